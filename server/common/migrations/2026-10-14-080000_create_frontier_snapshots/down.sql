@@ -0,0 +1,3 @@
+-- This file should undo anything in `up.sql`
+DROP TABLE frontier_entries;
+DROP TABLE frontier_snapshots;
\ No newline at end of file
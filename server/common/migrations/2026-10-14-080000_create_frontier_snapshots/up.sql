@@ -0,0 +1,19 @@
+CREATE TABLE frontier_snapshots
+(
+    id        SERIAL PRIMARY KEY,
+
+    taken_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+    completed BOOLEAN   NOT NULL DEFAULT FALSE -- Whether all the entries of the snapshot have been written.
+);
+
+CREATE TABLE frontier_entries
+(
+    snapshot_id INT           NOT NULL, -- The ID of the snapshot the entry belongs to.
+
+    url         VARCHAR(8192) NOT NULL, -- The URL waiting to be crawled.
+    depth       INT           NOT NULL, -- The depth the URL was queued at.
+
+    PRIMARY KEY (snapshot_id, url),
+
+    FOREIGN KEY (snapshot_id) REFERENCES frontier_snapshots (id) ON DELETE CASCADE
+);
\ No newline at end of file
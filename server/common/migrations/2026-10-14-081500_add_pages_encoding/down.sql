@@ -0,0 +1,2 @@
+-- This file should undo anything in `up.sql`
+ALTER TABLE pages DROP COLUMN encoding;
\ No newline at end of file
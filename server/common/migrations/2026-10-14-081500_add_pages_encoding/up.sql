@@ -0,0 +1,3 @@
+-- The encoding the page was decoded from, for debugging.
+ALTER TABLE pages
+    ADD COLUMN encoding VARCHAR(32) DEFAULT NULL;
\ No newline at end of file
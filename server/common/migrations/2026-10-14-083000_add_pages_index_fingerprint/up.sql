@@ -0,0 +1,5 @@
+-- The fingerprint of the dictionary the page was indexed with, pages with an outdated fingerprint need reindexing.
+ALTER TABLE pages
+    ADD COLUMN index_fingerprint VARCHAR(64) DEFAULT NULL;
+
+CREATE INDEX pages_index_fingerprint_idx ON pages (index_fingerprint);
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- This file should undo anything in `up.sql`
+DROP TABLE click_stats;
+DROP TABLE clicks;
\ No newline at end of file
@@ -0,0 +1,21 @@
+CREATE TABLE clicks
+(
+    id         SERIAL PRIMARY KEY,
+
+    query_hash VARCHAR(64)   NOT NULL,              -- The SHA-256 hash of the stemmed query, the query itself is never stored.
+    url        VARCHAR(8192) NOT NULL,              -- The URL of the result that was clicked.
+    position   INT           NOT NULL,              -- The 1-based position the result was shown at.
+    ip_prefix  VARCHAR(64)   NOT NULL,              -- The truncated IP address of the client.
+    clicked_at TIMESTAMP     NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE click_stats
+(
+    query_hash         VARCHAR(64)      NOT NULL,
+    url                VARCHAR(8192)    NOT NULL,
+
+    clicks             INT              NOT NULL, -- The number of clicks on the result for the query.
+    click_through_rate DOUBLE PRECISION NOT NULL, -- The position bias corrected share of the clicks for the query.
+
+    PRIMARY KEY (query_hash, url)
+);
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- This file should undo anything in `up.sql`
+ALTER TABLE clicks DROP COLUMN variant;
+DROP TABLE searches;
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE searches
+(
+    id          SERIAL PRIMARY KEY,
+
+    query_hash  VARCHAR(64) NOT NULL,                   -- The SHA-256 hash of the stemmed query, the query itself is never stored.
+    variant     VARCHAR(64) NOT NULL DEFAULT 'control', -- The ranking variant the results were ranked with.
+    results     INT         NOT NULL,                   -- The number of pages found.
+    searched_at TIMESTAMP   NOT NULL DEFAULT NOW()
+);
+
+-- The ranking variant the clicked result was ranked with.
+ALTER TABLE clicks
+    ADD COLUMN variant VARCHAR(64) NOT NULL DEFAULT 'control';
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- This file should undo anything in `up.sql`
+DROP TABLE page_history;
+ALTER TABLE pages DROP COLUMN first_seen_at;
\ No newline at end of file
@@ -0,0 +1,21 @@
+-- When the page was first crawled, it's kept as is when the page is crawled again.
+ALTER TABLE pages
+    ADD COLUMN first_seen_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+UPDATE pages
+SET first_seen_at = last_crawled_at;
+
+CREATE TABLE page_history
+(
+    id           SERIAL PRIMARY KEY,
+    page_id      INT         NOT NULL,
+
+    crawled_at   TIMESTAMP   NOT NULL DEFAULT NOW(),
+    content_hash VARCHAR(64) NOT NULL, -- The SHA-256 hash of the body of the page.
+    status       INT         NOT NULL, -- The HTTP status code of the response.
+    size         INT         NOT NULL, -- The size of the body in bytes.
+
+    FOREIGN KEY (page_id) REFERENCES pages (id) ON DELETE CASCADE
+);
+
+CREATE INDEX page_history_page_id_crawled_at_idx ON page_history (page_id, crawled_at DESC);
\ No newline at end of file
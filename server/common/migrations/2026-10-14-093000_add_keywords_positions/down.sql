@@ -0,0 +1,2 @@
+-- This file should undo anything in `up.sql`
+ALTER TABLE keywords DROP COLUMN positions;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- The positions of the first occurrences of the word on the page, counted in words from the start of the body.
+ALTER TABLE keywords
+    ADD COLUMN positions INT[] NOT NULL DEFAULT '{}';
\ No newline at end of file
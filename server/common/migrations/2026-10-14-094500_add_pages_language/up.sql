@@ -0,0 +1,5 @@
+-- The primary language of the page, like `da` or `en`, from the `lang` attribute of its `html` element.
+ALTER TABLE pages
+    ADD COLUMN language VARCHAR(8) DEFAULT NULL;
+
+CREATE INDEX pages_language_idx ON pages (language);
\ No newline at end of file
@@ -0,0 +1,16 @@
+CREATE TABLE submissions
+(
+    id           SERIAL PRIMARY KEY,
+
+    url          VARCHAR(8192) NOT NULL UNIQUE,
+    domain       VARCHAR(256)  NOT NULL,                -- The host of the URL, submissions are capped per domain.
+    ip_prefix    VARCHAR(64)   NOT NULL,                -- The truncated IP address of the submitter.
+    token        VARCHAR(64)   NOT NULL,                -- The token the site has to publish to verify the submission.
+    verified     BOOLEAN       NOT NULL DEFAULT FALSE,  -- Whether the site published the token, verified URLs are crawled first.
+    queued       BOOLEAN       NOT NULL DEFAULT FALSE,  -- Whether the crawler has queued the URL.
+    submitted_at TIMESTAMP     NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX submissions_domain_idx ON submissions (domain, submitted_at);
+CREATE INDEX submissions_ip_prefix_idx ON submissions (ip_prefix, submitted_at);
+CREATE INDEX submissions_queued_idx ON submissions (queued);
@@ -0,0 +1,2 @@
+-- This file should undo anything in `up.sql`
+DROP TABLE crawl_usage;
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE crawl_usage
+(
+    day      TIMESTAMP    NOT NULL,           -- The start of the UTC day the usage was recorded on.
+    run_id   VARCHAR(64)  NOT NULL,           -- The crawl run the usage was recorded by.
+    host     VARCHAR(256) NOT NULL,
+
+    bytes    BIGINT       NOT NULL DEFAULT 0, -- The bytes of the bodies downloaded, including robots.txt files.
+    requests BIGINT       NOT NULL DEFAULT 0, -- The number of requests made.
+
+    PRIMARY KEY (day, run_id, host)
+);
@@ -0,0 +1,16 @@
+CREATE TABLE crawl_log
+(
+    id         BIGSERIAL PRIMARY KEY,
+
+    url        VARCHAR(8192) NOT NULL,
+    host       VARCHAR(256)  NOT NULL,
+    status     INT                    DEFAULT NULL, -- The HTTP status code of the response, if there was one.
+    error_code VARCHAR(64)            DEFAULT NULL, -- The stable code of the error the crawl failed with, if any.
+    crawled_at TIMESTAMP     NOT NULL DEFAULT NOW()
+);
+
+-- Every filter is combined with a time window, newest first.
+CREATE INDEX crawl_log_crawled_at_idx ON crawl_log (crawled_at DESC, id DESC);
+CREATE INDEX crawl_log_host_idx ON crawl_log (host, crawled_at DESC);
+CREATE INDEX crawl_log_status_idx ON crawl_log (status, crawled_at DESC);
+CREATE INDEX crawl_log_error_code_idx ON crawl_log (error_code, crawled_at DESC);
@@ -0,0 +1,2 @@
+-- This file should undo anything in `up.sql`
+ALTER TABLE pages DROP COLUMN published_at, DROP COLUMN content_modified_at;
\ No newline at end of file
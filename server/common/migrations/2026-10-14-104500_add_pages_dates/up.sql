@@ -0,0 +1,6 @@
+-- When the content of the page was published and last modified, from its structured data, meta tags, `time` elements or URL.
+ALTER TABLE pages
+    ADD COLUMN published_at        TIMESTAMP DEFAULT NULL,
+    ADD COLUMN content_modified_at TIMESTAMP DEFAULT NULL;
+
+CREATE INDEX pages_published_at_idx ON pages (published_at);
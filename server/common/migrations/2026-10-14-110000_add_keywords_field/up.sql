@@ -0,0 +1,3 @@
+-- The part of the page the word is from, `title` or `body`.
+ALTER TABLE keywords
+    ADD COLUMN field VARCHAR(8) NOT NULL DEFAULT 'body';
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- The text of the page, compressed with zstd behind a format byte, or plain UTF-8 written before compression.
+ALTER TABLE pages
+    ADD COLUMN content BYTEA DEFAULT NULL;
\ No newline at end of file
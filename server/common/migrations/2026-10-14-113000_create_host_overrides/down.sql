@@ -0,0 +1,4 @@
+-- This file should undo anything in `up.sql`
+ALTER TABLE pages DROP COLUMN authenticated, DROP COLUMN excluded;
+
+DROP TABLE host_overrides;
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE host_overrides
+(
+    host                VARCHAR(256) PRIMARY KEY,
+    credentials         BYTEA   DEFAULT NULL,            -- The credentials sent to the host, encrypted with AES-GCM behind their nonce.
+    exclude_from_search BOOLEAN NOT NULL DEFAULT FALSE   -- Whether the pages fetched with the credentials are left out of search results.
+);
+
+-- Whether the page was fetched with the credentials of its host, and is left out of search results because of it.
+ALTER TABLE pages
+    ADD COLUMN authenticated BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN excluded      BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE curations
+(
+    id         SERIAL PRIMARY KEY,
+
+    pattern    VARCHAR(256)     NOT NULL, -- The normalized query the curation applies to.
+    url        VARCHAR(8192)    NOT NULL,
+    action     VARCHAR(16)      NOT NULL, -- `pin`, `boost`, `demote` or `block`.
+    weight     DOUBLE PRECISION NOT NULL DEFAULT 1,
+    expires_at TIMESTAMP                 DEFAULT NULL,
+    created_at TIMESTAMP        NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX curations_pattern_idx ON curations (pattern);
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE domain_authorities
+(
+    domain          VARCHAR(256)     PRIMARY KEY,
+
+    score           DOUBLE PRECISION NOT NULL,               -- The authority of the domain, from 0 to 1.
+    linking_domains INT              NOT NULL DEFAULT 0,     -- The number of other domains linking to the domain.
+    seeded          BOOLEAN          NOT NULL DEFAULT FALSE, -- Whether the score was set by an operator instead of derived.
+    updated_at      TIMESTAMP        NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
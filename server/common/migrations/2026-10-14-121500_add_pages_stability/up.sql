@@ -0,0 +1,4 @@
+-- Whether the response of the page varies by cookie or sets one, and whether its content changed between two fetches right after each other.
+ALTER TABLE pages
+    ADD COLUMN personalized BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN unstable     BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- Whether the page may not be shown from the cache, because of a `noarchive` directive.
+ALTER TABLE pages ADD COLUMN noarchive BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
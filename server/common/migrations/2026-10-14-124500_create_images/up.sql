@@ -0,0 +1,14 @@
+CREATE TABLE images
+(
+    id       SERIAL PRIMARY KEY,
+    page_id  INT           NOT NULL,
+
+    url      VARCHAR(8192) NOT NULL,
+    alt      VARCHAR(1024),          -- The alt text of the image.
+    caption  VARCHAR(1024),          -- The caption of the figure the image is in.
+    position INT           NOT NULL, -- The order of the image on the page, starting at 0.
+
+    FOREIGN KEY (page_id) REFERENCES pages (id) ON DELETE CASCADE
+);
+
+CREATE INDEX images_page_id_position_idx ON images (page_id, position);
\ No newline at end of file
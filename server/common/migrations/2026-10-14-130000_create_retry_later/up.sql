@@ -0,0 +1,11 @@
+CREATE TABLE retry_later
+(
+    url             VARCHAR(8192) PRIMARY KEY,
+    depth           INT           NOT NULL,                -- The depth the URL was queued at.
+    attempts        INT           NOT NULL,                -- The number of times fetching the URL failed.
+    error           VARCHAR(64)   NOT NULL,                -- The code of the last error.
+    dead            BOOLEAN       NOT NULL DEFAULT FALSE,  -- Whether the URL ran out of attempts, and is not retried anymore.
+    next_attempt_at TIMESTAMP     NOT NULL
+);
+
+CREATE INDEX retry_later_next_attempt_at_idx ON retry_later (dead, next_attempt_at);
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- The ETag and Last-Modified headers of the latest response of the page, sent back to only fetch it again if it changed.
+ALTER TABLE pages
+    ADD COLUMN etag          VARCHAR(1024),
+    ADD COLUMN last_modified VARCHAR(64);
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE redirects
+(
+    url       VARCHAR(8192) PRIMARY KEY,               -- The URL that redirects, which is an alias of the final URL.
+    next_url  VARCHAR(8192) NOT NULL,                  -- The URL it redirects to.
+    final_url VARCHAR(8192) NOT NULL,                  -- The URL the chain of redirects ends at, which is indexed instead.
+    hop       INT           NOT NULL,                  -- The position of the redirect in the chain, starting at 1.
+    status    INT           NOT NULL,                  -- The status code of the redirect.
+    seen_at   TIMESTAMP     NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX redirects_final_url_idx ON redirects (final_url);
@@ -0,0 +1,8 @@
+CREATE TABLE canonicals
+(
+    url           VARCHAR(8192) PRIMARY KEY,           -- The URL of a variant of a page, which is an alias of its canonical URL.
+    canonical_url VARCHAR(8192) NOT NULL,              -- The canonical URL the variant declares, which is indexed instead.
+    seen_at       TIMESTAMP     NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX canonicals_canonical_url_idx ON canonicals (canonical_url);
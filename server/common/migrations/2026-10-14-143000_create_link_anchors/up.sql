@@ -0,0 +1,12 @@
+CREATE TABLE link_anchors
+(
+    from_page_id INT           NOT NULL,
+    to_page_url  VARCHAR(8192) NOT NULL,
+
+    text         VARCHAR(1024) NOT NULL, -- The distinct anchor texts of the links, one per line.
+
+    PRIMARY KEY (from_page_id, to_page_url),
+    FOREIGN KEY (from_page_id) REFERENCES pages (id) ON DELETE CASCADE
+);
+
+CREATE INDEX link_anchors_to_page_url_idx ON link_anchors (to_page_url);
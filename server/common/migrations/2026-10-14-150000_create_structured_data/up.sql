@@ -0,0 +1,14 @@
+CREATE TABLE structured_data
+(
+    id       SERIAL PRIMARY KEY,
+    page_id  INT         NOT NULL,
+
+    kind     VARCHAR(32) NOT NULL, -- The kind of the entity, like `article` or `product`.
+    data     TEXT        NOT NULL, -- The JSON-LD of the entity.
+    position INT         NOT NULL, -- The order of the entity on the page, starting at 0.
+
+    FOREIGN KEY (page_id) REFERENCES pages (id) ON DELETE CASCADE
+);
+
+CREATE INDEX structured_data_page_id_position_idx ON structured_data (page_id, position);
+CREATE INDEX structured_data_kind_idx ON structured_data (kind);
@@ -0,0 +1,3 @@
+-- This file should undo anything in `up.sql`
+DROP TABLE near_duplicates;
+DROP TABLE simhashes;
\ No newline at end of file
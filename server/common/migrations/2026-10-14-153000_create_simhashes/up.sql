@@ -0,0 +1,27 @@
+CREATE TABLE simhashes
+(
+    page_id INT PRIMARY KEY,
+
+    simhash BIGINT NOT NULL, -- The simhash of the text of the page.
+    band_0  INT    NOT NULL, -- The bands of the simhash, from its highest 16 bits to its lowest, to look up similar ones.
+    band_1  INT    NOT NULL,
+    band_2  INT    NOT NULL,
+    band_3  INT    NOT NULL,
+
+    FOREIGN KEY (page_id) REFERENCES pages (id) ON DELETE CASCADE
+);
+
+CREATE INDEX simhashes_band_0_idx ON simhashes (band_0);
+CREATE INDEX simhashes_band_1_idx ON simhashes (band_1);
+CREATE INDEX simhashes_band_2_idx ON simhashes (band_2);
+CREATE INDEX simhashes_band_3_idx ON simhashes (band_3);
+
+CREATE TABLE near_duplicates
+(
+    url          VARCHAR(8192) PRIMARY KEY,           -- The URL of a page nearly the same as another, which isn't indexed.
+    duplicate_of VARCHAR(8192) NOT NULL,              -- The URL of the indexed page it's nearly the same as.
+    distance     INT           NOT NULL,              -- The number of bits their simhashes differ in.
+    seen_at      TIMESTAMP     NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX near_duplicates_duplicate_of_idx ON near_duplicates (duplicate_of);
@@ -0,0 +1,6 @@
+-- When the page was last fetched with a 2xx or 304 response, unlike `last_crawled_at` which every response updates.
+ALTER TABLE pages
+    ADD COLUMN last_succeeded_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+UPDATE pages
+SET last_succeeded_at = last_crawled_at;
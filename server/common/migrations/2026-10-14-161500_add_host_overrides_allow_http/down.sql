@@ -0,0 +1,2 @@
+-- This file should undo anything in `up.sql`
+ALTER TABLE host_overrides DROP COLUMN allow_http;
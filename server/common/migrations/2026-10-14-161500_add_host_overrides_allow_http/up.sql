@@ -0,0 +1,3 @@
+-- Whether the credentials are also sent to the host over plain HTTP, where anyone on the way can read them.
+ALTER TABLE host_overrides
+    ADD COLUMN allow_http BOOLEAN NOT NULL DEFAULT FALSE;
@@ -1,15 +1,28 @@
-use crate::database::model::{ForwardLink, Keyword, NewForwardLink, NewKeyword, NewPage, Page};
+use crate::database::model::{
+    Canonical, ClickStat, CrawlEvent, CrawlLogFilter, CrawlUsage, Curation, DomainAuthority,
+    ForwardLink, FrontierEntry, FrontierSnapshot, HostOverride, Image, Keyword, LinkAnchor,
+    NearDuplicate, NewClick, NewCrawlEvent, NewCuration, NewForwardLink, NewImage, NewKeyword,
+    NewLinkAnchor, NewPage, NewPageHistory, NewSearch, NewSimhash, NewStructuredData,
+    NewSubmission, Page, PageHistory, Redirect, Retry, RowCounts, StructuredData, Submission,
+    WordMatch,
+};
 use crate::errors::Error;
+use crate::utils::compression::Codec;
+use crate::utils::simhash;
+use crate::utils::urls;
 use diesel::{ConnectionResult, ExpressionMethods, OptionalExtension, QueryDsl, SelectableHelper};
 use diesel_async::{AsyncConnection, AsyncPgConnection, RunQueryDsl};
 use log::info;
 use serde::{Deserialize, Serialize};
 use std::collections::hash_map::RandomState;
-use std::collections::HashMap;
+use std::collections::{HashMap, HashSet};
+use std::time::{Duration, SystemTime};
 use url::Url;
 
 pub mod model;
+pub mod retry;
 mod schema;
+pub mod store;
 
 /// Gets a database connection.
 ///
@@ -33,16 +46,33 @@ pub async fn get_connection() -> ConnectionResult<AsyncPgConnection> {
         .expect("DATABASE_URL must be valid UTF-8!")
         .to_string();
 
-    AsyncPgConnection::establish(&url).await
+    get_connection_to(&url).await
 }
 
-/// Creates a new page.
+/// Gets a connection to a specific database.
+///
+/// # Arguments
+///
+/// * `url`: The URL of the database.
+///
+/// # Returns
+///
+/// * `ConnectionResult<AsyncPgConnection>` - The database connection if successful.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+pub async fn get_connection_to(url: &str) -> ConnectionResult<AsyncPgConnection> {
+    AsyncPgConnection::establish(url).await
+}
+
+/// Creates a new page, or updates it if a page with the same URL already exists.
 ///
 /// # Arguments
 ///
 /// * `conn`: The database connection.
 ///
-/// * `url`: The URL of the page.
+/// * `new_page`: The page to create.
 ///
 /// # Returns
 ///
@@ -52,226 +82,242 @@ pub async fn get_connection() -> ConnectionResult<AsyncPgConnection> {
 /// # Errors
 ///
 /// * If the page could not be created.
-pub async fn create_page(
-    conn: &mut AsyncPgConnection,
-    url: &Url,
-    title: Option<&str>,
-    description: Option<&str>,
-) -> Result<Page, Error> {
-    use crate::database::schema::pages::dsl::pages;
-
-    if let Some(page) = get_page_by_url(conn, url).await? {
-        info!("Page already exists: {}", url.to_string());
-
-        return Ok(page);
-    };
-
-    let new_page = NewPage {
-        url: url.to_string(),
-
-        title: title.map(std::string::ToString::to_string),
-        description: description.map(std::string::ToString::to_string),
-    };
+pub async fn create_page(conn: &mut AsyncPgConnection, new_page: &NewPage) -> Result<Page, Error> {
+    use crate::database::schema::pages::dsl::{last_crawled_at, pages, url};
 
     Ok(diesel::insert_into(pages)
-        .values(&new_page)
+        .values(new_page)
+        .on_conflict(url)
+        .do_update()
+        .set((new_page, last_crawled_at.eq(diesel::dsl::now)))
         .returning(Page::as_returning())
         .get_result(conn)
         .await?)
 }
 
-/// Gets the oldest pages.
+/// Creates new pages, or updates them if pages with the same URLs already exist, in as few queries as possible.
 ///
 /// # Arguments
 ///
 /// * `conn`: The database connection.
-/// * `limit`: The maximum number of pages to get.
+/// * `new_pages`: The pages to create, each URL only once.
 ///
 /// # Returns
 ///
-/// * `Ok(Vec<Page>)` - The oldest pages if successful.
-/// * `Err(Error)` - If the pages could not be retrieved.
+/// * `Ok(Vec<Page>)` - The created pages if successful, in no particular order.
+/// * `Err(Error)` - If the pages could not be created.
 ///
 /// # Errors
 ///
-/// * If the pages could not be retrieved.
-pub async fn get_oldest_pages(limit: i64) -> Result<Vec<Page>, Error> {
-    use crate::database::schema::pages::dsl::pages;
-    use crate::database::schema::pages::last_crawled_at;
-
-    let Ok(mut conn) = get_connection().await else {
-        return Err(Error::Database("Failed to get database connection!".into()));
+/// * If the pages could not be created, or the same URL is in `new_pages` more than once.
+pub async fn create_pages(
+    conn: &mut AsyncPgConnection,
+    new_pages: &[NewPage],
+) -> Result<Vec<Page>, Error> {
+    use crate::database::schema::pages::dsl::{
+        authenticated, content, content_modified_at, description, encoding, etag,
+        index_fingerprint, language, last_crawled_at, last_modified, noarchive, pages,
+        published_at, title, url,
     };
+    use diesel::upsert::excluded;
 
-    Ok(pages
-        .order(last_crawled_at.asc())
-        .limit(limit)
-        .load(&mut conn)
-        .await?)
+    let mut created_pages = Vec::with_capacity(new_pages.len());
+    for batch in new_pages.chunks(1_000) {
+        created_pages.extend(
+            diesel::insert_into(pages)
+                .values(batch)
+                .on_conflict(url)
+                .do_update()
+                .set((
+                    title.eq(excluded(title)),
+                    description.eq(excluded(description)),
+                    encoding.eq(excluded(encoding)),
+                    index_fingerprint.eq(excluded(index_fingerprint)),
+                    language.eq(excluded(language)),
+                    published_at.eq(excluded(published_at)),
+                    content_modified_at.eq(excluded(content_modified_at)),
+                    content.eq(excluded(content)),
+                    authenticated.eq(excluded(authenticated)),
+                    schema::pages::dsl::excluded.eq(excluded(schema::pages::dsl::excluded)),
+                    noarchive.eq(excluded(noarchive)),
+                    etag.eq(excluded(etag)),
+                    last_modified.eq(excluded(last_modified)),
+                    last_crawled_at.eq(diesel::dsl::now),
+                ))
+                .returning(Page::as_returning())
+                .get_results(conn)
+                .await?,
+        );
+    }
+
+    Ok(created_pages)
 }
 
-/// Creates new keywords.
+/// Restores a page from a backup, or updates it if a page with the same URL already exists.
 ///
 /// # Arguments
 ///
 /// * `conn`: The database connection.
-/// * `data`: The keywords to create.
+/// * `new_page`: The page to restore.
+/// * `crawled_at`: When the page was last crawled, according to the backup.
+/// * `first_seen`: When the page was first crawled, according to the backup.
 ///
 /// # Returns
 ///
-/// * `Ok(())`: If the keywords were successfully created.
-/// * `Err(diesel::result::Error)`: If the keywords weren't successfully inserted.
+/// * `Ok(Page)` - The restored page if successful.
+/// * `Err(Error)` - If the page could not be restored.
 ///
 /// # Errors
 ///
-/// * If the database failed to create the keywords.
-pub async fn create_keywords(
+/// * If the page could not be restored.
+///
+/// # Notes
+///
+/// * An existing page keeps when it was first seen.
+pub async fn restore_page(
     conn: &mut AsyncPgConnection,
-    data: &[NewKeyword],
-) -> Result<(), diesel::result::Error> {
-    use crate::database::schema::keywords::dsl::keywords;
-
-    diesel::insert_into(keywords)
-        .values(data)
-        .execute(conn)
-        .await?;
+    new_page: &NewPage,
+    crawled_at: SystemTime,
+    first_seen: SystemTime,
+) -> Result<Page, Error> {
+    use crate::database::schema::pages::dsl::{
+        first_seen_at, last_crawled_at, last_succeeded_at, pages, url,
+    };
 
-    Ok(())
+    // The backup doesn't say how the page responded, so it's taken to have succeeded when it was last crawled.
+    Ok(diesel::insert_into(pages)
+        .values((
+            new_page,
+            last_crawled_at.eq(crawled_at),
+            last_succeeded_at.eq(crawled_at),
+            first_seen_at.eq(first_seen),
+        ))
+        .on_conflict(url)
+        .do_update()
+        .set((
+            new_page,
+            last_crawled_at.eq(crawled_at),
+            last_succeeded_at.eq(crawled_at),
+        ))
+        .returning(Page::as_returning())
+        .get_result(conn)
+        .await?)
 }
 
-/// Creates new forward links.
+/// Records a crawl of a page, keeping only its latest crawls.
 ///
 /// # Arguments
 ///
 /// * `conn`: The database connection.
-/// * `from_page_url`: The page to create forward links for.
-/// * `to_page_urls`: The pages to create forward links to.
+/// * `new_entry`: The crawl to record.
+/// * `length`: The maximum number of crawls kept per page.
 ///
 /// # Returns
 ///
-/// * `Ok(())` - If the forward links were successfully created.
-/// * `Err(Error>)` - If the forward links were not created.
+/// * `Ok(())` - If the crawl was recorded.
+/// * `Err(Error)` - If the crawl could not be recorded.
 ///
 /// # Errors
 ///
-/// * If the forward links could not be created.
-pub async fn create_forward_links<S>(
+/// * If the crawl could not be recorded, or the older crawls could not be pruned.
+pub async fn create_page_history(
     conn: &mut AsyncPgConnection,
-    from_page_url: &Url,
-    to_page_urls: &HashMap<Url, i32, S>,
-) -> Result<(), Error>
-where
-    S: std::hash::BuildHasher + Send + Sync,
-    RandomState: std::hash::BuildHasher,
-{
-    use crate::database::schema::forward_links::dsl::forward_links;
-
-    // Get the page we're creating forward links for.
-    let Some(from_page) = get_page_by_url(conn, from_page_url).await? else {
-        return Err(Error::Database(format!(
-            "Failed to find page with URL: {from_page_url}!"
-        )));
-    };
-
-    let mut new_forward_links = Vec::new();
-    for (to_url, frequency) in to_page_urls {
-        /*
-        let Some(to_page) = get_page_by_url(conn, to_url).await? else {
-            return Err(Error::Database(format!(
-                "Failed to find page with URL: {to_url}!"
-            )));
-        };
-
-        new_forward_links.push(NewForwardLink {
-            from_page_id: from_page.id,
-            to_page_id: to_page.id,
-            frequency: *frequency,
-        });
-         */
+    new_entry: &NewPageHistory,
+    length: i64,
+) -> Result<(), Error> {
+    use crate::database::schema::page_history::dsl::page_history;
 
-        new_forward_links.push(NewForwardLink {
-            from_page_id: from_page.id,
-            to_page_url: to_url.to_string(),
-            frequency: *frequency,
-        });
-    }
-
-    diesel::insert_into(forward_links)
-        .values(new_forward_links)
+    diesel::insert_into(page_history)
+        .values(new_entry)
         .execute(conn)
         .await?;
 
-    Ok(())
+    prune_page_history(conn, new_entry.page_id, length).await
 }
 
-/// Gets a page by its ID.
+/// Records the crawls of many pages at once, keeping only their latest crawls.
 ///
 /// # Arguments
 ///
 /// * `conn`: The database connection.
-/// * `page_id`: The ID of the page.
+/// * `new_entries`: The crawls to record.
+/// * `length`: The maximum number of crawls kept per page.
 ///
 /// # Returns
 ///
-/// * `Ok(Some(Page))` - The page if successful.
-/// * `Ok(None)` - If no page was found.
-/// * `Err(diesel::result::Error)` - If the page could not be retrieved.
+/// * `Ok(())` - If the crawls were recorded.
+/// * `Err(Error)` - If the crawls could not be recorded.
 ///
 /// # Errors
 ///
-/// * If the page could not be retrieved.
-pub async fn get_page_by_id(
+/// * If the crawls could not be recorded, or the older crawls could not be pruned.
+pub async fn create_page_histories(
     conn: &mut AsyncPgConnection,
-    page_id: i32,
-) -> Result<Option<Page>, Error> {
-    use crate::database::schema::pages::dsl::pages;
-    use crate::database::schema::pages::id;
+    new_entries: &[NewPageHistory],
+    length: i64,
+) -> Result<(), Error> {
+    use crate::database::schema::page_history::dsl::page_history;
 
-    Ok(pages
-        .filter(id.eq(page_id))
-        .select(Page::as_select())
-        .first(conn)
-        .await
-        .optional()?)
+    for batch in new_entries.chunks(1_000) {
+        diesel::insert_into(page_history)
+            .values(batch)
+            .execute(conn)
+            .await?;
+    }
+
+    let page_ids = new_entries
+        .iter()
+        .map(|entry| entry.page_id)
+        .collect::<HashSet<_>>();
+    for page_id in page_ids {
+        prune_page_history(conn, page_id, length).await?;
+    }
+
+    Ok(())
 }
 
-/// Gets a page by its URL.
+/// Deletes all but the latest crawls of a page.
 ///
 /// # Arguments
 ///
 /// * `conn`: The database connection.
-/// * `url`: The URL of the page.
+/// * `page_id`: The ID of the page.
+/// * `length`: The number of crawls to keep.
 ///
 /// # Returns
 ///
-/// * `Ok(Some(Page))` - The page, if successful.
-/// * `Ok(None)` - If no page was found.
-/// * `Err(Error)` - If the page could not be retrieved.
+/// * `Ok(())` - If the older crawls were pruned.
+/// * `Err(Error)` - If the older crawls could not be pruned.
 ///
 /// # Errors
 ///
-/// * If the page could not be retrieved.
-pub async fn get_page_by_url(
+/// * If the older crawls could not be retrieved or deleted.
+async fn prune_page_history(
     conn: &mut AsyncPgConnection,
-    url: &Url,
-) -> Result<Option<Page>, Error> {
-    use crate::database::schema::pages::dsl::{pages, url as url_column};
+    page_id: i32,
+    length: i64,
+) -> Result<(), Error> {
+    use crate::database::schema::page_history::dsl::{
+        crawled_at, id, page_history, page_id as page_id_column,
+    };
 
-    Ok(pages
-        .filter(url_column.eq(url.to_string()))
-        .select(Page::as_select())
-        .first(conn)
-        .await
-        .optional()?)
-}
+    let pruned_ids = page_history
+        .filter(page_id_column.eq(page_id))
+        .order((crawled_at.desc(), id.desc()))
+        .offset(length)
+        .select(id)
+        .load::<i32>(conn)
+        .await?;
+    if !pruned_ids.is_empty() {
+        diesel::delete(page_history.filter(id.eq_any(pruned_ids)))
+            .execute(conn)
+            .await?;
+    }
 
-#[derive(Debug, Clone, Eq, PartialEq, Hash, Serialize, Deserialize)]
-pub struct CompletePage {
-    pub page: Page,
-    pub keywords: Option<Vec<Keyword>>,
+    Ok(())
 }
 
-/// Gets keywords by page ID.
+/// Gets the recorded crawls of a page.
 ///
 /// # Arguments
 ///
@@ -280,140 +326,2851 @@ pub struct CompletePage {
 ///
 /// # Returns
 ///
-/// * `Ok(Some(Vec<Keyword>))` - The keywords if successful.
-/// * `Ok(None)` - If no keywords were found.
-/// * `Err(diesel::result::Error)` - If the keywords could not be retrieved.
+/// * `Ok(Vec<PageHistory>)` - The crawls if successful, newest first.
+/// * `Err(Error)` - If the crawls could not be retrieved.
 ///
 /// # Errors
 ///
-/// * If the keywords could not be retrieved.
-pub async fn get_keywords_by_page_id(
+/// * If the crawls could not be retrieved.
+pub async fn get_page_history(
     conn: &mut AsyncPgConnection,
     page_id: i32,
-) -> Result<Option<Vec<Keyword>>, diesel::result::Error> {
-    use crate::database::schema::keywords::dsl::{keywords, page_id as page_id_column};
+) -> Result<Vec<PageHistory>, Error> {
+    use crate::database::schema::page_history::dsl::{
+        crawled_at, id, page_history, page_id as page_id_column,
+    };
 
-    keywords
+    Ok(page_history
         .filter(page_id_column.eq(page_id))
-        .select(Keyword::as_select())
+        .order((crawled_at.desc(), id.desc()))
+        .select(PageHistory::as_select())
         .load(conn)
-        .await
-        .optional()
+        .await?)
 }
 
-/// Get a series of pages matching a list of words
+/// Deletes the keywords, forward links, anchor texts, images, structured data and simhashes of a page, so it can be indexed again.
 ///
 /// # Arguments
 ///
 /// * `conn`: The database connection.
-/// * `words`: The words to search for.
+/// * `page_id`: The ID of the page.
 ///
 /// # Returns
 ///
-/// * `Ok(Some(Vec<Page>))` - The pages if successful.
-/// * `Ok(None)` - If no pages were found.
-/// * `Err(Error)` - If the pages could not be retrieved.
+/// * `Ok(())` - If the index of the page was deleted.
+/// * `Err(Error)` - If the index of the page could not be deleted.
 ///
 /// # Errors
 ///
-/// * If the pages could not be retrieved.
-pub async fn get_pages_with_words(
-    conn: &mut AsyncPgConnection,
-    words: Vec<String>,
-) -> Result<Option<Vec<Page>>, Error> {
-    use crate::database::schema::keywords::dsl::keywords;
-    use crate::database::schema::pages::dsl::pages;
-
-    // Search for pages that contain the words in their keywords.
-    let pages_with_keywords = keywords
-        .filter(schema::keywords::dsl::word.eq_any(&words))
-        .inner_join(pages)
-        .distinct()
-        .select(Page::as_select())
-        .load(conn)
-        .await
-        .optional()?;
-
-    // Search for pages that contain the words in their title or description.
-    let pages_with_title = pages
-        .filter(schema::pages::dsl::title.eq_any(&words))
-        .select(Page::as_select())
-        .load(conn)
-        .await
-        .optional()?;
-
-    let pages_with_description = pages
-        .filter(schema::pages::dsl::description.eq_any(&words))
-        .select(Page::as_select())
-        .load(conn)
-        .await
-        .optional()?;
-
-    // Combine the results.
-    let mut found_pages = Vec::new();
-
-    if let Some(mut data) = pages_with_keywords {
-        found_pages.append(&mut data);
-    }
-
-    if let Some(mut data) = pages_with_title {
-        found_pages.append(&mut data);
-    }
-
-    if let Some(mut data) = pages_with_description {
-        found_pages.append(&mut data);
-    }
+/// * If the keywords, forward links, anchor texts, images, structured data or simhashes could not be deleted.
+pub async fn delete_page_index(conn: &mut AsyncPgConnection, page_id: i32) -> Result<(), Error> {
+    use crate::database::schema::forward_links::dsl::{forward_links, from_page_id};
+    use crate::database::schema::images::dsl::{images, page_id as image_page_id};
+    use crate::database::schema::keywords::dsl::{keywords, page_id as page_id_column};
+    use crate::database::schema::link_anchors::dsl::{
+        from_page_id as anchor_page_id, link_anchors,
+    };
+    use crate::database::schema::simhashes::dsl::{page_id as simhash_page_id, simhashes};
+    use crate::database::schema::structured_data::dsl::{page_id as data_page_id, structured_data};
 
-    if found_pages.is_empty() {
-        return Ok(None);
-    }
+    diesel::delete(keywords.filter(page_id_column.eq(page_id)))
+        .execute(conn)
+        .await?;
+    diesel::delete(forward_links.filter(from_page_id.eq(page_id)))
+        .execute(conn)
+        .await?;
+    diesel::delete(images.filter(image_page_id.eq(page_id)))
+        .execute(conn)
+        .await?;
+    diesel::delete(link_anchors.filter(anchor_page_id.eq(page_id)))
+        .execute(conn)
+        .await?;
+    diesel::delete(structured_data.filter(data_page_id.eq(page_id)))
+        .execute(conn)
+        .await?;
+    diesel::delete(simhashes.filter(simhash_page_id.eq(page_id)))
+        .execute(conn)
+        .await?;
 
-    Ok(Some(found_pages))
+    Ok(())
 }
 
-/// Get the backlinks for a given page.
+/// Deletes the keywords, forward links, anchor texts, images, structured data and simhashes of many pages at once, so they can be indexed again.
 ///
 /// # Arguments
 ///
 /// * `conn`: The database connection.
-/// * `page`: The page to get backlinks for.
+/// * `page_ids`: The IDs of the pages.
 ///
 /// # Returns
 ///
-/// * `Ok(Vec<CompletePage>)` - The backlinks if successful.
-/// * `Err(Box<dyn std::errors::Error>)` - If the backlinks could not be retrieved.
+/// * `Ok(())` - If the indexes of the pages were deleted.
+/// * `Err(Error)` - If the indexes of the pages could not be deleted.
 ///
 /// # Errors
 ///
-/// * If the backlinks could not be retrieved.
-pub async fn get_backlinks(
+/// * If the keywords, forward links, anchor texts, images, structured data or simhashes could not be deleted.
+pub async fn delete_page_indexes(
     conn: &mut AsyncPgConnection,
-    page: &CompletePage,
-) -> Result<Vec<CompletePage>, Error> {
-    use crate::database::schema::forward_links::dsl::forward_links;
+    page_ids: &[i32],
+) -> Result<(), Error> {
+    use crate::database::schema::forward_links::dsl::{forward_links, from_page_id};
+    use crate::database::schema::images::dsl::{images, page_id as image_page_id};
+    use crate::database::schema::keywords::dsl::{keywords, page_id};
+    use crate::database::schema::link_anchors::dsl::{
+        from_page_id as anchor_page_id, link_anchors,
+    };
+    use crate::database::schema::simhashes::dsl::{page_id as simhash_page_id, simhashes};
+    use crate::database::schema::structured_data::dsl::{page_id as data_page_id, structured_data};
+
+    diesel::delete(keywords.filter(page_id.eq_any(page_ids)))
+        .execute(conn)
+        .await?;
+    diesel::delete(forward_links.filter(from_page_id.eq_any(page_ids)))
+        .execute(conn)
+        .await?;
+    diesel::delete(images.filter(image_page_id.eq_any(page_ids)))
+        .execute(conn)
+        .await?;
+    diesel::delete(link_anchors.filter(anchor_page_id.eq_any(page_ids)))
+        .execute(conn)
+        .await?;
+    diesel::delete(structured_data.filter(data_page_id.eq_any(page_ids)))
+        .execute(conn)
+        .await?;
+    diesel::delete(simhashes.filter(simhash_page_id.eq_any(page_ids)))
+        .execute(conn)
+        .await?;
+
+    Ok(())
+}
+
+/// Gets the URLs of the pages indexed with a different dictionary.
+///
+/// # Arguments
+///
+/// * `fingerprint`: The fingerprint of the current dictionary.
+///
+/// # Returns
+///
+/// * `Ok(Vec<Url>)` - The URLs of the pages that need to be reindexed.
+/// * `Err(Error)` - If the pages could not be retrieved.
+///
+/// # Errors
+///
+/// * If the pages could not be retrieved.
+pub async fn get_stale_page_urls(fingerprint: &str) -> Result<Vec<Url>, Error> {
+    use crate::database::schema::pages::dsl::{index_fingerprint, pages, url};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    Ok(pages
+        .filter(
+            index_fingerprint
+                .is_null()
+                .or(index_fingerprint.ne(fingerprint)),
+        )
+        .select(url)
+        .load::<String>(&mut conn)
+        .await?
+        .into_iter()
+        .filter_map(|page_url| Url::parse(&page_url).ok())
+        .collect())
+}
+
+/// Gets a batch of the pages that are stale, after a page.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `succeeded_before`: The time the pages must have last been fetched successfully before to be stale, if any.
+/// * `after_id`: The ID of the page to start after.
+/// * `limit`: The maximum number of pages to get.
+///
+/// # Returns
+///
+/// * `Ok(Vec<(i32, String)>)` - The IDs and URLs of the pages, empty once there are no more.
+/// * `Err(Error)` - If the pages could not be retrieved.
+///
+/// # Errors
+///
+/// * If the pages could not be retrieved.
+///
+/// # Notes
+///
+/// * Pages whose URL failed to be fetched too many times to be retried are stale regardless of when they were crawled.
+/// * Pages are compared by their last 2xx or 304 response, so pages that keep failing go stale even though they're crawled.
+pub async fn get_stale_pages_after(
+    conn: &mut AsyncPgConnection,
+    succeeded_before: Option<SystemTime>,
+    after_id: i32,
+    limit: i64,
+) -> Result<Vec<(i32, String)>, Error> {
+    use crate::database::schema::pages::dsl::{id, last_succeeded_at, pages, url};
+    use crate::database::schema::retry_later::dsl::{dead, retry_later, url as retry_url};
+
+    let dead_urls = || retry_later.filter(dead.eq(true)).select(retry_url);
+    let query = pages.filter(id.gt(after_id)).into_boxed();
+    let query = match succeeded_before {
+        Some(succeeded_before) => query.filter(
+            last_succeeded_at
+                .lt(succeeded_before)
+                .or(url.eq_any(dead_urls())),
+        ),
+        None => query.filter(url.eq_any(dead_urls())),
+    };
+
+    Ok(query
+        .order(id.asc())
+        .limit(limit)
+        .select((id, url))
+        .load(conn)
+        .await?)
+}
+
+/// Deletes pages, along with their keywords, links, anchor texts, images, structured data and history.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `page_ids`: The IDs of the pages.
+///
+/// # Returns
+///
+/// * `Ok(usize)` - The number of pages deleted.
+/// * `Err(Error)` - If the pages could not be deleted.
+///
+/// # Errors
+///
+/// * If the pages could not be deleted.
+///
+/// # Notes
+///
+/// * Everything else is deleted by the cascades, in the same statement, so a page is never left half deleted.
+/// * The links from other pages to the deleted pages are kept, since they're part of the pages linking to them.
+pub async fn delete_pages(conn: &mut AsyncPgConnection, page_ids: &[i32]) -> Result<usize, Error> {
+    use crate::database::schema::pages::dsl::{id, pages};
+
+    Ok(diesel::delete(pages.filter(id.eq_any(page_ids)))
+        .execute(conn)
+        .await?)
+}
+
+/// Gets the oldest pages.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `limit`: The maximum number of pages to get.
+///
+/// # Returns
+///
+/// * `Ok(Vec<Page>)` - The oldest pages if successful.
+/// * `Err(Error)` - If the pages could not be retrieved.
+///
+/// # Errors
+///
+/// * If the pages could not be retrieved.
+pub async fn get_oldest_pages(limit: i64) -> Result<Vec<Page>, Error> {
     use crate::database::schema::pages::dsl::pages;
+    use crate::database::schema::pages::last_crawled_at;
 
-    let mut backlinks = Vec::new();
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
 
-    let links = forward_links
-        .filter(schema::forward_links::dsl::to_page_url.eq(&page.page.url))
-        .select(ForwardLink::as_select())
+    Ok(pages
+        .order(last_crawled_at.asc())
+        .limit(limit)
+        .select(Page::as_select())
+        .load(&mut conn)
+        .await?)
+}
+
+/// Gets the pages after a page, in the order of their IDs.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `after_id`: The ID of the page to start after.
+/// * `limit`: The maximum number of pages to get.
+///
+/// # Returns
+///
+/// * `Ok(Vec<Page>)` - The pages if successful, empty once there are no more pages.
+/// * `Err(Error)` - If the pages could not be retrieved.
+///
+/// # Errors
+///
+/// * If the pages could not be retrieved.
+///
+/// # Notes
+///
+/// * Paging by ID rather than by offset keeps every page equally fast to get, however far into the pages it is.
+pub async fn get_pages_after(
+    conn: &mut AsyncPgConnection,
+    after_id: i32,
+    limit: i64,
+) -> Result<Vec<Page>, Error> {
+    use crate::database::schema::pages::dsl::{id, pages};
+
+    Ok(pages
+        .filter(id.gt(after_id))
+        .order(id.asc())
+        .limit(limit)
+        .select(Page::as_select())
         .load(conn)
+        .await?)
+}
+
+/// Creates new keywords.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `data`: The keywords to create.
+///
+/// # Returns
+///
+/// * `Ok(())`: If the keywords were successfully created.
+/// * `Err(diesel::result::Error)`: If the keywords weren't successfully inserted.
+///
+/// # Errors
+///
+/// * If the database failed to create the keywords.
+pub async fn create_keywords(
+    conn: &mut AsyncPgConnection,
+    data: &[NewKeyword],
+) -> Result<(), diesel::result::Error> {
+    use crate::database::schema::keywords::dsl::keywords;
+
+    diesel::insert_into(keywords)
+        .values(data)
+        .execute(conn)
         .await?;
 
-    for link in links {
-        let page = pages
-            .filter(schema::pages::dsl::id.eq(link.from_page_id))
-            .select(Page::as_select())
-            .first(conn)
-            .await?;
+    Ok(())
+}
 
-        let keywords = get_keywords_by_page_id(conn, page.id).await?;
+/// Creates new forward links.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `from_page_url`: The page to create forward links for.
+/// * `to_page_urls`: The pages to create forward links to.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the forward links were successfully created.
+/// * `Err(Error>)` - If the forward links were not created.
+///
+/// # Errors
+///
+/// * If the forward links could not be created.
+pub async fn create_forward_links<S>(
+    conn: &mut AsyncPgConnection,
+    from_page_url: &Url,
+    to_page_urls: &HashMap<Url, i32, S>,
+) -> Result<(), Error>
+where
+    S: std::hash::BuildHasher + Send + Sync,
+    RandomState: std::hash::BuildHasher,
+{
+    use crate::database::schema::forward_links::dsl::forward_links;
 
-        let complete_page = CompletePage { page, keywords };
+    // Get the page we're creating forward links for.
+    let Some(from_page) = get_page_by_url(conn, from_page_url).await? else {
+        return Err(Error::Database(format!(
+            "Failed to find page with URL: {from_page_url}!"
+        )));
+    };
 
-        backlinks.push(complete_page);
+    let mut new_forward_links = Vec::new();
+    for (to_url, frequency) in to_page_urls {
+        /*
+        let Some(to_page) = get_page_by_url(conn, to_url).await? else {
+            return Err(Error::Database(format!(
+                "Failed to find page with URL: {to_url}!"
+            )));
+        };
+
+        new_forward_links.push(NewForwardLink {
+            from_page_id: from_page.id,
+            to_page_id: to_page.id,
+            frequency: *frequency,
+        });
+         */
+
+        new_forward_links.push(NewForwardLink {
+            from_page_id: from_page.id,
+            to_page_url: to_url.to_string(),
+            frequency: *frequency,
+        });
     }
 
-    Ok(backlinks)
+    diesel::insert_into(forward_links)
+        .values(new_forward_links)
+        .execute(conn)
+        .await?;
+
+    Ok(())
+}
+
+/// Inserts forward links of pages that are already known.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `new_forward_links`: The forward links to insert.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the forward links were successfully inserted.
+/// * `Err(Error)` - If the forward links were not inserted.
+///
+/// # Errors
+///
+/// * If the forward links could not be inserted.
+pub async fn insert_forward_links(
+    conn: &mut AsyncPgConnection,
+    new_forward_links: &[NewForwardLink],
+) -> Result<(), Error> {
+    use crate::database::schema::forward_links::dsl::forward_links;
+
+    for batch in new_forward_links.chunks(10_000) {
+        diesel::insert_into(forward_links)
+            .values(batch)
+            .execute(conn)
+            .await?;
+    }
+
+    Ok(())
+}
+
+/// Gets the forward links on a page.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `page_id`: The ID of the page.
+///
+/// # Returns
+///
+/// * `Ok(Vec<ForwardLink>)` - The forward links if successful.
+/// * `Err(Error)` - If the forward links could not be retrieved.
+///
+/// # Errors
+///
+/// * If the forward links could not be retrieved.
+pub async fn get_forward_links_by_page_id(
+    conn: &mut AsyncPgConnection,
+    page_id: i32,
+) -> Result<Vec<ForwardLink>, Error> {
+    use crate::database::schema::forward_links::dsl::{forward_links, from_page_id};
+
+    Ok(forward_links
+        .filter(from_page_id.eq(page_id))
+        .select(ForwardLink::as_select())
+        .load(conn)
+        .await?)
+}
+
+/// Inserts the images of pages.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `new_images`: The images to insert.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the images were successfully inserted.
+/// * `Err(Error)` - If the images were not inserted.
+///
+/// # Errors
+///
+/// * If the images could not be inserted.
+pub async fn create_images(
+    conn: &mut AsyncPgConnection,
+    new_images: &[NewImage],
+) -> Result<(), Error> {
+    use crate::database::schema::images::dsl::images;
+
+    for batch in new_images.chunks(10_000) {
+        diesel::insert_into(images)
+            .values(batch)
+            .execute(conn)
+            .await?;
+    }
+
+    Ok(())
+}
+
+/// Inserts the structured data of pages.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `new_structured_data`: The structured data entities to insert.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the entities were successfully inserted.
+/// * `Err(Error)` - If the entities were not inserted.
+///
+/// # Errors
+///
+/// * If the entities could not be inserted.
+pub async fn create_structured_data(
+    conn: &mut AsyncPgConnection,
+    new_structured_data: &[NewStructuredData],
+) -> Result<(), Error> {
+    use crate::database::schema::structured_data::dsl::structured_data;
+
+    for batch in new_structured_data.chunks(10_000) {
+        diesel::insert_into(structured_data)
+            .values(batch)
+            .execute(conn)
+            .await?;
+    }
+
+    Ok(())
+}
+
+/// Gets the structured data of a page.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `page_id`: The ID of the page.
+///
+/// # Returns
+///
+/// * `Ok(Vec<StructuredData>)` - The entities, in the order they're on the page.
+/// * `Err(Error)` - If the entities could not be retrieved.
+///
+/// # Errors
+///
+/// * If the entities could not be retrieved.
+pub async fn get_structured_data_by_page_id(
+    conn: &mut AsyncPgConnection,
+    page_id: i32,
+) -> Result<Vec<StructuredData>, Error> {
+    use crate::database::schema::structured_data::dsl::{
+        page_id as page_id_column, position, structured_data,
+    };
+
+    Ok(structured_data
+        .filter(page_id_column.eq(page_id))
+        .order(position)
+        .select(StructuredData::as_select())
+        .load(conn)
+        .await?)
+}
+
+/// Inserts the simhashes of the text of pages.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `new_simhashes`: The simhashes to insert.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the simhashes were successfully inserted.
+/// * `Err(Error)` - If the simhashes were not inserted.
+///
+/// # Errors
+///
+/// * If the simhashes could not be inserted.
+pub async fn create_simhashes(
+    conn: &mut AsyncPgConnection,
+    new_simhashes: &[NewSimhash],
+) -> Result<(), Error> {
+    use crate::database::schema::simhashes::dsl::simhashes;
+
+    for batch in new_simhashes.chunks(10_000) {
+        diesel::insert_into(simhashes)
+            .values(batch)
+            .execute(conn)
+            .await?;
+    }
+
+    Ok(())
+}
+
+/// Gets the simhash of the text of a page.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `page_id`: The ID of the page.
+///
+/// # Returns
+///
+/// * `Ok(Some(i64))` - The simhash of the text of the page.
+/// * `Ok(None)` - If the page has no simhash.
+/// * `Err(Error)` - If the simhash could not be retrieved.
+///
+/// # Errors
+///
+/// * If the simhash could not be retrieved.
+pub async fn get_simhash_by_page_id(
+    conn: &mut AsyncPgConnection,
+    page_id: i32,
+) -> Result<Option<i64>, Error> {
+    use crate::database::schema::simhashes::dsl::{page_id as page_id_column, simhash, simhashes};
+
+    Ok(simhashes
+        .filter(page_id_column.eq(page_id))
+        .select(simhash)
+        .first(conn)
+        .await
+        .optional()?)
+}
+
+/// Gets the simhashes of pages that share a band with a simhash, along with the URL of their page.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `bands`: The bands of the simhash.
+/// * `limit`: The maximum number of simhashes to get.
+///
+/// # Returns
+///
+/// * `Ok(Vec<(String, i64)>)` - The URL of each page, and the simhash of its text.
+/// * `Err(Error)` - If the simhashes could not be retrieved.
+///
+/// # Errors
+///
+/// * If the simhashes could not be retrieved.
+///
+/// # Notes
+///
+/// * Pages excluded from search results are left out.
+pub async fn get_simhash_matches(
+    conn: &mut AsyncPgConnection,
+    bands: &[i32; simhash::BANDS],
+    limit: i64,
+) -> Result<Vec<(String, i64)>, Error> {
+    use crate::database::schema::pages::dsl::{excluded, pages, url};
+    use crate::database::schema::simhashes::dsl::{
+        band_0, band_1, band_2, band_3, simhash, simhashes,
+    };
+    use diesel::BoolExpressionMethods;
+
+    Ok(simhashes
+        .inner_join(pages)
+        .filter(
+            band_0
+                .eq(bands[0])
+                .or(band_1.eq(bands[1]))
+                .or(band_2.eq(bands[2]))
+                .or(band_3.eq(bands[3])),
+        )
+        .filter(excluded.eq(false))
+        .limit(limit)
+        .select((url, simhash))
+        .load(conn)
+        .await?)
+}
+
+/// Inserts the anchor texts of the links on pages.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `new_link_anchors`: The anchor texts to insert.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the anchor texts were successfully inserted.
+/// * `Err(Error)` - If the anchor texts were not inserted.
+///
+/// # Errors
+///
+/// * If the anchor texts could not be inserted.
+pub async fn create_link_anchors(
+    conn: &mut AsyncPgConnection,
+    new_link_anchors: &[NewLinkAnchor],
+) -> Result<(), Error> {
+    use crate::database::schema::link_anchors::dsl::link_anchors;
+
+    for batch in new_link_anchors.chunks(10_000) {
+        diesel::insert_into(link_anchors)
+            .values(batch)
+            .execute(conn)
+            .await?;
+    }
+
+    Ok(())
+}
+
+/// Gets the anchor texts of the links on a page.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `page_id`: The ID of the page.
+///
+/// # Returns
+///
+/// * `Ok(Vec<LinkAnchor>)` - The anchor texts of the links on the page.
+/// * `Err(Error)` - If the anchor texts could not be retrieved.
+///
+/// # Errors
+///
+/// * If the anchor texts could not be retrieved.
+pub async fn get_link_anchors_by_page_id(
+    conn: &mut AsyncPgConnection,
+    page_id: i32,
+) -> Result<Vec<LinkAnchor>, Error> {
+    use crate::database::schema::link_anchors::dsl::{from_page_id, link_anchors};
+
+    Ok(link_anchors
+        .filter(from_page_id.eq(page_id))
+        .select(LinkAnchor::as_select())
+        .load(conn)
+        .await?)
+}
+
+/// Gets the images on a page.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `page_id`: The ID of the page.
+///
+/// # Returns
+///
+/// * `Ok(Vec<Image>)` - The images, in the order they're on the page.
+/// * `Err(Error)` - If the images could not be retrieved.
+///
+/// # Errors
+///
+/// * If the images could not be retrieved.
+pub async fn get_images_by_page_id(
+    conn: &mut AsyncPgConnection,
+    page_id: i32,
+) -> Result<Vec<Image>, Error> {
+    use crate::database::schema::images::dsl::{images, page_id as page_id_column, position};
+
+    Ok(images
+        .filter(page_id_column.eq(page_id))
+        .order(position)
+        .select(Image::as_select())
+        .load(conn)
+        .await?)
+}
+
+/// Gets the images on pages, along with the URL of their page.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `urls`: The URLs of the pages.
+///
+/// # Returns
+///
+/// * `Ok(Vec<(String, Image)>)` - The URL of the page of each image, and the image, in the order they're on their page.
+/// * `Err(Error)` - If the images could not be retrieved.
+///
+/// # Errors
+///
+/// * If the images could not be retrieved.
+///
+/// # Notes
+///
+/// * Pages excluded from search results are left out.
+pub async fn get_images_by_page_urls(
+    conn: &mut AsyncPgConnection,
+    urls: &[String],
+) -> Result<Vec<(String, Image)>, Error> {
+    use crate::database::schema::images::dsl::{images, position};
+    use crate::database::schema::pages::dsl::{excluded, pages, url};
+
+    Ok(images
+        .inner_join(pages)
+        .filter(url.eq_any(urls))
+        .filter(excluded.eq(false))
+        .order(position)
+        .select((url, Image::as_select()))
+        .load(conn)
+        .await?)
+}
+
+/// Gets the hash of the latest content of pages, along with the URL of their page.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `urls`: The URLs of the pages.
+///
+/// # Returns
+///
+/// * `Ok(Vec<(String, String)>)` - The URL of each page, and the hash of its body the last time it was crawled.
+/// * `Err(Error)` - If the hashes could not be retrieved.
+///
+/// # Errors
+///
+/// * If the hashes could not be retrieved.
+///
+/// # Notes
+///
+/// * Pages without a history are left out.
+pub async fn get_content_hashes_by_page_urls(
+    conn: &mut AsyncPgConnection,
+    urls: &[String],
+) -> Result<Vec<(String, String)>, Error> {
+    use crate::database::schema::page_history::dsl::{
+        content_hash, crawled_at, id, page_history, page_id,
+    };
+    use crate::database::schema::pages::dsl::{pages, url};
+
+    Ok(page_history
+        .inner_join(pages)
+        .filter(url.eq_any(urls))
+        .distinct_on(page_id)
+        .order((page_id, crawled_at.desc(), id.desc()))
+        .select((url, content_hash))
+        .load(conn)
+        .await?)
+}
+
+/// Gets a page by its ID.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `page_id`: The ID of the page.
+///
+/// # Returns
+///
+/// * `Ok(Some(Page))` - The page if successful.
+/// * `Ok(None)` - If no page was found.
+/// * `Err(diesel::result::Error)` - If the page could not be retrieved.
+///
+/// # Errors
+///
+/// * If the page could not be retrieved.
+pub async fn get_page_by_id(
+    conn: &mut AsyncPgConnection,
+    page_id: i32,
+) -> Result<Option<Page>, Error> {
+    use crate::database::schema::pages::dsl::pages;
+    use crate::database::schema::pages::id;
+
+    Ok(pages
+        .filter(id.eq(page_id))
+        .select(Page::as_select())
+        .first(conn)
+        .await
+        .optional()?)
+}
+
+/// Gets a page by its URL.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `url`: The URL of the page.
+///
+/// # Returns
+///
+/// * `Ok(Some(Page))` - The page, if successful.
+/// * `Ok(None)` - If no page was found.
+/// * `Err(Error)` - If the page could not be retrieved.
+///
+/// # Errors
+///
+/// * If the page could not be retrieved.
+pub async fn get_page_by_url(
+    conn: &mut AsyncPgConnection,
+    url: &Url,
+) -> Result<Option<Page>, Error> {
+    use crate::database::schema::pages::dsl::{pages, url as url_column};
+
+    Ok(pages
+        .filter(url_column.eq(url.to_string()))
+        .select(Page::as_select())
+        .first(conn)
+        .await
+        .optional()?)
+}
+
+/// Marks a page as crawled and fetched successfully now, without changing anything else about it.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `page_id`: The ID of the page.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the page was marked as crawled.
+/// * `Err(Error)` - If the page could not be updated.
+///
+/// # Errors
+///
+/// * If the page could not be updated.
+pub async fn touch_page(conn: &mut AsyncPgConnection, page_id: i32) -> Result<(), Error> {
+    use crate::database::schema::pages::dsl::{id, last_crawled_at, last_succeeded_at, pages};
+
+    diesel::update(pages.filter(id.eq(page_id)))
+        .set((
+            last_crawled_at.eq(diesel::dsl::now),
+            last_succeeded_at.eq(diesel::dsl::now),
+        ))
+        .execute(conn)
+        .await?;
+
+    Ok(())
+}
+
+/// Marks pages as fetched successfully now, like when they were crawled with a 2xx response.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `page_ids`: The IDs of the pages.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the pages were marked as fetched successfully.
+/// * `Err(Error)` - If the pages could not be updated.
+///
+/// # Errors
+///
+/// * If the pages could not be updated.
+pub async fn mark_pages_succeeded(
+    conn: &mut AsyncPgConnection,
+    page_ids: &[i32],
+) -> Result<(), Error> {
+    use crate::database::schema::pages::dsl::{id, last_succeeded_at, pages};
+
+    if page_ids.is_empty() {
+        return Ok(());
+    }
+
+    diesel::update(pages.filter(id.eq_any(page_ids)))
+        .set(last_succeeded_at.eq(diesel::dsl::now))
+        .execute(conn)
+        .await?;
+
+    Ok(())
+}
+
+/// Gets the text of a page.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `page_id`: The ID of the page.
+/// * `codec`: The codec the text was stored with.
+///
+/// # Returns
+///
+/// * `Ok(Some(String))` - The text, if the page has any stored.
+/// * `Ok(None)` - If no page was found, or it has no text stored.
+/// * `Err(Error)` - If the text could not be retrieved.
+///
+/// # Errors
+///
+/// * If the text could not be retrieved or decompressed.
+pub async fn get_page_content(
+    conn: &mut AsyncPgConnection,
+    page_id: i32,
+    codec: &Codec,
+) -> Result<Option<String>, Error> {
+    use crate::database::schema::pages::dsl::{content, id, pages};
+
+    let stored = pages
+        .filter(id.eq(page_id))
+        .select(content)
+        .first::<Option<Vec<u8>>>(conn)
+        .await
+        .optional()?
+        .flatten();
+
+    stored.map(|stored| codec.decompress(&stored)).transpose()
+}
+
+/// Gets the stored text of the pages after a page, in the order of their IDs.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `after_id`: The ID of the page to start after.
+/// * `limit`: The maximum number of pages to get.
+///
+/// # Returns
+///
+/// * `Ok(Vec<(i32, Vec<u8>)>)` - The IDs of the pages and their text as stored, empty once there are no more.
+/// * `Err(Error)` - If the text could not be retrieved.
+///
+/// # Errors
+///
+/// * If the text could not be retrieved.
+///
+/// # Notes
+///
+/// * Pages without text are skipped, and the text isn't decompressed.
+pub async fn get_page_contents_after(
+    conn: &mut AsyncPgConnection,
+    after_id: i32,
+    limit: i64,
+) -> Result<Vec<(i32, Vec<u8>)>, Error> {
+    use crate::database::schema::pages::dsl::{content, id, pages};
+
+    let stored = pages
+        .filter(id.gt(after_id))
+        .filter(content.is_not_null())
+        .order(id.asc())
+        .limit(limit)
+        .select((id, content))
+        .load::<(i32, Option<Vec<u8>>)>(conn)
+        .await?;
+
+    Ok(stored
+        .into_iter()
+        .filter_map(|(page_id, stored)| stored.map(|stored| (page_id, stored)))
+        .collect())
+}
+
+/// Replaces the stored text of pages.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `contents`: The IDs of the pages and their text, as encoded by `Codec::compress`.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the text was replaced.
+/// * `Err(Error)` - If the text could not be replaced.
+///
+/// # Errors
+///
+/// * If the text of any page could not be replaced.
+pub async fn update_page_contents(
+    conn: &mut AsyncPgConnection,
+    contents: &[(i32, Vec<u8>)],
+) -> Result<(), Error> {
+    use crate::database::schema::pages::dsl::{content, id, pages};
+
+    for (page_id, stored) in contents {
+        diesel::update(pages.filter(id.eq(page_id)))
+            .set(content.eq(stored))
+            .execute(conn)
+            .await?;
+    }
+
+    Ok(())
+}
+
+#[derive(Debug, Clone, Eq, PartialEq, Hash, Serialize, Deserialize)]
+pub struct CompletePage {
+    pub page: Page,
+    pub keywords: Option<Vec<Keyword>>,
+}
+
+/// Gets keywords by page ID.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `page_id`: The ID of the page.
+///
+/// # Returns
+///
+/// * `Ok(Some(Vec<Keyword>))` - The keywords if successful.
+/// * `Ok(None)` - If no keywords were found.
+/// * `Err(diesel::result::Error)` - If the keywords could not be retrieved.
+///
+/// # Errors
+///
+/// * If the keywords could not be retrieved.
+pub async fn get_keywords_by_page_id(
+    conn: &mut AsyncPgConnection,
+    page_id: i32,
+) -> Result<Option<Vec<Keyword>>, diesel::result::Error> {
+    use crate::database::schema::keywords::dsl::{keywords, page_id as page_id_column};
+
+    keywords
+        .filter(page_id_column.eq(page_id))
+        .select(Keyword::as_select())
+        .load(conn)
+        .await
+        .optional()
+}
+
+/// Get a series of pages matching a list of words
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `words`: The words to search for.
+/// * `maximum_candidates`: The maximum number of pages to get for each way a page can match, if limited.
+///
+/// # Returns
+///
+/// * `Ok(Some(Vec<Page>))` - The pages if successful.
+/// * `Ok(None)` - If no pages were found.
+/// * `Err(Error)` - If the pages could not be retrieved.
+///
+/// # Errors
+///
+/// * If the pages could not be retrieved.
+///
+/// # Notes
+///
+/// * Pages excluded from search results, like those fetched with credentials where the host requires it, are left out.
+/// * The pages with the most occurrences of the words are kept, so a common word can't load the whole index to be ranked.
+/// * Ties are broken by the ID of the page, so the same pages are kept every time and pagination stays stable.
+pub async fn get_pages_with_words(
+    conn: &mut AsyncPgConnection,
+    words: Vec<String>,
+    maximum_candidates: Option<usize>,
+) -> Result<Option<Vec<Page>>, Error> {
+    use crate::database::schema::pages::dsl::{excluded, id, pages};
+
+    let limit = get_candidate_limit(maximum_candidates);
+
+    // Search for the pages with the most occurrences of the words in their keywords.
+    let candidate_ids = get_candidate_ids(conn, &words, limit).await?;
+
+    let pages_with_keywords = pages
+        .filter(id.eq_any(&candidate_ids))
+        .select(Page::as_select())
+        .load(conn)
+        .await
+        .optional()?;
+
+    // Search for pages that contain the words in their title or description, the oldest first so the capped pages are stable.
+    let pages_with_title = pages
+        .filter(schema::pages::dsl::title.eq_any(&words))
+        .filter(excluded.eq(false))
+        .select(Page::as_select())
+        .order(id.asc())
+        .limit(limit)
+        .load(conn)
+        .await
+        .optional()?;
+
+    let pages_with_description = pages
+        .filter(schema::pages::dsl::description.eq_any(&words))
+        .filter(excluded.eq(false))
+        .select(Page::as_select())
+        .order(id.asc())
+        .limit(limit)
+        .load(conn)
+        .await
+        .optional()?;
+
+    // Combine the results.
+    let mut found_pages = Vec::new();
+
+    if let Some(mut data) = pages_with_keywords {
+        found_pages.append(&mut data);
+    }
+
+    if let Some(mut data) = pages_with_title {
+        found_pages.append(&mut data);
+    }
+
+    if let Some(mut data) = pages_with_description {
+        found_pages.append(&mut data);
+    }
+
+    if found_pages.is_empty() {
+        return Ok(None);
+    }
+
+    Ok(Some(found_pages))
+}
+
+/// Gets the IDs of the pages with the most occurrences of the words of a query in their keywords.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `words`: The stemmed words of the query.
+/// * `limit`: The maximum number of pages to get.
+///
+/// # Returns
+///
+/// * `Ok(Vec<i32>)` - The IDs of the pages if successful.
+/// * `Err(Error)` - If the pages could not be retrieved.
+///
+/// # Errors
+///
+/// * If the pages could not be retrieved.
+async fn get_candidate_ids(
+    conn: &mut AsyncPgConnection,
+    words: &[String],
+    limit: i64,
+) -> Result<Vec<i32>, Error> {
+    Ok(select_candidate_ids(words, limit).load::<i32>(conn).await?)
+}
+
+/// Builds the query of the IDs of the pages with the most occurrences of the words of a query in their keywords.
+///
+/// # Arguments
+///
+/// * `words`: The stemmed words of the query.
+/// * `limit`: The maximum number of pages to get.
+///
+/// # Returns
+///
+/// * `impl LoadQuery` - The query of the IDs, the most frequent first and the oldest first among equally frequent ones.
+fn select_candidate_ids<'a>(
+    words: &'a [String],
+    limit: i64,
+) -> impl diesel_async::methods::LoadQuery<'a, AsyncPgConnection, i32>
+       + diesel::query_builder::QueryFragment<diesel::pg::Pg>
+       + 'a {
+    use crate::database::schema::keywords::dsl::{frequency, keywords, page_id, word};
+    use crate::database::schema::pages::dsl::{excluded, pages};
+
+    keywords
+        .filter(word.eq_any(words))
+        .inner_join(pages)
+        .filter(excluded.eq(false))
+        .group_by(page_id)
+        .select(page_id)
+        .order((diesel::dsl::sum(frequency).desc(), page_id.asc()))
+        .limit(limit)
+}
+
+/// Gets the maximum number of candidate pages to load for a query.
+///
+/// # Arguments
+///
+/// * `maximum_candidates`: The maximum number of candidate pages, if limited.
+///
+/// # Returns
+///
+/// * `i64` - The limit of the query, `i64::MAX` if the candidates aren't limited.
+fn get_candidate_limit(maximum_candidates: Option<usize>) -> i64 {
+    maximum_candidates.map_or(i64::MAX, |maximum| {
+        i64::try_from(maximum).unwrap_or(i64::MAX)
+    })
+}
+
+/// Gets the keywords matching the words of a query, along with the URL and language of their pages.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `words`: The stemmed words of the query.
+/// * `maximum_candidates`: The maximum number of pages to get the keywords of, if limited.
+///
+/// # Returns
+///
+/// * `Ok(Vec<WordMatch>)` - The matching keywords if successful.
+/// * `Err(Error)` - If the keywords could not be retrieved.
+///
+/// # Errors
+///
+/// * If the keywords could not be retrieved.
+///
+/// # Notes
+///
+/// * Only the keywords matching the query are loaded, instead of every keyword of every page.
+/// * Pages excluded from search results are left out.
+/// * Only the keywords of the pages with the most occurrences of the words are kept, like in `get_pages_with_words`.
+pub async fn get_word_matches(
+    conn: &mut AsyncPgConnection,
+    words: &[String],
+    maximum_candidates: Option<usize>,
+) -> Result<Vec<WordMatch>, Error> {
+    use crate::database::schema::keywords::dsl::{
+        field, frequency, keywords, page_id, positions, word,
+    };
+    use crate::database::schema::pages::dsl::{
+        excluded, language, pages, published_at, unstable, url,
+    };
+
+    let mut query = keywords
+        .filter(word.eq_any(words))
+        .inner_join(pages)
+        .filter(excluded.eq(false))
+        .select((
+            url,
+            language,
+            published_at,
+            unstable,
+            word,
+            frequency,
+            positions,
+            field,
+        ))
+        .into_boxed();
+
+    // Without a limit every page is a candidate, so there's no need to look them up first.
+    if maximum_candidates.is_some() {
+        let candidate_ids =
+            get_candidate_ids(conn, words, get_candidate_limit(maximum_candidates)).await?;
+        query = query.filter(page_id.eq_any(candidate_ids));
+    }
+
+    Ok(query.load::<WordMatch>(conn).await?)
+}
+
+/// Gets the most common stemmed words of the index, and how many keywords there are of each.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `limit`: The maximum number of words to get.
+///
+/// # Returns
+///
+/// * `Ok(Vec<(String, i64)>)` - The words and their counts if successful, most common first.
+/// * `Err(Error)` - If the words could not be counted.
+///
+/// # Errors
+///
+/// * If the keywords could not be counted.
+pub async fn get_word_counts(
+    conn: &mut AsyncPgConnection,
+    limit: i64,
+) -> Result<Vec<(String, i64)>, Error> {
+    use crate::database::schema::keywords::dsl::{keywords, word};
+
+    Ok(keywords
+        .group_by(word)
+        .select((word, diesel::dsl::count_star()))
+        .order(diesel::dsl::count_star().desc())
+        .limit(limit)
+        .load::<(String, i64)>(conn)
+        .await?)
+}
+
+/// Gets how many pages each stemmed word is on, and how often it occurs on them in total.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+///
+/// # Returns
+///
+/// * `Ok(Vec<(String, i64, i64)>)` - Each word, the number of pages it's on and its total frequency, if successful.
+/// * `Err(Error)` - If the words could not be counted.
+///
+/// # Errors
+///
+/// * If the keywords could not be counted.
+///
+/// # Notes
+///
+/// * A page is counted once, even if the word is in several of its fields.
+pub async fn get_term_stats(
+    conn: &mut AsyncPgConnection,
+) -> Result<Vec<(String, i64, i64)>, Error> {
+    use crate::database::schema::keywords::dsl::{frequency, keywords, page_id, word};
+
+    Ok(keywords
+        .group_by(word)
+        .select((
+            word,
+            diesel::dsl::count_distinct(page_id),
+            diesel::dsl::sum(frequency),
+        ))
+        .load::<(String, i64, Option<i64>)>(conn)
+        .await?
+        .into_iter()
+        .map(|(term, pages, total)| (term, pages, total.unwrap_or_default()))
+        .collect())
+}
+
+/// Counts the rows in the tables of the index.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+///
+/// # Returns
+///
+/// * `Ok(RowCounts)` - The number of pages, keywords and links if successful.
+/// * `Err(Error)` - If the rows could not be counted.
+///
+/// # Errors
+///
+/// * If the rows could not be counted.
+pub async fn count_rows(conn: &mut AsyncPgConnection) -> Result<RowCounts, Error> {
+    use crate::database::schema::forward_links::dsl::forward_links;
+    use crate::database::schema::keywords::dsl::keywords;
+    use crate::database::schema::pages::dsl::pages;
+
+    Ok(RowCounts {
+        pages: pages.count().get_result(conn).await?,
+        keywords: keywords.count().get_result(conn).await?,
+        forward_links: forward_links.count().get_result(conn).await?,
+    })
+}
+
+/// Gets a batch of the links between pages, along with the URL of the page they're on.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `after`: The ID of the page and the URL of the last link of the previous batch, if any.
+/// * `limit`: The maximum number of links to get.
+///
+/// # Returns
+///
+/// * `Ok(Vec<(i32, String, String)>)` - The ID and URL of each page, and the URL it links to, if successful.
+/// * `Err(Error)` - If the links could not be retrieved.
+///
+/// # Errors
+///
+/// * If the links could not be retrieved.
+pub async fn get_links(
+    conn: &mut AsyncPgConnection,
+    after: Option<(i32, &str)>,
+    limit: i64,
+) -> Result<Vec<(i32, String, String)>, Error> {
+    use crate::database::schema::forward_links::dsl::{forward_links, from_page_id, to_page_url};
+    use crate::database::schema::pages::dsl::{pages, url};
+    use diesel::BoolExpressionMethods;
+
+    let mut query = forward_links
+        .inner_join(pages)
+        .select((from_page_id, url, to_page_url))
+        .order((from_page_id, to_page_url))
+        .limit(limit)
+        .into_boxed();
+    if let Some((page_id, link_url)) = after {
+        query = query.filter(
+            from_page_id.gt(page_id).or(from_page_id
+                .eq(page_id)
+                .and(to_page_url.gt(link_url.to_string()))),
+        );
+    }
+
+    Ok(query.load::<(i32, String, String)>(conn).await?)
+}
+
+/// Get the backlinks for a given page.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `page`: The page to get backlinks for.
+///
+/// # Returns
+///
+/// * `Ok(Vec<CompletePage>)` - The backlinks if successful.
+/// * `Err(Box<dyn std::errors::Error>)` - If the backlinks could not be retrieved.
+///
+/// # Errors
+///
+/// * If the backlinks could not be retrieved.
+pub async fn get_backlinks(
+    conn: &mut AsyncPgConnection,
+    page: &CompletePage,
+) -> Result<Vec<CompletePage>, Error> {
+    use crate::database::schema::forward_links::dsl::forward_links;
+    use crate::database::schema::pages::dsl::pages;
+
+    let mut backlinks = Vec::new();
+
+    let links = forward_links
+        .filter(schema::forward_links::dsl::to_page_url.eq(&page.page.url))
+        .select(ForwardLink::as_select())
+        .load(conn)
+        .await?;
+
+    for link in links {
+        let page = pages
+            .filter(schema::pages::dsl::id.eq(link.from_page_id))
+            .select(Page::as_select())
+            .first(conn)
+            .await?;
+
+        let keywords = get_keywords_by_page_id(conn, page.id).await?;
+
+        let complete_page = CompletePage { page, keywords };
+
+        backlinks.push(complete_page);
+    }
+
+    Ok(backlinks)
+}
+
+/// Creates a snapshot of the crawl frontier, replacing the previous one.
+///
+/// # Arguments
+///
+/// * `entries`: The URLs waiting to be crawled, and the depth they were queued at.
+/// * `batch_size`: The number of entries to write at once.
+///
+/// # Returns
+///
+/// * `Ok(FrontierSnapshot)` - The created snapshot if successful.
+/// * `Err(Error)` - If the snapshot could not be created.
+///
+/// # Errors
+///
+/// * If the snapshot could not be created.
+/// * If the snapshot entries could not be created.
+pub async fn create_frontier_snapshot(
+    entries: &[(Url, u32)],
+    batch_size: usize,
+) -> Result<FrontierSnapshot, Error> {
+    use crate::database::schema::frontier_entries::dsl::frontier_entries;
+    use crate::database::schema::frontier_snapshots::dsl::{completed, frontier_snapshots, id};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    let snapshot = diesel::insert_into(frontier_snapshots)
+        .default_values()
+        .returning(FrontierSnapshot::as_returning())
+        .get_result(&mut conn)
+        .await?;
+
+    for batch in entries.chunks(batch_size.max(1)) {
+        diesel::insert_into(frontier_entries)
+            .values(get_frontier_entries(snapshot.id, batch)?)
+            .execute(&mut conn)
+            .await?;
+    }
+
+    // Only mark the snapshot as completed once all the entries are written, so a partial snapshot is never restored.
+    let snapshot = diesel::update(frontier_snapshots.filter(id.eq(snapshot.id)))
+        .set(completed.eq(true))
+        .returning(FrontierSnapshot::as_returning())
+        .get_result(&mut conn)
+        .await?;
+
+    diesel::delete(frontier_snapshots.filter(id.lt(snapshot.id)))
+        .execute(&mut conn)
+        .await?;
+
+    Ok(snapshot)
+}
+
+/// Gets the URLs of the latest completed frontier snapshot.
+///
+/// # Returns
+///
+/// * `Ok(HashMap<Url, u32>)` - The URLs and their depth if successful, empty if there's no snapshot.
+/// * `Err(Error)` - If the snapshot could not be retrieved.
+///
+/// # Errors
+///
+/// * If the snapshot could not be retrieved.
+///
+/// # Notes
+///
+/// * URLs of pages that have been crawled since the snapshot was taken are left out.
+/// * URLs are normalized again, since the snapshot may have been taken before normalization changed.
+pub async fn get_latest_frontier_snapshot() -> Result<HashMap<Url, u32>, Error> {
+    use crate::database::schema::frontier_entries::dsl::{frontier_entries, snapshot_id};
+    use crate::database::schema::frontier_snapshots::dsl::{
+        completed, frontier_snapshots, taken_at,
+    };
+    use crate::database::schema::pages::dsl::{last_crawled_at, pages, url as url_column};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    let Some(snapshot) = frontier_snapshots
+        .filter(completed.eq(true))
+        .order(taken_at.desc())
+        .select(FrontierSnapshot::as_select())
+        .first(&mut conn)
+        .await
+        .optional()?
+    else {
+        return Ok(HashMap::new());
+    };
+
+    let entries = frontier_entries
+        .filter(snapshot_id.eq(snapshot.id))
+        .select(FrontierEntry::as_select())
+        .load(&mut conn)
+        .await?;
+
+    let mut crawled_at = HashMap::new();
+    for batch in entries.chunks(1_000) {
+        let urls = batch.iter().map(|entry| &entry.url).collect::<Vec<_>>();
+
+        crawled_at.extend(
+            pages
+                .filter(url_column.eq_any(urls))
+                .select((url_column, last_crawled_at))
+                .load::<(String, SystemTime)>(&mut conn)
+                .await?,
+        );
+    }
+
+    let total_entries = entries.len();
+    let restored_urls = restore_frontier_entries(entries, &crawled_at, snapshot.taken_at);
+    info!(
+        "Restoring {} of {total_entries} entries from frontier snapshot #{}...",
+        restored_urls.len(),
+        snapshot.id
+    );
+
+    Ok(restored_urls)
+}
+
+/// Gets the entries of a frontier snapshot.
+///
+/// # Arguments
+///
+/// * `snapshot_id`: The ID of the snapshot.
+/// * `entries`: The URLs waiting to be crawled, and the depth they were queued at.
+///
+/// # Returns
+///
+/// * `Ok(Vec<FrontierEntry>)` - The entries if successful.
+/// * `Err(Error)` - If a depth is too deep to be stored.
+///
+/// # Errors
+///
+/// * If a depth doesn't fit in the database.
+fn get_frontier_entries(
+    snapshot_id: i32,
+    entries: &[(Url, u32)],
+) -> Result<Vec<FrontierEntry>, Error> {
+    entries
+        .iter()
+        .map(|(url, depth)| {
+            Ok::<_, Error>(FrontierEntry {
+                snapshot_id,
+                url: url.to_string(),
+                depth: i32::try_from(*depth)?,
+            })
+        })
+        .collect()
+}
+
+/// Restores the URLs of the entries of a frontier snapshot.
+///
+/// # Arguments
+///
+/// * `entries`: The entries of the snapshot.
+/// * `crawled_at`: The last time each page of the entries was crawled, if it has been.
+/// * `taken_at`: The time the snapshot was taken.
+///
+/// # Returns
+///
+/// * `HashMap<Url, u32>` - The URLs and their depth.
+///
+/// # Notes
+///
+/// * URLs of pages that have been crawled since the snapshot was taken are left out.
+fn restore_frontier_entries(
+    entries: Vec<FrontierEntry>,
+    crawled_at: &HashMap<String, SystemTime>,
+    taken_at: SystemTime,
+) -> HashMap<Url, u32> {
+    entries
+        .into_iter()
+        .filter(|entry| {
+            crawled_at
+                .get(&entry.url)
+                .map_or(true, |crawled_at| *crawled_at < taken_at)
+        })
+        .filter_map(|entry| {
+            let url = urls::normalize(&Url::parse(&entry.url).ok()?);
+            let depth = u32::try_from(entry.depth).ok()?;
+
+            Some((url, depth))
+        })
+        .collect()
+}
+
+/// Counts the entries of the latest completed frontier snapshot.
+///
+/// # Returns
+///
+/// * `Ok(Some((SystemTime, i64)))` - When the snapshot was taken, and the number of URLs in it.
+/// * `Ok(None)` - If no snapshot has been completed.
+/// * `Err(Error)` - If the snapshot could not be counted.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the snapshot could not be counted.
+pub async fn count_latest_frontier_snapshot() -> Result<Option<(SystemTime, i64)>, Error> {
+    use crate::database::schema::frontier_entries::dsl::{frontier_entries, snapshot_id};
+    use crate::database::schema::frontier_snapshots::dsl::{
+        completed, frontier_snapshots, taken_at,
+    };
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    let Some(snapshot) = frontier_snapshots
+        .filter(completed.eq(true))
+        .order(taken_at.desc())
+        .select(FrontierSnapshot::as_select())
+        .first(&mut conn)
+        .await
+        .optional()?
+    else {
+        return Ok(None);
+    };
+
+    let entries = frontier_entries
+        .filter(snapshot_id.eq(snapshot.id))
+        .count()
+        .get_result(&mut conn)
+        .await?;
+
+    Ok(Some((snapshot.taken_at, entries)))
+}
+
+/// Creates a new click on a search result.
+///
+/// # Arguments
+///
+/// * `new_click`: The click to create.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the click was successfully created.
+/// * `Err(Error)` - If the click was not created.
+///
+/// # Errors
+///
+/// * If the click could not be created.
+pub async fn create_click(new_click: &NewClick) -> Result<(), Error> {
+    use crate::database::schema::clicks::dsl::clicks;
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    diesel::insert_into(clicks)
+        .values(new_click)
+        .execute(&mut conn)
+        .await?;
+
+    Ok(())
+}
+
+/// Gets the number of clicks on each result of each query, by the position it was shown at.
+///
+/// # Returns
+///
+/// * `Ok(Vec<(String, String, i32, i64)>)` - The query hash, URL, position and number of clicks if successful.
+/// * `Err(Error)` - If the clicks could not be retrieved.
+///
+/// # Errors
+///
+/// * If the clicks could not be retrieved.
+pub async fn get_click_counts() -> Result<Vec<(String, String, i32, i64)>, Error> {
+    use crate::database::schema::clicks::dsl::{clicks, position, query_hash, url};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    Ok(clicks
+        .group_by((query_hash, url, position))
+        .select((query_hash, url, position, diesel::dsl::count_star()))
+        .load(&mut conn)
+        .await?)
+}
+
+/// Replaces all the click statistics.
+///
+/// # Arguments
+///
+/// * `stats`: The new click statistics.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the click statistics were successfully replaced.
+/// * `Err(Error)` - If the click statistics were not replaced.
+///
+/// # Errors
+///
+/// * If the old click statistics could not be deleted.
+/// * If the new click statistics could not be created.
+pub async fn replace_click_stats(stats: &[ClickStat]) -> Result<(), Error> {
+    use crate::database::schema::click_stats::dsl::click_stats;
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    diesel::delete(click_stats).execute(&mut conn).await?;
+
+    for batch in stats.chunks(1_000) {
+        diesel::insert_into(click_stats)
+            .values(batch)
+            .execute(&mut conn)
+            .await?;
+    }
+
+    Ok(())
+}
+
+/// Gets the click-through rates of the results of a query.
+///
+/// # Arguments
+///
+/// * `hash`: The hash of the query.
+///
+/// # Returns
+///
+/// * `Ok(HashMap<String, f64>)` - The click-through rate of each URL if successful.
+/// * `Err(Error)` - If the click statistics could not be retrieved.
+///
+/// # Errors
+///
+/// * If the click statistics could not be retrieved.
+pub async fn get_click_through_rates(hash: &str) -> Result<HashMap<String, f64>, Error> {
+    use crate::database::schema::click_stats::dsl::{click_stats, query_hash};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    Ok(click_stats
+        .filter(query_hash.eq(hash))
+        .select(ClickStat::as_select())
+        .load(&mut conn)
+        .await?
+        .into_iter()
+        .map(|stat| (stat.url, stat.click_through_rate))
+        .collect())
+}
+
+/// Gets the authority of every domain.
+///
+/// # Returns
+///
+/// * `Ok(Vec<DomainAuthority>)` - The domain authorities if successful.
+/// * `Err(Error)` - If the domain authorities could not be retrieved.
+///
+/// # Errors
+///
+/// * If the domain authorities could not be retrieved.
+pub async fn get_domain_authorities() -> Result<Vec<DomainAuthority>, Error> {
+    use crate::database::schema::domain_authorities::dsl::domain_authorities;
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    Ok(domain_authorities
+        .select(DomainAuthority::as_select())
+        .load(&mut conn)
+        .await?)
+}
+
+/// Replaces the authority of every domain.
+///
+/// # Arguments
+///
+/// * `authorities`: The new domain authorities.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the domain authorities were successfully replaced.
+/// * `Err(Error)` - If the domain authorities were not replaced.
+///
+/// # Errors
+///
+/// * If the old domain authorities could not be deleted.
+/// * If the new domain authorities could not be created.
+pub async fn replace_domain_authorities(authorities: &[DomainAuthority]) -> Result<(), Error> {
+    use crate::database::schema::domain_authorities::dsl::domain_authorities;
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    diesel::delete(domain_authorities)
+        .execute(&mut conn)
+        .await?;
+
+    for batch in authorities.chunks(1_000) {
+        diesel::insert_into(domain_authorities)
+            .values(batch)
+            .execute(&mut conn)
+            .await?;
+    }
+
+    Ok(())
+}
+
+/// Creates a new search.
+///
+/// # Arguments
+///
+/// * `new_search`: The search to create.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the search was successfully created.
+/// * `Err(Error)` - If the search was not created.
+///
+/// # Errors
+///
+/// * If the search could not be created.
+pub async fn create_search(new_search: &NewSearch) -> Result<(), Error> {
+    use crate::database::schema::searches::dsl::searches;
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    diesel::insert_into(searches)
+        .values(new_search)
+        .execute(&mut conn)
+        .await?;
+
+    Ok(())
+}
+
+/// Gets the number of searches, searches without results and clicks of each ranking variant.
+///
+/// # Returns
+///
+/// * `Ok(HashMap<String, (i64, i64, i64)>)` - The searches, searches without results and clicks of each variant if successful.
+/// * `Err(Error)` - If the counts could not be retrieved.
+///
+/// # Errors
+///
+/// * If the searches or clicks could not be counted.
+pub async fn get_variant_counts() -> Result<HashMap<String, (i64, i64, i64)>, Error> {
+    use crate::database::schema::clicks::dsl::{clicks, variant as click_variant};
+    use crate::database::schema::searches::dsl::{results, searches, variant};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    let mut counts = HashMap::new();
+    for (name, count) in searches
+        .group_by(variant)
+        .select((variant, diesel::dsl::count_star()))
+        .load::<(String, i64)>(&mut conn)
+        .await?
+    {
+        counts.entry(name).or_insert((0, 0, 0)).0 = count;
+    }
+
+    for (name, count) in searches
+        .filter(results.eq(0))
+        .group_by(variant)
+        .select((variant, diesel::dsl::count_star()))
+        .load::<(String, i64)>(&mut conn)
+        .await?
+    {
+        counts.entry(name).or_insert((0, 0, 0)).1 = count;
+    }
+
+    for (name, count) in clicks
+        .group_by(click_variant)
+        .select((click_variant, diesel::dsl::count_star()))
+        .load::<(String, i64)>(&mut conn)
+        .await?
+    {
+        counts.entry(name).or_insert((0, 0, 0)).2 = count;
+    }
+
+    Ok(counts)
+}
+
+/// Gets a submission by its URL.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `url`: The submitted URL.
+///
+/// # Returns
+///
+/// * `Ok(Some(Submission))` - The submission, if successful.
+/// * `Ok(None)` - If the URL wasn't submitted.
+/// * `Err(Error)` - If the submission could not be retrieved.
+///
+/// # Errors
+///
+/// * If the submission could not be retrieved.
+pub async fn get_submission_by_url(
+    conn: &mut AsyncPgConnection,
+    url: &Url,
+) -> Result<Option<Submission>, Error> {
+    use crate::database::schema::submissions::dsl::{submissions, url as url_column};
+
+    Ok(submissions
+        .filter(url_column.eq(url.to_string()))
+        .select(Submission::as_select())
+        .first(conn)
+        .await
+        .optional()?)
+}
+
+/// Counts the submissions made from an IP prefix, and for a domain, since a point in time.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `prefix`: The truncated IP address of the submitter.
+/// * `host`: The domain of the submitted URL.
+/// * `since`: The point in time to count from.
+///
+/// # Returns
+///
+/// * `Ok((i64, i64))` - The submissions from the IP prefix and for the domain if successful.
+/// * `Err(Error)` - If the submissions could not be counted.
+///
+/// # Errors
+///
+/// * If the submissions could not be counted.
+pub async fn count_submissions_since(
+    conn: &mut AsyncPgConnection,
+    prefix: &str,
+    host: &str,
+    since: SystemTime,
+) -> Result<(i64, i64), Error> {
+    use crate::database::schema::submissions::dsl::{domain, ip_prefix, submissions, submitted_at};
+
+    let by_ip_prefix = submissions
+        .filter(ip_prefix.eq(prefix))
+        .filter(submitted_at.ge(since))
+        .count()
+        .get_result(conn)
+        .await?;
+    let by_domain = submissions
+        .filter(domain.eq(host))
+        .filter(submitted_at.ge(since))
+        .count()
+        .get_result(conn)
+        .await?;
+
+    Ok((by_ip_prefix, by_domain))
+}
+
+/// Creates a new submission.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `new_submission`: The submission to create.
+///
+/// # Returns
+///
+/// * `Ok(Submission)` - The created submission if successful.
+/// * `Err(Error)` - If the submission was not created.
+///
+/// # Errors
+///
+/// * If the submission could not be created, like when the URL was already submitted.
+pub async fn create_submission(
+    conn: &mut AsyncPgConnection,
+    new_submission: &NewSubmission,
+) -> Result<Submission, Error> {
+    use crate::database::schema::submissions::dsl::submissions;
+
+    Ok(diesel::insert_into(submissions)
+        .values(new_submission)
+        .returning(Submission::as_returning())
+        .get_result(conn)
+        .await?)
+}
+
+/// Marks a submission as verified, so the crawler queues it again ahead of the unverified ones.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `submission_id`: The ID of the submission.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the submission was marked as verified.
+/// * `Err(Error)` - If the submission could not be updated.
+///
+/// # Errors
+///
+/// * If the submission could not be updated.
+pub async fn verify_submission(
+    conn: &mut AsyncPgConnection,
+    submission_id: i32,
+) -> Result<(), Error> {
+    use crate::database::schema::submissions::dsl::{id, queued, submissions, verified};
+
+    diesel::update(submissions.filter(id.eq(submission_id)))
+        .set((verified.eq(true), queued.eq(false)))
+        .execute(conn)
+        .await?;
+
+    Ok(())
+}
+
+/// Takes the submissions the crawler hasn't queued yet, marking them as queued.
+///
+/// # Arguments
+///
+/// * `limit`: The maximum number of submissions to take.
+///
+/// # Returns
+///
+/// * `Ok(Vec<Submission>)` - The submissions, verified ones first, then the oldest ones first.
+/// * `Err(Error)` - If the submissions could not be taken.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the submissions could not be retrieved or updated.
+pub async fn take_submissions(limit: i64) -> Result<Vec<Submission>, Error> {
+    use crate::database::schema::submissions::dsl::{
+        id, queued, submissions, submitted_at, verified,
+    };
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    let ids = submissions
+        .filter(queued.eq(false))
+        .order((verified.desc(), submitted_at.asc()))
+        .limit(limit)
+        .select(id)
+        .load::<i32>(&mut conn)
+        .await?;
+
+    let mut taken = diesel::update(submissions.filter(id.eq_any(&ids)).filter(queued.eq(false)))
+        .set(queued.eq(true))
+        .returning(Submission::as_returning())
+        .get_results(&mut conn)
+        .await?;
+    taken.sort_by_key(|submission| (!submission.verified, submission.submitted_at));
+
+    Ok(taken)
+}
+
+/// Gets the retry of a URL that failed to be fetched.
+///
+/// # Arguments
+///
+/// * `retry_url`: The URL.
+///
+/// # Returns
+///
+/// * `Ok(Some(Retry))` - The retry, if the URL failed before.
+/// * `Ok(None)` - If the URL has no retry.
+/// * `Err(Error)` - If the retry could not be retrieved.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the retry could not be retrieved.
+pub async fn get_retry(retry_url: &str) -> Result<Option<Retry>, Error> {
+    use crate::database::schema::retry_later::dsl::{retry_later, url};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    Ok(retry_later
+        .filter(url.eq(retry_url))
+        .select(Retry::as_select())
+        .first(&mut conn)
+        .await
+        .optional()?)
+}
+
+/// Sets the retry of a URL, replacing any it had.
+///
+/// # Arguments
+///
+/// * `retry`: The retry.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the retry was set.
+/// * `Err(Error)` - If the retry could not be set.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the retry could not be set.
+pub async fn set_retry(retry: &Retry) -> Result<(), Error> {
+    use crate::database::schema::retry_later::dsl::{retry_later, url};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    diesel::insert_into(retry_later)
+        .values(retry)
+        .on_conflict(url)
+        .do_update()
+        .set(retry)
+        .execute(&mut conn)
+        .await?;
+
+    Ok(())
+}
+
+/// Deletes the retry of a URL, once it's fetched or isn't worth retrying anymore.
+///
+/// # Arguments
+///
+/// * `retry_url`: The URL.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the retry was deleted, or there was none.
+/// * `Err(Error)` - If the retry could not be deleted.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the retry could not be deleted.
+pub async fn delete_retry(retry_url: &str) -> Result<(), Error> {
+    use crate::database::schema::retry_later::dsl::{retry_later, url};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    diesel::delete(retry_later.filter(url.eq(retry_url)))
+        .execute(&mut conn)
+        .await?;
+
+    Ok(())
+}
+
+/// Sets the redirects of a chain, replacing the ones their URLs had.
+///
+/// # Arguments
+///
+/// * `new_redirects`: The redirects, in the order they were followed.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the redirects were set.
+/// * `Err(Error)` - If the redirects could not be set.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the redirects could not be set, or the same URL is in `new_redirects` more than once.
+pub async fn set_redirects(new_redirects: &[Redirect]) -> Result<(), Error> {
+    use crate::database::schema::redirects::dsl::{
+        final_url, hop, next_url, redirects, seen_at, status, url,
+    };
+    use diesel::upsert::excluded;
+
+    if new_redirects.is_empty() {
+        return Ok(());
+    }
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    diesel::insert_into(redirects)
+        .values(new_redirects)
+        .on_conflict(url)
+        .do_update()
+        .set((
+            next_url.eq(excluded(next_url)),
+            final_url.eq(excluded(final_url)),
+            hop.eq(excluded(hop)),
+            status.eq(excluded(status)),
+            seen_at.eq(excluded(seen_at)),
+        ))
+        .execute(&mut conn)
+        .await?;
+
+    Ok(())
+}
+
+/// Sets the canonical URL of a variant of a page, replacing the one it had.
+///
+/// # Arguments
+///
+/// * `canonical`: The variant and its canonical URL.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the canonical URL was set.
+/// * `Err(Error)` - If the canonical URL could not be set.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the canonical URL could not be set.
+pub async fn set_canonical(canonical: &Canonical) -> Result<(), Error> {
+    use crate::database::schema::canonicals::dsl::{canonical_url, canonicals, seen_at, url};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    diesel::insert_into(canonicals)
+        .values(canonical)
+        .on_conflict(url)
+        .do_update()
+        .set((
+            canonical_url.eq(&canonical.canonical_url),
+            seen_at.eq(canonical.seen_at),
+        ))
+        .execute(&mut conn)
+        .await?;
+
+    Ok(())
+}
+
+/// Records that a page is nearly the same as another, replacing what it was recorded as.
+///
+/// # Arguments
+///
+/// * `near_duplicate`: The page and the indexed page it's nearly the same as.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the page was recorded.
+/// * `Err(Error)` - If the page could not be recorded.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the page could not be recorded.
+pub async fn set_near_duplicate(near_duplicate: &NearDuplicate) -> Result<(), Error> {
+    use crate::database::schema::near_duplicates::dsl::{
+        distance, duplicate_of, near_duplicates, seen_at, url,
+    };
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    diesel::insert_into(near_duplicates)
+        .values(near_duplicate)
+        .on_conflict(url)
+        .do_update()
+        .set((
+            duplicate_of.eq(&near_duplicate.duplicate_of),
+            distance.eq(near_duplicate.distance),
+            seen_at.eq(near_duplicate.seen_at),
+        ))
+        .execute(&mut conn)
+        .await?;
+
+    Ok(())
+}
+
+/// Takes the retries that are due, pushing their next attempt back so they aren't taken twice.
+///
+/// # Arguments
+///
+/// * `limit`: The maximum number of retries to take.
+/// * `lease`: How long until the retries are due again, in case the crawler stops before retrying them.
+///
+/// # Returns
+///
+/// * `Ok(Vec<Retry>)` - The retries, the longest overdue first.
+/// * `Err(Error)` - If the retries could not be taken.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the retries could not be retrieved or updated.
+pub async fn take_due_retries(limit: i64, lease: Duration) -> Result<Vec<Retry>, Error> {
+    use crate::database::schema::retry_later::dsl::{dead, next_attempt_at, retry_later, url};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    let now = SystemTime::now();
+    let urls = retry_later
+        .filter(dead.eq(false))
+        .filter(next_attempt_at.le(now))
+        .order(next_attempt_at.asc())
+        .limit(limit)
+        .select(url)
+        .load::<String>(&mut conn)
+        .await?;
+
+    let mut taken = diesel::update(
+        retry_later
+            .filter(url.eq_any(&urls))
+            .filter(next_attempt_at.le(now)),
+    )
+    .set(next_attempt_at.eq(now + lease))
+    .returning(Retry::as_returning())
+    .get_results(&mut conn)
+    .await?;
+    taken.sort_by_key(|retry| urls.iter().position(|other| other == &retry.url));
+
+    Ok(taken)
+}
+
+/// Adds to the crawl usage, creating the entries that don't exist yet.
+///
+/// # Arguments
+///
+/// * `usage`: The usage to add, per day, crawl run and host.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the usage was successfully added.
+/// * `Err(Error)` - If the usage was not added.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the usage could not be added.
+pub async fn add_crawl_usage(usage: &[CrawlUsage]) -> Result<(), Error> {
+    use crate::database::schema::crawl_usage::dsl::{
+        bytes, crawl_usage, day, host, requests, run_id,
+    };
+    use diesel::upsert::excluded;
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    for batch in usage.chunks(1_000) {
+        diesel::insert_into(crawl_usage)
+            .values(batch)
+            .on_conflict((day, run_id, host))
+            .do_update()
+            .set((
+                bytes.eq(bytes + excluded(bytes)),
+                requests.eq(requests + excluded(requests)),
+            ))
+            .execute(&mut conn)
+            .await?;
+    }
+
+    Ok(())
+}
+
+/// Gets the crawl usage recorded since a day.
+///
+/// # Arguments
+///
+/// * `since`: The start of the first day to get the usage of.
+///
+/// # Returns
+///
+/// * `Ok(Vec<CrawlUsage>)` - The usage per day, crawl run and host if successful.
+/// * `Err(Error)` - If the usage could not be retrieved.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the usage could not be retrieved.
+pub async fn get_crawl_usage_since(since: SystemTime) -> Result<Vec<CrawlUsage>, Error> {
+    use crate::database::schema::crawl_usage::dsl::{crawl_usage, day};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    Ok(crawl_usage
+        .filter(day.ge(since))
+        .select(CrawlUsage::as_select())
+        .load(&mut conn)
+        .await?)
+}
+
+/// Adds crawls to the crawl log.
+///
+/// # Arguments
+///
+/// * `events`: The crawls to add.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the crawls were successfully added.
+/// * `Err(Error)` - If the crawls were not added.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the crawls could not be added.
+pub async fn add_crawl_events(events: &[NewCrawlEvent]) -> Result<(), Error> {
+    use crate::database::schema::crawl_log::dsl::crawl_log;
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    for batch in events.chunks(1_000) {
+        diesel::insert_into(crawl_log)
+            .values(batch)
+            .execute(&mut conn)
+            .await?;
+    }
+
+    Ok(())
+}
+
+/// Gets a page of the crawl log, newest first.
+///
+/// # Arguments
+///
+/// * `filter`: The filters the crawls must match.
+/// * `before`: When the last crawl of the previous page was, and its ID, to continue after it.
+/// * `limit`: The maximum number of crawls to get.
+///
+/// # Returns
+///
+/// * `Ok(Vec<CrawlEvent>)` - The crawls if successful.
+/// * `Err(Error)` - If the crawls could not be retrieved.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the crawls could not be retrieved.
+pub async fn get_crawl_events(
+    filter: &CrawlLogFilter,
+    before: Option<(SystemTime, i64)>,
+    limit: i64,
+) -> Result<Vec<CrawlEvent>, Error> {
+    use crate::database::schema::crawl_log::dsl::{crawled_at, id};
+    use diesel::BoolExpressionMethods;
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    let mut query = filter_crawl_log(filter);
+    if let Some((before_at, before_id)) = before {
+        query = query.filter(
+            crawled_at
+                .lt(before_at)
+                .or(crawled_at.eq(before_at).and(id.lt(before_id))),
+        );
+    }
+
+    Ok(query
+        .order((crawled_at.desc(), id.desc()))
+        .limit(limit)
+        .select(CrawlEvent::as_select())
+        .load(&mut conn)
+        .await?)
+}
+
+/// Counts the crawls in the crawl log by their error code and status.
+///
+/// # Arguments
+///
+/// * `filter`: The filters the crawls must match.
+///
+/// # Returns
+///
+/// * `Ok(Vec<(Option<String>, Option<i32>, i64)>)` - The error code, status and number of crawls of each group.
+/// * `Err(Error)` - If the crawls could not be counted.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the crawls could not be counted.
+pub async fn count_crawl_events(
+    filter: &CrawlLogFilter,
+) -> Result<Vec<(Option<String>, Option<i32>, i64)>, Error> {
+    use crate::database::schema::crawl_log::dsl::{error_code, status};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    Ok(filter_crawl_log(filter)
+        .group_by((error_code, status))
+        .select((error_code, status, diesel::dsl::count_star()))
+        .load::<(Option<String>, Option<i32>, i64)>(&mut conn)
+        .await?)
+}
+
+/// Gets the settings of every host that differs from the defaults.
+///
+/// # Returns
+///
+/// * `Ok(Vec<HostOverride>)` - The settings of the hosts if successful.
+/// * `Err(Error)` - If the settings could not be retrieved.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the settings could not be retrieved.
+pub async fn get_host_overrides() -> Result<Vec<HostOverride>, Error> {
+    use crate::database::schema::host_overrides::dsl::host_overrides;
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    Ok(host_overrides
+        .select(HostOverride::as_select())
+        .load(&mut conn)
+        .await?)
+}
+
+/// Sets the settings of a host, replacing any it had.
+///
+/// # Arguments
+///
+/// * `host_override`: The settings of the host.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the settings were set.
+/// * `Err(Error)` - If the settings could not be set.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the settings could not be set.
+pub async fn set_host_override(host_override: &HostOverride) -> Result<(), Error> {
+    use crate::database::schema::host_overrides::dsl::{host, host_overrides};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    diesel::insert_into(host_overrides)
+        .values(host_override)
+        .on_conflict(host)
+        .do_update()
+        .set(host_override)
+        .execute(&mut conn)
+        .await?;
+
+    Ok(())
+}
+
+/// Gets every curation, including the expired ones.
+///
+/// # Returns
+///
+/// * `Ok(Vec<Curation>)` - The curations, oldest first, if successful.
+/// * `Err(Error)` - If the curations could not be retrieved.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the curations could not be retrieved.
+pub async fn get_curations() -> Result<Vec<Curation>, Error> {
+    use crate::database::schema::curations::dsl::{curations, id};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    Ok(curations
+        .order(id.asc())
+        .select(Curation::as_select())
+        .load(&mut conn)
+        .await?)
+}
+
+/// Creates a curation.
+///
+/// # Arguments
+///
+/// * `new_curation`: The curation to create.
+///
+/// # Returns
+///
+/// * `Ok(Curation)` - The created curation if successful.
+/// * `Err(Error)` - If the curation was not created.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the curation could not be created.
+pub async fn create_curation(new_curation: &NewCuration) -> Result<Curation, Error> {
+    use crate::database::schema::curations::dsl::curations;
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    Ok(diesel::insert_into(curations)
+        .values(new_curation)
+        .returning(Curation::as_returning())
+        .get_result(&mut conn)
+        .await?)
+}
+
+/// Replaces a curation.
+///
+/// # Arguments
+///
+/// * `curation_id`: The ID of the curation.
+/// * `new_curation`: What to replace the curation with.
+///
+/// # Returns
+///
+/// * `Ok(Some(Curation))` - The updated curation if it exists.
+/// * `Ok(None)` - If there is no curation with the ID.
+/// * `Err(Error)` - If the curation could not be updated.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the curation could not be updated.
+pub async fn update_curation(
+    curation_id: i32,
+    new_curation: &NewCuration,
+) -> Result<Option<Curation>, Error> {
+    use crate::database::schema::curations::dsl::{curations, id};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    Ok(diesel::update(curations.filter(id.eq(curation_id)))
+        .set(new_curation)
+        .returning(Curation::as_returning())
+        .get_result(&mut conn)
+        .await
+        .optional()?)
+}
+
+/// Deletes a curation.
+///
+/// # Arguments
+///
+/// * `curation_id`: The ID of the curation.
+///
+/// # Returns
+///
+/// * `Ok(bool)` - Whether there was a curation with the ID.
+/// * `Err(Error)` - If the curation could not be deleted.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the curation could not be deleted.
+pub async fn delete_curation(curation_id: i32) -> Result<bool, Error> {
+    use crate::database::schema::curations::dsl::{curations, id};
+
+    let Ok(mut conn) = get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    let deleted = diesel::delete(curations.filter(id.eq(curation_id)))
+        .execute(&mut conn)
+        .await?;
+
+    Ok(deleted > 0)
+}
+
+/// Builds a query of the crawl log, with the filters applied.
+///
+/// # Arguments
+///
+/// * `filter`: The filters the crawls must match.
+///
+/// # Returns
+///
+/// * `BoxedQuery` - The query of the crawls in the window of the filter, matching the other filters that are set.
+fn filter_crawl_log(
+    filter: &CrawlLogFilter,
+) -> crate::database::schema::crawl_log::BoxedQuery<'_, diesel::pg::Pg> {
+    use crate::database::schema::crawl_log::dsl::{
+        crawl_log, crawled_at, error_code, host, status,
+    };
+
+    let mut query = crawl_log
+        .filter(crawled_at.ge(filter.since))
+        .filter(crawled_at.lt(filter.until))
+        .into_boxed();
+    if let Some(filter_host) = &filter.host {
+        query = query.filter(host.eq(filter_host));
+    }
+    if let Some(filter_status) = filter.status {
+        query = query.filter(status.eq(filter_status));
+    }
+    if let Some(filter_error_code) = &filter.error_code {
+        query = query.filter(error_code.eq(filter_error_code));
+    }
+
+    query
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_restore_frontier_entries() {
+        let url = |url: &str| Url::parse(url).expect("Failed to parse URL!");
+        let frontier = HashMap::from([
+            (url("https://example.com/"), 0),
+            (url("https://example.com/a"), 1),
+            (url("https://example.com/a/b"), 2),
+            (url("https://example.org/deep"), 7),
+        ]);
+        let entries = get_frontier_entries(1, &frontier.clone().into_iter().collect::<Vec<_>>())
+            .expect("Failed to get frontier entries!");
+
+        // Every URL comes back at the depth it was queued at.
+        let taken_at = SystemTime::UNIX_EPOCH + Duration::from_secs(1_000);
+        assert_eq!(
+            restore_frontier_entries(entries.clone(), &HashMap::new(), taken_at),
+            frontier
+        );
+
+        // Pages crawled since the snapshot are left out, and pages crawled before it are crawled again.
+        let crawled_at = HashMap::from([
+            ("https://example.com/a".to_string(), taken_at),
+            (
+                "https://example.org/deep".to_string(),
+                taken_at + Duration::from_secs(1),
+            ),
+            (
+                "https://example.com/".to_string(),
+                taken_at - Duration::from_secs(1),
+            ),
+        ]);
+        assert_eq!(
+            restore_frontier_entries(entries, &crawled_at, taken_at),
+            HashMap::from([
+                (url("https://example.com/"), 0),
+                (url("https://example.com/a/b"), 2),
+            ])
+        );
+    }
+
+    #[test]
+    fn test_select_candidate_ids() {
+        let words = vec!["rust".to_string()];
+        let query =
+            diesel::debug_query::<diesel::pg::Pg, _>(&select_candidate_ids(&words, 10)).to_string();
+
+        // The cap keeps the pages with the most occurrences, and the same ones every time.
+        assert!(
+            query.contains(
+                r#"ORDER BY sum("keywords"."frequency") DESC, "keywords"."page_id" ASC LIMIT"#
+            ),
+            "{query}"
+        );
+    }
+
+    #[test]
+    fn test_get_candidate_limit() {
+        assert_eq!(get_candidate_limit(Some(10_000)), 10_000);
+        assert_eq!(get_candidate_limit(Some(usize::MAX)), i64::MAX);
+        assert_eq!(get_candidate_limit(None), i64::MAX);
+    }
 }
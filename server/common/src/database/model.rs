@@ -1,4 +1,4 @@
-use diesel::{Insertable, Queryable, Selectable};
+use diesel::{AsChangeset, Insertable, Queryable, Selectable};
 use serde::{Deserialize, Serialize};
 use std::time::SystemTime;
 
@@ -10,6 +10,23 @@ use std::time::SystemTime;
 ///
 /// * `url`: The URL of the page.
 /// * `last_crawled_at`: The last time the page was crawled.
+///
+/// * `title`: The title of the page.
+/// * `description`: The description of the page.
+/// * `encoding`: The encoding the page was decoded from.
+/// * `index_fingerprint`: The fingerprint of the dictionary the page was indexed with.
+///
+/// * `first_seen_at`: The first time the page was crawled.
+/// * `language`: The primary language of the page, like `da` or `en`.
+/// * `published_at`: When the content of the page was published, if known.
+/// * `content_modified_at`: When the content of the page was last modified, if known.
+/// * `authenticated`: Whether the page was fetched with the credentials of its host.
+/// * `excluded`: Whether the page is left out of search results, because its host requires it of pages fetched with credentials.
+/// * `personalized`: Whether the response of the page varies by cookie or sets one, so others may see different content.
+/// * `unstable`: Whether the content of the page changed between two fetches right after each other.
+/// * `noarchive`: Whether the page may not be shown from the cache, because of a `noarchive` directive.
+/// * `etag`: The `ETag` header of the latest response of the page, if any.
+/// * `last_modified`: The `Last-Modified` header of the latest response of the page, if any.
 #[derive(
     Debug, Clone, Eq, PartialEq, Hash, Serialize, Deserialize, Queryable, Selectable, Insertable,
 )]
@@ -23,6 +40,27 @@ pub struct Page {
 
     pub title: Option<String>,
     pub description: Option<String>,
+    pub encoding: Option<String>,
+    pub index_fingerprint: Option<String>,
+
+    pub first_seen_at: SystemTime,
+    pub language: Option<String>,
+    pub published_at: Option<SystemTime>,
+    pub content_modified_at: Option<SystemTime>,
+    #[serde(default)]
+    pub authenticated: bool,
+    #[serde(default)]
+    pub excluded: bool,
+    #[serde(default)]
+    pub personalized: bool,
+    #[serde(default)]
+    pub unstable: bool,
+    #[serde(default)]
+    pub noarchive: bool,
+    #[serde(default)]
+    pub etag: Option<String>,
+    #[serde(default)]
+    pub last_modified: Option<String>,
 }
 
 /// A new web page.
@@ -33,7 +71,20 @@ pub struct Page {
 ///
 /// * `title`: The title of the page.
 /// * `description`: The description of the page.
-#[derive(Debug, Clone, Insertable)]
+/// * `encoding`: The encoding the page was decoded from.
+/// * `index_fingerprint`: The fingerprint of the dictionary the page was indexed with.
+/// * `language`: The primary language of the page, like `da` or `en`.
+/// * `published_at`: When the content of the page was published, if known.
+/// * `content_modified_at`: When the content of the page was last modified, if known.
+/// * `content`: The text of the page, as encoded by `Codec::compress`.
+/// * `authenticated`: Whether the page was fetched with the credentials of its host.
+/// * `excluded`: Whether the page is left out of search results, because its host requires it of pages fetched with credentials.
+/// * `personalized`: Whether the response of the page varies by cookie or sets one, so others may see different content.
+/// * `unstable`: Whether the content of the page changed between two fetches right after each other.
+/// * `noarchive`: Whether the page may not be shown from the cache, because of a `noarchive` directive.
+/// * `etag`: The `ETag` header of the latest response of the page, if any.
+/// * `last_modified`: The `Last-Modified` header of the latest response of the page, if any.
+#[derive(Debug, Clone, Insertable, AsChangeset)]
 #[diesel(table_name = crate::database::schema::pages)]
 #[diesel(check_for_backend(diesel::pg::Pg))]
 pub struct NewPage {
@@ -41,6 +92,115 @@ pub struct NewPage {
 
     pub title: Option<String>,
     pub description: Option<String>,
+    pub encoding: Option<String>,
+    pub index_fingerprint: Option<String>,
+    pub language: Option<String>,
+    pub published_at: Option<SystemTime>,
+    pub content_modified_at: Option<SystemTime>,
+    pub content: Option<Vec<u8>>,
+    pub authenticated: bool,
+    pub excluded: bool,
+    pub personalized: bool,
+    pub unstable: bool,
+    pub noarchive: bool,
+    pub etag: Option<String>,
+    pub last_modified: Option<String>,
+}
+
+/// A crawl of a page.
+///
+/// # Fields
+///
+/// * `id`: The ID of the crawl.
+/// * `page_id`: The ID of the page that was crawled.
+///
+/// * `crawled_at`: When the page was crawled.
+/// * `content_hash`: The SHA-256 hash of the body of the page.
+/// * `status`: The HTTP status code of the response.
+/// * `size`: The size of the body in bytes.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize, Queryable, Selectable)]
+#[diesel(table_name = crate::database::schema::page_history)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct PageHistory {
+    pub id: i32,
+    pub page_id: i32,
+
+    pub crawled_at: SystemTime,
+    pub content_hash: String,
+    pub status: i32,
+    pub size: i32,
+}
+
+/// A new crawl of a page.
+///
+/// # Fields
+///
+/// * `page_id`: The ID of the page that was crawled.
+///
+/// * `content_hash`: The SHA-256 hash of the body of the page.
+/// * `status`: The HTTP status code of the response.
+/// * `size`: The size of the body in bytes.
+#[derive(Debug, Clone, Insertable)]
+#[diesel(table_name = crate::database::schema::page_history)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct NewPageHistory {
+    pub page_id: i32,
+
+    pub content_hash: String,
+    pub status: i32,
+    pub size: i32,
+}
+
+/// The part of a page a keyword is from.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum Field {
+    /// The title of the page.
+    Title,
+    /// The `h1`, `h2` and `h3` headings of the page.
+    Heading,
+    /// The text of the body of the page.
+    #[default]
+    Body,
+    /// The alt text and captions of the images on the page.
+    Image,
+}
+
+impl Field {
+    /// Gets the name of the field, as it's stored.
+    ///
+    /// # Returns
+    ///
+    /// * `&'static str` - `title`, `heading`, `body` or `image`.
+    #[must_use]
+    pub const fn as_str(self) -> &'static str {
+        match self {
+            Self::Title => "title",
+            Self::Heading => "heading",
+            Self::Body => "body",
+            Self::Image => "image",
+        }
+    }
+
+    /// Parses the name of a field.
+    ///
+    /// # Arguments
+    ///
+    /// * `field`: The name of the field.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Field)` - The field.
+    /// * `None` - If there is no field with the name.
+    #[must_use]
+    pub fn parse(field: &str) -> Option<Self> {
+        match field {
+            "title" => Some(Self::Title),
+            "heading" => Some(Self::Heading),
+            "body" => Some(Self::Body),
+            "image" => Some(Self::Image),
+            _ => None,
+        }
+    }
 }
 
 /// A keyword.
@@ -52,6 +212,8 @@ pub struct NewPage {
 ///
 /// * `word`: The word of the keyword.
 /// * `frequency`: The frequency of the keyword.
+/// * `positions`: The positions of the first occurrences of the keyword, counted in words.
+/// * `field`: The part of the page the keyword is from, `title`, `heading`, `body` or `image`.
 #[derive(Debug, Clone, Eq, PartialEq, Hash, Serialize, Deserialize, Queryable, Selectable)]
 #[diesel(table_name = crate::database::schema::keywords)]
 #[diesel(check_for_backend(diesel::pg::Pg))]
@@ -61,6 +223,34 @@ pub struct Keyword {
 
     pub word: String,
     pub frequency: i32,
+    pub positions: Vec<i32>,
+    pub field: String,
+}
+
+/// A keyword on a page, along with the URL and language of the page.
+///
+/// # Fields
+///
+/// * `url`: The URL of the page.
+/// * `language`: The primary language of the page, if known.
+/// * `published_at`: When the content of the page was published, if known.
+/// * `unstable`: Whether the content of the page changed between two fetches right after each other.
+///
+/// * `word`: The word of the keyword.
+/// * `frequency`: The frequency of the keyword.
+/// * `positions`: The positions of the first occurrences of the keyword, counted in words.
+/// * `field`: The part of the page the keyword is from, `title`, `heading`, `body` or `image`.
+#[derive(Debug, Clone, PartialEq, Eq, Queryable)]
+pub struct WordMatch {
+    pub url: String,
+    pub language: Option<String>,
+    pub published_at: Option<SystemTime>,
+    pub unstable: bool,
+
+    pub word: String,
+    pub frequency: i32,
+    pub positions: Vec<i32>,
+    pub field: String,
 }
 
 /// A new keyword.
@@ -71,6 +261,8 @@ pub struct Keyword {
 ///
 /// * `word`: The word of the keyword.
 /// * `frequency`: The frequency of the keyword.
+/// * `positions`: The positions of the first occurrences of the keyword, counted in words.
+/// * `field`: The part of the page the keyword is from, `title`, `heading`, `body` or `image`.
 #[derive(Debug, Insertable)]
 #[diesel(table_name = crate::database::schema::keywords)]
 #[diesel(check_for_backend(diesel::pg::Pg))]
@@ -79,6 +271,156 @@ pub struct NewKeyword {
 
     pub word: String,
     pub frequency: i32,
+    pub positions: Vec<i32>,
+    pub field: String,
+}
+
+/// An image on a page.
+///
+/// # Fields
+///
+/// * `id`: The ID of the image.
+/// * `page_id`: The ID of the page the image is on.
+///
+/// * `url`: The URL of the image.
+/// * `alt`: The alt text of the image, if any.
+/// * `caption`: The caption of the figure the image is in, if any.
+/// * `position`: The order of the image on the page, starting at `0`.
+#[derive(Debug, Clone, Eq, PartialEq, Serialize, Deserialize, Queryable, Selectable)]
+#[diesel(table_name = crate::database::schema::images)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct Image {
+    pub id: i32,
+    pub page_id: i32,
+
+    pub url: String,
+    pub alt: Option<String>,
+    pub caption: Option<String>,
+    pub position: i32,
+}
+
+/// A new image.
+///
+/// # Fields
+///
+/// * `page_id`: The ID of the page the image is on.
+///
+/// * `url`: The URL of the image.
+/// * `alt`: The alt text of the image, if any.
+/// * `caption`: The caption of the figure the image is in, if any.
+/// * `position`: The order of the image on the page, starting at `0`.
+#[derive(Debug, Insertable)]
+#[diesel(table_name = crate::database::schema::images)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct NewImage {
+    pub page_id: i32,
+
+    pub url: String,
+    pub alt: Option<String>,
+    pub caption: Option<String>,
+    pub position: i32,
+}
+
+/// A new simhash of the text of a page.
+///
+/// # Fields
+///
+/// * `page_id`: The ID of the page.
+///
+/// * `simhash`: The simhash of the text of the page.
+/// * `band_0`: The highest 16 bits of the simhash.
+/// * `band_1`: The next 16 bits of the simhash.
+/// * `band_2`: The next 16 bits of the simhash.
+/// * `band_3`: The lowest 16 bits of the simhash.
+#[derive(Debug, Insertable)]
+#[diesel(table_name = crate::database::schema::simhashes)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct NewSimhash {
+    pub page_id: i32,
+
+    pub simhash: i64,
+    pub band_0: i32,
+    pub band_1: i32,
+    pub band_2: i32,
+    pub band_3: i32,
+}
+
+/// A structured data entity on a page, like an article or a product.
+///
+/// # Fields
+///
+/// * `id`: The ID of the entity.
+/// * `page_id`: The ID of the page the entity is on.
+///
+/// * `kind`: The kind of the entity, like `article` or `product`.
+/// * `data`: The JSON-LD of the entity.
+/// * `position`: The order of the entity on the page, starting at `0`.
+#[derive(Debug, Clone, Eq, PartialEq, Serialize, Deserialize, Queryable, Selectable)]
+#[diesel(table_name = crate::database::schema::structured_data)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct StructuredData {
+    pub id: i32,
+    pub page_id: i32,
+
+    pub kind: String,
+    pub data: String,
+    pub position: i32,
+}
+
+/// A new structured data entity.
+///
+/// # Fields
+///
+/// * `page_id`: The ID of the page the entity is on.
+///
+/// * `kind`: The kind of the entity, like `article` or `product`.
+/// * `data`: The JSON-LD of the entity.
+/// * `position`: The order of the entity on the page, starting at `0`.
+#[derive(Debug, Insertable)]
+#[diesel(table_name = crate::database::schema::structured_data)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct NewStructuredData {
+    pub page_id: i32,
+
+    pub kind: String,
+    pub data: String,
+    pub position: i32,
+}
+
+/// The anchor text of the links from a page to a URL.
+///
+/// # Fields
+///
+/// * `from_page_id`: The ID of the page the links are on.
+/// * `to_page_url`: The URL the links point to.
+///
+/// * `text`: The distinct anchor texts of the links, one per line.
+#[derive(Debug, Clone, Eq, PartialEq, Serialize, Deserialize, Queryable, Selectable)]
+#[diesel(table_name = crate::database::schema::link_anchors)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct LinkAnchor {
+    pub from_page_id: i32,
+    pub to_page_url: String,
+
+    pub text: String,
+}
+
+/// A new anchor text of the links from a page to a URL.
+///
+/// # Fields
+///
+/// * `from_page_id`: The ID of the page the links are on.
+/// * `to_page_url`: The URL the links point to.
+///
+/// * `text`: The distinct anchor texts of the links, one per line.
+#[derive(Debug, Insertable)]
+#[diesel(table_name = crate::database::schema::link_anchors)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct NewLinkAnchor {
+    pub from_page_id: i32,
+    pub to_page_url: String,
+
+    pub text: String,
 }
 
 /*
@@ -156,3 +498,407 @@ pub struct NewForwardLink {
     pub to_page_url: String,
     pub frequency: i32,
 }
+
+/// A snapshot of the crawl frontier.
+///
+/// # Fields
+///
+/// * `id`: The ID of the snapshot.
+///
+/// * `taken_at`: The time the snapshot was taken.
+/// * `completed`: Whether all the entries of the snapshot have been written.
+#[derive(Debug, Clone, Queryable, Selectable)]
+#[diesel(table_name = crate::database::schema::frontier_snapshots)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct FrontierSnapshot {
+    pub id: i32,
+
+    pub taken_at: SystemTime,
+    pub completed: bool,
+}
+
+/// An entry of a frontier snapshot.
+///
+/// # Fields
+///
+/// * `snapshot_id`: The ID of the snapshot the entry belongs to.
+///
+/// * `url`: The URL waiting to be crawled.
+/// * `depth`: The depth the URL was queued at.
+#[derive(Debug, Clone, Queryable, Selectable, Insertable)]
+#[diesel(table_name = crate::database::schema::frontier_entries)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct FrontierEntry {
+    pub snapshot_id: i32,
+
+    pub url: String,
+    pub depth: i32,
+}
+
+/// A new click on a search result.
+///
+/// # Fields
+///
+/// * `query_hash`: The hash of the query the result was returned for.
+///
+/// * `url`: The URL of the result.
+/// * `position`: The 1-based position the result was shown at.
+/// * `ip_prefix`: The truncated IP address of the client.
+/// * `variant`: The ranking variant the result was ranked with.
+#[derive(Debug, Clone, Insertable)]
+#[diesel(table_name = crate::database::schema::clicks)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct NewClick {
+    pub query_hash: String,
+
+    pub url: String,
+    pub position: i32,
+    pub ip_prefix: String,
+    pub variant: String,
+}
+
+/// The click statistics of a search result for a query.
+///
+/// # Fields
+///
+/// * `query_hash`: The hash of the query.
+/// * `url`: The URL of the result.
+///
+/// * `clicks`: The number of clicks on the result.
+/// * `click_through_rate`: The position bias corrected share of the clicks for the query.
+#[derive(Debug, Clone, PartialEq, Queryable, Selectable, Insertable)]
+#[diesel(table_name = crate::database::schema::click_stats)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct ClickStat {
+    pub query_hash: String,
+    pub url: String,
+
+    pub clicks: i32,
+    pub click_through_rate: f64,
+}
+
+/// The authority of a domain, from how many other domains link to it.
+///
+/// # Fields
+///
+/// * `domain`: The domain.
+///
+/// * `score`: The authority of the domain, from `0` to `1`.
+/// * `linking_domains`: The number of other domains linking to the domain.
+/// * `seeded`: Whether the score was set by an operator instead of derived from the links.
+#[derive(Debug, Clone, PartialEq, Queryable, Selectable, Insertable)]
+#[diesel(table_name = crate::database::schema::domain_authorities)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct DomainAuthority {
+    pub domain: String,
+
+    pub score: f64,
+    pub linking_domains: i32,
+    pub seeded: bool,
+}
+
+/// A new search.
+///
+/// # Fields
+///
+/// * `query_hash`: The hash of the query.
+///
+/// * `variant`: The ranking variant the results were ranked with.
+/// * `results`: The number of pages found.
+#[derive(Debug, Clone, Insertable)]
+#[diesel(table_name = crate::database::schema::searches)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct NewSearch {
+    pub query_hash: String,
+
+    pub variant: String,
+    pub results: i32,
+}
+
+/// A URL submitted to be crawled.
+///
+/// # Fields
+///
+/// * `id`: The ID of the submission.
+///
+/// * `url`: The submitted URL.
+/// * `domain`: The host of the URL.
+/// * `ip_prefix`: The truncated IP address of the submitter.
+/// * `token`: The token the site has to publish to verify the submission.
+/// * `verified`: Whether the site published the token.
+/// * `queued`: Whether the crawler has queued the URL.
+/// * `submitted_at`: When the URL was submitted.
+#[derive(Debug, Clone, Queryable, Selectable)]
+#[diesel(table_name = crate::database::schema::submissions)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct Submission {
+    pub id: i32,
+
+    pub url: String,
+    pub domain: String,
+    pub ip_prefix: String,
+    pub token: String,
+    pub verified: bool,
+    pub queued: bool,
+    pub submitted_at: SystemTime,
+}
+
+/// A new URL submitted to be crawled.
+///
+/// # Fields
+///
+/// * `url`: The submitted URL.
+/// * `domain`: The host of the URL.
+/// * `ip_prefix`: The truncated IP address of the submitter.
+/// * `token`: The token the site has to publish to verify the submission.
+#[derive(Debug, Clone, Insertable)]
+#[diesel(table_name = crate::database::schema::submissions)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct NewSubmission {
+    pub url: String,
+    pub domain: String,
+    pub ip_prefix: String,
+    pub token: String,
+}
+
+/// The bytes downloaded and requests made for a host by a crawl run on a day.
+///
+/// # Fields
+///
+/// * `day`: The start of the UTC day the usage was recorded on.
+/// * `run_id`: The crawl run the usage was recorded by.
+/// * `host`: The host the requests were made to.
+///
+/// * `bytes`: The bytes of the bodies downloaded.
+/// * `requests`: The number of requests made.
+#[derive(Debug, Clone, PartialEq, Eq, Queryable, Selectable, Insertable)]
+#[diesel(table_name = crate::database::schema::crawl_usage)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct CrawlUsage {
+    pub day: SystemTime,
+    pub run_id: String,
+    pub host: String,
+
+    pub bytes: i64,
+    pub requests: i64,
+}
+
+/// A crawl of a URL, successful or not.
+///
+/// # Fields
+///
+/// * `id`: The ID of the crawl.
+///
+/// * `url`: The URL that was crawled.
+/// * `host`: The host of the URL.
+/// * `status`: The HTTP status code of the response, if there was one.
+/// * `error_code`: The stable code of the error the crawl failed with, if any.
+/// * `crawled_at`: When the URL was crawled.
+#[derive(Debug, Clone, PartialEq, Eq, Queryable, Selectable, Serialize)]
+#[diesel(table_name = crate::database::schema::crawl_log)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct CrawlEvent {
+    pub id: i64,
+
+    pub url: String,
+    pub host: String,
+    pub status: Option<i32>,
+    pub error_code: Option<String>,
+    pub crawled_at: SystemTime,
+}
+
+/// A new crawl of a URL.
+///
+/// # Fields
+///
+/// * `url`: The URL that was crawled.
+/// * `host`: The host of the URL.
+/// * `status`: The HTTP status code of the response, if there was one.
+/// * `error_code`: The stable code of the error the crawl failed with, if any.
+/// * `crawled_at`: When the URL was crawled.
+#[derive(Debug, Clone, PartialEq, Eq, Insertable)]
+#[diesel(table_name = crate::database::schema::crawl_log)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct NewCrawlEvent {
+    pub url: String,
+    pub host: String,
+    pub status: Option<i32>,
+    pub error_code: Option<String>,
+    pub crawled_at: SystemTime,
+}
+
+/// The filters of a query of the crawl log.
+///
+/// # Fields
+///
+/// * `host`: The host the crawls must be of, if any.
+/// * `status`: The HTTP status code the crawls must have, if any.
+/// * `error_code`: The error code the crawls must have failed with, if any.
+/// * `since`: The earliest time the crawls may be from.
+/// * `until`: The time the crawls must be from before.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct CrawlLogFilter {
+    pub host: Option<String>,
+    pub status: Option<i32>,
+    pub error_code: Option<String>,
+    pub since: SystemTime,
+    pub until: SystemTime,
+}
+
+/// The number of rows in the tables of the index.
+///
+/// # Fields
+///
+/// * `pages`: The number of pages.
+/// * `keywords`: The number of keywords.
+/// * `forward_links`: The number of links between pages.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct RowCounts {
+    pub pages: i64,
+    pub keywords: i64,
+    pub forward_links: i64,
+}
+
+/// The settings of a host that differ from the defaults.
+///
+/// # Fields
+///
+/// * `host`: The host.
+/// * `credentials`: The credentials sent to the host, encrypted, if any.
+/// * `exclude_from_search`: Whether the pages fetched with the credentials are left out of search results.
+/// * `allow_http`: Whether the credentials are also sent over plain HTTP, instead of only over HTTPS.
+#[derive(Debug, Clone, PartialEq, Eq, Queryable, Selectable, Insertable, AsChangeset)]
+#[diesel(table_name = crate::database::schema::host_overrides)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+#[diesel(treat_none_as_null = true)]
+pub struct HostOverride {
+    pub host: String,
+    pub credentials: Option<Vec<u8>>,
+    pub exclude_from_search: bool,
+    pub allow_http: bool,
+}
+
+/// A curation of the results of a query by an admin.
+///
+/// # Fields
+///
+/// * `id`: The ID of the curation.
+///
+/// * `pattern`: The normalized query the curation applies to.
+/// * `url`: The URL of the page that's curated.
+/// * `action`: What's done to the page, `pin`, `boost`, `demote` or `block`.
+/// * `weight`: The order of pins, highest first, or the factor of boosts and demotions.
+/// * `expires_at`: When the curation stops applying, if ever.
+/// * `created_at`: When the curation was created.
+#[derive(Debug, Clone, PartialEq, Queryable, Selectable, Serialize)]
+#[diesel(table_name = crate::database::schema::curations)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct Curation {
+    pub id: i32,
+
+    pub pattern: String,
+    pub url: String,
+    pub action: String,
+    pub weight: f64,
+    pub expires_at: Option<SystemTime>,
+    pub created_at: SystemTime,
+}
+
+/// A new curation of the results of a query.
+///
+/// # Fields
+///
+/// * `pattern`: The normalized query the curation applies to.
+/// * `url`: The URL of the page that's curated.
+/// * `action`: What's done to the page, `pin`, `boost`, `demote` or `block`.
+/// * `weight`: The order of pins, highest first, or the factor of boosts and demotions.
+/// * `expires_at`: When the curation stops applying, if ever.
+#[derive(Debug, Clone, PartialEq, Insertable, AsChangeset)]
+#[diesel(table_name = crate::database::schema::curations)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+#[diesel(treat_none_as_null = true)]
+pub struct NewCuration {
+    pub pattern: String,
+    pub url: String,
+    pub action: String,
+    pub weight: f64,
+    pub expires_at: Option<SystemTime>,
+}
+
+/// A URL that failed to be fetched, to be retried later.
+///
+/// # Fields
+///
+/// * `url`: The URL.
+/// * `depth`: The depth the URL was queued at.
+/// * `attempts`: The number of times fetching the URL failed.
+/// * `error`: The code of the last error.
+/// * `dead`: Whether the URL ran out of attempts, and isn't retried anymore.
+/// * `next_attempt_at`: When the URL is retried next.
+#[derive(Debug, Clone, PartialEq, Eq, Queryable, Selectable, Insertable, AsChangeset)]
+#[diesel(table_name = crate::database::schema::retry_later)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct Retry {
+    pub url: String,
+    pub depth: i32,
+    pub attempts: i32,
+    pub error: String,
+    pub dead: bool,
+    pub next_attempt_at: SystemTime,
+}
+
+/// A URL that redirects, which is an alias of the URL its chain of redirects ends at.
+///
+/// # Fields
+///
+/// * `url`: The URL.
+/// * `next_url`: The URL it redirects to.
+/// * `final_url`: The URL the chain of redirects ends at, which is indexed instead.
+/// * `hop`: The position of the redirect in the chain, starting at `1`.
+/// * `status`: The status code of the redirect.
+/// * `seen_at`: When the redirect was last followed.
+#[derive(Debug, Clone, PartialEq, Eq, Queryable, Selectable, Insertable, AsChangeset)]
+#[diesel(table_name = crate::database::schema::redirects)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct Redirect {
+    pub url: String,
+    pub next_url: String,
+    pub final_url: String,
+    pub hop: i32,
+    pub status: i32,
+    pub seen_at: SystemTime,
+}
+
+/// A variant of a page, which is an alias of the canonical URL it declares.
+///
+/// # Fields
+///
+/// * `url`: The URL of the variant.
+/// * `canonical_url`: The canonical URL, which is indexed instead.
+/// * `seen_at`: When the variant was last crawled.
+#[derive(Debug, Clone, PartialEq, Eq, Queryable, Selectable, Insertable, AsChangeset)]
+#[diesel(table_name = crate::database::schema::canonicals)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct Canonical {
+    pub url: String,
+    pub canonical_url: String,
+    pub seen_at: SystemTime,
+}
+
+/// A page nearly the same as another, which isn't indexed.
+///
+/// # Fields
+///
+/// * `url`: The URL of the page.
+/// * `duplicate_of`: The URL of the indexed page it's nearly the same as.
+/// * `distance`: The number of bits the simhashes of the pages differ in.
+/// * `seen_at`: When the page was last crawled.
+#[derive(Debug, Clone, PartialEq, Eq, Queryable, Selectable, Insertable, AsChangeset)]
+#[diesel(table_name = crate::database::schema::near_duplicates)]
+#[diesel(check_for_backend(diesel::pg::Pg))]
+pub struct NearDuplicate {
+    pub url: String,
+    pub duplicate_of: String,
+    pub distance: i32,
+    pub seen_at: SystemTime,
+}
@@ -0,0 +1,195 @@
+use crate::errors::Error;
+use log::warn;
+use std::future::Future;
+use std::sync::Mutex;
+use std::time::{Duration, Instant};
+
+/// A circuit breaker, failing fast when a database is clearly down instead of piling up retries.
+///
+/// # Fields
+///
+/// * `threshold`: The number of consecutive failures before the breaker opens.
+/// * `cooldown`: The time the breaker stays open before letting a single query through to probe the database.
+/// * `state`: The state of the breaker.
+#[derive(Debug)]
+pub struct CircuitBreaker {
+    threshold: u32,
+    cooldown: Duration,
+    state: Mutex<State>,
+}
+
+/// The state of a circuit breaker.
+///
+/// # Fields
+///
+/// * `failures`: The number of consecutive failures.
+/// * `opened_at`: When the breaker opened, if it's open.
+/// * `probing`: Whether a query is probing the database after the cooldown.
+#[derive(Debug, Default)]
+struct State {
+    failures: u32,
+    opened_at: Option<Instant>,
+    probing: bool,
+}
+
+impl CircuitBreaker {
+    /// Creates a new, closed circuit breaker.
+    ///
+    /// # Arguments
+    ///
+    /// * `threshold`: The number of consecutive failures before the breaker opens.
+    /// * `cooldown`: The time the breaker stays open before letting a query through again.
+    ///
+    /// # Returns
+    ///
+    /// * `CircuitBreaker` - The new circuit breaker.
+    #[must_use]
+    pub fn new(threshold: u32, cooldown: Duration) -> Self {
+        Self {
+            threshold,
+            cooldown,
+            state: Mutex::new(State::default()),
+        }
+    }
+
+    /// Checks if a query may be sent to the database.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the breaker is closed, or this query is the one probing the database after the cooldown.
+    #[must_use]
+    pub fn allow(&self) -> bool {
+        let Ok(mut state) = self.state.lock() else {
+            return false;
+        };
+
+        match state.opened_at {
+            None => true,
+            Some(opened_at) if !state.probing && opened_at.elapsed() >= self.cooldown => {
+                state.probing = true;
+
+                true
+            }
+            Some(_) => false,
+        }
+    }
+
+    /// Records a successful query, closing the breaker.
+    pub fn record_success(&self) {
+        if let Ok(mut state) = self.state.lock() {
+            *state = State::default();
+        }
+    }
+
+    /// Records a failed query, opening the breaker if there have been too many in a row.
+    pub fn record_failure(&self) {
+        if let Ok(mut state) = self.state.lock() {
+            state.failures = state.failures.saturating_add(1);
+
+            if state.probing || state.failures >= self.threshold {
+                state.opened_at = Some(Instant::now());
+                state.probing = false;
+            }
+        }
+    }
+}
+
+/// Runs a database operation, retrying it with exponential backoff while the database is unavailable.
+///
+/// # Arguments
+///
+/// * `breaker`: The circuit breaker of the database.
+/// * `retries`: The maximum number of times to retry the operation.
+/// * `backoff`: The pause before the first retry, doubled on each retry after it.
+/// * `operation`: The operation to run.
+///
+/// # Returns
+///
+/// * `Ok(T)` - The result of the operation if successful.
+/// * `Err(Error)` - If the operation failed, or the circuit breaker is open.
+///
+/// # Errors
+///
+/// * If the circuit breaker is open.
+/// * If the operation failed with an error that isn't transient.
+/// * If the operation still failed after all the retries.
+pub async fn with_retry<T, F, Fut>(
+    breaker: &CircuitBreaker,
+    retries: u32,
+    backoff: Duration,
+    mut operation: F,
+) -> Result<T, Error>
+where
+    F: FnMut() -> Fut,
+    Fut: Future<Output = Result<T, Error>>,
+{
+    let mut attempt = 0;
+    loop {
+        if !breaker.allow() {
+            return Err(Error::Unavailable(
+                "The database is unavailable, not trying again yet!".into(),
+            ));
+        }
+
+        match operation().await {
+            Ok(result) => {
+                breaker.record_success();
+
+                return Ok(result);
+            }
+            Err(err) if err.is_transient() => {
+                breaker.record_failure();
+
+                if attempt >= retries {
+                    return Err(err);
+                }
+
+                let pause = backoff.saturating_mul(2_u32.saturating_pow(attempt));
+                warn!("Database is unavailable, retrying in {pause:?}... (Error: {err})");
+
+                tokio::time::sleep(pause).await;
+                attempt += 1;
+            }
+            Err(err) => {
+                // The database answered, so it isn't down.
+                breaker.record_success();
+
+                return Err(err);
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_circuit_breaker() {
+        let breaker = CircuitBreaker::new(2, Duration::ZERO);
+
+        assert!(breaker.allow());
+        breaker.record_failure();
+        assert!(breaker.allow());
+        breaker.record_failure();
+
+        // Only a single query gets to probe the database once the cooldown is over.
+        assert!(breaker.allow());
+        assert!(!breaker.allow());
+
+        // A failed probe opens the breaker again, and a successful one closes it.
+        breaker.record_failure();
+        assert!(breaker.allow());
+        breaker.record_success();
+        assert!(breaker.allow());
+        assert!(breaker.allow());
+    }
+
+    #[test]
+    fn test_open_circuit_breaker() {
+        let breaker = CircuitBreaker::new(1, Duration::from_secs(60));
+
+        breaker.record_failure();
+        assert!(!breaker.allow());
+    }
+}
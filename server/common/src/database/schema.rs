@@ -1,5 +1,94 @@
 // @generated automatically by Diesel CLI.
 
+diesel::table! {
+    canonicals (url) {
+        #[max_length = 8192]
+        url -> Varchar,
+        #[max_length = 8192]
+        canonical_url -> Varchar,
+        seen_at -> Timestamp,
+    }
+}
+
+diesel::table! {
+    click_stats (query_hash, url) {
+        #[max_length = 64]
+        query_hash -> Varchar,
+        #[max_length = 8192]
+        url -> Varchar,
+        clicks -> Int4,
+        click_through_rate -> Float8,
+    }
+}
+
+diesel::table! {
+    clicks (id) {
+        id -> Int4,
+        #[max_length = 64]
+        query_hash -> Varchar,
+        #[max_length = 8192]
+        url -> Varchar,
+        position -> Int4,
+        #[max_length = 64]
+        ip_prefix -> Varchar,
+        clicked_at -> Timestamp,
+        #[max_length = 64]
+        variant -> Varchar,
+    }
+}
+
+diesel::table! {
+    crawl_log (id) {
+        id -> Int8,
+        #[max_length = 8192]
+        url -> Varchar,
+        #[max_length = 256]
+        host -> Varchar,
+        status -> Nullable<Int4>,
+        #[max_length = 64]
+        error_code -> Nullable<Varchar>,
+        crawled_at -> Timestamp,
+    }
+}
+
+diesel::table! {
+    crawl_usage (day, run_id, host) {
+        day -> Timestamp,
+        #[max_length = 64]
+        run_id -> Varchar,
+        #[max_length = 256]
+        host -> Varchar,
+        bytes -> Int8,
+        requests -> Int8,
+    }
+}
+
+diesel::table! {
+    curations (id) {
+        id -> Int4,
+        #[max_length = 256]
+        pattern -> Varchar,
+        #[max_length = 8192]
+        url -> Varchar,
+        #[max_length = 16]
+        action -> Varchar,
+        weight -> Float8,
+        expires_at -> Nullable<Timestamp>,
+        created_at -> Timestamp,
+    }
+}
+
+diesel::table! {
+    domain_authorities (domain) {
+        #[max_length = 256]
+        domain -> Varchar,
+        score -> Float8,
+        linking_domains -> Int4,
+        seeded -> Bool,
+        updated_at -> Timestamp,
+    }
+}
+
 diesel::table! {
     forward_links (from_page_id, to_page_url) {
         from_page_id -> Int4,
@@ -9,6 +98,47 @@ diesel::table! {
     }
 }
 
+diesel::table! {
+    frontier_entries (snapshot_id, url) {
+        snapshot_id -> Int4,
+        #[max_length = 8192]
+        url -> Varchar,
+        depth -> Int4,
+    }
+}
+
+diesel::table! {
+    frontier_snapshots (id) {
+        id -> Int4,
+        taken_at -> Timestamp,
+        completed -> Bool,
+    }
+}
+
+diesel::table! {
+    host_overrides (host) {
+        #[max_length = 256]
+        host -> Varchar,
+        credentials -> Nullable<Bytea>,
+        exclude_from_search -> Bool,
+        allow_http -> Bool,
+    }
+}
+
+diesel::table! {
+    images (id) {
+        id -> Int4,
+        page_id -> Int4,
+        #[max_length = 8192]
+        url -> Varchar,
+        #[max_length = 1024]
+        alt -> Nullable<Varchar>,
+        #[max_length = 1024]
+        caption -> Nullable<Varchar>,
+        position -> Int4,
+    }
+}
+
 diesel::table! {
     keywords (id) {
         id -> Int4,
@@ -16,6 +146,42 @@ diesel::table! {
         #[max_length = 128]
         word -> Varchar,
         frequency -> Int4,
+        positions -> Array<Int4>,
+        #[max_length = 8]
+        field -> Varchar,
+    }
+}
+
+diesel::table! {
+    link_anchors (from_page_id, to_page_url) {
+        from_page_id -> Int4,
+        #[max_length = 8192]
+        to_page_url -> Varchar,
+        #[max_length = 1024]
+        text -> Varchar,
+    }
+}
+
+diesel::table! {
+    near_duplicates (url) {
+        #[max_length = 8192]
+        url -> Varchar,
+        #[max_length = 8192]
+        duplicate_of -> Varchar,
+        distance -> Int4,
+        seen_at -> Timestamp,
+    }
+}
+
+diesel::table! {
+    page_history (id) {
+        id -> Int4,
+        page_id -> Int4,
+        crawled_at -> Timestamp,
+        #[max_length = 64]
+        content_hash -> Varchar,
+        status -> Int4,
+        size -> Int4,
     }
 }
 
@@ -29,10 +195,138 @@ diesel::table! {
         title -> Nullable<Varchar>,
         #[max_length = 1024]
         description -> Nullable<Varchar>,
+        #[max_length = 32]
+        encoding -> Nullable<Varchar>,
+        #[max_length = 64]
+        index_fingerprint -> Nullable<Varchar>,
+        first_seen_at -> Timestamp,
+        #[max_length = 8]
+        language -> Nullable<Varchar>,
+        published_at -> Nullable<Timestamp>,
+        content_modified_at -> Nullable<Timestamp>,
+        content -> Nullable<Bytea>,
+        authenticated -> Bool,
+        excluded -> Bool,
+        personalized -> Bool,
+        unstable -> Bool,
+        noarchive -> Bool,
+        #[max_length = 1024]
+        etag -> Nullable<Varchar>,
+        #[max_length = 64]
+        last_modified -> Nullable<Varchar>,
+        last_succeeded_at -> Timestamp,
+    }
+}
+
+diesel::table! {
+    redirects (url) {
+        #[max_length = 8192]
+        url -> Varchar,
+        #[max_length = 8192]
+        next_url -> Varchar,
+        #[max_length = 8192]
+        final_url -> Varchar,
+        hop -> Int4,
+        status -> Int4,
+        seen_at -> Timestamp,
+    }
+}
+
+diesel::table! {
+    retry_later (url) {
+        #[max_length = 8192]
+        url -> Varchar,
+        depth -> Int4,
+        attempts -> Int4,
+        #[max_length = 64]
+        error -> Varchar,
+        dead -> Bool,
+        next_attempt_at -> Timestamp,
+    }
+}
+
+diesel::table! {
+    searches (id) {
+        id -> Int4,
+        #[max_length = 64]
+        query_hash -> Varchar,
+        #[max_length = 64]
+        variant -> Varchar,
+        results -> Int4,
+        searched_at -> Timestamp,
+    }
+}
+
+diesel::table! {
+    simhashes (page_id) {
+        page_id -> Int4,
+        simhash -> Int8,
+        band_0 -> Int4,
+        band_1 -> Int4,
+        band_2 -> Int4,
+        band_3 -> Int4,
+    }
+}
+
+diesel::table! {
+    structured_data (id) {
+        id -> Int4,
+        page_id -> Int4,
+        #[max_length = 32]
+        kind -> Varchar,
+        data -> Text,
+        position -> Int4,
+    }
+}
+
+diesel::table! {
+    submissions (id) {
+        id -> Int4,
+        #[max_length = 8192]
+        url -> Varchar,
+        #[max_length = 256]
+        domain -> Varchar,
+        #[max_length = 64]
+        ip_prefix -> Varchar,
+        #[max_length = 64]
+        token -> Varchar,
+        verified -> Bool,
+        queued -> Bool,
+        submitted_at -> Timestamp,
     }
 }
 
 diesel::joinable!(forward_links -> pages (from_page_id));
+diesel::joinable!(frontier_entries -> frontier_snapshots (snapshot_id));
+diesel::joinable!(images -> pages (page_id));
 diesel::joinable!(keywords -> pages (page_id));
+diesel::joinable!(link_anchors -> pages (from_page_id));
+diesel::joinable!(page_history -> pages (page_id));
+diesel::joinable!(simhashes -> pages (page_id));
+diesel::joinable!(structured_data -> pages (page_id));
 
-diesel::allow_tables_to_appear_in_same_query!(forward_links, keywords, pages,);
+diesel::allow_tables_to_appear_in_same_query!(
+    canonicals,
+    click_stats,
+    clicks,
+    crawl_log,
+    crawl_usage,
+    curations,
+    domain_authorities,
+    forward_links,
+    frontier_entries,
+    frontier_snapshots,
+    host_overrides,
+    images,
+    keywords,
+    link_anchors,
+    near_duplicates,
+    page_history,
+    pages,
+    redirects,
+    retry_later,
+    searches,
+    simhashes,
+    structured_data,
+    submissions,
+);
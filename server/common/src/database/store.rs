@@ -0,0 +1,1035 @@
+use crate::database::model::{
+    Field, ForwardLink, Image, Keyword, NewForwardLink, NewImage, NewKeyword, NewLinkAnchor,
+    NewPage, NewPageHistory, NewSimhash, NewStructuredData, Page, RowCounts, WordMatch,
+};
+use crate::database::{self, CompletePage};
+use crate::errors::Error;
+use crate::utils;
+use crate::utils::simhash;
+use crate::utils::structured_data::Kind;
+use async_trait::async_trait;
+use futures::future::join_all;
+use sha2::{Digest, Sha256};
+use std::collections::{HashMap, HashSet};
+use std::fmt::Debug;
+use std::sync::Arc;
+use url::Url;
+
+/// The maximum number of keywords inserted in one query, to stay below the parameter limit of Postgres.
+const KEYWORD_BATCH_SIZE: usize = 10_000;
+
+/// The maximum number of similar simhashes looked up on each store, so a common band can't load them all.
+const SIMHASH_MATCH_LIMIT: i64 = 1_000;
+
+/// The number of links read at once when finding the links between domains.
+const LINK_BATCH_SIZE: i64 = 10_000;
+
+/// Loads the store of the databases in the environment.
+///
+/// # Returns
+///
+/// * `Arc<dyn Store>` - The Postgres database in `DATABASE_URL`, or the shards in `DATABASE_SHARDS` if there are any.
+///
+/// # Panics
+///
+/// * If `DATABASE_SHARDS` is not valid UTF-8.
+/// * If `DATABASE_SHARDS` isn't set, and `DATABASE_URL` is not set or not valid UTF-8.
+#[must_use]
+pub fn load() -> Arc<dyn Store> {
+    let mut urls = utils::env::database::get_database_urls();
+    if urls.len() == 1 {
+        return Arc::new(Postgres::new(urls.remove(0)));
+    }
+
+    Arc::new(Sharded::new(
+        urls.into_iter()
+            .map(|url| Box::new(Postgres::new(url)) as Box<dyn Store>)
+            .collect(),
+    ))
+}
+
+/// Gets the shard a page is stored on.
+///
+/// # Arguments
+///
+/// * `url`: The normalized URL of the page.
+/// * `shards`: The number of shards.
+///
+/// # Returns
+///
+/// * `usize` - The index of the shard.
+///
+/// # Notes
+///
+/// * The shard only depends on the URL and the number of shards, so it's the same across runs and machines.
+#[must_use]
+pub fn get_shard(url: &str, shards: usize) -> usize {
+    let hash = Sha256::digest(url.as_bytes());
+    let mut bytes = [0; 8];
+    bytes.copy_from_slice(&hash[..8]);
+
+    let shards = u64::try_from(shards.max(1)).unwrap_or(u64::MAX);
+
+    usize::try_from(u64::from_be_bytes(bytes) % shards).unwrap_or_default()
+}
+
+/// A crawled page, ready to be saved along with its history and index.
+///
+/// # Fields
+///
+/// * `page`: The page, with its text already compressed.
+/// * `content_hash`: The SHA-256 hash of the body of the page.
+/// * `status`: The HTTP status code of the response.
+/// * `size`: The size of the body in bytes.
+/// * `forward_links`: The links on the page, and how many times each is linked to.
+/// * `keywords`: The words on the page, with the field they're in, their frequency and positions.
+/// * `images`: The images on the page, with their alt text and caption, in the order they're on it.
+/// * `anchors`: The anchor text of the links on the page, by the URL they point to.
+/// * `structured_data`: The kind and JSON-LD of the structured data entities on the page, in the order they're on it.
+/// * `simhash`: The simhash of the text of the page, if it has enough words.
+#[derive(Debug, Clone)]
+pub struct CrawledPage {
+    pub page: NewPage,
+
+    pub content_hash: String,
+    pub status: i32,
+    pub size: i32,
+
+    pub forward_links: HashMap<Url, i32>,
+    pub keywords: Vec<(Field, String, i32, Vec<i32>)>,
+    pub images: Vec<(Url, Option<String>, Option<String>)>,
+    pub anchors: HashMap<Url, String>,
+    pub structured_data: Vec<(Kind, String)>,
+    pub simhash: Option<u64>,
+}
+
+/// A store of the crawled pages and their index, which the crawler writes to and the server searches.
+///
+/// # Methods
+///
+/// * `save_pages`: Saves crawled pages, replacing their previous index and keeping `history_length` crawls of each.
+/// * `get_pages_with_keywords`: Gets the pages matching the stemmed words of a query, along with their keywords.
+/// * `get_pages_by_urls`: Gets the pages with the given URLs, leaving out those that aren't stored.
+/// * `get_keywords`: Gets the keywords of a page.
+/// * `get_forward_links`: Gets the links on a page.
+/// * `touch_page`: Marks a page as crawled now, like when it wasn't modified since it was last crawled.
+/// * `delete_page`: Deletes a page along with its index, like when it may no longer be indexed.
+/// * `get_word_matches`: Gets the keywords matching the stemmed words of a query, along with the URL and language of their pages.
+/// * `get_backlinks`: Gets how many of the pages each backlink links to.
+/// * `get_word_counts`: Gets the most common stemmed words, and how many keywords there are of each.
+/// * `get_domain_links`: Gets the pairs of domains where a page on the first links to the second, each only once.
+/// * `count_rows`: Counts the pages, keywords and links in the index.
+/// * `get_term_stats`: Gets how many pages each stemmed word is on, and how often it occurs on them in total.
+/// * `get_images`: Gets the images on the pages with the given URLs, along with the URL of their page.
+/// * `get_content_hashes`: Gets the hash of the latest content of the pages with the given URLs, along with their URL.
+/// * `get_simhash_matches`: Gets the simhashes sharing a band with a simhash, along with the URL of their page.
+///
+/// # Notes
+///
+/// * Pages excluded from search results are left out of everything searched, but not of `get_pages_by_urls`.
+#[async_trait]
+pub trait Store: Debug + Send + Sync {
+    async fn save_pages(
+        &self,
+        pages: Vec<CrawledPage>,
+        history_length: i64,
+    ) -> Result<usize, Error>;
+    async fn get_pages_with_keywords(&self, words: &[String]) -> Result<Vec<CompletePage>, Error>;
+    async fn get_pages_by_urls(&self, urls: &[Url]) -> Result<Vec<Page>, Error>;
+    async fn get_keywords(&self, page: &Page) -> Result<Option<Vec<Keyword>>, Error>;
+    async fn get_forward_links(&self, page: &Page) -> Result<Vec<ForwardLink>, Error>;
+    async fn touch_page(&self, page: &Page) -> Result<(), Error>;
+    async fn delete_page(&self, page: &Page) -> Result<(), Error>;
+    async fn get_word_matches(&self, words: &[String]) -> Result<Vec<WordMatch>, Error>;
+    async fn get_backlinks(
+        &self,
+        pages: &[CompletePage],
+    ) -> Result<HashMap<CompletePage, u32>, Error>;
+    async fn get_word_counts(&self, limit: i64) -> Result<Vec<(String, i64)>, Error>;
+    async fn get_domain_links(&self) -> Result<HashSet<(String, String)>, Error>;
+    async fn count_rows(&self) -> Result<RowCounts, Error>;
+    async fn get_term_stats(&self) -> Result<Vec<(String, i64, i64)>, Error>;
+    async fn get_images(&self, urls: &[String]) -> Result<Vec<(String, Image)>, Error>;
+    async fn get_content_hashes(&self, urls: &[String]) -> Result<Vec<(String, String)>, Error>;
+    async fn get_simhash_matches(&self, simhash: u64) -> Result<Vec<(String, u64)>, Error>;
+}
+
+/// The default store, a Postgres database.
+///
+/// # Fields
+///
+/// * `url`: The URL of the database.
+#[derive(Debug, Clone)]
+pub struct Postgres {
+    url: String,
+}
+
+impl Postgres {
+    /// Creates a store of a Postgres database.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the database.
+    ///
+    /// # Returns
+    ///
+    /// * `Postgres` - The store.
+    #[must_use]
+    pub const fn new(url: String) -> Self {
+        Self { url }
+    }
+
+    /// Creates a store of the Postgres database in `DATABASE_URL`.
+    ///
+    /// # Returns
+    ///
+    /// * `Postgres` - The store.
+    ///
+    /// # Panics
+    ///
+    /// * If the `DATABASE_URL` environment variable is not set.
+    /// * If the `DATABASE_URL` environment variable is not valid UTF-8.
+    #[must_use]
+    #[allow(clippy::expect_used)]
+    pub fn load() -> Self {
+        let url = std::env::var_os("DATABASE_URL")
+            .expect("DATABASE_URL must be set!")
+            .to_str()
+            .expect("DATABASE_URL must be valid UTF-8!")
+            .to_string();
+
+        Self::new(url)
+    }
+}
+
+#[async_trait]
+impl Store for Postgres {
+    /// Saves crawled pages with one query per table.
+    ///
+    /// # Arguments
+    ///
+    /// * `pages`: The pages to save, each only once.
+    /// * `history_length`: The number of crawls kept in the history of each page.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(usize)` - The number of pages saved.
+    /// * `Err(Error)` - If the pages could not be saved.
+    ///
+    /// # Errors
+    ///
+    /// * If the database connection could not be established.
+    /// * If the pages, their history or their index could not be written.
+    async fn save_pages(
+        &self,
+        pages: Vec<CrawledPage>,
+        history_length: i64,
+    ) -> Result<usize, Error> {
+        if pages.is_empty() {
+            return Ok(0);
+        }
+
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        let new_pages = pages
+            .iter()
+            .map(|page| page.page.clone())
+            .collect::<Vec<_>>();
+        let page_ids = database::create_pages(&mut conn, &new_pages)
+            .await?
+            .into_iter()
+            .map(|page| (page.url, page.id))
+            .collect::<HashMap<_, _>>();
+
+        let mut new_entries = Vec::with_capacity(pages.len());
+        let mut new_forward_links = Vec::new();
+        let mut new_keywords = Vec::new();
+        let mut new_images = Vec::new();
+        let mut new_link_anchors = Vec::new();
+        let mut new_structured_data = Vec::new();
+        let mut new_simhashes = Vec::new();
+        let mut succeeded_ids = Vec::new();
+        for page in pages {
+            let Some(&page_id) = page_ids.get(&page.page.url) else {
+                return Err(Error::Database(format!(
+                    "Failed to find page with URL: {}!",
+                    page.page.url
+                )));
+            };
+
+            if (200..300).contains(&page.status) {
+                succeeded_ids.push(page_id);
+            }
+
+            new_entries.push(NewPageHistory {
+                page_id,
+
+                content_hash: page.content_hash,
+                status: page.status,
+                size: page.size,
+            });
+            new_forward_links.extend(page.forward_links.into_iter().map(|(url, frequency)| {
+                NewForwardLink {
+                    from_page_id: page_id,
+
+                    to_page_url: url.to_string(),
+                    frequency,
+                }
+            }));
+            new_keywords.extend(page.keywords.into_iter().map(
+                |(field, word, frequency, positions)| NewKeyword {
+                    page_id,
+
+                    word,
+                    frequency,
+                    positions,
+                    field: field.as_str().into(),
+                },
+            ));
+            new_images.extend(page.images.into_iter().enumerate().map(
+                |(position, (url, alt, caption))| NewImage {
+                    page_id,
+
+                    url: url.to_string(),
+                    alt,
+                    caption,
+                    position: i32::try_from(position).unwrap_or(i32::MAX),
+                },
+            ));
+            new_link_anchors.extend(page.anchors.into_iter().map(|(url, text)| NewLinkAnchor {
+                from_page_id: page_id,
+                to_page_url: url.to_string(),
+
+                text,
+            }));
+            new_structured_data.extend(page.structured_data.into_iter().enumerate().map(
+                |(position, (kind, data))| NewStructuredData {
+                    page_id,
+
+                    kind: kind.as_str().into(),
+                    data,
+                    position: i32::try_from(position).unwrap_or(i32::MAX),
+                },
+            ));
+            if let Some(simhash) = page.simhash {
+                let [band_0, band_1, band_2, band_3] = simhash::get_bands(simhash);
+                new_simhashes.push(NewSimhash {
+                    page_id,
+
+                    simhash: i64::from_be_bytes(simhash.to_be_bytes()),
+                    band_0,
+                    band_1,
+                    band_2,
+                    band_3,
+                });
+            }
+        }
+
+        database::create_page_histories(&mut conn, &new_entries, history_length).await?;
+
+        // Only pages that responded with a 2xx status keep from going stale.
+        database::mark_pages_succeeded(&mut conn, &succeeded_ids).await?;
+
+        // Remove what was indexed the last time the pages were crawled, if any.
+        let page_ids = page_ids.into_values().collect::<Vec<_>>();
+        database::delete_page_indexes(&mut conn, &page_ids).await?;
+
+        database::insert_forward_links(&mut conn, &new_forward_links).await?;
+        for batch in new_keywords.chunks(KEYWORD_BATCH_SIZE) {
+            database::create_keywords(&mut conn, batch).await?;
+        }
+        database::create_images(&mut conn, &new_images).await?;
+        database::create_link_anchors(&mut conn, &new_link_anchors).await?;
+        database::create_structured_data(&mut conn, &new_structured_data).await?;
+        database::create_simhashes(&mut conn, &new_simhashes).await?;
+
+        Ok(page_ids.len())
+    }
+
+    async fn get_pages_with_keywords(&self, words: &[String]) -> Result<Vec<CompletePage>, Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        // Get pages like the query, if any.
+        let Some(pages) = database::get_pages_with_words(
+            &mut conn,
+            words.to_vec(),
+            utils::env::search::get_maximum_candidates(),
+        )
+        .await?
+        else {
+            return Ok(Vec::new());
+        };
+
+        // Map the pages to their keywords.
+        let mut unordered_pages = Vec::new();
+        for page in pages {
+            let page_id = page.id;
+            let page = CompletePage {
+                page,
+                keywords: database::get_keywords_by_page_id(&mut conn, page_id).await?,
+            };
+
+            unordered_pages.push(page);
+        }
+
+        Ok(unordered_pages)
+    }
+
+    async fn get_pages_by_urls(&self, urls: &[Url]) -> Result<Vec<Page>, Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        let mut pages = Vec::new();
+        for url in urls {
+            if let Some(page) = database::get_page_by_url(&mut conn, url).await? {
+                pages.push(page);
+            }
+        }
+
+        Ok(pages)
+    }
+
+    async fn get_keywords(&self, page: &Page) -> Result<Option<Vec<Keyword>>, Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        Ok(database::get_keywords_by_page_id(&mut conn, page.id).await?)
+    }
+
+    async fn get_forward_links(&self, page: &Page) -> Result<Vec<ForwardLink>, Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        Ok(database::get_forward_links_by_page_id(&mut conn, page.id).await?)
+    }
+
+    async fn touch_page(&self, page: &Page) -> Result<(), Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        Ok(database::touch_page(&mut conn, page.id).await?)
+    }
+
+    async fn delete_page(&self, page: &Page) -> Result<(), Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        database::delete_pages(&mut conn, &[page.id]).await?;
+
+        Ok(())
+    }
+
+    async fn get_word_matches(&self, words: &[String]) -> Result<Vec<WordMatch>, Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        database::get_word_matches(
+            &mut conn,
+            words,
+            utils::env::search::get_maximum_candidates(),
+        )
+        .await
+    }
+
+    async fn get_backlinks(
+        &self,
+        pages: &[CompletePage],
+    ) -> Result<HashMap<CompletePage, u32>, Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        // Find the backlinks for each page.
+        let mut backlinks = HashMap::new();
+        for page in pages {
+            let page_backlinks = database::get_backlinks(&mut conn, page).await?;
+
+            for backlink in page_backlinks {
+                let count = backlinks.entry(backlink).or_insert(0);
+                *count += 1;
+            }
+        }
+
+        Ok(backlinks)
+    }
+
+    async fn get_word_counts(&self, limit: i64) -> Result<Vec<(String, i64)>, Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        database::get_word_counts(&mut conn, limit).await
+    }
+
+    async fn get_domain_links(&self) -> Result<HashSet<(String, String)>, Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        // Read the links in batches, so the whole link graph is never loaded at once.
+        let mut domain_links = HashSet::new();
+        let mut after: Option<(i32, String)> = None;
+        loop {
+            let links = database::get_links(
+                &mut conn,
+                after
+                    .as_ref()
+                    .map(|(page_id, url)| (*page_id, url.as_str())),
+                LINK_BATCH_SIZE,
+            )
+            .await?;
+            let Some((page_id, _, url)) = links.last() else {
+                break;
+            };
+            after = Some((*page_id, url.clone()));
+
+            for (_, from_url, to_url) in &links {
+                let (Some(from), Some(to)) = (
+                    utils::urls::get_domain(from_url),
+                    utils::urls::get_domain(to_url),
+                ) else {
+                    continue;
+                };
+
+                if from != to {
+                    domain_links.insert((from, to));
+                }
+            }
+        }
+
+        Ok(domain_links)
+    }
+
+    async fn count_rows(&self) -> Result<RowCounts, Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        database::count_rows(&mut conn).await
+    }
+
+    async fn get_term_stats(&self) -> Result<Vec<(String, i64, i64)>, Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        database::get_term_stats(&mut conn).await
+    }
+
+    async fn get_images(&self, urls: &[String]) -> Result<Vec<(String, Image)>, Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        database::get_images_by_page_urls(&mut conn, urls).await
+    }
+
+    async fn get_content_hashes(&self, urls: &[String]) -> Result<Vec<(String, String)>, Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        database::get_content_hashes_by_page_urls(&mut conn, urls).await
+    }
+
+    async fn get_simhash_matches(&self, simhash: u64) -> Result<Vec<(String, u64)>, Error> {
+        let mut conn = database::get_connection_to(&self.url).await?;
+
+        Ok(database::get_simhash_matches(
+            &mut conn,
+            &simhash::get_bands(simhash),
+            SIMHASH_MATCH_LIMIT,
+        )
+        .await?
+        .into_iter()
+        .map(|(url, simhash)| (url, u64::from_be_bytes(simhash.to_be_bytes())))
+        .collect())
+    }
+}
+
+/// A store split into shards, each page stored on one of them by the hash of its URL.
+///
+/// # Fields
+///
+/// * `shards`: The shards, in the order they're listed in.
+///
+/// # Notes
+///
+/// * The links on a page are stored along with it, so backlinks are looked up on every shard.
+/// * Adding a shard moves most pages to another one, which `reshard` takes care of.
+#[derive(Debug)]
+pub struct Sharded {
+    shards: Vec<Box<dyn Store>>,
+}
+
+impl Sharded {
+    /// Creates a store split into shards.
+    ///
+    /// # Arguments
+    ///
+    /// * `shards`: The shards, in the order they're listed in.
+    ///
+    /// # Returns
+    ///
+    /// * `Sharded` - The store.
+    #[must_use]
+    pub fn new(shards: Vec<Box<dyn Store>>) -> Self {
+        Self { shards }
+    }
+
+    /// Gets the shard a page is stored on.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the page.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(&dyn Store)` - The shard.
+    /// * `Err(Error)` - If there are no shards.
+    ///
+    /// # Errors
+    ///
+    /// * If there are no shards.
+    fn get(&self, url: &str) -> Result<&dyn Store, Error> {
+        self.shards
+            .get(get_shard(url, self.shards.len()))
+            .map(AsRef::as_ref)
+            .ok_or_else(|| Error::Database("There are no shards!".into()))
+    }
+}
+
+#[async_trait]
+impl Store for Sharded {
+    async fn save_pages(
+        &self,
+        pages: Vec<CrawledPage>,
+        history_length: i64,
+    ) -> Result<usize, Error> {
+        let mut shard_pages = (0..self.shards.len())
+            .map(|_| Vec::new())
+            .collect::<Vec<_>>();
+        for page in pages {
+            let shard = get_shard(&page.page.url, self.shards.len());
+            if let Some(pages) = shard_pages.get_mut(shard) {
+                pages.push(page);
+            }
+        }
+
+        let results = join_all(
+            self.shards
+                .iter()
+                .zip(shard_pages)
+                .map(|(shard, pages)| shard.save_pages(pages, history_length)),
+        )
+        .await;
+
+        results.into_iter().sum()
+    }
+
+    async fn get_pages_with_keywords(&self, words: &[String]) -> Result<Vec<CompletePage>, Error> {
+        let results = join_all(
+            self.shards
+                .iter()
+                .map(|shard| shard.get_pages_with_keywords(words)),
+        )
+        .await;
+
+        let mut pages = Vec::new();
+        for result in results {
+            pages.extend(result?);
+        }
+
+        Ok(pages)
+    }
+
+    async fn get_pages_by_urls(&self, urls: &[Url]) -> Result<Vec<Page>, Error> {
+        let mut pages = Vec::new();
+        for url in urls {
+            pages.extend(
+                self.get(url.as_str())?
+                    .get_pages_by_urls(std::slice::from_ref(url))
+                    .await?,
+            );
+        }
+
+        Ok(pages)
+    }
+
+    async fn get_keywords(&self, page: &Page) -> Result<Option<Vec<Keyword>>, Error> {
+        self.get(&page.url)?.get_keywords(page).await
+    }
+
+    async fn get_forward_links(&self, page: &Page) -> Result<Vec<ForwardLink>, Error> {
+        self.get(&page.url)?.get_forward_links(page).await
+    }
+
+    async fn touch_page(&self, page: &Page) -> Result<(), Error> {
+        self.get(&page.url)?.touch_page(page).await
+    }
+
+    async fn delete_page(&self, page: &Page) -> Result<(), Error> {
+        self.get(&page.url)?.delete_page(page).await
+    }
+
+    async fn get_word_matches(&self, words: &[String]) -> Result<Vec<WordMatch>, Error> {
+        let results = join_all(
+            self.shards
+                .iter()
+                .map(|shard| shard.get_word_matches(words)),
+        )
+        .await;
+
+        let mut matches = Vec::new();
+        for result in results {
+            matches.extend(result?);
+        }
+
+        Ok(matches)
+    }
+
+    async fn get_backlinks(
+        &self,
+        pages: &[CompletePage],
+    ) -> Result<HashMap<CompletePage, u32>, Error> {
+        let results = join_all(self.shards.iter().map(|shard| shard.get_backlinks(pages))).await;
+
+        let mut backlinks = HashMap::new();
+        for result in results {
+            for (backlink, count) in result? {
+                *backlinks.entry(backlink).or_insert(0) += count;
+            }
+        }
+
+        Ok(backlinks)
+    }
+
+    async fn get_word_counts(&self, limit: i64) -> Result<Vec<(String, i64)>, Error> {
+        let results = join_all(self.shards.iter().map(|shard| shard.get_word_counts(limit))).await;
+
+        let mut counts = HashMap::new();
+        for result in results {
+            for (word, count) in result? {
+                *counts.entry(word).or_insert(0) += count;
+            }
+        }
+
+        // Each shard counts its own words, so the totals are ordered again before they're cut off.
+        let mut counts = counts.into_iter().collect::<Vec<_>>();
+        counts.sort_by(|(word_a, count_a), (word_b, count_b)| {
+            count_b.cmp(count_a).then_with(|| word_a.cmp(word_b))
+        });
+        counts.truncate(usize::try_from(limit).unwrap_or(usize::MAX));
+
+        Ok(counts)
+    }
+
+    async fn get_domain_links(&self) -> Result<HashSet<(String, String)>, Error> {
+        let results = join_all(self.shards.iter().map(|shard| shard.get_domain_links())).await;
+
+        let mut domain_links = HashSet::new();
+        for result in results {
+            domain_links.extend(result?);
+        }
+
+        Ok(domain_links)
+    }
+
+    async fn count_rows(&self) -> Result<RowCounts, Error> {
+        let results = join_all(self.shards.iter().map(|shard| shard.count_rows())).await;
+
+        let mut counts = RowCounts::default();
+        for result in results {
+            let shard_counts = result?;
+            counts.pages += shard_counts.pages;
+            counts.keywords += shard_counts.keywords;
+            counts.forward_links += shard_counts.forward_links;
+        }
+
+        Ok(counts)
+    }
+
+    async fn get_term_stats(&self) -> Result<Vec<(String, i64, i64)>, Error> {
+        let results = join_all(self.shards.iter().map(|shard| shard.get_term_stats())).await;
+
+        // Each page is on one shard only, so the pages and frequencies of the shards add up.
+        let mut stats = HashMap::<String, (i64, i64)>::new();
+        for result in results {
+            for (word, pages, frequency) in result? {
+                let total = stats.entry(word).or_default();
+                total.0 += pages;
+                total.1 += frequency;
+            }
+        }
+
+        Ok(stats
+            .into_iter()
+            .map(|(word, (pages, frequency))| (word, pages, frequency))
+            .collect())
+    }
+
+    async fn get_images(&self, urls: &[String]) -> Result<Vec<(String, Image)>, Error> {
+        let mut shard_urls = (0..self.shards.len())
+            .map(|_| Vec::new())
+            .collect::<Vec<_>>();
+        for url in urls {
+            if let Some(urls) = shard_urls.get_mut(get_shard(url, self.shards.len())) {
+                urls.push(url.clone());
+            }
+        }
+
+        let results = join_all(
+            self.shards
+                .iter()
+                .zip(shard_urls)
+                .filter(|(_, urls)| !urls.is_empty())
+                .map(|(shard, urls)| async move { shard.get_images(&urls).await }),
+        )
+        .await;
+
+        let mut images = Vec::new();
+        for result in results {
+            images.extend(result?);
+        }
+
+        Ok(images)
+    }
+
+    async fn get_content_hashes(&self, urls: &[String]) -> Result<Vec<(String, String)>, Error> {
+        let mut shard_urls = (0..self.shards.len())
+            .map(|_| Vec::new())
+            .collect::<Vec<_>>();
+        for url in urls {
+            if let Some(urls) = shard_urls.get_mut(get_shard(url, self.shards.len())) {
+                urls.push(url.clone());
+            }
+        }
+
+        let results = join_all(
+            self.shards
+                .iter()
+                .zip(shard_urls)
+                .filter(|(_, urls)| !urls.is_empty())
+                .map(|(shard, urls)| async move { shard.get_content_hashes(&urls).await }),
+        )
+        .await;
+
+        let mut hashes = Vec::new();
+        for result in results {
+            hashes.extend(result?);
+        }
+
+        Ok(hashes)
+    }
+
+    async fn get_simhash_matches(&self, simhash: u64) -> Result<Vec<(String, u64)>, Error> {
+        let results = join_all(
+            self.shards
+                .iter()
+                .map(|shard| shard.get_simhash_matches(simhash)),
+        )
+        .await;
+
+        let mut matches = Vec::new();
+        for result in results {
+            matches.extend(result?);
+        }
+
+        Ok(matches)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::Mutex;
+
+    /// A shard that only keeps the URLs of the pages saved to it, with fixed word counts.
+    #[derive(Debug, Default)]
+    struct Memory {
+        urls: Arc<Mutex<Vec<String>>>,
+        words: Vec<(String, i64)>,
+    }
+
+    #[async_trait]
+    impl Store for Memory {
+        async fn save_pages(
+            &self,
+            pages: Vec<CrawledPage>,
+            _history_length: i64,
+        ) -> Result<usize, Error> {
+            let saved = pages.len();
+            self.urls
+                .lock()?
+                .extend(pages.into_iter().map(|page| page.page.url));
+
+            Ok(saved)
+        }
+
+        async fn get_pages_with_keywords(
+            &self,
+            _words: &[String],
+        ) -> Result<Vec<CompletePage>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn get_pages_by_urls(&self, _urls: &[Url]) -> Result<Vec<Page>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn get_keywords(&self, _page: &Page) -> Result<Option<Vec<Keyword>>, Error> {
+            Ok(None)
+        }
+
+        async fn get_forward_links(&self, _page: &Page) -> Result<Vec<ForwardLink>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn touch_page(&self, _page: &Page) -> Result<(), Error> {
+            Ok(())
+        }
+
+        async fn delete_page(&self, _page: &Page) -> Result<(), Error> {
+            Ok(())
+        }
+
+        async fn get_word_matches(&self, _words: &[String]) -> Result<Vec<WordMatch>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn get_backlinks(
+            &self,
+            _pages: &[CompletePage],
+        ) -> Result<HashMap<CompletePage, u32>, Error> {
+            Ok(HashMap::new())
+        }
+
+        async fn get_word_counts(&self, limit: i64) -> Result<Vec<(String, i64)>, Error> {
+            Ok(self
+                .words
+                .iter()
+                .take(usize::try_from(limit).unwrap_or(usize::MAX))
+                .cloned()
+                .collect())
+        }
+
+        async fn get_domain_links(&self) -> Result<HashSet<(String, String)>, Error> {
+            Ok(HashSet::new())
+        }
+
+        async fn count_rows(&self) -> Result<RowCounts, Error> {
+            Ok(RowCounts {
+                pages: i64::try_from(self.urls.lock()?.len()).unwrap_or(i64::MAX),
+                ..RowCounts::default()
+            })
+        }
+
+        async fn get_term_stats(&self) -> Result<Vec<(String, i64, i64)>, Error> {
+            Ok(self
+                .words
+                .iter()
+                .map(|(word, count)| (word.clone(), *count, *count))
+                .collect())
+        }
+
+        async fn get_images(&self, _urls: &[String]) -> Result<Vec<(String, Image)>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn get_content_hashes(
+            &self,
+            _urls: &[String],
+        ) -> Result<Vec<(String, String)>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn get_simhash_matches(&self, _simhash: u64) -> Result<Vec<(String, u64)>, Error> {
+            Ok(Vec::new())
+        }
+    }
+
+    fn crawled_page(url: &str) -> CrawledPage {
+        CrawledPage {
+            page: NewPage {
+                url: url.into(),
+
+                title: None,
+                description: None,
+                encoding: None,
+                index_fingerprint: None,
+                language: None,
+                published_at: None,
+                content_modified_at: None,
+                content: None,
+                authenticated: false,
+                excluded: false,
+                personalized: false,
+                unstable: false,
+                noarchive: false,
+                etag: None,
+                last_modified: None,
+            },
+            content_hash: String::new(),
+            status: 200,
+            size: 0,
+            forward_links: HashMap::new(),
+            keywords: Vec::new(),
+            images: Vec::new(),
+            anchors: HashMap::new(),
+            structured_data: Vec::new(),
+            simhash: None,
+        }
+    }
+
+    #[test]
+    fn test_get_shard() {
+        // The shards must never change, or the pages couldn't be found where they were stored.
+        assert_eq!(get_shard("https://example.com/", 2), 1);
+        assert_eq!(get_shard("https://example.com/about", 2), 0);
+        assert_eq!(get_shard("https://www.rust-lang.org/", 3), 1);
+        assert_eq!(get_shard("https://docs.rs/", 4), 1);
+
+        assert_eq!(get_shard("https://example.com/", 1), 0);
+        assert_eq!(get_shard("https://example.com/", 0), 0);
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_sharded() {
+        let saved_urls = [Arc::default(), Arc::default()];
+        let sharded = Sharded::new(vec![
+            Box::new(Memory {
+                urls: Arc::clone(&saved_urls[0]),
+                words: vec![("rust".into(), 5), ("web".into(), 4), ("page".into(), 1)],
+            }),
+            Box::new(Memory {
+                urls: Arc::clone(&saved_urls[1]),
+                words: vec![("page".into(), 6), ("rust".into(), 2)],
+            }),
+        ]);
+
+        let urls = [
+            "https://example.com/",
+            "https://example.com/about",
+            "https://www.rust-lang.org/",
+            "https://docs.rs/",
+        ];
+        let saved = futures::executor::block_on(
+            sharded.save_pages(urls.iter().map(|url| crawled_page(url)).collect(), 1),
+        )
+        .expect("Failed to save pages!");
+        assert_eq!(saved, urls.len());
+
+        // Every page is saved to the shard it's routed to, and only there.
+        for url in urls {
+            for (shard, shard_urls) in saved_urls.iter().enumerate() {
+                let shard_urls = shard_urls.lock().expect("Failed to lock URLs!");
+                assert_eq!(
+                    shard_urls.iter().any(|saved_url| saved_url == url),
+                    shard == get_shard(url, 2)
+                );
+            }
+        }
+
+        assert_eq!(
+            futures::executor::block_on(sharded.get_word_counts(2))
+                .expect("Failed to count words!"),
+            vec![("rust".into(), 7), ("page".into(), 6)]
+        );
+
+        // The rows of every shard are counted.
+        assert_eq!(
+            futures::executor::block_on(sharded.count_rows())
+                .expect("Failed to count rows!")
+                .pages,
+            4
+        );
+
+        // A word's pages on every shard add up, since each page is on one shard only.
+        let term_stats = futures::executor::block_on(sharded.get_term_stats())
+            .expect("Failed to get term statistics!");
+        assert_eq!(term_stats.len(), 3);
+        assert!(term_stats.contains(&("rust".into(), 7, 7)));
+        assert!(term_stats.contains(&("web".into(), 4, 4)));
+    }
+}
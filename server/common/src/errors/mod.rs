@@ -4,6 +4,14 @@ use std::io;
 use std::num::TryFromIntError;
 use thiserror::Error;
 
+/// Parts of the messages of database errors caused by the database shutting down or starting up.
+const TRANSIENT_ERROR_MESSAGES: [&str; 4] = [
+    "terminating connection",
+    "the database system is starting up",
+    "the database system is shutting down",
+    "server closed the connection",
+];
+
 /// An errors.
 ///
 /// # Variants
@@ -14,9 +22,24 @@ use thiserror::Error;
 /// * `InvalidUrl`: An invalid URL.
 /// * `InvalidBoundaries`: Invalid boundaries.
 /// * `Database`: A database error.
+/// * `Unavailable`: The database is unavailable, but may recover.
 /// * `NumberParseError`: A number parse error.
 /// * `Query`: A query error.
 /// * `Queue`: A queue error.
+/// * `Selector`: An invalid CSS selector.
+/// * `ReadWrite`: A poisoned lock.
+/// * `RobotsDisallowed`: The `robots.txt` file of the host disallows crawling the URL.
+/// * `Timeout`: A request timed out.
+/// * `Dns`: The host of a URL could not be resolved.
+/// * `Blocked`: The URL points somewhere that must not be fetched, like a private address.
+/// * `Compression`: Content could not be compressed or decompressed.
+/// * `Credentials`: The credentials of a host could not be encrypted or decrypted.
+/// * `Extraction`: A document is outside the limits of what's extracted, like one nested too deeply.
+/// * `Redirect`: A URL redirects too many times, or somewhere that isn't followed.
+///
+/// # Notes
+///
+/// * Each variant has a stable code, see `Error::code`, to log, persist and label metrics with.
 #[derive(Error, Serialize, Debug, Clone)]
 pub enum Error {
     #[error("Internal")]
@@ -31,6 +54,8 @@ pub enum Error {
     InvalidBoundaries(String),
     #[error("Database: {0}")]
     Database(String),
+    #[error("Unavailable: {0}")]
+    Unavailable(String),
     #[error("Parse Error: {0}")]
     NumberParseError(String),
     #[error("Query Error: {0}")]
@@ -41,6 +66,22 @@ pub enum Error {
     Selector(String),
     #[error("Read/Write Error: {0}")]
     ReadWrite(String),
+    #[error("Robots Disallowed: {0}")]
+    RobotsDisallowed(String),
+    #[error("Timeout: {0}")]
+    Timeout(String),
+    #[error("DNS: {0}")]
+    Dns(String),
+    #[error("Blocked: {0}")]
+    Blocked(String),
+    #[error("Compression: {0}")]
+    Compression(String),
+    #[error("Credentials: {0}")]
+    Credentials(String),
+    #[error("Extraction: {0}")]
+    Extraction(String),
+    #[error("Redirect: {0}")]
+    Redirect(String),
 }
 
 impl From<io::Error> for Error {
@@ -51,6 +92,15 @@ impl From<io::Error> for Error {
 
 impl From<reqwest::Error> for Error {
     fn from(err: reqwest::Error) -> Self {
+        if err.is_timeout() {
+            return Self::Timeout(err.to_string());
+        }
+
+        // reqwest doesn't say why a connection failed, but the resolver error is somewhere in its sources.
+        if err.is_connect() && has_source_containing(&err, "dns error") {
+            return Self::Dns(err.to_string());
+        }
+
         Self::Reqwest(err.to_string())
     }
 }
@@ -61,15 +111,135 @@ impl From<url::ParseError> for Error {
     }
 }
 
+impl Error {
+    /// Checks if the error is transient, and the operation that caused it is worth retrying.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the error is transient.
+    #[must_use]
+    pub const fn is_transient(&self) -> bool {
+        matches!(self, Self::Unavailable(_))
+    }
+
+    /// Checks if a fetch that failed with the error may succeed later, like once an outage is over.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the fetch is worth retrying later.
+    ///
+    /// # Notes
+    ///
+    /// * Errors caused by the URL or its content, like disallowed or blocked URLs, fail the same way every time.
+    #[must_use]
+    pub const fn is_retryable(&self) -> bool {
+        matches!(
+            self,
+            Self::Reqwest(_) | Self::Timeout(_) | Self::Dns(_) | Self::Unavailable(_)
+        )
+    }
+
+    /// Gets the stable code of the error.
+    ///
+    /// # Returns
+    ///
+    /// * `&'static str` - The code, like `robots_disallowed`, which never changes once added.
+    #[must_use]
+    pub const fn code(&self) -> &'static str {
+        match self {
+            Self::Internal(_) => "internal",
+            Self::IO(_) => "io",
+            Self::Reqwest(_) => "fetch",
+            Self::InvalidUrl(_) => "invalid_url",
+            Self::InvalidBoundaries(_) => "invalid_boundaries",
+            Self::Database(_) => "database",
+            Self::Unavailable(_) => "database_unavailable",
+            Self::NumberParseError(_) => "number_parse",
+            Self::Query(_) => "query",
+            Self::Queue(_) => "queue",
+            Self::Selector(_) => "selector",
+            Self::ReadWrite(_) => "read_write",
+            Self::RobotsDisallowed(_) => "robots_disallowed",
+            Self::Timeout(_) => "timeout",
+            Self::Dns(_) => "dns",
+            Self::Blocked(_) => "blocked",
+            Self::Compression(_) => "compression",
+            Self::Credentials(_) => "credentials",
+            Self::Extraction(_) => "extraction",
+            Self::Redirect(_) => "redirect",
+        }
+    }
+
+    /// Gets the HTTP status code to respond with for the error.
+    ///
+    /// # Returns
+    ///
+    /// * `u16` - `400` for bad input, `502` or `504` for failed fetches, `503` if the database is unavailable, and `500` otherwise.
+    #[must_use]
+    pub const fn status(&self) -> u16 {
+        match self {
+            Self::InvalidUrl(_) | Self::Query(_) | Self::Blocked(_) => 400,
+            Self::Reqwest(_) | Self::Dns(_) | Self::RobotsDisallowed(_) | Self::Redirect(_) => 502,
+            Self::Unavailable(_) => 503,
+            Self::Timeout(_) => 504,
+            _ => 500,
+        }
+    }
+}
+
+/// Checks if an error, or any of the errors that caused it, contains a message.
+///
+/// # Arguments
+///
+/// * `err`: The error.
+/// * `message`: The message to look for.
+///
+/// # Returns
+///
+/// * `bool` - Whether the message was found.
+fn has_source_containing(err: &(dyn std::error::Error + 'static), message: &str) -> bool {
+    let mut source = Some(err);
+    while let Some(err) = source {
+        if err.to_string().contains(message) {
+            return true;
+        }
+
+        source = err.source();
+    }
+
+    false
+}
+
 impl From<diesel::result::Error> for Error {
     fn from(err: diesel::result::Error) -> Self {
-        Self::Database(err.to_string())
+        use diesel::result::DatabaseErrorKind;
+
+        match &err {
+            diesel::result::Error::DatabaseError(
+                DatabaseErrorKind::ClosedConnection
+                | DatabaseErrorKind::UnableToSendCommand
+                | DatabaseErrorKind::SerializationFailure,
+                _,
+            ) => Self::Unavailable(err.to_string()),
+            // Postgres reports restarts as errors with their own SQLSTATE, which diesel doesn't know about.
+            diesel::result::Error::DatabaseError(DatabaseErrorKind::Unknown, info)
+                if TRANSIENT_ERROR_MESSAGES
+                    .iter()
+                    .any(|message| info.message().contains(message)) =>
+            {
+                Self::Unavailable(err.to_string())
+            }
+            _ => Self::Database(err.to_string()),
+        }
     }
 }
 
 impl From<ConnectionError> for Error {
     fn from(err: ConnectionError) -> Self {
-        Self::Database(err.to_string())
+        match err {
+            ConnectionError::BadConnection(_) => Self::Unavailable(err.to_string()),
+            _ => Self::Database(err.to_string()),
+        }
     }
 }
 
@@ -96,3 +266,107 @@ impl<T> From<std::sync::PoisonError<T>> for Error {
         Self::ReadWrite(err.to_string())
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::collections::HashSet;
+
+    /// An error that's caused by another error, like the ones of reqwest.
+    #[derive(Debug)]
+    struct Wrapper(io::Error);
+
+    impl std::fmt::Display for Wrapper {
+        fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+            write!(f, "error sending request")
+        }
+    }
+
+    impl std::error::Error for Wrapper {
+        fn source(&self) -> Option<&(dyn std::error::Error + 'static)> {
+            Some(&self.0)
+        }
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_wrapping() {
+        let err = Error::from(url::Url::parse("not a url").expect_err("Parsed an invalid URL!"));
+        assert!(matches!(err, Error::InvalidUrl(_)));
+        assert!(!err.is_retryable());
+        assert_eq!((err.code(), err.status()), ("invalid_url", 400));
+
+        let err = Error::from(ConnectionError::BadConnection("connection refused".into()));
+        assert!(matches!(err, Error::Unavailable(_)));
+        assert!(err.is_transient());
+        assert!(err.is_retryable());
+        assert_eq!((err.code(), err.status()), ("database_unavailable", 503));
+
+        let err = Error::from(diesel::result::Error::NotFound);
+        assert!(matches!(err, Error::Database(_)));
+        assert!(!err.is_transient());
+        assert_eq!((err.code(), err.status()), ("database", 500));
+
+        let err = Error::from(io::Error::new(io::ErrorKind::Other, "disk full"));
+        assert!(matches!(err, Error::IO(_)));
+        assert_eq!((err.code(), err.status()), ("io", 500));
+
+        // The errors an error is caused by are searched too.
+        let err = Wrapper(io::Error::new(
+            io::ErrorKind::Other,
+            "dns error: no such host",
+        ));
+        assert!(has_source_containing(&err, "dns error"));
+        assert!(has_source_containing(&err, "error sending request"));
+        assert!(!has_source_containing(&err, "timed out"));
+    }
+
+    #[test]
+    fn test_codes() {
+        let errors = [
+            Error::Internal(String::new()),
+            Error::IO(String::new()),
+            Error::Reqwest(String::new()),
+            Error::InvalidUrl(String::new()),
+            Error::InvalidBoundaries(String::new()),
+            Error::Database(String::new()),
+            Error::Unavailable(String::new()),
+            Error::NumberParseError(String::new()),
+            Error::Query(String::new()),
+            Error::Queue(String::new()),
+            Error::Selector(String::new()),
+            Error::ReadWrite(String::new()),
+            Error::RobotsDisallowed(String::new()),
+            Error::Timeout(String::new()),
+            Error::Dns(String::new()),
+            Error::Blocked(String::new()),
+            Error::Compression(String::new()),
+            Error::Credentials(String::new()),
+            Error::Extraction(String::new()),
+            Error::Redirect(String::new()),
+        ];
+
+        // Every variant has its own code.
+        let codes = errors.iter().map(Error::code).collect::<HashSet<_>>();
+        assert_eq!(codes.len(), errors.len());
+
+        assert_eq!(
+            errors
+                .iter()
+                .map(|err| (err.code(), err.status()))
+                .filter(|(_, status)| *status != 500)
+                .collect::<Vec<_>>(),
+            vec![
+                ("fetch", 502),
+                ("invalid_url", 400),
+                ("database_unavailable", 503),
+                ("query", 400),
+                ("robots_disallowed", 502),
+                ("timeout", 504),
+                ("dns", 502),
+                ("blocked", 400),
+                ("redirect", 502),
+            ]
+        );
+    }
+}
@@ -0,0 +1,65 @@
+use crate::utils;
+use sha2::{Digest, Sha256};
+
+/// Checks if the `Authorization` header of a request carries the admin token.
+///
+/// # Arguments
+///
+/// * `authorization`: The value of the `Authorization` header, if any.
+///
+/// # Returns
+///
+/// * `bool` - Whether the header is the admin token as a bearer token.
+///
+/// # Notes
+///
+/// * If `ADMIN_TOKEN` isn't set, nothing is authorized.
+/// * The token is compared in constant time, so its characters can't be guessed one by one from the response times.
+#[must_use]
+pub fn is_authorized(authorization: Option<&str>) -> bool {
+    let Some(admin_token) = utils::env::web::get_admin_token() else {
+        return false;
+    };
+
+    authorization
+        .and_then(|authorization| authorization.strip_prefix("Bearer "))
+        .is_some_and(|token| is_equal(token, &admin_token))
+}
+
+/// Compares two tokens in constant time.
+///
+/// # Arguments
+///
+/// * `token`: The token to check.
+/// * `expected`: The expected token.
+///
+/// # Returns
+///
+/// * `bool` - Whether the tokens are equal.
+///
+/// # Notes
+///
+/// * The digests of the tokens are compared instead of the tokens, so the time doesn't depend on their lengths either.
+fn is_equal(token: &str, expected: &str) -> bool {
+    let token = Sha256::digest(token.as_bytes());
+    let expected = Sha256::digest(expected.as_bytes());
+
+    token
+        .iter()
+        .zip(expected.iter())
+        .fold(0, |difference, (a, b)| difference | (a ^ b))
+        == 0
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_is_equal() {
+        assert!(is_equal("secret", "secret"));
+        assert!(!is_equal("secre", "secret"));
+        assert!(!is_equal("secreT", "secret"));
+        assert!(!is_equal("", "secret"));
+    }
+}
@@ -0,0 +1,282 @@
+use crate::errors::Error;
+use crate::utils;
+use std::io::Read;
+
+/// The format byte of content compressed with zstd, without a dictionary.
+const ZSTD: u8 = 0x01;
+
+/// The format byte of content compressed with zstd, with the shared dictionary.
+const ZSTD_DICTIONARY: u8 = 0x02;
+
+/// The maximum size of a trained dictionary in bytes, the same as the default of zstd.
+pub const DICTIONARY_SIZE: usize = 112_640;
+
+/// How stored content is encoded, told by its first byte.
+///
+/// # Variants
+///
+/// * `Plain`: Plain UTF-8 text, like the rows written before compression or with it disabled.
+/// * `Zstd`: Compressed with zstd, without a dictionary.
+/// * `ZstdDictionary`: Compressed with zstd, with the shared dictionary.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Format {
+    Plain,
+    Zstd,
+    ZstdDictionary,
+}
+
+impl Format {
+    /// Tells how stored content is encoded.
+    ///
+    /// # Arguments
+    ///
+    /// * `content`: The stored content.
+    ///
+    /// # Returns
+    ///
+    /// * `Format` - The format of the content, `Plain` unless its first byte is a format byte.
+    #[must_use]
+    pub fn of(content: &[u8]) -> Self {
+        match content.first() {
+            Some(&ZSTD) => Self::Zstd,
+            Some(&ZSTD_DICTIONARY) => Self::ZstdDictionary,
+            _ => Self::Plain,
+        }
+    }
+}
+
+/// Compresses the content of pages before it's stored, and decompresses it after it's read.
+///
+/// # Fields
+///
+/// * `level`: The zstd level content is compressed with, if compression is enabled.
+/// * `dictionary`: The shared dictionary content is compressed with, if any.
+#[derive(Debug, Clone, Default)]
+pub struct Codec {
+    level: Option<i32>,
+    dictionary: Option<Vec<u8>>,
+}
+
+impl Codec {
+    /// Creates a new codec.
+    ///
+    /// # Arguments
+    ///
+    /// * `level`: The zstd level content is compressed with, if compression is enabled.
+    /// * `dictionary`: The shared dictionary content is compressed with, if any.
+    ///
+    /// # Returns
+    ///
+    /// * `Codec` - The new codec.
+    #[must_use]
+    pub const fn new(level: Option<i32>, dictionary: Option<Vec<u8>>) -> Self {
+        Self { level, dictionary }
+    }
+
+    /// Loads the codec from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Codec)` - The codec, with the dictionary at `CONTENT_DICTIONARY` if it's set.
+    /// * `Err(Error)` - If the dictionary could not be read.
+    ///
+    /// # Errors
+    ///
+    /// * If `CONTENT_DICTIONARY` is set, but the file could not be read.
+    pub fn load() -> Result<Self, Error> {
+        let dictionary = utils::env::database::get_content_dictionary()
+            .map(std::fs::read)
+            .transpose()?;
+
+        Ok(Self::new(
+            utils::env::database::get_content_compression_level(),
+            dictionary,
+        ))
+    }
+
+    /// Gets the format content is stored in.
+    ///
+    /// # Returns
+    ///
+    /// * `Format` - `Plain` if compression is disabled, and whether the dictionary is used otherwise.
+    #[must_use]
+    pub const fn format(&self) -> Format {
+        match (self.level, &self.dictionary) {
+            (None, _) => Format::Plain,
+            (Some(_), None) => Format::Zstd,
+            (Some(_), Some(_)) => Format::ZstdDictionary,
+        }
+    }
+
+    /// Encodes content to store it.
+    ///
+    /// # Arguments
+    ///
+    /// * `text`: The content.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Vec<u8>)` - The format byte followed by the compressed content, or the plain text if compression is disabled.
+    /// * `Err(Error)` - If the content could not be compressed.
+    ///
+    /// # Errors
+    ///
+    /// * If zstd failed to compress the content.
+    ///
+    /// # Notes
+    ///
+    /// * Text starting with a format byte is compressed even if compression is disabled, so it isn't misread.
+    pub fn compress(&self, text: &str) -> Result<Vec<u8>, Error> {
+        let level = self.level.unwrap_or(zstd::DEFAULT_COMPRESSION_LEVEL);
+
+        match (self.format(), Format::of(text.as_bytes())) {
+            (Format::Plain, Format::Plain) => Ok(text.as_bytes().to_vec()),
+            (Format::ZstdDictionary, _) => {
+                let dictionary = self.dictionary.as_deref().unwrap_or_default();
+                let compressed = zstd::bulk::Compressor::with_dictionary(level, dictionary)
+                    .and_then(|mut compressor| compressor.compress(text.as_bytes()))
+                    .map_err(|err| Error::Compression(err.to_string()))?;
+
+                let mut content = vec![ZSTD_DICTIONARY];
+                content.extend(compressed);
+
+                Ok(content)
+            }
+            _ => {
+                let compressed = zstd::bulk::compress(text.as_bytes(), level)
+                    .map_err(|err| Error::Compression(err.to_string()))?;
+
+                let mut content = vec![ZSTD];
+                content.extend(compressed);
+
+                Ok(content)
+            }
+        }
+    }
+
+    /// Decodes stored content, in any format.
+    ///
+    /// # Arguments
+    ///
+    /// * `content`: The stored content.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(String)` - The text.
+    /// * `Err(Error)` - If the content could not be decompressed.
+    ///
+    /// # Errors
+    ///
+    /// * If the content is corrupt, or was compressed with a dictionary other than the loaded one, or none is loaded.
+    pub fn decompress(&self, content: &[u8]) -> Result<String, Error> {
+        let mut text = Vec::new();
+        match Format::of(content) {
+            Format::Plain => return Ok(String::from_utf8_lossy(content).into_owned()),
+            Format::Zstd => zstd::stream::read::Decoder::new(&content[1..])
+                .and_then(|mut decoder| decoder.read_to_end(&mut text)),
+            Format::ZstdDictionary => {
+                let Some(dictionary) = &self.dictionary else {
+                    return Err(Error::Compression(
+                        "The content was compressed with a dictionary, but none is loaded".into(),
+                    ));
+                };
+
+                zstd::stream::read::Decoder::with_dictionary(&content[1..], dictionary)
+                    .and_then(|mut decoder| decoder.read_to_end(&mut text))
+            }
+        }
+        .map_err(|err| Error::Compression(err.to_string()))?;
+
+        Ok(String::from_utf8_lossy(&text).into_owned())
+    }
+}
+
+/// Trains a shared dictionary on a sample of the content of pages.
+///
+/// # Arguments
+///
+/// * `samples`: The text of the sampled pages.
+///
+/// # Returns
+///
+/// * `Ok(Vec<u8>)` - The dictionary, at most `DICTIONARY_SIZE` bytes.
+/// * `Err(Error)` - If the dictionary could not be trained.
+///
+/// # Errors
+///
+/// * If there are too few or too small samples to train a dictionary on.
+pub fn train(samples: &[String]) -> Result<Vec<u8>, Error> {
+    zstd::dict::from_samples(samples, DICTIONARY_SIZE)
+        .map_err(|err| Error::Compression(err.to_string()))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn get_samples() -> Vec<String> {
+        (0..500)
+            .map(|i| {
+                format!(
+                    "Article {i} of the example news site. Read the latest news about topic {} \
+                        and subscribe to our newsletter for updates. Copyright example.com, all rights reserved.",
+                    i % 17
+                )
+            })
+            .collect()
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_round_trip() {
+        let dictionary = train(&get_samples()).expect("Failed to train dictionary!");
+        let text = "Article 1000 of the example news site. Read the latest news about topic 3.";
+
+        for (codec, format) in [
+            (Codec::new(Some(3), None), Format::Zstd),
+            (
+                Codec::new(Some(3), Some(dictionary)),
+                Format::ZstdDictionary,
+            ),
+            (Codec::new(None, None), Format::Plain),
+        ] {
+            let content = codec.compress(text).expect("Failed to compress!");
+            assert_eq!(Format::of(&content), format);
+            assert_eq!(
+                codec.decompress(&content).expect("Failed to decompress!"),
+                text
+            );
+        }
+
+        // Text that looks like it's compressed is compressed anyway.
+        let codec = Codec::new(None, None);
+        let content = codec.compress("\u{1}text").expect("Failed to compress!");
+        assert_eq!(Format::of(&content), Format::Zstd);
+        assert_eq!(
+            codec.decompress(&content).expect("Failed to decompress!"),
+            "\u{1}text"
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_decompress_legacy() {
+        let codec = Codec::new(Some(3), None);
+
+        // Rows written before compression are plain text.
+        assert_eq!(
+            codec
+                .decompress("Plain text".as_bytes())
+                .expect("Failed to decompress!"),
+            "Plain text"
+        );
+        assert_eq!(codec.decompress(&[]).expect("Failed to decompress!"), "");
+
+        // Content compressed with a dictionary can't be read without it.
+        let dictionary = train(&get_samples()).expect("Failed to train dictionary!");
+        let content = Codec::new(Some(3), Some(dictionary))
+            .compress("Article 1000 of the example news site.")
+            .expect("Failed to compress!");
+        assert!(codec.decompress(&content).is_err());
+    }
+}
@@ -0,0 +1,348 @@
+use chrono::{DateTime, NaiveDate, NaiveDateTime, Utc};
+use regex::Regex;
+use serde_json::Value;
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+use url::Url;
+
+/// The earliest plausible date of a page, 1995-01-01, since there were hardly any pages before it.
+const EARLIEST_DATE: Duration = Duration::from_secs(788_918_400);
+
+/// How far into the future a date may be, to allow for clocks and time zones that are slightly off.
+const FUTURE_TOLERANCE: Duration = Duration::from_secs(24 * 60 * 60);
+
+/// The formats of dates with a time and an offset, besides RFC 3339 and RFC 2822.
+const OFFSET_FORMATS: [&str; 4] = [
+    "%Y-%m-%dT%H:%M:%S%.f%z",
+    "%Y-%m-%dT%H:%M%z",
+    "%Y-%m-%d %H:%M:%S%.f%z",
+    "%Y-%m-%d %H:%M:%S %z",
+];
+
+/// The formats of dates with a time but without an offset, which are taken to be in UTC.
+const NAIVE_FORMATS: [&str; 3] = [
+    "%Y-%m-%dT%H:%M:%S%.f",
+    "%Y-%m-%dT%H:%M",
+    "%Y-%m-%d %H:%M:%S%.f",
+];
+
+/// The formats of dates without a time, which are taken to be midnight UTC.
+const DATE_FORMATS: [&str; 7] = [
+    "%Y-%m-%d",
+    "%Y/%m/%d",
+    "%Y%m%d",
+    "%B %d, %Y",
+    "%b %d, %Y",
+    "%d %B %Y",
+    "%d %b %Y",
+];
+
+/// When the content of a page was published and last modified.
+///
+/// # Fields
+///
+/// * `published_at`: When the content was published, if known.
+/// * `modified_at`: When the content was last modified, if known.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub struct Dates {
+    pub published_at: Option<SystemTime>,
+    pub modified_at: Option<SystemTime>,
+}
+
+impl Dates {
+    /// Fills in the dates that are missing from another, less trusted source.
+    ///
+    /// # Arguments
+    ///
+    /// * `other`: The dates of the other source.
+    ///
+    /// # Returns
+    ///
+    /// * `Dates` - These dates, with the missing ones taken from `other`.
+    #[must_use]
+    pub fn or(self, other: Self) -> Self {
+        Self {
+            published_at: self.published_at.or(other.published_at),
+            modified_at: self.modified_at.or(other.modified_at),
+        }
+    }
+}
+
+/// Parses a date in any of the common formats of dates on the web.
+///
+/// # Arguments
+///
+/// * `value`: The date, like `2024-05-12T08:30:00+02:00`, `Sun, 12 May 2024 06:30:00 GMT` or `May 12, 2024`.
+///
+/// # Returns
+///
+/// * `Some(SystemTime)` - The date.
+/// * `None` - If the date is in an unknown format.
+///
+/// # Notes
+///
+/// * Dates without an offset are taken to be in UTC.
+#[must_use]
+pub fn parse(value: &str) -> Option<SystemTime> {
+    let value = value.trim();
+
+    let date = DateTime::parse_from_rfc3339(value)
+        .or_else(|_| DateTime::parse_from_rfc2822(value))
+        .ok()
+        .or_else(|| {
+            OFFSET_FORMATS
+                .iter()
+                .find_map(|format| DateTime::parse_from_str(value, format).ok())
+        })
+        .map(|date| date.with_timezone(&Utc))
+        .or_else(|| {
+            NAIVE_FORMATS
+                .iter()
+                .find_map(|format| NaiveDateTime::parse_from_str(value, format).ok())
+                .or_else(|| {
+                    DATE_FORMATS
+                        .iter()
+                        .find_map(|format| NaiveDate::parse_from_str(value, format).ok())
+                        .and_then(|date| date.and_hms_opt(0, 0, 0))
+                })
+                .map(|date| date.and_utc())
+        })?;
+
+    Some(SystemTime::from(date))
+}
+
+/// Formats a date to show it, like `2024-05-12 14:30 UTC`.
+///
+/// # Arguments
+///
+/// * `date`: The date.
+///
+/// # Returns
+///
+/// * `String` - The date in UTC, to the minute.
+#[must_use]
+pub fn format(date: SystemTime) -> String {
+    DateTime::<Utc>::from(date)
+        .format("%Y-%m-%d %H:%M UTC")
+        .to_string()
+}
+
+/// Checks if a date is plausible for the content of a page.
+///
+/// # Arguments
+///
+/// * `date`: The date.
+/// * `now`: The current time.
+///
+/// # Returns
+///
+/// * `bool` - Whether the date is from 1995 or later, and isn't in the future.
+#[must_use]
+pub fn is_plausible(date: SystemTime, now: SystemTime) -> bool {
+    date >= UNIX_EPOCH + EARLIEST_DATE && date <= now + FUTURE_TOLERANCE
+}
+
+/// Parses a date, if it's plausible for the content of a page.
+///
+/// # Arguments
+///
+/// * `value`: The date.
+/// * `now`: The current time.
+///
+/// # Returns
+///
+/// * `Some(SystemTime)` - The date.
+/// * `None` - If the date is in an unknown format, or isn't plausible.
+#[must_use]
+pub fn parse_plausible(value: &str, now: SystemTime) -> Option<SystemTime> {
+    parse(value).filter(|&date| is_plausible(date, now))
+}
+
+/// Gets the date in the path of a URL, like `/2024/05/12/` or `/2024-05-12-`.
+///
+/// # Arguments
+///
+/// * `url`: The URL.
+/// * `now`: The current time.
+///
+/// # Returns
+///
+/// * `Some(SystemTime)` - Midnight UTC of the date.
+/// * `None` - If the path has no plausible date.
+///
+/// # Panics
+///
+/// * If the date pattern fails to compile.
+#[must_use]
+#[allow(clippy::expect_used)]
+pub fn from_url(url: &Url, now: SystemTime) -> Option<SystemTime> {
+    let pattern = Regex::new(r"/((?:19|20)\d{2})[/-](\d{1,2})[/-](\d{1,2})(?:[/\-_.]|$)")
+        .expect("Failed to compile URL date pattern!");
+
+    let date = pattern.captures_iter(url.path()).find_map(|captures| {
+        let date = NaiveDate::from_ymd_opt(
+            captures[1].parse().ok()?,
+            captures[2].parse().ok()?,
+            captures[3].parse().ok()?,
+        )?;
+
+        Some(SystemTime::from(date.and_hms_opt(0, 0, 0)?.and_utc()))
+            .filter(|&date| is_plausible(date, now))
+    });
+
+    date
+}
+
+/// Gets the dates of JSON-LD structured data, like an `Article` with `datePublished` and `dateModified`.
+///
+/// # Arguments
+///
+/// * `value`: The structured data.
+/// * `now`: The current time.
+///
+/// # Returns
+///
+/// * `Dates` - The first plausible dates found, searching objects, arrays and `@graph` depth first.
+#[must_use]
+pub fn from_json_ld(value: &Value, now: SystemTime) -> Dates {
+    match value {
+        Value::Object(object) => {
+            let get = |key| {
+                object
+                    .get(key)
+                    .and_then(Value::as_str)
+                    .and_then(|date| parse_plausible(date, now))
+            };
+            let dates = Dates {
+                published_at: get("datePublished"),
+                modified_at: get("dateModified"),
+            };
+
+            object
+                .values()
+                .fold(dates, |dates, value| dates.or(from_json_ld(value, now)))
+        }
+        Value::Array(values) => values.iter().fold(Dates::default(), |dates, value| {
+            dates.or(from_json_ld(value, now))
+        }),
+        _ => Dates::default(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse() {
+        let at = |secs| Some(UNIX_EPOCH + Duration::from_secs(secs));
+
+        // 2024-05-12T06:30:00Z, written in every format.
+        for value in [
+            "2024-05-12T06:30:00Z",
+            "2024-05-12T08:30:00+02:00",
+            "2024-05-12T06:30:00.000Z",
+            "2024-05-12T08:30:00+0200",
+            "2024-05-12T08:30+02:00",
+            "2024-05-12 08:30:00 +0200",
+            "Sun, 12 May 2024 06:30:00 GMT",
+            "Sun, 12 May 2024 08:30:00 +0200",
+            "2024-05-12T06:30:00",
+            "2024-05-12 06:30:00",
+            " 2024-05-12T06:30 ",
+        ] {
+            assert_eq!(parse(value), at(1_715_495_400), "{value}");
+        }
+
+        // 2024-05-12, at midnight UTC.
+        for value in [
+            "2024-05-12",
+            "2024/05/12",
+            "20240512",
+            "May 12, 2024",
+            "12 May 2024",
+        ] {
+            assert_eq!(parse(value), at(1_715_472_000), "{value}");
+        }
+
+        for value in ["", "yesterday", "2024-13-01", "12/05/2024"] {
+            assert_eq!(parse(value), None, "{value}");
+        }
+    }
+
+    #[test]
+    fn test_is_plausible() {
+        let now = UNIX_EPOCH + Duration::from_secs(1_715_495_400);
+
+        assert!(is_plausible(now, now));
+        assert!(is_plausible(UNIX_EPOCH + EARLIEST_DATE, now));
+        assert!(is_plausible(now + Duration::from_secs(60 * 60), now));
+        assert!(!is_plausible(
+            now + Duration::from_secs(2 * 24 * 60 * 60),
+            now
+        ));
+        assert!(!is_plausible(UNIX_EPOCH, now));
+        assert_eq!(parse_plausible("1970-01-01", now), None);
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_from_url() {
+        let now = UNIX_EPOCH + Duration::from_secs(1_715_495_400);
+        let date = |url: &str| from_url(&Url::parse(url).expect("Failed to parse URL!"), now);
+        let may_12 = Some(UNIX_EPOCH + Duration::from_secs(1_715_472_000));
+
+        assert_eq!(date("https://example.com/2024/05/12/title"), may_12);
+        assert_eq!(date("https://example.com/news/2024/5/12/"), may_12);
+        assert_eq!(date("https://example.com/2024-05-12-title.html"), may_12);
+        assert_eq!(date("https://example.com/blog/2024/05/12"), may_12);
+
+        assert_eq!(date("https://example.com/2024/05/"), None);
+        assert_eq!(date("https://example.com/2024/13/40/"), None);
+        assert_eq!(date("https://example.com/2099/01/01/"), None);
+        assert_eq!(date("https://example.com/?date=2024/05/12/"), None);
+        assert_eq!(date("https://example.com/id/12345/05/12/"), None);
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_from_json_ld() {
+        let now = UNIX_EPOCH + Duration::from_secs(1_715_495_400);
+        let dates = |json: &str| {
+            from_json_ld(
+                &serde_json::from_str(json).expect("Failed to parse JSON!"),
+                now,
+            )
+        };
+        let may_12 = Some(UNIX_EPOCH + Duration::from_secs(1_715_472_000));
+        let may_1 = Some(UNIX_EPOCH + Duration::from_secs(1_714_521_600));
+
+        assert_eq!(
+            dates(
+                r#"{"@type": "NewsArticle", "datePublished": "2024-05-01", "dateModified": "2024-05-12"}"#
+            ),
+            Dates {
+                published_at: may_1,
+                modified_at: may_12,
+            }
+        );
+        assert_eq!(
+            dates(
+                r#"{"@graph": [{"@type": "WebSite"}, {"@type": "Article", "datePublished": "2024-05-12"}]}"#
+            ),
+            Dates {
+                published_at: may_12,
+                modified_at: None,
+            }
+        );
+
+        // Implausible dates are skipped for the next one.
+        assert_eq!(
+            dates(r#"[{"datePublished": "2999-01-01"}, {"datePublished": "2024-05-01"}]"#),
+            Dates {
+                published_at: may_1,
+                modified_at: None,
+            }
+        );
+        assert_eq!(dates(r#"{"datePublished": 2024}"#), Dates::default());
+    }
+}
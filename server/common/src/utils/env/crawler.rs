@@ -1,9 +1,73 @@
 use log::warn;
 use std::time::Duration;
+use url::Url;
 
 /// The default delay between each request.
 const DEFAULT_DELAY: Duration = Duration::from_secs(1);
 
+/// The default probability of a discovered link being queued.
+const DEFAULT_SAMPLE_RATE: f64 = 1.0;
+
+/// The default interval between each frontier snapshot.
+const DEFAULT_FRONTIER_SNAPSHOT_INTERVAL: Duration = Duration::from_secs(300);
+
+/// The default interval between each recrawl of the fresh URLs.
+const DEFAULT_FRESHNESS_INTERVAL: Duration = Duration::from_secs(900);
+
+/// The default number of crawls kept in the history of each page.
+const DEFAULT_HISTORY_LENGTH: usize = 32;
+
+/// The default interval between each check for submitted URLs.
+const DEFAULT_SUBMISSION_INTERVAL: Duration = Duration::from_secs(60);
+
+/// The default interval between each flush of the crawl usage to the database.
+const DEFAULT_USAGE_FLUSH_INTERVAL: Duration = Duration::from_secs(60);
+
+/// The default interval between each flush of the crawl log to the database.
+const DEFAULT_CRAWL_LOG_FLUSH_INTERVAL: Duration = Duration::from_secs(10);
+
+/// The default number of pages written to the database at once.
+const DEFAULT_PAGE_BATCH_SIZE: usize = 1;
+
+/// The default maximum time a page waits to be written to the database.
+const DEFAULT_PAGE_BATCH_INTERVAL: Duration = Duration::from_millis(500);
+
+/// The default share of throttled responses that slows down the whole crawl.
+const DEFAULT_THROTTLE_THRESHOLD: f64 = 0.5;
+
+/// The default share of throttled responses the crawl recovers at.
+const DEFAULT_THROTTLE_RECOVERY: f64 = 0.1;
+
+/// The default window the share of throttled responses is measured over.
+const DEFAULT_THROTTLE_WINDOW: Duration = Duration::from_secs(60);
+
+/// The default delay added after each request while the crawl is slowed down.
+const DEFAULT_THROTTLE_DELAY: Duration = Duration::from_secs(5);
+
+/// The default interval between each check for failed URLs to retry.
+const DEFAULT_RETRY_INTERVAL: Duration = Duration::from_secs(60);
+
+/// The default delay before the first retry of a failed URL, doubled with every attempt after it.
+const DEFAULT_RETRY_DELAY: Duration = Duration::from_secs(300);
+
+/// The default number of times fetching a URL may fail, before it isn't retried anymore.
+const DEFAULT_MAXIMUM_RETRY_ATTEMPTS: u32 = 5;
+
+/// The default maximum number of URLs in spider traps queued per host.
+const DEFAULT_TRAP_URLS_PER_HOST: usize = 100;
+
+/// The default number of path segments, above which a URL is in a spider trap.
+const DEFAULT_TRAP_PATH_DEPTH: usize = 12;
+
+/// The default number of query parameters, above which a URL is in a spider trap.
+const DEFAULT_TRAP_QUERY_PARAMETERS: usize = 10;
+
+/// The default time since a page was last fetched successfully, after which it's removed as stale.
+const DEFAULT_STALE_PAGE_AGE: Duration = Duration::from_secs(90 * 24 * 60 * 60);
+
+/// The default weight of the authority of a domain in the priority of its queued URLs.
+const DEFAULT_FRONTIER_AUTHORITY_WEIGHT: f64 = 1.0;
+
 /// Get the delay between each request.
 ///
 /// # Returns
@@ -42,3 +106,1100 @@ pub fn get_delay() -> Duration {
         },
     )
 }
+
+/// Get the interval between each snapshot of the crawl frontier.
+///
+/// # Returns
+///
+/// * `Some(Duration)` - The interval between each snapshot in seconds.
+/// * `None` - If snapshots are disabled.
+///
+/// # Notes
+///
+/// * If the `FRONTIER_SNAPSHOT_INTERVAL` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_FRONTIER_SNAPSHOT_INTERVAL`.
+/// * Setting `FRONTIER_SNAPSHOT_INTERVAL` to `0` disables snapshots.
+#[must_use]
+pub fn get_frontier_snapshot_interval() -> Option<Duration> {
+    let interval = std::env::var_os("FRONTIER_SNAPSHOT_INTERVAL").map_or_else(
+        || DEFAULT_FRONTIER_SNAPSHOT_INTERVAL,
+        |interval| {
+            let Some(interval) = interval.to_str() else {
+                warn!(
+                    "Failed to parse FRONTIER_SNAPSHOT_INTERVAL to string slice, defaulting to {}s...",
+                    DEFAULT_FRONTIER_SNAPSHOT_INTERVAL.as_secs()
+                );
+
+                return DEFAULT_FRONTIER_SNAPSHOT_INTERVAL;
+            };
+
+            match interval.parse::<u64>() {
+                Ok(interval) => Duration::from_secs(interval),
+                Err(why) => {
+                    warn!(
+                        "FRONTIER_SNAPSHOT_INTERVAL isn't a valid number, defaulting to {}s... (Error: {why})",
+                        DEFAULT_FRONTIER_SNAPSHOT_INTERVAL.as_secs()
+                    );
+
+                    DEFAULT_FRONTIER_SNAPSHOT_INTERVAL
+                }
+            }
+        },
+    );
+
+    (!interval.is_zero()).then_some(interval)
+}
+
+/// Get the probability of a discovered link being queued.
+///
+/// # Returns
+///
+/// * The sample rate, between `0.0` and `1.0`.
+///
+/// # Notes
+///
+/// * If the `CRAWL_SAMPLE_RATE` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_SAMPLE_RATE`, meaning every link is queued.
+/// * Values outside of `0.0..=1.0` are clamped.
+#[must_use]
+pub fn get_sample_rate() -> f64 {
+    std::env::var_os("CRAWL_SAMPLE_RATE").map_or_else(
+        || DEFAULT_SAMPLE_RATE,
+        |sample_rate| {
+            let Some(sample_rate) = sample_rate.to_str() else {
+                warn!("Failed to parse CRAWL_SAMPLE_RATE to string slice, defaulting to {DEFAULT_SAMPLE_RATE}...");
+
+                return DEFAULT_SAMPLE_RATE;
+            };
+
+            match sample_rate.parse::<f64>() {
+                Ok(sample_rate) if (0.0..=1.0).contains(&sample_rate) => sample_rate,
+                Ok(sample_rate) if sample_rate.is_finite() => {
+                    warn!("CRAWL_SAMPLE_RATE must be between 0 and 1, clamping {sample_rate}...");
+
+                    sample_rate.clamp(0.0, 1.0)
+                }
+                Ok(_) => {
+                    warn!("CRAWL_SAMPLE_RATE isn't a finite number, defaulting to {DEFAULT_SAMPLE_RATE}...");
+
+                    DEFAULT_SAMPLE_RATE
+                }
+                Err(why) => {
+                    warn!("CRAWL_SAMPLE_RATE isn't a valid number, defaulting to {DEFAULT_SAMPLE_RATE}... (Error: {why})");
+
+                    DEFAULT_SAMPLE_RATE
+                }
+            }
+        },
+    )
+}
+
+/// Get the seed of the random number generator used for sampling links.
+///
+/// # Returns
+///
+/// * `Some(u64)` - The seed, making the sampled links reproducible.
+/// * `None` - If the `CRAWL_SAMPLE_SEED` environment variable isn't set or isn't a valid number.
+#[must_use]
+pub fn get_sample_seed() -> Option<u64> {
+    let seed = std::env::var_os("CRAWL_SAMPLE_SEED")?;
+    let Some(seed) = seed.to_str() else {
+        warn!("Failed to parse CRAWL_SAMPLE_SEED to string slice, using a random seed...");
+
+        return None;
+    };
+
+    match seed.parse::<u64>() {
+        Ok(seed) => Some(seed),
+        Err(why) => {
+            warn!("CRAWL_SAMPLE_SEED isn't a valid number, using a random seed... (Error: {why})");
+
+            None
+        }
+    }
+}
+
+/// Get the number of crawls kept in the history of each page.
+///
+/// # Returns
+///
+/// * The maximum number of crawls kept per page, older crawls are pruned.
+///
+/// # Notes
+///
+/// * If the `HISTORY_LENGTH` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_HISTORY_LENGTH`.
+#[must_use]
+pub fn get_history_length() -> usize {
+    std::env::var_os("HISTORY_LENGTH").map_or_else(
+        || DEFAULT_HISTORY_LENGTH,
+        |length| {
+            let Some(length) = length.to_str() else {
+                warn!("Failed to parse HISTORY_LENGTH to string slice, defaulting to {DEFAULT_HISTORY_LENGTH}...");
+
+                return DEFAULT_HISTORY_LENGTH;
+            };
+
+            match length.parse::<usize>() {
+                Ok(length) => length,
+                Err(why) => {
+                    warn!("HISTORY_LENGTH isn't a valid number, defaulting to {DEFAULT_HISTORY_LENGTH}... (Error: {why})");
+
+                    DEFAULT_HISTORY_LENGTH
+                }
+            }
+        },
+    )
+}
+
+/// Get the URLs to recrawl often, like the front pages of news sites, to find new content on them quickly.
+///
+/// # Returns
+///
+/// * The fresh URLs, empty if there are none.
+///
+/// # Notes
+///
+/// * `FRESH_URLS` is a comma separated list of URLs.
+/// * Invalid URLs are skipped.
+#[must_use]
+pub fn get_fresh_urls() -> Vec<Url> {
+    let Some(urls) = std::env::var_os("FRESH_URLS") else {
+        return Vec::new();
+    };
+    let Some(urls) = urls.to_str() else {
+        warn!("Failed to parse FRESH_URLS to string slice, not recrawling any fresh URLs...");
+
+        return Vec::new();
+    };
+
+    urls.split(',')
+        .map(str::trim)
+        .filter(|url| !url.is_empty())
+        .filter_map(|url| match Url::parse(url) {
+            Ok(url) => Some(url),
+            Err(why) => {
+                warn!("FRESH_URLS has an invalid URL \"{url}\", skipping it... (Error: {why})");
+
+                None
+            }
+        })
+        .collect()
+}
+
+/// Get the interval between each recrawl of the fresh URLs.
+///
+/// # Returns
+///
+/// * `Some(Duration)` - The interval between each recrawl in seconds.
+/// * `None` - If the fresh URLs are only crawled once, like any other URL.
+///
+/// # Notes
+///
+/// * If the `FRESHNESS_INTERVAL` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_FRESHNESS_INTERVAL`.
+/// * Setting `FRESHNESS_INTERVAL` to `0` disables recrawling.
+#[must_use]
+pub fn get_freshness_interval() -> Option<Duration> {
+    let interval = std::env::var_os("FRESHNESS_INTERVAL").map_or_else(
+        || DEFAULT_FRESHNESS_INTERVAL,
+        |interval| {
+            let Some(interval) = interval.to_str() else {
+                warn!(
+                    "Failed to parse FRESHNESS_INTERVAL to string slice, defaulting to {}s...",
+                    DEFAULT_FRESHNESS_INTERVAL.as_secs()
+                );
+
+                return DEFAULT_FRESHNESS_INTERVAL;
+            };
+
+            match interval.parse::<u64>() {
+                Ok(interval) => Duration::from_secs(interval),
+                Err(why) => {
+                    warn!(
+                        "FRESHNESS_INTERVAL isn't a valid number, defaulting to {}s... (Error: {why})",
+                        DEFAULT_FRESHNESS_INTERVAL.as_secs()
+                    );
+
+                    DEFAULT_FRESHNESS_INTERVAL
+                }
+            }
+        },
+    );
+
+    (!interval.is_zero()).then_some(interval)
+}
+
+/// Get the interval between each check for submitted URLs.
+///
+/// # Returns
+///
+/// * `Some(Duration)` - The interval between each check in seconds.
+/// * `None` - If submitted URLs aren't crawled.
+///
+/// # Notes
+///
+/// * If the `SUBMISSION_INTERVAL` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_SUBMISSION_INTERVAL`.
+/// * Setting `SUBMISSION_INTERVAL` to `0` disables crawling submitted URLs.
+#[must_use]
+pub fn get_submission_interval() -> Option<Duration> {
+    let interval = std::env::var_os("SUBMISSION_INTERVAL").map_or_else(
+        || DEFAULT_SUBMISSION_INTERVAL,
+        |interval| {
+            let Some(interval) = interval.to_str() else {
+                warn!(
+                    "Failed to parse SUBMISSION_INTERVAL to string slice, defaulting to {}s...",
+                    DEFAULT_SUBMISSION_INTERVAL.as_secs()
+                );
+
+                return DEFAULT_SUBMISSION_INTERVAL;
+            };
+
+            match interval.parse::<u64>() {
+                Ok(interval) => Duration::from_secs(interval),
+                Err(why) => {
+                    warn!(
+                        "SUBMISSION_INTERVAL isn't a valid number, defaulting to {}s... (Error: {why})",
+                        DEFAULT_SUBMISSION_INTERVAL.as_secs()
+                    );
+
+                    DEFAULT_SUBMISSION_INTERVAL
+                }
+            }
+        },
+    );
+
+    (!interval.is_zero()).then_some(interval)
+}
+
+/// Get the interval between each flush of the crawl usage to the database.
+///
+/// # Returns
+///
+/// * `Some(Duration)` - The interval between each flush in seconds.
+/// * `None` - If the usage is only flushed once the crawl is done.
+///
+/// # Notes
+///
+/// * If the `USAGE_FLUSH_INTERVAL` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_USAGE_FLUSH_INTERVAL`.
+/// * Setting `USAGE_FLUSH_INTERVAL` to `0` disables periodic flushes.
+#[must_use]
+pub fn get_usage_flush_interval() -> Option<Duration> {
+    let interval = std::env::var_os("USAGE_FLUSH_INTERVAL").map_or_else(
+        || DEFAULT_USAGE_FLUSH_INTERVAL,
+        |interval| {
+            let Some(interval) = interval.to_str() else {
+                warn!(
+                    "Failed to parse USAGE_FLUSH_INTERVAL to string slice, defaulting to {}s...",
+                    DEFAULT_USAGE_FLUSH_INTERVAL.as_secs()
+                );
+
+                return DEFAULT_USAGE_FLUSH_INTERVAL;
+            };
+
+            match interval.parse::<u64>() {
+                Ok(interval) => Duration::from_secs(interval),
+                Err(why) => {
+                    warn!(
+                        "USAGE_FLUSH_INTERVAL isn't a valid number, defaulting to {}s... (Error: {why})",
+                        DEFAULT_USAGE_FLUSH_INTERVAL.as_secs()
+                    );
+
+                    DEFAULT_USAGE_FLUSH_INTERVAL
+                }
+            }
+        },
+    );
+
+    (!interval.is_zero()).then_some(interval)
+}
+
+/// Get the number of pages written to the database at once.
+///
+/// # Returns
+///
+/// * The number of pages buffered before they're written in one batch, `1` to write each page on its own.
+///
+/// # Notes
+///
+/// * If the `PAGE_BATCH_SIZE` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_PAGE_BATCH_SIZE`.
+/// * A `PAGE_BATCH_SIZE` of `0` is treated as `1`.
+#[must_use]
+pub fn get_page_batch_size() -> usize {
+    std::env::var_os("PAGE_BATCH_SIZE")
+        .map_or_else(
+            || DEFAULT_PAGE_BATCH_SIZE,
+            |size| {
+                let Some(size) = size.to_str() else {
+                    warn!("Failed to parse PAGE_BATCH_SIZE to string slice, defaulting to {DEFAULT_PAGE_BATCH_SIZE}...");
+
+                    return DEFAULT_PAGE_BATCH_SIZE;
+                };
+
+                match size.parse::<usize>() {
+                    Ok(size) => size,
+                    Err(why) => {
+                        warn!("PAGE_BATCH_SIZE isn't a valid number, defaulting to {DEFAULT_PAGE_BATCH_SIZE}... (Error: {why})");
+
+                        DEFAULT_PAGE_BATCH_SIZE
+                    }
+                }
+            },
+        )
+        .max(1)
+}
+
+/// Get the maximum time a page waits in a batch before it's written to the database.
+///
+/// # Returns
+///
+/// * The interval between each write of the buffered pages in milliseconds.
+///
+/// # Notes
+///
+/// * If the `PAGE_BATCH_INTERVAL` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_PAGE_BATCH_INTERVAL`.
+/// * It only matters if `PAGE_BATCH_SIZE` is more than `1`.
+#[must_use]
+pub fn get_page_batch_interval() -> Duration {
+    std::env::var_os("PAGE_BATCH_INTERVAL").map_or_else(
+        || DEFAULT_PAGE_BATCH_INTERVAL,
+        |interval| {
+            let Some(interval) = interval.to_str() else {
+                warn!(
+                    "Failed to parse PAGE_BATCH_INTERVAL to string slice, defaulting to {}ms...",
+                    DEFAULT_PAGE_BATCH_INTERVAL.as_millis()
+                );
+
+                return DEFAULT_PAGE_BATCH_INTERVAL;
+            };
+
+            match interval.parse::<u64>() {
+                Ok(interval) if interval > 0 => Duration::from_millis(interval),
+                Ok(_) => {
+                    warn!(
+                        "PAGE_BATCH_INTERVAL must be more than 0, defaulting to {}ms...",
+                        DEFAULT_PAGE_BATCH_INTERVAL.as_millis()
+                    );
+
+                    DEFAULT_PAGE_BATCH_INTERVAL
+                }
+                Err(why) => {
+                    warn!(
+                        "PAGE_BATCH_INTERVAL isn't a valid number, defaulting to {}ms... (Error: {why})",
+                        DEFAULT_PAGE_BATCH_INTERVAL.as_millis()
+                    );
+
+                    DEFAULT_PAGE_BATCH_INTERVAL
+                }
+            }
+        },
+    )
+}
+
+/// Get the interval between each flush of the crawl log to the database.
+///
+/// # Returns
+///
+/// * `Some(Duration)` - The interval between each flush in seconds.
+/// * `None` - If the crawl log is only flushed once the crawl is done.
+///
+/// # Notes
+///
+/// * If the `CRAWL_LOG_FLUSH_INTERVAL` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_CRAWL_LOG_FLUSH_INTERVAL`.
+/// * Setting `CRAWL_LOG_FLUSH_INTERVAL` to `0` disables periodic flushes.
+#[must_use]
+pub fn get_crawl_log_flush_interval() -> Option<Duration> {
+    let interval = std::env::var_os("CRAWL_LOG_FLUSH_INTERVAL").map_or_else(
+        || DEFAULT_CRAWL_LOG_FLUSH_INTERVAL,
+        |interval| {
+            let Some(interval) = interval.to_str() else {
+                warn!(
+                    "Failed to parse CRAWL_LOG_FLUSH_INTERVAL to string slice, defaulting to {}s...",
+                    DEFAULT_CRAWL_LOG_FLUSH_INTERVAL.as_secs()
+                );
+
+                return DEFAULT_CRAWL_LOG_FLUSH_INTERVAL;
+            };
+
+            match interval.parse::<u64>() {
+                Ok(interval) => Duration::from_secs(interval),
+                Err(why) => {
+                    warn!(
+                        "CRAWL_LOG_FLUSH_INTERVAL isn't a valid number, defaulting to {}s... (Error: {why})",
+                        DEFAULT_CRAWL_LOG_FLUSH_INTERVAL.as_secs()
+                    );
+
+                    DEFAULT_CRAWL_LOG_FLUSH_INTERVAL
+                }
+            }
+        },
+    );
+
+    (!interval.is_zero()).then_some(interval)
+}
+
+/// How the seed URLs are ordered in the queue.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub enum SeedSelection {
+    /// In a random order, where seed URLs with a higher weight tend to come first.
+    #[default]
+    Weighted,
+    /// One seed URL per host in turn, in the order they're listed.
+    RoundRobin,
+}
+
+/// Get how the seed URLs are ordered in the queue.
+///
+/// # Returns
+///
+/// * `SeedSelection` - `Weighted` or `RoundRobin`.
+///
+/// # Notes
+///
+/// * If the `SEED_SELECTION` environment variable isn't set, the default value is used.
+/// * The default value is `SeedSelection::Weighted`.
+/// * `SEED_SELECTION` can be `weighted` or `round-robin`.
+#[must_use]
+pub fn get_seed_selection() -> SeedSelection {
+    std::env::var_os("SEED_SELECTION").map_or_else(SeedSelection::default, |selection| {
+        match selection.to_str() {
+            Some("weighted") => SeedSelection::Weighted,
+            Some("round-robin") => SeedSelection::RoundRobin,
+            Some(selection) => {
+                warn!("Unknown SEED_SELECTION \"{selection}\", defaulting to weighted...");
+
+                SeedSelection::default()
+            }
+            None => {
+                warn!("Failed to parse SEED_SELECTION to string slice, defaulting to weighted...");
+
+                SeedSelection::default()
+            }
+        }
+    })
+}
+
+/// Get the share of throttled responses that slows down the whole crawl.
+///
+/// # Returns
+///
+/// * `Some(f64)` - The share of `429` and `503` responses across all hosts, between `0.0` and `1.0`.
+/// * `None` - If the global slowdown is disabled.
+///
+/// # Notes
+///
+/// * If the `THROTTLE_THRESHOLD` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_THROTTLE_THRESHOLD`.
+/// * Values outside of `0.0..=1.0` are clamped, and setting `THROTTLE_THRESHOLD` to `0` disables the slowdown.
+#[must_use]
+pub fn get_throttle_threshold() -> Option<f64> {
+    let threshold = std::env::var_os("THROTTLE_THRESHOLD").map_or_else(
+        || DEFAULT_THROTTLE_THRESHOLD,
+        |threshold| {
+            let Some(threshold) = threshold.to_str() else {
+                warn!("Failed to parse THROTTLE_THRESHOLD to string slice, defaulting to {DEFAULT_THROTTLE_THRESHOLD}...");
+
+                return DEFAULT_THROTTLE_THRESHOLD;
+            };
+
+            match threshold.parse::<f64>() {
+                Ok(threshold) if threshold.is_finite() => threshold.clamp(0.0, 1.0),
+                Ok(_) => {
+                    warn!("THROTTLE_THRESHOLD isn't a finite number, defaulting to {DEFAULT_THROTTLE_THRESHOLD}...");
+
+                    DEFAULT_THROTTLE_THRESHOLD
+                }
+                Err(why) => {
+                    warn!("THROTTLE_THRESHOLD isn't a valid number, defaulting to {DEFAULT_THROTTLE_THRESHOLD}... (Error: {why})");
+
+                    DEFAULT_THROTTLE_THRESHOLD
+                }
+            }
+        },
+    );
+
+    (threshold > 0.0).then_some(threshold)
+}
+
+/// Get the share of throttled responses the crawl recovers from a global slowdown at.
+///
+/// # Returns
+///
+/// * The share of `429` and `503` responses across all hosts, between `0.0` and `1.0`.
+///
+/// # Notes
+///
+/// * If the `THROTTLE_RECOVERY` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_THROTTLE_RECOVERY`.
+/// * Values outside of `0.0..=1.0` are clamped.
+#[must_use]
+pub fn get_throttle_recovery() -> f64 {
+    std::env::var_os("THROTTLE_RECOVERY").map_or_else(
+        || DEFAULT_THROTTLE_RECOVERY,
+        |recovery| {
+            let Some(recovery) = recovery.to_str() else {
+                warn!("Failed to parse THROTTLE_RECOVERY to string slice, defaulting to {DEFAULT_THROTTLE_RECOVERY}...");
+
+                return DEFAULT_THROTTLE_RECOVERY;
+            };
+
+            match recovery.parse::<f64>() {
+                Ok(recovery) if recovery.is_finite() => recovery.clamp(0.0, 1.0),
+                Ok(_) => {
+                    warn!("THROTTLE_RECOVERY isn't a finite number, defaulting to {DEFAULT_THROTTLE_RECOVERY}...");
+
+                    DEFAULT_THROTTLE_RECOVERY
+                }
+                Err(why) => {
+                    warn!("THROTTLE_RECOVERY isn't a valid number, defaulting to {DEFAULT_THROTTLE_RECOVERY}... (Error: {why})");
+
+                    DEFAULT_THROTTLE_RECOVERY
+                }
+            }
+        },
+    )
+}
+
+/// Get the window the share of throttled responses is measured over.
+///
+/// # Returns
+///
+/// * The window in seconds.
+///
+/// # Notes
+///
+/// * If the `THROTTLE_WINDOW` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_THROTTLE_WINDOW`.
+#[must_use]
+pub fn get_throttle_window() -> Duration {
+    std::env::var_os("THROTTLE_WINDOW").map_or_else(
+        || DEFAULT_THROTTLE_WINDOW,
+        |window| {
+            let Some(window) = window.to_str() else {
+                warn!(
+                    "Failed to parse THROTTLE_WINDOW to string slice, defaulting to {}s...",
+                    DEFAULT_THROTTLE_WINDOW.as_secs()
+                );
+
+                return DEFAULT_THROTTLE_WINDOW;
+            };
+
+            match window.parse::<u64>() {
+                Ok(window) if window > 0 => Duration::from_secs(window),
+                Ok(_) => {
+                    warn!(
+                        "THROTTLE_WINDOW must be more than 0, defaulting to {}s...",
+                        DEFAULT_THROTTLE_WINDOW.as_secs()
+                    );
+
+                    DEFAULT_THROTTLE_WINDOW
+                }
+                Err(why) => {
+                    warn!(
+                        "THROTTLE_WINDOW isn't a valid number, defaulting to {}s... (Error: {why})",
+                        DEFAULT_THROTTLE_WINDOW.as_secs()
+                    );
+
+                    DEFAULT_THROTTLE_WINDOW
+                }
+            }
+        },
+    )
+}
+
+/// Get the delay added after each request while the crawl is slowed down.
+///
+/// # Returns
+///
+/// * The delay in milliseconds.
+///
+/// # Notes
+///
+/// * If the `THROTTLE_DELAY` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_THROTTLE_DELAY`.
+/// * A longer `Retry-After` of a throttled response is waited instead.
+#[must_use]
+pub fn get_throttle_delay() -> Duration {
+    std::env::var_os("THROTTLE_DELAY").map_or_else(
+        || DEFAULT_THROTTLE_DELAY,
+        |delay| {
+            let Some(delay) = delay.to_str() else {
+                warn!(
+                    "Failed to parse THROTTLE_DELAY to string slice, defaulting to {}ms...",
+                    DEFAULT_THROTTLE_DELAY.as_millis()
+                );
+
+                return DEFAULT_THROTTLE_DELAY;
+            };
+
+            match delay.parse::<u64>() {
+                Ok(delay) => Duration::from_millis(delay),
+                Err(why) => {
+                    warn!(
+                        "THROTTLE_DELAY isn't a valid number, defaulting to {}ms... (Error: {why})",
+                        DEFAULT_THROTTLE_DELAY.as_millis()
+                    );
+
+                    DEFAULT_THROTTLE_DELAY
+                }
+            }
+        },
+    )
+}
+
+/// Get the maximum number of requests per second made by the whole crawl.
+///
+/// # Returns
+///
+/// * `Some(f64)` - The maximum number of requests per second, across all hosts and workers.
+/// * `None` - If the number of requests per second isn't limited.
+///
+/// # Notes
+///
+/// * If the `MAXIMUM_REQUEST_RATE` environment variable isn't set, or is `0`, the requests aren't limited.
+/// * Fractions are allowed, like `0.5` for a request every other second.
+#[must_use]
+pub fn get_maximum_request_rate() -> Option<f64> {
+    let rate = std::env::var_os("MAXIMUM_REQUEST_RATE").map_or(0.0, |rate| {
+        let Some(rate) = rate.to_str() else {
+            warn!("Failed to parse MAXIMUM_REQUEST_RATE to string slice, not limiting the requests...");
+
+            return 0.0;
+        };
+
+        match rate.parse::<f64>() {
+            Ok(rate) if rate.is_finite() && rate >= 0.0 => rate,
+            Ok(_) => {
+                warn!("MAXIMUM_REQUEST_RATE isn't a finite positive number, not limiting the requests...");
+
+                0.0
+            }
+            Err(why) => {
+                warn!("MAXIMUM_REQUEST_RATE isn't a valid number, not limiting the requests... (Error: {why})");
+
+                0.0
+            }
+        }
+    });
+
+    (rate > 0.0).then_some(rate)
+}
+
+/// Get the maximum number of requests per second made to each host.
+///
+/// # Returns
+///
+/// * `Some(f64)` - The maximum number of requests per second to a host, across all workers.
+/// * `None` - If the number of requests per second to a host isn't limited.
+///
+/// # Notes
+///
+/// * If the `HOST_REQUEST_RATE` environment variable isn't set, or is `0`, the requests to a host aren't limited.
+/// * Fractions are allowed, like `0.5` for a request every other second.
+#[must_use]
+pub fn get_host_request_rate() -> Option<f64> {
+    let rate = std::env::var_os("HOST_REQUEST_RATE").map_or(0.0, |rate| {
+        let Some(rate) = rate.to_str() else {
+            warn!("Failed to parse HOST_REQUEST_RATE to string slice, not limiting the requests to each host...");
+
+            return 0.0;
+        };
+
+        match rate.parse::<f64>() {
+            Ok(rate) if rate.is_finite() && rate >= 0.0 => rate,
+            Ok(_) => {
+                warn!("HOST_REQUEST_RATE isn't a finite positive number, not limiting the requests to each host...");
+
+                0.0
+            }
+            Err(why) => {
+                warn!("HOST_REQUEST_RATE isn't a valid number, not limiting the requests to each host... (Error: {why})");
+
+                0.0
+            }
+        }
+    });
+
+    (rate > 0.0).then_some(rate)
+}
+
+/// Gets the hosts whose requests per second are limited differently than `HOST_REQUEST_RATE`.
+///
+/// # Returns
+///
+/// * `Vec<(String, f64)>` - The patterns of the hosts in lowercase, and their requests per second, in order.
+///
+/// # Panics
+///
+/// * If `HOST_REQUEST_RATES` is not valid UTF-8.
+///
+/// # Notes
+///
+/// * `HOST_REQUEST_RATES` is a comma separated list of `pattern=rate` pairs, like `*.example.com=0.5`.
+/// * A pattern is matched like in `TRANSPORTS`, and a rate of `0` doesn't limit the requests to the hosts.
+/// * Pairs without a pattern, or with a rate that isn't a finite positive number, are skipped.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_host_request_rates() -> Vec<(String, f64)> {
+    let Some(rates) = std::env::var_os("HOST_REQUEST_RATES") else {
+        return Vec::new();
+    };
+
+    rates
+        .to_str()
+        .expect("HOST_REQUEST_RATES must be valid UTF-8!")
+        .split(',')
+        .map(str::trim)
+        .filter(|rate| !rate.is_empty())
+        .filter_map(|rate| {
+            let pair = rate
+                .split_once('=')
+                .and_then(|(pattern, rate)| {
+                    Some((pattern.trim(), rate.trim().parse::<f64>().ok()?))
+                })
+                .filter(|(pattern, rate)| !pattern.is_empty() && rate.is_finite() && *rate >= 0.0);
+            if pair.is_none() {
+                warn!("Skipping host request rate \"{rate}\", it must be a pattern=rate pair!");
+            }
+
+            pair.map(|(pattern, rate)| (pattern.to_lowercase(), rate))
+        })
+        .collect()
+}
+
+/// Get the interval between each check for failed URLs to retry.
+///
+/// # Returns
+///
+/// * `Some(Duration)` - The interval between each check in seconds.
+/// * `None` - If failed URLs aren't retried.
+///
+/// # Notes
+///
+/// * If the `RETRY_INTERVAL` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_RETRY_INTERVAL`.
+/// * Setting `RETRY_INTERVAL` to `0` disables retrying failed URLs.
+#[must_use]
+pub fn get_retry_interval() -> Option<Duration> {
+    let interval = std::env::var_os("RETRY_INTERVAL").map_or_else(
+        || DEFAULT_RETRY_INTERVAL,
+        |interval| {
+            let Some(interval) = interval.to_str() else {
+                warn!(
+                    "Failed to parse RETRY_INTERVAL to string slice, defaulting to {}s...",
+                    DEFAULT_RETRY_INTERVAL.as_secs()
+                );
+
+                return DEFAULT_RETRY_INTERVAL;
+            };
+
+            match interval.parse::<u64>() {
+                Ok(interval) => Duration::from_secs(interval),
+                Err(why) => {
+                    warn!(
+                        "RETRY_INTERVAL isn't a valid number, defaulting to {}s... (Error: {why})",
+                        DEFAULT_RETRY_INTERVAL.as_secs()
+                    );
+
+                    DEFAULT_RETRY_INTERVAL
+                }
+            }
+        },
+    );
+
+    (!interval.is_zero()).then_some(interval)
+}
+
+/// Get the delay before the first retry of a failed URL.
+///
+/// # Returns
+///
+/// * The delay in seconds, doubled with every attempt after the first.
+///
+/// # Notes
+///
+/// * If the `RETRY_DELAY` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_RETRY_DELAY`.
+#[must_use]
+pub fn get_retry_delay() -> Duration {
+    std::env::var_os("RETRY_DELAY").map_or_else(
+        || DEFAULT_RETRY_DELAY,
+        |delay| {
+            let Some(delay) = delay.to_str() else {
+                warn!(
+                    "Failed to parse RETRY_DELAY to string slice, defaulting to {}s...",
+                    DEFAULT_RETRY_DELAY.as_secs()
+                );
+
+                return DEFAULT_RETRY_DELAY;
+            };
+
+            match delay.parse::<u64>() {
+                Ok(delay) => Duration::from_secs(delay),
+                Err(why) => {
+                    warn!(
+                        "RETRY_DELAY isn't a valid number, defaulting to {}s... (Error: {why})",
+                        DEFAULT_RETRY_DELAY.as_secs()
+                    );
+
+                    DEFAULT_RETRY_DELAY
+                }
+            }
+        },
+    )
+}
+
+/// Get the number of times fetching a URL may fail, before it isn't retried anymore.
+///
+/// # Returns
+///
+/// * The maximum number of failed attempts, after which the URL is marked as dead.
+///
+/// # Notes
+///
+/// * If the `MAXIMUM_RETRY_ATTEMPTS` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_MAXIMUM_RETRY_ATTEMPTS`.
+#[must_use]
+pub fn get_maximum_retry_attempts() -> u32 {
+    std::env::var_os("MAXIMUM_RETRY_ATTEMPTS").map_or_else(
+        || DEFAULT_MAXIMUM_RETRY_ATTEMPTS,
+        |attempts| {
+            let Some(attempts) = attempts.to_str() else {
+                warn!("Failed to parse MAXIMUM_RETRY_ATTEMPTS to string slice, defaulting to {DEFAULT_MAXIMUM_RETRY_ATTEMPTS}...");
+
+                return DEFAULT_MAXIMUM_RETRY_ATTEMPTS;
+            };
+
+            match attempts.parse::<u32>() {
+                Ok(attempts) => attempts,
+                Err(why) => {
+                    warn!("MAXIMUM_RETRY_ATTEMPTS isn't a valid number, defaulting to {DEFAULT_MAXIMUM_RETRY_ATTEMPTS}... (Error: {why})");
+
+                    DEFAULT_MAXIMUM_RETRY_ATTEMPTS
+                }
+            }
+        },
+    )
+}
+
+/// Get the time since a page was last fetched successfully, after which it's removed as stale.
+///
+/// # Returns
+///
+/// * `Some(Duration)` - The age of stale pages in seconds.
+/// * `None` - If pages aren't removed for their age.
+///
+/// # Notes
+///
+/// * If the `STALE_PAGE_AGE` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_STALE_PAGE_AGE`.
+/// * Setting `STALE_PAGE_AGE` to `0` only removes the pages that failed to be fetched too many times.
+#[must_use]
+pub fn get_stale_page_age() -> Option<Duration> {
+    let age = std::env::var_os("STALE_PAGE_AGE").map_or_else(
+        || DEFAULT_STALE_PAGE_AGE,
+        |age| {
+            let Some(age) = age.to_str() else {
+                warn!(
+                    "Failed to parse STALE_PAGE_AGE to string slice, defaulting to {}s...",
+                    DEFAULT_STALE_PAGE_AGE.as_secs()
+                );
+
+                return DEFAULT_STALE_PAGE_AGE;
+            };
+
+            match age.parse::<u64>() {
+                Ok(age) => Duration::from_secs(age),
+                Err(why) => {
+                    warn!(
+                        "STALE_PAGE_AGE isn't a valid number, defaulting to {}s... (Error: {why})",
+                        DEFAULT_STALE_PAGE_AGE.as_secs()
+                    );
+
+                    DEFAULT_STALE_PAGE_AGE
+                }
+            }
+        },
+    );
+
+    (!age.is_zero()).then_some(age)
+}
+
+/// Get the maximum number of URLs in spider traps queued per host, like the pages of an endless calendar.
+///
+/// # Returns
+///
+/// * `Some(usize)` - The maximum number of URLs.
+/// * `None` - If URLs in spider traps are queued like any other.
+///
+/// # Notes
+///
+/// * If the `TRAP_URLS_PER_HOST` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_TRAP_URLS_PER_HOST`.
+/// * Setting `TRAP_URLS_PER_HOST` to `0` disables it.
+#[must_use]
+pub fn get_trap_urls_per_host() -> Option<usize> {
+    let urls = std::env::var_os("TRAP_URLS_PER_HOST").map_or_else(
+        || DEFAULT_TRAP_URLS_PER_HOST,
+        |urls| {
+            let Some(urls) = urls.to_str() else {
+                warn!("Failed to parse TRAP_URLS_PER_HOST to string slice, defaulting to {DEFAULT_TRAP_URLS_PER_HOST}...");
+
+                return DEFAULT_TRAP_URLS_PER_HOST;
+            };
+
+            match urls.parse::<usize>() {
+                Ok(urls) => urls,
+                Err(why) => {
+                    warn!("TRAP_URLS_PER_HOST isn't a valid number, defaulting to {DEFAULT_TRAP_URLS_PER_HOST}... (Error: {why})");
+
+                    DEFAULT_TRAP_URLS_PER_HOST
+                }
+            }
+        },
+    );
+
+    (urls != 0).then_some(urls)
+}
+
+/// Get the number of path segments, above which a URL is in a spider trap.
+///
+/// # Returns
+///
+/// * The maximum path depth of URLs outside of spider traps.
+///
+/// # Notes
+///
+/// * If the `TRAP_PATH_DEPTH` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_TRAP_PATH_DEPTH`.
+#[must_use]
+pub fn get_trap_path_depth() -> usize {
+    std::env::var_os("TRAP_PATH_DEPTH").map_or_else(
+        || DEFAULT_TRAP_PATH_DEPTH,
+        |depth| {
+            let Some(depth) = depth.to_str() else {
+                warn!("Failed to parse TRAP_PATH_DEPTH to string slice, defaulting to {DEFAULT_TRAP_PATH_DEPTH}...");
+
+                return DEFAULT_TRAP_PATH_DEPTH;
+            };
+
+            match depth.parse::<usize>() {
+                Ok(depth) => depth,
+                Err(why) => {
+                    warn!("TRAP_PATH_DEPTH isn't a valid number, defaulting to {DEFAULT_TRAP_PATH_DEPTH}... (Error: {why})");
+
+                    DEFAULT_TRAP_PATH_DEPTH
+                }
+            }
+        },
+    )
+}
+
+/// Get the number of query parameters, above which a URL is in a spider trap.
+///
+/// # Returns
+///
+/// * The maximum number of query parameters of URLs outside of spider traps.
+///
+/// # Notes
+///
+/// * If the `TRAP_QUERY_PARAMETERS` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_TRAP_QUERY_PARAMETERS`.
+#[must_use]
+pub fn get_trap_query_parameters() -> usize {
+    std::env::var_os("TRAP_QUERY_PARAMETERS").map_or_else(
+        || DEFAULT_TRAP_QUERY_PARAMETERS,
+        |parameters| {
+            let Some(parameters) = parameters.to_str() else {
+                warn!("Failed to parse TRAP_QUERY_PARAMETERS to string slice, defaulting to {DEFAULT_TRAP_QUERY_PARAMETERS}...");
+
+                return DEFAULT_TRAP_QUERY_PARAMETERS;
+            };
+
+            match parameters.parse::<usize>() {
+                Ok(parameters) => parameters,
+                Err(why) => {
+                    warn!("TRAP_QUERY_PARAMETERS isn't a valid number, defaulting to {DEFAULT_TRAP_QUERY_PARAMETERS}... (Error: {why})");
+
+                    DEFAULT_TRAP_QUERY_PARAMETERS
+                }
+            }
+        },
+    )
+}
+
+/// Get the maximum number of pages fetched from each host per day, so one large site can't take up the whole crawl.
+///
+/// # Returns
+///
+/// * `Some(u64)` - The maximum number of pages fetched from a host per UTC day.
+/// * `None` - If the pages fetched from a host aren't limited.
+///
+/// # Notes
+///
+/// * If the `HOST_DAILY_BUDGET` environment variable isn't set, or is `0`, the pages aren't limited.
+#[must_use]
+pub fn get_host_daily_budget() -> Option<u64> {
+    let budget = std::env::var_os("HOST_DAILY_BUDGET").map_or(0, |budget| {
+        let Some(budget) = budget.to_str() else {
+            warn!("Failed to parse HOST_DAILY_BUDGET to string slice, not limiting the pages...");
+
+            return 0;
+        };
+
+        match budget.parse::<u64>() {
+            Ok(budget) => budget,
+            Err(why) => {
+                warn!("HOST_DAILY_BUDGET isn't a valid number, not limiting the pages... (Error: {why})");
+
+                0
+            }
+        }
+    });
+
+    (budget > 0).then_some(budget)
+}
+
+/// Get the weight of the authority of a domain in the priority of its queued URLs.
+///
+/// # Returns
+///
+/// * The authority weight, `0.0` or above.
+///
+/// # Notes
+///
+/// * If the `FRONTIER_AUTHORITY_WEIGHT` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_FRONTIER_AUTHORITY_WEIGHT`.
+/// * A value of `0` queues URLs by their depth alone.
+#[must_use]
+pub fn get_frontier_authority_weight() -> f64 {
+    std::env::var_os("FRONTIER_AUTHORITY_WEIGHT").map_or_else(
+        || DEFAULT_FRONTIER_AUTHORITY_WEIGHT,
+        |weight| {
+            let Some(weight) = weight.to_str() else {
+                warn!("Failed to parse FRONTIER_AUTHORITY_WEIGHT to string slice, defaulting to {DEFAULT_FRONTIER_AUTHORITY_WEIGHT}...");
+
+                return DEFAULT_FRONTIER_AUTHORITY_WEIGHT;
+            };
+
+            match weight.parse::<f64>() {
+                Ok(weight) if weight.is_finite() && weight >= 0.0 => weight,
+                Ok(_) => {
+                    warn!("FRONTIER_AUTHORITY_WEIGHT must be a finite number of 0 or above, defaulting to {DEFAULT_FRONTIER_AUTHORITY_WEIGHT}...");
+
+                    DEFAULT_FRONTIER_AUTHORITY_WEIGHT
+                }
+                Err(why) => {
+                    warn!("FRONTIER_AUTHORITY_WEIGHT isn't a valid number, defaulting to {DEFAULT_FRONTIER_AUTHORITY_WEIGHT}... (Error: {why})");
+
+                    DEFAULT_FRONTIER_AUTHORITY_WEIGHT
+                }
+            }
+        },
+    )
+}
@@ -1,5 +1,6 @@
 use serde_yaml::Value;
 
+use std::collections::HashMap;
 use std::fs::File;
 use std::io::Read;
 use std::path::Path;
@@ -13,6 +14,51 @@ use serde::Deserialize;
 /// 1 MB as bytes.
 const MAX_BYTES_TO_READ: u64 = 1_024_000;
 
+/// The weight of a seed URL that doesn't have one.
+pub const DEFAULT_SEED_WEIGHT: f64 = 1.0;
+
+/// A seed URL.
+///
+/// # Fields
+///
+/// * `url`: The URL.
+/// * `weight`: How often the URL is picked relative to the other seed URLs, `DEFAULT_SEED_WEIGHT` if it has none.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Seed {
+    pub url: Url,
+    pub weight: f64,
+}
+
+/// A seed URL as it's written in a file, either just the URL or the URL and its weight.
+#[derive(Deserialize)]
+#[serde(untagged)]
+enum SeedEntry {
+    Url(String),
+    Weighted { url: String, weight: f64 },
+}
+
+impl SeedEntry {
+    /// Gets the URL and weight of the entry.
+    ///
+    /// # Returns
+    ///
+    /// * `(String, f64)` - The URL, and its weight if it's positive, otherwise `DEFAULT_SEED_WEIGHT`.
+    fn into_weighted(self) -> (String, f64) {
+        match self {
+            Self::Url(url) => (url, DEFAULT_SEED_WEIGHT),
+            Self::Weighted { url, weight } => {
+                let weight = if weight.is_finite() && weight > 0.0 {
+                    weight
+                } else {
+                    DEFAULT_SEED_WEIGHT
+                };
+
+                (url, weight)
+            }
+        }
+    }
+}
+
 /// Reads data from a file.
 ///
 /// # Arguments
@@ -22,14 +68,11 @@ const MAX_BYTES_TO_READ: u64 = 1_024_000;
 ///
 /// # Returns
 ///
-/// * `Result<Option<Vec<String>>, std::io::Error>` - The data.
-fn read_data_from_file<T, F>(
-    file_path: T,
-    strategy: F,
-) -> Result<Option<Vec<String>>, std::io::Error>
+/// * `Result<Option<Vec<D>>, std::io::Error>` - The data.
+fn read_data_from_file<D, T, F>(file_path: T, strategy: F) -> Result<Option<Vec<D>>, std::io::Error>
 where
     T: AsRef<Path>,
-    F: Fn(&str) -> Option<Vec<String>>,
+    F: Fn(&str) -> Option<Vec<D>>,
 {
     let file = File::open(file_path)?;
     let mut content = String::new();
@@ -60,22 +103,22 @@ where
 /// * `niche_or_specialized_websites`: A list of niche or specialized websites.
 #[derive(Deserialize)]
 struct SeedURLs {
-    search_engines: Option<Vec<String>>,
-    news_websites: Option<Vec<String>>,
-    social_media_platforms: Option<Vec<String>>,
-    academic_and_research_databases: Option<Vec<String>>,
-    e_commerce_websites: Option<Vec<String>>,
-    government_websites: Option<Vec<String>>,
-    blogs_and_personal_websites: Option<Vec<String>>,
-    reference_websites: Option<Vec<String>>,
-    technology_news_and_forums: Option<Vec<String>>,
-    educational_institutions: Option<Vec<String>>,
-    open_data_repositories: Option<Vec<String>>,
-    video_sharing_platforms: Option<Vec<String>>,
-    forums_and_community_sites: Option<Vec<String>>,
-    health_and_medical_websites: Option<Vec<String>>,
-    local_and_regional_news: Option<Vec<String>>,
-    niche_or_specialized_websites: Option<Vec<String>>,
+    search_engines: Option<Vec<SeedEntry>>,
+    news_websites: Option<Vec<SeedEntry>>,
+    social_media_platforms: Option<Vec<SeedEntry>>,
+    academic_and_research_databases: Option<Vec<SeedEntry>>,
+    e_commerce_websites: Option<Vec<SeedEntry>>,
+    government_websites: Option<Vec<SeedEntry>>,
+    blogs_and_personal_websites: Option<Vec<SeedEntry>>,
+    reference_websites: Option<Vec<SeedEntry>>,
+    technology_news_and_forums: Option<Vec<SeedEntry>>,
+    educational_institutions: Option<Vec<SeedEntry>>,
+    open_data_repositories: Option<Vec<SeedEntry>>,
+    video_sharing_platforms: Option<Vec<SeedEntry>>,
+    forums_and_community_sites: Option<Vec<SeedEntry>>,
+    health_and_medical_websites: Option<Vec<SeedEntry>>,
+    local_and_regional_news: Option<Vec<SeedEntry>>,
+    niche_or_specialized_websites: Option<Vec<SeedEntry>>,
 }
 
 /// A list of stop words.
@@ -89,19 +132,23 @@ struct StopWords {
 }
 
 trait SeedUrlStrategy {
-    fn read_seed_urls(&self, content: &str) -> Option<Vec<String>>;
+    fn read_seed_urls(&self, content: &str) -> Option<Vec<(String, f64)>>;
 }
 
 trait StopWordsStrategy {
     fn read_stop_words(&self, content: &str) -> Option<Vec<String>>;
 }
 
+trait AuthorityStrategy {
+    fn read_authorities(&self, content: &str) -> Option<Vec<(String, f64)>>;
+}
+
 struct JSONStrategy;
 struct YAMLStrategy;
 struct TextStrategy;
 
 impl SeedUrlStrategy for JSONStrategy {
-    fn read_seed_urls(&self, content: &str) -> Option<Vec<String>> {
+    fn read_seed_urls(&self, content: &str) -> Option<Vec<(String, f64)>> {
         let seed_urls: SeedURLs = serde_json::from_str(content).ok()?;
         let all_urls = vec![
             seed_urls.search_engines,
@@ -122,20 +169,25 @@ impl SeedUrlStrategy for JSONStrategy {
             seed_urls.niche_or_specialized_websites,
         ];
 
-        let result: Vec<String> = all_urls.into_iter().flatten().flatten().collect();
+        let result = all_urls
+            .into_iter()
+            .flatten()
+            .flatten()
+            .map(SeedEntry::into_weighted)
+            .collect();
 
         Some(result)
     }
 }
 
 impl SeedUrlStrategy for YAMLStrategy {
-    fn read_seed_urls(&self, content: &str) -> Option<Vec<String>> {
+    fn read_seed_urls(&self, content: &str) -> Option<Vec<(String, f64)>> {
         let seed_urls: Value = serde_yaml::from_str(content).ok()?;
         if let Value::Sequence(urls) = seed_urls {
             let result = urls
-                .iter()
-                .filter_map(|url| url.as_str())
-                .map(std::string::ToString::to_string)
+                .into_iter()
+                .filter_map(|url| serde_yaml::from_value::<SeedEntry>(url).ok())
+                .map(SeedEntry::into_weighted)
                 .collect();
 
             Some(result)
@@ -146,10 +198,20 @@ impl SeedUrlStrategy for YAMLStrategy {
 }
 
 impl SeedUrlStrategy for TextStrategy {
-    fn read_seed_urls(&self, content: &str) -> Option<Vec<String>> {
+    fn read_seed_urls(&self, content: &str) -> Option<Vec<(String, f64)>> {
+        // Each line is a URL, optionally followed by its weight.
         let result = content
             .lines()
-            .map(std::string::ToString::to_string)
+            .filter_map(|line| {
+                let mut parts = line.split_whitespace();
+                let url = parts.next()?.to_string();
+                let entry = match parts.next().map(str::parse::<f64>) {
+                    Some(Ok(weight)) => SeedEntry::Weighted { url, weight },
+                    _ => SeedEntry::Url(url),
+                };
+
+                Some(entry.into_weighted())
+            })
             .collect();
 
         Some(result)
@@ -158,6 +220,11 @@ impl SeedUrlStrategy for TextStrategy {
 
 impl StopWordsStrategy for JSONStrategy {
     fn read_stop_words(&self, content: &str) -> Option<Vec<String>> {
+        // Accept both a plain list of words, and an object with a list of words.
+        if let Ok(words) = serde_json::from_str::<Vec<String>>(content) {
+            return Some(words);
+        }
+
         let stop_words: StopWords = serde_json::from_str(content).ok()?;
         let result = stop_words.words?;
 
@@ -193,6 +260,40 @@ impl StopWordsStrategy for TextStrategy {
     }
 }
 
+impl AuthorityStrategy for JSONStrategy {
+    fn read_authorities(&self, content: &str) -> Option<Vec<(String, f64)>> {
+        let authorities: HashMap<String, f64> = serde_json::from_str(content).ok()?;
+
+        Some(authorities.into_iter().collect())
+    }
+}
+
+impl AuthorityStrategy for YAMLStrategy {
+    fn read_authorities(&self, content: &str) -> Option<Vec<(String, f64)>> {
+        let authorities: HashMap<String, f64> = serde_yaml::from_str(content).ok()?;
+
+        Some(authorities.into_iter().collect())
+    }
+}
+
+impl AuthorityStrategy for TextStrategy {
+    fn read_authorities(&self, content: &str) -> Option<Vec<(String, f64)>> {
+        // Each line is a domain, followed by its score.
+        let result = content
+            .lines()
+            .filter_map(|line| {
+                let mut parts = line.split_whitespace();
+                let domain = parts.next()?.to_string();
+                let score = parts.next()?.parse::<f64>().ok()?;
+
+                Some((domain, score))
+            })
+            .collect();
+
+        Some(result)
+    }
+}
+
 struct SeedURLReader<'a> {
     strategy: &'a dyn SeedUrlStrategy,
 }
@@ -202,7 +303,7 @@ impl<'a> SeedURLReader<'a> {
         SeedURLReader { strategy }
     }
 
-    fn read_seed_urls_from_file<T>(&self, file_path: T) -> Result<Option<Vec<Url>>, std::io::Error>
+    fn read_seed_urls_from_file<T>(&self, file_path: T) -> Result<Option<Vec<Seed>>, std::io::Error>
     where
         T: AsRef<Path>,
     {
@@ -210,7 +311,9 @@ impl<'a> SeedURLReader<'a> {
             |urls| {
                 urls.map(|urls| {
                     urls.into_iter()
-                        .filter_map(|url| Url::from_str(&url).ok())
+                        .filter_map(|(url, weight)| {
+                            Url::from_str(&url).ok().map(|url| Seed { url, weight })
+                        })
                         .collect()
                 })
             },
@@ -243,9 +346,12 @@ impl<'a> StopWordsReader<'a> {
 /// The file is specified by the `SEED_URLS` environment variable and can be of many file types,
 /// but will mostly be denoted as `JSON`.
 ///
+/// Each seed URL can have a weight, written as `{ "url": "...", "weight": 2.0 }` in `JSON` and `YAML`,
+/// or after the URL on the same line in text files.
+///
 /// # Returns
 ///
-/// * `Result<Vec<String>, Error>` - The seed URLs.
+/// * `Result<Vec<Seed>, Error>` - The seed URLs, in the order they're listed.
 ///
 /// # Errors
 ///
@@ -261,7 +367,7 @@ impl<'a> StopWordsReader<'a> {
 /// * If `SEED_URLS` is not set.
 /// * If `SEED_URLS` is not valid UTF-8.
 #[allow(clippy::expect_used)]
-pub fn fetch_seed_urls() -> Result<Vec<Url>, Error> {
+pub fn fetch_seed_urls() -> Result<Vec<Seed>, Error> {
     // Load the file path from the environment variable.
     let file_path = std::env::var_os("SEED_URLS")
         .expect("SEED_URLS must be set!")
@@ -301,41 +407,42 @@ pub fn fetch_seed_urls() -> Result<Vec<Url>, Error> {
     )
 }
 
-/// Fetch all the stop words from the provided file.
+/// Fetch a list of words from the file named by an environment variable.
+///
+/// The file can be of many file types, but will mostly be denoted as `JSON`.
 ///
-/// The file is specified by the `STOP_WORDS` environment variable and can be of many file types,
-/// but will mostly be denoted as `text`.
+/// # Arguments
+///
+/// * `variable`: The environment variable holding the path to the file, e.g. `STOP_WORDS`.
 ///
 /// # Returns
 ///
-/// * `Result<Vec<String>, Error>` - The stop words.
+/// * `Ok(Some(Vec<String>))` - The words.
+/// * `Ok(None)` - If the environment variable isn't set.
+/// * `Err(Error)` - If the words could not be read.
 ///
 /// # Errors
 ///
+/// * If the environment variable is not valid UTF-8.
 /// * If the file extension is invalid.
 /// * If the file extension is not supported.
 /// * If the file cannot be read.
 /// * If the file cannot be parsed.
 /// * If the file is not valid UTF-8.
 /// * If the file is not a valid JSON, YAML, or text file.
-///
-/// # Panics
-///
-/// * If `SEED_URLS` is not set.
-/// * If `SEED_URLS` is not valid UTF-8.
-#[allow(clippy::expect_used)]
-pub fn fetch_stop_words() -> Result<Vec<String>, Error> {
+pub fn fetch_words(variable: &str) -> Result<Option<Vec<String>>, Error> {
     // Load the file path from the environment variable.
-    let file_path = std::env::var_os("STOP_WORDS")
-        .expect("STOP_WORDS must be set!")
-        .to_str()
-        .expect("STOP_WORDS must be valid UTF-8!")
-        .to_string();
+    let Some(file_path) = std::env::var_os(variable) else {
+        return Ok(None);
+    };
+    let Some(file_path) = file_path.to_str() else {
+        return Err(Error::Internal(format!("{variable} must be valid UTF-8!")));
+    };
 
-    info!("Loading stop words from {file_path}...");
+    info!("Loading {variable} from {file_path}...");
 
     // Define the reader.
-    let path = Path::new(&file_path);
+    let path = Path::new(file_path);
     let Some(extension) = path.extension() else {
         return Err(Error::Internal(
             "Invalid file extension, no reader implemented for \"\"!".into(),
@@ -357,9 +464,75 @@ pub fn fetch_stop_words() -> Result<Vec<String>, Error> {
         }
     };
 
-    // Read the stop words from the file.
+    // Read the words from the file.
     (reader.read_stop_words_from_file(path)?).map_or_else(
-        || Err(Error::Internal("Failed to read stop words!".into())),
-        Ok,
+        || Err(Error::Internal(format!("Failed to read {variable}!"))),
+        |words| Ok(Some(words)),
     )
 }
+
+/// Fetch the domain authorities operators seeded from the provided file.
+///
+/// The file is specified by the `DOMAIN_AUTHORITY` environment variable, and maps each domain to its score,
+/// like `{ "example.com": 0.9 }` in `JSON` and `YAML`, or `example.com 0.9` on each line of text files.
+///
+/// # Returns
+///
+/// * `Ok(Some(Vec<(String, f64)>))` - The domains and their scores, clamped between `0` and `1`.
+/// * `Ok(None)` - If `DOMAIN_AUTHORITY` isn't set.
+/// * `Err(Error)` - If the domain authorities could not be read.
+///
+/// # Errors
+///
+/// * If `DOMAIN_AUTHORITY` is not valid UTF-8.
+/// * If the file extension is invalid.
+/// * If the file extension is not supported.
+/// * If the file cannot be read.
+/// * If the file is not a valid JSON, YAML, or text file.
+pub fn fetch_domain_authorities() -> Result<Option<Vec<(String, f64)>>, Error> {
+    let Some(file_path) = std::env::var_os("DOMAIN_AUTHORITY") else {
+        return Ok(None);
+    };
+    let Some(file_path) = file_path.to_str() else {
+        return Err(Error::Internal(
+            "DOMAIN_AUTHORITY must be valid UTF-8!".into(),
+        ));
+    };
+
+    info!("Loading domain authorities from {file_path}...");
+
+    // Define the reader.
+    let path = Path::new(file_path);
+    let strategy: &dyn AuthorityStrategy =
+        match path.extension().and_then(|extension| extension.to_str()) {
+            Some("json") => &JSONStrategy,
+            Some("yaml" | "yml") => &YAMLStrategy,
+            Some("txt") => &TextStrategy,
+            extension => {
+                return Err(Error::Internal(format!(
+                    "Invalid file extension, no reader implemented for \".{}\"!",
+                    extension.unwrap_or_default()
+                )));
+            }
+        };
+
+    // Read the domain authorities from the file.
+    let Some(authorities) =
+        read_data_from_file(path, |content| strategy.read_authorities(content))?
+    else {
+        return Err(Error::Internal("Failed to read domain authorities!".into()));
+    };
+
+    Ok(Some(
+        authorities
+            .into_iter()
+            .filter(|(_, score)| score.is_finite())
+            .map(|(domain, score)| {
+                (
+                    domain.trim_end_matches('.').to_lowercase(),
+                    score.clamp(0.0, 1.0),
+                )
+            })
+            .collect(),
+    ))
+}
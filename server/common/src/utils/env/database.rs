@@ -0,0 +1,242 @@
+use log::warn;
+use std::env;
+use std::path::PathBuf;
+use std::time::Duration;
+
+/// The default number of times to retry a query that failed because the database is unavailable.
+const DEFAULT_RETRIES: u32 = 3;
+
+/// The default pause before the first retry, doubled on each retry after it.
+const DEFAULT_RETRY_BACKOFF: Duration = Duration::from_millis(100);
+
+/// The default number of consecutive failures before the circuit breaker opens.
+const DEFAULT_CIRCUIT_BREAKER_THRESHOLD: u32 = 5;
+
+/// The default time the circuit breaker stays open before letting a query through again.
+const DEFAULT_CIRCUIT_BREAKER_COOLDOWN: Duration = Duration::from_secs(30);
+
+/// The default zstd level the content of pages is compressed with.
+const DEFAULT_CONTENT_COMPRESSION_LEVEL: i32 = 3;
+
+/// Gets the URLs of the databases to search.
+///
+/// # Returns
+///
+/// * `Vec<String>` - The URLs of the database shards, or just `DATABASE_URL` if there are no shards.
+///
+/// # Panics
+///
+/// * If `DATABASE_SHARDS` is not valid UTF-8.
+/// * If `DATABASE_SHARDS` isn't set, and `DATABASE_URL` is not set or not valid UTF-8.
+///
+/// # Notes
+///
+/// * `DATABASE_SHARDS` is a comma separated list of database URLs.
+#[must_use]
+#[allow(clippy::expect_used)]
+pub fn get_database_urls() -> Vec<String> {
+    let shards = env::var_os("DATABASE_SHARDS")
+        .map(|shards| {
+            shards
+                .to_str()
+                .expect("DATABASE_SHARDS must be valid UTF-8!")
+                .split(',')
+                .map(str::trim)
+                .filter(|shard| !shard.is_empty())
+                .map(std::string::ToString::to_string)
+                .collect::<Vec<_>>()
+        })
+        .unwrap_or_default();
+
+    if !shards.is_empty() {
+        return shards;
+    }
+
+    vec![env::var_os("DATABASE_URL")
+        .expect("DATABASE_URL must be set!")
+        .to_str()
+        .expect("DATABASE_URL must be valid UTF-8!")
+        .to_string()]
+}
+
+/// Get the number of times to retry a query that failed because the database is unavailable.
+///
+/// # Returns
+///
+/// * The number of times to retry a query that failed because the database is unavailable.
+///
+/// # Notes
+///
+/// * If the `DATABASE_RETRIES` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_RETRIES`.
+#[must_use]
+pub fn get_retries() -> u32 {
+    env::var_os("DATABASE_RETRIES").map_or_else(
+        || DEFAULT_RETRIES,
+        |retries| {
+            let Some(retries) = retries.to_str() else {
+                warn!("Failed to parse DATABASE_RETRIES to string slice, defaulting to {DEFAULT_RETRIES}...");
+
+                return DEFAULT_RETRIES;
+            };
+
+            match retries.parse::<u32>() {
+                Ok(retries) => retries,
+                Err(why) => {
+                    warn!("DATABASE_RETRIES isn't a valid number, defaulting to {DEFAULT_RETRIES}... (Error: {why})");
+
+                    DEFAULT_RETRIES
+                }
+            }
+        },
+    )
+}
+
+/// Get the pause before the first retry of a query, doubled on each retry after it.
+///
+/// # Returns
+///
+/// * The pause before the first retry of a query in milliseconds.
+///
+/// # Notes
+///
+/// * If the `DATABASE_RETRY_BACKOFF` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_RETRY_BACKOFF`.
+#[must_use]
+pub fn get_retry_backoff() -> Duration {
+    env::var_os("DATABASE_RETRY_BACKOFF").map_or_else(
+        || DEFAULT_RETRY_BACKOFF,
+        |backoff| {
+            let Some(backoff) = backoff.to_str() else {
+                warn!("Failed to parse DATABASE_RETRY_BACKOFF to string slice, defaulting to {}ms...", DEFAULT_RETRY_BACKOFF.as_millis());
+
+                return DEFAULT_RETRY_BACKOFF;
+            };
+
+            match backoff.parse::<u64>() {
+                Ok(backoff) => Duration::from_millis(backoff),
+                Err(why) => {
+                    warn!("DATABASE_RETRY_BACKOFF isn't a valid number, defaulting to {}ms... (Error: {why})", DEFAULT_RETRY_BACKOFF.as_millis());
+
+                    DEFAULT_RETRY_BACKOFF
+                }
+            }
+        },
+    )
+}
+
+/// Get the number of consecutive failures before the circuit breaker of a database opens.
+///
+/// # Returns
+///
+/// * The number of consecutive failures before the circuit breaker of a database opens.
+///
+/// # Notes
+///
+/// * If the `CIRCUIT_BREAKER_THRESHOLD` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_CIRCUIT_BREAKER_THRESHOLD`.
+#[must_use]
+pub fn get_circuit_breaker_threshold() -> u32 {
+    env::var_os("CIRCUIT_BREAKER_THRESHOLD").map_or_else(
+        || DEFAULT_CIRCUIT_BREAKER_THRESHOLD,
+        |threshold| {
+            let Some(threshold) = threshold.to_str() else {
+                warn!("Failed to parse CIRCUIT_BREAKER_THRESHOLD to string slice, defaulting to {DEFAULT_CIRCUIT_BREAKER_THRESHOLD}...");
+
+                return DEFAULT_CIRCUIT_BREAKER_THRESHOLD;
+            };
+
+            match threshold.parse::<u32>() {
+                Ok(threshold) => threshold.max(1),
+                Err(why) => {
+                    warn!("CIRCUIT_BREAKER_THRESHOLD isn't a valid number, defaulting to {DEFAULT_CIRCUIT_BREAKER_THRESHOLD}... (Error: {why})");
+
+                    DEFAULT_CIRCUIT_BREAKER_THRESHOLD
+                }
+            }
+        },
+    )
+}
+
+/// Get the time the circuit breaker of a database stays open before letting a query through again.
+///
+/// # Returns
+///
+/// * The cooldown of the circuit breaker in seconds.
+///
+/// # Notes
+///
+/// * If the `CIRCUIT_BREAKER_COOLDOWN` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_CIRCUIT_BREAKER_COOLDOWN`.
+#[must_use]
+pub fn get_circuit_breaker_cooldown() -> Duration {
+    env::var_os("CIRCUIT_BREAKER_COOLDOWN").map_or_else(
+        || DEFAULT_CIRCUIT_BREAKER_COOLDOWN,
+        |cooldown| {
+            let Some(cooldown) = cooldown.to_str() else {
+                warn!("Failed to parse CIRCUIT_BREAKER_COOLDOWN to string slice, defaulting to {}s...", DEFAULT_CIRCUIT_BREAKER_COOLDOWN.as_secs());
+
+                return DEFAULT_CIRCUIT_BREAKER_COOLDOWN;
+            };
+
+            match cooldown.parse::<u64>() {
+                Ok(cooldown) => Duration::from_secs(cooldown),
+                Err(why) => {
+                    warn!("CIRCUIT_BREAKER_COOLDOWN isn't a valid number, defaulting to {}s... (Error: {why})", DEFAULT_CIRCUIT_BREAKER_COOLDOWN.as_secs());
+
+                    DEFAULT_CIRCUIT_BREAKER_COOLDOWN
+                }
+            }
+        },
+    )
+}
+
+/// Get the zstd level the content of pages is compressed with.
+///
+/// # Returns
+///
+/// * `Some(i32)` - The compression level, between `1` and `22`.
+/// * `None` - If compression is disabled, and the content is stored as plain text.
+///
+/// # Notes
+///
+/// * If the `CONTENT_COMPRESSION_LEVEL` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_CONTENT_COMPRESSION_LEVEL`.
+/// * Setting `CONTENT_COMPRESSION_LEVEL` to `0` disables compression, and higher levels are clamped to `22`.
+#[must_use]
+pub fn get_content_compression_level() -> Option<i32> {
+    let level = env::var_os("CONTENT_COMPRESSION_LEVEL").map_or_else(
+        || DEFAULT_CONTENT_COMPRESSION_LEVEL,
+        |level| {
+            let Some(level) = level.to_str() else {
+                warn!("Failed to parse CONTENT_COMPRESSION_LEVEL to string slice, defaulting to {DEFAULT_CONTENT_COMPRESSION_LEVEL}...");
+
+                return DEFAULT_CONTENT_COMPRESSION_LEVEL;
+            };
+
+            match level.parse::<u32>() {
+                Ok(level) => i32::try_from(level.min(22)).unwrap_or(22),
+                Err(why) => {
+                    warn!("CONTENT_COMPRESSION_LEVEL isn't a valid number, defaulting to {DEFAULT_CONTENT_COMPRESSION_LEVEL}... (Error: {why})");
+
+                    DEFAULT_CONTENT_COMPRESSION_LEVEL
+                }
+            }
+        },
+    );
+
+    (level > 0).then_some(level)
+}
+
+/// Get the path of the shared dictionary the content of pages is compressed with.
+///
+/// # Returns
+///
+/// * `Some(PathBuf)` - The path of the dictionary, trained with the `train-content-dictionary` command.
+/// * `None` - If the `CONTENT_DICTIONARY` environment variable isn't set, and content is compressed without one.
+#[must_use]
+pub fn get_content_dictionary() -> Option<PathBuf> {
+    env::var_os("CONTENT_DICTIONARY")
+        .filter(|path| !path.is_empty())
+        .map(PathBuf::from)
+}
@@ -1,6 +1,8 @@
 pub mod crawler;
 pub mod data;
+pub mod database;
 pub mod ranker;
 pub mod scraper;
+pub mod search;
 pub mod web;
 pub mod workers;
@@ -6,6 +6,36 @@ const DEFAULT_RANKER_CONSTANT: f64 = 0.7;
 /// The default rating factor.
 const DEFAULT_RATING_FACTOR: f64 = 0.4;
 
+/// The default maximum factor a query term can be boosted by.
+const DEFAULT_MAXIMUM_TERM_BOOST: f64 = 10.0;
+
+/// The default weight of the click-through rate of a page, `0.0` disables click ranking.
+const DEFAULT_CLICK_WEIGHT: f64 = 0.0;
+
+/// The default weight of the proximity of the query terms on a page, `0.0` disables proximity ranking.
+const DEFAULT_PROXIMITY_WEIGHT: f64 = 1.0;
+
+/// The default boost of pages in the most preferred language of a client, `0.0` disables language ranking.
+const DEFAULT_LANGUAGE_WEIGHT: f64 = 1.0;
+
+/// The default weight of the authority of the domain of a page, `0.0` disables authority ranking.
+const DEFAULT_AUTHORITY_WEIGHT: f64 = 0.0;
+
+/// The default share of the rank taken from pages whose content changes between fetches, `0.0` disables the penalty.
+const DEFAULT_UNSTABLE_PENALTY: f64 = 0.5;
+
+/// The default weight of matches in the title of a page.
+const DEFAULT_TITLE_WEIGHT: f64 = 3.0;
+
+/// The default weight of matches in the headings of a page.
+const DEFAULT_HEADING_WEIGHT: f64 = 2.0;
+
+/// The default weight of matches in the body of a page.
+const DEFAULT_BODY_WEIGHT: f64 = 1.0;
+
+/// The default weight of matches in the alt text and captions of the images on a page.
+const DEFAULT_IMAGE_WEIGHT: f64 = 0.5;
+
 /// Get the ranker constant used to calculate the rank of a page.
 ///
 /// # Returns
@@ -71,3 +101,408 @@ pub fn get_rating_factor() -> f64 {
         },
     )
 }
+
+/// Get the maximum factor a query term can be boosted by.
+///
+/// # Returns
+///
+/// * The maximum term boost.
+///
+/// # Notes
+///
+/// * If the `MAXIMUM_TERM_BOOST` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_MAXIMUM_TERM_BOOST`.
+///
+/// # Panics
+///
+/// * If `MAXIMUM_TERM_BOOST` is not valid UTF-8.
+/// * If `MAXIMUM_TERM_BOOST` is not a valid, finite number, since `inf` would lift the cap and `NaN` would poison the ranks.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_maximum_term_boost() -> f64 {
+    std::env::var_os("MAXIMUM_TERM_BOOST").map_or_else(
+        || DEFAULT_MAXIMUM_TERM_BOOST,
+        |maximum_term_boost| {
+            let maximum_term_boost = maximum_term_boost
+                .to_str()
+                .expect("MAXIMUM_TERM_BOOST must be valid UTF-8!")
+                .parse::<f64>()
+                .ok()
+                .filter(|maximum_term_boost| maximum_term_boost.is_finite())
+                .expect("MAXIMUM_TERM_BOOST must be a valid number!");
+            if maximum_term_boost <= 0.0 {
+                warn!("MAXIMUM_TERM_BOOST must be positive, got {maximum_term_boost}, defaulting to {DEFAULT_MAXIMUM_TERM_BOOST}...");
+
+                return DEFAULT_MAXIMUM_TERM_BOOST;
+            }
+
+            maximum_term_boost
+        },
+    )
+}
+
+/// Get the weight of the click-through rate of a page when ranking it.
+///
+/// # Returns
+///
+/// * The click weight.
+///
+/// # Notes
+///
+/// * If the `CLICK_WEIGHT` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_CLICK_WEIGHT`, which disables click ranking.
+#[must_use]
+pub fn get_click_weight() -> f64 {
+    std::env::var_os("CLICK_WEIGHT").map_or_else(
+        || DEFAULT_CLICK_WEIGHT,
+        |click_weight| {
+            let Some(click_weight) = click_weight.to_str() else {
+                warn!("Failed to parse CLICK_WEIGHT to string slice, defaulting to {DEFAULT_CLICK_WEIGHT}...",);
+
+                return DEFAULT_CLICK_WEIGHT;
+            };
+
+            match click_weight.parse::<f64>() {
+                Ok(click_weight) if click_weight >= 0.0 => click_weight,
+                Ok(click_weight) => {
+                    warn!("CLICK_WEIGHT can't be negative, got {click_weight}, defaulting to {DEFAULT_CLICK_WEIGHT}...");
+
+                    DEFAULT_CLICK_WEIGHT
+                }
+                Err(why) => {
+                    warn!("CLICK_WEIGHT isn't a valid number, defaulting to {DEFAULT_CLICK_WEIGHT}... (Error: {why})");
+
+                    DEFAULT_CLICK_WEIGHT
+                }
+            }
+        },
+    )
+}
+
+/// Get the weight of the proximity of the query terms on a page when ranking it.
+///
+/// # Returns
+///
+/// * The proximity weight.
+///
+/// # Notes
+///
+/// * If the `PROXIMITY_WEIGHT` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_PROXIMITY_WEIGHT`, which at most doubles the relevance of a page.
+#[must_use]
+pub fn get_proximity_weight() -> f64 {
+    std::env::var_os("PROXIMITY_WEIGHT").map_or_else(
+        || DEFAULT_PROXIMITY_WEIGHT,
+        |proximity_weight| {
+            let Some(proximity_weight) = proximity_weight.to_str() else {
+                warn!("Failed to parse PROXIMITY_WEIGHT to string slice, defaulting to {DEFAULT_PROXIMITY_WEIGHT}...",);
+
+                return DEFAULT_PROXIMITY_WEIGHT;
+            };
+
+            match proximity_weight.parse::<f64>() {
+                Ok(proximity_weight) if proximity_weight >= 0.0 => proximity_weight,
+                Ok(proximity_weight) => {
+                    warn!("PROXIMITY_WEIGHT can't be negative, got {proximity_weight}, defaulting to {DEFAULT_PROXIMITY_WEIGHT}...");
+
+                    DEFAULT_PROXIMITY_WEIGHT
+                }
+                Err(why) => {
+                    warn!("PROXIMITY_WEIGHT isn't a valid number, defaulting to {DEFAULT_PROXIMITY_WEIGHT}... (Error: {why})");
+
+                    DEFAULT_PROXIMITY_WEIGHT
+                }
+            }
+        },
+    )
+}
+
+/// Get the boost of pages in the most preferred language of a client when ranking them.
+///
+/// # Returns
+///
+/// * The language weight, later preferred languages get a smaller boost.
+///
+/// # Notes
+///
+/// * If the `LANGUAGE_WEIGHT` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_LANGUAGE_WEIGHT`, which doubles the rank of pages in the most preferred language.
+#[must_use]
+pub fn get_language_weight() -> f64 {
+    std::env::var_os("LANGUAGE_WEIGHT").map_or_else(
+        || DEFAULT_LANGUAGE_WEIGHT,
+        |language_weight| {
+            let Some(language_weight) = language_weight.to_str() else {
+                warn!("Failed to parse LANGUAGE_WEIGHT to string slice, defaulting to {DEFAULT_LANGUAGE_WEIGHT}...",);
+
+                return DEFAULT_LANGUAGE_WEIGHT;
+            };
+
+            match language_weight.parse::<f64>() {
+                Ok(language_weight) if language_weight >= 0.0 => language_weight,
+                Ok(language_weight) => {
+                    warn!("LANGUAGE_WEIGHT can't be negative, got {language_weight}, defaulting to {DEFAULT_LANGUAGE_WEIGHT}...");
+
+                    DEFAULT_LANGUAGE_WEIGHT
+                }
+                Err(why) => {
+                    warn!("LANGUAGE_WEIGHT isn't a valid number, defaulting to {DEFAULT_LANGUAGE_WEIGHT}... (Error: {why})");
+
+                    DEFAULT_LANGUAGE_WEIGHT
+                }
+            }
+        },
+    )
+}
+
+/// Get the weight of the authority of the domain of a page when ranking it.
+///
+/// # Returns
+///
+/// * The authority weight.
+///
+/// # Notes
+///
+/// * If the `AUTHORITY_WEIGHT` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_AUTHORITY_WEIGHT`, which disables authority ranking.
+#[must_use]
+pub fn get_authority_weight() -> f64 {
+    std::env::var_os("AUTHORITY_WEIGHT").map_or_else(
+        || DEFAULT_AUTHORITY_WEIGHT,
+        |authority_weight| {
+            let Some(authority_weight) = authority_weight.to_str() else {
+                warn!("Failed to parse AUTHORITY_WEIGHT to string slice, defaulting to {DEFAULT_AUTHORITY_WEIGHT}...",);
+
+                return DEFAULT_AUTHORITY_WEIGHT;
+            };
+
+            match authority_weight.parse::<f64>() {
+                Ok(authority_weight) if authority_weight >= 0.0 => authority_weight,
+                Ok(authority_weight) => {
+                    warn!("AUTHORITY_WEIGHT can't be negative, got {authority_weight}, defaulting to {DEFAULT_AUTHORITY_WEIGHT}...");
+
+                    DEFAULT_AUTHORITY_WEIGHT
+                }
+                Err(why) => {
+                    warn!("AUTHORITY_WEIGHT isn't a valid number, defaulting to {DEFAULT_AUTHORITY_WEIGHT}... (Error: {why})");
+
+                    DEFAULT_AUTHORITY_WEIGHT
+                }
+            }
+        },
+    )
+}
+
+/// Get the share of the rank taken from pages whose content changes between fetches.
+///
+/// # Returns
+///
+/// * The unstable penalty, from `0` to `1`.
+///
+/// # Notes
+///
+/// * If the `UNSTABLE_PENALTY` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_UNSTABLE_PENALTY`.
+#[must_use]
+pub fn get_unstable_penalty() -> f64 {
+    std::env::var_os("UNSTABLE_PENALTY").map_or_else(
+        || DEFAULT_UNSTABLE_PENALTY,
+        |unstable_penalty| {
+            let Some(unstable_penalty) = unstable_penalty.to_str() else {
+                warn!("Failed to parse UNSTABLE_PENALTY to string slice, defaulting to {DEFAULT_UNSTABLE_PENALTY}...",);
+
+                return DEFAULT_UNSTABLE_PENALTY;
+            };
+
+            match unstable_penalty.parse::<f64>() {
+                Ok(unstable_penalty) if (0.0..=1.0).contains(&unstable_penalty) => unstable_penalty,
+                Ok(unstable_penalty) => {
+                    warn!("UNSTABLE_PENALTY must be between 0 and 1, got {unstable_penalty}, defaulting to {DEFAULT_UNSTABLE_PENALTY}...");
+
+                    DEFAULT_UNSTABLE_PENALTY
+                }
+                Err(why) => {
+                    warn!("UNSTABLE_PENALTY isn't a valid number, defaulting to {DEFAULT_UNSTABLE_PENALTY}... (Error: {why})");
+
+                    DEFAULT_UNSTABLE_PENALTY
+                }
+            }
+        },
+    )
+}
+
+/// Get the weight of matches in the title of a page when ranking it.
+///
+/// # Returns
+///
+/// * The title weight.
+///
+/// # Notes
+///
+/// * If the `TITLE_WEIGHT` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_TITLE_WEIGHT`, which makes a match in the title worth three in the body.
+#[must_use]
+pub fn get_title_weight() -> f64 {
+    std::env::var_os("TITLE_WEIGHT").map_or_else(
+        || DEFAULT_TITLE_WEIGHT,
+        |title_weight| {
+            let Some(title_weight) = title_weight.to_str() else {
+                warn!("Failed to parse TITLE_WEIGHT to string slice, defaulting to {DEFAULT_TITLE_WEIGHT}...",);
+
+                return DEFAULT_TITLE_WEIGHT;
+            };
+
+            match title_weight.parse::<f64>() {
+                Ok(title_weight) if title_weight >= 0.0 => title_weight,
+                Ok(title_weight) => {
+                    warn!("TITLE_WEIGHT can't be negative, got {title_weight}, defaulting to {DEFAULT_TITLE_WEIGHT}...");
+
+                    DEFAULT_TITLE_WEIGHT
+                }
+                Err(why) => {
+                    warn!("TITLE_WEIGHT isn't a valid number, defaulting to {DEFAULT_TITLE_WEIGHT}... (Error: {why})");
+
+                    DEFAULT_TITLE_WEIGHT
+                }
+            }
+        },
+    )
+}
+
+/// Get the weight of matches in the `h1`, `h2` and `h3` headings of a page when ranking it.
+///
+/// # Returns
+///
+/// * The heading weight.
+///
+/// # Notes
+///
+/// * If the `HEADING_WEIGHT` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_HEADING_WEIGHT`, between the title and body weights, since the words of headings are also in the body.
+#[must_use]
+pub fn get_heading_weight() -> f64 {
+    std::env::var_os("HEADING_WEIGHT").map_or_else(
+        || DEFAULT_HEADING_WEIGHT,
+        |heading_weight| {
+            let Some(heading_weight) = heading_weight.to_str() else {
+                warn!("Failed to parse HEADING_WEIGHT to string slice, defaulting to {DEFAULT_HEADING_WEIGHT}...",);
+
+                return DEFAULT_HEADING_WEIGHT;
+            };
+
+            match heading_weight.parse::<f64>() {
+                Ok(heading_weight) if heading_weight >= 0.0 => heading_weight,
+                Ok(heading_weight) => {
+                    warn!("HEADING_WEIGHT can't be negative, got {heading_weight}, defaulting to {DEFAULT_HEADING_WEIGHT}...");
+
+                    DEFAULT_HEADING_WEIGHT
+                }
+                Err(why) => {
+                    warn!("HEADING_WEIGHT isn't a valid number, defaulting to {DEFAULT_HEADING_WEIGHT}... (Error: {why})");
+
+                    DEFAULT_HEADING_WEIGHT
+                }
+            }
+        },
+    )
+}
+
+/// Get the weight of matches in the body of a page when ranking it.
+///
+/// # Returns
+///
+/// * The body weight.
+///
+/// # Notes
+///
+/// * If the `BODY_WEIGHT` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_BODY_WEIGHT`.
+#[must_use]
+pub fn get_body_weight() -> f64 {
+    std::env::var_os("BODY_WEIGHT").map_or_else(
+        || DEFAULT_BODY_WEIGHT,
+        |body_weight| {
+            let Some(body_weight) = body_weight.to_str() else {
+                warn!("Failed to parse BODY_WEIGHT to string slice, defaulting to {DEFAULT_BODY_WEIGHT}...",);
+
+                return DEFAULT_BODY_WEIGHT;
+            };
+
+            match body_weight.parse::<f64>() {
+                Ok(body_weight) if body_weight >= 0.0 => body_weight,
+                Ok(body_weight) => {
+                    warn!("BODY_WEIGHT can't be negative, got {body_weight}, defaulting to {DEFAULT_BODY_WEIGHT}...");
+
+                    DEFAULT_BODY_WEIGHT
+                }
+                Err(why) => {
+                    warn!("BODY_WEIGHT isn't a valid number, defaulting to {DEFAULT_BODY_WEIGHT}... (Error: {why})");
+
+                    DEFAULT_BODY_WEIGHT
+                }
+            }
+        },
+    )
+}
+
+/// Get the weight of matches in the alt text and captions of the images on a page when ranking it.
+///
+/// # Returns
+///
+/// * The image weight.
+///
+/// # Notes
+///
+/// * If the `IMAGE_WEIGHT` environment variable isn't set, the default value is used.
+/// * The default value is `DEFAULT_IMAGE_WEIGHT`, which makes a match in an image worth half of one in the body, since alt text is often missing or boilerplate.
+#[must_use]
+pub fn get_image_weight() -> f64 {
+    std::env::var_os("IMAGE_WEIGHT").map_or_else(
+        || DEFAULT_IMAGE_WEIGHT,
+        |image_weight| {
+            let Some(image_weight) = image_weight.to_str() else {
+                warn!("Failed to parse IMAGE_WEIGHT to string slice, defaulting to {DEFAULT_IMAGE_WEIGHT}...",);
+
+                return DEFAULT_IMAGE_WEIGHT;
+            };
+
+            match image_weight.parse::<f64>() {
+                Ok(image_weight) if image_weight >= 0.0 => image_weight,
+                Ok(image_weight) => {
+                    warn!("IMAGE_WEIGHT can't be negative, got {image_weight}, defaulting to {DEFAULT_IMAGE_WEIGHT}...");
+
+                    DEFAULT_IMAGE_WEIGHT
+                }
+                Err(why) => {
+                    warn!("IMAGE_WEIGHT isn't a valid number, defaulting to {DEFAULT_IMAGE_WEIGHT}... (Error: {why})");
+
+                    DEFAULT_IMAGE_WEIGHT
+                }
+            }
+        },
+    )
+}
+
+/// Get the ranking variants to experiment with.
+///
+/// # Returns
+///
+/// * `Some(String)` - The ranking variants, if any.
+/// * `None` - If there are no ranking variants, so every search uses the control weights.
+///
+/// # Notes
+///
+/// * The variants are `;` separated, in the format `name:key=value,key=value`.
+/// * The keys are the fields of the weights, like `click_weight` or `title_weight`, any key left out is the same as in the control.
+#[must_use]
+pub fn get_ranking_variants() -> Option<String> {
+    std::env::var_os("RANKING_VARIANTS").and_then(|variants| {
+        let Some(variants) = variants.to_str() else {
+            warn!("Failed to parse RANKING_VARIANTS to string slice, using the control weights only...");
+
+            return None;
+        };
+
+        Some(variants.to_string())
+    })
+}
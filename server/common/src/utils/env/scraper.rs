@@ -1,3 +1,4 @@
+use crate::utils::simhash;
 use const_format::formatcp;
 use log::warn;
 use reqwest::header::HeaderValue;
@@ -25,6 +26,81 @@ const DEFAULT_MINIMUM_WORD_LENGTH: usize = 2;
 /// The default maximum word length.
 const DEFAULT_MAXIMUM_WORD_LENGTH: usize = 128;
 
+/// Whether HTTP/2 is negotiated by default.
+const DEFAULT_HTTP2: bool = true;
+
+/// Whether cookies set by hosts are sent back to them by default.
+const DEFAULT_COOKIES: bool = false;
+
+/// Whether compressed responses are asked for by default.
+const DEFAULT_COMPRESSION: bool = true;
+
+/// Whether only the titles and links of pages are indexed by default.
+const DEFAULT_TITLES_ONLY: bool = false;
+
+/// Whether recrawled pages are only fetched again if they changed by default.
+const DEFAULT_CONDITIONAL_REQUESTS: bool = true;
+
+/// Whether URLs with an unknown extension are checked with a `HEAD` request first by default.
+const DEFAULT_HEAD_PREFLIGHT: bool = false;
+
+/// The default maximum number of redirects followed from a URL.
+const DEFAULT_MAXIMUM_REDIRECTS: usize = 10;
+
+/// The default maximum number of idle connections kept open per host.
+const DEFAULT_IDLE_CONNECTIONS_PER_HOST: usize = 8;
+
+/// The default time an idle connection is kept open.
+const DEFAULT_IDLE_CONNECTION_TIMEOUT: Duration = Duration::from_secs(90);
+
+/// The default interval between TCP keep-alive probes.
+const DEFAULT_TCP_KEEPALIVE: Duration = Duration::from_secs(60);
+
+/// Whether numbers are indexed by default.
+const DEFAULT_INDEX_NUMBERS: bool = true;
+
+/// Whether words are split on punctuation by default.
+const DEFAULT_SPLIT_WORDS: bool = false;
+
+/// The default maximum number of positions stored per word on a page.
+const DEFAULT_MAXIMUM_KEYWORD_POSITIONS: usize = 64;
+
+/// The default maximum size of a downloaded body in bytes.
+const DEFAULT_MAXIMUM_BODY_SIZE: usize = 10_485_760;
+
+/// The default time parsing a document may take before its extraction is aborted.
+const DEFAULT_EXTRACTION_TIMEOUT: Duration = Duration::from_secs(5);
+
+/// The default maximum number of nodes in a parsed document.
+const DEFAULT_MAXIMUM_NODES: usize = 500_000;
+
+/// The default maximum depth of the elements in a parsed document.
+const DEFAULT_MAXIMUM_TREE_DEPTH: usize = 1_024;
+
+/// The default maximum number of distinct links kept from a page.
+const DEFAULT_MAXIMUM_LINKS: usize = 5_000;
+
+/// The default maximum number of bits the simhashes of near-duplicate pages differ in.
+const DEFAULT_NEAR_DUPLICATE_DISTANCE: u32 = 3;
+
+/// The default maximum number of pages walked per pagination template.
+const DEFAULT_MAXIMUM_PAGINATION_PAGES: usize = 100;
+
+/// The default interval between each fetch of the `robots.txt` file of a host.
+const DEFAULT_ROBOTS_REFRESH_INTERVAL: Duration = Duration::from_secs(24 * 60 * 60);
+
+/// The default maximum number of hosts whose `robots.txt` files are cached.
+const DEFAULT_ROBOTS_CACHE_SIZE: usize = 10_000;
+
+/// The default schemes of the links that are followed.
+const DEFAULT_ALLOWED_SCHEMES: [&str; 2] = ["http", "https"];
+
+/// The default media types of the responses that are indexed.
+const DEFAULT_CONTENT_TYPES: [&str; 2] = ["text/html", "application/xhtml+xml"];
+
+/// The default query parameters stripped from URLs, since they only track where a visitor came from.
+const DEFAULT_TRACKING_PARAMETERS: [&str; 4] = ["utm_*", "fbclid", "gclid", "ref"];
+
 /// Gets the HTTP timeout.
 ///
 /// # Returns
@@ -92,15 +168,14 @@ pub fn get_user_agent() -> HeaderValue {
 ///
 /// # Returns
 ///
-/// * `(usize, usize, usize, usize)` - The boundaries, in order: minimum word frequency, maximum word frequency, minimum word length, maximum word length.
+/// * `(usize, usize)` - The boundaries, in order: minimum word frequency, maximum word frequency.
+///
+/// # Notes
+///
+/// * The length of words is bounded by the tokenizer, since it applies to queries as well.
 #[must_use]
-pub fn get_word_boundaries() -> (usize, usize, usize, usize) {
-    (
-        get_minimum_word_frequency(),
-        get_maximum_word_frequency(),
-        get_minimum_word_length(),
-        get_maximum_word_length(),
-    )
+pub fn get_word_boundaries() -> (usize, usize) {
+    (get_minimum_word_frequency(), get_maximum_word_frequency())
 }
 
 /// Gets the maximum depth.
@@ -111,26 +186,38 @@ pub fn get_word_boundaries() -> (usize, usize, usize, usize) {
 ///
 /// # Panics
 ///
-/// * If `MAX_DEPTH` is not valid UTF-8.
-/// * If `MAX_DEPTH` is not a valid number.
+/// * If `MAXIMUM_DEPTH` or `MAX_DEPTH` is not valid UTF-8.
+/// * If `MAXIMUM_DEPTH` or `MAX_DEPTH` is not a valid number.
+///
+/// # Notes
+///
+/// * The deprecated `MAX_DEPTH` is still read if `MAXIMUM_DEPTH` isn't set.
 #[must_use]
 #[allow(clippy::expect_used)]
 pub fn get_max_depth() -> Option<u32> {
-    env::var_os("MAX_DEPTH").map_or_else(
-        || {
-            warn!("MAX_DEPTH is not set! Using default value of {DEFAULT_MAX_DEPTH:?}...",);
+    if let Some(max_depth) = env::var_os("MAXIMUM_DEPTH") {
+        return max_depth
+            .to_str()
+            .expect("MAXIMUM_DEPTH must be valid UTF-8!")
+            .parse::<u32>()
+            .expect("MAXIMUM_DEPTH must be a valid number!")
+            .into();
+    }
 
-            DEFAULT_MAX_DEPTH
-        },
-        |max_depth| {
-            max_depth
-                .to_str()
-                .expect("MAX_DEPTH must be valid UTF-8!")
-                .parse::<u32>()
-                .expect("MAX_DEPTH must be a valid number!")
-                .into()
-        },
-    )
+    if let Some(max_depth) = env::var_os("MAX_DEPTH") {
+        warn!("MAX_DEPTH is deprecated! Use MAXIMUM_DEPTH instead...");
+
+        return max_depth
+            .to_str()
+            .expect("MAX_DEPTH must be valid UTF-8!")
+            .parse::<u32>()
+            .expect("MAX_DEPTH must be a valid number!")
+            .into();
+    }
+
+    warn!("MAXIMUM_DEPTH is not set! Using default value of {DEFAULT_MAX_DEPTH:?}...",);
+
+    DEFAULT_MAX_DEPTH
 }
 
 /// Gets the minimum word frequency.
@@ -189,7 +276,8 @@ fn get_maximum_word_frequency() -> usize {
 ///
 /// * `usize` - The minimum word length.
 #[allow(clippy::expect_used)]
-fn get_minimum_word_length() -> usize {
+#[must_use]
+pub fn get_minimum_word_length() -> usize {
     env::var_os("MINIMUM_WORD_LENGTH").map_or_else(
         || {
             warn!(
@@ -214,7 +302,8 @@ fn get_minimum_word_length() -> usize {
 ///
 /// * `usize` - The maximum word length.
 #[allow(clippy::expect_used)]
-fn get_maximum_word_length() -> usize {
+#[must_use]
+pub fn get_maximum_word_length() -> usize {
     env::var_os("MAXIMUM_WORD_LENGTH").map_or_else(
         || {
             warn!(
@@ -232,3 +321,1117 @@ fn get_maximum_word_length() -> usize {
         },
     )
 }
+
+/// Gets whether words made up only of digits are indexed.
+///
+/// # Returns
+///
+/// * `bool` - Whether numbers are indexed.
+///
+/// # Panics
+///
+/// * If `INDEX_NUMBERS` is not valid UTF-8.
+/// * If `INDEX_NUMBERS` is not either `true` or `false`.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_index_numbers() -> bool {
+    env::var_os("INDEX_NUMBERS").map_or_else(
+        || {
+            warn!("INDEX_NUMBERS is not set! Using default value of {DEFAULT_INDEX_NUMBERS}...");
+
+            DEFAULT_INDEX_NUMBERS
+        },
+        |index_numbers| {
+            index_numbers
+                .to_str()
+                .expect("INDEX_NUMBERS must be valid UTF-8!")
+                .parse::<bool>()
+                .expect("INDEX_NUMBERS must be either true or false!")
+        },
+    )
+}
+
+/// Gets whether words are split on punctuation, instead of having it removed.
+///
+/// # Returns
+///
+/// * `bool` - Whether words are split on punctuation.
+///
+/// # Panics
+///
+/// * If `SPLIT_WORDS` is not valid UTF-8.
+/// * If `SPLIT_WORDS` is not either `true` or `false`.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_split_words() -> bool {
+    env::var_os("SPLIT_WORDS").map_or_else(
+        || {
+            warn!("SPLIT_WORDS is not set! Using default value of {DEFAULT_SPLIT_WORDS}...");
+
+            DEFAULT_SPLIT_WORDS
+        },
+        |split_words| {
+            split_words
+                .to_str()
+                .expect("SPLIT_WORDS must be valid UTF-8!")
+                .parse::<bool>()
+                .expect("SPLIT_WORDS must be either true or false!")
+        },
+    )
+}
+
+/// Gets whether HTTP/2 is negotiated with hosts that support it, instead of always using HTTP/1.1.
+///
+/// # Returns
+///
+/// * `bool` - Whether HTTP/2 is enabled.
+///
+/// # Panics
+///
+/// * If `HTTP2` is not valid UTF-8.
+/// * If `HTTP2` is not either `true` or `false`.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_http2() -> bool {
+    env::var_os("HTTP2").map_or_else(
+        || {
+            warn!("HTTP2 is not set! Using default value of {DEFAULT_HTTP2}...");
+
+            DEFAULT_HTTP2
+        },
+        |http2| {
+            http2
+                .to_str()
+                .expect("HTTP2 must be valid UTF-8!")
+                .parse::<bool>()
+                .expect("HTTP2 must be either true or false!")
+        },
+    )
+}
+
+/// Gets whether cookies set by hosts are kept, and sent back with later requests to them.
+///
+/// # Returns
+///
+/// * `bool` - Whether cookies are enabled.
+///
+/// # Panics
+///
+/// * If `COOKIES` is not valid UTF-8.
+/// * If `COOKIES` is not either `true` or `false`.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_cookies() -> bool {
+    env::var_os("COOKIES").map_or(DEFAULT_COOKIES, |cookies| {
+        cookies
+            .to_str()
+            .expect("COOKIES must be valid UTF-8!")
+            .parse::<bool>()
+            .expect("COOKIES must be either true or false!")
+    })
+}
+
+/// Gets whether hosts are asked to compress their responses with gzip or Brotli.
+///
+/// # Returns
+///
+/// * `bool` - Whether compression is enabled.
+///
+/// # Panics
+///
+/// * If `COMPRESSION` is not valid UTF-8.
+/// * If `COMPRESSION` is not either `true` or `false`.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_compression() -> bool {
+    env::var_os("COMPRESSION").map_or(DEFAULT_COMPRESSION, |compression| {
+        compression
+            .to_str()
+            .expect("COMPRESSION must be valid UTF-8!")
+            .parse::<bool>()
+            .expect("COMPRESSION must be either true or false!")
+    })
+}
+
+/// Gets whether only the titles and links of pages are indexed, for fast discovery crawls.
+///
+/// # Returns
+///
+/// * `bool` - Whether only titles and links are indexed.
+///
+/// # Panics
+///
+/// * If `TITLES_ONLY` is not valid UTF-8.
+/// * If `TITLES_ONLY` is not either `true` or `false`.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_titles_only() -> bool {
+    env::var_os("TITLES_ONLY").map_or(DEFAULT_TITLES_ONLY, |titles_only| {
+        titles_only
+            .to_str()
+            .expect("TITLES_ONLY must be valid UTF-8!")
+            .parse::<bool>()
+            .expect("TITLES_ONLY must be either true or false!")
+    })
+}
+
+/// Gets whether recrawled pages are fetched with the `ETag` and `Last-Modified` headers of their latest response.
+///
+/// # Returns
+///
+/// * `bool` - Whether conditional requests are enabled.
+///
+/// # Panics
+///
+/// * If `CONDITIONAL_REQUESTS` is not valid UTF-8.
+/// * If `CONDITIONAL_REQUESTS` is not either `true` or `false`.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_conditional_requests() -> bool {
+    env::var_os("CONDITIONAL_REQUESTS").map_or(
+        DEFAULT_CONDITIONAL_REQUESTS,
+        |conditional_requests| {
+            conditional_requests
+                .to_str()
+                .expect("CONDITIONAL_REQUESTS must be valid UTF-8!")
+                .parse::<bool>()
+                .expect("CONDITIONAL_REQUESTS must be either true or false!")
+        },
+    )
+}
+
+/// Gets whether URLs with an unknown extension are checked with a `HEAD` request, before they're fetched in full.
+///
+/// # Returns
+///
+/// * `bool` - Whether `HEAD` preflights are enabled.
+///
+/// # Panics
+///
+/// * If `HEAD_PREFLIGHT` is not valid UTF-8.
+/// * If `HEAD_PREFLIGHT` is not either `true` or `false`.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_head_preflight() -> bool {
+    env::var_os("HEAD_PREFLIGHT").map_or(DEFAULT_HEAD_PREFLIGHT, |head_preflight| {
+        head_preflight
+            .to_str()
+            .expect("HEAD_PREFLIGHT must be valid UTF-8!")
+            .parse::<bool>()
+            .expect("HEAD_PREFLIGHT must be either true or false!")
+    })
+}
+
+/// How the links marked with `rel="nofollow"`, `rel="ugc"` or `rel="sponsored"` are treated.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub enum QualifiedLinks {
+    /// Queued like other links, but not stored as links of the page, so they don't count as backlinks.
+    #[default]
+    Unranked,
+    /// Neither queued nor stored as links of the page.
+    Skip,
+    /// Treated like other links.
+    Follow,
+}
+
+/// Gets how the links marked with `rel="nofollow"`, `rel="ugc"` or `rel="sponsored"` are treated.
+///
+/// # Returns
+///
+/// * `QualifiedLinks` - `Unranked`, `Skip` or `Follow`.
+///
+/// # Notes
+///
+/// * If the `QUALIFIED_LINKS` environment variable isn't set, the default value is used.
+/// * The default value is `QualifiedLinks::Unranked`.
+/// * `QUALIFIED_LINKS` can be `unranked`, `skip` or `follow`.
+#[must_use]
+pub fn get_qualified_links() -> QualifiedLinks {
+    env::var_os("QUALIFIED_LINKS").map_or_else(QualifiedLinks::default, |qualified_links| {
+        match qualified_links.to_str() {
+            Some("unranked") => QualifiedLinks::Unranked,
+            Some("skip") => QualifiedLinks::Skip,
+            Some("follow") => QualifiedLinks::Follow,
+            Some(qualified_links) => {
+                warn!("Unknown QUALIFIED_LINKS \"{qualified_links}\", defaulting to unranked...");
+
+                QualifiedLinks::default()
+            }
+            None => {
+                warn!("Failed to parse QUALIFIED_LINKS to string slice, defaulting to unranked...");
+
+                QualifiedLinks::default()
+            }
+        }
+    })
+}
+
+/// Gets the maximum number of redirects followed from a URL, before giving up on it.
+///
+/// # Returns
+///
+/// * `usize` - The maximum number of redirects, where `0` follows none.
+///
+/// # Panics
+///
+/// * If `MAXIMUM_REDIRECTS` is not valid UTF-8.
+/// * If `MAXIMUM_REDIRECTS` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_maximum_redirects() -> usize {
+    env::var_os("MAXIMUM_REDIRECTS").map_or_else(
+        || {
+            warn!(
+                "MAXIMUM_REDIRECTS is not set! Using default value of {DEFAULT_MAXIMUM_REDIRECTS}..."
+            );
+
+            DEFAULT_MAXIMUM_REDIRECTS
+        },
+        |maximum_redirects| {
+            maximum_redirects
+                .to_str()
+                .expect("MAXIMUM_REDIRECTS must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("MAXIMUM_REDIRECTS must be a valid number!")
+        },
+    )
+}
+
+/// Gets the maximum number of idle connections kept open per host, to reuse for later requests.
+///
+/// # Returns
+///
+/// * `usize` - The maximum number of idle connections per host.
+///
+/// # Panics
+///
+/// * If `IDLE_CONNECTIONS_PER_HOST` is not valid UTF-8.
+/// * If `IDLE_CONNECTIONS_PER_HOST` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_idle_connections_per_host() -> usize {
+    env::var_os("IDLE_CONNECTIONS_PER_HOST").map_or_else(
+        || {
+            warn!(
+                "IDLE_CONNECTIONS_PER_HOST is not set! Using default value of {DEFAULT_IDLE_CONNECTIONS_PER_HOST}..."
+            );
+
+            DEFAULT_IDLE_CONNECTIONS_PER_HOST
+        },
+        |idle_connections_per_host| {
+            idle_connections_per_host
+                .to_str()
+                .expect("IDLE_CONNECTIONS_PER_HOST must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("IDLE_CONNECTIONS_PER_HOST must be a valid number!")
+        },
+    )
+}
+
+/// Gets the time an idle connection is kept open.
+///
+/// # Returns
+///
+/// * `Some(Duration)` - The idle connection timeout in seconds.
+/// * `None` - If idle connections are kept open until the host closes them.
+///
+/// # Panics
+///
+/// * If `IDLE_CONNECTION_TIMEOUT` is not valid UTF-8.
+/// * If `IDLE_CONNECTION_TIMEOUT` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_idle_connection_timeout() -> Option<Duration> {
+    let idle_connection_timeout = env::var_os("IDLE_CONNECTION_TIMEOUT").map_or_else(
+        || {
+            warn!(
+                "IDLE_CONNECTION_TIMEOUT is not set! Using default value of {}...",
+                DEFAULT_IDLE_CONNECTION_TIMEOUT.as_secs()
+            );
+
+            DEFAULT_IDLE_CONNECTION_TIMEOUT
+        },
+        |idle_connection_timeout| {
+            Duration::from_secs(
+                idle_connection_timeout
+                    .to_str()
+                    .expect("IDLE_CONNECTION_TIMEOUT must be valid UTF-8!")
+                    .parse::<u64>()
+                    .expect("IDLE_CONNECTION_TIMEOUT must be a valid number!"),
+            )
+        },
+    );
+
+    // A value of 0 disables it.
+    if idle_connection_timeout.is_zero() {
+        None
+    } else {
+        Some(idle_connection_timeout)
+    }
+}
+
+/// Gets the interval between TCP keep-alive probes on open connections.
+///
+/// # Returns
+///
+/// * `Some(Duration)` - The TCP keep-alive interval in seconds.
+/// * `None` - If TCP keep-alive is disabled.
+///
+/// # Panics
+///
+/// * If `TCP_KEEPALIVE` is not valid UTF-8.
+/// * If `TCP_KEEPALIVE` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_tcp_keepalive() -> Option<Duration> {
+    let tcp_keepalive = env::var_os("TCP_KEEPALIVE").map_or_else(
+        || {
+            warn!(
+                "TCP_KEEPALIVE is not set! Using default value of {}...",
+                DEFAULT_TCP_KEEPALIVE.as_secs()
+            );
+
+            DEFAULT_TCP_KEEPALIVE
+        },
+        |tcp_keepalive| {
+            Duration::from_secs(
+                tcp_keepalive
+                    .to_str()
+                    .expect("TCP_KEEPALIVE must be valid UTF-8!")
+                    .parse::<u64>()
+                    .expect("TCP_KEEPALIVE must be a valid number!"),
+            )
+        },
+    );
+
+    // A value of 0 disables it.
+    if tcp_keepalive.is_zero() {
+        None
+    } else {
+        Some(tcp_keepalive)
+    }
+}
+
+/// Gets the maximum number of positions stored per word on a page, the positions after it are dropped.
+///
+/// # Returns
+///
+/// * `usize` - The maximum number of positions per word.
+///
+/// # Panics
+///
+/// * If `MAXIMUM_KEYWORD_POSITIONS` is not valid UTF-8.
+/// * If `MAXIMUM_KEYWORD_POSITIONS` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_maximum_keyword_positions() -> usize {
+    env::var_os("MAXIMUM_KEYWORD_POSITIONS").map_or_else(
+        || {
+            warn!(
+                "MAXIMUM_KEYWORD_POSITIONS is not set! Using default value of {DEFAULT_MAXIMUM_KEYWORD_POSITIONS}..."
+            );
+
+            DEFAULT_MAXIMUM_KEYWORD_POSITIONS
+        },
+        |maximum_keyword_positions| {
+            maximum_keyword_positions
+                .to_str()
+                .expect("MAXIMUM_KEYWORD_POSITIONS must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("MAXIMUM_KEYWORD_POSITIONS must be a valid number!")
+        },
+    )
+}
+
+/// Gets the maximum size of a downloaded body in bytes.
+///
+/// # Returns
+///
+/// * `Some(usize)` - The maximum size of a body.
+/// * `None` - If the size of bodies isn't limited.
+///
+/// # Panics
+///
+/// * If `MAXIMUM_BODY_SIZE` is not valid UTF-8.
+/// * If `MAXIMUM_BODY_SIZE` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_maximum_body_size() -> Option<usize> {
+    let maximum_body_size = env::var_os("MAXIMUM_BODY_SIZE").map_or_else(
+        || {
+            warn!(
+                "MAXIMUM_BODY_SIZE is not set! Using default value of {DEFAULT_MAXIMUM_BODY_SIZE}..."
+            );
+
+            DEFAULT_MAXIMUM_BODY_SIZE
+        },
+        |maximum_body_size| {
+            maximum_body_size
+                .to_str()
+                .expect("MAXIMUM_BODY_SIZE must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("MAXIMUM_BODY_SIZE must be a valid number!")
+        },
+    );
+
+    // A value of 0 disables it.
+    if maximum_body_size == 0 {
+        None
+    } else {
+        Some(maximum_body_size)
+    }
+}
+
+/// Gets the time parsing a document may take, before its extraction is aborted.
+///
+/// # Returns
+///
+/// * `Some(Duration)` - The extraction timeout in seconds.
+/// * `None` - If parsing isn't limited in time.
+///
+/// # Panics
+///
+/// * If `EXTRACTION_TIMEOUT` is not valid UTF-8.
+/// * If `EXTRACTION_TIMEOUT` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_extraction_timeout() -> Option<Duration> {
+    let extraction_timeout = env::var_os("EXTRACTION_TIMEOUT").map_or_else(
+        || {
+            warn!(
+                "EXTRACTION_TIMEOUT is not set! Using default value of {}...",
+                DEFAULT_EXTRACTION_TIMEOUT.as_secs()
+            );
+
+            DEFAULT_EXTRACTION_TIMEOUT
+        },
+        |extraction_timeout| {
+            Duration::from_secs(
+                extraction_timeout
+                    .to_str()
+                    .expect("EXTRACTION_TIMEOUT must be valid UTF-8!")
+                    .parse::<u64>()
+                    .expect("EXTRACTION_TIMEOUT must be a valid number!"),
+            )
+        },
+    );
+
+    // A value of 0 disables it.
+    if extraction_timeout.is_zero() {
+        None
+    } else {
+        Some(extraction_timeout)
+    }
+}
+
+/// Gets the maximum number of nodes in a parsed document, before its extraction is aborted.
+///
+/// # Returns
+///
+/// * `Some(usize)` - The maximum number of nodes.
+/// * `None` - If the number of nodes isn't limited.
+///
+/// # Panics
+///
+/// * If `MAXIMUM_NODES` is not valid UTF-8.
+/// * If `MAXIMUM_NODES` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_maximum_nodes() -> Option<usize> {
+    let maximum_nodes = env::var_os("MAXIMUM_NODES").map_or_else(
+        || {
+            warn!("MAXIMUM_NODES is not set! Using default value of {DEFAULT_MAXIMUM_NODES}...");
+
+            DEFAULT_MAXIMUM_NODES
+        },
+        |maximum_nodes| {
+            maximum_nodes
+                .to_str()
+                .expect("MAXIMUM_NODES must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("MAXIMUM_NODES must be a valid number!")
+        },
+    );
+
+    // A value of 0 disables it.
+    if maximum_nodes == 0 {
+        None
+    } else {
+        Some(maximum_nodes)
+    }
+}
+
+/// Gets the maximum depth of the elements in a parsed document, before its extraction is aborted.
+///
+/// # Returns
+///
+/// * `Some(usize)` - The maximum depth.
+/// * `None` - If the depth isn't limited.
+///
+/// # Panics
+///
+/// * If `MAXIMUM_TREE_DEPTH` is not valid UTF-8.
+/// * If `MAXIMUM_TREE_DEPTH` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_maximum_tree_depth() -> Option<usize> {
+    let maximum_tree_depth = env::var_os("MAXIMUM_TREE_DEPTH").map_or_else(
+        || {
+            warn!(
+                "MAXIMUM_TREE_DEPTH is not set! Using default value of {DEFAULT_MAXIMUM_TREE_DEPTH}..."
+            );
+
+            DEFAULT_MAXIMUM_TREE_DEPTH
+        },
+        |maximum_tree_depth| {
+            maximum_tree_depth
+                .to_str()
+                .expect("MAXIMUM_TREE_DEPTH must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("MAXIMUM_TREE_DEPTH must be a valid number!")
+        },
+    );
+
+    // A value of 0 disables it.
+    if maximum_tree_depth == 0 {
+        None
+    } else {
+        Some(maximum_tree_depth)
+    }
+}
+
+/// Gets the maximum number of distinct links kept from a page, before the rest are dropped.
+///
+/// # Returns
+///
+/// * `Some(usize)` - The maximum number of links.
+/// * `None` - If the number of links isn't limited.
+///
+/// # Panics
+///
+/// * If `MAXIMUM_LINKS` is not valid UTF-8.
+/// * If `MAXIMUM_LINKS` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_maximum_links() -> Option<usize> {
+    let maximum_links = env::var_os("MAXIMUM_LINKS").map_or_else(
+        || {
+            warn!("MAXIMUM_LINKS is not set! Using default value of {DEFAULT_MAXIMUM_LINKS}...");
+
+            DEFAULT_MAXIMUM_LINKS
+        },
+        |maximum_links| {
+            maximum_links
+                .to_str()
+                .expect("MAXIMUM_LINKS must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("MAXIMUM_LINKS must be a valid number!")
+        },
+    );
+
+    // A value of 0 disables it.
+    if maximum_links == 0 {
+        None
+    } else {
+        Some(maximum_links)
+    }
+}
+
+/// Gets the maximum number of bits the simhash of a page may differ in from an indexed one, for it to be skipped as a near-duplicate.
+///
+/// # Returns
+///
+/// * `Some(u32)` - The maximum distance.
+/// * `None` - If near-duplicates are indexed too.
+///
+/// # Panics
+///
+/// * If `NEAR_DUPLICATE_DISTANCE` is not valid UTF-8.
+/// * If `NEAR_DUPLICATE_DISTANCE` is not a valid number.
+///
+/// # Notes
+///
+/// * Distances of `simhash::BANDS` bits or more are clamped, since similar simhashes are looked up by a band they share.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_near_duplicate_distance() -> Option<u32> {
+    let distance = env::var_os("NEAR_DUPLICATE_DISTANCE").map_or_else(
+        || {
+            warn!(
+                "NEAR_DUPLICATE_DISTANCE is not set! Using default value of {DEFAULT_NEAR_DUPLICATE_DISTANCE}..."
+            );
+
+            DEFAULT_NEAR_DUPLICATE_DISTANCE
+        },
+        |distance| {
+            distance
+                .to_str()
+                .expect("NEAR_DUPLICATE_DISTANCE must be valid UTF-8!")
+                .parse::<u32>()
+                .expect("NEAR_DUPLICATE_DISTANCE must be a valid number!")
+        },
+    );
+
+    // Simhashes that differ in fewer bits than there are bands always share a band.
+    let maximum_distance = u32::try_from(simhash::BANDS - 1).unwrap_or(u32::MAX);
+    if distance > maximum_distance {
+        warn!("NEAR_DUPLICATE_DISTANCE must be at most {maximum_distance}, clamping {distance}...");
+
+        return Some(maximum_distance);
+    }
+
+    // A value of 0 disables it.
+    if distance == 0 {
+        None
+    } else {
+        Some(distance)
+    }
+}
+
+/// Gets the schemes of the links that are followed.
+///
+/// # Returns
+///
+/// * `Vec<String>` - The allowed schemes, in lowercase.
+///
+/// # Panics
+///
+/// * If `ALLOWED_SCHEMES` is not valid UTF-8.
+///
+/// # Notes
+///
+/// * `ALLOWED_SCHEMES` is a comma separated list of schemes, like `http,https`.
+/// * Dangerous schemes like `javascript` and `data` are never followed, even if they're allowed.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_allowed_schemes() -> Vec<String> {
+    let default = || {
+        DEFAULT_ALLOWED_SCHEMES
+            .iter()
+            .map(std::string::ToString::to_string)
+            .collect()
+    };
+
+    env::var_os("ALLOWED_SCHEMES").map_or_else(
+        || {
+            warn!(
+                "ALLOWED_SCHEMES is not set! Using default value of {}...",
+                DEFAULT_ALLOWED_SCHEMES.join(",")
+            );
+
+            default()
+        },
+        |allowed_schemes| {
+            let allowed_schemes = allowed_schemes
+                .to_str()
+                .expect("ALLOWED_SCHEMES must be valid UTF-8!")
+                .split(',')
+                .map(|scheme| scheme.trim().trim_end_matches(':').to_lowercase())
+                .filter(|scheme| !scheme.is_empty())
+                .collect::<Vec<_>>();
+
+            if allowed_schemes.is_empty() {
+                warn!(
+                    "ALLOWED_SCHEMES is empty! Using default value of {}...",
+                    DEFAULT_ALLOWED_SCHEMES.join(",")
+                );
+
+                return default();
+            }
+
+            allowed_schemes
+        },
+    )
+}
+
+/// Gets the media types of the responses that are indexed.
+///
+/// # Returns
+///
+/// * `Vec<String>` - The allowed media types, in lowercase.
+///
+/// # Panics
+///
+/// * If `CONTENT_TYPES` is not valid UTF-8.
+///
+/// # Notes
+///
+/// * `CONTENT_TYPES` is a comma separated list of media types, like `text/html,application/xhtml+xml`.
+/// * A type followed by `/*`, like `text/*`, allows each of its subtypes.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_content_types() -> Vec<String> {
+    let default = || {
+        DEFAULT_CONTENT_TYPES
+            .iter()
+            .map(std::string::ToString::to_string)
+            .collect()
+    };
+
+    env::var_os("CONTENT_TYPES").map_or_else(
+        || {
+            warn!(
+                "CONTENT_TYPES is not set! Using default value of {}...",
+                DEFAULT_CONTENT_TYPES.join(",")
+            );
+
+            default()
+        },
+        |content_types| {
+            let content_types = content_types
+                .to_str()
+                .expect("CONTENT_TYPES must be valid UTF-8!")
+                .split(',')
+                .map(|content_type| content_type.trim().to_lowercase())
+                .filter(|content_type| !content_type.is_empty())
+                .collect::<Vec<_>>();
+
+            if content_types.is_empty() {
+                warn!(
+                    "CONTENT_TYPES is empty! Using default value of {}...",
+                    DEFAULT_CONTENT_TYPES.join(",")
+                );
+
+                return default();
+            }
+
+            content_types
+        },
+    )
+}
+
+/// Gets the query parameters stripped from URLs before they're queued.
+///
+/// # Returns
+///
+/// * `Vec<String>` - The names of the tracking parameters, in lowercase.
+///
+/// # Panics
+///
+/// * If `TRACKING_PARAMETERS` is not valid UTF-8.
+///
+/// # Notes
+///
+/// * `TRACKING_PARAMETERS` is a comma separated list of names, like `utm_*,fbclid,gclid,ref`.
+/// * A name followed by `*`, like `utm_*`, strips each parameter starting with it.
+/// * An empty list strips no parameters.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_tracking_parameters() -> Vec<String> {
+    env::var_os("TRACKING_PARAMETERS").map_or_else(
+        || {
+            warn!(
+                "TRACKING_PARAMETERS is not set! Using default value of {}...",
+                DEFAULT_TRACKING_PARAMETERS.join(",")
+            );
+
+            DEFAULT_TRACKING_PARAMETERS
+                .iter()
+                .map(std::string::ToString::to_string)
+                .collect()
+        },
+        |tracking_parameters| {
+            tracking_parameters
+                .to_str()
+                .expect("TRACKING_PARAMETERS must be valid UTF-8!")
+                .split(',')
+                .map(|name| name.trim().to_lowercase())
+                .filter(|name| !name.is_empty())
+                .collect()
+        },
+    )
+}
+
+/// Gets the key the credentials of hosts are encrypted with.
+///
+/// # Returns
+///
+/// * `Some(String)` - The key, if set.
+/// * `None` - If `CREDENTIALS_KEY` is not set.
+///
+/// # Panics
+///
+/// * If `CREDENTIALS_KEY` is not valid UTF-8.
+///
+/// # Notes
+///
+/// * Without the key, no credentials are sent to any host.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_credentials_key() -> Option<String> {
+    env::var_os("CREDENTIALS_KEY").map(|key| {
+        key.to_str()
+            .expect("CREDENTIALS_KEY must be valid UTF-8!")
+            .to_string()
+    })
+}
+
+/// Gets the transports that hosts are crawled through, instead of connecting to them directly.
+///
+/// # Returns
+///
+/// * `Vec<(String, String)>` - The host patterns and the URLs of the proxies they're crawled through, in order.
+///
+/// # Panics
+///
+/// * If `TRANSPORTS` is not valid UTF-8.
+///
+/// # Notes
+///
+/// * `TRANSPORTS` is a comma separated list of `pattern=proxy` pairs, like `*.onion=socks5h://127.0.0.1:9050`.
+/// * A pattern is a host, `*.` and a domain to match it and its subdomains, or `*` to match every host.
+/// * Pairs without a pattern or proxy are skipped.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_transports() -> Vec<(String, String)> {
+    let Some(transports) = env::var_os("TRANSPORTS") else {
+        return Vec::new();
+    };
+
+    transports
+        .to_str()
+        .expect("TRANSPORTS must be valid UTF-8!")
+        .split(',')
+        .map(str::trim)
+        .filter(|transport| !transport.is_empty())
+        .filter_map(|transport| {
+            let pair = transport
+                .split_once('=')
+                .map(|(pattern, proxy)| (pattern.trim(), proxy.trim()))
+                .filter(|(pattern, proxy)| !pattern.is_empty() && !proxy.is_empty());
+            if pair.is_none() {
+                warn!("Skipping transport \"{transport}\", it must be a pattern=proxy pair!");
+            }
+
+            pair.map(|(pattern, proxy)| (pattern.to_lowercase(), proxy.to_string()))
+        })
+        .collect()
+}
+
+/// Gets the aliases of hosts, which are crawled and stored as their canonical host instead.
+///
+/// # Returns
+///
+/// * `Vec<String>` - The aliases, in lowercase.
+///
+/// # Panics
+///
+/// * If `HOST_ALIASES` is not valid UTF-8.
+///
+/// # Notes
+///
+/// * `HOST_ALIASES` is a comma separated list of `alias=canonical` hosts and `label.*` prefixes, like `www.*,m.example.com=example.com`.
+/// * A prefix like `www.*` strips that label from the front of every host, as long as a domain is left.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_host_aliases() -> Vec<String> {
+    let Some(host_aliases) = env::var_os("HOST_ALIASES") else {
+        return Vec::new();
+    };
+
+    host_aliases
+        .to_str()
+        .expect("HOST_ALIASES must be valid UTF-8!")
+        .split(',')
+        .map(|alias| alias.trim().to_lowercase())
+        .filter(|alias| !alias.is_empty())
+        .collect()
+}
+
+/// Gets the patterns of the hosts that are crawled, so a crawl can be restricted to a set of sites.
+///
+/// # Returns
+///
+/// * `Vec<String>` - The patterns, in lowercase, or none to crawl every host that isn't blocked.
+///
+/// # Panics
+///
+/// * If `ALLOWED_HOSTS` is not valid UTF-8.
+///
+/// # Notes
+///
+/// * `ALLOWED_HOSTS` is a comma separated list of hosts and `*.domain` patterns, like `example.com,*.example.org`.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_allowed_hosts() -> Vec<String> {
+    let Some(allowed_hosts) = env::var_os("ALLOWED_HOSTS") else {
+        return Vec::new();
+    };
+
+    allowed_hosts
+        .to_str()
+        .expect("ALLOWED_HOSTS must be valid UTF-8!")
+        .split(',')
+        .map(|pattern| pattern.trim().to_lowercase())
+        .filter(|pattern| !pattern.is_empty())
+        .collect()
+}
+
+/// Gets the patterns of the hosts that are never crawled, like link farms or internal hosts.
+///
+/// # Returns
+///
+/// * `Vec<String>` - The patterns, in lowercase.
+///
+/// # Panics
+///
+/// * If `BLOCKED_HOSTS` is not valid UTF-8.
+///
+/// # Notes
+///
+/// * `BLOCKED_HOSTS` is a comma separated list of hosts and `*.domain` patterns, like `*.internal,spam.example.com`.
+/// * A blocked host is never crawled, even if it's allowed too.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_blocked_hosts() -> Vec<String> {
+    let Some(blocked_hosts) = env::var_os("BLOCKED_HOSTS") else {
+        return Vec::new();
+    };
+
+    blocked_hosts
+        .to_str()
+        .expect("BLOCKED_HOSTS must be valid UTF-8!")
+        .split(',')
+        .map(|pattern| pattern.trim().to_lowercase())
+        .filter(|pattern| !pattern.is_empty())
+        .collect()
+}
+
+/// Gets the pagination templates of hosts, whose pages are walked to find content not linked to otherwise.
+///
+/// # Returns
+///
+/// * `Vec<(String, String)>` - The hosts in lowercase, and their templates.
+///
+/// # Panics
+///
+/// * If `PAGINATION_TEMPLATES` is not valid UTF-8.
+///
+/// # Notes
+///
+/// * `PAGINATION_TEMPLATES` is a comma separated list of `host=template` pairs, like `example.com=/blog?page={n}`.
+/// * Pairs without a host or template are skipped.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_pagination_templates() -> Vec<(String, String)> {
+    let Some(templates) = env::var_os("PAGINATION_TEMPLATES") else {
+        return Vec::new();
+    };
+
+    templates
+        .to_str()
+        .expect("PAGINATION_TEMPLATES must be valid UTF-8!")
+        .split(',')
+        .map(str::trim)
+        .filter(|template| !template.is_empty())
+        .filter_map(|template| {
+            let pair = template
+                .split_once('=')
+                .map(|(host, template)| (host.trim(), template.trim()))
+                .filter(|(host, template)| !host.is_empty() && !template.is_empty());
+            if pair.is_none() {
+                warn!(
+                    "Skipping pagination template \"{template}\", it must be a host=template pair!"
+                );
+            }
+
+            pair.map(|(host, template)| (host.to_lowercase(), template.to_string()))
+        })
+        .collect()
+}
+
+/// Gets the maximum number of pages walked per pagination template.
+///
+/// # Returns
+///
+/// * `usize` - The maximum number of pages.
+///
+/// # Panics
+///
+/// * If `MAXIMUM_PAGINATION_PAGES` is not valid UTF-8.
+/// * If `MAXIMUM_PAGINATION_PAGES` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_maximum_pagination_pages() -> usize {
+    env::var_os("MAXIMUM_PAGINATION_PAGES").map_or_else(
+        || {
+            warn!(
+                "MAXIMUM_PAGINATION_PAGES is not set! Using default value of {DEFAULT_MAXIMUM_PAGINATION_PAGES}..."
+            );
+
+            DEFAULT_MAXIMUM_PAGINATION_PAGES
+        },
+        |maximum_pages| {
+            maximum_pages
+                .to_str()
+                .expect("MAXIMUM_PAGINATION_PAGES must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("MAXIMUM_PAGINATION_PAGES must be a valid number!")
+        },
+    )
+}
+
+/// Gets the interval between each fetch of the `robots.txt` file of a host.
+///
+/// # Returns
+///
+/// * `Duration` - The refresh interval in seconds.
+///
+/// # Panics
+///
+/// * If `ROBOTS_REFRESH_INTERVAL` is not valid UTF-8.
+/// * If `ROBOTS_REFRESH_INTERVAL` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_robots_refresh_interval() -> Duration {
+    env::var_os("ROBOTS_REFRESH_INTERVAL").map_or_else(
+        || {
+            warn!(
+                "ROBOTS_REFRESH_INTERVAL is not set! Using default value of {}...",
+                DEFAULT_ROBOTS_REFRESH_INTERVAL.as_secs()
+            );
+
+            DEFAULT_ROBOTS_REFRESH_INTERVAL
+        },
+        |refresh_interval| {
+            Duration::from_secs(
+                refresh_interval
+                    .to_str()
+                    .expect("ROBOTS_REFRESH_INTERVAL must be valid UTF-8!")
+                    .parse::<u64>()
+                    .expect("ROBOTS_REFRESH_INTERVAL must be a valid number!"),
+            )
+        },
+    )
+}
+
+/// Gets the maximum number of hosts whose `robots.txt` files are cached.
+///
+/// # Returns
+///
+/// * `usize` - The maximum number of hosts.
+///
+/// # Panics
+///
+/// * If `ROBOTS_CACHE_SIZE` is not valid UTF-8.
+/// * If `ROBOTS_CACHE_SIZE` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_robots_cache_size() -> usize {
+    env::var_os("ROBOTS_CACHE_SIZE").map_or_else(
+        || {
+            warn!(
+                "ROBOTS_CACHE_SIZE is not set! Using default value of {DEFAULT_ROBOTS_CACHE_SIZE}..."
+            );
+
+            DEFAULT_ROBOTS_CACHE_SIZE
+        },
+        |cache_size| {
+            cache_size
+                .to_str()
+                .expect("ROBOTS_CACHE_SIZE must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("ROBOTS_CACHE_SIZE must be a valid number!")
+        },
+    )
+}
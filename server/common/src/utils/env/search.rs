@@ -0,0 +1,700 @@
+use log::warn;
+use std::env;
+use std::time::Duration;
+
+/// The default number of results per page.
+const DEFAULT_RESULTS_PER_PAGE: usize = 20;
+
+/// The default maximum number of results per page.
+const DEFAULT_MAXIMUM_RESULTS_PER_PAGE: usize = 100;
+
+/// The default maximum number of results exported at once.
+const DEFAULT_MAXIMUM_EXPORT_ROWS: usize = 1_000;
+
+/// The default maximum number of candidate pages loaded from each shard for a query, before they're ranked.
+const DEFAULT_MAXIMUM_CANDIDATES: usize = 10_000;
+
+/// The default time a search may take.
+const DEFAULT_SEARCH_TIMEOUT: Duration = Duration::from_millis(1_000);
+
+/// The default maximum length of result snippets, in grapheme clusters.
+const DEFAULT_SNIPPET_LENGTH: usize = 160;
+
+/// The default number of clicks a client can record per minute.
+const DEFAULT_CLICKS_PER_MINUTE: u32 = 30;
+
+/// The default number of URLs a client can submit per day.
+const DEFAULT_SUBMISSIONS_PER_IP: u32 = 10;
+
+/// The default number of URLs that can be submitted for a domain per day.
+const DEFAULT_SUBMISSIONS_PER_DOMAIN: u32 = 50;
+
+/// The default maximum number of postings cached per shard, `0` disables the posting cache.
+const DEFAULT_POSTING_CACHE_SIZE: usize = 0;
+
+/// The default number of most searched terms whose postings are cached.
+const DEFAULT_POSTING_CACHE_TERMS: usize = 100;
+
+/// The default time cached postings are served for before they're loaded again.
+const DEFAULT_POSTING_CACHE_INTERVAL: Duration = Duration::from_secs(300);
+
+/// The default number of most common words spelling is corrected against, `0` disables autocorrect.
+const DEFAULT_SUGGESTION_VOCABULARY_SIZE: usize = 100_000;
+
+/// The default confidence a correction needs to be searched for instead of a query without results.
+const DEFAULT_AUTOCORRECT_CONFIDENCE: f64 = 0.8;
+
+/// The default time curations are applied for, before they're loaded from the database again.
+const DEFAULT_CURATION_REFRESH_INTERVAL: Duration = Duration::from_secs(60);
+
+/// The default time domain authorities are applied for, before they're loaded from the database again.
+const DEFAULT_AUTHORITY_REFRESH_INTERVAL: Duration = Duration::from_secs(3_600);
+
+/// The default time term statistics are returned for, before they're aggregated again.
+const DEFAULT_TERM_STATS_INTERVAL: Duration = Duration::from_secs(3_600);
+
+/// The default time a link to the cached copy of a page is valid for.
+const DEFAULT_CACHE_LINK_LIFETIME: Duration = Duration::from_secs(86_400);
+
+/// Gets the number of results per page, when the client doesn't ask for a specific number.
+///
+/// # Returns
+///
+/// * `usize` - The number of results per page.
+///
+/// # Panics
+///
+/// * If `RESULTS_PER_PAGE` is not valid UTF-8.
+/// * If `RESULTS_PER_PAGE` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_results_per_page() -> usize {
+    env::var_os("RESULTS_PER_PAGE").map_or_else(
+        || {
+            warn!(
+                "RESULTS_PER_PAGE is not set! Using default value of {DEFAULT_RESULTS_PER_PAGE}..."
+            );
+
+            DEFAULT_RESULTS_PER_PAGE
+        },
+        |results_per_page| {
+            results_per_page
+                .to_str()
+                .expect("RESULTS_PER_PAGE must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("RESULTS_PER_PAGE must be a valid number!")
+        },
+    )
+}
+
+/// Gets the maximum number of results per page a client can ask for.
+///
+/// # Returns
+///
+/// * `usize` - The maximum number of results per page.
+///
+/// # Panics
+///
+/// * If `MAXIMUM_RESULTS_PER_PAGE` is not valid UTF-8.
+/// * If `MAXIMUM_RESULTS_PER_PAGE` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_maximum_results_per_page() -> usize {
+    env::var_os("MAXIMUM_RESULTS_PER_PAGE").map_or_else(
+        || {
+            warn!(
+                "MAXIMUM_RESULTS_PER_PAGE is not set! Using default value of {DEFAULT_MAXIMUM_RESULTS_PER_PAGE}..."
+            );
+
+            DEFAULT_MAXIMUM_RESULTS_PER_PAGE
+        },
+        |maximum_results_per_page| {
+            maximum_results_per_page
+                .to_str()
+                .expect("MAXIMUM_RESULTS_PER_PAGE must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("MAXIMUM_RESULTS_PER_PAGE must be a valid number!")
+        },
+    )
+}
+
+/// Gets the maximum number of results a client can export at once, as CSV or NDJSON.
+///
+/// # Returns
+///
+/// * `usize` - The maximum number of exported results.
+///
+/// # Panics
+///
+/// * If `MAXIMUM_EXPORT_ROWS` is not valid UTF-8.
+/// * If `MAXIMUM_EXPORT_ROWS` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_maximum_export_rows() -> usize {
+    env::var_os("MAXIMUM_EXPORT_ROWS").map_or_else(
+        || {
+            warn!(
+                "MAXIMUM_EXPORT_ROWS is not set! Using default value of {DEFAULT_MAXIMUM_EXPORT_ROWS}..."
+            );
+
+            DEFAULT_MAXIMUM_EXPORT_ROWS
+        },
+        |maximum_export_rows| {
+            maximum_export_rows
+                .to_str()
+                .expect("MAXIMUM_EXPORT_ROWS must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("MAXIMUM_EXPORT_ROWS must be a valid number!")
+        },
+    )
+}
+
+/// Gets the maximum number of candidate pages loaded from each shard for a query, before they're ranked.
+///
+/// # Returns
+///
+/// * `Some(usize)` - The maximum number of candidates.
+/// * `None` - If the number of candidates isn't limited.
+///
+/// # Panics
+///
+/// * If `MAXIMUM_CANDIDATES` is not valid UTF-8.
+/// * If `MAXIMUM_CANDIDATES` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_maximum_candidates() -> Option<usize> {
+    let maximum_candidates = env::var_os("MAXIMUM_CANDIDATES").map_or_else(
+        || {
+            warn!(
+                "MAXIMUM_CANDIDATES is not set! Using default value of {DEFAULT_MAXIMUM_CANDIDATES}..."
+            );
+
+            DEFAULT_MAXIMUM_CANDIDATES
+        },
+        |maximum_candidates| {
+            maximum_candidates
+                .to_str()
+                .expect("MAXIMUM_CANDIDATES must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("MAXIMUM_CANDIDATES must be a valid number!")
+        },
+    );
+
+    // A value of 0 disables it.
+    if maximum_candidates == 0 {
+        None
+    } else {
+        Some(maximum_candidates)
+    }
+}
+
+/// Gets the time a search may take, before it's answered with whatever is done.
+///
+/// # Returns
+///
+/// * `Duration` - The search timeout.
+///
+/// # Panics
+///
+/// * If `SEARCH_TIMEOUT` is not valid UTF-8.
+/// * If `SEARCH_TIMEOUT` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_search_timeout() -> Duration {
+    env::var_os("SEARCH_TIMEOUT").map_or_else(
+        || {
+            warn!(
+                "SEARCH_TIMEOUT is not set! Using default value of {}...",
+                DEFAULT_SEARCH_TIMEOUT.as_millis()
+            );
+
+            DEFAULT_SEARCH_TIMEOUT
+        },
+        |search_timeout| {
+            Duration::from_millis(
+                search_timeout
+                    .to_str()
+                    .expect("SEARCH_TIMEOUT must be valid UTF-8!")
+                    .parse::<u64>()
+                    .expect("SEARCH_TIMEOUT must be a valid number!"),
+            )
+        },
+    )
+}
+
+/// Gets the maximum length of result snippets.
+///
+/// # Returns
+///
+/// * `usize` - The maximum length of result snippets, in grapheme clusters.
+///
+/// # Panics
+///
+/// * If `SNIPPET_LENGTH` is not valid UTF-8.
+/// * If `SNIPPET_LENGTH` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_snippet_length() -> usize {
+    env::var_os("SNIPPET_LENGTH").map_or_else(
+        || {
+            warn!("SNIPPET_LENGTH is not set! Using default value of {DEFAULT_SNIPPET_LENGTH}...");
+
+            DEFAULT_SNIPPET_LENGTH
+        },
+        |snippet_length| {
+            snippet_length
+                .to_str()
+                .expect("SNIPPET_LENGTH must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("SNIPPET_LENGTH must be a valid number!")
+        },
+    )
+}
+
+/// Gets the secret used to sign click tokens.
+///
+/// # Returns
+///
+/// * `Some(String)` - The secret, if set.
+/// * `None` - If `CLICK_TOKEN_SECRET` is not set.
+///
+/// # Panics
+///
+/// * If `CLICK_TOKEN_SECRET` is not valid UTF-8.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_click_token_secret() -> Option<String> {
+    env::var_os("CLICK_TOKEN_SECRET").map_or_else(
+        || {
+            warn!("CLICK_TOKEN_SECRET is not set! Click tokens won't survive a restart...");
+
+            None
+        },
+        |secret| {
+            Some(
+                secret
+                    .to_str()
+                    .expect("CLICK_TOKEN_SECRET must be valid UTF-8!")
+                    .to_string(),
+            )
+        },
+    )
+}
+
+/// Gets the number of clicks a single client can record per minute.
+///
+/// # Returns
+///
+/// * `u32` - The number of clicks per minute.
+///
+/// # Panics
+///
+/// * If `CLICKS_PER_MINUTE` is not valid UTF-8.
+/// * If `CLICKS_PER_MINUTE` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_clicks_per_minute() -> u32 {
+    env::var_os("CLICKS_PER_MINUTE").map_or_else(
+        || {
+            warn!(
+                "CLICKS_PER_MINUTE is not set! Using default value of {DEFAULT_CLICKS_PER_MINUTE}..."
+            );
+
+            DEFAULT_CLICKS_PER_MINUTE
+        },
+        |clicks_per_minute| {
+            clicks_per_minute
+                .to_str()
+                .expect("CLICKS_PER_MINUTE must be valid UTF-8!")
+                .parse::<u32>()
+                .expect("CLICKS_PER_MINUTE must be a valid number!")
+        },
+    )
+}
+
+/// Gets the number of URLs a single client can submit per day.
+///
+/// # Returns
+///
+/// * `u32` - The number of URLs per day.
+///
+/// # Panics
+///
+/// * If `SUBMISSIONS_PER_IP` is not valid UTF-8.
+/// * If `SUBMISSIONS_PER_IP` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_submissions_per_ip() -> u32 {
+    env::var_os("SUBMISSIONS_PER_IP").map_or_else(
+        || {
+            warn!(
+                "SUBMISSIONS_PER_IP is not set! Using default value of {DEFAULT_SUBMISSIONS_PER_IP}..."
+            );
+
+            DEFAULT_SUBMISSIONS_PER_IP
+        },
+        |submissions_per_ip| {
+            submissions_per_ip
+                .to_str()
+                .expect("SUBMISSIONS_PER_IP must be valid UTF-8!")
+                .parse::<u32>()
+                .expect("SUBMISSIONS_PER_IP must be a valid number!")
+        },
+    )
+}
+
+/// Gets the number of URLs that can be submitted for a single domain per day.
+///
+/// # Returns
+///
+/// * `u32` - The number of URLs per day.
+///
+/// # Panics
+///
+/// * If `SUBMISSIONS_PER_DOMAIN` is not valid UTF-8.
+/// * If `SUBMISSIONS_PER_DOMAIN` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_submissions_per_domain() -> u32 {
+    env::var_os("SUBMISSIONS_PER_DOMAIN").map_or_else(
+        || {
+            warn!(
+                "SUBMISSIONS_PER_DOMAIN is not set! Using default value of {DEFAULT_SUBMISSIONS_PER_DOMAIN}..."
+            );
+
+            DEFAULT_SUBMISSIONS_PER_DOMAIN
+        },
+        |submissions_per_domain| {
+            submissions_per_domain
+                .to_str()
+                .expect("SUBMISSIONS_PER_DOMAIN must be valid UTF-8!")
+                .parse::<u32>()
+                .expect("SUBMISSIONS_PER_DOMAIN must be a valid number!")
+        },
+    )
+}
+
+/// Gets the maximum number of postings cached per shard.
+///
+/// # Returns
+///
+/// * `usize` - The maximum number of postings, where `0` disables the posting cache.
+///
+/// # Panics
+///
+/// * If `POSTING_CACHE_SIZE` is not valid UTF-8.
+/// * If `POSTING_CACHE_SIZE` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_posting_cache_size() -> usize {
+    env::var_os("POSTING_CACHE_SIZE").map_or_else(
+        || {
+            warn!(
+                "POSTING_CACHE_SIZE is not set! Using default value of {DEFAULT_POSTING_CACHE_SIZE}..."
+            );
+
+            DEFAULT_POSTING_CACHE_SIZE
+        },
+        |posting_cache_size| {
+            posting_cache_size
+                .to_str()
+                .expect("POSTING_CACHE_SIZE must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("POSTING_CACHE_SIZE must be a valid number!")
+        },
+    )
+}
+
+/// Gets the number of most searched terms whose postings are cached.
+///
+/// # Returns
+///
+/// * `usize` - The number of terms.
+///
+/// # Panics
+///
+/// * If `POSTING_CACHE_TERMS` is not valid UTF-8.
+/// * If `POSTING_CACHE_TERMS` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_posting_cache_terms() -> usize {
+    env::var_os("POSTING_CACHE_TERMS").map_or_else(
+        || {
+            warn!(
+                "POSTING_CACHE_TERMS is not set! Using default value of {DEFAULT_POSTING_CACHE_TERMS}..."
+            );
+
+            DEFAULT_POSTING_CACHE_TERMS
+        },
+        |posting_cache_terms| {
+            posting_cache_terms
+                .to_str()
+                .expect("POSTING_CACHE_TERMS must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("POSTING_CACHE_TERMS must be a valid number!")
+        },
+    )
+}
+
+/// Gets the time cached postings are served for, before they're loaded from the database again.
+///
+/// # Returns
+///
+/// * `Duration` - The refresh interval of the posting cache.
+///
+/// # Panics
+///
+/// * If `POSTING_CACHE_INTERVAL` is not valid UTF-8.
+/// * If `POSTING_CACHE_INTERVAL` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_posting_cache_interval() -> Duration {
+    env::var_os("POSTING_CACHE_INTERVAL").map_or_else(
+        || {
+            warn!(
+                "POSTING_CACHE_INTERVAL is not set! Using default value of {}...",
+                DEFAULT_POSTING_CACHE_INTERVAL.as_secs()
+            );
+
+            DEFAULT_POSTING_CACHE_INTERVAL
+        },
+        |posting_cache_interval| {
+            Duration::from_secs(
+                posting_cache_interval
+                    .to_str()
+                    .expect("POSTING_CACHE_INTERVAL must be valid UTF-8!")
+                    .parse::<u64>()
+                    .expect("POSTING_CACHE_INTERVAL must be a valid number!"),
+            )
+        },
+    )
+}
+
+/// Gets the number of most common words of the index spelling is corrected against.
+///
+/// # Returns
+///
+/// * `usize` - The number of words, where `0` disables autocorrect.
+///
+/// # Panics
+///
+/// * If `SUGGESTION_VOCABULARY_SIZE` is not valid UTF-8.
+/// * If `SUGGESTION_VOCABULARY_SIZE` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_suggestion_vocabulary_size() -> usize {
+    env::var_os("SUGGESTION_VOCABULARY_SIZE").map_or_else(
+        || {
+            warn!(
+                "SUGGESTION_VOCABULARY_SIZE is not set! Using default value of {DEFAULT_SUGGESTION_VOCABULARY_SIZE}..."
+            );
+
+            DEFAULT_SUGGESTION_VOCABULARY_SIZE
+        },
+        |suggestion_vocabulary_size| {
+            suggestion_vocabulary_size
+                .to_str()
+                .expect("SUGGESTION_VOCABULARY_SIZE must be valid UTF-8!")
+                .parse::<usize>()
+                .expect("SUGGESTION_VOCABULARY_SIZE must be a valid number!")
+        },
+    )
+}
+
+/// Gets the confidence a correction needs to be searched for instead of a query without results.
+///
+/// # Returns
+///
+/// * `f64` - The confidence, between `0` and `1`.
+///
+/// # Panics
+///
+/// * If `AUTOCORRECT_CONFIDENCE` is not valid UTF-8.
+/// * If `AUTOCORRECT_CONFIDENCE` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_autocorrect_confidence() -> f64 {
+    env::var_os("AUTOCORRECT_CONFIDENCE").map_or_else(
+        || {
+            warn!(
+                "AUTOCORRECT_CONFIDENCE is not set! Using default value of {DEFAULT_AUTOCORRECT_CONFIDENCE}..."
+            );
+
+            DEFAULT_AUTOCORRECT_CONFIDENCE
+        },
+        |autocorrect_confidence| {
+            autocorrect_confidence
+                .to_str()
+                .expect("AUTOCORRECT_CONFIDENCE must be valid UTF-8!")
+                .parse::<f64>()
+                .expect("AUTOCORRECT_CONFIDENCE must be a valid number!")
+                .clamp(0.0, 1.0)
+        },
+    )
+}
+
+/// Gets the time curations are applied for, before they're loaded from the database again.
+///
+/// # Returns
+///
+/// * `Duration` - The refresh interval of the curations.
+///
+/// # Panics
+///
+/// * If `CURATION_REFRESH_INTERVAL` is not valid UTF-8.
+/// * If `CURATION_REFRESH_INTERVAL` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_curation_refresh_interval() -> Duration {
+    env::var_os("CURATION_REFRESH_INTERVAL").map_or_else(
+        || {
+            warn!(
+                "CURATION_REFRESH_INTERVAL is not set! Using default value of {}...",
+                DEFAULT_CURATION_REFRESH_INTERVAL.as_secs()
+            );
+
+            DEFAULT_CURATION_REFRESH_INTERVAL
+        },
+        |curation_refresh_interval| {
+            Duration::from_secs(
+                curation_refresh_interval
+                    .to_str()
+                    .expect("CURATION_REFRESH_INTERVAL must be valid UTF-8!")
+                    .parse::<u64>()
+                    .expect("CURATION_REFRESH_INTERVAL must be a valid number!"),
+            )
+        },
+    )
+}
+
+/// Gets the time domain authorities are applied for, before they're loaded from the database again.
+///
+/// # Returns
+///
+/// * `Duration` - The refresh interval of the domain authorities.
+///
+/// # Panics
+///
+/// * If `AUTHORITY_REFRESH_INTERVAL` is not valid UTF-8.
+/// * If `AUTHORITY_REFRESH_INTERVAL` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_authority_refresh_interval() -> Duration {
+    env::var_os("AUTHORITY_REFRESH_INTERVAL").map_or_else(
+        || {
+            warn!(
+                "AUTHORITY_REFRESH_INTERVAL is not set! Using default value of {}...",
+                DEFAULT_AUTHORITY_REFRESH_INTERVAL.as_secs()
+            );
+
+            DEFAULT_AUTHORITY_REFRESH_INTERVAL
+        },
+        |authority_refresh_interval| {
+            Duration::from_secs(
+                authority_refresh_interval
+                    .to_str()
+                    .expect("AUTHORITY_REFRESH_INTERVAL must be valid UTF-8!")
+                    .parse::<u64>()
+                    .expect("AUTHORITY_REFRESH_INTERVAL must be a valid number!"),
+            )
+        },
+    )
+}
+
+/// Gets the time term statistics are returned for, before they're aggregated from the keywords again.
+///
+/// # Returns
+///
+/// * `Duration` - The refresh interval of the term statistics.
+///
+/// # Panics
+///
+/// * If `TERM_STATS_INTERVAL` is not valid UTF-8.
+/// * If `TERM_STATS_INTERVAL` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_term_stats_interval() -> Duration {
+    env::var_os("TERM_STATS_INTERVAL").map_or_else(
+        || {
+            warn!(
+                "TERM_STATS_INTERVAL is not set! Using default value of {}...",
+                DEFAULT_TERM_STATS_INTERVAL.as_secs()
+            );
+
+            DEFAULT_TERM_STATS_INTERVAL
+        },
+        |term_stats_interval| {
+            Duration::from_secs(
+                term_stats_interval
+                    .to_str()
+                    .expect("TERM_STATS_INTERVAL must be valid UTF-8!")
+                    .parse::<u64>()
+                    .expect("TERM_STATS_INTERVAL must be a valid number!"),
+            )
+        },
+    )
+}
+
+/// Gets the secret used to sign links to the cached copies of pages.
+///
+/// # Returns
+///
+/// * `Some(String)` - The secret, if set.
+/// * `None` - If `CACHE_LINK_SECRET` is not set.
+///
+/// # Panics
+///
+/// * If `CACHE_LINK_SECRET` is not valid UTF-8.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_cache_link_secret() -> Option<String> {
+    env::var_os("CACHE_LINK_SECRET").map_or_else(
+        || {
+            warn!("CACHE_LINK_SECRET is not set! Cache links won't survive a restart...");
+
+            None
+        },
+        |secret| {
+            Some(
+                secret
+                    .to_str()
+                    .expect("CACHE_LINK_SECRET must be valid UTF-8!")
+                    .to_string(),
+            )
+        },
+    )
+}
+
+/// Gets the time a link to the cached copy of a page is valid for, after the search it was returned with.
+///
+/// # Returns
+///
+/// * `Duration` - The lifetime of cache links.
+///
+/// # Panics
+///
+/// * If `CACHE_LINK_LIFETIME` is not valid UTF-8.
+/// * If `CACHE_LINK_LIFETIME` is not a valid number.
+#[allow(clippy::expect_used)]
+#[must_use]
+pub fn get_cache_link_lifetime() -> Duration {
+    env::var_os("CACHE_LINK_LIFETIME").map_or_else(
+        || {
+            warn!(
+                "CACHE_LINK_LIFETIME is not set! Using default value of {}...",
+                DEFAULT_CACHE_LINK_LIFETIME.as_secs()
+            );
+
+            DEFAULT_CACHE_LINK_LIFETIME
+        },
+        |cache_link_lifetime| {
+            Duration::from_secs(
+                cache_link_lifetime
+                    .to_str()
+                    .expect("CACHE_LINK_LIFETIME must be valid UTF-8!")
+                    .parse::<u64>()
+                    .expect("CACHE_LINK_LIFETIME must be a valid number!"),
+            )
+        },
+    )
+}
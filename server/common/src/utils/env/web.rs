@@ -1,5 +1,6 @@
 use log::warn;
 use std::env;
+use std::net::IpAddr;
 
 /// The default IP and port to listen on.
 const DEFAULT_LISTENING_ADDRESS: (&str, u16) = ("0.0.0.0", 8080);
@@ -37,3 +38,95 @@ pub fn get_address() -> (String, u16) {
         }
     )
 }
+
+/// Get the token admin requests must be authorized with.
+///
+/// # Returns
+///
+/// * `Some(String)` - The admin token, if set.
+/// * `None` - If `ADMIN_TOKEN` is not set, which disables admin requests.
+///
+/// # Panics
+///
+/// * If `ADMIN_TOKEN` is not valid UTF-8.
+#[must_use]
+#[allow(clippy::expect_used)]
+pub fn get_admin_token() -> Option<String> {
+    env::var_os("ADMIN_TOKEN")
+        .map(|token| {
+            token
+                .to_str()
+                .expect("ADMIN_TOKEN must be valid UTF-8!")
+                .to_string()
+        })
+        .filter(|token| !token.is_empty())
+}
+
+/// Get the IP and port the admin server of the crawler listens on.
+///
+/// # Returns
+///
+/// * `Some((String, u16))`: The IP and port to listen on.
+/// * `None`: If `CRAWLER_ADMIN_ADDRESS` isn't set, which disables the admin server.
+///
+/// # Panics
+///
+/// * If `CRAWLER_ADMIN_ADDRESS` is not valid UTF-8.
+/// * If `CRAWLER_ADMIN_ADDRESS` is not in the format `ip:port`.
+/// * If `CRAWLER_ADMIN_ADDRESS`'s port is not a valid number.
+#[must_use]
+#[allow(clippy::expect_used)]
+pub fn get_crawler_admin_address() -> Option<(String, u16)> {
+    env::var_os("CRAWLER_ADMIN_ADDRESS").map(|admin_address| {
+        let admin_address = admin_address
+            .to_str()
+            .expect("CRAWLER_ADMIN_ADDRESS must be valid UTF-8!");
+
+        let (ip, port) = admin_address
+            .rsplit_once(':')
+            .expect("CRAWLER_ADMIN_ADDRESS must be in the format \"ip:port\"!");
+        let port = port
+            .parse::<u16>()
+            .expect("CRAWLER_ADMIN_ADDRESS must be in the format \"ip:port\"!");
+
+        (ip.to_string(), port)
+    })
+}
+
+/// Get the IP addresses of the reverse proxies trusted to forward the addresses of clients.
+///
+/// # Returns
+///
+/// * `Vec<IpAddr>` - The IP addresses of the trusted proxies, empty if no proxy is trusted.
+///
+/// # Panics
+///
+/// * If `TRUSTED_PROXIES` is not valid UTF-8.
+///
+/// # Notes
+///
+/// * `TRUSTED_PROXIES` is a comma separated list of IP addresses.
+/// * Invalid IP addresses are skipped.
+#[must_use]
+#[allow(clippy::expect_used)]
+pub fn get_trusted_proxies() -> Vec<IpAddr> {
+    let Some(proxies) = env::var_os("TRUSTED_PROXIES") else {
+        return Vec::new();
+    };
+
+    proxies
+        .to_str()
+        .expect("TRUSTED_PROXIES must be valid UTF-8!")
+        .split(',')
+        .map(str::trim)
+        .filter(|proxy| !proxy.is_empty())
+        .filter_map(|proxy| match proxy.parse::<IpAddr>() {
+            Ok(proxy) => Some(proxy),
+            Err(why) => {
+                warn!("TRUSTED_PROXIES has an invalid IP address \"{proxy}\", skipping it... (Error: {why})");
+
+                None
+            }
+        })
+        .collect()
+}
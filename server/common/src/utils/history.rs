@@ -0,0 +1,105 @@
+use crate::database::model::PageHistory;
+use sha2::{Digest, Sha256};
+
+/// Hashes the body of a page, to tell if it changed between crawls.
+///
+/// # Arguments
+///
+/// * `body`: The body of the page.
+///
+/// # Returns
+///
+/// * `String` - The hex encoded SHA-256 hash of the body.
+#[must_use]
+pub fn hash_content(body: &[u8]) -> String {
+    Sha256::digest(body)
+        .iter()
+        .map(|byte| format!("{byte:02x}"))
+        .collect()
+}
+
+/// Gets how often a page changes between crawls.
+///
+/// # Arguments
+///
+/// * `history`: The recorded crawls of the page, newest first.
+///
+/// # Returns
+///
+/// * `Some(f64)` - The share of recrawls where the content had changed, between `0.0` and `1.0`.
+/// * `None` - If the page was crawled successfully fewer than two times.
+///
+/// # Notes
+///
+/// * Only successful crawls are compared, so an error page in between isn't counted as a change.
+#[must_use]
+pub fn get_change_rate(history: &[PageHistory]) -> Option<f64> {
+    let hashes = history
+        .iter()
+        .filter(|entry| (200..300).contains(&entry.status))
+        .map(|entry| &entry.content_hash)
+        .collect::<Vec<_>>();
+    if hashes.len() < 2 {
+        return None;
+    }
+
+    let changes = hashes.windows(2).filter(|pair| pair[0] != pair[1]).count();
+
+    #[allow(clippy::cast_precision_loss)]
+    Some(changes as f64 / (hashes.len() - 1) as f64)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::time::{Duration, SystemTime};
+
+    /// Records the crawls of a page, given oldest first.
+    fn get_history(crawls: &[(&str, i32)]) -> Vec<PageHistory> {
+        let mut history = crawls
+            .iter()
+            .zip(1_u32..)
+            .map(|(&(body, status), id)| PageHistory {
+                id: i32::try_from(id).unwrap_or(i32::MAX),
+                page_id: 1,
+                crawled_at: SystemTime::UNIX_EPOCH + Duration::from_secs(u64::from(id)),
+                content_hash: hash_content(body.as_bytes()),
+                status,
+                size: i32::try_from(body.len()).unwrap_or(i32::MAX),
+            })
+            .collect::<Vec<_>>();
+        history.reverse();
+
+        history
+    }
+
+    #[test]
+    fn test_hash_content() {
+        assert_eq!(
+            hash_content(b"hello"),
+            "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+        );
+        assert_ne!(hash_content(b"hello"), hash_content(b"hello!"));
+    }
+
+    #[test]
+    fn test_get_change_rate() {
+        assert_eq!(get_change_rate(&[]), None);
+        assert_eq!(get_change_rate(&get_history(&[("v1", 200)])), None);
+
+        // Changed on two of four recrawls.
+        let history = get_history(&[
+            ("v1", 200),
+            ("v1", 200),
+            ("v2", 200),
+            ("v2", 200),
+            ("v3", 200),
+        ]);
+        assert_eq!(history[0].content_hash, hash_content(b"v3"));
+        assert_eq!(get_change_rate(&history), Some(0.5));
+
+        // The error page in between isn't a change.
+        let history = get_history(&[("v1", 200), ("Not Found", 404), ("v1", 200)]);
+        assert_eq!(get_change_rate(&history), Some(0.0));
+    }
+}
@@ -0,0 +1,139 @@
+/// Normalizes a language tag to its primary language.
+///
+/// # Arguments
+///
+/// * `tag`: The language tag, like `da-DK` or `en_US`.
+///
+/// # Returns
+///
+/// * `Some(String)` - The lowercase primary language, like `da` or `en`.
+/// * `None` - If the tag has no valid primary language.
+///
+/// # Notes
+///
+/// * Regions and scripts are dropped, so `en-US` and `en-GB` are the same language.
+#[must_use]
+pub fn normalize(tag: &str) -> Option<String> {
+    let language = tag.trim().split(['-', '_']).next()?;
+    if !(2..=3).contains(&language.len()) || !language.chars().all(|c| c.is_ascii_alphabetic()) {
+        return None;
+    }
+
+    Some(language.to_ascii_lowercase())
+}
+
+/// Converts a three letter ISO 639-3 code to the two letter code pages are stored with.
+///
+/// # Arguments
+///
+/// * `code`: The ISO 639-3 code, like `dan` or `eng`.
+///
+/// # Returns
+///
+/// * `Some(&str)` - The ISO 639-1 code, like `da` or `en`.
+/// * `None` - If the language has no two letter code, or isn't known.
+///
+/// # Notes
+///
+/// * Norwegian Bokmål is stored as `no`, and Mandarin as `zh`, like the tags pages usually declare them with.
+#[must_use]
+pub fn from_iso_639_3(code: &str) -> Option<&'static str> {
+    Some(match code {
+        "epo" => "eo",
+        "eng" => "en",
+        "rus" => "ru",
+        "cmn" => "zh",
+        "spa" => "es",
+        "por" => "pt",
+        "ita" => "it",
+        "ben" => "bn",
+        "fra" => "fr",
+        "deu" => "de",
+        "ukr" => "uk",
+        "kat" => "ka",
+        "ara" => "ar",
+        "hin" => "hi",
+        "jpn" => "ja",
+        "heb" => "he",
+        "yid" => "yi",
+        "pol" => "pl",
+        "amh" => "am",
+        "jav" => "jv",
+        "kor" => "ko",
+        "nob" => "no",
+        "dan" => "da",
+        "swe" => "sv",
+        "fin" => "fi",
+        "tur" => "tr",
+        "nld" => "nl",
+        "hun" => "hu",
+        "ces" => "cs",
+        "ell" => "el",
+        "bul" => "bg",
+        "bel" => "be",
+        "mar" => "mr",
+        "kan" => "kn",
+        "ron" => "ro",
+        "slv" => "sl",
+        "hrv" => "hr",
+        "srp" => "sr",
+        "mkd" => "mk",
+        "lit" => "lt",
+        "lav" => "lv",
+        "est" => "et",
+        "tam" => "ta",
+        "vie" => "vi",
+        "urd" => "ur",
+        "tha" => "th",
+        "guj" => "gu",
+        "uzb" => "uz",
+        "pan" => "pa",
+        "aze" => "az",
+        "ind" => "id",
+        "tel" => "te",
+        "pes" => "fa",
+        "mal" => "ml",
+        "ori" => "or",
+        "mya" => "my",
+        "nep" => "ne",
+        "sin" => "si",
+        "khm" => "km",
+        "tuk" => "tk",
+        "aka" => "ak",
+        "zul" => "zu",
+        "sna" => "sn",
+        "afr" => "af",
+        "lat" => "la",
+        "slk" => "sk",
+        "cat" => "ca",
+        "tgl" => "tl",
+        "hye" => "hy",
+        _ => return None,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_normalize() {
+        assert_eq!(normalize("da"), Some("da".into()));
+        assert_eq!(normalize(" en-US "), Some("en".into()));
+        assert_eq!(normalize("pt_BR"), Some("pt".into()));
+        assert_eq!(normalize("ZH-Hant-TW"), Some("zh".into()));
+        assert_eq!(normalize("fil"), Some("fil".into()));
+        assert_eq!(normalize(""), None);
+        assert_eq!(normalize("*"), None);
+        assert_eq!(normalize("english"), None);
+    }
+
+    #[test]
+    fn test_from_iso_639_3() {
+        assert_eq!(from_iso_639_3("dan"), Some("da"));
+        assert_eq!(from_iso_639_3("eng"), Some("en"));
+        assert_eq!(from_iso_639_3("nob"), Some("no"));
+        assert_eq!(from_iso_639_3("cmn"), Some("zh"));
+        assert_eq!(from_iso_639_3("xyz"), None);
+    }
+}
@@ -1,3 +1,12 @@
+pub mod admin;
+pub mod compression;
+pub mod dates;
 pub mod env;
+pub mod history;
+pub mod language;
+pub mod simhash;
+pub mod structured_data;
 pub mod timer;
+pub mod urls;
+pub mod usage;
 pub mod words;
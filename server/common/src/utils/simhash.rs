@@ -0,0 +1,147 @@
+use sha2::{Digest, Sha256};
+
+/// The number of words in each shingle of a text, so the order of the words counts too.
+const SHINGLE_SIZE: usize = 3;
+
+/// The number of bands a simhash is split into, so similar ones can be looked up by a band they share.
+pub const BANDS: usize = 4;
+
+/// Computes the simhash of a text, which only differs in a few bits for texts that are nearly the same.
+///
+/// # Arguments
+///
+/// * `text`: The text.
+///
+/// # Returns
+///
+/// * `Some(u64)` - The simhash of the text.
+/// * `None` - If the text has fewer than `SHINGLE_SIZE` words, which is too short to tell.
+///
+/// # Notes
+///
+/// * Words are compared case-insensitively, and punctuation and whitespace are ignored.
+/// * Each shingle of `SHINGLE_SIZE` words after each other votes on every bit with its hash.
+#[must_use]
+pub fn compute(text: &str) -> Option<u64> {
+    let words = text
+        .split(|character: char| !character.is_alphanumeric())
+        .filter(|word| !word.is_empty())
+        .map(str::to_lowercase)
+        .collect::<Vec<_>>();
+    if words.len() < SHINGLE_SIZE {
+        return None;
+    }
+
+    let mut votes = [0_i64; 64];
+    for shingle in words.windows(SHINGLE_SIZE) {
+        let digest = Sha256::digest(shingle.join(" ").as_bytes());
+        let mut bytes = [0; 8];
+        bytes.copy_from_slice(&digest[..8]);
+
+        let hash = u64::from_be_bytes(bytes);
+        for (bit, vote) in votes.iter_mut().enumerate() {
+            if hash >> bit & 1 == 1 {
+                *vote += 1;
+            } else {
+                *vote -= 1;
+            }
+        }
+    }
+
+    Some(
+        votes
+            .iter()
+            .enumerate()
+            .filter(|(_, vote)| **vote > 0)
+            .fold(0, |simhash, (bit, _)| simhash | 1 << bit),
+    )
+}
+
+/// Gets the number of bits two simhashes differ in.
+///
+/// # Arguments
+///
+/// * `first`: The first simhash.
+/// * `second`: The second simhash.
+///
+/// # Returns
+///
+/// * `u32` - The Hamming distance between the simhashes.
+#[must_use]
+pub const fn distance(first: u64, second: u64) -> u32 {
+    (first ^ second).count_ones()
+}
+
+/// Splits a simhash into its bands.
+///
+/// # Arguments
+///
+/// * `simhash`: The simhash.
+///
+/// # Returns
+///
+/// * `[i32; BANDS]` - The 16 bits of each band, from the highest to the lowest.
+///
+/// # Notes
+///
+/// * Simhashes that differ in fewer than `BANDS` bits always share a band, since each bit is in one band.
+#[must_use]
+pub fn get_bands(simhash: u64) -> [i32; BANDS] {
+    let mut bands = [0; BANDS];
+    for (index, band) in bands.iter_mut().enumerate() {
+        *band = i32::from((simhash >> ((BANDS - 1 - index) * 16)) as u16);
+    }
+
+    bands
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_compute() {
+        let text = "The quick brown fox jumps over the lazy dog, and then it runs into the forest \
+            where it meets a bear, a wolf and an owl, who are all friends of the fox.";
+        let simhash = compute(text).expect("Failed to compute simhash!");
+
+        // Case, punctuation and whitespace don't count.
+        assert_eq!(
+            compute(&text.to_uppercase().replace(", ", "  ")),
+            Some(simhash)
+        );
+
+        // A nearly identical text is close, and an unrelated one isn't.
+        let print_view = format!("{text} Print this page.");
+        let near = compute(&print_view).expect("Failed to compute simhash!");
+        let far = compute("Rust is a systems programming language focused on safety, speed and concurrency, with a rich type system and ownership model.")
+            .expect("Failed to compute simhash!");
+        assert!(distance(simhash, near) < distance(simhash, far));
+
+        assert_eq!(compute("Too short"), None);
+    }
+
+    #[test]
+    fn test_distance() {
+        assert_eq!(distance(0, 0), 0);
+        assert_eq!(distance(0b1011, 0b0001), 2);
+        assert_eq!(distance(0, u64::MAX), 64);
+    }
+
+    #[test]
+    fn test_get_bands() {
+        assert_eq!(
+            get_bands(0x0001_0002_0003_FFFF),
+            [1, 2, 3, i32::from(u16::MAX)]
+        );
+
+        // Any three differing bits leave at least one band the same.
+        let simhash = 0x1234_5678_9ABC_DEF0;
+        let other = simhash ^ (1 << 63 | 1 << 40 | 1 << 20);
+        assert!(get_bands(simhash)
+            .iter()
+            .zip(get_bands(other))
+            .any(|(band, other_band)| *band == other_band));
+    }
+}
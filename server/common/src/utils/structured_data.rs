@@ -0,0 +1,174 @@
+use serde_json::Value;
+
+/// The kinds of structured data entities that are stored.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum Kind {
+    /// An article, like a news article or a blog post.
+    Article,
+    /// A product, like one sold in a shop.
+    Product,
+    /// A recipe.
+    Recipe,
+    /// An organization, like a company or a local business.
+    Organization,
+}
+
+impl Kind {
+    /// Gets the name of the kind, as it's stored.
+    ///
+    /// # Returns
+    ///
+    /// * `&'static str` - The name of the kind.
+    #[must_use]
+    pub const fn as_str(self) -> &'static str {
+        match self {
+            Self::Article => "article",
+            Self::Product => "product",
+            Self::Recipe => "recipe",
+            Self::Organization => "organization",
+        }
+    }
+
+    /// Parses the name of a kind, as it's stored.
+    ///
+    /// # Arguments
+    ///
+    /// * `name`: The name of the kind.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Kind)` - The kind.
+    /// * `None` - If the name isn't a known kind.
+    #[must_use]
+    pub fn parse(name: &str) -> Option<Self> {
+        match name {
+            "article" => Some(Self::Article),
+            "product" => Some(Self::Product),
+            "recipe" => Some(Self::Recipe),
+            "organization" => Some(Self::Organization),
+            _ => None,
+        }
+    }
+
+    /// Gets the kind of a schema.org type.
+    ///
+    /// # Arguments
+    ///
+    /// * `name`: The type, like `NewsArticle` or `https://schema.org/Product`.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Kind)` - The kind the type is, or is a common subtype of.
+    /// * `None` - If the type isn't of a stored kind.
+    #[must_use]
+    pub fn from_type(name: &str) -> Option<Self> {
+        let name = name.trim();
+        let name = name
+            .strip_prefix("https://schema.org/")
+            .or_else(|| name.strip_prefix("http://schema.org/"))
+            .unwrap_or(name);
+
+        match name {
+            "Article" | "NewsArticle" | "BlogPosting" | "TechArticle" | "ScholarlyArticle"
+            | "Report" => Some(Self::Article),
+            "Product" | "ProductGroup" | "IndividualProduct" => Some(Self::Product),
+            "Recipe" => Some(Self::Recipe),
+            "Organization"
+            | "Corporation"
+            | "LocalBusiness"
+            | "NGO"
+            | "NewsMediaOrganization"
+            | "EducationalOrganization" => Some(Self::Organization),
+            _ => None,
+        }
+    }
+}
+
+/// Gets the typed entities of JSON-LD structured data, like an `Article` or a `Product`.
+///
+/// # Arguments
+///
+/// * `value`: The structured data.
+///
+/// # Returns
+///
+/// * `Vec<(Kind, &Value)>` - The entities of a stored kind, searching objects, arrays and `@graph` depth first.
+///
+/// # Notes
+///
+/// * Entities aren't searched for other entities, so the publisher of an article is kept as part of it.
+/// * An entity with many types, like `["Product", "Organization"]`, is of the kind of the first one that's stored.
+#[must_use]
+pub fn from_json_ld(value: &Value) -> Vec<(Kind, &Value)> {
+    match value {
+        Value::Object(object) => {
+            let kind = match object.get("@type") {
+                Some(Value::String(name)) => Kind::from_type(name),
+                Some(Value::Array(names)) => names
+                    .iter()
+                    .filter_map(Value::as_str)
+                    .find_map(Kind::from_type),
+                _ => None,
+            };
+            if let Some(kind) = kind {
+                return vec![(kind, value)];
+            }
+
+            object.values().flat_map(from_json_ld).collect()
+        }
+        Value::Array(values) => values.iter().flat_map(from_json_ld).collect(),
+        _ => Vec::new(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_from_type() {
+        assert_eq!(Kind::from_type("NewsArticle"), Some(Kind::Article));
+        assert_eq!(
+            Kind::from_type("https://schema.org/Product"),
+            Some(Kind::Product)
+        );
+        assert_eq!(Kind::from_type("LocalBusiness"), Some(Kind::Organization));
+        assert_eq!(Kind::from_type("WebSite"), None);
+
+        assert_eq!(Kind::parse(Kind::Recipe.as_str()), Some(Kind::Recipe));
+        assert_eq!(Kind::parse("website"), None);
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_from_json_ld() {
+        let value = serde_json::from_str::<Value>(
+            r#"{"@graph": [
+                {"@type": "WebSite", "name": "Example"},
+                {"@type": "Recipe", "name": "Pancakes"},
+                {"@type": ["Thing", "Product"], "name": "Pan", "brand": {"@type": "Organization"}}
+            ]}"#,
+        )
+        .expect("Failed to parse JSON!");
+
+        let kinds = from_json_ld(&value)
+            .into_iter()
+            .map(|(kind, entity)| (kind, entity["name"].as_str()))
+            .collect::<Vec<_>>();
+        // The brand of the product is kept as part of it, rather than as an entity of its own.
+        assert_eq!(
+            kinds,
+            vec![
+                (Kind::Recipe, Some("Pancakes")),
+                (Kind::Product, Some("Pan")),
+            ]
+        );
+
+        let value = serde_json::from_str::<Value>(
+            r#"{"@type": "WebPage", "mainEntity": {"@type": "Article", "headline": "News"}}"#,
+        )
+        .expect("Failed to parse JSON!");
+        assert_eq!(from_json_ld(&value).len(), 1);
+        assert!(from_json_ld(&Value::Null).is_empty());
+    }
+}
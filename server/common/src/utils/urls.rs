@@ -0,0 +1,720 @@
+use crate::utils;
+use log::warn;
+use std::collections::HashMap;
+use url::{Host, Position, Url};
+
+/// The schemes of links that are never followed, since they run code or embed the content instead of linking to it.
+const DANGEROUS_SCHEMES: [&str; 4] = ["javascript", "vbscript", "data", "file"];
+
+/// Why a link isn't followed.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum Rejection {
+    /// The link isn't an absolute or protocol-relative URL.
+    Invalid,
+    /// The scheme of the link runs code or embeds content, like `javascript:` or `data:`.
+    Dangerous(String),
+    /// The scheme of the link isn't allowed, like `mailto:` or `tel:` by default.
+    Disallowed(String),
+}
+
+/// The aliases of hosts, so sites served on several hosts are crawled and stored as one.
+///
+/// # Fields
+///
+/// * `hosts`: The canonical host of each aliased host, like `example.com` for `m.example.com`.
+/// * `prefixes`: The labels stripped from the front of every host, like `www`.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct HostAliases {
+    hosts: HashMap<String, String>,
+    prefixes: Vec<String>,
+}
+
+impl HostAliases {
+    /// Creates new host aliases.
+    ///
+    /// # Arguments
+    ///
+    /// * `aliases`: The `alias=canonical` hosts and `label.*` prefixes, in lowercase.
+    ///
+    /// # Returns
+    ///
+    /// * `HostAliases` - The host aliases, without the invalid ones.
+    #[must_use]
+    pub fn new(aliases: &[String]) -> Self {
+        let mut host_aliases = Self::default();
+        for alias in aliases {
+            if let Some((host, canonical)) = alias.split_once('=') {
+                let (host, canonical) = (host.trim(), canonical.trim());
+                if host.is_empty() || canonical.is_empty() || host == canonical {
+                    warn!("Skipping host alias \"{alias}\", it must be an alias=canonical pair!");
+
+                    continue;
+                }
+
+                host_aliases
+                    .hosts
+                    .insert(host.to_string(), canonical.to_string());
+            } else if let Some(label) = alias
+                .strip_suffix(".*")
+                .filter(|label| !label.is_empty() && !label.contains('.'))
+            {
+                host_aliases.prefixes.push(format!("{label}."));
+            } else {
+                warn!("Skipping host alias \"{alias}\", it must be an alias=canonical pair or a label.* prefix!");
+            }
+        }
+
+        host_aliases
+    }
+
+    /// Loads the host aliases from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `HostAliases` - The host aliases.
+    #[must_use]
+    pub fn load() -> Self {
+        Self::new(&utils::env::scraper::get_host_aliases())
+    }
+
+    /// Gets the canonical host of a host.
+    ///
+    /// # Arguments
+    ///
+    /// * `host`: The host, in lowercase.
+    ///
+    /// # Returns
+    ///
+    /// * `&str` - The canonical host, or the host itself if it isn't aliased.
+    ///
+    /// # Notes
+    ///
+    /// * Prefixes are stripped one label at a time until an alias matches, so `www.m.example.com` can become `example.com`.
+    /// * A prefix is never stripped if only a top-level domain would be left, so `www.com` stays as it is.
+    #[must_use]
+    pub fn get_canonical<'a>(&'a self, mut host: &'a str) -> &'a str {
+        loop {
+            if let Some(canonical) = self.hosts.get(host) {
+                return canonical;
+            }
+
+            let stripped = self
+                .prefixes
+                .iter()
+                .find_map(|prefix| host.strip_prefix(prefix.as_str()))
+                .filter(|rest| rest.trim_end_matches('.').contains('.'));
+            match stripped {
+                Some(rest) => host = rest,
+                None => return host,
+            }
+        }
+    }
+
+    /// Replaces the host of a URL with its canonical host.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The normalized URL.
+    ///
+    /// # Returns
+    ///
+    /// * `Url` - The URL with the canonical host, or the URL itself if its host isn't aliased.
+    ///
+    /// # Notes
+    ///
+    /// * Only domains are aliased, never IP addresses.
+    #[must_use]
+    pub fn apply(&self, url: &Url) -> Url {
+        let Some(Host::Domain(host)) = url.host() else {
+            return url.clone();
+        };
+
+        let canonical = self.get_canonical(host);
+        if canonical == host {
+            return url.clone();
+        }
+
+        let mut aliased = url.clone();
+        if aliased.set_host(Some(canonical)).is_err() {
+            return url.clone();
+        }
+
+        aliased
+    }
+}
+
+/// The query parameters that only track where a visitor came from, so analytics-tagged links aren't crawled as new pages.
+///
+/// # Fields
+///
+/// * `names`: The names of the parameters that are stripped, like `fbclid`.
+/// * `prefixes`: The prefixes of the names of the parameters that are stripped, like `utm_`.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct TrackingParameters {
+    names: Vec<String>,
+    prefixes: Vec<String>,
+}
+
+impl TrackingParameters {
+    /// Creates new tracking parameters.
+    ///
+    /// # Arguments
+    ///
+    /// * `parameters`: The names of the parameters and `prefix*` patterns, in lowercase.
+    ///
+    /// # Returns
+    ///
+    /// * `TrackingParameters` - The tracking parameters.
+    #[must_use]
+    pub fn new(parameters: &[String]) -> Self {
+        let mut tracking_parameters = Self::default();
+        for parameter in parameters {
+            match parameter.strip_suffix('*') {
+                Some("") => warn!(
+                    "Skipping tracking parameter \"{parameter}\", it would strip every parameter!"
+                ),
+                Some(prefix) => tracking_parameters.prefixes.push(prefix.to_string()),
+                None => tracking_parameters.names.push(parameter.clone()),
+            }
+        }
+
+        tracking_parameters
+    }
+
+    /// Loads the tracking parameters from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `TrackingParameters` - The tracking parameters.
+    #[must_use]
+    pub fn load() -> Self {
+        Self::new(&utils::env::scraper::get_tracking_parameters())
+    }
+
+    /// Checks if a query parameter is a tracking parameter.
+    ///
+    /// # Arguments
+    ///
+    /// * `name`: The name of the parameter.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the parameter is stripped.
+    #[must_use]
+    pub fn contains(&self, name: &str) -> bool {
+        let name = name.to_lowercase();
+
+        self.names.contains(&name)
+            || self
+                .prefixes
+                .iter()
+                .any(|prefix| name.starts_with(prefix.as_str()))
+    }
+
+    /// Strips the tracking parameters from the query of a URL.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The normalized URL.
+    ///
+    /// # Returns
+    ///
+    /// * `Url` - The URL without its tracking parameters, and without its query if only those were left.
+    ///
+    /// # Notes
+    ///
+    /// * The other parameters keep their order, so the URL stays normalized.
+    #[must_use]
+    pub fn strip(&self, url: &Url) -> Url {
+        let Some(query) = url.query() else {
+            return url.clone();
+        };
+
+        let parameters = query
+            .split('&')
+            .filter(|parameter| {
+                let name = parameter
+                    .split_once('=')
+                    .map_or(*parameter, |(name, _)| name);
+
+                !self.contains(name)
+            })
+            .collect::<Vec<_>>();
+
+        let mut stripped = url.clone();
+        if parameters.is_empty() {
+            stripped.set_query(None);
+        } else {
+            stripped.set_query(Some(&parameters.join("&")));
+        }
+
+        stripped
+    }
+}
+
+/// Normalizes a URL, so the same resource is always stored and looked up the same way.
+///
+/// # Arguments
+///
+/// * `url`: The URL to normalize.
+///
+/// # Returns
+///
+/// * `Url` - The normalized URL.
+///
+/// # Notes
+///
+/// * Hosts are already lowercase punycode once parsed, so `münchen.de` and `xn--mnchen-3ya.de` are the same host.
+/// * Escaped unreserved characters are decoded, and the hex digits of the remaining escapes are uppercased.
+/// * Reserved characters stay escaped, since decoding them could change what the URL points to.
+/// * Default ports and dot segments are also removed when parsing, so `http://example.com:80/a/../` is `http://example.com/`.
+/// * Fragments are removed, since they point into the same page.
+/// * Trailing slashes are trimmed, except for the root path, so `/about/` and `/about` are the same page.
+/// * Query parameters are sorted by name, keeping the order of repeated names, and empty queries are removed.
+#[must_use]
+pub fn normalize(url: &Url) -> Url {
+    let mut url = url.clone();
+    url.set_fragment(None);
+
+    let path = normalize_percent_encoding(url.path());
+    let path = if path.starts_with('/') {
+        let trimmed = path.trim_end_matches('/');
+        if trimmed.is_empty() {
+            "/"
+        } else {
+            trimmed
+        }
+    } else {
+        &path
+    };
+    url.set_path(path);
+
+    if let Some(query) = url.query().map(normalize_percent_encoding) {
+        let mut parameters = query
+            .split('&')
+            .filter(|parameter| !parameter.is_empty())
+            .collect::<Vec<_>>();
+        parameters.sort_by_key(|parameter| {
+            parameter
+                .split_once('=')
+                .map_or(*parameter, |(name, _)| name)
+        });
+
+        if parameters.is_empty() {
+            url.set_query(None);
+        } else {
+            url.set_query(Some(&parameters.join("&")));
+        }
+    }
+
+    url
+}
+
+/// Resolves a link on a page to the URL to follow.
+///
+/// # Arguments
+///
+/// * `link`: The link, like the `href` of an `a` element.
+/// * `base`: The URL of the page the link is on.
+/// * `allowed_schemes`: The schemes of the links that are followed, in lowercase.
+///
+/// # Returns
+///
+/// * `Ok(Url)` - The normalized URL of the link.
+/// * `Err(Rejection)` - Why the link isn't followed.
+///
+/// # Errors
+///
+/// * If the link isn't an absolute or protocol-relative URL.
+/// * If the scheme of the link is dangerous, even if it's allowed.
+/// * If the scheme of the link isn't allowed.
+///
+/// # Notes
+///
+/// * Protocol-relative links like `//example.com/` get the scheme of the page.
+pub fn resolve_link(link: &str, base: &Url, allowed_schemes: &[String]) -> Result<Url, Rejection> {
+    let link = link.trim();
+    let url = if link.starts_with("//") {
+        base.join(link)
+    } else {
+        Url::parse(link)
+    }
+    .map_err(|_| Rejection::Invalid)?;
+
+    check_scheme(&url, allowed_schemes)?;
+
+    Ok(normalize(&url))
+}
+
+/// Checks if the scheme of a URL is followed.
+///
+/// # Arguments
+///
+/// * `url`: The URL.
+/// * `allowed_schemes`: The schemes of the links that are followed, in lowercase.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the scheme is allowed.
+/// * `Err(Rejection)` - Why the scheme isn't followed.
+///
+/// # Errors
+///
+/// * If the scheme is dangerous, even if it's allowed.
+/// * If the scheme isn't allowed.
+pub fn check_scheme(url: &Url, allowed_schemes: &[String]) -> Result<(), Rejection> {
+    let scheme = url.scheme();
+    if DANGEROUS_SCHEMES.contains(&scheme) {
+        return Err(Rejection::Dangerous(scheme.to_string()));
+    }
+
+    if !allowed_schemes.iter().any(|allowed| allowed == scheme) {
+        return Err(Rejection::Disallowed(scheme.to_string()));
+    }
+
+    Ok(())
+}
+
+/// Gets the human-readable form of a URL, with its host in Unicode.
+///
+/// # Arguments
+///
+/// * `url`: The normalized URL.
+///
+/// # Returns
+///
+/// * `String` - The URL, with a punycode host like `xn--mnchen-3ya.de` shown as `münchen.de`.
+///
+/// # Notes
+///
+/// * The display form is only meant to be shown, the normalized form is the one to match and fetch.
+#[must_use]
+pub fn get_display_url(url: &Url) -> String {
+    let Some(host) = url.host_str() else {
+        return url.to_string();
+    };
+
+    let (display_host, result) = idna::domain_to_unicode(host);
+    if result.is_err() {
+        return url.to_string();
+    }
+
+    format!(
+        "{}{display_host}{}",
+        &url[..Position::BeforeHost],
+        &url[Position::AfterHost..]
+    )
+}
+
+/// Gets the domain of a URL, the part its authority is scored by.
+///
+/// # Arguments
+///
+/// * `url`: The URL.
+///
+/// # Returns
+///
+/// * `Some(String)` - The host of the URL, without a trailing dot.
+/// * `None` - If the URL is invalid or has no host.
+#[must_use]
+pub fn get_domain(url: &str) -> Option<String> {
+    let url = Url::parse(url).ok()?;
+
+    url.host_str()
+        .map(|host| host.trim_end_matches('.').to_string())
+}
+
+/// Normalizes the percent-encoding of a part of a URL.
+///
+/// # Arguments
+///
+/// * `value`: The path or query of a URL.
+///
+/// # Returns
+///
+/// * `String` - The value, with unreserved characters decoded and the other escapes in uppercase.
+fn normalize_percent_encoding(value: &str) -> String {
+    let bytes = value.as_bytes();
+
+    let mut normalized = String::with_capacity(value.len());
+    let mut index = 0;
+    while index < bytes.len() {
+        let escaped = bytes
+            .get(index + 1..index + 3)
+            .filter(|_| bytes[index] == b'%')
+            .and_then(|hex| std::str::from_utf8(hex).ok())
+            .and_then(|hex| u8::from_str_radix(hex, 16).ok());
+
+        match escaped {
+            Some(byte) if is_unreserved(byte) => {
+                normalized.push(char::from(byte));
+                index += 3;
+            }
+            Some(byte) => {
+                normalized.push_str(&format!("%{byte:02X}"));
+                index += 3;
+            }
+            None => {
+                // Copy everything up to the next escape at once, so multibyte characters aren't split.
+                let next = value[index..]
+                    .char_indices()
+                    .skip(1)
+                    .find_map(|(offset, c)| (c == '%').then_some(index + offset))
+                    .unwrap_or(value.len());
+                normalized.push_str(&value[index..next]);
+                index = next;
+            }
+        }
+    }
+
+    normalized
+}
+
+/// Checks if a byte is an unreserved character, which never has to be escaped.
+///
+/// # Arguments
+///
+/// * `byte`: The byte.
+///
+/// # Returns
+///
+/// * `bool` - Whether the byte is a letter, a digit, `-`, `.`, `_` or `~`.
+const fn is_unreserved(byte: u8) -> bool {
+    byte.is_ascii_alphanumeric() || matches!(byte, b'-' | b'.' | b'_' | b'~')
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_normalize() {
+        for (url, normalized) in [
+            // IDN hosts are stored as punycode.
+            ("https://münchen.de/", "https://xn--mnchen-3ya.de/"),
+            ("https://MÜNCHEN.de/", "https://xn--mnchen-3ya.de/"),
+            ("https://xn--mnchen-3ya.de/", "https://xn--mnchen-3ya.de/"),
+            // Escaped unreserved characters are decoded.
+            (
+                "https://example.com/%7Euser/%41%62c",
+                "https://example.com/~user/Abc",
+            ),
+            ("https://example.com/a%2d%2E%5f", "https://example.com/a-._"),
+            // Mixed-case hex is uppercased.
+            (
+                "https://example.com/a%2fb%c3%bc",
+                "https://example.com/a%2Fb%C3%BC",
+            ),
+            (
+                "https://example.com/?q=a%2bb%3D",
+                "https://example.com/?q=a%2Bb%3D",
+            ),
+            // Already encoded reserved characters stay encoded.
+            (
+                "https://example.com/a%2Fb%3Fc%23d",
+                "https://example.com/a%2Fb%3Fc%23d",
+            ),
+            (
+                "https://example.com/?q=a%26b&r=%C3%BC",
+                "https://example.com/?q=a%26b&r=%C3%BC",
+            ),
+            // Unencoded characters are encoded the same way as the encoded ones.
+            ("https://example.com/ü", "https://example.com/%C3%BC"),
+            ("https://example.com/%c3%bc", "https://example.com/%C3%BC"),
+            // Invalid escapes are left alone.
+            (
+                "https://example.com/100%/%zz",
+                "https://example.com/100%/%zz",
+            ),
+            // Equivalent forms of the same page are the same URL.
+            ("HTTP://Example.COM:80", "http://example.com/"),
+            ("https://example.com/a/./b/../c/", "https://example.com/a/c"),
+            (
+                "https://example.com/about/#team",
+                "https://example.com/about",
+            ),
+            ("https://example.com//", "https://example.com/"),
+            ("https://example.com/?", "https://example.com/"),
+            (
+                "https://example.com/?b=2&a=1&&b=1",
+                "https://example.com/?a=1&b=2&b=1",
+            ),
+        ] {
+            let url = Url::parse(url).expect("Failed to parse URL!");
+
+            assert_eq!(normalize(&url).as_str(), normalized, "{url}");
+        }
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_strip_tracking_parameters() {
+        let tracking_parameters =
+            TrackingParameters::new(&["utm_*".to_string(), "fbclid".to_string(), "*".to_string()]);
+        let strip = |url| {
+            tracking_parameters
+                .strip(&normalize(&Url::parse(url).expect("Failed to parse URL!")))
+                .to_string()
+        };
+
+        assert_eq!(
+            strip("https://example.com/?utm_source=news&UTM_Medium=email&fbclid=1"),
+            "https://example.com/"
+        );
+        assert_eq!(
+            strip("https://example.com/?utm_source=news&page=2&fbclid=1&id=7"),
+            "https://example.com/?id=7&page=2"
+        );
+        assert_eq!(
+            strip("https://example.com/?fbclid_x=1&utm=2"),
+            "https://example.com/?fbclid_x=1&utm=2"
+        );
+        assert_eq!(strip("https://example.com/"), "https://example.com/");
+
+        // The "*" pattern is skipped, so nothing else is stripped.
+        assert!(!tracking_parameters.contains("q"));
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_display_url() {
+        for (url, display_url) in [
+            (
+                "https://münchen.de/straße?q=1",
+                "https://münchen.de/stra%C3%9Fe?q=1",
+            ),
+            ("https://xn--mnchen-3ya.de/", "https://münchen.de/"),
+            (
+                "https://user@xn--bcher-kva.example:8080/",
+                "https://user@bücher.example:8080/",
+            ),
+            ("https://example.com/", "https://example.com/"),
+            ("https://127.0.0.1/", "https://127.0.0.1/"),
+        ] {
+            let url = normalize(&Url::parse(url).expect("Failed to parse URL!"));
+
+            assert_eq!(get_display_url(&url), display_url, "{url}");
+
+            // The display form parses back to the same URL.
+            assert_eq!(Url::parse(&get_display_url(&url)).ok(), Some(url));
+        }
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_resolve_link() {
+        let allowed_schemes = vec!["http".to_string(), "https".to_string()];
+        let resolve = |link, base| {
+            resolve_link(
+                link,
+                &Url::parse(base).expect("Failed to parse URL!"),
+                &allowed_schemes,
+            )
+            .map(String::from)
+        };
+
+        assert_eq!(
+            resolve("https://example.com/%7Ea", "https://page.com/"),
+            Ok("https://example.com/~a".into())
+        );
+        assert_eq!(
+            resolve(" HTTP://example.com/ ", "https://page.com/"),
+            Ok("http://example.com/".into())
+        );
+
+        // Protocol-relative links get the scheme of the page.
+        assert_eq!(
+            resolve("//example.com/path", "https://page.com/a/b"),
+            Ok("https://example.com/path".into())
+        );
+        assert_eq!(
+            resolve("//example.com/path", "http://page.com/"),
+            Ok("http://example.com/path".into())
+        );
+
+        // Links relative to the page aren't followed.
+        assert_eq!(
+            resolve("/about", "https://page.com/"),
+            Err(Rejection::Invalid)
+        );
+        assert_eq!(
+            resolve("about", "https://page.com/"),
+            Err(Rejection::Invalid)
+        );
+        assert_eq!(resolve("", "https://page.com/"), Err(Rejection::Invalid));
+
+        for (link, scheme) in [
+            ("javascript:alert(1)", "javascript"),
+            ("JavaScript:void(0)", "javascript"),
+            ("vbscript:msgbox", "vbscript"),
+            ("data:text/html;base64,PHNjcmlwdD4=", "data"),
+            ("file:///etc/passwd", "file"),
+        ] {
+            assert_eq!(
+                resolve(link, "https://page.com/"),
+                Err(Rejection::Dangerous(scheme.into())),
+                "{link}"
+            );
+        }
+
+        for (link, scheme) in [
+            ("mailto:someone@example.com", "mailto"),
+            ("tel:+4512345678", "tel"),
+            ("ftp://example.com/file", "ftp"),
+        ] {
+            assert_eq!(
+                resolve(link, "https://page.com/"),
+                Err(Rejection::Disallowed(scheme.into())),
+                "{link}"
+            );
+        }
+
+        // Dangerous schemes are rejected even if they're allowed.
+        let allowed_schemes = vec!["ftp".to_string(), "data".to_string()];
+        let base = Url::parse("https://page.com/").expect("Failed to parse URL!");
+        assert!(resolve_link("ftp://example.com/file", &base, &allowed_schemes).is_ok());
+        assert_eq!(
+            resolve_link("data:,hello", &base, &allowed_schemes),
+            Err(Rejection::Dangerous("data".into()))
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_host_aliases() {
+        let host_aliases = HostAliases::new(&[
+            "www.*".into(),
+            "m.*".into(),
+            "mobile.example.org=example.org".into(),
+            "example.net=www.example.net".into(),
+            "invalid".into(),
+            "=example.com".into(),
+        ]);
+
+        for (url, aliased) in [
+            // The www and mobile hosts collapse into the apex.
+            ("https://www.example.com/a?b", "https://example.com/a?b"),
+            ("https://m.example.com/a", "https://example.com/a"),
+            ("https://www.m.example.com/", "https://example.com/"),
+            ("https://example.com/", "https://example.com/"),
+            // Other subdomains are left alone.
+            ("https://blog.example.com/", "https://blog.example.com/"),
+            // Exact aliases, even if they point to a prefixed host.
+            ("https://mobile.example.org/", "https://example.org/"),
+            ("https://example.net/", "https://www.example.net/"),
+            ("https://m.example.net/", "https://www.example.net/"),
+            // Never down to a top-level domain, or for IP addresses.
+            ("https://www.com/", "https://www.com/"),
+            ("http://127.0.0.1/", "http://127.0.0.1/"),
+        ] {
+            let url = Url::parse(url).expect("Failed to parse URL!");
+
+            assert_eq!(host_aliases.apply(&url).as_str(), aliased);
+        }
+
+        // Without any aliases, hosts are never changed.
+        let url = Url::parse("https://www.example.com/").expect("Failed to parse URL!");
+        assert_eq!(HostAliases::default().apply(&url), url);
+    }
+}
@@ -0,0 +1,39 @@
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+
+/// The length of a day, which crawl usage is aggregated over.
+pub const DAY: Duration = Duration::from_secs(24 * 60 * 60);
+
+/// Gets the start of the UTC day a point in time is on.
+///
+/// # Arguments
+///
+/// * `time`: The point in time.
+///
+/// # Returns
+///
+/// * `SystemTime` - Midnight UTC of the day, or the Unix epoch if the time is before it.
+#[must_use]
+pub fn get_day(time: SystemTime) -> SystemTime {
+    let seconds = time
+        .duration_since(UNIX_EPOCH)
+        .map(|since_epoch| since_epoch.as_secs())
+        .unwrap_or_default();
+
+    UNIX_EPOCH + Duration::from_secs(seconds - seconds % DAY.as_secs())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_get_day() {
+        let midnight = UNIX_EPOCH + DAY * 20_000;
+
+        assert_eq!(get_day(midnight), midnight);
+        assert_eq!(get_day(midnight + Duration::from_secs(1)), midnight);
+        assert_eq!(get_day(midnight + DAY - Duration::from_millis(1)), midnight);
+        assert_eq!(get_day(midnight + DAY), midnight + DAY);
+        assert_eq!(get_day(UNIX_EPOCH - DAY), UNIX_EPOCH);
+    }
+}
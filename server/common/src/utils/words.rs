@@ -1,6 +1,352 @@
-use log::debug;
+use crate::errors::Error;
+use crate::utils::env;
+use log::{debug, info, warn};
 use regex::Regex;
-use std::collections::HashMap;
+use sha2::{Digest, Sha256};
+use std::collections::{HashMap, HashSet};
+
+/// The rules text is split into words by, shared by indexing and queries so they always match.
+///
+/// # Fields
+///
+/// * `minimum_length`: The minimum length of a word, in characters.
+/// * `maximum_length`: The maximum length of a word, in characters.
+/// * `index_numbers`: Whether words made up only of digits are kept.
+/// * `split_words`: Whether words are split on punctuation, like `state-of-the-art`, instead of having it removed.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Tokenizer {
+    pub minimum_length: usize,
+    pub maximum_length: usize,
+    pub index_numbers: bool,
+    pub split_words: bool,
+}
+
+impl Default for Tokenizer {
+    fn default() -> Self {
+        Self {
+            minimum_length: 2,
+            maximum_length: 128,
+            index_numbers: true,
+            split_words: false,
+        }
+    }
+}
+
+impl Tokenizer {
+    /// Creates a new tokenizer.
+    ///
+    /// # Arguments
+    ///
+    /// * `minimum_length`: The minimum length of a word, in characters.
+    /// * `maximum_length`: The maximum length of a word, in characters.
+    /// * `index_numbers`: Whether words made up only of digits are kept.
+    /// * `split_words`: Whether words are split on punctuation, instead of having it removed.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Tokenizer)` - The tokenizer.
+    /// * `Err(Error)` - If the lengths are invalid.
+    ///
+    /// # Errors
+    ///
+    /// * If the minimum length is greater than the maximum length.
+    pub fn new(
+        minimum_length: usize,
+        maximum_length: usize,
+        index_numbers: bool,
+        split_words: bool,
+    ) -> Result<Self, Error> {
+        if minimum_length > maximum_length {
+            return Err(Error::InvalidBoundaries(
+                "Minimum length cannot be greater than maximum length!".into(),
+            ));
+        }
+
+        Ok(Self {
+            minimum_length,
+            maximum_length,
+            index_numbers,
+            split_words,
+        })
+    }
+
+    /// Loads the tokenizer from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Tokenizer)` - The tokenizer.
+    /// * `Err(Error)` - If the lengths are invalid.
+    ///
+    /// # Errors
+    ///
+    /// * If `MINIMUM_WORD_LENGTH` is greater than `MAXIMUM_WORD_LENGTH`.
+    pub fn load() -> Result<Self, Error> {
+        Self::new(
+            env::scraper::get_minimum_word_length(),
+            env::scraper::get_maximum_word_length(),
+            env::scraper::get_index_numbers(),
+            env::scraper::get_split_words(),
+        )
+    }
+
+    /// Splits text into lowercase words.
+    ///
+    /// # Arguments
+    ///
+    /// * `content`: The text to split.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<String>` - The words that follow the rules of the tokenizer, in order.
+    ///
+    /// # Panics
+    ///
+    /// * If the illegal characters regex fails to compile.
+    #[allow(clippy::expect_used)]
+    #[must_use]
+    pub fn tokenize(&self, content: &str) -> Vec<String> {
+        /*
+         If a word isn't in this regex, it's illegal.
+         Illegal characters are removed from the word, or split it if enabled.
+         This is to prevent words like "hello!" and "world?" from being counted as different words.
+        */
+        let illegal_characters = Regex::new(r"[^a-zA-Z0-9\u{00C0}-\u{00FF}]+")
+            .expect("Failed to compile illegal characters regex!");
+
+        let mut words = Vec::new();
+        for word in content.to_lowercase().split_whitespace() {
+            if self.split_words {
+                words.extend(illegal_characters.split(word).map(str::to_string));
+            } else {
+                words.push(illegal_characters.replace_all(word, "").to_string());
+            }
+        }
+
+        words.retain(|word| {
+            let length = word.chars().count();
+
+            length >= self.minimum_length
+                && length <= self.maximum_length
+                && (self.index_numbers || !word.chars().all(|c| c.is_ascii_digit()))
+        });
+
+        words
+    }
+}
+
+/// The words treated specially when extracting words.
+///
+/// # Fields
+///
+/// * `stop_words`: The words that are never indexed.
+/// * `protected_words`: The words that are never stemmed.
+/// * `tokenizer`: The rules text is split into words by.
+#[derive(Debug, Clone, Default)]
+pub struct Dictionary {
+    stop_words: HashSet<String>,
+    protected_words: HashSet<String>,
+    tokenizer: Tokenizer,
+}
+
+impl Dictionary {
+    /// Creates a new dictionary.
+    ///
+    /// # Arguments
+    ///
+    /// * `stop_words`: The words that are never indexed.
+    /// * `protected_words`: The words that are never stemmed.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Dictionary)` - The dictionary, with all words lowercased.
+    /// * `Err(Error)` - If any of the words are invalid.
+    ///
+    /// # Errors
+    ///
+    /// * If a word contains whitespace, since it could never match a single word.
+    pub fn new<S, P>(stop_words: S, protected_words: P) -> Result<Self, Error>
+    where
+        S: IntoIterator<Item = String>,
+        P: IntoIterator<Item = String>,
+    {
+        Ok(Self {
+            stop_words: Self::validate(stop_words)?,
+            protected_words: Self::validate(protected_words)?,
+            tokenizer: Tokenizer::default(),
+        })
+    }
+
+    /// Sets the tokenizer of the dictionary.
+    ///
+    /// # Arguments
+    ///
+    /// * `tokenizer`: The rules text is split into words by.
+    ///
+    /// # Returns
+    ///
+    /// * `Dictionary` - The dictionary, with the tokenizer.
+    #[must_use]
+    pub fn with_tokenizer(mut self, tokenizer: Tokenizer) -> Self {
+        self.tokenizer = tokenizer;
+
+        self
+    }
+
+    /// Loads the dictionary from the files provided by the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Dictionary)` - The dictionary.
+    /// * `Err(Error)` - If any of the files could not be read, or contain invalid words.
+    ///
+    /// # Errors
+    ///
+    /// * If any of the files could not be read.
+    /// * If any of the words are invalid.
+    /// * If the tokenizer is invalid.
+    ///
+    /// # Notes
+    ///
+    /// * The stop words are the words in `STOP_WORDS` and `STOP_WORDS_ADDITIONS`, minus the ones in `STOP_WORDS_REMOVALS`.
+    /// * The protected words are the words in `PROTECTED_WORDS`.
+    /// * Any of the variables may be left unset.
+    /// * The tokenizer is loaded from the environment as well.
+    pub fn load() -> Result<Self, Error> {
+        let mut stop_words = Self::validate(
+            env::data::fetch_words("STOP_WORDS")?
+                .into_iter()
+                .chain(env::data::fetch_words("STOP_WORDS_ADDITIONS")?)
+                .flatten(),
+        )?;
+        let removals = Self::validate(
+            env::data::fetch_words("STOP_WORDS_REMOVALS")?
+                .into_iter()
+                .flatten(),
+        )?;
+        stop_words.retain(|word| !removals.contains(word));
+
+        let protected_words = Self::validate(
+            env::data::fetch_words("PROTECTED_WORDS")?
+                .into_iter()
+                .flatten(),
+        )?;
+        for word in protected_words.intersection(&stop_words) {
+            warn!("\"{word}\" is both a stop word and a protected word, it will not be indexed!");
+        }
+
+        let dictionary = Self {
+            stop_words,
+            protected_words,
+            tokenizer: Tokenizer::load()?,
+        };
+        info!(
+            "Loaded {} stop words and {} protected words (Fingerprint: {}).",
+            dictionary.stop_words.len(),
+            dictionary.protected_words.len(),
+            dictionary.fingerprint()
+        );
+
+        Ok(dictionary)
+    }
+
+    /// Validates and lowercases a list of words, skipping empty ones.
+    ///
+    /// # Arguments
+    ///
+    /// * `words`: The words to validate.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(HashSet<String>)` - The lowercased words.
+    /// * `Err(Error)` - If any of the words are invalid.
+    ///
+    /// # Errors
+    ///
+    /// * If a word contains whitespace.
+    fn validate<T>(words: T) -> Result<HashSet<String>, Error>
+    where
+        T: IntoIterator<Item = String>,
+    {
+        let mut validated_words = HashSet::new();
+        for word in words {
+            let word = word.trim().to_lowercase();
+            if word.is_empty() {
+                continue;
+            }
+
+            if word.contains(char::is_whitespace) {
+                return Err(Error::Internal(format!(
+                    "Invalid dictionary word \"{word}\", words can't contain whitespace!"
+                )));
+            }
+
+            validated_words.insert(word);
+        }
+
+        Ok(validated_words)
+    }
+
+    /// Gets the fingerprint of the dictionary.
+    ///
+    /// Pages indexed with a different fingerprint were indexed with a different dictionary or tokenizer, and need to be reindexed.
+    ///
+    /// # Returns
+    ///
+    /// * `String` - The hex encoded SHA-256 hash of the dictionary.
+    #[must_use]
+    pub fn fingerprint(&self) -> String {
+        let mut stop_words = self.stop_words.iter().collect::<Vec<_>>();
+        let mut protected_words = self.protected_words.iter().collect::<Vec<_>>();
+        stop_words.sort_unstable();
+        protected_words.sort_unstable();
+
+        let mut hasher = Sha256::new();
+        for (name, words) in [("stop", stop_words), ("protected", protected_words)] {
+            hasher.update(name.as_bytes());
+            for word in words {
+                hasher.update([0]);
+                hasher.update(word.as_bytes());
+            }
+            hasher.update([0xFF]);
+        }
+
+        let tokenizer = &self.tokenizer;
+        hasher.update(
+            format!(
+                "tokenizer:{}:{}:{}:{}",
+                tokenizer.minimum_length,
+                tokenizer.maximum_length,
+                tokenizer.index_numbers,
+                tokenizer.split_words
+            )
+            .as_bytes(),
+        );
+
+        hasher
+            .finalize()
+            .iter()
+            .map(|byte| format!("{byte:02x}"))
+            .collect()
+    }
+
+    /// Checks if a word is a stop word.
+    #[must_use]
+    pub fn is_stop_word(&self, word: &str) -> bool {
+        self.stop_words.contains(word)
+    }
+
+    /// Checks if a word is protected from stemming.
+    #[must_use]
+    pub fn is_protected(&self, word: &str) -> bool {
+        self.protected_words.contains(word)
+    }
+
+    /// Gets the tokenizer of the dictionary.
+    #[must_use]
+    pub const fn tokenizer(&self) -> &Tokenizer {
+        &self.tokenizer
+    }
+}
 
 /// Get words from content.
 ///
@@ -8,43 +354,74 @@ use std::collections::HashMap;
 ///
 /// * `content` - The content to get words from.
 /// * `language` - The language to stem the words in.
+/// * `dictionary` - The stop words and protected words to use.
 ///
 /// # Returns
 ///
 /// * `HashMap<String, usize>` - The words and their frequencies.
+pub fn extract(
+    content: &str,
+    language: rust_stemmers::Algorithm,
+    dictionary: &Dictionary,
+) -> HashMap<String, usize> {
+    let mut extracted_words = HashMap::new();
+    for word in dictionary.tokenizer().tokenize(content) {
+        if dictionary.is_stop_word(&word) {
+            continue;
+        }
+
+        let frequency = extracted_words.entry(word).or_insert(0);
+        *frequency += 1;
+    }
+
+    stem(extracted_words, language, dictionary)
+}
+
+/// Extracts the positions of words from a string.
 ///
-/// # Panics
+/// # Arguments
 ///
-/// * If the illegal characters regex fails to compile.
-#[allow(clippy::expect_used)]
-pub fn extract(content: &str, language: rust_stemmers::Algorithm) -> HashMap<String, usize> {
-    let raw_words = content
-        .to_lowercase()
-        .split_whitespace()
-        .map(std::string::ToString::to_string)
-        .collect::<Vec<_>>();
-    let mut extracted_words = HashMap::new();
+/// * `content` - The string to extract words from.
+/// * `language` - The language to stem the words in.
+/// * `dictionary` - The stop words and protected words.
+///
+/// # Returns
+///
+/// * `HashMap<String, Vec<usize>>` - The stemmed words and their positions, in order.
+///
+/// # Notes
+///
+/// * Positions are counted in words, including stop words, so words next to each other are always `1` apart.
+/// * Each word occurs as many times as it's counted by [`extract`].
+#[must_use]
+pub fn extract_positions(
+    content: &str,
+    language: rust_stemmers::Algorithm,
+    dictionary: &Dictionary,
+) -> HashMap<String, Vec<usize>> {
+    let stemmer = rust_stemmers::Stemmer::create(language);
 
-    /*
-     If a word isn't in this regex, it's illegal.
-     Illegal characters are removed from the word.
-     This is to prevent words like "hello!" and "world?" from being counted as different words.
-    */
-    let illegal_characters = Regex::new(r"[^a-zA-Z0-9\u{00C0}-\u{00FF}]+")
-        .expect("Failed to compile illegal characters regex!");
-
-    for word in raw_words {
-        // Make sure the word doesn't contain illegal characters.
-        let word = illegal_characters.replace_all(&word, "");
-        if word.is_empty() {
+    let mut positions = HashMap::<_, Vec<_>>::new();
+    for (position, word) in dictionary
+        .tokenizer()
+        .tokenize(content)
+        .into_iter()
+        .enumerate()
+    {
+        if dictionary.is_stop_word(&word) {
             continue;
         }
 
-        let frequency = extracted_words.entry(word.to_string()).or_insert(0);
-        *frequency += 1;
+        let word = if dictionary.is_protected(&word) {
+            word
+        } else {
+            stemmer.stem(&word).to_string()
+        };
+
+        positions.entry(word).or_default().push(position);
     }
 
-    stem(extracted_words, language)
+    positions
 }
 
 /// Stem words.
@@ -53,6 +430,7 @@ pub fn extract(content: &str, language: rust_stemmers::Algorithm) -> HashMap<Str
 ///
 /// * `words` - The words to stem.
 /// * `language` - The language to stem the words in.
+/// * `dictionary` - The dictionary holding the words that must not be stemmed.
 ///
 /// # Returns
 ///
@@ -60,20 +438,153 @@ pub fn extract(content: &str, language: rust_stemmers::Algorithm) -> HashMap<Str
 fn stem(
     words: HashMap<String, usize>,
     language: rust_stemmers::Algorithm,
+    dictionary: &Dictionary,
 ) -> HashMap<String, usize> {
     let stemmer = rust_stemmers::Stemmer::create(language);
 
     let mut stemmed_words = HashMap::new();
     for (word, frequency) in words {
-        let stemmed_word = stemmer.stem(&word);
+        let stemmed_word = if dictionary.is_protected(&word) {
+            word.clone()
+        } else {
+            stemmer.stem(&word).to_string()
+        };
 
         if word != stemmed_word {
             debug!("Stemmed word: {word} -> {stemmed_word}");
         }
 
-        let count = stemmed_words.entry(stemmed_word.to_string()).or_insert(0);
+        let count = stemmed_words.entry(stemmed_word).or_insert(0);
         *count += frequency;
     }
 
     stemmed_words
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_protected_words() {
+        let dictionary = Dictionary::new(vec!["patient".into()], vec!["Acute".into()])
+            .expect("Failed to create dictionary!");
+
+        assert_eq!(
+            extract(
+                "Acute care for the acute patient, treating acutely.",
+                rust_stemmers::Algorithm::English,
+                &dictionary
+            ),
+            vec![
+                ("acute".into(), 2), // "acute" is protected, so it isn't stemmed to "acut".
+                ("care".into(), 1),
+                ("for".into(), 1),
+                ("the".into(), 1),
+                ("treat".into(), 1),
+                ("acut".into(), 1), // "acutely" isn't protected, so it's still stemmed.
+            ]
+            .into_iter()
+            .collect::<HashMap<_, _>>()
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_extract_positions() {
+        let dictionary =
+            Dictionary::new(vec!["the".into()], Vec::new()).expect("Failed to create dictionary!");
+        let text = "The quick fox jumps over the lazy fox, jumping.";
+
+        let positions = extract_positions(text, rust_stemmers::Algorithm::English, &dictionary);
+        assert_eq!(positions.get("fox"), Some(&vec![2, 7]));
+        assert_eq!(positions.get("jump"), Some(&vec![3, 8]));
+        assert_eq!(positions.get("the"), None); // Stop words aren't kept, but still take up a position.
+
+        let frequencies = extract(text, rust_stemmers::Algorithm::English, &dictionary);
+        assert_eq!(
+            positions
+                .into_iter()
+                .map(|(word, positions)| (word, positions.len()))
+                .collect::<HashMap<_, _>>(),
+            frequencies
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_tokenize_lengths() {
+        let tokenizer = Tokenizer::new(3, 6, true, false).expect("Failed to create tokenizer!");
+
+        assert_eq!(
+            tokenizer.tokenize("A fox ran on Mærsk's ultralong ships."),
+            vec!["fox", "ran", "mærsks", "ships"]
+        );
+        assert!(Tokenizer::new(4, 3, true, false).is_err());
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_tokenize_numbers() {
+        let text = "Rust 1 was released in 2015, not 2O15.";
+        let with_numbers =
+            Tokenizer::new(1, 128, true, false).expect("Failed to create tokenizer!");
+        let without_numbers =
+            Tokenizer::new(1, 128, false, false).expect("Failed to create tokenizer!");
+
+        assert_eq!(
+            with_numbers.tokenize(text),
+            vec!["rust", "1", "was", "released", "in", "2015", "not", "2o15"]
+        );
+        assert_eq!(
+            without_numbers.tokenize(text),
+            vec!["rust", "was", "released", "in", "not", "2o15"]
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_tokenize_split_words() {
+        let text = "A state-of-the-art (e-mail) client";
+        let joined = Tokenizer::new(1, 128, true, false).expect("Failed to create tokenizer!");
+        let split = Tokenizer::new(1, 128, true, true).expect("Failed to create tokenizer!");
+
+        assert_eq!(
+            joined.tokenize(text),
+            vec!["a", "stateoftheart", "email", "client"]
+        );
+        assert_eq!(
+            split.tokenize(text),
+            vec!["a", "state", "of", "the", "art", "e", "mail", "client"]
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_fingerprint() {
+        let dictionary = Dictionary::new(vec!["a".into(), "b".into()], Vec::new())
+            .expect("Failed to create dictionary!");
+        let reordered = Dictionary::new(vec!["B".into(), "a".into()], Vec::new())
+            .expect("Failed to create dictionary!");
+        let protected = Dictionary::new(vec!["a".into()], vec!["b".into()])
+            .expect("Failed to create dictionary!");
+
+        assert_eq!(dictionary.fingerprint(), reordered.fingerprint());
+        assert_ne!(dictionary.fingerprint(), protected.fingerprint());
+        assert_ne!(
+            dictionary.fingerprint(),
+            Dictionary::default().fingerprint()
+        );
+        assert_ne!(
+            dictionary.fingerprint(),
+            dictionary
+                .clone()
+                .with_tokenizer(
+                    Tokenizer::new(1, 128, true, true).expect("Failed to create tokenizer!")
+                )
+                .fingerprint()
+        );
+        assert!(Dictionary::new(vec!["two words".into()], Vec::new()).is_err());
+    }
+}
@@ -0,0 +1,163 @@
+use crate::crawl_log::CrawlLog;
+use crate::robots::Verdict;
+use crate::scrapers::web::Web;
+use actix_web::http::header::{AUTHORIZATION, CACHE_CONTROL};
+use actix_web::web::Bytes;
+use actix_web::{get, web, App, HttpRequest, HttpResponse, HttpServer, Responder};
+use common::utils;
+use log::{debug, info};
+use serde::{Deserialize, Serialize};
+use std::sync::Arc;
+use tokio::sync::broadcast::error::RecvError;
+use url::Url;
+
+/// A request to check a URL against its host's `robots.txt` file.
+///
+/// # Fields
+///
+/// * `url`: The URL to check.
+#[derive(Debug, Deserialize)]
+pub struct RobotsCheck {
+    pub url: String,
+}
+
+/// The result of checking a URL against its host's `robots.txt` file.
+///
+/// # Fields
+///
+/// * `url`: The URL that was checked.
+/// * `verdict`: The verdict of the `robots.txt` file, if it could be fetched.
+/// * `error`: Why the URL couldn't be checked, if it couldn't.
+#[derive(Debug, Serialize)]
+pub struct RobotsCheckOutput {
+    pub url: String,
+    #[serde(flatten)]
+    pub verdict: Option<Verdict>,
+    pub error: Option<String>,
+}
+
+/// Checks if a request is authorized as an admin request.
+///
+/// # Arguments
+///
+/// * `request`: The request.
+///
+/// # Returns
+///
+/// * `bool` - Whether the request has the admin token as its bearer token.
+fn is_authorized(request: &HttpRequest) -> bool {
+    utils::admin::is_authorized(
+        request
+            .headers()
+            .get(AUTHORIZATION)
+            .and_then(|authorization| authorization.to_str().ok()),
+    )
+}
+
+#[get("/health")]
+async fn handle_health() -> impl Responder {
+    HttpResponse::Ok().finish()
+}
+
+#[get("/robots-check")]
+async fn handle_robots_check(
+    request: HttpRequest,
+    check: web::Query<RobotsCheck>,
+    scraper: web::Data<Web>,
+) -> impl Responder {
+    if !is_authorized(&request) {
+        return HttpResponse::Unauthorized().finish();
+    }
+
+    let check = check.into_inner();
+    let url = match Url::parse(&check.url) {
+        Ok(url) => url,
+        Err(err) => {
+            return HttpResponse::BadRequest().json(RobotsCheckOutput {
+                url: check.url,
+                verdict: None,
+                error: Some(err.to_string()),
+            })
+        }
+    };
+
+    match scraper.check_robots(&url).await {
+        Ok(verdict) => HttpResponse::Ok().json(RobotsCheckOutput {
+            url: url.to_string(),
+            verdict: Some(verdict),
+            error: None,
+        }),
+        Err(err) => HttpResponse::BadGateway().json(RobotsCheckOutput {
+            url: url.to_string(),
+            verdict: None,
+            error: Some(err.to_string()),
+        }),
+    }
+}
+
+#[get("/events")]
+async fn handle_events(request: HttpRequest, crawl_log: web::Data<CrawlLog>) -> impl Responder {
+    if !is_authorized(&request) {
+        return HttpResponse::Unauthorized().finish();
+    }
+
+    let events = futures::stream::unfold(crawl_log.subscribe(), |mut receiver| async move {
+        let message = match receiver.recv().await {
+            Ok(event) => event.to_sse(),
+            // Tell the client how many events it missed, instead of holding up the crawl for it.
+            Err(RecvError::Lagged(dropped)) => {
+                debug!("Dropped {dropped} events for a slow subscriber...");
+
+                format!("event: dropped\ndata: {{\"dropped\":{dropped}}}\n\n")
+            }
+            Err(RecvError::Closed) => return None,
+        };
+
+        Some((Ok::<_, actix_web::Error>(Bytes::from(message)), receiver))
+    });
+
+    HttpResponse::Ok()
+        .content_type("text/event-stream")
+        .insert_header((CACHE_CONTROL, "no-cache"))
+        .streaming(events)
+}
+
+/// Runs the admin server of the crawler.
+///
+/// # Arguments
+///
+/// * `address`: The IP and port to listen on.
+/// * `scraper`: The scraper the crawler uses, sharing its `robots.txt` cache.
+/// * `crawl_log`: The crawl log the crawler records to, streamed live at `/events`.
+///
+/// # Returns
+///
+/// * `std::io::Result<()>` - If the server stopped, or failed to start.
+///
+/// # Errors
+///
+/// * If the server could not listen on the address.
+pub async fn serve(
+    address: (String, u16),
+    scraper: Arc<Web>,
+    crawl_log: Arc<CrawlLog>,
+) -> std::io::Result<()> {
+    let scraper = web::Data::from(scraper);
+    let crawl_log = web::Data::from(crawl_log);
+
+    info!(
+        "Admin server listening on \"http://{}:{}\"...",
+        address.0, address.1
+    );
+    HttpServer::new(move || {
+        App::new()
+            .app_data(scraper.clone())
+            .app_data(crawl_log.clone())
+            .service(handle_health)
+            .service(handle_robots_check)
+            .service(handle_events)
+    })
+    .bind(address)?
+    .run()
+    .await
+}
@@ -0,0 +1,144 @@
+use common::database;
+use common::utils;
+use log::error;
+use std::collections::HashMap;
+use std::time::SystemTime;
+use tokio::sync::Mutex;
+use url::Url;
+
+/// The pages fetched from each host per day, capped so one large site can't take up the whole crawl.
+///
+/// # Fields
+///
+/// * `maximum_pages`: The maximum number of pages fetched from a host per UTC day.
+/// * `hosts`: The day the pages are counted for and the pages fetched from each host on it, once they're loaded.
+///
+/// # Notes
+///
+/// * The pages of a day start out as the requests in the crawl usage of that day, so they're shared with earlier runs.
+#[derive(Debug)]
+pub struct Budget {
+    maximum_pages: u64,
+    hosts: Mutex<Option<(SystemTime, HashMap<String, u64>)>>,
+}
+
+impl Budget {
+    /// Creates a new budget.
+    ///
+    /// # Arguments
+    ///
+    /// * `maximum_pages`: The maximum number of pages fetched from a host per UTC day.
+    ///
+    /// # Returns
+    ///
+    /// * `Budget` - The new budget.
+    #[must_use]
+    pub const fn new(maximum_pages: u64) -> Self {
+        Self {
+            maximum_pages,
+            hosts: Mutex::const_new(None),
+        }
+    }
+
+    /// Loads the budget from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Budget)` - The budget.
+    /// * `None` - If the pages fetched from a host aren't limited.
+    #[must_use]
+    pub fn load() -> Option<Self> {
+        utils::env::crawler::get_host_daily_budget().map(Self::new)
+    }
+
+    /// Spends a page of the budget of the host of a URL, if it has any left.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the page.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the page may be fetched, which is always the case for URLs without a host.
+    pub async fn spend(&self, url: &Url) -> bool {
+        let Some(host) = url.host_str() else {
+            return true;
+        };
+
+        let today = utils::usage::get_day(SystemTime::now());
+        let mut hosts = self.hosts.lock().await;
+        if hosts.as_ref().map_or(true, |(day, _)| *day != today) {
+            *hosts = Some((today, Self::get_spent(today).await));
+        }
+
+        let Some((_, hosts)) = hosts.as_mut() else {
+            return true;
+        };
+
+        let pages = hosts.entry(host.to_string()).or_insert(0);
+        if *pages >= self.maximum_pages {
+            return false;
+        }
+
+        *pages += 1;
+
+        true
+    }
+
+    /// Gets the requests made to each host on a day, by every crawl run.
+    ///
+    /// # Arguments
+    ///
+    /// * `day`: The start of the day.
+    ///
+    /// # Returns
+    ///
+    /// * `HashMap<String, u64>` - The requests made to each host, or none if they could not be retrieved.
+    async fn get_spent(day: SystemTime) -> HashMap<String, u64> {
+        let usage = match database::get_crawl_usage_since(day).await {
+            Ok(usage) => usage,
+            Err(err) => {
+                error!(
+                    "Failed to get the crawl usage of today, starting the budgets over ({}): {err}",
+                    err.code()
+                );
+
+                return HashMap::new();
+            }
+        };
+
+        let mut hosts = HashMap::new();
+        for usage in usage {
+            *hosts.entry(usage.host).or_insert(0) += u64::try_from(usage.requests).unwrap_or(0);
+        }
+
+        hosts
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[tokio::test]
+    #[allow(clippy::expect_used)]
+    async fn test_spend() {
+        let url = |url: &str| Url::parse(url).expect("Failed to parse URL!");
+        let budget = Budget::new(2);
+
+        // The pages of today are already loaded, so the crawl usage isn't read.
+        *budget.hosts.lock().await = Some((
+            utils::usage::get_day(SystemTime::now()),
+            HashMap::from([("busy.example.com".to_string(), 2)]),
+        ));
+
+        assert!(budget.spend(&url("https://example.com/a")).await);
+        assert!(budget.spend(&url("https://example.com/b")).await);
+        assert!(!budget.spend(&url("https://example.com/c")).await);
+
+        // Other hosts have budgets of their own, and some of them were spent by earlier runs.
+        assert!(budget.spend(&url("https://example.org/")).await);
+        assert!(!budget.spend(&url("https://busy.example.com/")).await);
+        assert!(budget.spend(&url("data:text/plain,budget")).await);
+    }
+}
@@ -0,0 +1,340 @@
+use chardetng::EncodingDetector;
+use encoding_rs::{Encoding, UTF_16BE, UTF_16LE, UTF_8};
+use regex::bytes::Regex;
+
+/// The number of bytes browsers scan for a `<meta charset>` declaration before giving up.
+const PRESCAN_LENGTH: usize = 1_024;
+
+/// Decodes an HTML body to UTF-8.
+///
+/// # Arguments
+///
+/// * `body`: The raw bytes of the body.
+/// * `content_type`: The `Content-Type` header of the response, if any.
+///
+/// # Returns
+///
+/// * `(String, &'static Encoding)`: The decoded body, and the encoding it was decoded from.
+///
+/// # Notes
+///
+/// * The encoding is chosen in order of precedence: byte order mark, `Content-Type` header, `<meta charset>`, then sniffing.
+/// * Byte order marks are stripped from the decoded body.
+/// * If no encoding is declared in the first 1024 bytes, a later `<meta charset>` is looked for before the encoding is sniffed.
+/// * Malformed byte sequences are replaced with the replacement character.
+pub fn decode(body: &[u8], content_type: Option<&str>) -> (String, &'static Encoding) {
+    if let Some((encoding, bom_length)) = Encoding::for_bom(body) {
+        return (decode_with(encoding, &body[bom_length..]), encoding);
+    }
+
+    if let Some(encoding) = content_type.and_then(get_header_charset) {
+        return (decode_with(encoding, body), encoding);
+    }
+
+    if let Some(encoding) = get_meta_charset(&body[..body.len().min(PRESCAN_LENGTH)]) {
+        return (decode_with(encoding, body), encoding);
+    }
+
+    // Rescan the whole body, in case a late declaration contradicts the assumed encoding.
+    let encoding = get_meta_charset(body).unwrap_or_else(|| sniff(body));
+
+    (decode_with(encoding, body), encoding)
+}
+
+/// Guesses the encoding of a body that doesn't declare one.
+///
+/// # Arguments
+///
+/// * `body`: The raw bytes of the body.
+///
+/// # Returns
+///
+/// * `&'static Encoding`: UTF-8 if the body is valid UTF-8, and otherwise the legacy encoding its bytes look the most like.
+///
+/// # Notes
+///
+/// * The guess is made like browsers do, so a body they'd show correctly is decoded the same way.
+fn sniff(body: &[u8]) -> &'static Encoding {
+    if std::str::from_utf8(body).is_ok() {
+        return UTF_8;
+    }
+
+    let mut detector = EncodingDetector::new();
+    detector.feed(body, true);
+
+    detector.guess(None, true)
+}
+
+/// Checks if a `Content-Type` header is one of a document that's indexed.
+///
+/// # Arguments
+///
+/// * `content_type`: The `Content-Type` header of the response, if any.
+/// * `allowed_types`: The media types that are indexed, in lowercase, where `text/*` allows each subtype of `text`.
+///
+/// # Returns
+///
+/// * `bool`: Whether the media type of the response is allowed, or the response doesn't say what it is.
+///
+/// # Notes
+///
+/// * Responses without a `Content-Type` are downloaded, and left to `is_binary` once they are.
+pub fn is_document(content_type: Option<&str>, allowed_types: &[String]) -> bool {
+    let Some(content_type) = content_type else {
+        return true;
+    };
+    let media_type = content_type
+        .split(';')
+        .next()
+        .unwrap_or_default()
+        .trim()
+        .to_lowercase();
+    if media_type.is_empty() {
+        return true;
+    }
+
+    allowed_types.iter().any(|allowed_type| {
+        allowed_type.strip_suffix("/*").map_or_else(
+            || *allowed_type == media_type,
+            |allowed_type| {
+                media_type
+                    .strip_prefix(allowed_type)
+                    .is_some_and(|subtype| subtype.starts_with('/'))
+            },
+        )
+    })
+}
+
+/// Checks if a body is binary, like an image or an archive sent as a page.
+///
+/// # Arguments
+///
+/// * `body`: The raw bytes of the body.
+/// * `content_type`: The `Content-Type` header of the response, if any.
+///
+/// # Returns
+///
+/// * `bool`: Whether the start of the body has a NUL byte, which text never has.
+///
+/// # Notes
+///
+/// * Bodies with a byte order mark, or declared as UTF-16, have NUL bytes in their text, so they're never binary.
+pub fn is_binary(body: &[u8], content_type: Option<&str>) -> bool {
+    if Encoding::for_bom(body).is_some()
+        || content_type
+            .and_then(get_header_charset)
+            .is_some_and(|encoding| encoding == UTF_16LE || encoding == UTF_16BE)
+    {
+        return false;
+    }
+
+    body[..body.len().min(PRESCAN_LENGTH)].contains(&0)
+}
+
+/// Sanitizes text extracted from a page, so the database accepts it.
+///
+/// # Arguments
+///
+/// * `text`: The text to sanitize.
+///
+/// # Returns
+///
+/// * `String`: The text without NUL and other control characters, except for tabs and line breaks.
+///
+/// # Notes
+///
+/// * Postgres rejects text containing NUL, which would fail the insert of the whole page.
+/// * Malformed byte sequences are already replaced with the replacement character when decoding, and are kept.
+pub fn sanitize(text: &str) -> String {
+    text.chars()
+        .filter(|c| !c.is_control() || matches!(c, '\t' | '\n' | '\r'))
+        .collect()
+}
+
+/// Decodes bytes with the given encoding, ignoring any byte order mark.
+///
+/// # Arguments
+///
+/// * `encoding`: The encoding to decode with.
+/// * `bytes`: The bytes to decode.
+///
+/// # Returns
+///
+/// * `String`: The decoded bytes.
+fn decode_with(encoding: &'static Encoding, bytes: &[u8]) -> String {
+    encoding.decode_without_bom_handling(bytes).0.into_owned()
+}
+
+/// Gets the encoding declared by a `Content-Type` header.
+///
+/// # Arguments
+///
+/// * `content_type`: The `Content-Type` header, e.g. `text/html; charset=utf-8`.
+///
+/// # Returns
+///
+/// * `Option<&'static Encoding>`: The declared encoding, if any is known.
+fn get_header_charset(content_type: &str) -> Option<&'static Encoding> {
+    content_type
+        .split(';')
+        .filter_map(|parameter| parameter.split_once('='))
+        .find(|(key, _)| key.trim().eq_ignore_ascii_case("charset"))
+        .and_then(|(_, label)| Encoding::for_label(label.trim().trim_matches('"').as_bytes()))
+}
+
+/// Gets the encoding declared by the first `<meta charset>` or `<meta http-equiv="Content-Type">` tag.
+///
+/// # Arguments
+///
+/// * `bytes`: The bytes to scan.
+///
+/// # Returns
+///
+/// * `Option<&'static Encoding>`: The declared encoding, if any is known.
+///
+/// # Panics
+///
+/// * If the meta charset regex fails to compile.
+///
+/// # Notes
+///
+/// * A document can't declare itself as UTF-16 in a meta tag, so those declarations are treated as UTF-8.
+#[allow(clippy::expect_used)]
+fn get_meta_charset(bytes: &[u8]) -> Option<&'static Encoding> {
+    let meta_charset = Regex::new(r#"(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_:.\-]+)"#)
+        .expect("Failed to compile meta charset regex!");
+
+    meta_charset
+        .captures(bytes)
+        .and_then(|captures| captures.get(1))
+        .and_then(|label| Encoding::for_label(label.as_bytes()))
+        .map(Encoding::output_encoding)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use scraper::{Html, Selector};
+
+    #[allow(clippy::expect_used)]
+    fn get_title(html: &str) -> String {
+        Html::parse_document(html)
+            .select(&Selector::parse("title").expect("Failed to parse title selector!"))
+            .next()
+            .map(|element| element.inner_html())
+            .expect("Failed to get title!")
+    }
+
+    #[test]
+    fn test_decode_utf_16_with_bom() {
+        let mut body = vec![0xFF, 0xFE];
+        for unit in "<html><head><title>Grüße</title></head></html>".encode_utf16() {
+            body.extend_from_slice(&unit.to_le_bytes());
+        }
+
+        let (html, encoding) = decode(&body, Some("text/html; charset=iso-8859-1"));
+
+        assert_eq!(encoding, encoding_rs::UTF_16LE);
+        assert_eq!(get_title(&html), "Grüße");
+    }
+
+    #[test]
+    fn test_decode_header_over_meta() {
+        let body = b"<html><head><meta charset=\"utf-8\"><title>Caf\xE9</title></head></html>";
+
+        let (html, encoding) = decode(body, Some("text/html; charset=\"ISO-8859-1\""));
+
+        assert_eq!(encoding, encoding_rs::WINDOWS_1252);
+        assert_eq!(get_title(&html), "Café");
+    }
+
+    #[test]
+    fn test_sanitize() {
+        let body = b"<html><head><title>Caf\xC3 \x00au\x07 lait\xFF</title></head></html>";
+
+        let (html, encoding) = decode(body, Some("text/html; charset=utf-8"));
+        let title = sanitize(&get_title(&html));
+
+        assert_eq!(encoding, encoding_rs::UTF_8);
+        assert_eq!(title, "Caf\u{FFFD} \u{FFFD}au lait\u{FFFD}");
+        assert_eq!(
+            sanitize(&String::from_utf8_lossy(b"Caf\xC3 \x00au\x07 lait\t\n")),
+            "Caf\u{FFFD} au lait\t\n"
+        );
+        assert!(!sanitize("\0\0").contains('\0'));
+    }
+
+    #[test]
+    fn test_decode_late_meta() {
+        let mut body = b"<html><head><!--".to_vec();
+        body.extend(std::iter::repeat(b' ').take(PRESCAN_LENGTH));
+        body.extend_from_slice(
+            b"--><meta charset=\"windows-1251\"><title>\xCF\xF0\xE8\xE2\xE5\xF2</title></head></html>",
+        );
+
+        let (html, encoding) = decode(&body, Some("text/html"));
+
+        assert_eq!(encoding, encoding_rs::WINDOWS_1251);
+        assert_eq!(get_title(&html), "Привет");
+    }
+
+    #[test]
+    fn test_is_document() {
+        let allowed_types = vec!["text/html".to_string(), "application/xhtml+xml".to_string()];
+
+        assert!(is_document(
+            Some("text/html; charset=utf-8"),
+            &allowed_types
+        ));
+        assert!(is_document(Some("Application/XHTML+XML"), &allowed_types));
+        assert!(is_document(None, &allowed_types));
+
+        assert!(!is_document(Some("text/plain"), &allowed_types));
+        assert!(!is_document(Some("image/png"), &allowed_types));
+        assert!(!is_document(Some("application/zip"), &allowed_types));
+
+        // A wildcard allows every subtype, but not types starting the same way.
+        let allowed_types = vec!["text/*".to_string()];
+        assert!(is_document(Some("text/plain"), &allowed_types));
+        assert!(!is_document(Some("textual/plain"), &allowed_types));
+        assert!(!is_document(Some("application/pdf"), &allowed_types));
+    }
+
+    #[test]
+    fn test_is_binary() {
+        assert!(is_binary(b"\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", None));
+        assert!(!is_binary(b"<html><body>Hello!</body></html>", None));
+
+        // UTF-16 text has NUL bytes, but isn't binary.
+        let utf_16 = "<html></html>"
+            .encode_utf16()
+            .flat_map(u16::to_le_bytes)
+            .collect::<Vec<_>>();
+        assert!(!is_binary(&utf_16, Some("text/html; charset=utf-16le")));
+        assert!(!is_binary(&[&[0xFF, 0xFE][..], &utf_16].concat(), None));
+        assert!(is_binary(&utf_16, None));
+    }
+
+    #[test]
+    fn test_decode_undeclared() {
+        // Windows-1251, without a declaration.
+        let body = b"<html><head><title>\xcf\xf0\xe8\xe2\xe5\xf2</title></head><body><p>\xdd\xf2\xee \xf2\xe5\xf1\xf2\xee\xe2\xe0\xff \xf1\xf2\xf0\xe0\xed\xe8\xf6\xe0 \xed\xe0 \xf0\xf3\xf1\xf1\xea\xee\xec \xff\xe7\xfb\xea\xe5, \xed\xe0\xef\xe8\xf1\xe0\xed\xed\xe0\xff \xe4\xeb\xff \xef\xf0\xee\xe2\xe5\xf0\xea\xe8 \xea\xee\xe4\xe8\xf0\xee\xe2\xea\xe8.</p></body></html>";
+        let (html, encoding) = decode(body, Some("text/html"));
+
+        assert_eq!(encoding, encoding_rs::WINDOWS_1251);
+        assert_eq!(get_title(&html), "Привет");
+
+        // ISO-8859-1, which is decoded as its superset Windows-1252.
+        let body = b"<html><head><title>Caf\xe9</title></head><body><p>Un caf\xe9 cr\xe8me et une cr\xeape \xe0 la fran\xe7aise, s'il vous pla\xeet, tr\xe8s \xe9l\xe9gant.</p></body></html>";
+        let (html, encoding) = decode(body, None);
+
+        assert_eq!(encoding, encoding_rs::WINDOWS_1252);
+        assert_eq!(get_title(&html), "Café");
+
+        // Valid UTF-8 is kept as it is.
+        let (html, encoding) = decode("<title>Grüße</title>".as_bytes(), None);
+
+        assert_eq!(encoding, UTF_8);
+        assert_eq!(get_title(&html), "Grüße");
+    }
+}
@@ -0,0 +1,95 @@
+use common::errors::Error;
+use common::{database, utils};
+use log::info;
+use std::time::{Duration, SystemTime};
+
+/// The number of stale pages removed at a time.
+const BATCH_SIZE: i64 = 500;
+
+/// Removes the pages that haven't been fetched successfully in a long time, or failed to be fetched too many times.
+///
+/// # Arguments
+///
+/// * `dry_run`: Whether to only list the stale pages, without removing them.
+///
+/// # Returns
+///
+/// * `Ok(usize)` - The number of pages removed, or that would be in a dry run.
+/// * `Err(Error)` - If the pages could not be removed.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the stale pages could not be retrieved or deleted.
+///
+/// # Notes
+///
+/// * Pages are removed in batches, so no batch holds its locks for long.
+/// * Pages are stale once their last 2xx or 304 response is `STALE_PAGE_AGE` old, or once fetching them failed `MAXIMUM_RETRY_ATTEMPTS` times.
+/// * Error responses don't count, so a page that keeps responding with `404` goes stale even though it's still crawled.
+pub async fn remove_stale_pages(dry_run: bool) -> Result<usize, Error> {
+    let Ok(mut conn) = database::get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    let succeeded_before =
+        get_succeeded_before(utils::env::crawler::get_stale_page_age(), SystemTime::now());
+
+    let mut removed = 0;
+    let mut last_id = 0;
+    loop {
+        let stale =
+            database::get_stale_pages_after(&mut conn, succeeded_before, last_id, BATCH_SIZE)
+                .await?;
+        let Some(&(id, _)) = stale.last() else {
+            break;
+        };
+        last_id = id;
+
+        if dry_run {
+            for (_, url) in &stale {
+                info!("Would remove {url}.");
+            }
+
+            removed += stale.len();
+            continue;
+        }
+
+        let page_ids = stale.iter().map(|(id, _)| *id).collect::<Vec<_>>();
+        removed += database::delete_pages(&mut conn, &page_ids).await?;
+        info!("Removed {removed} stale pages up to page {last_id} so far...");
+    }
+
+    Ok(removed)
+}
+
+/// Gets the time pages must have last been fetched successfully before to be stale.
+///
+/// # Arguments
+///
+/// * `age`: The age of stale pages, if they're removed for their age.
+/// * `now`: The current time.
+///
+/// # Returns
+///
+/// * `Some(SystemTime)` - The time, `age` before now.
+/// * `None` - If pages aren't removed for their age, or it's longer than the clock goes back.
+fn get_succeeded_before(age: Option<Duration>, now: SystemTime) -> Option<SystemTime> {
+    age.and_then(|age| now.checked_sub(age))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_get_succeeded_before() {
+        let now = SystemTime::UNIX_EPOCH + Duration::from_secs(1_000_000);
+
+        assert_eq!(
+            get_succeeded_before(Some(Duration::from_secs(1_000)), now),
+            Some(SystemTime::UNIX_EPOCH + Duration::from_secs(999_000))
+        );
+        assert_eq!(get_succeeded_before(None, now), None);
+    }
+}
@@ -0,0 +1,747 @@
+use common::utils;
+use reqwest::header::{HeaderMap, USER_AGENT};
+use reqwest::redirect::Policy;
+use reqwest::{Client, Proxy, Response};
+use std::time::Duration;
+use url::Url;
+
+/// The settings of the HTTP client used to crawl.
+///
+/// # Fields
+///
+/// * `timeout`: The timeout for requests.
+/// * `http2`: Whether HTTP/2 is negotiated with hosts that support it, instead of always using HTTP/1.1.
+/// * `idle_connections_per_host`: The maximum number of idle connections kept open per host.
+/// * `idle_connection_timeout`: The time an idle connection is kept open, if limited.
+/// * `tcp_keepalive`: The interval between TCP keep-alive probes, if enabled.
+/// * `cookies`: Whether cookies set by hosts are kept, and sent back with later requests to them.
+/// * `compression`: Whether hosts are asked to compress their responses with gzip or Brotli.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Settings {
+    pub timeout: Duration,
+    pub http2: bool,
+    pub idle_connections_per_host: usize,
+    pub idle_connection_timeout: Option<Duration>,
+    pub tcp_keepalive: Option<Duration>,
+    pub cookies: bool,
+    pub compression: bool,
+}
+
+impl Settings {
+    /// Loads the settings from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Settings` - The settings.
+    #[must_use]
+    pub fn load() -> Self {
+        Self {
+            timeout: utils::env::scraper::get_http_timeout(),
+            http2: utils::env::scraper::get_http2(),
+            idle_connections_per_host: utils::env::scraper::get_idle_connections_per_host(),
+            idle_connection_timeout: utils::env::scraper::get_idle_connection_timeout(),
+            tcp_keepalive: utils::env::scraper::get_tcp_keepalive(),
+            cookies: utils::env::scraper::get_cookies(),
+            compression: utils::env::scraper::get_compression(),
+        }
+    }
+
+    /// Builds an HTTP client with the settings.
+    ///
+    /// # Arguments
+    ///
+    /// * `headers`: The headers to send with every request.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Client)` - The HTTP client if successful.
+    /// * `Err(reqwest::Error)` - If the client could not be built.
+    ///
+    /// # Errors
+    ///
+    /// * If the TLS backend could not be initialized.
+    ///
+    /// # Notes
+    ///
+    /// * Connections are reused per host, so crawling the same host repeatedly doesn't pay for a new handshake every time.
+    pub fn build(&self, headers: HeaderMap) -> reqwest::Result<Client> {
+        self.build_through(headers, None)
+    }
+
+    /// Builds an HTTP client with the settings, connecting through a proxy.
+    ///
+    /// # Arguments
+    ///
+    /// * `headers`: The headers to send with every request.
+    /// * `proxy`: The proxy to send every request through, or `None` to use the proxies of the system.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Client)` - The HTTP client if successful.
+    /// * `Err(reqwest::Error)` - If the client could not be built.
+    ///
+    /// # Errors
+    ///
+    /// * If the TLS backend could not be initialized.
+    ///
+    /// # Notes
+    ///
+    /// * Unless cookies are enabled, cookies set by hosts are never sent back, and pages are indexed as a visitor without cookies sees them.
+    /// * Otherwise each client keeps its own cookies in memory, sending them only to the domains and paths they were set for, until the crawler stops.
+    /// * With compression enabled, `Accept-Encoding` asks for gzip or Brotli, and compressed responses are decompressed while they're read.
+    /// * Redirects are never followed by the client, so the crawler can check and record each hop itself.
+    pub fn build_through(
+        &self,
+        headers: HeaderMap,
+        proxy: Option<Proxy>,
+    ) -> reqwest::Result<Client> {
+        let mut builder = Client::builder()
+            .default_headers(headers)
+            .timeout(self.timeout)
+            .pool_max_idle_per_host(self.idle_connections_per_host)
+            .pool_idle_timeout(self.idle_connection_timeout)
+            .tcp_keepalive(self.tcp_keepalive)
+            .cookie_store(self.cookies)
+            .gzip(self.compression)
+            .brotli(self.compression)
+            .redirect(Policy::none());
+        if let Some(proxy) = proxy {
+            builder = builder.proxy(proxy);
+        }
+
+        if self.http2 {
+            builder.build()
+        } else {
+            builder.http1_only().build()
+        }
+    }
+}
+
+/// A pattern of the hosts crawled through a transport.
+///
+/// # Variants
+///
+/// * `Any`: Every host, from `*`.
+/// * `Domain`: A domain and its subdomains, from `*.onion` or `*.example.com`.
+/// * `Host`: A single host, from `example.com`.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum Pattern {
+    Any,
+    Domain(String),
+    Host(String),
+}
+
+impl Pattern {
+    /// Parses a host pattern.
+    ///
+    /// # Arguments
+    ///
+    /// * `pattern`: The pattern, like `*.onion`.
+    ///
+    /// # Returns
+    ///
+    /// * `Pattern` - The parsed pattern.
+    #[must_use]
+    pub fn parse(pattern: &str) -> Self {
+        let pattern = pattern.trim().trim_end_matches('.').to_lowercase();
+        if pattern == "*" {
+            return Self::Any;
+        }
+
+        pattern.strip_prefix("*.").map_or_else(
+            || Self::Host(pattern.clone()),
+            |domain| Self::Domain(domain.into()),
+        )
+    }
+
+    /// Checks if a host matches the pattern.
+    ///
+    /// # Arguments
+    ///
+    /// * `host`: The host, in lowercase.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the host matches.
+    #[must_use]
+    pub fn matches(&self, host: &str) -> bool {
+        match self {
+            Self::Any => true,
+            Self::Domain(domain) => host
+                .strip_suffix(domain.as_str())
+                .is_some_and(|rest| rest.is_empty() || rest.ends_with('.')),
+            Self::Host(pattern) => host == pattern,
+        }
+    }
+}
+
+/// The HTTP clients used to crawl, picked by the host of each URL.
+///
+/// # Fields
+///
+/// * `default`: The client of the hosts that don't match any route.
+/// * `routes`: The patterns of the hosts crawled through another transport, and the client of each, in order.
+#[derive(Debug, Clone)]
+pub struct Transports {
+    default: Client,
+    routes: Vec<(Pattern, Client)>,
+}
+
+impl Transports {
+    /// Creates transports that crawl every host with the same client.
+    ///
+    /// # Arguments
+    ///
+    /// * `default`: The client.
+    ///
+    /// # Returns
+    ///
+    /// * `Transports` - The transports.
+    #[must_use]
+    pub const fn new(default: Client) -> Self {
+        Self {
+            default,
+            routes: Vec::new(),
+        }
+    }
+
+    /// Builds a client for every route, along with the default client.
+    ///
+    /// # Arguments
+    ///
+    /// * `settings`: The settings of every client.
+    /// * `headers`: The headers to send with every request.
+    /// * `routes`: The host patterns and the URLs of the proxies they're crawled through, in order.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Transports)` - The transports if successful.
+    /// * `Err(reqwest::Error)` - If a client could not be built.
+    ///
+    /// # Errors
+    ///
+    /// * If the URL of a proxy is invalid, or uses an unsupported scheme.
+    /// * If the TLS backend could not be initialized.
+    ///
+    /// # Notes
+    ///
+    /// * Proxies can be HTTP, HTTPS or SOCKS5, where `socks5h` also resolves the hosts through the proxy, like Tor needs.
+    pub fn build(
+        settings: &Settings,
+        headers: &HeaderMap,
+        routes: &[(String, String)],
+    ) -> reqwest::Result<Self> {
+        let mut transports = Self::new(settings.build(headers.clone())?);
+        for (pattern, proxy) in routes {
+            let client = settings.build_through(headers.clone(), Some(Proxy::all(proxy)?))?;
+
+            transports.routes.push((Pattern::parse(pattern), client));
+        }
+
+        Ok(transports)
+    }
+
+    /// Gets the client to crawl a URL with.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL.
+    ///
+    /// # Returns
+    ///
+    /// * `&Client` - The client of the first route matching the host of the URL, or the default client.
+    ///
+    /// # Notes
+    ///
+    /// * The clients don't follow redirects, so each hop is requested with the client of the URL it leads to.
+    #[must_use]
+    pub fn get(&self, url: &Url) -> &Client {
+        let host = url.host_str().unwrap_or_default().trim_end_matches('.');
+
+        self.routes
+            .iter()
+            .find(|(pattern, _)| pattern.matches(host))
+            .map_or(&self.default, |(_, client)| client)
+    }
+}
+
+/// Builds the HTTP clients used to crawl from the environment.
+///
+/// # Returns
+///
+/// * `Ok(Transports)` - The HTTP clients if successful.
+/// * `Err(reqwest::Error)` - If a client could not be built.
+///
+/// # Errors
+///
+/// * If the URL of a proxy in `TRANSPORTS` is invalid.
+/// * If the TLS backend could not be initialized.
+pub fn build() -> reqwest::Result<Transports> {
+    let mut headers = HeaderMap::new();
+    headers.insert(USER_AGENT, utils::env::scraper::get_user_agent());
+
+    Transports::build(
+        &Settings::load(),
+        &headers,
+        &utils::env::scraper::get_transports(),
+    )
+}
+
+/// Reads the body of a response, without downloading more than the maximum size.
+///
+/// # Arguments
+///
+/// * `response`: The response.
+/// * `maximum_size`: The maximum size of the body in bytes, if limited.
+///
+/// # Returns
+///
+/// * `Ok(Some(Vec<u8>))` - The body, cut off at the maximum size.
+/// * `Ok(None)` - If the response declares a `Content-Length` above the maximum size, so none of it was downloaded.
+/// * `Err(reqwest::Error)` - If the body could not be read.
+///
+/// # Errors
+///
+/// * If the connection fails while the body is read.
+///
+/// # Notes
+///
+/// * Bodies without a `Content-Length`, or with one of `0`, are streamed until they reach the maximum size.
+/// * Compressed bodies are decompressed while they're streamed, so the maximum size applies to the decompressed bytes.
+pub async fn read_body(
+    response: Response,
+    maximum_size: Option<usize>,
+) -> reqwest::Result<Option<Vec<u8>>> {
+    let Some(maximum_size) = maximum_size else {
+        return Ok(Some(response.bytes().await?.to_vec()));
+    };
+
+    let declared_size = response.content_length().unwrap_or_default();
+    if declared_size > u64::try_from(maximum_size).unwrap_or(u64::MAX) {
+        return Ok(None);
+    }
+
+    read_prefix(response, maximum_size).await.map(Some)
+}
+
+/// Reads the start of the body of a response, streaming it until it reaches the maximum size.
+///
+/// # Arguments
+///
+/// * `response`: The response.
+/// * `maximum_size`: The maximum size of the body in bytes.
+///
+/// # Returns
+///
+/// * `Ok(Vec<u8>)` - The body, cut off at the maximum size.
+/// * `Err(reqwest::Error)` - If the body could not be read.
+///
+/// # Errors
+///
+/// * If the connection fails while the body is read.
+///
+/// # Notes
+///
+/// * Unlike `read_body`, the `Content-Length` is ignored, so a body declared larger than the maximum size is still read up to it.
+pub async fn read_prefix(mut response: Response, maximum_size: usize) -> reqwest::Result<Vec<u8>> {
+    let mut body = Vec::new();
+    while let Some(chunk) = response.chunk().await? {
+        let remaining = maximum_size - body.len();
+        if chunk.len() >= remaining {
+            body.extend_from_slice(&chunk[..remaining]);
+
+            break;
+        }
+
+        body.extend_from_slice(&chunk);
+    }
+
+    Ok(body)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use flate2::write::GzEncoder;
+    use flate2::Compression;
+    use reqwest::StatusCode;
+    use std::io::Write;
+    use std::sync::atomic::{AtomicUsize, Ordering};
+    use std::sync::Arc;
+    use tokio::io::{AsyncReadExt, AsyncWriteExt};
+    use tokio::net::TcpListener;
+
+    /// Serves `200 OK` to every request over HTTP/1.1, counting the connections it accepts.
+    #[allow(clippy::expect_used)]
+    async fn serve() -> (String, Arc<AtomicUsize>) {
+        let listener = TcpListener::bind("127.0.0.1:0")
+            .await
+            .expect("Failed to bind listener!");
+        let address = listener.local_addr().expect("Failed to get address!");
+        let connections = Arc::new(AtomicUsize::new(0));
+
+        let counter = connections.clone();
+        tokio::spawn(async move {
+            while let Ok((mut stream, _)) = listener.accept().await {
+                counter.fetch_add(1, Ordering::SeqCst);
+
+                tokio::spawn(async move {
+                    let mut request = Vec::new();
+                    let mut buffer = [0; 1024];
+                    while let Ok(read) = stream.read(&mut buffer).await {
+                        if read == 0 {
+                            break;
+                        }
+                        request.extend_from_slice(&buffer[..read]);
+
+                        // Answer each request once its headers are in, keeping the connection open.
+                        while let Some(end) = request.windows(4).position(|w| w == b"\r\n\r\n") {
+                            request.drain(..end + 4);
+
+                            if stream
+                                .write_all(b"HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+                                .await
+                                .is_err()
+                            {
+                                return;
+                            }
+                        }
+                    }
+                });
+            }
+        });
+
+        (format!("http://{address}/"), connections)
+    }
+
+    /// Serves the same response to every connection, closing it right after.
+    #[allow(clippy::expect_used)]
+    async fn serve_response(response: Vec<u8>) -> String {
+        let listener = TcpListener::bind("127.0.0.1:0")
+            .await
+            .expect("Failed to bind listener!");
+        let address = listener.local_addr().expect("Failed to get address!");
+
+        tokio::spawn(async move {
+            while let Ok((mut stream, _)) = listener.accept().await {
+                let mut buffer = [0; 1024];
+                let _ = stream.read(&mut buffer).await;
+                let _ = stream.write_all(&response).await;
+            }
+        });
+
+        format!("http://{address}/")
+    }
+
+    fn get_settings(idle_connections_per_host: usize) -> Settings {
+        Settings {
+            timeout: Duration::from_secs(5),
+            http2: true,
+            idle_connections_per_host,
+            idle_connection_timeout: Some(Duration::from_secs(90)),
+            tcp_keepalive: Some(Duration::from_secs(60)),
+            cookies: false,
+            compression: true,
+        }
+    }
+
+    #[tokio::test]
+    #[allow(clippy::expect_used)]
+    async fn test_connection_reuse() {
+        let (url, connections) = serve().await;
+        let client = get_settings(8)
+            .build(HeaderMap::new())
+            .expect("Failed to build client!");
+
+        for _ in 0..5 {
+            let body = client
+                .get(&url)
+                .send()
+                .await
+                .expect("Failed to send request!")
+                .text()
+                .await
+                .expect("Failed to read response!");
+            assert_eq!(body, "ok");
+        }
+
+        assert_eq!(connections.load(Ordering::SeqCst), 1);
+    }
+
+    #[tokio::test]
+    #[allow(clippy::expect_used)]
+    async fn test_no_idle_connections() {
+        let (url, connections) = serve().await;
+        let client = get_settings(0)
+            .build(HeaderMap::new())
+            .expect("Failed to build client!");
+
+        for _ in 0..3 {
+            client
+                .get(&url)
+                .send()
+                .await
+                .expect("Failed to send request!")
+                .text()
+                .await
+                .expect("Failed to read response!");
+        }
+
+        // Without idle connections, every request needs a connection of its own.
+        assert_eq!(connections.load(Ordering::SeqCst), 3);
+    }
+
+    #[tokio::test]
+    #[allow(clippy::expect_used)]
+    async fn test_declared_size() {
+        // The declared body is never sent, so reading it would hang until the timeout.
+        let url =
+            serve_response(b"HTTP/1.1 200 OK\r\nContent-Length: 10000000\r\n\r\n<html>".to_vec())
+                .await;
+        let client = get_settings(0)
+            .build(HeaderMap::new())
+            .expect("Failed to build client!");
+
+        let response = client
+            .get(&url)
+            .send()
+            .await
+            .expect("Failed to send request!");
+        assert_eq!(
+            read_body(response, Some(1_024))
+                .await
+                .expect("Failed to read body!"),
+            None
+        );
+    }
+
+    #[tokio::test]
+    #[allow(clippy::expect_used)]
+    async fn test_streamed_size() {
+        // Without a declared length, the body is streamed until it reaches the maximum size.
+        let mut response = b"HTTP/1.1 200 OK\r\nConnection: close\r\n\r\n".to_vec();
+        response.extend([b'a'; 4_096]);
+        let url = serve_response(response).await;
+        let client = get_settings(0)
+            .build(HeaderMap::new())
+            .expect("Failed to build client!");
+
+        for (maximum_size, size) in [(Some(1_024), 1_024), (None, 4_096)] {
+            let response = client
+                .get(&url)
+                .send()
+                .await
+                .expect("Failed to send request!");
+            let body = read_body(response, maximum_size)
+                .await
+                .expect("Failed to read body!")
+                .expect("Missing body!");
+
+            assert_eq!(body.len(), size);
+        }
+    }
+
+    #[tokio::test]
+    #[allow(clippy::expect_used)]
+    async fn test_read_prefix() {
+        // The declared body is larger than the maximum size, but its start is still read.
+        let mut response = b"HTTP/1.1 200 OK\r\nContent-Length: 4096\r\n\r\n".to_vec();
+        response.extend([b'a'; 4_096]);
+        let url = serve_response(response).await;
+        let client = get_settings(0)
+            .build(HeaderMap::new())
+            .expect("Failed to build client!");
+
+        let response = client
+            .get(&url)
+            .send()
+            .await
+            .expect("Failed to send request!");
+        assert_eq!(
+            read_prefix(response, 1_024)
+                .await
+                .expect("Failed to read body!"),
+            vec![b'a'; 1_024]
+        );
+    }
+
+    #[tokio::test]
+    #[allow(clippy::expect_used)]
+    async fn test_cookies() {
+        // Redirects back to the page, setting the cookie, until the cookie is sent along.
+        let listener = TcpListener::bind("127.0.0.1:0")
+            .await
+            .expect("Failed to bind listener!");
+        let address = listener.local_addr().expect("Failed to get address!");
+        tokio::spawn(async move {
+            while let Ok((mut stream, _)) = listener.accept().await {
+                let mut buffer = [0; 4_096];
+                let read = stream.read(&mut buffer).await.unwrap_or_default();
+                let request = String::from_utf8_lossy(&buffer[..read]).to_lowercase();
+
+                let response: &[u8] = if request.contains("cookie: consent=yes") {
+                    b"HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 7\r\n\r\ncontent"
+                } else {
+                    b"HTTP/1.1 302 Found\r\nConnection: close\r\nLocation: /\r\nSet-Cookie: consent=yes; Path=/\r\nContent-Length: 0\r\n\r\n"
+                };
+                let _ = stream.write_all(response).await;
+            }
+        });
+        let url = format!("http://{address}/");
+
+        // The redirect isn't followed, but the cookie it sets is sent along with the next request.
+        for (cookies, status) in [(true, StatusCode::OK), (false, StatusCode::FOUND)] {
+            let mut settings = get_settings(0);
+            settings.cookies = cookies;
+            let client = settings
+                .build(HeaderMap::new())
+                .expect("Failed to build client!");
+
+            let response = client
+                .get(&url)
+                .send()
+                .await
+                .expect("Failed to send request!");
+            assert_eq!(response.status(), StatusCode::FOUND);
+
+            let response = client
+                .get(&url)
+                .send()
+                .await
+                .expect("Failed to send request!");
+            assert_eq!(response.status(), status);
+        }
+    }
+
+    #[tokio::test]
+    #[allow(clippy::expect_used)]
+    async fn test_compression() {
+        // Sends a gzipped body when it's asked for, and a plain one otherwise.
+        let listener = TcpListener::bind("127.0.0.1:0")
+            .await
+            .expect("Failed to bind listener!");
+        let address = listener.local_addr().expect("Failed to get address!");
+        let mut encoder = GzEncoder::new(Vec::new(), Compression::default());
+        encoder
+            .write_all(&[b'a'; 4_096])
+            .expect("Failed to compress body!");
+        let compressed = encoder.finish().expect("Failed to compress body!");
+        tokio::spawn(async move {
+            while let Ok((mut stream, _)) = listener.accept().await {
+                let mut buffer = [0; 4_096];
+                let read = stream.read(&mut buffer).await.unwrap_or_default();
+                let request = String::from_utf8_lossy(&buffer[..read]).to_lowercase();
+
+                let accepted = request
+                    .lines()
+                    .find(|line| line.starts_with("accept-encoding:"))
+                    .is_some_and(|line| line.contains("gzip") && line.contains("br"));
+
+                let response = if accepted {
+                    let mut response = format!(
+                        "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Encoding: gzip\r\nContent-Length: {}\r\n\r\n",
+                        compressed.len()
+                    )
+                    .into_bytes();
+                    response.extend_from_slice(&compressed);
+
+                    response
+                } else {
+                    b"HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 5\r\n\r\nplain"
+                        .to_vec()
+                };
+                let _ = stream.write_all(&response).await;
+            }
+        });
+        let url = format!("http://{address}/");
+
+        let client = get_settings(0)
+            .build(HeaderMap::new())
+            .expect("Failed to build client!");
+        for (maximum_size, size) in [(None, 4_096), (Some(1_024), 1_024)] {
+            let response = client
+                .get(&url)
+                .send()
+                .await
+                .expect("Failed to send request!");
+            let body = read_body(response, maximum_size)
+                .await
+                .expect("Failed to read body!")
+                .expect("Missing body!");
+
+            // The maximum size applies to the decompressed body.
+            assert_eq!(body, vec![b'a'; size]);
+        }
+
+        let mut settings = get_settings(0);
+        settings.compression = false;
+        let client = settings
+            .build(HeaderMap::new())
+            .expect("Failed to build client!");
+        let body = client
+            .get(&url)
+            .send()
+            .await
+            .expect("Failed to send request!")
+            .text()
+            .await
+            .expect("Failed to read response!");
+        assert_eq!(body, "plain");
+    }
+
+    #[test]
+    fn test_patterns() {
+        assert_eq!(Pattern::parse("*"), Pattern::Any);
+        assert_eq!(Pattern::parse("*.Onion"), Pattern::Domain("onion".into()));
+        assert_eq!(
+            Pattern::parse("example.com."),
+            Pattern::Host("example.com".into())
+        );
+
+        let onion = Pattern::parse("*.onion");
+        assert!(onion.matches("example.onion"));
+        assert!(onion.matches("www.example.onion"));
+        assert!(onion.matches("onion"));
+        assert!(!onion.matches("example.notonion"));
+        assert!(!onion.matches("onion.com"));
+
+        let host = Pattern::parse("example.com");
+        assert!(host.matches("example.com"));
+        assert!(!host.matches("www.example.com"));
+    }
+
+    #[tokio::test]
+    #[allow(clippy::expect_used)]
+    async fn test_transports() {
+        let proxy = serve_response(
+            b"HTTP/1.1 200 OK\r\nContent-Length: 7\r\nConnection: close\r\n\r\nproxied".to_vec(),
+        )
+        .await;
+        let transports = Transports::build(
+            &get_settings(0),
+            &HeaderMap::new(),
+            &[("*.onion".into(), proxy)],
+        )
+        .expect("Failed to build transports!");
+
+        // The host doesn't exist, so only the proxy can answer.
+        let url = Url::parse("http://example.onion/").expect("Failed to parse URL!");
+        let body = transports
+            .get(&url)
+            .get(url.clone())
+            .send()
+            .await
+            .expect("Failed to send request!")
+            .text()
+            .await
+            .expect("Failed to read response!");
+        assert_eq!(body, "proxied");
+
+        assert!(Transports::build(
+            &get_settings(0),
+            &HeaderMap::new(),
+            &[("*".into(), "not a proxy".into())],
+        )
+        .is_err());
+    }
+}
@@ -0,0 +1,172 @@
+use common::database;
+use common::errors::Error;
+use common::utils::compression::{self, Codec, Format};
+use log::{info, warn};
+use std::path::Path;
+
+/// The number of pages compressed at a time.
+const BATCH_SIZE: i64 = 500;
+
+/// The number of pages a dictionary is trained on.
+const SAMPLE_SIZE: usize = 10_000;
+
+/// How much space compressing the stored text of pages saved.
+///
+/// # Fields
+///
+/// * `pages`: The number of pages whose text was compressed.
+/// * `before`: The size of their text before in bytes.
+/// * `after`: The size of their text after in bytes.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub struct Savings {
+    pub pages: usize,
+    pub before: usize,
+    pub after: usize,
+}
+
+impl Savings {
+    /// Gets the share of the space that was saved.
+    ///
+    /// # Returns
+    ///
+    /// * `f64` - The saved bytes over the bytes before, `0` if nothing was compressed.
+    #[must_use]
+    #[allow(clippy::cast_precision_loss)]
+    pub fn ratio(&self) -> f64 {
+        if self.before == 0 {
+            return 0.0;
+        }
+
+        self.before.saturating_sub(self.after) as f64 / self.before as f64
+    }
+}
+
+/// Compresses the stored text of every page that isn't stored the way the codec stores it.
+///
+/// # Arguments
+///
+/// * `codec`: The codec to compress the text with.
+///
+/// # Returns
+///
+/// * `Ok(Savings)` - How much space was saved.
+/// * `Err(Error)` - If the text could not be compressed.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the text could not be retrieved, decompressed or replaced.
+///
+/// # Notes
+///
+/// * Pages are compressed in batches, so only a batch is kept in memory.
+/// * Plain text written before compression is compressed, and so is text compressed without the dictionary once one is set.
+pub async fn compress(codec: &Codec) -> Result<Savings, Error> {
+    let Ok(mut conn) = database::get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    let mut savings = Savings::default();
+    let mut last_id = 0;
+    loop {
+        let stored = database::get_page_contents_after(&mut conn, last_id, BATCH_SIZE).await?;
+        let Some(&(id, _)) = stored.last() else {
+            break;
+        };
+        last_id = id;
+
+        let mut contents = Vec::new();
+        for (page_id, content) in stored {
+            if Format::of(&content) == codec.format() {
+                continue;
+            }
+
+            let compressed = codec.compress(&codec.decompress(&content)?)?;
+            savings.pages += 1;
+            savings.before += content.len();
+            savings.after += compressed.len();
+
+            contents.push((page_id, compressed));
+        }
+
+        database::update_page_contents(&mut conn, &contents).await?;
+        info!(
+            "Compressed {} pages up to page {last_id}, saving {:.1}% so far...",
+            savings.pages,
+            savings.ratio() * 100.0
+        );
+    }
+
+    Ok(savings)
+}
+
+/// Trains a shared dictionary on the stored text of the first pages, and saves it.
+///
+/// # Arguments
+///
+/// * `path`: The path of the file to save the dictionary to.
+///
+/// # Returns
+///
+/// * `Ok(usize)` - The number of pages the dictionary was trained on.
+/// * `Err(Error)` - If the dictionary could not be trained.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the text could not be retrieved or decompressed.
+/// * If there's too little text to train a dictionary on, or it could not be saved.
+///
+/// # Notes
+///
+/// * Text compressed with a dictionary other than the one set is skipped.
+pub async fn train(path: &Path) -> Result<usize, Error> {
+    let Ok(mut conn) = database::get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    let codec = Codec::load()?;
+    let mut samples = Vec::new();
+    let mut last_id = 0;
+    while samples.len() < SAMPLE_SIZE {
+        let stored = database::get_page_contents_after(&mut conn, last_id, BATCH_SIZE).await?;
+        let Some(&(id, _)) = stored.last() else {
+            break;
+        };
+        last_id = id;
+
+        for (page_id, content) in stored {
+            match codec.decompress(&content) {
+                Ok(text) if !text.is_empty() => samples.push(text),
+                Ok(_) => {}
+                Err(err) => warn!(
+                    "Skipping the text of page {page_id} ({}): {err}",
+                    err.code()
+                ),
+            }
+        }
+    }
+    samples.truncate(SAMPLE_SIZE);
+
+    let dictionary = compression::train(&samples)?;
+    std::fs::write(path, dictionary)?;
+
+    Ok(samples.len())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_ratio() {
+        let savings = Savings {
+            pages: 2,
+            before: 1_000,
+            after: 250,
+        };
+
+        assert!((savings.ratio() - 0.75).abs() < f64::EPSILON);
+        assert!(Savings::default().ratio().abs() < f64::EPSILON);
+    }
+}
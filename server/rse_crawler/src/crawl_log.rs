@@ -0,0 +1,384 @@
+use common::database;
+use common::database::model::NewCrawlEvent;
+use common::errors::Error;
+use log::{error, info};
+use serde::Serialize;
+use std::sync::{Arc, Mutex};
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+use tokio::sync::broadcast;
+use url::Url;
+
+/// The number of live events each subscriber can fall behind by, before the oldest ones are dropped for it.
+const SUBSCRIBER_CAPACITY: usize = 1_024;
+
+/// What happened to a URL.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Kind {
+    /// The URL was fetched.
+    Fetched,
+    /// The page was handed to the writer to be indexed.
+    Indexed,
+    /// The crawl of the URL failed.
+    Failed,
+}
+
+/// A live event of a crawl, sent to the subscribers as it happens.
+///
+/// # Fields
+///
+/// * `kind`: What happened to the URL.
+/// * `url`: The URL.
+/// * `status`: The HTTP status code of the response, if there was one.
+/// * `error_code`: The code of the error the crawl failed with, if any.
+/// * `at`: When it happened, in seconds since the Unix epoch.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Event {
+    pub kind: Kind,
+    pub url: String,
+    pub status: Option<u16>,
+    pub error_code: Option<String>,
+    pub at: u64,
+}
+
+/// The crawls of a crawl run, kept in memory between flushes.
+///
+/// # Fields
+///
+/// * `events`: The crawls since the last flush, oldest first.
+/// * `live`: The channel live events are sent to the subscribers through.
+#[derive(Debug)]
+pub struct CrawlLog {
+    events: Mutex<Vec<NewCrawlEvent>>,
+    live: broadcast::Sender<Event>,
+}
+
+impl Kind {
+    /// Gets the name of the kind.
+    ///
+    /// # Returns
+    ///
+    /// * `&str` - The name, like `fetched`.
+    #[must_use]
+    pub const fn as_str(self) -> &'static str {
+        match self {
+            Self::Fetched => "fetched",
+            Self::Indexed => "indexed",
+            Self::Failed => "failed",
+        }
+    }
+}
+
+impl Event {
+    /// Creates a new event, happening now.
+    ///
+    /// # Arguments
+    ///
+    /// * `kind`: What happened to the URL.
+    /// * `url`: The URL.
+    /// * `status`: The HTTP status code of the response, if there was one.
+    /// * `err`: The error the crawl failed with, if any.
+    ///
+    /// # Returns
+    ///
+    /// * `Event` - The new event.
+    fn new(kind: Kind, url: &Url, status: Option<u16>, err: Option<&Error>) -> Self {
+        Self {
+            kind,
+            url: url.to_string(),
+            status,
+            error_code: err.map(|err| err.code().to_string()),
+            at: SystemTime::now()
+                .duration_since(UNIX_EPOCH)
+                .unwrap_or_default()
+                .as_secs(),
+        }
+    }
+
+    /// Formats the event as a server-sent event.
+    ///
+    /// # Returns
+    ///
+    /// * `String` - The event, named after its kind, with the event as JSON for its data.
+    #[must_use]
+    pub fn to_sse(&self) -> String {
+        format!(
+            "event: {}\ndata: {}\n\n",
+            self.kind.as_str(),
+            serde_json::to_string(self).unwrap_or_default()
+        )
+    }
+}
+
+impl Default for CrawlLog {
+    fn default() -> Self {
+        Self::new(SUBSCRIBER_CAPACITY)
+    }
+}
+
+impl CrawlLog {
+    /// Creates a new crawl log.
+    ///
+    /// # Arguments
+    ///
+    /// * `capacity`: The number of live events each subscriber can fall behind by.
+    ///
+    /// # Returns
+    ///
+    /// * `CrawlLog` - The new crawl log.
+    ///
+    /// # Panics
+    ///
+    /// * If the capacity is `0`.
+    #[must_use]
+    pub fn new(capacity: usize) -> Self {
+        Self {
+            events: Mutex::new(Vec::new()),
+            live: broadcast::channel(capacity).0,
+        }
+    }
+
+    /// Subscribes to the live events, from now on.
+    ///
+    /// # Returns
+    ///
+    /// * `broadcast::Receiver<Event>` - The receiver of the events.
+    ///
+    /// # Notes
+    ///
+    /// * A subscriber that falls behind loses the oldest events, the crawler never waits for it.
+    #[must_use]
+    pub fn subscribe(&self) -> broadcast::Receiver<Event> {
+        self.live.subscribe()
+    }
+
+    /// Sends a live event to the subscribers, if there are any.
+    ///
+    /// # Arguments
+    ///
+    /// * `event`: The event.
+    fn publish(&self, event: Event) {
+        // Sending only fails if there are no subscribers, in which case the event is dropped.
+        let _ = self.live.send(event);
+    }
+
+    /// Records that a page was handed to the writer to be indexed.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the page.
+    ///
+    /// # Notes
+    ///
+    /// * It's only sent to the live subscribers, the crawl itself is already recorded.
+    pub fn record_indexed(&self, url: &Url) {
+        self.publish(Event::new(Kind::Indexed, url, None, None));
+    }
+
+    /// Records a crawl.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL that was crawled.
+    /// * `status`: The HTTP status code of the response, if there was one.
+    /// * `err`: The error the crawl failed with, if any.
+    pub fn record(&self, url: &Url, status: Option<u16>, err: Option<&Error>) {
+        let Some(host) = url.host_str() else {
+            return;
+        };
+
+        let event = NewCrawlEvent {
+            url: url.to_string(),
+            host: host.to_string(),
+            status: status.map(i32::from),
+            error_code: err.map(|err| err.code().to_string()),
+            crawled_at: SystemTime::now(),
+        };
+
+        if let Ok(mut events) = self.events.lock() {
+            events.push(event);
+        }
+
+        let kind = if err.is_some() {
+            Kind::Failed
+        } else {
+            Kind::Fetched
+        };
+        self.publish(Event::new(kind, url, status, err));
+    }
+
+    /// Writes the crawls recorded since the last flush to the database.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(usize)` - The number of crawls written.
+    /// * `Err(Error)` - If the crawls could not be written.
+    ///
+    /// # Errors
+    ///
+    /// * If the crawls could not be added to the database, in which case they're kept for the next flush.
+    pub async fn flush(&self) -> Result<usize, Error> {
+        let events = self.take();
+        if events.is_empty() {
+            return Ok(0);
+        }
+
+        if let Err(err) = database::add_crawl_events(&events).await {
+            self.restore(events);
+
+            return Err(err);
+        }
+
+        Ok(events.len())
+    }
+
+    /// Flushes the crawls to the database in the background, every interval.
+    ///
+    /// # Arguments
+    ///
+    /// * `crawl_log`: The crawls to flush.
+    /// * `interval`: The interval between each flush.
+    pub fn flush_every(crawl_log: Arc<Self>, interval: Duration) {
+        tokio::spawn(async move {
+            loop {
+                tokio::time::sleep(interval).await;
+
+                match crawl_log.flush().await {
+                    Ok(0) => {}
+                    Ok(events) => info!("Flushed {events} crawls to the crawl log."),
+                    Err(err) => error!("Failed to flush crawl log ({}): {err}", err.code()),
+                }
+            }
+        });
+    }
+
+    /// Takes the crawls recorded since the last flush.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<NewCrawlEvent>` - The crawls, oldest first.
+    fn take(&self) -> Vec<NewCrawlEvent> {
+        self.events
+            .lock()
+            .map(|mut events| std::mem::take(&mut *events))
+            .unwrap_or_default()
+    }
+
+    /// Puts back crawls that could not be flushed, ahead of the ones recorded since.
+    ///
+    /// # Arguments
+    ///
+    /// * `events`: The crawls, oldest first.
+    fn restore(&self, mut events: Vec<NewCrawlEvent>) {
+        if let Ok(mut recorded) = self.events.lock() {
+            events.append(&mut recorded);
+            *recorded = events;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_record() {
+        let url = |url: &str| Url::parse(url).expect("Failed to parse URL!");
+        let crawl_log = CrawlLog::default();
+
+        crawl_log.record(&url("https://example.com/"), Some(200), None);
+        crawl_log.record(
+            &url("https://example.com/private"),
+            None,
+            Some(&Error::RobotsDisallowed(String::new())),
+        );
+
+        let events = crawl_log.take();
+        assert_eq!(
+            events
+                .iter()
+                .map(|event| (
+                    event.url.as_str(),
+                    event.host.as_str(),
+                    event.status,
+                    event.error_code.as_deref()
+                ))
+                .collect::<Vec<_>>(),
+            vec![
+                ("https://example.com/", "example.com", Some(200), None),
+                (
+                    "https://example.com/private",
+                    "example.com",
+                    None,
+                    Some("robots_disallowed")
+                ),
+            ]
+        );
+        assert!(crawl_log.take().is_empty());
+
+        // Crawls that failed to flush go back ahead of the ones recorded since.
+        crawl_log.record(&url("https://example.com/later"), Some(404), None);
+        crawl_log.restore(events);
+        assert_eq!(
+            crawl_log
+                .take()
+                .iter()
+                .map(|event| event.url.as_str())
+                .collect::<Vec<_>>(),
+            vec![
+                "https://example.com/",
+                "https://example.com/private",
+                "https://example.com/later",
+            ]
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_subscribe() {
+        let url = |url: &str| Url::parse(url).expect("Failed to parse URL!");
+        let crawl_log = CrawlLog::new(2);
+
+        // Events without subscribers are dropped.
+        crawl_log.record(&url("https://example.com/before"), Some(200), None);
+
+        let mut receiver = crawl_log.subscribe();
+        crawl_log.record(&url("https://example.com/"), Some(200), None);
+        crawl_log.record_indexed(&url("https://example.com/"));
+
+        let event = receiver.try_recv().expect("Failed to receive event!");
+        assert_eq!(
+            (event.kind, event.url.as_str(), event.status),
+            (Kind::Fetched, "https://example.com/", Some(200))
+        );
+        assert!(event
+            .to_sse()
+            .starts_with("event: fetched\ndata: {\"kind\":\"fetched\","));
+        assert!(event.to_sse().ends_with("}\n\n"));
+        assert_eq!(
+            receiver.try_recv().map(|event| event.kind),
+            Ok(Kind::Indexed)
+        );
+
+        // A subscriber that falls behind loses the oldest events, instead of holding up the crawl.
+        for page in 0..5 {
+            crawl_log.record(
+                &url(&format!("https://example.com/{page}")),
+                None,
+                Some(&Error::Timeout(String::new())),
+            );
+        }
+        assert_eq!(
+            receiver.try_recv(),
+            Err(broadcast::error::TryRecvError::Lagged(3))
+        );
+
+        let event = receiver.try_recv().expect("Failed to receive event!");
+        assert_eq!(
+            (event.kind, event.url.as_str(), event.error_code.as_deref()),
+            (Kind::Failed, "https://example.com/3", Some("timeout"))
+        );
+        assert_eq!(crawl_log.take().len(), 7);
+    }
+}
@@ -1,10 +1,22 @@
+use crate::decision::Evaluator;
+use crate::exclusions::Exclusions;
+use crate::frontier::Frontier;
+use crate::retries::Retries;
 use crate::scrapers::Scraper;
+use crate::throttle::Throttle;
+use crate::traps::Traps;
+use common::errors::Error;
+use common::utils::urls::{HostAliases, TrackingParameters};
+use common::{database, utils};
 use futures::StreamExt;
-use log::{error, info};
+use log::{debug, error, info, warn};
+use rand::rngs::StdRng;
+use rand::{Rng, SeedableRng};
 use std::collections::{HashMap, HashSet};
-use std::sync::atomic::{AtomicUsize, Ordering};
+use std::sync::atomic::{AtomicBool, AtomicUsize, Ordering};
 use std::sync::Arc;
-use std::time::Duration;
+use std::time::{Duration, Instant};
+use tokio::sync::mpsc::error::TrySendError;
 use tokio::sync::{mpsc, Barrier};
 use tokio_stream::wrappers::ReceiverStream;
 use url::Url;
@@ -15,20 +27,89 @@ pub const SCRAPER_QUEUE_CAPACITY_MULTIPLIER: usize = 400;
 /// The maximum number of items that can be in the queues at once. If it's exceeded, the control loop will exit.
 pub const PROCESSOR_QUEUE_CAPACITY_MULTIPLIER: usize = 10;
 
+/// The number of frontier entries written to the database at once when taking a snapshot.
+pub const FRONTIER_SNAPSHOT_BATCH_SIZE: usize = 1_000;
+
+/// The maximum number of submitted URLs queued at once.
+pub const SUBMISSION_BATCH_SIZE: i64 = 100;
+
+/// The URLs recrawled periodically, like the front pages of news sites, to find new content on them quickly.
+///
+/// # Fields
+///
+/// * `urls`: The URLs to recrawl.
+/// * `interval`: The interval between each recrawl.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Freshness {
+    pub urls: Vec<Url>,
+    pub interval: Duration,
+}
+
+impl Freshness {
+    /// Loads the fresh URLs from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Freshness)` - The fresh URLs and how often to recrawl them.
+    /// * `None` - If there are no fresh URLs, or recrawling them is disabled.
+    #[must_use]
+    pub fn load() -> Option<Self> {
+        let host_aliases = HostAliases::load();
+        let tracking_parameters = TrackingParameters::load();
+        let urls = utils::env::crawler::get_fresh_urls()
+            .iter()
+            .map(|url| host_aliases.apply(&tracking_parameters.strip(&utils::urls::normalize(url))))
+            .collect::<Vec<_>>();
+        let interval = utils::env::crawler::get_freshness_interval()?;
+
+        (!urls.is_empty()).then_some(Self { urls, interval })
+    }
+}
+
 /// A crawler is responsible for orchestrating the crawling of URLs.
 ///
 /// # Fields
 ///
 /// * `delay`: The delay between requests.
 ///
+/// * `scrapers`: The number of scrapers fetching URLs at once.
 /// * `scraper_queue_capacity`: The maximum number of items that can be in the scraper queue at once.
 /// * `processor_queue_capacity`: The maximum number of items that can be in the processor queue at once.
+///
+/// * `snapshot_interval`: The interval between frontier snapshots, if enabled.
+///
+/// * `evaluator`: The evaluator of the scrapers, so links past its maximum depth aren't queued.
+/// * `sample_rate`: The probability of a discovered link being queued.
+/// * `sample_seed`: The seed of the random number generator used for sampling, if any.
+/// * `traps`: The detection of spider traps, capping how many discovered URLs in them are queued per host, if enabled.
+/// * `exclusions`: The rules of the discovered URLs that are never queued, if any.
+///
+/// * `freshness`: The URLs recrawled periodically, if any.
+/// * `submission_interval`: The interval between each check for submitted URLs, if enabled.
+/// * `retries`: The URLs that failed to be fetched, retried later, if enabled.
+///
+/// * `throttle`: The global slowdown while many hosts throttle the crawl.
 #[derive(Debug)]
 pub struct Crawler {
     delay: Duration,
 
+    scrapers: usize,
     scraper_queue_capacity: usize,
     processor_queue_capacity: usize,
+
+    snapshot_interval: Option<Duration>,
+
+    evaluator: Evaluator,
+    sample_rate: f64,
+    sample_seed: Option<u64>,
+    traps: Option<Traps>,
+    exclusions: Option<Exclusions>,
+
+    freshness: Option<Freshness>,
+    submission_interval: Option<Duration>,
+    retries: Option<Arc<Retries>>,
+
+    throttle: Arc<Throttle>,
 }
 
 impl Crawler {
@@ -40,12 +121,56 @@ impl Crawler {
     ///
     /// * `scrapers` - The number of scrapers running at once.
     /// * `processors` - The number of processors running at once.
-    pub const fn new(delay: Duration, scrapers: usize, processors: usize) -> Self {
+    ///
+    /// * `snapshot_interval` - The interval between frontier snapshots, if enabled.
+    ///
+    /// * `evaluator` - The evaluator of the scrapers, so links past its maximum depth aren't queued.
+    /// * `sample_rate` - The probability of a discovered link being queued.
+    /// * `sample_seed` - The seed of the random number generator used for sampling, if any.
+    /// * `traps` - The detection of spider traps, capping how many discovered URLs in them are queued per host, if enabled.
+    /// * `exclusions` - The rules of the discovered URLs that are never queued, if any.
+    ///
+    /// * `freshness` - The URLs recrawled periodically, if any.
+    /// * `submission_interval` - The interval between each check for submitted URLs, if enabled.
+    /// * `retries` - The URLs that failed to be fetched, retried later, if enabled.
+    ///
+    /// * `throttle` - The global slowdown while many hosts throttle the crawl.
+    #[allow(clippy::too_many_arguments)]
+    pub const fn new(
+        delay: Duration,
+        scrapers: usize,
+        processors: usize,
+        snapshot_interval: Option<Duration>,
+        evaluator: Evaluator,
+        sample_rate: f64,
+        sample_seed: Option<u64>,
+        traps: Option<Traps>,
+        exclusions: Option<Exclusions>,
+        freshness: Option<Freshness>,
+        submission_interval: Option<Duration>,
+        retries: Option<Arc<Retries>>,
+        throttle: Arc<Throttle>,
+    ) -> Self {
         Self {
             delay,
 
+            scrapers,
             scraper_queue_capacity: scrapers * SCRAPER_QUEUE_CAPACITY_MULTIPLIER,
             processor_queue_capacity: processors * PROCESSOR_QUEUE_CAPACITY_MULTIPLIER,
+
+            snapshot_interval,
+
+            evaluator,
+            sample_rate,
+            sample_seed,
+            traps,
+            exclusions,
+
+            freshness,
+            submission_interval,
+            retries,
+
+            throttle,
         }
     }
 
@@ -54,10 +179,31 @@ impl Crawler {
     /// # Arguments
     ///
     /// * `scraper`: The scraper to use.
-    pub async fn run<T: Send + 'static>(&self, scraper: Arc<dyn Scraper<Item = T>>) {
+    /// * `restored_urls`: The URLs restored from a frontier snapshot, if any.
+    pub async fn run<T: Send + 'static>(
+        &self,
+        scraper: Arc<dyn Scraper<Item = T>>,
+        restored_urls: HashMap<Url, u32>,
+    ) {
         let mut visited_urls = HashSet::<Url>::new();
 
+        // The URLs waiting to be sent to the scrapers, and the URLs that have been queued but not yet visited.
+        let mut frontier = Frontier::load().await;
+        let mut pending_urls = HashMap::new();
+
         let active_scrapers = Arc::new(AtomicUsize::new(0));
+        let snapshot_in_progress = Arc::new(AtomicBool::new(false));
+        let mut last_snapshot = Instant::now();
+        let mut last_freshness_crawl = Instant::now();
+        let mut last_submission_check = None::<Instant>;
+        let mut last_retry_check = None::<Instant>;
+
+        // Seed and restored URLs are always queued, only discovered links are sampled.
+        let mut sampler = self
+            .sample_seed
+            .map_or_else(StdRng::from_entropy, StdRng::seed_from_u64);
+        let mut traps = self.traps.clone();
+        let mut exclusions = self.exclusions.clone();
 
         let (urls_to_visit_tx, urls_to_visit_rx) = mpsc::channel(self.scraper_queue_capacity);
         let (items_tx, items_rx) = mpsc::channel(self.processor_queue_capacity);
@@ -66,13 +212,14 @@ impl Crawler {
         // Create a barrier to wait for the scrapers, processors, and new control loop to finish.
         let barrier = Arc::new(Barrier::new(3));
 
-        // Add the seed URLs to the queue.
-        for (url, depth) in scraper.seed_urls() {
-            visited_urls.insert(url.clone());
+        // Add the seed URLs and the restored URLs to the queue.
+        for (url, depth) in scraper.seed_urls().into_iter().chain(restored_urls) {
+            if !visited_urls.insert(url.clone()) {
+                continue;
+            }
 
-            let _ = urls_to_visit_tx
-                .send(HashMap::from([(url.clone(), depth)]))
-                .await;
+            pending_urls.insert(url.clone(), depth);
+            frontier.push(url, depth);
         }
 
         // Spawn the processors.
@@ -90,8 +237,73 @@ impl Crawler {
 
         // Start the control loop.
         loop {
+            // Send as many queued URLs to the scrapers as they have room for.
+            while let Some((url, depth)) = frontier.pop() {
+                if let Err(err) = urls_to_visit_tx.try_send(HashMap::from([(url.clone(), depth)])) {
+                    frontier.push_ahead(url, depth);
+
+                    if let TrySendError::Closed(_) = err {
+                        error!("The scraper queue was closed unexpectedly!");
+                    }
+
+                    break;
+                }
+            }
+
+            if let Some(interval) = self.snapshot_interval {
+                if last_snapshot.elapsed() >= interval
+                    && !snapshot_in_progress.swap(true, Ordering::SeqCst)
+                {
+                    Self::snapshot_frontier(&pending_urls, snapshot_in_progress.clone());
+
+                    last_snapshot = Instant::now();
+                }
+            }
+
+            if let Some(freshness) = &self.freshness {
+                if last_freshness_crawl.elapsed() >= freshness.interval {
+                    Self::queue_fresh_urls(freshness, &mut frontier, &mut pending_urls);
+
+                    last_freshness_crawl = Instant::now();
+                }
+            }
+
+            if let Some(interval) = self.submission_interval {
+                if last_submission_check.map_or(true, |last_check| last_check.elapsed() >= interval)
+                {
+                    let submissions = Self::take_submissions().await;
+                    Self::queue_submissions(
+                        &submissions,
+                        &mut frontier,
+                        &mut pending_urls,
+                        &mut visited_urls,
+                    );
+
+                    last_submission_check = Some(Instant::now());
+                }
+            }
+
+            if let Some(retries) = &self.retries {
+                if last_retry_check
+                    .map_or(true, |last_check| last_check.elapsed() >= retries.interval)
+                {
+                    let due_urls = retries.take().await;
+                    Self::queue_retries(
+                        &due_urls,
+                        &mut frontier,
+                        &mut pending_urls,
+                        &mut visited_urls,
+                    );
+
+                    last_retry_check = Some(Instant::now());
+                }
+            }
+
             let Ok((visited_url, new_urls)) = new_urls_rx.try_recv() else {
-                if new_urls_tx.capacity() == self.scraper_queue_capacity
+                // Keep waiting for the next recrawl of the fresh URLs, even once everything else is crawled.
+                if self.freshness.is_none()
+                    && frontier.is_empty()
+                    && new_urls_tx.capacity() == self.scraper_queue_capacity
                     && urls_to_visit_tx.capacity() == self.scraper_queue_capacity
                     && active_scrapers.load(Ordering::SeqCst) == 0
                 {
@@ -103,41 +315,252 @@ impl Crawler {
                 continue;
             };
 
+            pending_urls.remove(&visited_url);
             visited_urls.insert(visited_url);
 
-            for (url, depth) in new_urls {
-                if visited_urls.contains(&url) {
-                    continue;
-                }
-
-                // Retry sending the URL until it's successfully sent to the queue.
-                loop {
-                    if urls_to_visit_tx
-                        .send(HashMap::from([(url.clone(), depth)]))
-                        .await
-                        .is_err()
-                    {
-                        // Sleep for a short duration before retrying.
-                        tokio::time::sleep(Duration::from_millis(5)).await;
-
-                        continue;
-                    }
+            self.queue_new_urls(
+                new_urls,
+                &mut frontier,
+                &mut pending_urls,
+                &mut visited_urls,
+                &mut exclusions,
+                &mut traps,
+                &mut sampler,
+            );
+        }
 
-                    // URL successfully sent, break the retry loop.
-                    break;
-                }
+        info!("Control loop finished, waiting for streams to complete...");
 
-                visited_urls.insert(url.clone());
-                info!("Queued URL: {url}");
+        if let Some(exclusions) = &exclusions {
+            for (rule, urls) in exclusions.get_counts() {
+                info!("Excluded {urls} URLs by \"{rule}\".");
             }
         }
 
-        info!("Control loop finished, waiting for streams to complete...");
-
         drop(urls_to_visit_tx);
         barrier.wait().await;
     }
 
+    /// Queues the fresh URLs to be crawled next, ahead of everything else in the frontier.
+    ///
+    /// # Arguments
+    ///
+    /// * `freshness`: The fresh URLs.
+    /// * `frontier`: The URLs waiting to be sent to the scrapers.
+    /// * `pending_urls`: The URLs that have been queued but not yet visited.
+    ///
+    /// # Notes
+    ///
+    /// * Fresh URLs are queued again even though they've been visited, but not while they're still pending.
+    /// * They're queued at depth `0`, so the new links on them are followed like those on the seed URLs.
+    fn queue_fresh_urls(
+        freshness: &Freshness,
+        frontier: &mut Frontier,
+        pending_urls: &mut HashMap<Url, u32>,
+    ) {
+        for url in freshness.urls.iter().rev() {
+            if pending_urls.contains_key(url) {
+                continue;
+            }
+
+            pending_urls.insert(url.clone(), 0);
+            frontier.push_ahead(url.clone(), 0);
+            info!("Queued fresh URL: {url}");
+        }
+    }
+
+    /// Queues the links found on a visited URL in the frontier, by their priority.
+    ///
+    /// # Arguments
+    ///
+    /// * `new_urls`: The links and the depth they'd be queued at.
+    /// * `frontier`: The URLs waiting to be sent to the scrapers.
+    /// * `pending_urls`: The URLs that have been queued but not yet visited.
+    /// * `visited_urls`: The URLs that have been queued or visited.
+    /// * `exclusions`: The rules of the discovered URLs that are never queued, if any.
+    /// * `traps`: The detection of spider traps, if enabled.
+    /// * `sampler`: The random number generator used for sampling.
+    ///
+    /// # Notes
+    ///
+    /// * Links past the maximum depth aren't marked as visited, so they're still queued if they're found closer to a seed.
+    #[allow(clippy::too_many_arguments)]
+    fn queue_new_urls(
+        &self,
+        new_urls: HashMap<Url, u32>,
+        frontier: &mut Frontier,
+        pending_urls: &mut HashMap<Url, u32>,
+        visited_urls: &mut HashSet<Url>,
+        exclusions: &mut Option<Exclusions>,
+        traps: &mut Option<Traps>,
+        sampler: &mut StdRng,
+    ) {
+        for (url, depth) in new_urls {
+            if !self.evaluator.check_depth(depth).passed {
+                debug!("Skipped URL past the maximum depth: {url}");
+
+                continue;
+            }
+
+            if !visited_urls.insert(url.clone()) {
+                continue;
+            }
+
+            if let Some(rule) = exclusions
+                .as_mut()
+                .and_then(|exclusions| exclusions.check(&url))
+            {
+                debug!("Skipped URL excluded by \"{rule}\": {url}");
+
+                continue;
+            }
+
+            if let Some(trap) = traps.as_mut().and_then(|traps| traps.check(&url)) {
+                debug!("Skipped URL in a {} trap: {url}", trap.as_str());
+
+                continue;
+            }
+
+            if self.sample_rate < 1.0 && !sampler.gen_bool(self.sample_rate) {
+                debug!("Skipped URL by sampling: {url}");
+
+                continue;
+            }
+
+            pending_urls.insert(url.clone(), depth);
+            frontier.push(url.clone(), depth);
+            info!("Queued URL: {url}");
+        }
+    }
+
+    /// Takes the submitted URLs that haven't been queued yet.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<(Url, bool)>` - The URLs and whether they're verified, verified ones first.
+    ///
+    /// # Notes
+    ///
+    /// * Submissions with invalid URLs are skipped, and if they could not be taken, none are returned.
+    async fn take_submissions() -> Vec<(Url, bool)> {
+        match database::take_submissions(SUBMISSION_BATCH_SIZE).await {
+            Ok(submissions) => submissions
+                .into_iter()
+                .filter_map(|submission| {
+                    Url::parse(&submission.url)
+                        .ok()
+                        .map(|url| (url, submission.verified))
+                })
+                .collect(),
+            Err(err) => {
+                error!("Failed to take submitted URLs ({}): {err}", err.code());
+
+                Vec::new()
+            }
+        }
+    }
+
+    /// Queues submitted URLs, verified ones ahead of everything else in the frontier and the rest by their priority.
+    ///
+    /// # Arguments
+    ///
+    /// * `submissions`: The submitted URLs and whether they're verified, verified ones first.
+    /// * `frontier`: The URLs waiting to be sent to the scrapers.
+    /// * `pending_urls`: The URLs that have been queued but not yet visited.
+    /// * `visited_urls`: The URLs that have been queued or visited.
+    ///
+    /// # Notes
+    ///
+    /// * URLs already in the frontier or visited aren't queued again.
+    /// * They're queued at depth `0`, so the links on them are followed like those on the seed URLs.
+    fn queue_submissions(
+        submissions: &[(Url, bool)],
+        frontier: &mut Frontier,
+        pending_urls: &mut HashMap<Url, u32>,
+        visited_urls: &mut HashSet<Url>,
+    ) {
+        let (verified, unverified): (Vec<_>, Vec<_>) =
+            submissions.iter().partition(|(_, verified)| *verified);
+
+        for (url, _) in verified.into_iter().rev() {
+            if !visited_urls.insert(url.clone()) {
+                continue;
+            }
+
+            pending_urls.insert(url.clone(), 0);
+            frontier.push_ahead(url.clone(), 0);
+            info!("Queued verified submitted URL: {url}");
+        }
+
+        for (url, _) in unverified {
+            if !visited_urls.insert(url.clone()) {
+                continue;
+            }
+
+            pending_urls.insert(url.clone(), 0);
+            frontier.push(url.clone(), 0);
+            info!("Queued submitted URL: {url}");
+        }
+    }
+
+    /// Queues the failed URLs that are due to be retried in the frontier, by their priority.
+    ///
+    /// # Arguments
+    ///
+    /// * `due_urls`: The URLs and the depth they were queued at.
+    /// * `frontier`: The URLs waiting to be sent to the scrapers.
+    /// * `pending_urls`: The URLs that have been queued but not yet visited.
+    /// * `visited_urls`: The URLs that have been queued or visited.
+    ///
+    /// # Notes
+    ///
+    /// * Failed URLs are queued again even though they've been visited, but not while they're still pending.
+    fn queue_retries(
+        due_urls: &[(Url, u32)],
+        frontier: &mut Frontier,
+        pending_urls: &mut HashMap<Url, u32>,
+        visited_urls: &mut HashSet<Url>,
+    ) {
+        for (url, depth) in due_urls {
+            if pending_urls.contains_key(url) {
+                continue;
+            }
+
+            visited_urls.insert(url.clone());
+            pending_urls.insert(url.clone(), *depth);
+            frontier.push(url.clone(), *depth);
+            info!("Queued failed URL to retry: {url}");
+        }
+    }
+
+    /// Saves a snapshot of the frontier in the background.
+    ///
+    /// # Arguments
+    ///
+    /// * `pending_urls`: The URLs that have been queued but not yet visited.
+    /// * `in_progress`: Whether a snapshot is being taken, cleared once this one is done.
+    ///
+    /// # Notes
+    ///
+    /// * The entries are written in batches, and no other snapshot is started until this one is done.
+    fn snapshot_frontier(pending_urls: &HashMap<Url, u32>, in_progress: Arc<AtomicBool>) {
+        let entries = pending_urls
+            .iter()
+            .map(|(url, depth)| (url.clone(), *depth))
+            .collect::<Vec<_>>();
+
+        tokio::spawn(async move {
+            info!("Taking snapshot of {} frontier entries...", entries.len());
+
+            match database::create_frontier_snapshot(&entries, FRONTIER_SNAPSHOT_BATCH_SIZE).await {
+                Ok(snapshot) => info!("Saved frontier snapshot #{}.", snapshot.id),
+                Err(err) => error!("Failed to save frontier snapshot ({}): {err}", err.code()),
+            }
+
+            in_progress.store(false, Ordering::SeqCst);
+        });
+    }
+
     /// Launches the processors.
     ///
     /// # Arguments
@@ -156,10 +579,16 @@ impl Crawler {
         tokio::spawn(async move {
             ReceiverStream::new(items)
                 .for_each_concurrent(processor_queue_capacity, |item| async {
-                    let _ = scraper.process(item).await;
+                    if let Err(err) = scraper.process(item).await {
+                        error!("Failed to process item ({}): {err}", err.code());
+                    }
                 })
                 .await;
 
+            if let Err(err) = scraper.flush().await {
+                error!("Failed to flush processed items ({}): {err}", err.code());
+            }
+
             barrier.wait().await;
         });
     }
@@ -174,6 +603,10 @@ impl Crawler {
     /// * `items_tx`: The channel to send items to.
     /// * `active_scrapers`: The number of active spiders.
     /// * `barrier`: The barrier to wait for.
+    ///
+    /// # Notes
+    ///
+    /// * Only `scrapers` URLs are fetched at once, the rest wait in the bounded queue, and the frontier once it's full.
     fn launch_scrapers<T: Send + 'static>(
         &self,
         scraper: Arc<dyn Scraper<Item = T>>,
@@ -183,12 +616,14 @@ impl Crawler {
         active_scrapers: Arc<AtomicUsize>,
         barrier: Arc<Barrier>,
     ) {
-        let scraper_queue_capacity = self.scraper_queue_capacity;
+        let scrapers = self.scrapers;
         let delay = self.delay;
+        let throttle = self.throttle.clone();
+        let retries = self.retries.clone();
 
         tokio::spawn(async move {
             ReceiverStream::new(urls_to_visit)
-                .for_each_concurrent(scraper_queue_capacity, |queued_url| async {
+                .for_each_concurrent(scrapers, |queued_url| async {
                     active_scrapers.fetch_add(1, Ordering::SeqCst); // Increment the number of active scrapers.
 
                     let Some((url, depth)) = queued_url.into_iter().next() else {
@@ -198,17 +633,21 @@ impl Crawler {
                     };
 
                     let mut urls = HashMap::new();
-                    let results = scraper
-                        .scrape(url.clone(), depth)
-                        .await
-                        .map_err(|err| {
-                            error!("Failed to scrape {url}: {err}");
+                    let results = scraper.scrape(url.clone(), depth).await;
+                    if let Err(err) = &results {
+                        if let Error::RobotsDisallowed(_) = err {
+                            warn!("Skipped {url} ({}): {err}", err.code());
+                        } else {
+                            error!("Failed to scrape {url} ({}): {err}", err.code());
+                        }
+                    }
 
-                            err
-                        })
-                        .ok();
+                    // Retry the URLs that failed in a way that may pass later, like during an outage.
+                    if let Some(retries) = &retries {
+                        retries.record(&url, depth, results.as_ref().err()).await;
+                    }
 
-                    if let Some((items, new_urls)) = results {
+                    if let Ok((items, new_urls)) = results {
                         for item in items {
                             let _ = items_tx.send(item).await;
                         }
@@ -218,7 +657,7 @@ impl Crawler {
 
                     let _ = new_urls_tx.send((url.clone(), urls)).await;
 
-                    tokio::time::sleep(delay).await;
+                    tokio::time::sleep(delay + throttle.get_delay()).await;
                     active_scrapers.fetch_sub(1, Ordering::SeqCst);
                 })
                 .await;
@@ -228,3 +667,176 @@ impl Crawler {
         });
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn get_queued(frontier: &Frontier) -> Vec<(String, u32)> {
+        let mut frontier = frontier.clone();
+
+        std::iter::from_fn(|| frontier.pop())
+            .map(|(url, depth)| (url.to_string(), depth))
+            .collect()
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_queue_fresh_urls() {
+        let url = |url: &str| Url::parse(url).expect("Failed to parse URL!");
+        let freshness = Freshness {
+            urls: vec![
+                url("https://news.example.com/"),
+                url("https://blog.example.com/"),
+            ],
+            interval: Duration::from_secs(60),
+        };
+
+        let mut frontier = Frontier::default();
+        frontier.push(url("https://example.com/article"), 2);
+        let mut pending_urls = HashMap::from([(url("https://example.com/article"), 2)]);
+
+        // The fresh URLs go ahead of everything else, in the order they're configured.
+        Crawler::queue_fresh_urls(&freshness, &mut frontier, &mut pending_urls);
+        assert_eq!(
+            get_queued(&frontier),
+            vec![
+                ("https://news.example.com/".to_string(), 0),
+                ("https://blog.example.com/".to_string(), 0),
+                ("https://example.com/article".to_string(), 2),
+            ]
+        );
+
+        // They aren't queued twice while they're still pending.
+        Crawler::queue_fresh_urls(&freshness, &mut frontier, &mut pending_urls);
+        assert_eq!(frontier.len(), 3);
+
+        // Once visited, they're queued again.
+        pending_urls.remove(&url("https://news.example.com/"));
+        frontier.pop();
+        Crawler::queue_fresh_urls(&freshness, &mut frontier, &mut pending_urls);
+        assert_eq!(
+            frontier.pop().map(|(url, _)| url.to_string()),
+            Some("https://news.example.com/".to_string())
+        );
+        assert_eq!(frontier.len(), 2);
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_queue_new_urls() {
+        let url = |url: &str| Url::parse(url).expect("Failed to parse URL!");
+        let crawler = Crawler::new(
+            Duration::ZERO,
+            1,
+            1,
+            None,
+            Evaluator::new(
+                vec!["http".to_string(), "https".to_string()],
+                Some(2),
+                "RSE/1.0.0".to_string(),
+                Duration::ZERO,
+                Vec::new(),
+                HostAliases::new(&[]),
+                TrackingParameters::new(&[]),
+                Vec::new(),
+                Vec::new(),
+            ),
+            1.0,
+            None,
+            None,
+            None,
+            None,
+            None,
+            None,
+            Arc::new(Throttle::load()),
+        );
+
+        let mut frontier = Frontier::default();
+        let mut pending_urls = HashMap::new();
+        let mut visited_urls = HashSet::new();
+        let mut sampler = StdRng::seed_from_u64(0);
+
+        // Links at the maximum depth or past it aren't queued.
+        crawler.queue_new_urls(
+            HashMap::from([
+                (url("https://example.com/near"), 1),
+                (url("https://example.com/far"), 2),
+                (url("https://example.com/farther"), 3),
+            ]),
+            &mut frontier,
+            &mut pending_urls,
+            &mut visited_urls,
+            &mut None,
+            &mut None,
+            &mut sampler,
+        );
+        assert_eq!(
+            get_queued(&frontier),
+            vec![("https://example.com/near".to_string(), 1)]
+        );
+        assert!(!pending_urls.contains_key(&url("https://example.com/far")));
+        assert!(!visited_urls.contains(&url("https://example.com/far")));
+
+        // They're still queued once they're found closer to a seed.
+        crawler.queue_new_urls(
+            HashMap::from([(url("https://example.com/far"), 1)]),
+            &mut frontier,
+            &mut pending_urls,
+            &mut visited_urls,
+            &mut None,
+            &mut None,
+            &mut sampler,
+        );
+        assert_eq!(frontier.len(), 2);
+        assert_eq!(pending_urls.get(&url("https://example.com/far")), Some(&1));
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_queue_submissions() {
+        let url = |url: &str| Url::parse(url).expect("Failed to parse URL!");
+        let submissions = vec![
+            (url("https://verified.example.com/"), true),
+            (url("https://also-verified.example.com/"), true),
+            (url("https://unverified.example.com/"), false),
+            (url("https://example.com/article"), false),
+            (url("https://example.com/visited"), true),
+        ];
+
+        let mut frontier = Frontier::default();
+        frontier.push(url("https://example.com/article"), 2);
+        let mut pending_urls = HashMap::from([(url("https://example.com/article"), 2)]);
+        let mut visited_urls = HashSet::from([
+            url("https://example.com/article"),
+            url("https://example.com/visited"),
+        ]);
+
+        // Verified URLs go ahead of everything else, unverified ones by their depth, and known ones are skipped.
+        Crawler::queue_submissions(
+            &submissions,
+            &mut frontier,
+            &mut pending_urls,
+            &mut visited_urls,
+        );
+        assert_eq!(
+            get_queued(&frontier),
+            vec![
+                ("https://verified.example.com/".to_string(), 0),
+                ("https://also-verified.example.com/".to_string(), 0),
+                ("https://unverified.example.com/".to_string(), 0),
+                ("https://example.com/article".to_string(), 2),
+            ]
+        );
+
+        // They aren't queued twice.
+        Crawler::queue_submissions(
+            &submissions,
+            &mut frontier,
+            &mut pending_urls,
+            &mut visited_urls,
+        );
+        assert_eq!(frontier.len(), 4);
+        assert_eq!(pending_urls.len(), 4);
+    }
+}
@@ -0,0 +1,748 @@
+use crate::client::Pattern;
+use crate::crawler::Freshness;
+use crate::robots::RobotsFile;
+use common::errors::Error;
+use common::utils;
+use common::utils::urls::{self, HostAliases, Rejection, TrackingParameters};
+use serde::Serialize;
+use std::collections::HashSet;
+use std::time::Duration;
+use url::Url;
+
+/// A check a URL goes through before it's crawled.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Check {
+    /// Whether the URL parses, and what it's normalized to.
+    Normalize,
+    /// Whether the scheme of the URL is followed.
+    Scheme,
+    /// Whether the host of the URL isn't blocked, and is allowed if only some hosts are.
+    Host,
+    /// Whether the URL is within the maximum depth.
+    Depth,
+    /// Whether the URL hasn't been queued or visited already.
+    Visited,
+    /// Whether the `robots.txt` file of the host allows the URL.
+    Robots,
+    /// Where the URL is queued, and how long the scraper waits after crawling it.
+    Schedule,
+}
+
+/// The outcome of a check.
+///
+/// # Fields
+///
+/// * `check`: The check.
+/// * `passed`: Whether the URL passed the check.
+/// * `detail`: Why the URL passed or failed the check.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Step {
+    pub check: Check,
+    pub passed: bool,
+    pub detail: String,
+}
+
+/// Whether a URL would be crawled, and the checks that decided it.
+///
+/// # Fields
+///
+/// * `url`: The URL, as it was given.
+/// * `crawl`: Whether the URL would be crawled.
+/// * `steps`: The checks in the order they're made, up to the first one the URL failed.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Decision {
+    pub url: String,
+    pub crawl: bool,
+    pub steps: Vec<Step>,
+}
+
+/// Decides whether URLs are crawled, the same way for crawls, dry runs and single URLs.
+///
+/// # Fields
+///
+/// * `allowed_schemes`: The schemes of the links that are followed.
+/// * `max_depth`: The maximum depth to crawl to, if any.
+/// * `user_agent`: The user agent `robots.txt` files are evaluated for.
+/// * `delay`: The delay of the scraper after each request.
+/// * `fresh_urls`: The URLs queued ahead of everything else, if any.
+/// * `host_aliases`: The aliases of hosts, so URLs are crawled with their canonical host.
+/// * `tracking_parameters`: The query parameters stripped from URLs, so tagged links aren't crawled twice.
+/// * `allowed_hosts`: The patterns of the hosts that are crawled, or none to crawl every host.
+/// * `blocked_hosts`: The patterns of the hosts that are never crawled, even if they're allowed.
+#[derive(Debug, Clone)]
+pub struct Evaluator {
+    allowed_schemes: Vec<String>,
+    max_depth: Option<u32>,
+    user_agent: String,
+    delay: Duration,
+    fresh_urls: Vec<Url>,
+    host_aliases: HostAliases,
+    tracking_parameters: TrackingParameters,
+    allowed_hosts: Vec<Pattern>,
+    blocked_hosts: Vec<Pattern>,
+}
+
+impl Step {
+    /// Creates a step.
+    ///
+    /// # Arguments
+    ///
+    /// * `check`: The check.
+    /// * `passed`: Whether the URL passed the check.
+    /// * `detail`: Why the URL passed or failed the check.
+    ///
+    /// # Returns
+    ///
+    /// * `Step` - The step.
+    fn new(check: Check, passed: bool, detail: impl Into<String>) -> Self {
+        Self {
+            check,
+            passed,
+            detail: detail.into(),
+        }
+    }
+}
+
+impl Decision {
+    /// Adds a step to the decision, unless the URL already failed a check.
+    ///
+    /// # Arguments
+    ///
+    /// * `step`: The step.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the URL has passed every check so far.
+    fn push(&mut self, step: Step) -> bool {
+        if self.crawl {
+            self.crawl = step.passed;
+            self.steps.push(step);
+        }
+
+        self.crawl
+    }
+}
+
+impl Evaluator {
+    /// Creates a new evaluator.
+    ///
+    /// # Arguments
+    ///
+    /// * `allowed_schemes`: The schemes of the links that are followed.
+    /// * `max_depth`: The maximum depth to crawl to, if any.
+    /// * `user_agent`: The user agent `robots.txt` files are evaluated for.
+    /// * `delay`: The delay of the scraper after each request.
+    /// * `fresh_urls`: The URLs queued ahead of everything else, if any.
+    /// * `host_aliases`: The aliases of hosts, so URLs are crawled with their canonical host.
+    /// * `tracking_parameters`: The query parameters stripped from URLs, so tagged links aren't crawled twice.
+    /// * `allowed_hosts`: The patterns of the hosts that are crawled, or none to crawl every host.
+    /// * `blocked_hosts`: The patterns of the hosts that are never crawled, even if they're allowed.
+    ///
+    /// # Returns
+    ///
+    /// * `Evaluator` - The new evaluator.
+    #[must_use]
+    pub const fn new(
+        allowed_schemes: Vec<String>,
+        max_depth: Option<u32>,
+        user_agent: String,
+        delay: Duration,
+        fresh_urls: Vec<Url>,
+        host_aliases: HostAliases,
+        tracking_parameters: TrackingParameters,
+        allowed_hosts: Vec<Pattern>,
+        blocked_hosts: Vec<Pattern>,
+    ) -> Self {
+        Self {
+            allowed_schemes,
+            max_depth,
+            user_agent,
+            delay,
+            fresh_urls,
+            host_aliases,
+            tracking_parameters,
+            allowed_hosts,
+            blocked_hosts,
+        }
+    }
+
+    /// Loads the evaluator from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Evaluator` - The evaluator, with the same settings as the crawler.
+    #[must_use]
+    pub fn load() -> Self {
+        Self::new(
+            utils::env::scraper::get_allowed_schemes(),
+            utils::env::scraper::get_max_depth(),
+            utils::env::scraper::get_user_agent()
+                .to_str()
+                .unwrap_or_default()
+                .to_string(),
+            utils::env::crawler::get_delay(),
+            Freshness::load()
+                .map(|freshness| freshness.urls)
+                .unwrap_or_default(),
+            HostAliases::load(),
+            TrackingParameters::load(),
+            utils::env::scraper::get_allowed_hosts()
+                .iter()
+                .map(|pattern| Pattern::parse(pattern))
+                .collect(),
+            utils::env::scraper::get_blocked_hosts()
+                .iter()
+                .map(|pattern| Pattern::parse(pattern))
+                .collect(),
+        )
+    }
+
+    /// Gets the schemes of the links that are followed.
+    ///
+    /// # Returns
+    ///
+    /// * `&[String]` - The allowed schemes.
+    #[must_use]
+    pub fn allowed_schemes(&self) -> &[String] {
+        &self.allowed_schemes
+    }
+
+    /// Gets the aliases of hosts.
+    ///
+    /// # Returns
+    ///
+    /// * `&HostAliases` - The host aliases.
+    #[must_use]
+    pub const fn host_aliases(&self) -> &HostAliases {
+        &self.host_aliases
+    }
+
+    /// Gets the query parameters stripped from URLs.
+    ///
+    /// # Returns
+    ///
+    /// * `&TrackingParameters` - The tracking parameters.
+    #[must_use]
+    pub const fn tracking_parameters(&self) -> &TrackingParameters {
+        &self.tracking_parameters
+    }
+
+    /// Normalizes a URL the way it's queued and stored.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL.
+    ///
+    /// # Returns
+    ///
+    /// * `Url` - The normalized URL, without its tracking parameters and with its canonical host.
+    #[must_use]
+    pub fn normalize(&self, url: &Url) -> Url {
+        self.host_aliases
+            .apply(&self.tracking_parameters.strip(&urls::normalize(url)))
+    }
+
+    /// Checks the URL up to its `robots.txt` file, which has to be fetched before the decision can be finished.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL.
+    /// * `depth`: The depth the URL would be queued at.
+    /// * `visited_urls`: The URLs that have been queued or visited.
+    ///
+    /// # Returns
+    ///
+    /// * `(Decision, Option<Url>)` - The decision so far, and the normalized URL if it passed every check so far.
+    #[must_use]
+    pub fn check(
+        &self,
+        url: &str,
+        depth: u32,
+        visited_urls: &HashSet<Url>,
+    ) -> (Decision, Option<Url>) {
+        let mut decision = Decision {
+            url: url.to_string(),
+            crawl: true,
+            steps: Vec::new(),
+        };
+
+        let normalized = match Url::parse(url.trim()) {
+            Ok(parsed) => self.normalize(&parsed),
+            Err(err) => {
+                decision.push(Step::new(
+                    Check::Normalize,
+                    false,
+                    format!("Not a valid URL: {err}"),
+                ));
+
+                return (decision, None);
+            }
+        };
+
+        let passed = decision.push(Step::new(Check::Normalize, true, normalized.as_str()))
+            && decision.push(self.check_scheme(&normalized))
+            && decision.push(self.check_host(&normalized))
+            && decision.push(self.check_depth(depth))
+            && decision.push(Self::check_visited(&normalized, visited_urls));
+
+        (decision, passed.then_some(normalized))
+    }
+
+    /// Finishes a decision with the `robots.txt` file of the host of the URL.
+    ///
+    /// # Arguments
+    ///
+    /// * `decision`: The decision so far, from `check`.
+    /// * `url`: The normalized URL.
+    /// * `depth`: The depth the URL would be queued at.
+    /// * `robots_file`: The `robots.txt` file of the host, or why it couldn't be fetched.
+    ///
+    /// # Returns
+    ///
+    /// * `Decision` - The finished decision.
+    #[must_use]
+    pub fn finish(
+        &self,
+        mut decision: Decision,
+        url: &Url,
+        depth: u32,
+        robots_file: Result<&RobotsFile, &Error>,
+    ) -> Decision {
+        let robots_step = self.check_robots(url, robots_file);
+        let crawl_delay = robots_file
+            .ok()
+            .and_then(|robots_file| robots_file.check(url, &self.user_agent).crawl_delay);
+
+        if decision.push(robots_step) {
+            decision.push(self.schedule(url, depth, crawl_delay));
+        }
+
+        decision
+    }
+
+    /// Checks if the scheme of a URL is followed.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The normalized URL.
+    ///
+    /// # Returns
+    ///
+    /// * `Step` - Whether the scheme is allowed, and isn't dangerous.
+    #[must_use]
+    pub fn check_scheme(&self, url: &Url) -> Step {
+        match urls::check_scheme(url, &self.allowed_schemes) {
+            Ok(()) => Step::new(Check::Scheme, true, format!("{} is allowed", url.scheme())),
+            Err(Rejection::Dangerous(scheme)) => {
+                Step::new(Check::Scheme, false, format!("{scheme} is dangerous"))
+            }
+            Err(Rejection::Disallowed(scheme)) => Step::new(
+                Check::Scheme,
+                false,
+                format!(
+                    "{scheme} isn't one of the allowed schemes, {}",
+                    self.allowed_schemes.join(", ")
+                ),
+            ),
+            Err(Rejection::Invalid) => Step::new(Check::Scheme, false, "Not a valid URL"),
+        }
+    }
+
+    /// Checks if the host of a URL is crawled.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The normalized URL.
+    ///
+    /// # Returns
+    ///
+    /// * `Step` - Whether the host isn't blocked, and is allowed if only some hosts are.
+    #[must_use]
+    pub fn check_host(&self, url: &Url) -> Step {
+        let Some(host) = url.host_str() else {
+            return Step::new(
+                Check::Host,
+                self.allowed_hosts.is_empty(),
+                "The URL has no host",
+            );
+        };
+
+        if self
+            .blocked_hosts
+            .iter()
+            .any(|pattern| pattern.matches(host))
+        {
+            return Step::new(Check::Host, false, format!("{host} is blocked"));
+        }
+
+        if self.allowed_hosts.is_empty() {
+            return Step::new(Check::Host, true, format!("{host} isn't blocked"));
+        }
+
+        if self
+            .allowed_hosts
+            .iter()
+            .any(|pattern| pattern.matches(host))
+        {
+            Step::new(Check::Host, true, format!("{host} is allowed"))
+        } else {
+            Step::new(
+                Check::Host,
+                false,
+                format!("{host} isn't one of the allowed hosts"),
+            )
+        }
+    }
+
+    /// Checks if a URL at a depth is within the maximum depth.
+    ///
+    /// # Arguments
+    ///
+    /// * `depth`: The depth of the URL.
+    ///
+    /// # Returns
+    ///
+    /// * `Step` - Whether the maximum depth hasn't been reached.
+    #[must_use]
+    pub fn check_depth(&self, depth: u32) -> Step {
+        match self.max_depth {
+            Some(max_depth) if depth >= max_depth => Step::new(
+                Check::Depth,
+                false,
+                format!("Depth {depth} reached the maximum depth of {max_depth}"),
+            ),
+            Some(max_depth) => Step::new(
+                Check::Depth,
+                true,
+                format!("Depth {depth} is below the maximum depth of {max_depth}"),
+            ),
+            None => Step::new(
+                Check::Depth,
+                true,
+                format!("Depth {depth}, there's no maximum depth"),
+            ),
+        }
+    }
+
+    /// Checks if a URL hasn't been queued or visited already.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The normalized URL.
+    /// * `visited_urls`: The URLs that have been queued or visited.
+    ///
+    /// # Returns
+    ///
+    /// * `Step` - Whether the URL is new.
+    #[must_use]
+    pub fn check_visited(url: &Url, visited_urls: &HashSet<Url>) -> Step {
+        if visited_urls.contains(url) {
+            Step::new(Check::Visited, false, "Already queued or visited")
+        } else {
+            Step::new(Check::Visited, true, "Not queued or visited yet")
+        }
+    }
+
+    /// Checks if the `robots.txt` file of the host allows a URL.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The normalized URL.
+    /// * `robots_file`: The `robots.txt` file of the host, or why it couldn't be fetched.
+    ///
+    /// # Returns
+    ///
+    /// * `Step` - Whether the URL is allowed, and the group and rule that decided it.
+    #[must_use]
+    pub fn check_robots(&self, url: &Url, robots_file: Result<&RobotsFile, &Error>) -> Step {
+        let robots_file = match robots_file {
+            Ok(robots_file) => robots_file,
+            Err(err) => {
+                return Step::new(
+                    Check::Robots,
+                    false,
+                    format!("Failed to get robots.txt ({}): {err}", err.code()),
+                )
+            }
+        };
+
+        let verdict = robots_file.check(url, &self.user_agent);
+        let group = verdict.group.map_or_else(
+            || "no group applies".to_string(),
+            |group| format!("the group of {}", group.join(", ")),
+        );
+        let detail = match &verdict.rule {
+            Some(rule) => format!("\"{rule}\" of {group}"),
+            None => format!("No rule matches, {group}"),
+        };
+
+        Step::new(
+            Check::Robots,
+            verdict.allowed,
+            format!(
+                "{} by robots.txt: {detail}",
+                if verdict.allowed {
+                    "Allowed"
+                } else {
+                    "Disallowed"
+                }
+            ),
+        )
+    }
+
+    /// Tells where a URL is queued, and how long the scraper waits after crawling it.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The normalized URL.
+    /// * `depth`: The depth the URL would be queued at.
+    /// * `crawl_delay`: The crawl delay the `robots.txt` file asks for in seconds, if any.
+    ///
+    /// # Returns
+    ///
+    /// * `Step` - The schedule of the URL.
+    ///
+    /// # Notes
+    ///
+    /// * Fresh URLs are queued ahead of everything else at depth `0`, and the rest by their priority.
+    #[must_use]
+    pub fn schedule(&self, url: &Url, depth: u32, crawl_delay: Option<f64>) -> Step {
+        let queue = if self.fresh_urls.contains(url) {
+            "Queued ahead of the frontier at depth 0, as a fresh URL".to_string()
+        } else {
+            format!("Queued by priority at depth {depth}")
+        };
+        let delay = crawl_delay.map_or_else(
+            || format!("waiting {}ms after it", self.delay.as_millis()),
+            |crawl_delay| {
+                format!(
+                    "waiting {}ms after it, robots.txt asks for {crawl_delay}s",
+                    self.delay.as_millis()
+                )
+            },
+        );
+
+        Step::new(Check::Schedule, true, format!("{queue}, {delay}"))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const ROBOTS_FILE: &str = "
+User-agent: *
+Disallow: /private
+Crawl-delay: 2
+";
+
+    #[allow(clippy::expect_used)]
+    fn evaluator() -> Evaluator {
+        Evaluator::new(
+            vec!["http".to_string(), "https".to_string()],
+            Some(3),
+            "RSE/1.0.0".to_string(),
+            Duration::from_millis(1_000),
+            vec![Url::parse("https://news.example.com/").expect("Failed to parse URL!")],
+            HostAliases::new(&["www.*".to_string()]),
+            TrackingParameters::new(&["utm_*".to_string()]),
+            Vec::new(),
+            vec![Pattern::parse("*.internal")],
+        )
+    }
+
+    fn evaluate(url: &str, depth: u32, visited_urls: &HashSet<Url>) -> Decision {
+        let evaluator = evaluator();
+        let robots_file = RobotsFile::parse(ROBOTS_FILE);
+
+        match evaluator.check(url, depth, visited_urls) {
+            (decision, Some(normalized)) => {
+                evaluator.finish(decision, &normalized, depth, Ok(&robots_file))
+            }
+            (decision, None) => decision,
+        }
+    }
+
+    fn get_chain(decision: &Decision) -> Vec<(Check, bool, &str)> {
+        decision
+            .steps
+            .iter()
+            .map(|step| (step.check, step.passed, step.detail.as_str()))
+            .collect()
+    }
+
+    #[test]
+    fn test_evaluate() {
+        let visited_urls = HashSet::new();
+
+        // The www host collapses into the apex, and the tracking parameters are stripped.
+        let decision = evaluate(
+            "https://www.example.com/%7Euser?utm_source=news",
+            1,
+            &visited_urls,
+        );
+        assert!(decision.crawl);
+        assert_eq!(
+            get_chain(&decision),
+            vec![
+                (Check::Normalize, true, "https://example.com/~user"),
+                (Check::Scheme, true, "https is allowed"),
+                (Check::Host, true, "example.com isn't blocked"),
+                (Check::Depth, true, "Depth 1 is below the maximum depth of 3"),
+                (Check::Visited, true, "Not queued or visited yet"),
+                (
+                    Check::Robots,
+                    true,
+                    "Allowed by robots.txt: No rule matches, the group of *"
+                ),
+                (
+                    Check::Schedule,
+                    true,
+                    "Queued by priority at depth 1, waiting 1000ms after it, robots.txt asks for 2s"
+                ),
+            ]
+        );
+
+        let decision = evaluate("https://news.example.com/", 0, &visited_urls);
+        assert!(decision.crawl);
+        assert_eq!(
+            decision.steps.last().map(|step| step.detail.as_str()),
+            Some("Queued ahead of the frontier at depth 0, as a fresh URL, waiting 1000ms after it, robots.txt asks for 2s")
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_evaluate_rejected() {
+        let visited_urls =
+            HashSet::from([Url::parse("https://example.com/").expect("Failed to parse URL!")]);
+        let failed = |url, depth| {
+            let decision = evaluate(url, depth, &visited_urls);
+            assert!(!decision.crawl, "{url}");
+
+            decision
+                .steps
+                .last()
+                .map(|step| (step.check, step.detail.clone()))
+        };
+
+        assert_eq!(
+            failed("example.com/page", 0),
+            Some((
+                Check::Normalize,
+                "Not a valid URL: relative URL without a base".into()
+            ))
+        );
+        assert_eq!(
+            failed("javascript:alert(1)", 0),
+            Some((Check::Scheme, "javascript is dangerous".into()))
+        );
+        assert_eq!(
+            failed("mailto:someone@example.com", 0),
+            Some((
+                Check::Scheme,
+                "mailto isn't one of the allowed schemes, http, https".into()
+            ))
+        );
+        assert_eq!(
+            failed("https://wiki.corp.internal/", 0),
+            Some((Check::Host, "wiki.corp.internal is blocked".into()))
+        );
+        assert_eq!(
+            failed("https://example.com/page", 3),
+            Some((
+                Check::Depth,
+                "Depth 3 reached the maximum depth of 3".into()
+            ))
+        );
+        assert_eq!(
+            failed("https://example.com/", 0),
+            Some((Check::Visited, "Already queued or visited".into()))
+        );
+        assert_eq!(
+            failed("https://www.example.com/", 0),
+            Some((Check::Visited, "Already queued or visited".into()))
+        );
+        assert_eq!(
+            failed("https://example.com/private/page", 0),
+            Some((
+                Check::Robots,
+                "Disallowed by robots.txt: \"Disallow: /private\" of the group of *".into()
+            ))
+        );
+
+        // The checks stop at the first one that fails.
+        assert_eq!(
+            evaluate("https://example.com/", 5, &visited_urls)
+                .steps
+                .len(),
+            4
+        );
+
+        let evaluator = evaluator();
+        let url = Url::parse("https://example.com/").expect("Failed to parse URL!");
+        let (decision, _) = evaluator.check(url.as_str(), 0, &HashSet::new());
+        let decision =
+            evaluator.finish(decision, &url, 0, Err(&Error::Timeout("robots.txt".into())));
+        assert!(!decision.crawl);
+        assert_eq!(decision.steps.len(), 6);
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_check_host() {
+        let evaluator = Evaluator::new(
+            vec!["https".to_string()],
+            None,
+            "RSE/1.0.0".to_string(),
+            Duration::from_millis(1_000),
+            Vec::new(),
+            HostAliases::default(),
+            TrackingParameters::default(),
+            vec![
+                Pattern::parse("example.com"),
+                Pattern::parse("*.example.org"),
+            ],
+            vec![Pattern::parse("spam.example.org")],
+        );
+        let check = |url: &str| {
+            let step = evaluator.check_host(&Url::parse(url).expect("Failed to parse URL!"));
+
+            (step.passed, step.detail)
+        };
+
+        assert_eq!(
+            check("https://example.com/"),
+            (true, "example.com is allowed".into())
+        );
+        assert_eq!(
+            check("https://docs.example.org/"),
+            (true, "docs.example.org is allowed".into())
+        );
+        assert_eq!(
+            check("https://example.org/"),
+            (true, "example.org is allowed".into())
+        );
+
+        // Exact hosts don't allow their subdomains, and blocked hosts lose even if they're allowed.
+        assert_eq!(
+            check("https://www.example.com/"),
+            (
+                false,
+                "www.example.com isn't one of the allowed hosts".into()
+            )
+        );
+        assert_eq!(
+            check("https://spam.example.org/"),
+            (false, "spam.example.org is blocked".into())
+        );
+        assert_eq!(
+            check("https://notexample.org/"),
+            (
+                false,
+                "notexample.org isn't one of the allowed hosts".into()
+            )
+        );
+    }
+}
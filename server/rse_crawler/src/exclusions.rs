@@ -0,0 +1,156 @@
+use common::utils;
+use log::{error, warn};
+use regex::Regex;
+use url::Url;
+
+/// The rules of the discovered URLs that are never queued, like downloads and admin pages.
+///
+/// # Fields
+///
+/// * `rules`: The pattern of each rule, and the number of URLs it excluded so far, in order.
+///
+/// # Notes
+///
+/// * A URL is only counted against the first rule it matches.
+#[derive(Debug, Clone)]
+pub struct Exclusions {
+    rules: Vec<(Regex, usize)>,
+}
+
+impl Exclusions {
+    /// Creates new exclusion rules.
+    ///
+    /// # Arguments
+    ///
+    /// * `patterns`: The regular expressions of the rules, where empty lines and lines starting with `#` are skipped.
+    ///
+    /// # Returns
+    ///
+    /// * `Exclusions` - The exclusion rules, without the invalid ones.
+    #[must_use]
+    pub fn new(patterns: &[String]) -> Self {
+        let rules = patterns
+            .iter()
+            .map(|pattern| pattern.trim())
+            .filter(|pattern| !pattern.is_empty() && !pattern.starts_with('#'))
+            .filter_map(|pattern| match Regex::new(pattern) {
+                Ok(regex) => Some((regex, 0)),
+                Err(err) => {
+                    warn!("Skipping URL exclusion \"{pattern}\", it's not a valid regex: {err}");
+
+                    None
+                }
+            })
+            .collect();
+
+        Self { rules }
+    }
+
+    /// Loads the exclusion rules from the file in `URL_EXCLUSIONS`.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Exclusions)` - The exclusion rules.
+    /// * `None` - If no URLs are excluded, or the rules could not be read.
+    #[must_use]
+    pub fn load() -> Option<Self> {
+        let patterns = match utils::env::data::fetch_words("URL_EXCLUSIONS") {
+            Ok(patterns) => patterns?,
+            Err(err) => {
+                error!(
+                    "Failed to read the URL exclusions, not excluding any URLs ({}): {err}",
+                    err.code()
+                );
+
+                return None;
+            }
+        };
+
+        let exclusions = Self::new(&patterns);
+        if exclusions.rules.is_empty() {
+            return None;
+        }
+
+        Some(exclusions)
+    }
+
+    /// Checks if a discovered URL is excluded, counting it against the rule that excluded it.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The normalized URL.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(&str)` - The pattern of the first rule the URL matches.
+    /// * `None` - If the URL is queued.
+    pub fn check(&mut self, url: &Url) -> Option<&str> {
+        let (regex, urls) = self
+            .rules
+            .iter_mut()
+            .find(|(regex, _)| regex.is_match(url.as_str()))?;
+        *urls += 1;
+
+        Some(regex.as_str())
+    }
+
+    /// Gets the number of URLs each rule excluded.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<(&str, usize)>` - The pattern of each rule, and the number of URLs it excluded, in order.
+    #[must_use]
+    pub fn get_counts(&self) -> Vec<(&str, usize)> {
+        self.rules
+            .iter()
+            .map(|(regex, urls)| (regex.as_str(), *urls))
+            .collect()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_check() {
+        let url = |url: &str| Url::parse(url).expect("Failed to parse URL!");
+        let mut exclusions = Exclusions::new(&[
+            "# Downloads".to_string(),
+            r"\.(jpg|zip|exe)$".to_string(),
+            String::new(),
+            "/wp-admin/".to_string(),
+            "(?i)[?&](phpsessid|sid)=".to_string(),
+            "(unclosed".to_string(),
+        ]);
+
+        assert_eq!(
+            exclusions.check(&url("https://example.com/setup.exe")),
+            Some(r"\.(jpg|zip|exe)$")
+        );
+        assert_eq!(
+            exclusions.check(&url("https://example.com/wp-admin/photo.jpg")),
+            Some(r"\.(jpg|zip|exe)$")
+        );
+        assert_eq!(
+            exclusions.check(&url("https://example.com/wp-admin/options.php")),
+            Some("/wp-admin/")
+        );
+        assert_eq!(
+            exclusions.check(&url("https://example.com/forum?PHPSESSID=abc")),
+            Some("(?i)[?&](phpsessid|sid)=")
+        );
+        assert_eq!(exclusions.check(&url("https://example.com/blog/")), None);
+
+        // Comments, empty lines and invalid patterns aren't rules.
+        assert_eq!(
+            exclusions.get_counts(),
+            vec![
+                (r"\.(jpg|zip|exe)$", 2),
+                ("/wp-admin/", 1),
+                ("(?i)[?&](phpsessid|sid)=", 1),
+            ]
+        );
+    }
+}
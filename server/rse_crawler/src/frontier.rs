@@ -0,0 +1,290 @@
+use common::database;
+use common::utils;
+use log::warn;
+use std::cmp::Ordering;
+use std::collections::{BinaryHeap, HashMap, VecDeque};
+use url::Url;
+
+/// A URL waiting in the frontier.
+///
+/// # Fields
+///
+/// * `priority`: How important the URL is, the highest goes first.
+/// * `sequence`: The order the URL was queued in, so URLs of the same priority go first in, first out.
+/// * `url`: The URL.
+/// * `depth`: The depth the URL was queued at.
+#[derive(Debug, Clone)]
+struct Entry {
+    priority: f64,
+    sequence: u64,
+    url: Url,
+    depth: u32,
+}
+
+impl PartialEq for Entry {
+    fn eq(&self, other: &Self) -> bool {
+        self.cmp(other) == Ordering::Equal
+    }
+}
+
+impl Eq for Entry {}
+
+impl PartialOrd for Entry {
+    fn partial_cmp(&self, other: &Self) -> Option<Ordering> {
+        Some(self.cmp(other))
+    }
+}
+
+impl Ord for Entry {
+    fn cmp(&self, other: &Self) -> Ordering {
+        self.priority
+            .total_cmp(&other.priority)
+            .then_with(|| other.sequence.cmp(&self.sequence))
+    }
+}
+
+/// The URLs waiting to be sent to the scrapers, the most important ones first.
+///
+/// # Fields
+///
+/// * `authority_weight`: The weight of the authority of a domain in the priority of its URLs.
+/// * `authorities`: The authority of each domain, from `0` to `1`.
+/// * `ahead`: The URLs queued ahead of everything else, like the fresh URLs, in order.
+/// * `entries`: The rest of the URLs, by their priority.
+/// * `sequence`: The number of URLs queued by their priority so far.
+///
+/// # Notes
+///
+/// * The priority of a URL is `(1 + authority_weight * authority) / (1 + depth)`, so shallow pages of important domains go first.
+#[derive(Debug, Clone, Default)]
+pub struct Frontier {
+    authority_weight: f64,
+    authorities: HashMap<String, f64>,
+    ahead: VecDeque<(Url, u32)>,
+    entries: BinaryHeap<Entry>,
+    sequence: u64,
+}
+
+impl Frontier {
+    /// Creates a new, empty frontier.
+    ///
+    /// # Arguments
+    ///
+    /// * `authority_weight`: The weight of the authority of a domain in the priority of its URLs, `0` to queue them by depth alone.
+    /// * `authorities`: The authority of each domain, from `0` to `1`.
+    ///
+    /// # Returns
+    ///
+    /// * `Frontier` - The new frontier.
+    #[must_use]
+    pub fn new(authority_weight: f64, authorities: HashMap<String, f64>) -> Self {
+        Self {
+            authority_weight,
+            authorities,
+            ..Self::default()
+        }
+    }
+
+    /// Loads the frontier settings from the environment, and the domain authorities from the database.
+    ///
+    /// # Returns
+    ///
+    /// * `Frontier` - The new, empty frontier, queueing by depth alone if the domain authorities could not be loaded.
+    pub async fn load() -> Self {
+        let authority_weight = utils::env::crawler::get_frontier_authority_weight();
+        if authority_weight <= 0.0 {
+            return Self::new(0.0, HashMap::new());
+        }
+
+        match database::get_domain_authorities().await {
+            Ok(authorities) => Self::new(
+                authority_weight,
+                authorities
+                    .into_iter()
+                    .map(|authority| (authority.domain, authority.score))
+                    .collect(),
+            ),
+            Err(err) => {
+                warn!(
+                    "Failed to load domain authorities, queueing URLs by depth alone ({}): {err}",
+                    err.code()
+                );
+
+                Self::new(0.0, HashMap::new())
+            }
+        }
+    }
+
+    /// Gets the number of queued URLs.
+    ///
+    /// # Returns
+    ///
+    /// * `usize` - The number of queued URLs.
+    #[must_use]
+    pub fn len(&self) -> usize {
+        self.ahead.len() + self.entries.len()
+    }
+
+    /// Checks if no URLs are queued.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the frontier is empty.
+    #[must_use]
+    pub fn is_empty(&self) -> bool {
+        self.ahead.is_empty() && self.entries.is_empty()
+    }
+
+    /// Queues a URL by its priority.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL.
+    /// * `depth`: The depth the URL is queued at.
+    pub fn push(&mut self, url: Url, depth: u32) {
+        let priority = self.get_priority(&url, depth);
+        self.entries.push(Entry {
+            priority,
+            sequence: self.sequence,
+            url,
+            depth,
+        });
+        self.sequence += 1;
+    }
+
+    /// Queues a URL ahead of everything else, so it's the next one taken.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL.
+    /// * `depth`: The depth the URL is queued at.
+    pub fn push_ahead(&mut self, url: Url, depth: u32) {
+        self.ahead.push_front((url, depth));
+    }
+
+    /// Takes the next URL to crawl.
+    ///
+    /// # Returns
+    ///
+    /// * `Some((Url, u32))` - The URL queued ahead last, otherwise the one with the highest priority, and its depth.
+    /// * `None` - If the frontier is empty.
+    pub fn pop(&mut self) -> Option<(Url, u32)> {
+        self.ahead
+            .pop_front()
+            .or_else(|| self.entries.pop().map(|entry| (entry.url, entry.depth)))
+    }
+
+    /// Gets the priority of a URL.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL.
+    /// * `depth`: The depth the URL is queued at.
+    ///
+    /// # Returns
+    ///
+    /// * `f64` - The priority of the URL, the highest goes first.
+    #[must_use]
+    pub fn get_priority(&self, url: &Url, depth: u32) -> f64 {
+        self.authority_weight.mul_add(self.get_authority(url), 1.0) / (1.0 + f64::from(depth))
+    }
+
+    /// Gets the authority of the domain of a URL.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL.
+    ///
+    /// # Returns
+    ///
+    /// * `f64` - The authority of the domain, from `0` to `1`, `0` if it's unknown.
+    ///
+    /// # Notes
+    ///
+    /// * A subdomain without an authority of its own gets the authority of its closest parent, like when searching.
+    fn get_authority(&self, url: &Url) -> f64 {
+        let Some(mut domain) = url.host_str() else {
+            return 0.0;
+        };
+
+        // Top-level domains are never scored, so the walk stops at the last dot.
+        loop {
+            if let Some(authority) = self.authorities.get(domain) {
+                return *authority;
+            }
+
+            match domain.split_once('.') {
+                Some((_, parent)) if parent.contains('.') => domain = parent,
+                _ => return 0.0,
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[allow(clippy::expect_used)]
+    fn url(url: &str) -> Url {
+        Url::parse(url).expect("Failed to parse URL!")
+    }
+
+    fn drain(frontier: &mut Frontier) -> Vec<(String, u32)> {
+        std::iter::from_fn(|| frontier.pop())
+            .map(|(url, depth)| (url.to_string(), depth))
+            .collect()
+    }
+
+    #[test]
+    fn test_pop() {
+        let mut frontier = Frontier::new(
+            1.0,
+            HashMap::from([
+                ("example.com".to_string(), 1.0),
+                ("blog.example.com".to_string(), 0.2),
+            ]),
+        );
+
+        frontier.push(url("https://other.com/a"), 1);
+        frontier.push(url("https://docs.example.com/"), 1);
+        frontier.push(url("https://other.com/"), 0);
+        frontier.push(url("https://blog.example.com/"), 1);
+        frontier.push(url("https://other.com/b"), 1);
+        frontier.push_ahead(url("https://news.example.com/"), 0);
+        assert_eq!(frontier.len(), 6);
+
+        // Subdomains inherit the authority of their parent, and URLs of the same priority go in order.
+        assert_eq!(
+            drain(&mut frontier),
+            vec![
+                ("https://news.example.com/".to_string(), 0),
+                ("https://docs.example.com/".to_string(), 1),
+                ("https://other.com/".to_string(), 0),
+                ("https://blog.example.com/".to_string(), 1),
+                ("https://other.com/a".to_string(), 1),
+                ("https://other.com/b".to_string(), 1),
+            ]
+        );
+        assert!(frontier.is_empty());
+    }
+
+    #[test]
+    fn test_pop_by_depth() {
+        let mut frontier = Frontier::new(0.0, HashMap::from([("example.com".to_string(), 1.0)]));
+
+        frontier.push(url("https://example.com/deep"), 2);
+        frontier.push(url("https://other.com/"), 0);
+        frontier.push(url("https://example.com/"), 1);
+
+        // Without an authority weight, the URLs are crawled breadth first.
+        assert_eq!(
+            drain(&mut frontier),
+            vec![
+                ("https://other.com/".to_string(), 0),
+                ("https://example.com/".to_string(), 1),
+                ("https://example.com/deep".to_string(), 2),
+            ]
+        );
+    }
+}
@@ -0,0 +1,574 @@
+use aes_gcm::aead::{Aead, AeadCore, KeyInit, OsRng, Payload};
+use aes_gcm::{Aes256Gcm, Nonce};
+use common::database;
+use common::database::model::HostOverride;
+use common::errors::Error;
+use common::utils;
+use log::warn;
+use reqwest::header::{HeaderValue, COOKIE};
+use reqwest::RequestBuilder;
+use serde::{Deserialize, Serialize};
+use sha2::{Digest, Sha256};
+use std::collections::HashMap;
+use std::fmt;
+use url::Url;
+
+/// The length of the nonce the credentials are encrypted behind.
+const NONCE_LENGTH: usize = 12;
+
+/// The credentials a partner site issued to the crawler.
+///
+/// # Variants
+///
+/// * `Basic`: A username and password, sent with HTTP basic authentication.
+/// * `Cookie`: A static `Cookie` header, like `session=...`.
+///
+/// # Notes
+///
+/// * The credentials are redacted when they're debug printed, so they're never logged.
+#[derive(Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Credentials {
+    Basic {
+        username: String,
+        password: Option<String>,
+    },
+    Cookie(String),
+}
+
+impl fmt::Debug for Credentials {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            Self::Basic { .. } => write!(f, "Basic(<redacted>)"),
+            Self::Cookie(_) => write!(f, "Cookie(<redacted>)"),
+        }
+    }
+}
+
+impl Credentials {
+    /// Adds the credentials to a request.
+    ///
+    /// # Arguments
+    ///
+    /// * `request`: The request.
+    ///
+    /// # Returns
+    ///
+    /// * `RequestBuilder` - The request, with the credentials marked as sensitive.
+    pub fn apply(&self, request: RequestBuilder) -> RequestBuilder {
+        match self {
+            Self::Basic { username, password } => request.basic_auth(username, password.as_ref()),
+            Self::Cookie(cookie) => match HeaderValue::from_str(cookie) {
+                Ok(mut value) => {
+                    value.set_sensitive(true);
+
+                    request.header(COOKIE, value)
+                }
+                Err(_) => {
+                    warn!("The cookie isn't a valid header, sending the request without it!");
+
+                    request
+                }
+            },
+        }
+    }
+
+    /// Validates the credentials.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(())` - If the credentials can be sent.
+    /// * `Err(Error)` - If the credentials can't be sent.
+    ///
+    /// # Errors
+    ///
+    /// * If the cookie contains characters that aren't allowed in headers.
+    pub fn validate(&self) -> Result<(), Error> {
+        match self {
+            Self::Basic { .. } => Ok(()),
+            Self::Cookie(cookie) => HeaderValue::from_str(cookie)
+                .map(|_| ())
+                .map_err(|_| Error::Credentials("The cookie isn't a valid header!".into())),
+        }
+    }
+}
+
+/// Encrypts and decrypts the credentials of hosts with AES-GCM.
+///
+/// # Fields
+///
+/// * `cipher`: The cipher, keyed with the SHA-256 of `CREDENTIALS_KEY`.
+pub struct Cipher {
+    cipher: Aes256Gcm,
+}
+
+impl fmt::Debug for Cipher {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "Cipher(<redacted>)")
+    }
+}
+
+impl Cipher {
+    /// Creates a new cipher.
+    ///
+    /// # Arguments
+    ///
+    /// * `key`: The key from the config, of any length.
+    ///
+    /// # Returns
+    ///
+    /// * `Cipher` - The new cipher.
+    #[must_use]
+    pub fn new(key: &str) -> Self {
+        Self {
+            cipher: Aes256Gcm::new(&Sha256::digest(key.as_bytes())),
+        }
+    }
+
+    /// Loads the cipher from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Cipher)` - The cipher, if `CREDENTIALS_KEY` is set.
+    /// * `None` - If `CREDENTIALS_KEY` isn't set.
+    #[must_use]
+    pub fn load() -> Option<Self> {
+        utils::env::scraper::get_credentials_key().map(|key| Self::new(&key))
+    }
+
+    /// Encrypts the credentials of a host.
+    ///
+    /// # Arguments
+    ///
+    /// * `host`: The host, which the credentials are bound to.
+    /// * `credentials`: The credentials.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Vec<u8>)` - A random nonce, followed by the encrypted credentials.
+    /// * `Err(Error)` - If the credentials could not be encrypted.
+    ///
+    /// # Errors
+    ///
+    /// * If the credentials could not be serialized or encrypted.
+    pub fn encrypt(&self, host: &str, credentials: &Credentials) -> Result<Vec<u8>, Error> {
+        let plaintext = serde_json::to_vec(credentials)
+            .map_err(|_| Error::Credentials("Failed to serialize the credentials!".into()))?;
+        let nonce = Aes256Gcm::generate_nonce(&mut OsRng);
+        let ciphertext = self
+            .cipher
+            .encrypt(
+                &nonce,
+                Payload {
+                    msg: &plaintext,
+                    aad: host.as_bytes(),
+                },
+            )
+            .map_err(|_| Error::Credentials("Failed to encrypt the credentials!".into()))?;
+
+        let mut encrypted = nonce.to_vec();
+        encrypted.extend(ciphertext);
+
+        Ok(encrypted)
+    }
+
+    /// Decrypts the credentials of a host.
+    ///
+    /// # Arguments
+    ///
+    /// * `host`: The host the credentials were encrypted for.
+    /// * `encrypted`: The nonce, followed by the encrypted credentials.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Credentials)` - The credentials.
+    /// * `Err(Error)` - If the credentials could not be decrypted.
+    ///
+    /// # Errors
+    ///
+    /// * If the credentials were encrypted with another key or for another host, or were tampered with.
+    pub fn decrypt(&self, host: &str, encrypted: &[u8]) -> Result<Credentials, Error> {
+        if encrypted.len() < NONCE_LENGTH {
+            return Err(Error::Credentials("The credentials are too short!".into()));
+        }
+
+        let (nonce, ciphertext) = encrypted.split_at(NONCE_LENGTH);
+        let plaintext = self
+            .cipher
+            .decrypt(
+                Nonce::from_slice(nonce),
+                Payload {
+                    msg: ciphertext,
+                    aad: host.as_bytes(),
+                },
+            )
+            .map_err(|_| Error::Credentials("Failed to decrypt the credentials!".into()))?;
+
+        serde_json::from_slice(&plaintext)
+            .map_err(|_| Error::Credentials("Failed to deserialize the credentials!".into()))
+    }
+}
+
+/// The settings of a host that differ from the defaults.
+///
+/// # Fields
+///
+/// * `credentials`: The credentials sent to the host, if any.
+/// * `exclude_from_search`: Whether the pages fetched with the credentials are left out of search results.
+/// * `allow_http`: Whether the credentials are also sent over plain HTTP, for hosts that don't support HTTPS.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Deserialize)]
+pub struct Override {
+    pub credentials: Option<Credentials>,
+    #[serde(default)]
+    pub exclude_from_search: bool,
+    #[serde(default)]
+    pub allow_http: bool,
+}
+
+/// The settings of every host that differs from the defaults.
+///
+/// # Fields
+///
+/// * `hosts`: The settings of each host.
+#[derive(Debug, Default)]
+pub struct Overrides {
+    hosts: HashMap<String, Override>,
+}
+
+impl Overrides {
+    /// Creates new host overrides.
+    ///
+    /// # Arguments
+    ///
+    /// * `hosts`: The settings of each host.
+    ///
+    /// # Returns
+    ///
+    /// * `Overrides` - The new host overrides.
+    #[must_use]
+    pub const fn new(hosts: HashMap<String, Override>) -> Self {
+        Self { hosts }
+    }
+
+    /// Loads the host overrides from the database, decrypting their credentials.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Overrides)` - The host overrides.
+    /// * `Err(Error)` - If the host overrides could not be retrieved.
+    ///
+    /// # Errors
+    ///
+    /// * If the host overrides could not be retrieved.
+    ///
+    /// # Notes
+    ///
+    /// * Hosts whose credentials can't be decrypted, or with `CREDENTIALS_KEY` unset, are crawled without them.
+    pub async fn load() -> Result<Self, Error> {
+        let cipher = Cipher::load();
+
+        let mut hosts = HashMap::new();
+        for host_override in database::get_host_overrides().await? {
+            let credentials = match (&host_override.credentials, &cipher) {
+                (None, _) => None,
+                (Some(_), None) => {
+                    warn!(
+                        "\"{}\" has credentials, but CREDENTIALS_KEY isn't set, crawling it without them...",
+                        host_override.host
+                    );
+
+                    None
+                }
+                (Some(encrypted), Some(cipher)) => {
+                    match cipher.decrypt(&host_override.host, encrypted) {
+                        Ok(credentials) => Some(credentials),
+                        Err(err) => {
+                            warn!(
+                                "Failed to decrypt the credentials of \"{}\", crawling it without them! Error ({}): {err}",
+                                host_override.host,
+                                err.code()
+                            );
+
+                            None
+                        }
+                    }
+                }
+            };
+
+            hosts.insert(
+                host_override.host,
+                Override {
+                    credentials,
+                    exclude_from_search: host_override.exclude_from_search,
+                    allow_http: host_override.allow_http,
+                },
+            );
+        }
+
+        Ok(Self::new(hosts))
+    }
+
+    /// Adds the credentials of the host of a URL to a request for it.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL that's requested.
+    /// * `request`: The request.
+    ///
+    /// # Returns
+    ///
+    /// * `RequestBuilder` - The request, with the credentials of exactly that host, if it has any.
+    ///
+    /// # Notes
+    ///
+    /// * The credentials are only sent over HTTPS, unless the host has `allow_http` set.
+    /// * The clients of the crawler don't follow redirects, so each hop is requested on its own, with only the credentials of its host.
+    /// * A redirect to another host never carries the credentials along, it gets the credentials of the host it leads to, if any.
+    pub fn authenticate(&self, url: &Url, request: RequestBuilder) -> RequestBuilder {
+        match self.get_credentials(url) {
+            Some(credentials) => credentials.apply(request),
+            None => request,
+        }
+    }
+
+    /// Tells whether a page was fetched with credentials, and has to be left out of search results because of it.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL the page was fetched from, after any redirects.
+    ///
+    /// # Returns
+    ///
+    /// * `(bool, bool)` - Whether the page was fetched with credentials, and whether it's excluded from search results.
+    ///
+    /// # Notes
+    ///
+    /// * Each hop of a redirect is authenticated like `authenticate` does, so only the host the page was fetched from matters.
+    #[must_use]
+    pub fn get_flags(&self, url: &Url) -> (bool, bool) {
+        let authenticated = self.get_credentials(url).is_some();
+        let excluded = authenticated
+            && self
+                .get(url)
+                .is_some_and(|host_override| host_override.exclude_from_search);
+
+        (authenticated, excluded)
+    }
+
+    /// Gets the settings of the host of a URL.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(&Override)` - The settings of the host, if it differs from the defaults.
+    /// * `None` - If the host uses the defaults.
+    #[must_use]
+    pub fn get(&self, url: &Url) -> Option<&Override> {
+        self.hosts.get(url.host_str()?)
+    }
+
+    /// Gets the credentials of the host of a URL.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(&Credentials)` - The credentials of the host, if it has any that may be sent to the URL.
+    /// * `None` - If the host has no credentials, or the URL is plain HTTP and the host doesn't allow it.
+    fn get_credentials(&self, url: &Url) -> Option<&Credentials> {
+        let host_override = self.get(url)?;
+        if url.scheme() != "https" && !host_override.allow_http {
+            return None;
+        }
+
+        host_override.credentials.as_ref()
+    }
+}
+
+/// Sets the settings of a host, encrypting its credentials.
+///
+/// # Arguments
+///
+/// * `host`: The host.
+/// * `settings`: The settings, as JSON like `{ "credentials": { "cookie": "session=..." }, "exclude_from_search": true, "allow_http": false }`.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the settings were set.
+/// * `Err(Error)` - If the settings could not be set.
+///
+/// # Errors
+///
+/// * If the settings aren't valid JSON, or the cookie isn't a valid header.
+/// * If there are credentials, but `CREDENTIALS_KEY` isn't set.
+/// * If the settings could not be stored.
+///
+/// # Notes
+///
+/// * Errors never contain the settings, so the credentials aren't logged.
+pub async fn set(host: &str, settings: &str) -> Result<(), Error> {
+    let host = host.trim().to_lowercase();
+    let host_override = serde_json::from_str::<Override>(settings).map_err(|err| {
+        Error::Credentials(format!(
+            "Invalid settings at line {}, column {}!",
+            err.line(),
+            err.column()
+        ))
+    })?;
+
+    let credentials = match &host_override.credentials {
+        Some(credentials) => {
+            let Some(cipher) = Cipher::load() else {
+                return Err(Error::Credentials(
+                    "CREDENTIALS_KEY must be set to store credentials!".into(),
+                ));
+            };
+
+            credentials.validate()?;
+
+            Some(cipher.encrypt(&host, credentials)?)
+        }
+        None => None,
+    };
+
+    database::set_host_override(&HostOverride {
+        host,
+        credentials,
+        exclude_from_search: host_override.exclude_from_search,
+        allow_http: host_override.allow_http,
+    })
+    .await
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use reqwest::header::AUTHORIZATION;
+    use reqwest::Client;
+
+    fn get_overrides() -> Overrides {
+        Overrides::new(HashMap::from([
+            (
+                "127.0.0.1".to_string(),
+                Override {
+                    credentials: Some(Credentials::Basic {
+                        username: "rse".into(),
+                        password: Some("secret".into()),
+                    }),
+                    exclude_from_search: true,
+                    // The test servers only speak plain HTTP.
+                    allow_http: true,
+                },
+            ),
+            (
+                "docs.example.com".to_string(),
+                Override {
+                    credentials: Some(Credentials::Cookie("session=secret".into())),
+                    exclude_from_search: false,
+                    allow_http: false,
+                },
+            ),
+        ]))
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_authenticate() {
+        let overrides = get_overrides();
+        let client = Client::new();
+        let request = |url: &str| {
+            let url = Url::parse(url).expect("Failed to parse URL!");
+
+            overrides
+                .authenticate(&url, client.get(url.clone()))
+                .build()
+                .expect("Failed to build request!")
+        };
+
+        // The credentials of a host are only sent to exactly that host.
+        let basic = request("http://127.0.0.1/private");
+        let authorization = basic
+            .headers()
+            .get(AUTHORIZATION)
+            .expect("Missing authorization!");
+        assert_eq!(authorization, "Basic cnNlOnNlY3JldA==");
+        assert!(authorization.is_sensitive());
+
+        let cookie = request("https://docs.example.com/");
+        assert_eq!(
+            cookie.headers().get(COOKIE).expect("Missing cookie!"),
+            "session=secret"
+        );
+        assert!(cookie.headers().get(AUTHORIZATION).is_none());
+
+        // Plain HTTP only gets the credentials of the hosts that allow it.
+        for url in [
+            "https://example.com/",
+            "https://www.docs.example.com/",
+            "http://docs.example.com/",
+        ] {
+            let headers = request(url).headers().clone();
+            assert!(headers.get(AUTHORIZATION).is_none() && headers.get(COOKIE).is_none());
+        }
+
+        // The credentials are never printed.
+        assert!(!format!("{overrides:?}").contains("secret"));
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_flags() {
+        let overrides = get_overrides();
+        let url = |url: &str| Url::parse(url).expect("Failed to parse URL!");
+
+        // Pages fetched with credentials are flagged, and excluded if their host requires it.
+        assert_eq!(
+            overrides.get_flags(&url("http://127.0.0.1/a")),
+            (true, true)
+        );
+        assert_eq!(
+            overrides.get_flags(&url("https://docs.example.com/")),
+            (true, false)
+        );
+        assert_eq!(
+            overrides.get_flags(&url("https://example.com/")),
+            (false, false)
+        );
+        assert_eq!(
+            overrides.get_flags(&url("http://docs.example.com/")),
+            (false, false)
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_cipher() {
+        let cipher = Cipher::new("key");
+        let credentials = Credentials::Cookie("session=secret".into());
+
+        let encrypted = cipher
+            .encrypt("docs.example.com", &credentials)
+            .expect("Failed to encrypt!");
+        assert_eq!(
+            cipher
+                .decrypt("docs.example.com", &encrypted)
+                .expect("Failed to decrypt!"),
+            credentials
+        );
+
+        // Credentials can't be decrypted for another host, with another key, or once tampered with.
+        assert!(cipher.decrypt("example.com", &encrypted).is_err());
+        assert!(Cipher::new("other")
+            .decrypt("docs.example.com", &encrypted)
+            .is_err());
+
+        let mut tampered = encrypted;
+        tampered[NONCE_LENGTH] ^= 1;
+        assert!(cipher.decrypt("docs.example.com", &tampered).is_err());
+    }
+}
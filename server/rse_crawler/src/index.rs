@@ -0,0 +1,538 @@
+use common::database;
+use common::database::model::{
+    Field, Keyword, NewImage, NewKeyword, NewLinkAnchor, NewPage, NewSimhash, NewStructuredData,
+    Page,
+};
+use common::database::store;
+use common::errors::Error;
+use common::utils;
+use diesel_async::AsyncPgConnection;
+use flate2::read::MultiGzDecoder;
+use flate2::write::GzEncoder;
+use flate2::Compression;
+use log::{info, warn};
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::fs::{self, File, OpenOptions};
+use std::io::{BufRead, BufReader, ErrorKind, Write};
+use std::path::{Path, PathBuf};
+use url::Url;
+
+/// The number of pages exported at a time.
+const BATCH_SIZE: i64 = 500;
+
+/// A page of the index, as it's exported.
+///
+/// # Fields
+///
+/// * `page`: The page.
+/// * `keywords`: The words in the body of the page, with how often they occur and where.
+/// * `title_keywords`: The words in the title of the page, missing from exports made before titles were indexed.
+/// * `heading_keywords`: The words in the headings of the page, missing from exports made before headings were indexed.
+/// * `image_keywords`: The words in the alt text and captions of the images on the page, missing from exports made before images were indexed.
+/// * `links`: The URLs the page links to, with how often they're linked.
+/// * `images`: The URL, alt text and caption of the images on the page, in the order they're on it.
+/// * `anchors`: The URLs the page links to, with the anchor texts of the links, missing from exports made before anchor texts were stored.
+/// * `structured_data`: The kind and JSON-LD of the structured data entities on the page, in the order they're on it, missing from exports made before structured data was stored.
+/// * `simhash`: The simhash of the text of the page, missing from exports made before simhashes were stored.
+#[derive(Debug, Serialize, Deserialize)]
+struct Entry {
+    page: Page,
+    keywords: Vec<(String, i32, Vec<i32>)>,
+    #[serde(default)]
+    title_keywords: Vec<(String, i32, Vec<i32>)>,
+    #[serde(default)]
+    heading_keywords: Vec<(String, i32, Vec<i32>)>,
+    #[serde(default)]
+    image_keywords: Vec<(String, i32, Vec<i32>)>,
+    links: Vec<(String, i32)>,
+    #[serde(default)]
+    images: Vec<(String, Option<String>, Option<String>)>,
+    #[serde(default)]
+    anchors: Vec<(String, String)>,
+    #[serde(default)]
+    structured_data: Vec<(String, String)>,
+    #[serde(default)]
+    simhash: Option<u64>,
+}
+
+/// How far an export got, so it can be resumed if interrupted.
+///
+/// # Fields
+///
+/// * `last_id`: The ID of the last exported page.
+/// * `offset`: The length of the export file after the last exported page.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+struct Checkpoint {
+    last_id: i32,
+    offset: u64,
+}
+
+impl Checkpoint {
+    /// Parses a checkpoint, formatted as `<last_id> <offset>`.
+    ///
+    /// # Arguments
+    ///
+    /// * `content`: The content of the checkpoint file.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Checkpoint)` - The checkpoint if it's valid.
+    /// * `None` - If the checkpoint is invalid.
+    fn parse(content: &str) -> Option<Self> {
+        let (last_id, offset) = content.trim().split_once(' ')?;
+
+        Some(Self {
+            last_id: last_id.parse().ok()?,
+            offset: offset.parse().ok()?,
+        })
+    }
+}
+
+impl std::fmt::Display for Checkpoint {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "{} {}", self.last_id, self.offset)
+    }
+}
+
+/// Gets the path of the checkpoint file of an export.
+fn get_checkpoint_path(path: &Path) -> PathBuf {
+    let mut checkpoint_path = path.as_os_str().to_owned();
+    checkpoint_path.push(".checkpoint");
+
+    PathBuf::from(checkpoint_path)
+}
+
+/// Exports the index as gzipped JSON Lines, one page per line.
+///
+/// # Arguments
+///
+/// * `path`: The path of the file to export to.
+///
+/// # Returns
+///
+/// * `Ok(usize)` - The number of pages exported by this run.
+/// * `Err(Error)` - If the index could not be exported.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the pages could not be retrieved.
+/// * If the file could not be written.
+///
+/// # Notes
+///
+/// * Pages are exported in batches, each written as its own gzip member, so only a batch is kept in memory.
+/// * If an earlier export to the same file was interrupted, it's resumed after the last batch it finished.
+pub async fn export(path: &Path) -> Result<usize, Error> {
+    let Ok(mut conn) = database::get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    let checkpoint_path = get_checkpoint_path(path);
+    let mut checkpoint = match fs::read_to_string(&checkpoint_path) {
+        Ok(content) => {
+            let Some(checkpoint) = Checkpoint::parse(&content) else {
+                return Err(Error::Internal(format!(
+                    "Invalid checkpoint \"{}\"!",
+                    checkpoint_path.display()
+                )));
+            };
+            info!(
+                "Resuming export after page {} at byte {}...",
+                checkpoint.last_id, checkpoint.offset
+            );
+
+            checkpoint
+        }
+        Err(err) if err.kind() == ErrorKind::NotFound => Checkpoint::default(),
+        Err(err) => return Err(err.into()),
+    };
+
+    // Drop anything written after the last finished batch.
+    let mut file = OpenOptions::new().create(true).append(true).open(path)?;
+    file.set_len(checkpoint.offset)?;
+
+    let mut exported = 0;
+    loop {
+        let pages = database::get_pages_after(&mut conn, checkpoint.last_id, BATCH_SIZE).await?;
+        let Some(last_id) = pages.last().map(|page| page.id) else {
+            break;
+        };
+
+        let mut encoder = GzEncoder::new(Vec::new(), Compression::default());
+        for page in &pages {
+            let entry = get_entry(&mut conn, page.clone()).await?;
+            let line =
+                serde_json::to_string(&entry).map_err(|err| Error::Internal(err.to_string()))?;
+
+            writeln!(encoder, "{line}")?;
+        }
+        let batch = encoder.finish()?;
+
+        file.write_all(&batch)?;
+        file.sync_data()?;
+
+        checkpoint = Checkpoint {
+            last_id,
+            offset: checkpoint.offset + batch.len() as u64,
+        };
+        fs::write(&checkpoint_path, checkpoint.to_string())?;
+
+        exported += pages.len();
+        info!("Exported {exported} pages...");
+    }
+
+    fs::remove_file(&checkpoint_path).or_else(|err| {
+        if err.kind() == ErrorKind::NotFound {
+            Ok(())
+        } else {
+            Err(err)
+        }
+    })?;
+
+    Ok(exported)
+}
+
+/// Gets the keywords, forward links, anchor texts, images and structured data of a page.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `page`: The page.
+///
+/// # Returns
+///
+/// * `Ok(Entry)` - The page with its keywords, forward links, anchor texts, images, structured data and simhash.
+/// * `Err(Error)` - If the keywords, forward links, anchor texts, images, structured data or simhash could not be retrieved.
+///
+/// # Errors
+///
+/// * If the keywords, forward links, anchor texts, images, structured data or simhash could not be retrieved.
+async fn get_entry(conn: &mut AsyncPgConnection, page: Page) -> Result<Entry, Error> {
+    let (title_keywords, keywords) = database::get_keywords_by_page_id(conn, page.id)
+        .await?
+        .unwrap_or_default()
+        .into_iter()
+        .partition::<Vec<_>, _>(|keyword| Field::parse(&keyword.field) == Some(Field::Title));
+    let (heading_keywords, keywords) = keywords
+        .into_iter()
+        .partition::<Vec<_>, _>(|keyword| Field::parse(&keyword.field) == Some(Field::Heading));
+    let (image_keywords, keywords) = keywords
+        .into_iter()
+        .partition::<Vec<_>, _>(|keyword| Field::parse(&keyword.field) == Some(Field::Image));
+    let get_keywords = |keywords: Vec<_>| {
+        keywords
+            .into_iter()
+            .map(|keyword: Keyword| (keyword.word, keyword.frequency, keyword.positions))
+            .collect()
+    };
+    let links = database::get_forward_links_by_page_id(conn, page.id)
+        .await?
+        .into_iter()
+        .map(|link| (link.to_page_url, link.frequency))
+        .collect();
+    let images = database::get_images_by_page_id(conn, page.id)
+        .await?
+        .into_iter()
+        .map(|image| (image.url, image.alt, image.caption))
+        .collect();
+    let anchors = database::get_link_anchors_by_page_id(conn, page.id)
+        .await?
+        .into_iter()
+        .map(|anchor| (anchor.to_page_url, anchor.text))
+        .collect();
+    let structured_data = database::get_structured_data_by_page_id(conn, page.id)
+        .await?
+        .into_iter()
+        .map(|entity| (entity.kind, entity.data))
+        .collect();
+    let simhash = database::get_simhash_by_page_id(conn, page.id)
+        .await?
+        .map(|simhash| u64::from_be_bytes(simhash.to_be_bytes()));
+
+    Ok(Entry {
+        page,
+        keywords: get_keywords(keywords),
+        title_keywords: get_keywords(title_keywords),
+        heading_keywords: get_keywords(heading_keywords),
+        image_keywords: get_keywords(image_keywords),
+        links,
+        images,
+        anchors,
+        structured_data,
+        simhash,
+    })
+}
+
+/// Imports an index exported by [`export`], replacing the index of every page in it.
+///
+/// # Arguments
+///
+/// * `path`: The path of the file to import from.
+///
+/// # Returns
+///
+/// * `Ok(usize)` - The number of pages imported.
+/// * `Err(Error)` - If the index could not be imported.
+///
+/// # Errors
+///
+/// * If the connection to a database could not be established.
+/// * If the file could not be read, or contains an invalid page.
+/// * If a page could not be restored.
+///
+/// # Notes
+///
+/// * If `DATABASE_SHARDS` is set, each page is imported into the shard it's stored on.
+pub async fn import(path: &Path) -> Result<usize, Error> {
+    let mut shards = Vec::new();
+    for url in utils::env::database::get_database_urls() {
+        let Ok(conn) = database::get_connection_to(&url).await else {
+            return Err(Error::Database("Failed to get database connection!".into()));
+        };
+
+        shards.push(conn);
+    }
+
+    let reader = BufReader::new(MultiGzDecoder::new(File::open(path)?));
+
+    let mut imported = 0;
+    for line in reader.lines() {
+        let line = line?;
+        if line.is_empty() {
+            continue;
+        }
+
+        let entry: Entry =
+            serde_json::from_str(&line).map_err(|err| Error::Internal(err.to_string()))?;
+        let shard = store::get_shard(&entry.page.url, shards.len());
+        let Some(conn) = shards.get_mut(shard) else {
+            return Err(Error::Database("There are no shards!".into()));
+        };
+        restore_entry(conn, entry).await?;
+
+        imported += 1;
+        if imported % 1_000 == 0 {
+            info!("Imported {imported} pages...");
+        }
+    }
+
+    Ok(imported)
+}
+
+/// Moves the index of `DATABASE_URL` to the shards in `DATABASE_SHARDS`, by exporting and importing it.
+///
+/// # Arguments
+///
+/// * `path`: The path of the file to export the index to.
+///
+/// # Returns
+///
+/// * `Ok(usize)` - The number of pages imported into the shards.
+/// * `Err(Error)` - If the index could not be moved.
+///
+/// # Errors
+///
+/// * If `DATABASE_SHARDS` doesn't list at least two databases, or lists `DATABASE_URL`.
+/// * If the index could not be exported or imported.
+///
+/// # Notes
+///
+/// * The pages are left in `DATABASE_URL`, since everything but the index is still stored there.
+/// * The export is kept, so resharding again after it was interrupted resumes the export.
+pub async fn reshard(path: &Path) -> Result<usize, Error> {
+    let shards = utils::env::database::get_database_urls();
+    if shards.len() < 2 {
+        return Err(Error::Internal(
+            "DATABASE_SHARDS must list at least two databases to reshard to!".into(),
+        ));
+    }
+
+    let source = std::env::var("DATABASE_URL")
+        .map_err(|_| Error::Internal("DATABASE_URL must be set to reshard from!".into()))?;
+    if shards.contains(&source) {
+        return Err(Error::Internal(
+            "DATABASE_SHARDS can't list DATABASE_URL, or the pages moved from it would still be found there!".into(),
+        ));
+    }
+
+    let exported = export(path).await?;
+    info!(
+        "Exported {exported} pages, importing them into {} shards...",
+        shards.len()
+    );
+
+    import(path).await
+}
+
+/// Restores a page with its keywords, forward links, anchor texts, images and structured data.
+///
+/// # Arguments
+///
+/// * `conn`: The database connection.
+/// * `entry`: The exported page.
+///
+/// # Returns
+///
+/// * `Ok(())` - If the page was restored.
+/// * `Err(Error)` - If the page could not be restored.
+///
+/// # Errors
+///
+/// * If the page, its keywords, its forward links, its anchor texts, its images or its structured data could not be restored.
+async fn restore_entry(conn: &mut AsyncPgConnection, entry: Entry) -> Result<(), Error> {
+    let url = Url::parse(&entry.page.url)?;
+    let new_page = NewPage {
+        url: entry.page.url,
+        title: entry.page.title,
+        description: entry.page.description,
+        encoding: entry.page.encoding,
+        index_fingerprint: entry.page.index_fingerprint,
+        language: entry.page.language,
+        published_at: entry.page.published_at,
+        content_modified_at: entry.page.content_modified_at,
+        content: None,
+        authenticated: entry.page.authenticated,
+        excluded: entry.page.excluded,
+        personalized: entry.page.personalized,
+        unstable: entry.page.unstable,
+        noarchive: entry.page.noarchive,
+        etag: entry.page.etag,
+        last_modified: entry.page.last_modified,
+    };
+    let page = database::restore_page(
+        conn,
+        &new_page,
+        entry.page.last_crawled_at,
+        entry.page.first_seen_at,
+    )
+    .await?;
+
+    database::delete_page_index(conn, page.id).await?;
+
+    let mut links = HashMap::new();
+    for (link, frequency) in entry.links {
+        match Url::parse(&link) {
+            Ok(link) => {
+                links.insert(link, frequency);
+            }
+            Err(err) => warn!("Skipping invalid link \"{link}\" on \"{url}\"! Error: {err}"),
+        }
+    }
+    database::create_forward_links(conn, &url, &links).await?;
+
+    let keywords = entry
+        .keywords
+        .into_iter()
+        .map(|keyword| (Field::Body, keyword))
+        .chain(
+            entry
+                .title_keywords
+                .into_iter()
+                .map(|keyword| (Field::Title, keyword)),
+        )
+        .chain(
+            entry
+                .heading_keywords
+                .into_iter()
+                .map(|keyword| (Field::Heading, keyword)),
+        )
+        .chain(
+            entry
+                .image_keywords
+                .into_iter()
+                .map(|keyword| (Field::Image, keyword)),
+        )
+        .map(|(field, (word, frequency, positions))| NewKeyword {
+            page_id: page.id,
+            word,
+            frequency,
+            positions,
+            field: field.as_str().into(),
+        })
+        .collect::<Vec<_>>();
+    database::create_keywords(conn, &keywords).await?;
+
+    let images = entry
+        .images
+        .into_iter()
+        .enumerate()
+        .map(|(position, (image_url, alt, caption))| NewImage {
+            page_id: page.id,
+            url: image_url,
+            alt,
+            caption,
+            position: i32::try_from(position).unwrap_or(i32::MAX),
+        })
+        .collect::<Vec<_>>();
+    database::create_images(conn, &images).await?;
+
+    let anchors = entry
+        .anchors
+        .into_iter()
+        .map(|(to_page_url, text)| NewLinkAnchor {
+            from_page_id: page.id,
+            to_page_url,
+            text,
+        })
+        .collect::<Vec<_>>();
+    database::create_link_anchors(conn, &anchors).await?;
+
+    let structured_data = entry
+        .structured_data
+        .into_iter()
+        .enumerate()
+        .map(|(position, (kind, data))| NewStructuredData {
+            page_id: page.id,
+            kind,
+            data,
+            position: i32::try_from(position).unwrap_or(i32::MAX),
+        })
+        .collect::<Vec<_>>();
+    database::create_structured_data(conn, &structured_data).await?;
+
+    if let Some(simhash) = entry.simhash {
+        let [band_0, band_1, band_2, band_3] = utils::simhash::get_bands(simhash);
+        database::create_simhashes(
+            conn,
+            &[NewSimhash {
+                page_id: page.id,
+                simhash: i64::from_be_bytes(simhash.to_be_bytes()),
+                band_0,
+                band_1,
+                band_2,
+                band_3,
+            }],
+        )
+        .await?;
+    }
+
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_checkpoint() {
+        let checkpoint = Checkpoint {
+            last_id: 1500,
+            offset: 123_456,
+        };
+
+        assert_eq!(checkpoint.to_string(), "1500 123456");
+        assert_eq!(Checkpoint::parse("1500 123456\n"), Some(checkpoint));
+        assert_eq!(Checkpoint::parse("1500"), None);
+        assert_eq!(Checkpoint::parse("page 1500"), None);
+    }
+
+    #[test]
+    fn test_get_checkpoint_path() {
+        assert_eq!(
+            get_checkpoint_path(Path::new("backups/index.jsonl.gz")),
+            PathBuf::from("backups/index.jsonl.gz.checkpoint")
+        );
+    }
+}
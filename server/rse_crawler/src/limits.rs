@@ -0,0 +1,171 @@
+use common::errors::Error;
+use common::utils;
+use scraper::Html;
+use std::time::Duration;
+
+/// The limits of extracting a document, so one hostile page can't stall a worker.
+///
+/// # Fields
+///
+/// * `timeout`: The time parsing a document may take, if limited.
+/// * `maximum_nodes`: The maximum number of nodes in a document, if limited.
+/// * `maximum_depth`: The maximum depth of the elements in a document, if limited.
+///
+/// # Notes
+///
+/// * HTML is the only type of document that's extracted, so it's the only one the limits apply to.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct Limits {
+    pub timeout: Option<Duration>,
+    pub maximum_nodes: Option<usize>,
+    pub maximum_depth: Option<usize>,
+}
+
+impl Limits {
+    /// Loads the limits from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Limits` - The limits.
+    #[must_use]
+    pub fn load() -> Self {
+        Self {
+            timeout: utils::env::scraper::get_extraction_timeout(),
+            maximum_nodes: utils::env::scraper::get_maximum_nodes(),
+            maximum_depth: utils::env::scraper::get_maximum_tree_depth(),
+        }
+    }
+
+    /// Checks that a document can be extracted within the limits.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(())` - If the document is within the limits.
+    /// * `Err(Error)` - If the document is outside the limits.
+    ///
+    /// # Errors
+    ///
+    /// * If parsing the document takes longer than the timeout.
+    /// * If the document has too many nodes, or elements nested too deeply.
+    ///
+    /// # Notes
+    ///
+    /// * The document is parsed on a blocking thread, so the worker moves on once the timeout is up, even if the parse doesn't.
+    pub async fn check(&self, html: &str) -> Result<(), Error> {
+        let limits = *self;
+        let html = html.to_string();
+        let parse = tokio::task::spawn_blocking(move || limits.check_tree(&html));
+
+        let result = match self.timeout {
+            Some(timeout) => tokio::time::timeout(timeout, parse).await.map_err(|_| {
+                Error::Timeout(format!(
+                    "Parsing took longer than {} seconds!",
+                    timeout.as_secs()
+                ))
+            })?,
+            None => parse.await,
+        };
+
+        result.map_err(|err| Error::Internal(format!("Failed to parse document! Error: {err}")))?
+    }
+
+    /// Parses a document and checks the size of its tree.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(())` - If the tree is within the limits.
+    /// * `Err(Error)` - If the tree is outside the limits.
+    ///
+    /// # Errors
+    ///
+    /// * If the tree has too many nodes, or elements nested too deeply.
+    ///
+    /// # Notes
+    ///
+    /// * The tree is walked without recursing, and the walk stops at the first limit that's exceeded.
+    fn check_tree(&self, html: &str) -> Result<(), Error> {
+        let document = Html::parse_document(html);
+
+        let mut nodes = 0_usize;
+        let mut stack = vec![(document.tree.root(), 0_usize)];
+        while let Some((node, depth)) = stack.pop() {
+            nodes += 1;
+            if self.maximum_nodes.is_some_and(|maximum| nodes > maximum) {
+                return Err(Error::Extraction(format!(
+                    "The document has more than {} nodes!",
+                    nodes - 1
+                )));
+            }
+
+            if self.maximum_depth.is_some_and(|maximum| depth > maximum) {
+                return Err(Error::Extraction(format!(
+                    "The document has elements nested deeper than {} levels!",
+                    depth - 1
+                )));
+            }
+
+            stack.extend(node.children().map(|child| (child, depth + 1)));
+        }
+
+        Ok(())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn get_limits(maximum_nodes: usize, maximum_depth: usize) -> Limits {
+        Limits {
+            timeout: Some(Duration::from_secs(30)),
+            maximum_nodes: Some(maximum_nodes),
+            maximum_depth: Some(maximum_depth),
+        }
+    }
+
+    /// Nests `depth` unclosed elements, the way a hostile page would.
+    fn get_nested(depth: usize) -> String {
+        format!("<html><body>{}text</body></html>", "<div>".repeat(depth))
+    }
+
+    #[tokio::test]
+    async fn test_check() {
+        let limits = get_limits(10_000, 256);
+        assert!(limits
+            .check("<html><body><p>Hello, <b>world</b>!</p></body></html>")
+            .await
+            .is_ok());
+        assert!(limits.check(&get_nested(200)).await.is_ok());
+
+        // Too deep, even though there are few enough nodes.
+        assert!(matches!(
+            limits.check(&get_nested(5_000)).await,
+            Err(Error::Extraction(_))
+        ));
+
+        // Too many nodes, even though none of them are nested.
+        assert!(matches!(
+            limits.check(&"<p>a</p>".repeat(20_000)).await,
+            Err(Error::Extraction(_))
+        ));
+    }
+
+    #[tokio::test]
+    async fn test_unlimited() {
+        let limits = Limits {
+            timeout: None,
+            maximum_nodes: None,
+            maximum_depth: None,
+        };
+
+        assert!(limits.check(&get_nested(5_000)).await.is_ok());
+    }
+}
@@ -1,36 +1,346 @@
-use crate::crawler::Crawler;
+use crate::crawl_log::CrawlLog;
+use crate::crawler::{Crawler, Freshness};
+use crate::decision::Evaluator;
+use crate::exclusions::Exclusions;
+use crate::hosts::Overrides;
+use crate::retries::Retries;
 use crate::scrapers::web::Web;
-use common::utils;
-use log::info;
-use reqwest::header::{HeaderMap, HeaderValue, CONNECTION, USER_AGENT};
+use crate::scrapers::Scraper;
+use crate::throttle::Throttle;
+use crate::traps::Traps;
+use crate::usage::Usage;
+use crate::writer::Writer;
+use common::database::store;
+use common::utils::compression::Codec;
+use common::utils::words::Dictionary;
+use common::{database, utils};
+use log::{error, info, warn};
+use std::collections::{HashMap, HashSet};
+use std::io::Read;
+use std::path::Path;
 use std::sync::Arc;
 
+mod admin;
+mod budget;
+mod charset;
+mod cleanup;
+mod client;
+mod content;
+mod crawl_log;
 mod crawler;
+mod decision;
+mod exclusions;
+mod frontier;
+mod hosts;
+mod index;
+mod limits;
+mod pagination;
+mod personalization;
+mod rate;
+mod retries;
 mod robots;
 mod scrapers;
+mod seeds;
+mod text;
+mod throttle;
+mod traps;
+mod usage;
+mod writer;
 
 #[tokio::main]
 #[allow(clippy::expect_used)]
 async fn main() {
     env_logger::init();
 
+    // Dry runs evaluate the URLs that would be crawled first, without crawling them or writing anything.
+    let (flags, args): (Vec<_>, Vec<_>) =
+        std::env::args().skip(1).partition(|arg| arg == "--dry-run");
+    let dry_run = !flags.is_empty();
+
+    let mut commands = args.iter().map(String::as_str);
+    match (commands.next(), commands.next()) {
+        (Some("export-index"), Some(path)) => {
+            info!("Exporting index to \"{path}\"...");
+
+            match index::export(Path::new(&path)).await {
+                Ok(exported) => info!("Exported {exported} pages!"),
+                Err(err) => error!("Failed to export index! Error: {err}"),
+            }
+
+            return;
+        }
+        (Some("import-index"), Some(path)) => {
+            info!("Importing index from \"{path}\"...");
+
+            match index::import(Path::new(&path)).await {
+                Ok(imported) => info!("Imported {imported} pages!"),
+                Err(err) => error!("Failed to import index! Error: {err}"),
+            }
+
+            return;
+        }
+        (Some("reshard"), Some(path)) => {
+            info!("Resharding index through \"{path}\"...");
+
+            match index::reshard(Path::new(&path)).await {
+                Ok(imported) => info!("Moved {imported} pages to the shards!"),
+                Err(err) => error!("Failed to reshard index! Error: {err}"),
+            }
+
+            return;
+        }
+        (Some("train-content-dictionary"), Some(path)) => {
+            info!("Training content dictionary to \"{path}\"...");
+
+            match content::train(Path::new(&path)).await {
+                Ok(trained) => info!("Trained the dictionary on {trained} pages!"),
+                Err(err) => error!("Failed to train content dictionary! Error: {err}"),
+            }
+
+            return;
+        }
+        (Some("check-url"), Some(url)) => {
+            let scraper = Web::new(
+                client::build().expect("Failed to build HTTP clients!"),
+                Evaluator::load(),
+                Dictionary::load().expect("Failed to load dictionary!"),
+                Arc::new(Usage::start()),
+                Arc::new(Throttle::load()),
+                Overrides::load()
+                    .await
+                    .expect("Failed to load host overrides!"),
+                Arc::new(Writer::new(1, 0, Codec::default(), store::load())),
+                Arc::new(CrawlLog::default()),
+            );
+
+            let decision = scraper.check_url(url, 0, &HashSet::new()).await;
+            println!(
+                "{}",
+                serde_json::to_string_pretty(&decision).expect("Failed to serialize decision!")
+            );
+
+            return;
+        }
+        (Some("compress-content"), None) => {
+            info!("Compressing the content of pages...");
+
+            let codec = Codec::load().expect("Failed to load content dictionary!");
+            match content::compress(&codec).await {
+                Ok(savings) => info!(
+                    "Compressed {} pages, from {} to {} bytes ({:.1}% saved)!",
+                    savings.pages,
+                    savings.before,
+                    savings.after,
+                    savings.ratio() * 100.0
+                ),
+                Err(err) => error!("Failed to compress content! Error: {err}"),
+            }
+
+            return;
+        }
+        (Some("remove-stale-pages"), None) => {
+            info!("Removing stale pages...");
+
+            match cleanup::remove_stale_pages(dry_run).await {
+                Ok(removed) if dry_run => info!("Would remove {removed} stale pages!"),
+                Ok(removed) => info!("Removed {removed} stale pages!"),
+                Err(err) => error!("Failed to remove stale pages! Error: {err}"),
+            }
+
+            return;
+        }
+        (Some("set-host-override"), Some(host)) => {
+            info!("Reading the settings of \"{host}\" from stdin...");
+
+            let mut settings = String::new();
+            if let Err(err) = std::io::stdin().read_to_string(&mut settings) {
+                error!("Failed to read the settings! Error: {err}");
+
+                return;
+            }
+
+            match hosts::set(host, &settings).await {
+                Ok(()) => info!("Set the settings of \"{host}\"!"),
+                Err(err) => error!("Failed to set the settings of \"{host}\"! Error: {err}"),
+            }
+
+            return;
+        }
+        (Some(command @ ("export-index" | "import-index" | "reshard")), None) => {
+            error!("The \"{command}\" command takes the path of the index file!");
+
+            return;
+        }
+        (Some("train-content-dictionary"), None) => {
+            error!(
+                "The \"train-content-dictionary\" command takes the path of the dictionary file!"
+            );
+
+            return;
+        }
+        (Some("check-url"), None) => {
+            error!("The \"check-url\" command takes the URL to check!");
+
+            return;
+        }
+        (Some("set-host-override"), None) => {
+            error!("The \"set-host-override\" command takes the host to set the settings of!");
+
+            return;
+        }
+        _ => {}
+    }
+
+    let dictionary = Dictionary::load().expect("Failed to load dictionary!");
+    let stale_urls = database::get_stale_page_urls(&dictionary.fingerprint())
+        .await
+        .expect("Failed to get pages indexed with a different dictionary!");
+
+    let restored_urls = match args.first().map(String::as_str) {
+        None => {
+            if !stale_urls.is_empty() {
+                warn!(
+                    "{} pages were indexed with a different dictionary, run the \"reindex\" command to reindex them!",
+                    stale_urls.len()
+                );
+            }
+
+            HashMap::new()
+        }
+        Some("restore-frontier") => {
+            info!("Restoring frontier from the latest snapshot...");
+
+            database::get_latest_frontier_snapshot()
+                .await
+                .expect("Failed to restore frontier snapshot!")
+        }
+        Some("reindex") => {
+            info!(
+                "{} pages are affected by the dictionary change, queueing them for reindexing...",
+                stale_urls.len()
+            );
+
+            stale_urls.into_iter().map(|url| (url, 0)).collect()
+        }
+        Some(command) => {
+            error!("Unknown command \"{command}\"! Available commands: restore-frontier, reindex, export-index, import-index, reshard, check-url, compress-content, remove-stale-pages, train-content-dictionary, set-host-override");
+
+            return;
+        }
+    };
+
+    let throttle = Arc::new(Throttle::load());
+    let evaluator = Evaluator::load();
     let crawler = Crawler::new(
         utils::env::crawler::get_delay(),
         utils::env::workers::get_crawlers(),
         utils::env::workers::get_processors(),
+        utils::env::crawler::get_frontier_snapshot_interval(),
+        evaluator.clone(),
+        utils::env::crawler::get_sample_rate(),
+        utils::env::crawler::get_sample_seed(),
+        Traps::load(),
+        Exclusions::load(),
+        Freshness::load(),
+        utils::env::crawler::get_submission_interval(),
+        Retries::load().map(Arc::new),
+        throttle.clone(),
     );
 
-    let mut headers = HeaderMap::new();
-    headers.insert(USER_AGENT, utils::env::scraper::get_user_agent());
-    headers.insert(CONNECTION, HeaderValue::from_static("keep-alive"));
+    let usage = Arc::new(Usage::start());
+    let crawl_log = Arc::new(CrawlLog::default());
+    let writer = Arc::new(Writer::new(
+        utils::env::crawler::get_page_batch_size(),
+        utils::env::crawler::get_history_length(),
+        Codec::load().expect("Failed to load content dictionary!"),
+        store::load(),
+    ));
+
+    // Nothing is flushed in dry runs.
+    if !dry_run {
+        if let Some(interval) = utils::env::crawler::get_usage_flush_interval() {
+            Usage::flush_every(usage.clone(), interval);
+        }
+        if let Some(interval) = utils::env::crawler::get_crawl_log_flush_interval() {
+            CrawlLog::flush_every(crawl_log.clone(), interval);
+        }
+        if writer.is_batched() {
+            Writer::flush_every(
+                writer.clone(),
+                utils::env::crawler::get_page_batch_interval(),
+            );
+        }
+    }
+
+    let transports = client::build().expect("Failed to build HTTP clients!");
+    let scraper = Arc::new(Web::new(
+        transports,
+        evaluator,
+        dictionary,
+        usage.clone(),
+        throttle,
+        Overrides::load()
+            .await
+            .expect("Failed to load host overrides!"),
+        writer,
+        crawl_log.clone(),
+    ));
+
+    if dry_run {
+        info!("Evaluating the initial URLs without crawling them...");
+
+        let mut visited_urls = HashSet::new();
+        let initial_urls = scraper
+            .seed_urls()
+            .into_iter()
+            .chain(restored_urls)
+            .collect::<Vec<_>>();
+        let mut crawled = 0;
+        for (url, depth) in &initial_urls {
+            let decision = scraper.check_url(url.as_str(), *depth, &visited_urls).await;
+            let detail = decision
+                .steps
+                .iter()
+                .map(|step| step.detail.as_str())
+                .collect::<Vec<_>>()
+                .join(" -> ");
+
+            if decision.crawl {
+                crawled += 1;
+                info!("Would crawl \"{url}\": {detail}");
+            } else {
+                info!("Would skip \"{url}\": {detail}");
+            }
+
+            visited_urls.insert(url.clone());
+        }
+
+        info!(
+            "Would crawl {crawled} of {} initial URLs!",
+            initial_urls.len()
+        );
+
+        return;
+    }
+
+    if let Some(address) = utils::env::web::get_crawler_admin_address() {
+        let scraper = scraper.clone();
+        let crawl_log = crawl_log.clone();
+
+        tokio::spawn(async move {
+            if let Err(err) = admin::serve(address, scraper, crawl_log).await {
+                error!("Failed to run admin server! Error: {err}");
+            }
+        });
+    }
 
-    let http_client = reqwest::Client::builder()
-        .default_headers(headers)
-        .timeout(utils::env::scraper::get_http_timeout())
-        .build()
-        .expect("Failed to build HTTP client!");
-    let scraper = Arc::new(Web::new(http_client, utils::env::scraper::get_max_depth()));
+    info!("Starting crawler run \"{}\"...", usage.run_id());
+    crawler.run(scraper, restored_urls).await;
 
-    info!("Starting crawler...");
-    crawler.run(scraper).await;
+    if let Err(err) = usage.flush().await {
+        error!("Failed to flush crawl usage! Error: {err}");
+    }
+    if let Err(err) = crawl_log.flush().await {
+        error!("Failed to flush crawl log! Error: {err}");
+    }
 }
@@ -0,0 +1,228 @@
+use common::utils;
+use common::utils::urls;
+use log::{info, warn};
+use std::collections::{HashMap, HashSet};
+use std::sync::Mutex;
+use url::Url;
+
+/// The placeholder for the page number in a pagination template.
+const PAGE_NUMBER: &str = "{n}";
+
+/// The paginated listings of hosts, walked page by page to find content that isn't reachable by links.
+///
+/// # Fields
+///
+/// * `listings`: The pages of the listing of each host, in order, starting at page `1`.
+/// * `pages`: The host and index of every page of every listing.
+/// * `seen_links`: The links found on the pages of each listing that have been walked so far.
+///
+/// # Notes
+///
+/// * Walking a listing is aggressive, so it's only done for the hosts it's configured for.
+#[derive(Debug, Default)]
+pub struct Pagination {
+    listings: HashMap<String, Vec<Url>>,
+    pages: HashMap<Url, (String, usize)>,
+    seen_links: Mutex<HashMap<String, HashSet<Url>>>,
+}
+
+impl Pagination {
+    /// Creates new paginated listings.
+    ///
+    /// # Arguments
+    ///
+    /// * `templates`: The hosts and their templates, like `/blog?page={n}`, resolved against the root of the host.
+    /// * `maximum_pages`: The maximum number of pages walked per listing.
+    ///
+    /// # Returns
+    ///
+    /// * `Pagination` - The new listings.
+    ///
+    /// # Notes
+    ///
+    /// * Templates without `{n}`, or that don't expand to valid URLs, are skipped.
+    #[must_use]
+    pub fn new(templates: &[(String, String)], maximum_pages: usize) -> Self {
+        let mut pagination = Self::default();
+        for (host, template) in templates {
+            if !template.contains(PAGE_NUMBER) {
+                warn!("Skipping pagination template \"{template}\" of \"{host}\", it has no {PAGE_NUMBER}!");
+
+                continue;
+            }
+
+            let Some(listing) = (1..=maximum_pages)
+                .map(|number| expand(host, template, number))
+                .collect::<Option<Vec<_>>>()
+            else {
+                warn!("Skipping pagination template \"{template}\" of \"{host}\", it isn't a valid URL!");
+
+                continue;
+            };
+
+            for (index, page) in listing.iter().enumerate() {
+                pagination.pages.insert(page.clone(), (host.clone(), index));
+            }
+            pagination.listings.insert(host.clone(), listing);
+        }
+
+        pagination
+    }
+
+    /// Creates new paginated listings from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Pagination` - The new listings.
+    #[must_use]
+    pub fn load() -> Self {
+        Self::new(
+            &utils::env::scraper::get_pagination_templates(),
+            utils::env::scraper::get_maximum_pagination_pages(),
+        )
+    }
+
+    /// Gets the first page of each listing, to seed the crawl with.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<Url>` - The first pages.
+    #[must_use]
+    pub fn seed_urls(&self) -> Vec<Url> {
+        self.listings
+            .values()
+            .filter_map(|listing| listing.first().cloned())
+            .collect()
+    }
+
+    /// Gets the page after a page of a listing, if walking the listing should go on.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the page that was crawled.
+    /// * `links`: The links found on the page.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Url)` - The next page of the listing.
+    /// * `None` - If the URL isn't a page of a listing, it's the last page, or it has no new links.
+    ///
+    /// # Notes
+    ///
+    /// * Links to the pages of the listing itself don't count as new, so a "load more" link can't keep it going.
+    /// * A page past the end of a listing is usually empty, or repeats the last page, which both stop the walk.
+    pub fn get_next(&self, url: &Url, links: &[(Url, i32)]) -> Option<Url> {
+        let (host, index) = self.pages.get(url)?;
+
+        let new_links = {
+            let mut seen_links = self.seen_links.lock().ok()?;
+            let seen_links = seen_links.entry(host.clone()).or_default();
+
+            let mut new_links = 0;
+            for (link, _) in links {
+                if !self.pages.contains_key(link) && seen_links.insert(link.clone()) {
+                    new_links += 1;
+                }
+            }
+
+            new_links
+        };
+        if new_links == 0 {
+            info!(
+                "Page {} of the listing of \"{host}\" has no new links, stopping...",
+                index + 1
+            );
+
+            return None;
+        }
+
+        self.listings.get(host)?.get(index + 1).cloned()
+    }
+}
+
+/// Expands a pagination template.
+///
+/// # Arguments
+///
+/// * `host`: The host the template is resolved against.
+/// * `template`: The template.
+/// * `number`: The number of the page.
+///
+/// # Returns
+///
+/// * `Some(Url)` - The normalized URL of the page.
+/// * `None` - If the template doesn't expand to a valid URL.
+fn expand(host: &str, template: &str, number: usize) -> Option<Url> {
+    Url::parse(&format!("https://{host}/"))
+        .and_then(|base| base.join(&template.replace(PAGE_NUMBER, &number.to_string())))
+        .ok()
+        .map(|url| urls::normalize(&url))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn get_links(links: &[&str]) -> Vec<(Url, i32)> {
+        links
+            .iter()
+            .filter_map(|link| Url::parse(link).ok())
+            .map(|link| (link, 1))
+            .collect()
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_next() {
+        let pagination = Pagination::new(
+            &[
+                ("example.com".into(), "/blog?page={n}".into()),
+                ("example.org".into(), "/blog".into()),
+            ],
+            3,
+        );
+        let page = |number: usize| {
+            Url::parse(&format!("https://example.com/blog?page={number}"))
+                .expect("Failed to parse page URL!")
+        };
+
+        assert_eq!(pagination.seed_urls(), vec![page(1)]);
+
+        let next = pagination.get_next(
+            &page(1),
+            &get_links(&[
+                "https://example.com/posts/1",
+                "https://example.com/blog?page=2",
+            ]),
+        );
+        assert_eq!(next, Some(page(2)));
+
+        // Only links to the listing itself, or to posts that were already found, stop the walk.
+        assert_eq!(
+            pagination.get_next(
+                &page(2),
+                &get_links(&[
+                    "https://example.com/posts/1",
+                    "https://example.com/blog?page=3",
+                ]),
+            ),
+            None
+        );
+        assert_eq!(pagination.get_next(&page(2), &[]), None);
+
+        // The last page has no next page, even with new links.
+        assert_eq!(
+            pagination.get_next(&page(3), &get_links(&["https://example.com/posts/3"])),
+            None
+        );
+
+        // Pages that aren't part of a listing have none either.
+        assert_eq!(
+            pagination.get_next(
+                &Url::parse("https://example.com/blog").expect("Failed to parse URL!"),
+                &get_links(&["https://example.com/posts/4"]),
+            ),
+            None
+        );
+    }
+}
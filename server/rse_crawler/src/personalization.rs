@@ -0,0 +1,180 @@
+use reqwest::header::{HeaderMap, SET_COOKIE, VARY};
+use std::collections::HashSet;
+
+/// The share of words two fetches of a page must have in common, for its content to be stable.
+const MINIMUM_SIMILARITY: f64 = 0.5;
+
+/// Checks if a response may be personalized, so what's indexed may not be what others see.
+///
+/// # Arguments
+///
+/// * `headers`: The headers of the response.
+///
+/// # Returns
+///
+/// * `bool` - Whether the response sets a cookie, or varies by the cookies of the request.
+///
+/// # Notes
+///
+/// * `Vary: *` counts too, since it varies by anything, cookies included.
+#[must_use]
+pub fn is_personalized(headers: &HeaderMap) -> bool {
+    headers.contains_key(SET_COOKIE)
+        || headers
+            .get_all(VARY)
+            .iter()
+            .filter_map(|value| value.to_str().ok())
+            .flat_map(|value| value.split(','))
+            .map(str::trim)
+            .any(|header| header == "*" || header.eq_ignore_ascii_case("cookie"))
+}
+
+/// Gets how similar the text of two fetches of a page is.
+///
+/// # Arguments
+///
+/// * `text_a`: The text of the first fetch.
+/// * `text_b`: The text of the second fetch.
+///
+/// # Returns
+///
+/// * `f64` - The share of the distinct words of both texts that are in both, from `0` to `1`.
+#[allow(clippy::cast_precision_loss)]
+#[must_use]
+pub fn get_similarity(text_a: &str, text_b: &str) -> f64 {
+    let words_a = text_a.split_whitespace().collect::<HashSet<_>>();
+    let words_b = text_b.split_whitespace().collect::<HashSet<_>>();
+
+    let union = words_a.union(&words_b).count();
+    if union == 0 {
+        return 1.0;
+    }
+
+    words_a.intersection(&words_b).count() as f64 / union as f64
+}
+
+/// Checks if the content of a page is unstable, from two fetches right after each other.
+///
+/// # Arguments
+///
+/// * `text_a`: The text of the first fetch.
+/// * `text_b`: The text of the second fetch.
+///
+/// # Returns
+///
+/// * `bool` - Whether the texts have less than `MINIMUM_SIMILARITY` of their words in common.
+///
+/// # Notes
+///
+/// * A changed timestamp or token doesn't make a page unstable, only content that differs wildly does.
+#[must_use]
+pub fn is_unstable(text_a: &str, text_b: &str) -> bool {
+    get_similarity(text_a, text_b) < MINIMUM_SIMILARITY
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use reqwest::header::HeaderValue;
+    use reqwest::Client;
+    use std::sync::atomic::{AtomicUsize, Ordering};
+    use std::sync::Arc;
+    use tokio::io::{AsyncReadExt, AsyncWriteExt};
+    use tokio::net::TcpListener;
+
+    /// Serves different content with a new cookie to every connection, like a personalized front page.
+    #[allow(clippy::expect_used)]
+    async fn serve_random() -> String {
+        let listener = TcpListener::bind("127.0.0.1:0")
+            .await
+            .expect("Failed to bind listener!");
+        let address = listener.local_addr().expect("Failed to get address!");
+        let requests = Arc::new(AtomicUsize::new(0));
+
+        tokio::spawn(async move {
+            while let Ok((mut stream, _)) = listener.accept().await {
+                let mut buffer = [0; 1024];
+                let _ = stream.read(&mut buffer).await;
+
+                let request = requests.fetch_add(1, Ordering::SeqCst);
+                let body = (0..20)
+                    .map(|word| format!("word{}", rand::random::<u32>() ^ word))
+                    .collect::<Vec<_>>()
+                    .join(" ");
+                let response = format!(
+                    "HTTP/1.1 200 OK\r\nSet-Cookie: session={request}\r\nVary: Cookie\r\n\
+                     Content-Length: {}\r\nConnection: close\r\n\r\n{body}",
+                    body.len()
+                );
+                let _ = stream.write_all(response.as_bytes()).await;
+            }
+        });
+
+        format!("http://{address}/")
+    }
+
+    fn get_headers(headers: &[(&'static str, &'static str)]) -> HeaderMap {
+        let mut map = HeaderMap::new();
+        for (name, value) in headers {
+            map.append(*name, HeaderValue::from_static(value));
+        }
+
+        map
+    }
+
+    #[test]
+    fn test_is_personalized() {
+        assert!(!is_personalized(&get_headers(&[])));
+        assert!(!is_personalized(&get_headers(&[(
+            "vary",
+            "Accept-Encoding"
+        )])));
+        assert!(is_personalized(&get_headers(&[(
+            "vary",
+            "Accept-Encoding, cookie"
+        )])));
+        assert!(is_personalized(&get_headers(&[
+            ("vary", "Accept-Encoding"),
+            ("vary", "Cookie"),
+        ])));
+        assert!(is_personalized(&get_headers(&[("vary", "*")])));
+        assert!(is_personalized(&get_headers(&[("set-cookie", "id=1")])));
+    }
+
+    #[test]
+    fn test_is_unstable() {
+        let text = "Welcome to the front page of the example site";
+        assert!(!is_unstable(text, text));
+        assert!(!is_unstable("", ""));
+
+        // A changed date or token isn't enough.
+        assert!(!is_unstable(
+            &format!("{text} 2024-05-12 token-a"),
+            &format!("{text} 2024-05-13 token-b"),
+        ));
+        assert!(is_unstable(text, "Hello again, Alice! Your orders"));
+    }
+
+    #[tokio::test]
+    #[allow(clippy::expect_used)]
+    async fn test_random_content() {
+        let url = serve_random().await;
+        let client = Client::new();
+
+        let mut fetches = Vec::new();
+        for _ in 0..2 {
+            let response = client
+                .get(&url)
+                .send()
+                .await
+                .expect("Failed to send request!");
+            let personalized = is_personalized(response.headers());
+            let text = response.text().await.expect("Failed to read response!");
+
+            fetches.push((personalized, text));
+        }
+
+        assert!(fetches.iter().all(|(personalized, _)| *personalized));
+        assert!(is_unstable(&fetches[0].1, &fetches[1].1));
+    }
+}
@@ -0,0 +1,409 @@
+use crate::client::Pattern;
+use common::utils;
+use std::collections::HashMap;
+use std::sync::Mutex;
+use std::time::{Duration, Instant};
+use url::Url;
+
+/// The number of hosts tracked before the ones that may be requested right away are forgotten.
+const PRUNE_THRESHOLD: usize = 10_000;
+
+/// The longest crawl delay honored, so a `robots.txt` file can't stall the workers waiting on its host.
+const MAXIMUM_CRAWL_DELAY: Duration = Duration::from_secs(60);
+
+/// The longest interval between requests, so a tiny rate can't overflow a duration.
+const MAXIMUM_REQUEST_INTERVAL: Duration = Duration::from_secs(24 * 60 * 60);
+
+/// Caps the requests of the whole crawl, across all hosts and workers, like for an egress budget.
+///
+/// # Fields
+///
+/// * `rate`: The maximum number of requests per second, if limited.
+/// * `next_at`: The earliest time the next request may be made at.
+///
+/// # Notes
+///
+/// * Requests are spread out evenly instead of in bursts, so the cap holds over any window.
+#[derive(Debug)]
+pub struct RateLimit {
+    rate: Option<f64>,
+    next_at: Mutex<Option<Instant>>,
+}
+
+impl RateLimit {
+    /// Creates a new rate limit.
+    ///
+    /// # Arguments
+    ///
+    /// * `rate`: The maximum number of requests per second, if limited.
+    ///
+    /// # Returns
+    ///
+    /// * `RateLimit` - The new rate limit.
+    #[must_use]
+    pub const fn new(rate: Option<f64>) -> Self {
+        Self {
+            rate,
+            next_at: Mutex::new(None),
+        }
+    }
+
+    /// Loads the rate limit from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `RateLimit` - The rate limit, disabled unless `MAXIMUM_REQUEST_RATE` is set.
+    #[must_use]
+    pub fn load() -> Self {
+        Self::new(utils::env::crawler::get_maximum_request_rate())
+    }
+
+    /// Waits until a request may be made.
+    ///
+    /// # Notes
+    ///
+    /// * Every outbound request has to wait, including the ones for `robots.txt` files.
+    pub async fn wait(&self) {
+        let delay = self.reserve_at(Instant::now());
+        if !delay.is_zero() {
+            tokio::time::sleep(delay).await;
+        }
+    }
+
+    /// Reserves the next free slot for a request, at a given time.
+    ///
+    /// # Arguments
+    ///
+    /// * `now`: The current time.
+    ///
+    /// # Returns
+    ///
+    /// * `Duration` - How long to wait before making the request, zero if it can be made right away.
+    ///
+    /// # Notes
+    ///
+    /// * Slots are handed out in order, so a request waiting for one never loses it to a later one.
+    fn reserve_at(&self, now: Instant) -> Duration {
+        let Some(rate) = self.rate else {
+            return Duration::ZERO;
+        };
+
+        let Ok(mut next_at) = self.next_at.lock() else {
+            return Duration::ZERO;
+        };
+
+        let at = next_at.map_or(now, |next_at| next_at.max(now));
+        *next_at = Some(at + get_rate_interval(rate));
+
+        at.duration_since(now)
+    }
+}
+
+/// Caps the requests made to each host, so a host isn't hammered by many workers at once.
+///
+/// # Fields
+///
+/// * `rate`: The maximum number of requests per second to a host, if limited.
+/// * `rates`: The patterns of the hosts limited differently, and the rate of each, in order.
+/// * `next_at`: The earliest time the next request to each host may be made at.
+///
+/// # Notes
+///
+/// * The requests to a host are spread out evenly like `RateLimit`, and the first pattern a host matches wins.
+/// * A host is never requested more often than its `robots.txt` file asks for with `Crawl-delay`, whatever its rate.
+#[derive(Debug)]
+pub struct HostRateLimit {
+    rate: Option<f64>,
+    rates: Vec<(Pattern, Option<f64>)>,
+    next_at: Mutex<HashMap<String, Instant>>,
+}
+
+impl HostRateLimit {
+    /// Creates a new host rate limit.
+    ///
+    /// # Arguments
+    ///
+    /// * `rate`: The maximum number of requests per second to a host, if limited.
+    /// * `rates`: The patterns of the hosts limited differently, and their requests per second, `0` to not limit them.
+    ///
+    /// # Returns
+    ///
+    /// * `HostRateLimit` - The new host rate limit.
+    #[must_use]
+    pub fn new(rate: Option<f64>, rates: &[(String, f64)]) -> Self {
+        Self {
+            rate,
+            rates: rates
+                .iter()
+                .map(|(pattern, rate)| (Pattern::parse(pattern), (*rate > 0.0).then_some(*rate)))
+                .collect(),
+            next_at: Mutex::new(HashMap::new()),
+        }
+    }
+
+    /// Loads the host rate limit from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `HostRateLimit` - The host rate limit, only waiting for crawl delays unless `HOST_REQUEST_RATE` or `HOST_REQUEST_RATES` is set.
+    #[must_use]
+    pub fn load() -> Self {
+        Self::new(
+            utils::env::crawler::get_host_request_rate(),
+            &utils::env::crawler::get_host_request_rates(),
+        )
+    }
+
+    /// Waits until a request to the host of a URL may be made.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL to request.
+    /// * `crawl_delay`: The crawl delay the `robots.txt` file of the host asks for in seconds, if any.
+    pub async fn wait(&self, url: &Url, crawl_delay: Option<f64>) {
+        let Some(host) = url.host_str() else {
+            return;
+        };
+
+        let delay = self.reserve_at(&host.to_lowercase(), crawl_delay, Instant::now());
+        if !delay.is_zero() {
+            tokio::time::sleep(delay).await;
+        }
+    }
+
+    /// Gets the interval between requests to a host.
+    ///
+    /// # Arguments
+    ///
+    /// * `host`: The host, in lowercase.
+    /// * `crawl_delay`: The crawl delay the `robots.txt` file of the host asks for in seconds, if any.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Duration)` - The longer of the interval of the rate of the host, and its crawl delay up to `MAXIMUM_CRAWL_DELAY`.
+    /// * `None` - If the requests to the host aren't limited.
+    fn get_interval(&self, host: &str, crawl_delay: Option<f64>) -> Option<Duration> {
+        let rate = self
+            .rates
+            .iter()
+            .find(|(pattern, _)| pattern.matches(host))
+            .map_or(self.rate, |(_, rate)| *rate);
+        let interval = rate.map(get_rate_interval);
+        // Crawl delays too long for a duration are capped too, instead of panicking on them.
+        let crawl_delay = crawl_delay.map(|crawl_delay| {
+            Duration::try_from_secs_f64(crawl_delay).map_or(MAXIMUM_CRAWL_DELAY, |crawl_delay| {
+                crawl_delay.min(MAXIMUM_CRAWL_DELAY)
+            })
+        });
+
+        interval.max(crawl_delay)
+    }
+
+    /// Reserves the next free slot for a request to a host, at a given time.
+    ///
+    /// # Arguments
+    ///
+    /// * `host`: The host, in lowercase.
+    /// * `crawl_delay`: The crawl delay the `robots.txt` file of the host asks for in seconds, if any.
+    /// * `now`: The current time.
+    ///
+    /// # Returns
+    ///
+    /// * `Duration` - How long to wait before making the request, zero if it can be made right away.
+    fn reserve_at(&self, host: &str, crawl_delay: Option<f64>, now: Instant) -> Duration {
+        let Some(interval) = self.get_interval(host, crawl_delay) else {
+            return Duration::ZERO;
+        };
+
+        let Ok(mut next_at) = self.next_at.lock() else {
+            return Duration::ZERO;
+        };
+
+        // Hosts that may be requested right away are as good as untracked.
+        if next_at.len() >= PRUNE_THRESHOLD {
+            next_at.retain(|_, next_at| *next_at > now);
+        }
+
+        let at = next_at.get(host).map_or(now, |next_at| (*next_at).max(now));
+        next_at.insert(host.to_string(), at + interval);
+
+        at.duration_since(now)
+    }
+}
+
+/// Gets the interval between requests at a rate.
+///
+/// # Arguments
+///
+/// * `rate`: The requests per second.
+///
+/// # Returns
+///
+/// * `Duration` - The interval between requests, up to `MAXIMUM_REQUEST_INTERVAL`.
+fn get_rate_interval(rate: f64) -> Duration {
+    Duration::try_from_secs_f64(1.0 / rate).map_or(MAXIMUM_REQUEST_INTERVAL, |interval| {
+        interval.min(MAXIMUM_REQUEST_INTERVAL)
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::Arc;
+
+    #[test]
+    fn test_reserve() {
+        let rate_limit = RateLimit::new(Some(4.0));
+        let start = Instant::now();
+        let at = |millis| start + Duration::from_millis(millis);
+
+        // Requests made at once are spread out over the second.
+        for slot in 0..4 {
+            assert_eq!(
+                rate_limit.reserve_at(at(0)),
+                Duration::from_millis(slot * 250)
+            );
+        }
+
+        // Unused slots aren't saved up for a burst later on.
+        assert_eq!(rate_limit.reserve_at(at(5_000)), Duration::ZERO);
+        assert_eq!(rate_limit.reserve_at(at(5_000)), Duration::from_millis(250));
+    }
+
+    #[test]
+    fn test_reserve_tiny_rate() {
+        let now = Instant::now();
+
+        // Rates too small for a duration wait the longest interval, instead of panicking on it.
+        for rate in [1e-300, 1e-6, 0.0] {
+            let rate_limit = RateLimit::new(Some(rate));
+            assert_eq!(rate_limit.reserve_at(now), Duration::ZERO);
+            assert_eq!(rate_limit.reserve_at(now), MAXIMUM_REQUEST_INTERVAL);
+
+            let rate_limit = HostRateLimit::new(Some(rate), &[]);
+            assert_eq!(rate_limit.reserve_at("a.com", None, now), Duration::ZERO);
+            assert_eq!(
+                rate_limit.reserve_at("a.com", None, now),
+                MAXIMUM_REQUEST_INTERVAL
+            );
+        }
+    }
+
+    #[test]
+    fn test_reserve_disabled() {
+        let rate_limit = RateLimit::new(None);
+        let now = Instant::now();
+
+        for _ in 0..100 {
+            assert_eq!(rate_limit.reserve_at(now), Duration::ZERO);
+        }
+    }
+
+    #[test]
+    fn test_reserve_host() {
+        let rate_limit = HostRateLimit::new(
+            Some(2.0),
+            &[("*.slow.com".into(), 0.5), ("fast.com".into(), 0.0)],
+        );
+        let now = Instant::now();
+
+        // Each host gets its own slots.
+        assert_eq!(rate_limit.reserve_at("a.com", None, now), Duration::ZERO);
+        assert_eq!(
+            rate_limit.reserve_at("a.com", None, now),
+            Duration::from_millis(500)
+        );
+        assert_eq!(rate_limit.reserve_at("b.com", None, now), Duration::ZERO);
+
+        // Patterns override the rate of the hosts they match.
+        assert_eq!(
+            rate_limit.reserve_at("www.slow.com", None, now),
+            Duration::ZERO
+        );
+        assert_eq!(
+            rate_limit.reserve_at("www.slow.com", None, now),
+            Duration::from_secs(2)
+        );
+        for _ in 0..100 {
+            assert_eq!(rate_limit.reserve_at("fast.com", None, now), Duration::ZERO);
+        }
+    }
+
+    #[test]
+    fn test_reserve_host_disabled() {
+        let rate_limit = HostRateLimit::new(None, &[]);
+        let now = Instant::now();
+
+        for _ in 0..100 {
+            assert_eq!(rate_limit.reserve_at("a.com", None, now), Duration::ZERO);
+        }
+    }
+
+    #[test]
+    fn test_reserve_crawl_delay() {
+        let rate_limit = HostRateLimit::new(Some(2.0), &[]);
+        let now = Instant::now();
+
+        // The crawl delay is honored when it's longer than the interval of the rate.
+        assert_eq!(
+            rate_limit.reserve_at("a.com", Some(3.0), now),
+            Duration::ZERO
+        );
+        assert_eq!(
+            rate_limit.reserve_at("a.com", Some(3.0), now),
+            Duration::from_secs(3)
+        );
+        assert_eq!(
+            rate_limit.reserve_at("b.com", Some(0.1), now),
+            Duration::ZERO
+        );
+        assert_eq!(
+            rate_limit.reserve_at("b.com", Some(0.1), now),
+            Duration::from_millis(500)
+        );
+
+        // Unlimited hosts still wait for their crawl delay, up to the longest one honored.
+        let rate_limit = HostRateLimit::new(None, &[]);
+        assert_eq!(
+            rate_limit.reserve_at("a.com", Some(86_400.0), now),
+            Duration::ZERO
+        );
+        assert_eq!(
+            rate_limit.reserve_at("a.com", Some(86_400.0), now),
+            MAXIMUM_CRAWL_DELAY
+        );
+        assert_eq!(
+            rate_limit.reserve_at("b.com", Some(1e20), now),
+            Duration::ZERO
+        );
+        assert_eq!(
+            rate_limit.reserve_at("b.com", Some(1e20), now),
+            MAXIMUM_CRAWL_DELAY
+        );
+    }
+
+    #[tokio::test]
+    #[allow(clippy::expect_used)]
+    async fn test_wait() {
+        let rate = 50.0;
+        let requests = 26;
+        let rate_limit = Arc::new(RateLimit::new(Some(rate)));
+        let started_at = Instant::now();
+
+        // Workers share the rate limit, so together they stay under it.
+        let workers = (0..requests)
+            .map(|_| {
+                let rate_limit = rate_limit.clone();
+
+                tokio::spawn(async move { rate_limit.wait().await })
+            })
+            .collect::<Vec<_>>();
+        for worker in workers {
+            worker.await.expect("Failed to wait for worker!");
+        }
+
+        // The first request is made right away, and every other one a slot later.
+        let elapsed = started_at.elapsed().as_secs_f64();
+        assert!(f64::from(requests - 1) / elapsed <= rate);
+    }
+}
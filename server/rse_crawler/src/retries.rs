@@ -0,0 +1,206 @@
+use common::database;
+use common::database::model::Retry;
+use common::errors::Error;
+use common::utils;
+use log::{error, info, warn};
+use std::collections::HashSet;
+use std::sync::Mutex;
+use std::time::{Duration, SystemTime};
+use url::Url;
+
+/// The maximum number of failed URLs queued at once.
+const RETRY_BATCH_SIZE: i64 = 100;
+
+/// The longest delay before a retry, so doubling it can't overflow.
+const MAXIMUM_RETRY_DELAY: Duration = Duration::from_secs(7 * 24 * 60 * 60);
+
+/// The URLs that failed to be fetched, retried later with an increasing delay so an outage can be waited out.
+///
+/// # Fields
+///
+/// * `interval`: The interval between each check for URLs that are due.
+/// * `delay`: The delay before the first retry, doubled with every attempt after it.
+/// * `maximum_attempts`: The number of times fetching a URL may fail, before it's marked as dead.
+/// * `taken`: The URLs queued to be retried, that haven't been fetched again yet.
+///
+/// # Notes
+///
+/// * The URLs are kept in the database, so they're retried even if the crawler is restarted in between.
+#[derive(Debug)]
+pub struct Retries {
+    pub interval: Duration,
+    delay: Duration,
+    maximum_attempts: u32,
+    taken: Mutex<HashSet<Url>>,
+}
+
+impl Retries {
+    /// Creates new retries.
+    ///
+    /// # Arguments
+    ///
+    /// * `interval`: The interval between each check for URLs that are due.
+    /// * `delay`: The delay before the first retry, doubled with every attempt after it.
+    /// * `maximum_attempts`: The number of times fetching a URL may fail, before it's marked as dead.
+    ///
+    /// # Returns
+    ///
+    /// * `Retries` - The new retries.
+    #[must_use]
+    pub fn new(interval: Duration, delay: Duration, maximum_attempts: u32) -> Self {
+        Self {
+            interval,
+            delay,
+            maximum_attempts,
+            taken: Mutex::new(HashSet::new()),
+        }
+    }
+
+    /// Loads the retries from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Retries)` - The retries.
+    /// * `None` - If retrying failed URLs is disabled.
+    #[must_use]
+    pub fn load() -> Option<Self> {
+        Some(Self::new(
+            utils::env::crawler::get_retry_interval()?,
+            utils::env::crawler::get_retry_delay(),
+            utils::env::crawler::get_maximum_retry_attempts(),
+        ))
+    }
+
+    /// Takes the URLs that are due to be retried.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<(Url, u32)>` - The URLs and the depth they were queued at, the longest overdue first.
+    ///
+    /// # Notes
+    ///
+    /// * If the crawler stops before retrying them, they're due again after the first delay.
+    pub async fn take(&self) -> Vec<(Url, u32)> {
+        let retries = match database::take_due_retries(RETRY_BATCH_SIZE, self.delay).await {
+            Ok(retries) => retries,
+            Err(err) => {
+                error!(
+                    "Failed to take failed URLs to retry ({}): {err}",
+                    err.code()
+                );
+
+                return Vec::new();
+            }
+        };
+
+        let urls = retries
+            .into_iter()
+            .filter_map(|retry| {
+                Url::parse(&retry.url)
+                    .ok()
+                    .map(|url| (url, u32::try_from(retry.depth).unwrap_or_default()))
+            })
+            .collect::<Vec<_>>();
+        if let Ok(mut taken) = self.taken.lock() {
+            taken.extend(urls.iter().map(|(url, _)| url.clone()));
+        }
+
+        urls
+    }
+
+    /// Records the outcome of fetching a URL, scheduling it to be retried if it failed in a way that may pass.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL.
+    /// * `depth`: The depth the URL was queued at.
+    /// * `err`: The error fetching the URL failed with, if it did.
+    ///
+    /// # Notes
+    ///
+    /// * Only retried URLs are looked up once they're fetched, so the others cost nothing unless they fail.
+    /// * URLs that fail in a way that won't pass, like being disallowed, stop being retried.
+    pub async fn record(&self, url: &Url, depth: u32, err: Option<&Error>) {
+        let was_taken = self.taken.lock().is_ok_and(|mut taken| taken.remove(url));
+
+        let Some(err) = err.filter(|err| err.is_retryable()) else {
+            if was_taken {
+                if let Err(err) = database::delete_retry(url.as_str()).await {
+                    error!("Failed to clear the retry of {url} ({}): {err}", err.code());
+                }
+            }
+
+            return;
+        };
+
+        let attempts = match database::get_retry(url.as_str()).await {
+            Ok(retry) => retry.map_or(1, |retry| {
+                u32::try_from(retry.attempts).unwrap_or_default() + 1
+            }),
+            Err(err) => {
+                error!("Failed to get the retry of {url} ({}): {err}", err.code());
+
+                return;
+            }
+        };
+        let dead = attempts >= self.maximum_attempts;
+        let delay = self.get_delay(attempts);
+
+        let retry = Retry {
+            url: url.to_string(),
+            depth: i32::try_from(depth).unwrap_or(i32::MAX),
+            attempts: i32::try_from(attempts).unwrap_or(i32::MAX),
+            error: err.code().into(),
+            dead,
+            next_attempt_at: SystemTime::now() + delay,
+        };
+        if let Err(err) = database::set_retry(&retry).await {
+            error!(
+                "Failed to schedule a retry of {url} ({}): {err}",
+                err.code()
+            );
+
+            return;
+        }
+
+        if dead {
+            warn!("Giving up on {url} after {attempts} failed attempts!");
+        } else {
+            info!(
+                "Retrying {url} in {}s, after {attempts} of {} attempts...",
+                delay.as_secs(),
+                self.maximum_attempts
+            );
+        }
+    }
+
+    /// Gets the delay before retrying a URL.
+    ///
+    /// # Arguments
+    ///
+    /// * `attempts`: The number of times fetching the URL failed.
+    ///
+    /// # Returns
+    ///
+    /// * `Duration` - The first delay, doubled with every attempt after the first, up to `MAXIMUM_RETRY_DELAY`.
+    fn get_delay(&self, attempts: u32) -> Duration {
+        self.delay
+            .saturating_mul(2_u32.saturating_pow(attempts.saturating_sub(1)))
+            .min(MAXIMUM_RETRY_DELAY)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_get_delay() {
+        let retries = Retries::new(Duration::from_secs(60), Duration::from_secs(300), 5);
+
+        assert_eq!(retries.get_delay(1), Duration::from_secs(300));
+        assert_eq!(retries.get_delay(2), Duration::from_secs(600));
+        assert_eq!(retries.get_delay(4), Duration::from_secs(2_400));
+        assert_eq!(retries.get_delay(1_000), MAXIMUM_RETRY_DELAY);
+    }
+}
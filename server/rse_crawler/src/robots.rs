@@ -1,18 +1,158 @@
+use common::utils;
+use serde::Serialize;
+use std::collections::HashMap;
+use std::sync::Mutex;
+use std::time::{Duration, Instant};
 use url::Url;
 
+/// The robots directives that take a value after a colon, which must not be mistaken for user agents.
+const VALUED_DIRECTIVES: [&str; 4] = [
+    "unavailable_after",
+    "max-snippet",
+    "max-image-preview",
+    "max-video-preview",
+];
+
+/// A group of a `robots.txt` file.
+///
+/// # Fields
+///
+/// * `user_agents`: The user agents the group applies to, in lowercase.
+/// * `rules`: The rules of the group.
+/// * `crawl_delay`: The delay between requests specified by the group, in seconds.
+#[derive(Debug, Clone, Default)]
+pub struct Group {
+    pub user_agents: Vec<String>,
+    pub rules: Vec<Rule>,
+    pub crawl_delay: Option<f64>,
+}
+
+/// A rule of a `robots.txt` group.
+///
+/// # Fields
+///
+/// * `allow`: Whether the rule allows, or disallows the paths it matches.
+/// * `path`: The path pattern of the rule.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Rule {
+    pub allow: bool,
+    pub path: String,
+}
+
+/// The verdict of a `robots.txt` file on a URL.
+///
+/// # Fields
+///
+/// * `allowed`: Whether the URL may be crawled.
+/// * `group`: The user agents of the group that applied, if any.
+/// * `rule`: The rule that decided the verdict, if any.
+/// * `crawl_delay`: The delay between requests the group asks for, in seconds.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct Verdict {
+    pub allowed: bool,
+    pub group: Option<Vec<String>>,
+    pub rule: Option<String>,
+    pub crawl_delay: Option<f64>,
+}
+
+/// The indexing directives of a page, from its `X-Robots-Tag` headers and robots meta tags.
+///
+/// # Fields
+///
+/// * `noindex`: Whether the page may not be indexed.
+/// * `nofollow`: Whether the links on the page may not be followed.
+/// * `noarchive`: Whether the page may not be cached.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct Directives {
+    pub noindex: bool,
+    pub nofollow: bool,
+    pub noarchive: bool,
+}
+
+impl Directives {
+    /// Parses a list of directives, like `noindex, nofollow`.
+    ///
+    /// # Arguments
+    ///
+    /// * `value`: The comma separated directives.
+    ///
+    /// # Returns
+    ///
+    /// * `Directives`: The directives, unknown ones are ignored.
+    pub fn parse(value: &str) -> Self {
+        let mut directives = Self::default();
+        for directive in value.split(',') {
+            match directive.trim().to_lowercase().as_str() {
+                "noindex" => directives.noindex = true,
+                "nofollow" => directives.nofollow = true,
+                "noarchive" | "nocache" => directives.noarchive = true,
+                "none" => {
+                    directives.noindex = true;
+                    directives.nofollow = true;
+                }
+                _ => {}
+            }
+        }
+
+        directives
+    }
+
+    /// Parses the value of an `X-Robots-Tag` header, which may be limited to a user agent like `googlebot: noindex`.
+    ///
+    /// # Arguments
+    ///
+    /// * `value`: The value of the header.
+    /// * `user_agent`: The user agent of the crawler.
+    ///
+    /// # Returns
+    ///
+    /// * `Directives`: The directives, empty if they're for another user agent.
+    pub fn parse_header(value: &str, user_agent: &str) -> Self {
+        let Some((agent, directives)) = value.split_once(':') else {
+            return Self::parse(value);
+        };
+
+        // Directives with values, like `unavailable_after: <date>`, aren't user agents.
+        let agent = agent.trim().to_lowercase();
+        if agent.contains(',') || VALUED_DIRECTIVES.contains(&agent.as_str()) {
+            return Self::parse(value);
+        }
+
+        if agent == get_product_token(user_agent) {
+            Self::parse(directives)
+        } else {
+            Self::default()
+        }
+    }
+
+    /// Combines the directives with other directives, the most restrictive of each wins.
+    ///
+    /// # Arguments
+    ///
+    /// * `other`: The other directives.
+    ///
+    /// # Returns
+    ///
+    /// * `Directives`: The combined directives.
+    #[must_use]
+    pub const fn merge(self, other: Self) -> Self {
+        Self {
+            noindex: self.noindex || other.noindex,
+            nofollow: self.nofollow || other.nofollow,
+            noarchive: self.noarchive || other.noarchive,
+        }
+    }
+}
+
 /// A parsed `robots.txt` file.
 ///
 /// # Fields
 ///
-/// * `crawl_delay`: The delay specified by the `robots.txt` file.
-/// * `disallow`: The disallowed URLs specified by the `robots.txt` file.
-/// * `allow`: The allowed URLs specified by the `robots.txt` file.
+/// * `groups`: The groups of the `robots.txt` file.
 /// * `content`: The raw contents of the `robots.txt` file.
 #[derive(Debug, Clone, Default)]
 pub struct RobotsFile {
-    pub crawl_delay: Option<u64>,
-    pub disallow: Vec<String>,
-    pub allow: Vec<String>,
+    pub groups: Vec<Group>,
     pub content: String,
 }
 
@@ -22,25 +162,78 @@ impl RobotsFile {
     /// # Arguments
     ///
     /// * `url`: The URL to check.
+    /// * `user_agent`: The user agent of the crawler.
     ///
     /// # Returns
     ///
     /// * `bool`: Whether the URL is crawlable, or not.
-    pub fn is_crawlable(&self, url: &Url) -> bool {
-        let path = url.path().to_lowercase();
+    pub fn is_crawlable(&self, url: &Url, user_agent: &str) -> bool {
+        self.check(url, user_agent).allowed
+    }
 
-        // If the URL is disallowed, return false.
-        if self.disallow.iter().any(|url| path.starts_with(url)) {
-            return false;
+    /// Evaluates the `robots.txt` file for a URL.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL to check.
+    /// * `user_agent`: The user agent of the crawler.
+    ///
+    /// # Returns
+    ///
+    /// * `Verdict`: Whether the URL is crawlable, and why.
+    ///
+    /// # Notes
+    ///
+    /// * The groups naming the product token of the user agent apply, or the `*` groups if there are none.
+    /// * The longest matching rule decides the verdict, and `Allow` wins ties.
+    pub fn check(&self, url: &Url, user_agent: &str) -> Verdict {
+        let product_token = get_product_token(user_agent);
+
+        let mut groups = self.get_groups(&product_token);
+        if groups.is_empty() {
+            groups = self.get_groups("*");
+        }
+
+        if groups.is_empty() {
+            return Verdict {
+                allowed: true,
+                group: None,
+                rule: None,
+                crawl_delay: None,
+            };
         }
 
-        // If the URL is allowed, return true.
-        if self.allow.iter().any(|url| path.starts_with(url)) {
-            return true;
+        let path = match url.query() {
+            Some(query) => format!("{}?{query}", url.path()),
+            None => url.path().to_string(),
+        };
+
+        let rule = groups
+            .iter()
+            .flat_map(|group| &group.rules)
+            .filter(|rule| !rule.path.is_empty() && matches(&rule.path, &path))
+            .max_by_key(|rule| (rule.path.len(), rule.allow));
+
+        let mut user_agents = Vec::new();
+        for user_agent in groups.iter().flat_map(|group| &group.user_agents) {
+            if !user_agents.contains(user_agent) {
+                user_agents.push(user_agent.clone());
+            }
         }
 
-        // Assume the URL is allowed.
-        true
+        Verdict {
+            // The robots.txt file itself is always allowed.
+            allowed: url.path() == "/robots.txt" || rule.map_or(true, |rule| rule.allow),
+            group: Some(user_agents),
+            rule: rule.map(|rule| {
+                format!(
+                    "{}: {}",
+                    if rule.allow { "Allow" } else { "Disallow" },
+                    rule.path
+                )
+            }),
+            crawl_delay: groups.iter().find_map(|group| group.crawl_delay),
+        }
     }
 
     /// Parses a `robots.txt` file.
@@ -52,56 +245,449 @@ impl RobotsFile {
     /// # Returns
     ///
     /// * `RobotsFile`: The parsed `robots.txt` file.
-    #[allow(clippy::expect_used)]
     pub fn parse(content: &str) -> RobotsFile {
-        let mut crawl_delay = None;
-
-        let mut user_agent = String::new();
-        let mut disallow = Vec::new();
-        let mut allow = Vec::new();
+        let mut groups: Vec<Group> = Vec::new();
 
+        // Consecutive user agent lines share a group, the first rule after them closes it.
+        let mut is_open = false;
         for line in content.lines() {
-            let line = line.trim();
+            let line = line.split('#').next().unwrap_or_default().trim();
 
-            if line.is_empty() {
+            let Some((key, value)) = line.split_once(':') else {
                 continue;
-            }
+            };
+            let key = key.trim().to_lowercase();
+            let value = value.trim();
 
-            let mut parts = line.splitn(2, ':');
+            if key == "user-agent" {
+                match groups.last_mut() {
+                    Some(group) if is_open => group.user_agents.push(value.to_lowercase()),
+                    _ => groups.push(Group {
+                        user_agents: vec![value.to_lowercase()],
+                        ..Group::default()
+                    }),
+                }
 
-            let key = parts.next().expect("Failed to get key!").to_lowercase();
-            let value = parts.next().unwrap_or_default().trim();
+                is_open = true;
+
+                continue;
+            }
+
+            // Rules before the first user agent line don't belong to any group.
+            let Some(group) = groups.last_mut() else {
+                continue;
+            };
 
             match key.as_str() {
-                "user-agent" => {
-                    if user_agent.is_empty() {
-                        user_agent = value.to_lowercase();
-                    }
+                "allow" | "disallow" => {
+                    group.rules.push(Rule {
+                        allow: key == "allow",
+                        path: value.to_string(),
+                    });
+                    is_open = false;
                 }
                 "crawl-delay" => {
-                    if crawl_delay.is_none() {
-                        crawl_delay = value.parse::<u64>().ok();
-                    }
-                }
-                "disallow" => {
-                    if user_agent == "*" {
-                        disallow.push(value.to_lowercase());
-                    }
-                }
-                "allow" => {
-                    if user_agent == "*" {
-                        allow.push(value.to_lowercase());
+                    if group.crawl_delay.is_none() {
+                        group.crawl_delay = value
+                            .parse::<f64>()
+                            .ok()
+                            .filter(|delay| delay.is_finite() && *delay >= 0.0);
                     }
+                    is_open = false;
                 }
                 _ => {}
             }
         }
 
         RobotsFile {
-            crawl_delay,
-            disallow,
-            allow,
+            groups,
             content: content.to_string(),
         }
     }
+
+    /// Gets the groups that name a user agent.
+    ///
+    /// # Arguments
+    ///
+    /// * `user_agent`: The user agent, in lowercase.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<&Group>`: The groups naming the user agent.
+    fn get_groups(&self, user_agent: &str) -> Vec<&Group> {
+        self.groups
+            .iter()
+            .filter(|group| group.user_agents.iter().any(|agent| agent == user_agent))
+            .collect()
+    }
+}
+
+/// Gets the product token of a user agent, like `rse` for `RSE/1.0.0`.
+///
+/// # Arguments
+///
+/// * `user_agent`: The user agent.
+///
+/// # Returns
+///
+/// * `String`: The product token, in lowercase.
+pub fn get_product_token(user_agent: &str) -> String {
+    user_agent
+        .split(|c: char| c == '/' || c.is_whitespace())
+        .next()
+        .unwrap_or_default()
+        .to_lowercase()
+}
+
+/// Checks if a path matches a rule's pattern.
+///
+/// # Arguments
+///
+/// * `pattern`: The pattern, where `*` matches anything and a trailing `$` anchors the end of the path.
+/// * `path`: The path, including the query.
+///
+/// # Returns
+///
+/// * `bool`: Whether the path matches the pattern.
+fn matches(pattern: &str, path: &str) -> bool {
+    let (pattern, is_anchored) = pattern
+        .strip_suffix('$')
+        .map_or((pattern, false), |pattern| (pattern, true));
+
+    let mut parts = pattern.split('*');
+    let Some(mut rest) = path.strip_prefix(parts.next().unwrap_or_default()) else {
+        return false;
+    };
+
+    let parts = parts.collect::<Vec<_>>();
+    for (index, part) in parts.iter().enumerate() {
+        if is_anchored && index == parts.len() - 1 {
+            return rest.ends_with(part);
+        }
+
+        let Some(start) = rest.find(part) else {
+            return false;
+        };
+        rest = &rest[start + part.len()..];
+    }
+
+    !is_anchored || rest.is_empty()
+}
+
+/// The `robots.txt` files of recently crawled hosts, so they aren't fetched again for every URL.
+///
+/// # Fields
+///
+/// * `refresh_interval`: How long a `robots.txt` file is used before it's fetched again.
+/// * `capacity`: The maximum number of files cached, the least recently used one is evicted first.
+/// * `entries`: The cached files, by their URL.
+///
+/// # Notes
+///
+/// * Files are keyed by the URL they're fetched from, so each scheme and host has its own.
+#[derive(Debug)]
+pub struct Cache {
+    refresh_interval: Duration,
+    capacity: usize,
+    entries: Mutex<HashMap<String, Entry>>,
+}
+
+/// A cached `robots.txt` file.
+///
+/// # Fields
+///
+/// * `robots_file`: The parsed file.
+/// * `fetched_at`: When the file was fetched.
+/// * `used_at`: When the file was last used.
+#[derive(Debug)]
+struct Entry {
+    robots_file: RobotsFile,
+    fetched_at: Instant,
+    used_at: Instant,
+}
+
+impl Cache {
+    /// Creates a new cache.
+    ///
+    /// # Arguments
+    ///
+    /// * `refresh_interval`: How long a `robots.txt` file is used before it's fetched again.
+    /// * `capacity`: The maximum number of files cached, `0` to not cache them.
+    ///
+    /// # Returns
+    ///
+    /// * `Cache` - The new cache.
+    #[must_use]
+    pub fn new(refresh_interval: Duration, capacity: usize) -> Self {
+        Self {
+            refresh_interval,
+            capacity,
+            entries: Mutex::new(HashMap::new()),
+        }
+    }
+
+    /// Loads the cache from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Cache` - The cache, sized and refreshed by `ROBOTS_CACHE_SIZE` and `ROBOTS_REFRESH_INTERVAL`.
+    #[must_use]
+    pub fn load() -> Self {
+        Self::new(
+            utils::env::scraper::get_robots_refresh_interval(),
+            utils::env::scraper::get_robots_cache_size(),
+        )
+    }
+
+    /// Gets a cached `robots.txt` file.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the file.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(RobotsFile)` - The file, if it's cached and hasn't expired.
+    /// * `None` - If the file has to be fetched.
+    #[must_use]
+    pub fn get(&self, url: &str) -> Option<RobotsFile> {
+        self.get_at(url, Instant::now())
+    }
+
+    /// Caches a `robots.txt` file.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the file.
+    /// * `robots_file`: The parsed file.
+    pub fn insert(&self, url: String, robots_file: RobotsFile) {
+        self.insert_at(url, robots_file, Instant::now());
+    }
+
+    /// Gets a cached `robots.txt` file, at a given time.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the file.
+    /// * `now`: The current time.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(RobotsFile)` - The file, if it's cached and hasn't expired.
+    /// * `None` - If the file has to be fetched.
+    fn get_at(&self, url: &str, now: Instant) -> Option<RobotsFile> {
+        let mut entries = self.entries.lock().ok()?;
+        let entry = entries.get_mut(url)?;
+        if now.saturating_duration_since(entry.fetched_at) >= self.refresh_interval {
+            entries.remove(url);
+
+            return None;
+        }
+
+        entry.used_at = now;
+
+        Some(entry.robots_file.clone())
+    }
+
+    /// Caches a `robots.txt` file, at a given time.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the file.
+    /// * `robots_file`: The parsed file.
+    /// * `now`: The current time.
+    ///
+    /// # Notes
+    ///
+    /// * Once the cache is full, the expired files are evicted, or the least recently used one if none have.
+    fn insert_at(&self, url: String, robots_file: RobotsFile, now: Instant) {
+        if self.capacity == 0 {
+            return;
+        }
+
+        let Ok(mut entries) = self.entries.lock() else {
+            return;
+        };
+
+        if !entries.contains_key(&url) && entries.len() >= self.capacity {
+            entries.retain(|_, entry| {
+                now.saturating_duration_since(entry.fetched_at) < self.refresh_interval
+            });
+        }
+        if !entries.contains_key(&url) && entries.len() >= self.capacity {
+            let least_recently_used = entries
+                .iter()
+                .min_by_key(|(_, entry)| entry.used_at)
+                .map(|(url, _)| url.clone());
+            if let Some(least_recently_used) = least_recently_used {
+                entries.remove(&least_recently_used);
+            }
+        }
+
+        entries.insert(
+            url,
+            Entry {
+                robots_file,
+                fetched_at: now,
+                used_at: now,
+            },
+        );
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const ROBOTS_FILE: &str = "
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Crawl-delay: 2
+
+# We're fine with RSE, except for the search pages.
+User-agent: Other
+user-agent: RSE
+Disallow: /search
+Disallow: /*.pdf$
+Crawl-delay: 0.5
+";
+
+    #[allow(clippy::expect_used)]
+    fn check(url: &str, user_agent: &str) -> Verdict {
+        RobotsFile::parse(ROBOTS_FILE).check(&Url::parse(url).expect("Invalid URL!"), user_agent)
+    }
+
+    #[test]
+    fn test_check_group() {
+        let verdict = check("https://example.com/private", "RSE/1.0.0");
+        assert!(verdict.allowed);
+        assert_eq!(
+            verdict.group,
+            Some(vec!["other".to_string(), "rse".to_string()])
+        );
+        assert_eq!(verdict.crawl_delay, Some(0.5));
+
+        let verdict = check("https://example.com/private", "SomeBot/2.0");
+        assert!(!verdict.allowed);
+        assert_eq!(verdict.group, Some(vec!["*".to_string()]));
+        assert_eq!(verdict.rule, Some("Disallow: /private".to_string()));
+        assert_eq!(verdict.crawl_delay, Some(2.0));
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_check_rules() {
+        // The longest match wins.
+        let verdict = check("https://example.com/private/public/page", "SomeBot");
+        assert!(verdict.allowed);
+        assert_eq!(verdict.rule, Some("Allow: /private/public".to_string()));
+
+        // Wildcards and anchors.
+        assert!(!check("https://example.com/files/report.pdf", "RSE").allowed);
+        assert!(check("https://example.com/files/report.pdf?download", "RSE").allowed);
+        assert!(!check("https://example.com/search?q=rust", "RSE").allowed);
+
+        // Without any groups, everything is allowed.
+        let verdict = RobotsFile::parse("").check(
+            &Url::parse("https://example.com/").expect("Invalid URL!"),
+            "RSE",
+        );
+        assert!(verdict.allowed);
+        assert_eq!(verdict.group, None);
+    }
+
+    #[test]
+    fn test_matches() {
+        assert!(matches("/", "/anything"));
+        assert!(matches("/fish*.php", "/fish/salmon.php?id=1"));
+        assert!(matches("/*.php$", "/index.php"));
+        assert!(!matches("/*.php$", "/index.php?id=1"));
+        assert!(!matches("/fish$", "/fishes"));
+        assert!(!matches("/fish", "/Fish"));
+    }
+
+    #[test]
+    fn test_parse_directives() {
+        assert_eq!(Directives::parse(""), Directives::default());
+        assert_eq!(
+            Directives::parse("NoIndex, nofollow"),
+            Directives {
+                noindex: true,
+                nofollow: true,
+                noarchive: false,
+            }
+        );
+        assert_eq!(
+            Directives::parse("none"),
+            Directives::parse("noindex, nofollow")
+        );
+        assert_eq!(
+            Directives::parse("all, noarchive, max-snippet: 20"),
+            Directives {
+                noarchive: true,
+                ..Directives::default()
+            }
+        );
+    }
+
+    #[test]
+    fn test_parse_header() {
+        let noindex = Directives {
+            noindex: true,
+            ..Directives::default()
+        };
+
+        assert_eq!(Directives::parse_header("noindex", "RSE/1.0.0"), noindex);
+        assert_eq!(
+            Directives::parse_header("RSE: noindex", "RSE/1.0.0"),
+            noindex
+        );
+        assert_eq!(
+            Directives::parse_header("googlebot: noindex", "RSE/1.0.0"),
+            Directives::default()
+        );
+        assert_eq!(
+            Directives::parse_header("unavailable_after: 25 Jun 2010 15:00:00 PST", "RSE/1.0.0"),
+            Directives::default()
+        );
+        assert_eq!(
+            Directives::parse_header("noindex, max-snippet: 20", "RSE/1.0.0"),
+            noindex
+        );
+        assert_eq!(
+            noindex.merge(Directives::parse_header("nofollow", "RSE/1.0.0")),
+            Directives::parse("noindex, nofollow")
+        );
+    }
+
+    #[test]
+    fn test_cache() {
+        let cache = Cache::new(Duration::from_secs(60), 2);
+        let start = Instant::now();
+        let at = |secs| start + Duration::from_secs(secs);
+        let robots_file = RobotsFile::parse(ROBOTS_FILE);
+
+        cache.insert_at(
+            "https://a.com/robots.txt".into(),
+            robots_file.clone(),
+            at(0),
+        );
+        cache.insert_at(
+            "https://b.com/robots.txt".into(),
+            robots_file.clone(),
+            at(0),
+        );
+        assert!(cache.get_at("https://a.com/robots.txt", at(10)).is_some());
+        assert!(cache.get_at("http://a.com/robots.txt", at(10)).is_none());
+
+        // The least recently used file is evicted once the cache is full.
+        cache.insert_at("https://c.com/robots.txt".into(), robots_file, at(20));
+        assert!(cache.get_at("https://a.com/robots.txt", at(30)).is_some());
+        assert!(cache.get_at("https://b.com/robots.txt", at(30)).is_none());
+
+        // Files expire once they're the refresh interval old.
+        assert!(cache.get_at("https://a.com/robots.txt", at(60)).is_none());
+        assert!(cache.get_at("https://c.com/robots.txt", at(79)).is_some());
+    }
 }
@@ -13,18 +13,23 @@ use url::Url;
 ///
 /// # Methods
 ///
-/// * `seed_urls`: Returns the URLs the scraper starts scraping from.
+/// * `seed_urls`: Returns the URLs the scraper starts scraping from, in the order to queue them in.
 /// * `scrape`: Scrapes a URL.
 /// * `process`: Processes an item.
+/// * `flush`: Finishes processing the items that are buffered, once there are no more items.
 #[async_trait]
 pub trait Scraper: Send + Sync {
     type Item;
 
-    fn seed_urls(&self) -> HashMap<Url, u32>;
+    fn seed_urls(&self) -> Vec<(Url, u32)>;
     async fn scrape(
         &self,
         url: Url,
         depth: u32,
     ) -> Result<(Vec<Self::Item>, HashMap<Url, u32>), Error>;
     async fn process(&self, item: Self::Item) -> Result<(), Error>;
+
+    async fn flush(&self) -> Result<(), Error> {
+        Ok(())
+    }
 }
@@ -1,33 +1,151 @@
-use crate::robots::RobotsFile;
+use crate::budget::Budget;
+use crate::charset;
+use crate::client::{self, Transports};
+use crate::crawl_log::CrawlLog;
+use crate::decision::{Decision, Evaluator};
+use crate::hosts::Overrides;
+use crate::limits::Limits;
+use crate::pagination::Pagination;
+use crate::personalization;
+use crate::rate::{HostRateLimit, RateLimit};
+use crate::robots::{self, Directives, RobotsFile, Verdict};
 use crate::scrapers::Scraper;
+use crate::seeds;
+use crate::text;
+use crate::throttle::{self, Throttle};
+use crate::usage::Usage;
+use crate::writer::{Entry, Writer};
 use async_trait::async_trait;
-use common::database::model::NewKeyword;
+use common::database;
+use common::database::model::{Canonical, Field, NearDuplicate, NewPage, Page, Redirect};
 use common::errors::Error;
-use common::{database, utils};
-use html5ever::tree_builder::TreeSink;
+use common::utils;
+use common::utils::dates::{self, Dates};
+use common::utils::env::scraper::QualifiedLinks;
+use common::utils::structured_data::{self, Kind};
+use common::utils::urls::{HostAliases, Rejection, TrackingParameters};
+use common::utils::words::Dictionary;
+use common::utils::{history, urls};
 use log::{debug, error, info, warn};
-use reqwest::Client;
+use rand::rngs::StdRng;
+use rand::SeedableRng;
+use reqwest::header::{
+    HeaderMap, HeaderName, CONTENT_LENGTH, CONTENT_TYPE, ETAG, IF_MODIFIED_SINCE, IF_NONE_MATCH,
+    LAST_MODIFIED, LOCATION, RETRY_AFTER,
+};
+use reqwest::{Response, StatusCode};
 use rust_stemmers::Algorithm;
-use scraper::{Html, Selector};
-use std::collections::HashMap;
+use scraper::{ElementRef, Html, Selector};
+use std::collections::{HashMap, HashSet};
 use std::str::FromStr;
-use std::sync::RwLock;
+use std::sync::Arc;
+use std::time::SystemTime;
 use url::Url;
 
+/// The header servers send indexing directives in, like `noindex` for non-HTML resources.
+const X_ROBOTS_TAG: &str = "x-robots-tag";
+
+/// The number of `time` elements checked for the publish date of a page.
+const MAXIMUM_TIME_ELEMENTS: usize = 3;
+
+/// The elements whose links are boilerplate, like menus and footers, so they're dropped first.
+const BOILERPLATE_ELEMENTS: [&str; 4] = ["nav", "header", "footer", "aside"];
+
+/// The `rel` values of links that don't vouch for the page they link to, like links in comments and ads.
+const QUALIFIED_RELS: [&str; 3] = ["nofollow", "ugc", "sponsored"];
+
+/// The maximum number of distinct headings indexed from a page.
+const MAXIMUM_HEADINGS: usize = 100;
+
+/// The maximum number of images kept from a page.
+const MAXIMUM_IMAGES: usize = 100;
+
+/// The maximum length of the alt text and caption of an image, in characters.
+const MAXIMUM_IMAGE_TEXT_LENGTH: usize = 1_024;
+
+/// The maximum length of the anchor texts of the links from a page to a URL, in characters.
+const MAXIMUM_ANCHOR_TEXT_LENGTH: usize = 1_024;
+
+/// The maximum number of structured data entities kept from a page.
+const MAXIMUM_STRUCTURED_DATA: usize = 10;
+
+/// The maximum size of the JSON-LD of a structured data entity, in bytes.
+const MAXIMUM_STRUCTURED_DATA_SIZE: usize = 64 * 1_024;
+
+/// The extensions of URLs that are known to be pages, so they're never checked with a `HEAD` request first.
+const PAGE_EXTENSIONS: [&str; 9] = [
+    "htm", "html", "xhtml", "shtml", "php", "asp", "aspx", "jsp", "cgi",
+];
+
+/// The maximum size of a `robots.txt` file that's read in bytes, which is the least RFC 9309 asks crawlers to parse.
+const MAXIMUM_ROBOTS_SIZE: usize = 500 * 1_024;
+
+/// The maximum length of a stored `ETag` header, longer ones aren't sent back.
+const MAXIMUM_ETAG_LENGTH: usize = 1_024;
+
+/// The maximum length of a stored `Last-Modified` header, longer ones aren't sent back.
+const MAXIMUM_LAST_MODIFIED_LENGTH: usize = 64;
+
 /// A scraper for websites.
 ///
 /// # Fields
 ///
-/// * `http_client` - The HTTP client to use.
-/// * `max_depth` - The maximum depth to crawl to, if any.
+/// * `transports` - The HTTP clients to use, picked by the host of each URL.
+/// * `evaluator` - The evaluator deciding whether URLs are crawled.
 /// * `robots_cache` - The cache of `robots.txt` files.
+/// * `user_agent` - The user agent `robots.txt` files are evaluated for.
 /// * `word_boundaries` - The boundaries of the words.
+/// * `dictionary` - The stop words and protected words.
+/// * `fingerprint` - The fingerprint of the dictionary.
+/// * `maximum_keyword_positions` - The maximum number of positions stored per word on a page.
+/// * `maximum_body_size` - The maximum size of a downloaded body in bytes, if limited.
+/// * `limits` - The limits of extracting a page, so a hostile page can't stall a worker.
+/// * `maximum_links` - The maximum number of distinct links kept from a page, if limited.
+/// * `near_duplicate_distance` - The maximum number of bits the simhash of a page may differ in from an indexed one to be skipped, if they're skipped.
+/// * `content_types` - The media types of the responses that are indexed.
+/// * `head_preflight` - Whether URLs with an unknown extension are checked with a `HEAD` request before they're fetched in full.
+/// * `qualified_links` - How links marked with `rel="nofollow"`, `rel="ugc"` or `rel="sponsored"` are treated.
+/// * `pagination` - The paginated listings walked to find content that isn't reachable by links.
+/// * `titles_only` - Whether only the titles and links of pages are indexed, skipping their text.
+/// * `conditional_requests` - Whether recrawled pages are only fetched in full again if they changed.
+/// * `maximum_redirects` - The maximum number of redirects followed from a URL.
+/// * `usage` - The bytes downloaded and requests made per host.
+/// * `budget` - The pages fetched from each host per day, if they're limited.
+/// * `throttle` - The global slowdown the status of each response is recorded in.
+/// * `rate_limit` - The global cap on requests every request waits for.
+/// * `host_rate_limit` - The cap on requests to each host and the crawl delays of their `robots.txt` files, waited for before the global one.
+/// * `overrides` - The credentials and settings of the hosts that differ from the defaults.
+/// * `writer` - The writer of the processed pages.
+/// * `crawl_log` - The log of the crawled URLs.
 #[derive(Debug)]
 pub struct Web {
-    http_client: Client,
-    max_depth: Option<u32>,
-    robots_cache: RwLock<HashMap<String, RobotsFile>>,
-    word_boundaries: (usize, usize, usize, usize),
+    transports: Transports,
+    evaluator: Evaluator,
+    robots_cache: robots::Cache,
+    user_agent: String,
+    word_boundaries: (usize, usize),
+    dictionary: Dictionary,
+    fingerprint: String,
+    maximum_keyword_positions: usize,
+    maximum_body_size: Option<usize>,
+    limits: Limits,
+    maximum_links: Option<usize>,
+    near_duplicate_distance: Option<u32>,
+    content_types: Vec<String>,
+    head_preflight: bool,
+    qualified_links: QualifiedLinks,
+    pagination: Pagination,
+    titles_only: bool,
+    conditional_requests: bool,
+    maximum_redirects: usize,
+    usage: Arc<Usage>,
+    budget: Option<Budget>,
+    throttle: Arc<Throttle>,
+    rate_limit: RateLimit,
+    host_rate_limit: HostRateLimit,
+    overrides: Overrides,
+    writer: Arc<Writer>,
+    crawl_log: Arc<CrawlLog>,
 }
 
 impl Web {
@@ -35,14 +153,55 @@ impl Web {
     ///
     /// # Arguments
     ///
-    /// * `http_client` - The HTTP client to use.
-    /// * `max_depth` - The maximum depth to crawl to, if any.
-    pub fn new(http_client: Client, max_depth: Option<u32>) -> Self {
+    /// * `transports` - The HTTP clients to use, picked by the host of each URL.
+    /// * `evaluator` - The evaluator deciding whether URLs are crawled.
+    /// * `dictionary` - The stop words and protected words.
+    /// * `usage` - The usage to record the bytes downloaded and requests made per host in.
+    /// * `throttle` - The throttle to record the status of each response in.
+    /// * `overrides` - The credentials and settings of the hosts that differ from the defaults.
+    /// * `writer` - The writer to write the processed pages with.
+    /// * `crawl_log` - The log to record the crawled URLs in.
+    pub fn new(
+        transports: Transports,
+        evaluator: Evaluator,
+        dictionary: Dictionary,
+        usage: Arc<Usage>,
+        throttle: Arc<Throttle>,
+        overrides: Overrides,
+        writer: Arc<Writer>,
+        crawl_log: Arc<CrawlLog>,
+    ) -> Self {
         Self {
-            http_client,
-            max_depth,
-            robots_cache: RwLock::new(HashMap::new()),
+            transports,
+            evaluator,
+            robots_cache: robots::Cache::load(),
+            user_agent: utils::env::scraper::get_user_agent()
+                .to_str()
+                .unwrap_or_default()
+                .to_string(),
             word_boundaries: utils::env::scraper::get_word_boundaries(),
+            fingerprint: dictionary.fingerprint(),
+            dictionary,
+            maximum_keyword_positions: utils::env::scraper::get_maximum_keyword_positions(),
+            maximum_body_size: utils::env::scraper::get_maximum_body_size(),
+            limits: Limits::load(),
+            maximum_links: utils::env::scraper::get_maximum_links(),
+            near_duplicate_distance: utils::env::scraper::get_near_duplicate_distance(),
+            content_types: utils::env::scraper::get_content_types(),
+            head_preflight: utils::env::scraper::get_head_preflight(),
+            qualified_links: utils::env::scraper::get_qualified_links(),
+            pagination: Pagination::load(),
+            titles_only: utils::env::scraper::get_titles_only(),
+            conditional_requests: utils::env::scraper::get_conditional_requests(),
+            maximum_redirects: utils::env::scraper::get_maximum_redirects(),
+            usage,
+            budget: Budget::load(),
+            throttle,
+            rate_limit: RateLimit::load(),
+            host_rate_limit: HostRateLimit::load(),
+            overrides,
+            writer,
+            crawl_log,
         }
     }
 
@@ -56,407 +215,2109 @@ impl Web {
     /// # Returns
     ///
     /// * `Result<RobotsFile, Error>` - The parsed `robots.txt` file.
+    ///
+    /// # Notes
+    ///
+    /// * Up to `MAXIMUM_REDIRECTS` redirects are followed, and the file is cached for the URL that was requested.
+    /// * Only the first `MAXIMUM_ROBOTS_SIZE` bytes are read, so a huge file can't fill the memory.
     async fn get_robots_file(&self, url: &Url) -> Result<RobotsFile, Error> {
         let robots_url = Url::from_str(&format!(
             "{}://{}/robots.txt",
             url.scheme(),
             url.host()
-                .ok_or_else(|| Error::Reqwest(format!("Failed to get host for \"{url}\"")))?
+                .ok_or_else(|| Error::InvalidUrl(format!("Failed to get host for \"{url}\"")))?
         ))?;
-        let domain = url.domain().unwrap_or_default().to_string();
 
-        if let Some(robots_file) = self.robots_cache.write()?.get(&domain) {
+        if let Some(robots_file) = self.robots_cache.get(robots_url.as_str()) {
             info!("Using cached robots.txt file for \"{url}\"...");
 
-            return Ok(robots_file.clone());
+            return Ok(robots_file);
         }
 
-        let response = self.http_client.get(robots_url).send().await?;
-        let body = response.text().await?;
+        // Hosts often redirect their robots.txt file to another scheme or host, so it's followed there.
+        let mut fetched_url = robots_url.clone();
+        let mut redirects = 0;
+        let response = loop {
+            self.host_rate_limit.wait(&fetched_url, None).await;
+            self.rate_limit.wait().await;
+            let response = self
+                .transports
+                .get(&fetched_url)
+                .get(fetched_url.clone())
+                .send()
+                .await?;
+
+            match Self::get_location(response.status(), response.headers(), &fetched_url) {
+                Some(location) if redirects < self.maximum_redirects => {
+                    self.usage.record(&fetched_url, 0);
+                    fetched_url = location;
+                    redirects += 1;
+                }
+                _ => break response,
+            }
+        };
+        let bytes = client::read_prefix(response, MAXIMUM_ROBOTS_SIZE).await?;
+        self.usage.record(&fetched_url, bytes.len());
+        let body = String::from_utf8_lossy(&bytes);
 
         info!("Parsing robots.txt file for \"{url}\"...");
         let robots_file = RobotsFile::parse(&body);
 
         self.robots_cache
-            .write()?
-            .insert(domain, robots_file.clone());
+            .insert(robots_url.to_string(), robots_file.clone());
 
         Ok(robots_file)
     }
 
-    /// Extracts all links from the given HTML body.
+    /// Evaluates the `robots.txt` file of a URL's host for the crawler, without crawling it.
     ///
     /// # Arguments
     ///
-    /// * `body` - The HTML body to extract links from.
+    /// * `url` - The URL to check.
     ///
     /// # Returns
     ///
-    /// * `Result<Vec<Url>, Error>` - The extracted links.
-    pub fn extract_links(body: &str) -> Result<Vec<Url>, Error> {
-        let mut links = Vec::new();
-
-        let document = Html::parse_document(body);
-        let selector = Selector::parse("a")?;
-        for element in document.select(&selector) {
-            // If the element has no href, skip it.
-            let Some(link) = element.value().attr("href") else {
-                continue;
-            };
-
-            // If the link fails to parse, skip it.
-            let Ok(url) = Url::from_str(link) else {
-                continue;
-            };
-
-            // If the link has no scheme, skip it.
-            if url.scheme().is_empty() {
-                continue;
-            }
-
-            links.push(url);
-        }
-
-        Ok(links)
+    /// * `Result<Verdict, Error>` - Whether the URL is crawlable, and why.
+    ///
+    /// # Errors
+    ///
+    /// * If the `robots.txt` file could not be fetched.
+    pub async fn check_robots(&self, url: &Url) -> Result<Verdict, Error> {
+        Ok(self
+            .get_robots_file(url)
+            .await?
+            .check(url, &self.user_agent))
     }
 
-    /// Checks if the given depth has been reached.
+    /// Decides whether a URL would be crawled, without crawling it.
     ///
     /// # Arguments
     ///
-    /// * `depth` - The current depth of the crawl.
+    /// * `url` - The URL to check.
+    /// * `depth` - The depth the URL would be queued at.
+    /// * `visited_urls` - The URLs that have been queued or visited.
     ///
     /// # Returns
     ///
-    /// * `bool` - Whether the max depth has been reached, or not.
-    const fn has_reached_max_depth(&self, depth: u32) -> bool {
-        if let Some(max_depth) = self.max_depth {
-            depth >= max_depth
-        } else {
-            false
-        }
-    }
-}
-
-#[async_trait]
-impl Scraper for Web {
-    type Item = Website;
+    /// * `Decision` - Whether the URL would be crawled, and the checks that decided it.
+    ///
+    /// # Notes
+    ///
+    /// * The `robots.txt` file of the host is the only thing fetched, and only if the URL passes the checks before it.
+    pub async fn check_url(&self, url: &str, depth: u32, visited_urls: &HashSet<Url>) -> Decision {
+        let (decision, normalized) = self.evaluator.check(url, depth, visited_urls);
+        let Some(normalized) = normalized else {
+            return decision;
+        };
 
-    #[allow(clippy::expect_used)]
-    fn seed_urls(&self) -> HashMap<Url, u32> {
-        let seed_urls = utils::env::data::fetch_seed_urls().expect("Failed to fetch seed URLs!");
+        let robots_file = self.get_robots_file(&normalized).await;
 
-        seed_urls
-            .into_iter()
-            .map(|url| (url, 0))
-            .collect::<HashMap<_, _>>()
+        self.evaluator
+            .finish(decision, &normalized, depth, robots_file.as_ref())
     }
 
-    /// Scrapes the given URL.
+    /// Fetches a page again, to check if its content changes from one fetch to the next.
     ///
     /// # Arguments
     ///
-    /// * `url` - The URL to scrape.
-    /// * `depth` - The current depth of the crawl.
+    /// * `url` - The URL of the page.
+    /// * `body` - The decoded body of the first fetch.
+    /// * `content_type` - The `Content-Type` header of the first fetch, if any.
+    /// * `crawl_delay` - The crawl delay the `robots.txt` file of the host asks for in seconds, if any.
     ///
     /// # Returns
     ///
-    /// * `Result<(Vec<Self::Item>, (Vec<Url>, u32)), Error>` - The scraped items and new URLs.
-    async fn scrape(
+    /// * `bool` - Whether the text of the two fetches differs wildly, `false` if the page could not be fetched again.
+    ///
+    /// # Notes
+    ///
+    /// * Unless `COOKIES` is enabled, no cookies are kept between the fetches, so both are what a visitor without cookies would see.
+    /// * The page is fetched from the URL its redirects ended at, and isn't compared if it redirects again.
+    async fn is_unstable(
         &self,
-        url: Url,
-        depth: u32,
-    ) -> Result<(Vec<Self::Item>, HashMap<Url, u32>), Error> {
-        if self.has_reached_max_depth(depth) {
-            warn!("Reached max depth, skipping \"{url}\"...");
-
-            return Ok((Vec::new(), HashMap::new()));
-        }
-
-        debug!("Current Depth: {depth}");
+        url: &Url,
+        body: &str,
+        content_type: Option<&str>,
+        crawl_delay: Option<f64>,
+    ) -> bool {
+        let bytes = match self.send(url, crawl_delay, None).await {
+            // A page that redirects now isn't compared, since the redirect has no content.
+            Ok(response) if response.status().is_redirection() => Ok(None),
+            Ok(response) => client::read_body(response, self.maximum_body_size).await,
+            Err(err) => Err(err),
+        };
 
-        info!("Getting robots.txt file for \"{url}\"...");
-        match self.get_robots_file(&url).await {
-            Ok(robots_file) => {
-                if !robots_file.is_crawlable(&url) {
-                    warn!("\"{url}\" is not crawlable, skipping...");
+        match bytes {
+            Ok(Some(bytes)) => {
+                self.usage.record(url, bytes.len());
+                let (other_body, _) = charset::decode(&bytes, content_type);
 
-                    return Ok((Vec::new(), HashMap::new()));
-                }
+                personalization::is_unstable(
+                    &Website::get_text(body),
+                    &Website::get_text(&other_body),
+                )
             }
+            Ok(None) => false,
             Err(err) => {
-                error!(
-                    "Failed to get robots.txt file for \"{url}\"! \
-                        Error: {err}"
-                );
+                warn!("Failed to fetch \"{url}\" again, assuming it's stable! Error: {err}");
 
-                return Ok((Vec::new(), HashMap::new()));
+                false
             }
-        };
-
-        info!("Getting body of \"{url}\"...");
-        let response = self.http_client.get(url.to_string()).send().await?;
-        let body = response.text().await?;
-
-        info!("Extracting links from \"{url}\"...");
-        let links = Self::extract_links(&body)?;
-
-        Ok((
-            vec![Website {
-                url: url.clone(),
-                html: body,
-                links: Some(links.clone()),
-            }],
-            links
-                .into_iter()
-                .map(|url| (url, depth + 1))
-                .collect::<HashMap<_, _>>(),
-        ))
+        }
     }
 
-    #[allow(clippy::expect_used)]
-    async fn process(&self, item: Self::Item) -> Result<(), Error> {
-        info!("Processing \"{}\"...", item.url);
+    /// Sends a request for a URL, once the rate limits allow it.
+    ///
+    /// # Arguments
+    ///
+    /// * `url` - The URL.
+    /// * `crawl_delay` - The crawl delay the `robots.txt` file of the host asks for in seconds, if any.
+    /// * `stored_page` - The stored page of the URL, whose `ETag` and `Last-Modified` headers are sent back, if any.
+    ///
+    /// # Returns
+    ///
+    /// * `reqwest::Result<Response>` - The response, without following it if it's a redirect.
+    async fn send(
+        &self,
+        url: &Url,
+        crawl_delay: Option<f64>,
+        stored_page: Option<&Page>,
+    ) -> reqwest::Result<Response> {
+        let mut request = self
+            .overrides
+            .authenticate(url, self.transports.get(url).get(url.to_string()));
+        if let Some(page) = stored_page {
+            if let Some(etag) = &page.etag {
+                request = request.header(IF_NONE_MATCH, etag);
+            }
+            if let Some(last_modified) = &page.last_modified {
+                request = request.header(IF_MODIFIED_SINCE, last_modified);
+            }
+        }
+        self.host_rate_limit.wait(url, crawl_delay).await;
+        self.rate_limit.wait().await;
 
-        let title = Website::get_title(&item.html);
-        let description = Website::get_description(&item.html);
-        let language = Website::get_language(&item.html);
-        let keywords = Website::get_keywords(&item.html);
-        let words = Website::get_words(&item.html, language.as_deref(), self.word_boundaries)?;
-        let link_count = item.links.as_ref().map(Vec::len).unwrap_or_default();
+        request.send().await
+    }
 
-        debug!("=> Title: {title:?}");
-        debug!("=> Description: {description:?}");
-        debug!("=> Language: {language:?}");
-        debug!("=> Keywords: {keywords:?}");
-        debug!("=> Words: {}", words.len());
-        debug!("=> Links: {link_count}");
+    /// Checks a URL with a `HEAD` request, before it's fetched in full.
+    ///
+    /// # Arguments
+    ///
+    /// * `url` - The URL.
+    /// * `crawl_delay` - The crawl delay the `robots.txt` file of the host asks for in seconds, if any.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the URL is fetched, unless its headers show it isn't in `CONTENT_TYPES` or is larger than `MAXIMUM_BODY_SIZE`.
+    ///
+    /// # Notes
+    ///
+    /// * URLs whose `HEAD` request fails, redirects or isn't supported are fetched anyway, since the `GET` request checks them too.
+    async fn preflight(&self, url: &Url, crawl_delay: Option<f64>) -> bool {
+        let request = self
+            .overrides
+            .authenticate(url, self.transports.get(url).head(url.to_string()));
+        self.host_rate_limit.wait(url, crawl_delay).await;
+        self.rate_limit.wait().await;
+        let response = match request.send().await {
+            Ok(response) => response,
+            Err(err) => {
+                warn!("Failed to check \"{url}\" with a HEAD request, fetching it anyway! Error: {err}");
 
-        let mut conn = database::get_connection().await?;
+                return true;
+            }
+        };
+        self.usage.record(url, 0);
+        if !response.status().is_success() {
+            return true;
+        }
 
-        info!("=> Creating page with URL: {}", item.url);
-        let page = database::create_page(
-            &mut conn,
-            &item.url,
-            title.as_deref(),
-            description.as_deref(),
-        )
-        .await?;
+        let content_type = response
+            .headers()
+            .get(CONTENT_TYPE)
+            .and_then(|content_type| content_type.to_str().ok());
+        if !charset::is_document(content_type, &self.content_types) {
+            info!(
+                "\"{url}\" is {}, which isn't in CONTENT_TYPES, skipping it without fetching it...",
+                content_type.unwrap_or_default()
+            );
 
-        let mut forward_links = HashMap::new();
-        for link in item.links.unwrap_or_else(|| {
-            warn!("=> No links found for \"{}\"!", item.url);
+            return false;
+        }
 
-            Vec::new()
-        }) {
-            if link == item.url {
-                warn!("=> Skipping forward link to self for \"{}\"...", link);
+        // The body of a HEAD response is empty, so its size is only in the header.
+        let declared_size = response
+            .headers()
+            .get(CONTENT_LENGTH)
+            .and_then(|content_length| content_length.to_str().ok())
+            .and_then(|content_length| content_length.trim().parse::<usize>().ok());
+        if let Some((declared_size, maximum_size)) = declared_size.zip(self.maximum_body_size) {
+            if declared_size > maximum_size {
+                info!("\"{url}\" declares a body larger than MAXIMUM_BODY_SIZE, skipping it without fetching it...");
 
-                continue;
+                return false;
             }
-
-            let count = forward_links.entry(link).or_insert(0);
-            *count += 1;
         }
-        info!(
-            "=> Creating {} forward links for \"{}\"...",
-            forward_links.len(),
-            item.url
-        );
-        database::create_forward_links(&mut conn, &item.url, &forward_links).await?;
-
-        let keywords = words
-            .into_iter()
-            .map(|(word, frequency)| NewKeyword {
-                page_id: page.id,
-                word,
-                frequency: i32::try_from(frequency).expect("=> Failed to convert frequency!"),
-            })
-            .collect::<Vec<_>>();
-        info!(
-            "=> Creating {} keywords for page with URL: {}",
-            keywords.len(),
-            item.url
-        );
-        database::create_keywords(&mut conn, &keywords).await?;
 
-        Ok(())
+        true
     }
-}
-
-/// A scraped website.
-///
-/// # Fields
-///
-/// * `url` - The URL of the website.
-/// * `html` - The HTML of the website.
-/// * `links` - The links on the website, if any.
-pub struct Website {
-    pub url: Url,
-    pub html: String,
-    pub links: Option<Vec<Url>>,
-}
 
-impl Website {
-    /// Gets the title of a page.
+    /// Checks if the path of a URL ends in an extension that isn't known to be a page, like `.iso` or `.dat`.
     ///
     /// # Arguments
     ///
-    /// * `html`: The HTML document to get the title from.
+    /// * `url` - The URL.
     ///
     /// # Returns
     ///
-    /// * `Option<String>`: The title of the page.
-    ///
-    /// # Panics
-    ///
-    /// * If the title selector fails to parse.
-    #[allow(clippy::expect_used)]
-    fn get_title(html: &str) -> Option<String> {
-        Html::parse_document(html)
-            .select(&Selector::parse("title").expect("Failed to parse title selector!"))
-            .next()
-            .map(|element| element.inner_html().trim().to_string())
+    /// * `bool` - Whether the last segment of the path has an extension, and it isn't one of `PAGE_EXTENSIONS`.
+    fn has_unknown_extension(url: &Url) -> bool {
+        url.path_segments()
+            .and_then(Iterator::last)
+            .and_then(|segment| segment.rsplit_once('.'))
+            .is_some_and(|(_, extension)| {
+                !PAGE_EXTENSIONS.contains(&extension.to_lowercase().as_str())
+            })
     }
 
-    /// Gets the description of a page.
+    /// Fetches a URL, following its redirects one hop at a time.
     ///
     /// # Arguments
     ///
-    /// * `html`: The HTML document to get the description from.
+    /// * `url` - The URL.
+    /// * `crawl_delay` - The crawl delay the `robots.txt` file of the host asks for in seconds, if any.
+    /// * `stored_page` - The stored page of the URL, whose `ETag` and `Last-Modified` headers are sent back, if any.
     ///
     /// # Returns
     ///
-    /// * `Option<String>`: The description of the page.
+    /// * `Ok((Response, Vec<(Url, u16)>))` - The response the redirects ended at, and each URL that redirected with the status code of its redirect.
+    /// * `Err(Error)` - If the URL could not be fetched.
     ///
-    /// # Panics
+    /// # Errors
     ///
-    /// * If the description selector fails to parse.
-    #[allow(clippy::expect_used)]
-    fn get_description(html: &str) -> Option<String> {
-        Html::parse_document(html)
-            .select(
-                &Selector::parse("meta[name=description]")
-                    .expect("Failed to parse description selector!"),
-            )
-            .next()
-            .map(|element| element.inner_html().trim().to_string())
+    /// * If a hop could not be fetched.
+    /// * If the URL redirects more than `MAXIMUM_REDIRECTS` times, or to a scheme that isn't followed.
+    /// * If the `robots.txt` file of a hop disallows crawling it.
+    ///
+    /// # Notes
+    ///
+    /// * Each hop is requested with the client and credentials of its own host, and waits for the rate limits and crawl delay of it.
+    /// * The `ETag` and `Last-Modified` headers are only sent to the URL itself, since they belong to its stored page.
+    async fn fetch(
+        &self,
+        url: &Url,
+        crawl_delay: Option<f64>,
+        stored_page: Option<&Page>,
+    ) -> Result<(Response, Vec<(Url, u16)>), Error> {
+        let mut redirects = Vec::new();
+        let mut fetched_url = url.clone();
+        let mut response = self.send(url, crawl_delay, stored_page).await?;
+        while let Some(location) =
+            Self::get_location(response.status(), response.headers(), &fetched_url)
+        {
+            if redirects.len() >= self.maximum_redirects {
+                return Err(Error::Redirect(format!(
+                    "\"{url}\" redirects more than {} times",
+                    self.maximum_redirects
+                )));
+            }
+
+            let step = self.evaluator.check_scheme(&location);
+            if !step.passed {
+                return Err(Error::Redirect(format!(
+                    "\"{fetched_url}\" redirects to \"{location}\", {}",
+                    step.detail
+                )));
+            }
+
+            let step = self.evaluator.check_host(&location);
+            if !step.passed {
+                return Err(Error::Redirect(format!(
+                    "\"{fetched_url}\" redirects to \"{location}\", {}",
+                    step.detail
+                )));
+            }
+
+            let robots_file = self.get_robots_file(&location).await;
+            let step = self.evaluator.check_robots(&location, robots_file.as_ref());
+            if !step.passed {
+                return Err(Error::RobotsDisallowed(format!(
+                    "\"{fetched_url}\" redirects to \"{location}\", which is not crawlable, {}",
+                    step.detail
+                )));
+            }
+            let crawl_delay = robots_file
+                .ok()
+                .and_then(|robots_file| robots_file.check(&location, &self.user_agent).crawl_delay);
+
+            info!("\"{fetched_url}\" redirects to \"{location}\", following it...");
+            self.usage.record(&fetched_url, 0);
+            redirects.push((fetched_url, response.status().as_u16()));
+            fetched_url = location;
+            response = self.send(&fetched_url, crawl_delay, None).await?;
+        }
+
+        Ok((response, redirects))
     }
 
-    /// Gets the language of a page.
+    /// Gets the URL a response redirects to.
     ///
     /// # Arguments
     ///
-    /// * `document`: The HTML document to get the language from.
+    /// * `status` - The status code of the response.
+    /// * `headers` - The headers of the response.
+    /// * `url` - The URL that was requested, which relative locations are resolved against.
     ///
     /// # Returns
     ///
-    /// * `Option<String>`: The language of the page.
+    /// * `Option<Url>` - The URL in the `Location` header, if the response is a redirect with a valid one.
     ///
-    /// # Panics
+    /// # Notes
     ///
-    /// * If the HTML selector fails to parse.
-    #[allow(clippy::expect_used)]
-    fn get_language(html: &str) -> Option<String> {
-        Html::parse_document(html)
-            .select(&Selector::parse("html").expect("Failed to parse HTML selector!"))
-            .next()
-            .and_then(|element| element.value().attr("lang"))
-            .map(std::string::ToString::to_string)
+    /// * Only `301`, `302`, `303`, `307` and `308` are followed, like browsers do.
+    fn get_location(status: StatusCode, headers: &HeaderMap, url: &Url) -> Option<Url> {
+        if !matches!(
+            status,
+            StatusCode::MOVED_PERMANENTLY
+                | StatusCode::FOUND
+                | StatusCode::SEE_OTHER
+                | StatusCode::TEMPORARY_REDIRECT
+                | StatusCode::PERMANENT_REDIRECT
+        ) {
+            return None;
+        }
+
+        headers
+            .get(LOCATION)
+            .and_then(|location| location.to_str().ok())
+            .and_then(|location| url.join(location.trim()).ok())
     }
 
-    /// Gets the keywords of a page.
+    /// Records the redirects a URL was followed through, so each URL in the chain is an alias of the one it ended at.
     ///
     /// # Arguments
     ///
-    /// * `html`: The HTML document to get the keywords from.
-    ///
-    /// # Returns
-    ///
-    /// * `Option<Vec<String>>`: The keywords of the page.
+    /// * `redirects` - Each URL that redirected, in order, with the status code of its redirect.
+    /// * `final_url` - The URL the redirects ended at, as it's indexed.
     ///
-    /// # Panics
+    /// # Notes
     ///
-    /// * If the keywords selector fails to parse.
-    #[allow(clippy::expect_used)]
-    fn get_keywords(html: &str) -> Option<Vec<String>> {
-        Html::parse_document(html)
-            .select(
-                &Selector::parse("meta[name=keywords]")
-                    .expect("Failed to parse keywords selector!"),
-            )
-            .next()
-            .and_then(|element| element.value().attr("content"))
-            .map(|keywords| {
-                keywords
-                    .split(',')
-                    .map(|keyword| keyword.trim().to_string())
-                    .collect()
+    /// * URLs that are the same as the final URL once they're normalized, like a redirect adding a trailing slash, aren't aliases of it.
+    async fn record_redirects(&self, redirects: &[(Url, u16)], final_url: &Url) {
+        let normalize = |url: &Url| self.evaluator.normalize(url);
+        let seen_at = SystemTime::now();
+
+        // A URL the chain passes through twice is recorded where it's first passed.
+        let mut seen = HashSet::new();
+        let aliases = redirects
+            .iter()
+            .enumerate()
+            .map(|(index, (url, status))| (index, normalize(url), *status))
+            .filter(|(_, url, _)| url != final_url && seen.insert(url.clone()))
+            .map(|(index, url, status)| Redirect {
+                url: url.to_string(),
+                next_url: redirects
+                    .get(index + 1)
+                    .map_or_else(|| final_url.clone(), |(next_url, _)| normalize(next_url))
+                    .to_string(),
+                final_url: final_url.to_string(),
+                hop: i32::try_from(index + 1).unwrap_or(i32::MAX),
+                status: i32::from(status),
+                seen_at,
             })
+            .collect::<Vec<_>>();
+
+        if let Err(err) = database::set_redirects(&aliases).await {
+            error!(
+                "Failed to record the redirects to \"{final_url}\" ({}): {err}",
+                err.code()
+            );
+        }
     }
 
-    /// Gets the "spoken" words on a page, excluding HTML tags.
+    /// Removes the stored page of a URL from the index, for a page that may no longer be indexed.
     ///
     /// # Arguments
     ///
-    /// * `html`: The HTML document to get the words from.
-    /// * `language`: The language of the page.
-    /// * `bounds`: The bounds of the words.
+    /// * `url` - The URL of the page.
+    async fn remove_page(&self, url: &Url) {
+        match self.writer.remove(url).await {
+            Ok(true) => {
+                info!("Removed \"{url}\" from the index, since it may no longer be indexed.");
+            }
+            Ok(false) => {}
+            Err(err) => error!(
+                "Failed to remove \"{url}\" from the index ({}): {err}",
+                err.code()
+            ),
+        }
+    }
+
+    /// Records the canonical URL a variant of a page declares, so the variant is an alias of it.
     ///
-    /// # Returns
+    /// # Arguments
     ///
-    /// * `Result<HashMap<String, usize>, Error>`: The words on the page.
+    /// * `url` - The URL of the variant, as it was fetched.
+    /// * `canonical_url` - The canonical URL, as it's indexed.
+    async fn record_canonical(&self, url: &Url, canonical_url: &Url) {
+        let canonical = Canonical {
+            url: url.to_string(),
+            canonical_url: canonical_url.to_string(),
+            seen_at: SystemTime::now(),
+        };
+
+        if let Err(err) = database::set_canonical(&canonical).await {
+            error!(
+                "Failed to record the canonical URL of \"{url}\" ({}): {err}",
+                err.code()
+            );
+        }
+    }
+
+    /// Records that a page is nearly the same as an indexed one, so it isn't indexed itself.
     ///
-    /// # Errors
+    /// # Arguments
     ///
-    /// * If the minimum length is greater than the maximum length.
+    /// * `url` - The URL of the page.
+    /// * `duplicate_of` - The URL of the indexed page.
+    /// * `distance` - The number of bits the simhashes of the pages differ in.
+    async fn record_near_duplicate(&self, url: &Url, duplicate_of: &str, distance: u32) {
+        let near_duplicate = NearDuplicate {
+            url: url.to_string(),
+            duplicate_of: duplicate_of.to_string(),
+            distance: i32::try_from(distance).unwrap_or(i32::MAX),
+            seen_at: SystemTime::now(),
+        };
+
+        if let Err(err) = database::set_near_duplicate(&near_duplicate).await {
+            error!(
+                "Failed to record \"{url}\" as a near-duplicate ({}): {err}",
+                err.code()
+            );
+        }
+    }
+
+    /// Gets the stored page of a URL, if it's only fetched in full again if it changed.
+    ///
+    /// # Arguments
+    ///
+    /// * `url` - The URL of the page.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Page)` - The page, if it has an `ETag` or `Last-Modified` header and is indexed with the current dictionary.
+    /// * `None` - If the page is fetched in full.
+    ///
+    /// # Notes
+    ///
+    /// * Pages indexed with another dictionary, or only by their title, are always fetched in full, so they're indexed again.
+    async fn get_stored_page(&self, url: &Url) -> Option<Page> {
+        if !self.conditional_requests {
+            return None;
+        }
+
+        match self.writer.get_page(url).await {
+            Ok(page) => page.filter(|page| {
+                (page.etag.is_some() || page.last_modified.is_some())
+                    && page.index_fingerprint.as_deref() == Some(self.fingerprint.as_str())
+            }),
+            Err(err) => {
+                warn!(
+                    "Failed to get the stored page of \"{url}\", fetching it in full! Error ({}): {err}",
+                    err.code()
+                );
+
+                None
+            }
+        }
+    }
+
+    /// Gets a header of a response that's sent back to only fetch the page again if it changed.
+    ///
+    /// # Arguments
+    ///
+    /// * `headers` - The headers of the response.
+    /// * `name` - The name of the header, like `ETag`.
+    /// * `maximum_length` - The maximum length of the header that's stored.
+    ///
+    /// # Returns
+    ///
+    /// * `Option<String>` - The header, if it's set, valid and not too long to store.
+    fn get_validator(
+        headers: &HeaderMap,
+        name: &HeaderName,
+        maximum_length: usize,
+    ) -> Option<String> {
+        headers
+            .get(name)
+            .and_then(|value| value.to_str().ok())
+            .map(str::trim)
+            .filter(|value| !value.is_empty() && value.len() <= maximum_length)
+            .map(std::string::ToString::to_string)
+    }
+
+    /// Writes a page with only its title and links, for fast discovery crawls.
+    ///
+    /// # Arguments
+    ///
+    /// * `item` - The scraped page.
+    /// * `title` - The sanitized title of the page, if any.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(())` - If the page was written.
+    /// * `Err(Error)` - If the page could not be written.
+    ///
+    /// # Errors
+    ///
+    /// * If the page could not be written.
+    ///
+    /// # Notes
+    ///
+    /// * No keywords or images are written, so the page isn't found by searches until it's fully indexed.
+    /// * The page has no index fingerprint, so the `reindex` command fully indexes it later on.
+    async fn process_title(&self, item: Website, title: Option<String>) -> Result<(), Error> {
+        let language = Website::get_language(&item.html);
+        let forward_links = item
+            .links
+            .unwrap_or_default()
+            .into_iter()
+            .filter(|(link, _)| *link != item.url)
+            .collect::<HashMap<_, _>>();
+        let anchors = item
+            .anchors
+            .into_iter()
+            .filter(|(link, _)| forward_links.contains_key(link))
+            .collect::<HashMap<_, _>>();
+
+        info!(
+            "=> Writing title of page with URL \"{}\" and {} forward links...",
+            item.url,
+            forward_links.len()
+        );
+        self.writer
+            .write(Entry {
+                page: NewPage {
+                    url: item.url.to_string(),
+
+                    title,
+                    description: None,
+                    encoding: Some(item.encoding),
+                    index_fingerprint: None,
+                    language: language.as_deref().and_then(utils::language::normalize),
+                    published_at: None,
+                    content_modified_at: None,
+                    content: None,
+                    authenticated: item.authenticated,
+                    excluded: item.excluded,
+                    personalized: item.personalized,
+                    unstable: item.unstable,
+                    noarchive: item.noarchive,
+                    etag: None,
+                    last_modified: None,
+                },
+                content: String::new(),
+
+                content_hash: item.content_hash,
+                status: i32::from(item.status),
+                size: i32::try_from(item.size).unwrap_or(i32::MAX),
+
+                forward_links,
+                keywords: Vec::new(),
+                images: Vec::new(),
+                anchors,
+                structured_data: Vec::new(),
+                simhash: None,
+            })
+            .await?;
+        self.crawl_log.record_indexed(&item.url);
+
+        Ok(())
+    }
+
+    /// Extracts the distinct links from the given HTML body.
+    ///
+    /// # Arguments
+    ///
+    /// * `body` - The HTML body to extract links from.
+    /// * `base` - The URL of the page, which protocol-relative links get the scheme of.
+    /// * `allowed_schemes` - The schemes of the links to follow.
+    /// * `host_aliases` - The aliases of hosts, so links to an alias are kept as its canonical host.
+    /// * `tracking_parameters` - The query parameters stripped from links, so tagged links are kept as one.
+    /// * `maximum_links` - The maximum number of distinct links to keep, if limited.
+    ///
+    /// # Returns
+    ///
+    /// * `Result<Links, Error>` - The extracted links, and how many were dropped.
+    ///
+    /// # Notes
+    ///
+    /// * Links are told apart by their normalized URL, and each is kept where it first appears.
+    /// * Links in the content are kept before those in menus, headers and footers, and earlier links before later ones.
+    /// * A link is only qualified if every link to its URL is marked with `rel="nofollow"`, `rel="ugc"` or `rel="sponsored"`.
+    /// * The distinct anchor texts of the links to a URL are kept one per line, up to `MAXIMUM_ANCHOR_TEXT_LENGTH` characters.
+    pub fn extract_links(
+        body: &str,
+        base: &Url,
+        allowed_schemes: &[String],
+        host_aliases: &HostAliases,
+        tracking_parameters: &TrackingParameters,
+        maximum_links: Option<usize>,
+    ) -> Result<Links, Error> {
+        // The index of each link, so duplicates only add to its count.
+        let mut indexes = HashMap::<Url, usize>::new();
+        let mut links = Vec::<(Url, i32, bool, bool)>::new();
+        let mut anchors = HashMap::<Url, String>::new();
+
+        let document = Html::parse_document(body);
+        let selector = Selector::parse("a")?;
+        let image_selector = Selector::parse("img[alt]")?;
+        for element in document.select(&selector) {
+            // If the element has no href, skip it.
+            let Some(link) = element.value().attr("href") else {
+                continue;
+            };
+
+            // If the link fails to parse or its scheme isn't followed, skip it.
+            match urls::resolve_link(link, base, allowed_schemes) {
+                Ok(url) => {
+                    let url = host_aliases.apply(&tracking_parameters.strip(&url));
+                    let qualified = element.value().attr("rel").is_some_and(|rel| {
+                        rel.split_ascii_whitespace().any(|value| {
+                            QUALIFIED_RELS
+                                .iter()
+                                .any(|qualified| value.eq_ignore_ascii_case(qualified))
+                        })
+                    });
+                    if let Some(text) = Self::get_anchor_text(element, &image_selector) {
+                        Self::add_anchor_text(anchors.entry(url.clone()).or_default(), &text);
+                    }
+                    if let Some(&index) = indexes.get(&url) {
+                        links[index].1 = links[index].1.saturating_add(1);
+                        links[index].3 &= qualified;
+
+                        continue;
+                    }
+
+                    let boilerplate = element
+                        .ancestors()
+                        .filter_map(|ancestor| ancestor.value().as_element())
+                        .any(|ancestor| BOILERPLATE_ELEMENTS.contains(&ancestor.name()));
+                    indexes.insert(url.clone(), links.len());
+                    links.push((url, 1, boilerplate, qualified));
+                }
+                Err(Rejection::Invalid) => {}
+                Err(Rejection::Dangerous(scheme)) => {
+                    info!("Skipping {scheme}: link on \"{base}\", the scheme is dangerous...");
+                }
+                Err(Rejection::Disallowed(scheme)) => {
+                    debug!("Skipping {scheme}: link on \"{base}\", the scheme isn't allowed...");
+                }
+            }
+        }
+
+        // The sort is stable, so the links keep their order within the content and the boilerplate.
+        links.sort_by_key(|(_, _, boilerplate, _)| *boilerplate);
+        let dropped = maximum_links.map_or(0, |maximum| links.len().saturating_sub(maximum));
+        links.truncate(links.len() - dropped);
+
+        Ok(Links {
+            qualified: links
+                .iter()
+                .filter(|(_, _, _, qualified)| *qualified)
+                .map(|(url, _, _, _)| url.clone())
+                .collect(),
+            anchors: links
+                .iter()
+                .filter_map(|(url, _, _, _)| Some((url.clone(), anchors.remove(url)?)))
+                .collect(),
+            counts: links
+                .into_iter()
+                .map(|(url, count, _, _)| (url, count))
+                .collect(),
+            dropped,
+        })
+    }
+
+    /// Gets the anchor text of a link, falling back to the alt text of the images in it.
+    ///
+    /// # Arguments
+    ///
+    /// * `element` - The link element.
+    /// * `image_selector` - The selector of the images with alt text.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(String)` - The anchor text, cut off at `MAXIMUM_ANCHOR_TEXT_LENGTH` characters.
+    /// * `None` - If the link has no text.
+    fn get_anchor_text(element: ElementRef, image_selector: &Selector) -> Option<String> {
+        let text = Some(charset::sanitize(&text::extract(element)))
+            .filter(|text| !text.is_empty())
+            .or_else(|| {
+                element
+                    .select(image_selector)
+                    .filter_map(|image| image.value().attr("alt"))
+                    .map(|alt| {
+                        charset::sanitize(&alt.split_whitespace().collect::<Vec<_>>().join(" "))
+                    })
+                    .find(|alt| !alt.is_empty())
+            })?;
+
+        Some(text.chars().take(MAXIMUM_ANCHOR_TEXT_LENGTH).collect())
+    }
+
+    /// Adds an anchor text to the anchor texts of the links to a URL.
+    ///
+    /// # Arguments
+    ///
+    /// * `texts` - The distinct anchor texts so far, one per line.
+    /// * `text` - The anchor text to add.
+    ///
+    /// # Notes
+    ///
+    /// * Texts that are already there, or wouldn't fit in `MAXIMUM_ANCHOR_TEXT_LENGTH` characters, aren't added.
+    fn add_anchor_text(texts: &mut String, text: &str) {
+        if texts.lines().any(|other| other == text) {
+            return;
+        }
+
+        let length = texts.chars().count() + usize::from(!texts.is_empty()) + text.chars().count();
+        if length > MAXIMUM_ANCHOR_TEXT_LENGTH {
+            return;
+        }
+
+        if !texts.is_empty() {
+            texts.push('\n');
+        }
+        texts.push_str(text);
+    }
+}
+
+#[async_trait]
+impl Scraper for Web {
+    type Item = Website;
+
+    #[allow(clippy::expect_used)]
+    fn seed_urls(&self) -> Vec<(Url, u32)> {
+        let seed_urls = utils::env::data::fetch_seed_urls().expect("Failed to fetch seed URLs!");
+
+        // Use the sampling seed so the order is reproducible along with the sampled links.
+        let mut rng = utils::env::crawler::get_sample_seed()
+            .map_or_else(StdRng::from_entropy, StdRng::seed_from_u64);
+
+        seeds::order(
+            seed_urls,
+            utils::env::crawler::get_seed_selection(),
+            &mut rng,
+        )
+        .into_iter()
+        .map(|url| self.evaluator.normalize(&url))
+        .chain(self.pagination.seed_urls())
+        .map(|url| (url, 0))
+        .collect()
+    }
+
+    /// Scrapes the given URL.
+    ///
+    /// # Arguments
+    ///
+    /// * `url` - The URL to scrape.
+    /// * `depth` - The current depth of the crawl.
+    ///
+    /// # Returns
+    ///
+    /// * `Result<(Vec<Self::Item>, (Vec<Url>, u32)), Error>` - The scraped items and new URLs.
+    async fn scrape(
+        &self,
+        url: Url,
+        depth: u32,
+    ) -> Result<(Vec<Self::Item>, HashMap<Url, u32>), Error> {
+        let step = self.evaluator.check_depth(depth);
+        if !step.passed {
+            warn!("{}, skipping \"{url}\"...", step.detail);
+
+            return Ok((Vec::new(), HashMap::new()));
+        }
+
+        let step = self.evaluator.check_host(&url);
+        if !step.passed {
+            info!("{}, skipping \"{url}\"...", step.detail);
+
+            return Ok((Vec::new(), HashMap::new()));
+        }
+
+        debug!("Current Depth: {depth}");
+
+        info!("Getting robots.txt file for \"{url}\"...");
+        let crawl_delay = match self.get_robots_file(&url).await {
+            Ok(robots_file) => {
+                let step = self.evaluator.check_robots(&url, Ok(&robots_file));
+                if !step.passed {
+                    let err = Error::RobotsDisallowed(format!(
+                        "\"{url}\" is not crawlable, {}",
+                        step.detail
+                    ));
+                    self.crawl_log.record(&url, None, Some(&err));
+
+                    return Err(err);
+                }
+
+                robots_file.check(&url, &self.user_agent).crawl_delay
+            }
+            Err(err) => {
+                error!(
+                    "Failed to get robots.txt file for \"{url}\"! \
+                        Error ({}): {err}",
+                    err.code()
+                );
+
+                return Ok((Vec::new(), HashMap::new()));
+            }
+        };
+
+        if let Some(budget) = &self.budget {
+            if !budget.spend(&url).await {
+                info!("The host of \"{url}\" used up its pages for today, skipping it...");
+
+                return Ok((Vec::new(), HashMap::new()));
+            }
+        }
+
+        // Pages that were crawled before are only fetched in full again if they changed.
+        let stored_page = self.get_stored_page(&url).await;
+
+        // URLs that may be large binaries are checked first, so they aren't downloaded only to be skipped.
+        if self.head_preflight
+            && stored_page.is_none()
+            && Self::has_unknown_extension(&url)
+            && !self.preflight(&url, crawl_delay).await
+        {
+            return Ok((Vec::new(), HashMap::new()));
+        }
+
+        info!("Getting body of \"{url}\"...");
+        let (response, redirects) = match self.fetch(&url, crawl_delay, stored_page.as_ref()).await
+        {
+            Ok(fetched) => fetched,
+            Err(err) => {
+                self.crawl_log.record(&url, None, Some(&err));
+
+                return Err(err);
+            }
+        };
+        let status = response.status().as_u16();
+        self.crawl_log.record(&url, Some(status), None);
+        let fetched_url = response.url().clone();
+        let (authenticated, excluded) = self.overrides.get_flags(&fetched_url);
+        let personalized = personalization::is_personalized(response.headers());
+        let retry_after = response
+            .headers()
+            .get(RETRY_AFTER)
+            .and_then(|retry_after| retry_after.to_str().ok())
+            .and_then(|retry_after| throttle::parse_retry_after(retry_after, SystemTime::now()));
+        self.throttle.record(status, retry_after);
+        let header_directives = response
+            .headers()
+            .get_all(X_ROBOTS_TAG)
+            .iter()
+            .filter_map(|value| value.to_str().ok())
+            .fold(Directives::default(), |directives, value| {
+                directives.merge(Directives::parse_header(value, &self.user_agent))
+            });
+        if let Some(page) = stored_page.filter(|_| status == StatusCode::NOT_MODIFIED.as_u16()) {
+            info!("\"{url}\" wasn't modified since it was last crawled, following its stored links...");
+
+            let links = self.writer.revisit(&page).await?;
+
+            // The headers of the response still apply, even though the page is the same.
+            if header_directives.noindex {
+                info!("\"{url}\" may no longer be indexed...");
+                self.remove_page(&url).await;
+            }
+            if header_directives.nofollow {
+                info!("\"{url}\" may no longer be followed, skipping its stored links...");
+
+                return Ok((Vec::new(), HashMap::new()));
+            }
+
+            return Ok((
+                Vec::new(),
+                links.into_iter().map(|link| (link, depth + 1)).collect(),
+            ));
+        }
+
+        // Pages are indexed by the URL their redirects end at, and the URLs before it are recorded as its aliases.
+        let (url, crawl_delay) = if redirects.is_empty() {
+            (url, crawl_delay)
+        } else {
+            let final_url = self.evaluator.normalize(&fetched_url);
+            info!(
+                "\"{url}\" redirects to \"{final_url}\" after {} hops, indexing it instead...",
+                redirects.len()
+            );
+            self.record_redirects(&redirects, &final_url).await;
+
+            (final_url, None)
+        };
+
+        let etag = Self::get_validator(response.headers(), &ETAG, MAXIMUM_ETAG_LENGTH);
+        let last_modified = Self::get_validator(
+            response.headers(),
+            &LAST_MODIFIED,
+            MAXIMUM_LAST_MODIFIED_LENGTH,
+        );
+        let content_type = response
+            .headers()
+            .get(CONTENT_TYPE)
+            .and_then(|content_type| content_type.to_str().ok())
+            .map(std::string::ToString::to_string);
+        if header_directives.noindex && header_directives.nofollow {
+            info!("\"{url}\" may not be indexed or followed, skipping...");
+            self.remove_page(&url).await;
+
+            return Ok((Vec::new(), HashMap::new()));
+        }
+
+        if !charset::is_document(content_type.as_deref(), &self.content_types) {
+            info!(
+                "\"{url}\" is {}, which isn't in CONTENT_TYPES, skipping...",
+                content_type.unwrap_or_default()
+            );
+
+            return Ok((Vec::new(), HashMap::new()));
+        }
+
+        let Some(bytes) = client::read_body(response, self.maximum_body_size).await? else {
+            info!("\"{url}\" declares a body larger than MAXIMUM_BODY_SIZE, skipping...");
+
+            return Ok((Vec::new(), HashMap::new()));
+        };
+        self.usage.record(&fetched_url, bytes.len());
+        if charset::is_binary(&bytes, content_type.as_deref()) {
+            info!("\"{url}\" has a binary body, skipping...");
+
+            return Ok((Vec::new(), HashMap::new()));
+        }
+        let (body, encoding) = charset::decode(&bytes, content_type.as_deref());
+        debug!("Decoded \"{url}\" as {}.", encoding.name());
+
+        if let Err(err) = self.limits.check(&body).await {
+            warn!(
+                "Skipping extraction of \"{url}\"! Error ({}): {err}",
+                err.code()
+            );
+
+            return Ok((Vec::new(), HashMap::new()));
+        }
+
+        // Index the full version of AMP pages instead of the stripped-down variant.
+        if let Some(canonical_url) = Website::get_amp_canonical(&body, &url) {
+            let canonical_url = self.evaluator.normalize(&canonical_url);
+            info!(
+                "\"{url}\" is an AMP page, queueing its canonical \"{canonical_url}\" instead..."
+            );
+
+            return Ok((Vec::new(), HashMap::from([(canonical_url, depth)])));
+        }
+
+        let directives =
+            header_directives.merge(Website::get_meta_directives(&body, &self.user_agent));
+        debug!("=> Directives: {directives:?}");
+
+        let links = if directives.nofollow {
+            info!("\"{url}\" may not be followed, skipping its links...");
+
+            Links::default()
+        } else {
+            info!("Extracting links from \"{url}\"...");
+
+            Self::extract_links(
+                &body,
+                &url,
+                self.evaluator.allowed_schemes(),
+                self.evaluator.host_aliases(),
+                self.evaluator.tracking_parameters(),
+                self.maximum_links,
+            )?
+        };
+        if links.dropped > 0 {
+            info!(
+                "Dropped {} links from \"{url}\", keeping {}...",
+                links.dropped,
+                links.counts.len()
+            );
+        }
+
+        let mut new_urls = links
+            .counts
+            .iter()
+            .filter(|(link, _)| links.is_queued(link, self.qualified_links))
+            .map(|(link, _)| (link.clone(), depth + 1))
+            .collect::<HashMap<_, _>>();
+        if !directives.nofollow {
+            if let Some(next_url) = Website::get_next(&body, &url, self.evaluator.allowed_schemes())
+            {
+                new_urls
+                    .entry(self.evaluator.normalize(&next_url))
+                    .or_insert(depth + 1);
+            }
+        }
+
+        // The next page of a listing is at the same depth, since it's only a continuation of this one.
+        if let Some(next_url) = self.pagination.get_next(&url, &links.counts) {
+            info!("Walking the listing of \"{url}\" on to \"{next_url}\"...");
+
+            new_urls.insert(next_url, depth);
+        }
+        if directives.noindex {
+            info!("\"{url}\" may not be indexed, only following its links...");
+            self.remove_page(&url).await;
+
+            return Ok((Vec::new(), new_urls));
+        }
+
+        // Pages that may be personalized are fetched again, to check if others would see the same content.
+        let unstable = personalized
+            && !self.titles_only
+            && self
+                .is_unstable(&fetched_url, &body, content_type.as_deref(), crawl_delay)
+                .await;
+        if unstable {
+            info!("\"{url}\" changed between two fetches, marking it as unstable...");
+        }
+
+        // Variants of a page, like a sorted or filtered listing, are indexed as the canonical URL they declare.
+        let canonical_url = Website::get_variant_canonical(
+            &body,
+            &url,
+            self.evaluator.allowed_schemes(),
+            self.evaluator.host_aliases(),
+            self.evaluator.tracking_parameters(),
+        );
+        if let Some(canonical_url) = &canonical_url {
+            info!(
+                "\"{url}\" declares \"{canonical_url}\" as its canonical URL, indexing it instead..."
+            );
+            self.record_canonical(&url, canonical_url).await;
+        }
+
+        // Images are resolved against the URL the page was fetched from, like its links.
+        let images = if self.titles_only {
+            Vec::new()
+        } else {
+            Website::get_images(&body, &url, self.evaluator.allowed_schemes())
+        };
+
+        Ok((
+            vec![Website {
+                url: canonical_url.unwrap_or_else(|| url.clone()),
+                html: body,
+                encoding: encoding.name().to_string(),
+                anchors: links.get_ranked_anchors(self.qualified_links),
+                links: Some(links.get_ranked(self.qualified_links)),
+                images,
+                status,
+                content_hash: history::hash_content(&bytes),
+                size: bytes.len(),
+                authenticated,
+                excluded,
+                personalized,
+                unstable,
+                noarchive: directives.noarchive,
+                etag,
+                last_modified,
+            }],
+            new_urls,
+        ))
+    }
+
+    #[allow(clippy::expect_used)]
+    async fn process(&self, item: Self::Item) -> Result<(), Error> {
+        info!("Processing \"{}\"...", item.url);
+
+        let title = Website::get_title(&item.html).map(|title| charset::sanitize(&title));
+        if self.titles_only {
+            return self.process_title(item, title).await;
+        }
+
+        let description =
+            Website::get_description(&item.html).map(|description| charset::sanitize(&description));
+        let dates = Website::get_dates(&item.html, &item.url, SystemTime::now());
+        let structured_data = Website::get_structured_data(&item.html);
+        let keywords = Website::get_keywords(&item.html);
+        let text = Website::get_text(&item.html);
+
+        // Pages nearly the same as an indexed one, like a print view or a mirror, aren't indexed again.
+        let simhash = utils::simhash::compute(&text);
+        if let (Some(simhash), Some(maximum_distance)) = (simhash, self.near_duplicate_distance) {
+            match self
+                .writer
+                .find_near_duplicate(&item.url, simhash, maximum_distance)
+                .await
+            {
+                Ok(Some((duplicate_of, distance))) => {
+                    info!(
+                        "\"{}\" is nearly the same as \"{duplicate_of}\", skipping it...",
+                        item.url
+                    );
+                    self.record_near_duplicate(&item.url, &duplicate_of, distance)
+                        .await;
+                    self.remove_page(&item.url).await;
+
+                    return Ok(());
+                }
+                Ok(None) => {}
+                Err(err) => error!(
+                    "Failed to look up the near-duplicates of \"{}\" ({}): {err}",
+                    item.url,
+                    err.code()
+                ),
+            }
+        }
+
+        // Pages that don't declare their language have it detected from their text.
+        let language = Website::get_language(&item.html)
+            .as_deref()
+            .and_then(utils::language::normalize)
+            .or_else(|| Website::detect_language(&text));
+        let words = Website::get_words(
+            &text,
+            language.as_deref(),
+            self.word_boundaries,
+            &self.dictionary,
+        )?;
+        let title_words = title.as_deref().map_or_else(HashMap::new, |title| {
+            Website::get_title_words(title, language.as_deref(), &self.dictionary)
+        });
+        let heading_words = Website::get_heading_words(
+            &Website::get_headings(&item.html),
+            language.as_deref(),
+            &self.dictionary,
+        );
+        let image_words =
+            Website::get_image_words(&item.images, language.as_deref(), &self.dictionary);
+        let link_count = item.links.as_ref().map(Vec::len).unwrap_or_default();
+
+        debug!("=> Encoding: {}", item.encoding);
+        debug!("=> Title: {title:?}");
+        debug!("=> Description: {description:?}");
+        debug!("=> Language: {language:?}");
+        debug!("=> Dates: {dates:?}");
+        debug!("=> Keywords: {keywords:?}");
+        debug!(
+            "=> Words: {} (+{} in title, +{} in headings, +{} in images)",
+            words.len(),
+            title_words.len(),
+            heading_words.len(),
+            image_words.len()
+        );
+        debug!("=> Links: {link_count}");
+        debug!("=> Images: {}", item.images.len());
+        debug!("=> Structured data: {}", structured_data.len());
+
+        let mut forward_links = HashMap::new();
+        for (link, count) in item.links.unwrap_or_else(|| {
+            warn!("=> No links found for \"{}\"!", item.url);
+
+            Vec::new()
+        }) {
+            if link == item.url {
+                warn!("=> Skipping forward link to self for \"{}\"...", link);
+
+                continue;
+            }
+
+            forward_links.insert(link, count);
+        }
+        let anchors = item
+            .anchors
+            .into_iter()
+            .filter(|(link, _)| forward_links.contains_key(link))
+            .collect::<HashMap<_, _>>();
+
+        let keywords = words
+            .into_iter()
+            .map(|(word, positions)| (Field::Body, word, positions))
+            .chain(
+                title_words
+                    .into_iter()
+                    .map(|(word, positions)| (Field::Title, word, positions)),
+            )
+            .chain(
+                heading_words
+                    .into_iter()
+                    .map(|(word, positions)| (Field::Heading, word, positions)),
+            )
+            .chain(
+                image_words
+                    .into_iter()
+                    .map(|(word, positions)| (Field::Image, word, positions)),
+            )
+            .map(|(field, word, positions)| {
+                (
+                    field,
+                    word,
+                    i32::try_from(positions.len()).expect("=> Failed to convert frequency!"),
+                    positions
+                        .into_iter()
+                        .take(self.maximum_keyword_positions)
+                        .map_while(|position| i32::try_from(position).ok())
+                        .collect(),
+                )
+            })
+            .collect::<Vec<_>>();
+
+        info!(
+            "=> Writing page with URL \"{}\", {} forward links and {} keywords...",
+            item.url,
+            forward_links.len(),
+            keywords.len()
+        );
+        self.writer
+            .write(Entry {
+                page: NewPage {
+                    url: item.url.to_string(),
+
+                    title,
+                    description,
+                    encoding: Some(item.encoding),
+                    index_fingerprint: Some(self.fingerprint.clone()),
+                    language,
+                    published_at: dates.published_at,
+                    content_modified_at: dates.modified_at,
+                    content: None,
+                    authenticated: item.authenticated,
+                    excluded: item.excluded,
+                    personalized: item.personalized,
+                    unstable: item.unstable,
+                    noarchive: item.noarchive,
+                    etag: item.etag,
+                    last_modified: item.last_modified,
+                },
+                content: text,
+
+                content_hash: item.content_hash,
+                status: i32::from(item.status),
+                size: i32::try_from(item.size).unwrap_or(i32::MAX),
+
+                forward_links,
+                keywords,
+                images: item.images,
+                anchors,
+                structured_data,
+                simhash,
+            })
+            .await?;
+        self.crawl_log.record_indexed(&item.url);
+
+        Ok(())
+    }
+
+    async fn flush(&self) -> Result<(), Error> {
+        let pages = self.writer.flush().await?;
+        if pages > 0 {
+            info!("Wrote the last batch of {pages} pages.");
+        }
+
+        Ok(())
+    }
+}
+
+/// The links extracted from a page.
+///
+/// # Fields
+///
+/// * `counts` - Each distinct link, and how many times the page links to it, in the order they're kept in.
+/// * `qualified` - The kept links that are marked with `rel="nofollow"`, `rel="ugc"` or `rel="sponsored"`.
+/// * `anchors` - The distinct anchor texts of the kept links, one per line, for the links that have any.
+/// * `dropped` - The number of distinct links that were dropped, to keep at most `MAXIMUM_LINKS`.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct Links {
+    pub counts: Vec<(Url, i32)>,
+    pub qualified: HashSet<Url>,
+    pub anchors: HashMap<Url, String>,
+    pub dropped: usize,
+}
+
+impl Links {
+    /// Checks if a link is queued.
+    ///
+    /// # Arguments
+    ///
+    /// * `link` - The link.
+    /// * `qualified_links` - How qualified links are treated.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the link is queued.
+    #[must_use]
+    pub fn is_queued(&self, link: &Url, qualified_links: QualifiedLinks) -> bool {
+        qualified_links != QualifiedLinks::Skip || !self.qualified.contains(link)
+    }
+
+    /// Gets the links that are stored as links of the page, so they count as backlinks of the pages they link to.
+    ///
+    /// # Arguments
+    ///
+    /// * `qualified_links` - How qualified links are treated.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<(Url, i32)>` - The links, and how many times the page links to each.
+    #[must_use]
+    pub fn get_ranked(self, qualified_links: QualifiedLinks) -> Vec<(Url, i32)> {
+        if qualified_links == QualifiedLinks::Follow {
+            return self.counts;
+        }
+
+        self.counts
+            .into_iter()
+            .filter(|(link, _)| !self.qualified.contains(link))
+            .collect()
+    }
+
+    /// Gets the anchor texts of the links that are stored as links of the page.
+    ///
+    /// # Arguments
+    ///
+    /// * `qualified_links` - How qualified links are treated.
+    ///
+    /// # Returns
+    ///
+    /// * `HashMap<Url, String>` - The anchor texts of the links, by the URL they point to.
+    #[must_use]
+    pub fn get_ranked_anchors(&self, qualified_links: QualifiedLinks) -> HashMap<Url, String> {
+        self.anchors
+            .iter()
+            .filter(|(link, _)| {
+                qualified_links == QualifiedLinks::Follow || !self.qualified.contains(*link)
+            })
+            .map(|(link, text)| (link.clone(), text.clone()))
+            .collect()
+    }
+}
+
+/// A scraped website.
+///
+/// # Fields
+///
+/// * `url` - The URL of the website.
+/// * `html` - The HTML of the website.
+/// * `encoding` - The encoding the HTML was decoded from.
+/// * `links` - The distinct links on the website, and how many times it links to each, if any.
+/// * `images` - The images on the website, with their alt text and caption.
+/// * `anchors` - The anchor texts of the links on the website, by the URL they point to.
+/// * `status` - The HTTP status code of the response.
+/// * `content_hash` - The hash of the body of the response.
+/// * `size` - The size of the body of the response in bytes.
+/// * `authenticated` - Whether the website was fetched with the credentials of its host.
+/// * `excluded` - Whether the website is left out of search results.
+/// * `personalized` - Whether the response sets a cookie, or varies by the cookies of the request.
+/// * `unstable` - Whether the content changed between two fetches right after each other.
+/// * `noarchive` - Whether the website may not be shown from the cache.
+/// * `etag` - The `ETag` header of the response, if any.
+/// * `last_modified` - The `Last-Modified` header of the response, if any.
+pub struct Website {
+    pub url: Url,
+    pub html: String,
+    pub encoding: String,
+    pub links: Option<Vec<(Url, i32)>>,
+    pub images: Vec<(Url, Option<String>, Option<String>)>,
+    pub anchors: HashMap<Url, String>,
+    pub status: u16,
+    pub content_hash: String,
+    pub size: usize,
+    pub authenticated: bool,
+    pub excluded: bool,
+    pub personalized: bool,
+    pub unstable: bool,
+    pub noarchive: bool,
+    pub etag: Option<String>,
+    pub last_modified: Option<String>,
+}
+
+impl Website {
+    /// Gets the title of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to get the title from.
+    ///
+    /// # Returns
+    ///
+    /// * `Option<String>`: The title of the page.
+    ///
+    /// # Panics
+    ///
+    /// * If the title selector fails to parse.
+    #[allow(clippy::expect_used)]
+    fn get_title(html: &str) -> Option<String> {
+        Html::parse_document(html)
+            .select(&Selector::parse("title").expect("Failed to parse title selector!"))
+            .next()
+            .map(text::extract)
+    }
+
+    /// Gets the canonical URL of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to get the canonical URL from.
+    /// * `url`: The URL of the page, used to resolve relative canonical URLs.
+    ///
+    /// # Returns
+    ///
+    /// * `Option<Url>`: The canonical URL of the page.
+    ///
+    /// # Panics
+    ///
+    /// * If the canonical selector fails to parse.
+    #[allow(clippy::expect_used)]
+    fn get_canonical(html: &str, url: &Url) -> Option<Url> {
+        Html::parse_document(html)
+            .select(
+                &Selector::parse("link[rel=canonical][href]")
+                    .expect("Failed to parse canonical selector!"),
+            )
+            .next()
+            .and_then(|element| element.value().attr("href"))
+            .and_then(|href| url.join(href.trim()).ok())
+            .map(|canonical_url| urls::normalize(&canonical_url))
+    }
+
+    /// Gets the next page of a paginated page, from its `link rel="next"` hint.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to check.
+    /// * `url`: The URL of the page.
+    /// * `allowed_schemes`: The schemes of the links to follow.
+    ///
+    /// # Returns
+    ///
+    /// * `Option<Url>`: The next page, if the page links to one other than itself with a followed scheme.
+    ///
+    /// # Panics
+    ///
+    /// * If the next selector fails to parse.
+    #[allow(clippy::expect_used)]
+    fn get_next(html: &str, url: &Url, allowed_schemes: &[String]) -> Option<Url> {
+        Html::parse_document(html)
+            .select(
+                &Selector::parse("link[rel~=next][href]").expect("Failed to parse next selector!"),
+            )
+            .next()
+            .and_then(|element| element.value().attr("href"))
+            .and_then(|href| url.join(href.trim()).ok())
+            .filter(|next_url| urls::check_scheme(next_url, allowed_schemes).is_ok())
+            .map(|next_url| urls::normalize(&next_url))
+            .filter(|next_url| next_url != url)
+    }
+
+    /// Gets the images on a page, with their alt text and the caption of the figure they're in.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to get the images from.
+    /// * `url`: The URL of the page, which relative image URLs are resolved against.
+    /// * `allowed_schemes`: The schemes of the images to keep.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<(Url, Option<String>, Option<String>)>`: The URL, alt text and caption of each distinct image, in the order they're on the page.
+    ///
+    /// # Panics
+    ///
+    /// * If the image or caption selector fails to parse.
+    ///
+    /// # Notes
+    ///
+    /// * At most `MAXIMUM_IMAGES` images are kept, and their text is cut off at `MAXIMUM_IMAGE_TEXT_LENGTH` characters.
+    #[allow(clippy::expect_used)]
+    fn get_images(
+        html: &str,
+        url: &Url,
+        allowed_schemes: &[String],
+    ) -> Vec<(Url, Option<String>, Option<String>)> {
+        let get_text = |text: &str| -> Option<String> {
+            let text = charset::sanitize(&text.split_whitespace().collect::<Vec<_>>().join(" "));
+
+            (!text.is_empty()).then(|| text.chars().take(MAXIMUM_IMAGE_TEXT_LENGTH).collect())
+        };
+
+        let document = Html::parse_document(html);
+        let caption_selector =
+            Selector::parse("figcaption").expect("Failed to parse caption selector!");
+
+        let mut images = Vec::<(Url, Option<String>, Option<String>)>::new();
+        for element in
+            document.select(&Selector::parse("img[src]").expect("Failed to parse image selector!"))
+        {
+            let Some(image_url) = element
+                .value()
+                .attr("src")
+                .and_then(|src| url.join(src.trim()).ok())
+                .filter(|image_url| urls::check_scheme(image_url, allowed_schemes).is_ok())
+                .map(|image_url| urls::normalize(&image_url))
+            else {
+                continue;
+            };
+            if images
+                .iter()
+                .any(|(other_url, _, _)| other_url == &image_url)
+            {
+                continue;
+            }
+
+            let alt = element.value().attr("alt").and_then(get_text);
+            let caption = element
+                .ancestors()
+                .filter_map(ElementRef::wrap)
+                .find(|ancestor| ancestor.value().name() == "figure")
+                .and_then(|figure| figure.select(&caption_selector).next())
+                .and_then(|caption| get_text(&caption.text().collect::<String>()));
+
+            images.push((image_url, alt, caption));
+            if images.len() >= MAXIMUM_IMAGES {
+                break;
+            }
+        }
+
+        images
+    }
+
+    /// Checks if a page is an AMP page, marked by an `amp` or `⚡` attribute on the `html` element.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to check.
+    ///
+    /// # Returns
+    ///
+    /// * `bool`: Whether the page is an AMP page, or not.
+    ///
+    /// # Panics
+    ///
+    /// * If the HTML selector fails to parse.
+    #[allow(clippy::expect_used)]
+    fn is_amp(html: &str) -> bool {
+        Html::parse_document(html)
+            .select(&Selector::parse("html").expect("Failed to parse HTML selector!"))
+            .next()
+            .is_some_and(|element| {
+                element
+                    .value()
+                    .attrs()
+                    .any(|(name, _)| name == "amp" || name == "⚡")
+            })
+    }
+
+    /// Gets the canonical URL of an AMP page, which should be indexed in its place.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to check.
+    /// * `url`: The URL of the page.
+    ///
+    /// # Returns
+    ///
+    /// * `Option<Url>`: The canonical URL, if the page is an AMP page pointing to another page.
+    fn get_amp_canonical(html: &str, url: &Url) -> Option<Url> {
+        if !Self::is_amp(html) {
+            return None;
+        }
+
+        Self::get_canonical(html, url).filter(|canonical_url| canonical_url != url)
+    }
+
+    /// Gets the canonical URL of a variant of a page, which should be indexed in its place.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to check.
+    /// * `url`: The normalized URL of the page.
+    /// * `allowed_schemes`: The schemes of the links that are followed.
+    /// * `host_aliases`: The aliases of hosts, so a canonical URL on an alias is kept as its canonical host.
+    /// * `tracking_parameters`: The query parameters stripped from the canonical URL.
+    ///
+    /// # Returns
+    ///
+    /// * `Option<Url>`: The normalized canonical URL, if the page declares another URL on its host as canonical.
+    ///
+    /// # Notes
+    ///
+    /// * Canonical URLs on other hosts are ignored, so a page can't have its content indexed as another site's.
+    fn get_variant_canonical(
+        html: &str,
+        url: &Url,
+        allowed_schemes: &[String],
+        host_aliases: &HostAliases,
+        tracking_parameters: &TrackingParameters,
+    ) -> Option<Url> {
+        Self::get_canonical(html, url)
+            .filter(|canonical_url| urls::check_scheme(canonical_url, allowed_schemes).is_ok())
+            .map(|canonical_url| host_aliases.apply(&tracking_parameters.strip(&canonical_url)))
+            .filter(|canonical_url| canonical_url != url && canonical_url.host() == url.host())
+    }
+
+    /// Gets the indexing directives of the robots meta tags of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to get the directives from.
+    /// * `user_agent`: The user agent of the crawler.
+    ///
+    /// # Returns
+    ///
+    /// * `Directives`: The directives of the `robots` meta tags, and the ones naming the crawler.
+    ///
+    /// # Panics
+    ///
+    /// * If the meta selector fails to parse.
+    #[allow(clippy::expect_used)]
+    fn get_meta_directives(html: &str, user_agent: &str) -> Directives {
+        let product_token = robots::get_product_token(user_agent);
+
+        Html::parse_document(html)
+            .select(
+                &Selector::parse("meta[name][content]").expect("Failed to parse meta selector!"),
+            )
+            .filter(|element| {
+                element.value().attr("name").is_some_and(|name| {
+                    let name = name.trim().to_lowercase();
+
+                    name == "robots" || name == product_token
+                })
+            })
+            .filter_map(|element| element.value().attr("content"))
+            .fold(Directives::default(), |directives, content| {
+                directives.merge(Directives::parse(content))
+            })
+    }
+
+    /// Gets the description of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to get the description from.
+    ///
+    /// # Returns
+    ///
+    /// * `Option<String>`: The description of the page.
+    ///
+    /// # Panics
+    ///
+    /// * If the description selector fails to parse.
+    #[allow(clippy::expect_used)]
+    fn get_description(html: &str) -> Option<String> {
+        Html::parse_document(html)
+            .select(
+                &Selector::parse("meta[name=description]")
+                    .expect("Failed to parse description selector!"),
+            )
+            .next()
+            .map(|element| element.inner_html().trim().to_string())
+    }
+
+    /// Gets the language of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `document`: The HTML document to get the language from.
+    ///
+    /// # Returns
+    ///
+    /// * `Option<String>`: The language of the page.
+    ///
+    /// # Panics
+    ///
+    /// * If the HTML selector fails to parse.
+    #[allow(clippy::expect_used)]
+    fn get_language(html: &str) -> Option<String> {
+        Html::parse_document(html)
+            .select(&Selector::parse("html").expect("Failed to parse HTML selector!"))
+            .next()
+            .and_then(|element| element.value().attr("lang"))
+            .map(std::string::ToString::to_string)
+    }
+
+    /// Detects the language of a page from its text.
+    ///
+    /// # Arguments
+    ///
+    /// * `text`: The text of the page, from `get_text`.
+    ///
+    /// # Returns
+    ///
+    /// * `Option<String>`: The two letter code of the language, if it's detected reliably.
+    ///
+    /// # Notes
+    ///
+    /// * Short or mixed texts are rarely detected reliably, so they're left without a language.
+    fn detect_language(text: &str) -> Option<String> {
+        whatlang::detect(text)
+            .filter(whatlang::Info::is_reliable)
+            .and_then(|info| utils::language::from_iso_639_3(info.lang().code()))
+            .map(std::string::ToString::to_string)
+    }
+
+    /// Gets when the content of a page was published and last modified.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to get the dates from.
+    /// * `url`: The URL of the page.
+    /// * `now`: The current time, to leave out dates in the future.
+    ///
+    /// # Returns
+    ///
+    /// * `Dates`: The dates, each from the most trusted signal with a plausible one.
+    ///
+    /// # Notes
+    ///
+    /// * The signals are JSON-LD `datePublished` and `dateModified`, then the `article:published_time` and `article:modified_time` meta tags, then the first `time` elements of the article, and then a date in the URL.
+    ///
+    /// # Panics
+    ///
+    /// * If the selectors fail to parse.
+    #[allow(clippy::expect_used)]
+    fn get_dates(html: &str, url: &Url, now: SystemTime) -> Dates {
+        let document = Html::parse_document(html);
+
+        let json_ld = document
+            .select(
+                &Selector::parse(r#"script[type="application/ld+json"]"#)
+                    .expect("Failed to parse JSON-LD selector!"),
+            )
+            .filter_map(|element| {
+                serde_json::from_str::<serde_json::Value>(&element.text().collect::<String>()).ok()
+            })
+            .fold(Dates::default(), |found, value| {
+                found.or(dates::from_json_ld(&value, now))
+            });
+
+        let meta = |properties: &[&str]| {
+            document
+                .select(&Selector::parse("meta[content]").expect("Failed to parse meta selector!"))
+                .filter(|element| {
+                    let element = element.value();
+                    element
+                        .attr("property")
+                        .or_else(|| element.attr("name"))
+                        .is_some_and(|property| {
+                            properties.contains(&property.trim().to_lowercase().as_str())
+                        })
+                })
+                .filter_map(|element| element.value().attr("content"))
+                .find_map(|content| dates::parse_plausible(content, now))
+        };
+        let meta_tags = Dates {
+            published_at: meta(&["article:published_time"]),
+            modified_at: meta(&["article:modified_time", "og:updated_time"]),
+        };
+
+        // Only the first few, since the ones further down are usually comments or related articles.
+        let time = |selector: &str| {
+            document
+                .select(&Selector::parse(selector).expect("Failed to parse time selector!"))
+                .filter_map(|element| element.value().attr("datetime"))
+                .take(MAXIMUM_TIME_ELEMENTS)
+                .find_map(|datetime| dates::parse_plausible(datetime, now))
+        };
+        let time_elements = Dates {
+            published_at: time("article time[datetime], main time[datetime]")
+                .or_else(|| time("time[datetime]")),
+            modified_at: None,
+        };
+
+        let url_date = Dates {
+            published_at: dates::from_url(url, now),
+            modified_at: None,
+        };
+
+        json_ld.or(meta_tags).or(time_elements).or(url_date)
+    }
+
+    /// Gets the structured data entities of a page, like articles, products, recipes and organizations.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to get the structured data from.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<(Kind, String)>`: The kind and JSON-LD of each entity, in the order they're on the page.
+    ///
+    /// # Panics
+    ///
+    /// * If the JSON-LD selector fails to parse.
+    ///
+    /// # Notes
+    ///
+    /// * At most `MAXIMUM_STRUCTURED_DATA` entities are kept, and those above `MAXIMUM_STRUCTURED_DATA_SIZE` bytes are skipped.
+    /// * Blocks that aren't valid JSON are skipped, like they are by search engines.
+    #[allow(clippy::expect_used)]
+    fn get_structured_data(html: &str) -> Vec<(Kind, String)> {
+        let document = Html::parse_document(html);
+
+        document
+            .select(
+                &Selector::parse(r#"script[type="application/ld+json"]"#)
+                    .expect("Failed to parse JSON-LD selector!"),
+            )
+            .filter_map(|element| {
+                serde_json::from_str::<serde_json::Value>(&element.text().collect::<String>()).ok()
+            })
+            .flat_map(|value| {
+                structured_data::from_json_ld(&value)
+                    .into_iter()
+                    .map(|(kind, entity)| (kind, entity.to_string()))
+                    .collect::<Vec<_>>()
+            })
+            .filter(|(_, data)| data.len() <= MAXIMUM_STRUCTURED_DATA_SIZE)
+            .take(MAXIMUM_STRUCTURED_DATA)
+            .collect()
+    }
+
+    /// Gets the keywords of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to get the keywords from.
+    ///
+    /// # Returns
+    ///
+    /// * `Option<Vec<String>>`: The keywords of the page.
+    ///
+    /// # Panics
+    ///
+    /// * If the keywords selector fails to parse.
+    #[allow(clippy::expect_used)]
+    fn get_keywords(html: &str) -> Option<Vec<String>> {
+        Html::parse_document(html)
+            .select(
+                &Selector::parse("meta[name=keywords]")
+                    .expect("Failed to parse keywords selector!"),
+            )
+            .next()
+            .and_then(|element| element.value().attr("content"))
+            .map(|keywords| {
+                keywords
+                    .split(',')
+                    .map(|keyword| keyword.trim().to_string())
+                    .collect()
+            })
+    }
+
+    /// Gets the "spoken" text on a page, excluding HTML tags, scripts and styles.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to get the text from.
+    ///
+    /// # Returns
+    ///
+    /// * `String`: The text of the body, with its whitespace collapsed.
     ///
     /// # Panics
     ///
-    /// * If the illegal characters regex fails to compile.
     /// * If the body selector fails to parse.
     #[allow(clippy::expect_used)]
+    fn get_text(html: &str) -> String {
+        let document = Html::parse_document(html);
+
+        // Get the text from the body.
+        let selector = Selector::parse("body").expect("Failed to parse body selector!");
+        let element = document
+            .select(&selector)
+            .next()
+            .expect("Failed to get body!");
+
+        text::extract(element)
+    }
+
+    /// Gets the words in the text of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `text`: The text of the page, from `get_text`.
+    /// * `language`: The language of the page.
+    /// * `bounds`: The minimum and maximum frequency of the words.
+    /// * `dictionary`: The stop words, protected words and tokenizer.
+    ///
+    /// # Returns
+    ///
+    /// * `Result<HashMap<String, Vec<usize>>, Error>`: The words on the page, with their positions.
+    ///
+    /// # Errors
+    ///
+    /// * If the minimum frequency is greater than the maximum frequency.
     fn get_words(
-        html: &str,
+        text: &str,
         language: Option<&str>,
-        boundaries: (usize, usize, usize, usize),
-    ) -> Result<HashMap<String, usize>, Error> {
-        let (minimum_frequency, maximum_frequency, minimum_length, maximum_length) = boundaries;
+        boundaries: (usize, usize),
+        dictionary: &Dictionary,
+    ) -> Result<HashMap<String, Vec<usize>>, Error> {
+        let (minimum_frequency, maximum_frequency) = boundaries;
 
-        if minimum_length > maximum_length {
-            return Err(Error::InvalidBoundaries(
-                "Minimum length cannot be greater than maximum length!".into(),
-            ));
-        }
         if minimum_frequency > maximum_frequency {
             return Err(Error::InvalidBoundaries(
                 "Minimum frequency cannot be greater than maximum frequency!".into(),
             ));
         }
 
-        let mut document = Html::parse_document(html);
+        // Get the words from the text, stem, filter and locate them.
+        let mut words =
+            utils::words::extract_positions(text, Self::get_algorithm(language), dictionary);
 
-        // Remove script and style tags.
-        let selector = Selector::parse("script, style").expect("Failed to parse selector!");
-        let node_ids = document
-            .select(&selector)
-            .map(|x| x.id())
-            .collect::<Vec<_>>();
-        for node_id in node_ids {
-            document.remove_from_parent(&node_id);
+        words.retain(|_, positions| {
+            positions.len() >= minimum_frequency && positions.len() <= maximum_frequency
+        });
+
+        Ok(words)
+    }
+
+    /// Gets the words in the title of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `title`: The title of the page.
+    /// * `language`: The language of the page.
+    /// * `dictionary`: The stop words, protected words and tokenizer.
+    ///
+    /// # Returns
+    ///
+    /// * `HashMap<String, Vec<usize>>`: The words in the title, with their positions.
+    ///
+    /// # Notes
+    ///
+    /// * Unlike the body, the words aren't filtered by frequency, since every word in a title counts.
+    fn get_title_words(
+        title: &str,
+        language: Option<&str>,
+        dictionary: &Dictionary,
+    ) -> HashMap<String, Vec<usize>> {
+        utils::words::extract_positions(title, Self::get_algorithm(language), dictionary)
+    }
+
+    /// Gets the `h1`, `h2` and `h3` headings of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `html`: The HTML document to get the headings from.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<String>`: The text of each distinct heading, in the order they're on the page.
+    ///
+    /// # Panics
+    ///
+    /// * If the heading selector fails to parse.
+    ///
+    /// # Notes
+    ///
+    /// * At most `MAXIMUM_HEADINGS` headings are kept, so a page can't have all of its text weighted as headings.
+    #[allow(clippy::expect_used)]
+    fn get_headings(html: &str) -> Vec<String> {
+        let document = Html::parse_document(html);
+
+        let mut headings = Vec::<String>::new();
+        for element in document
+            .select(&Selector::parse("h1, h2, h3").expect("Failed to parse heading selector!"))
+        {
+            let heading = text::extract(element);
+            if heading.is_empty() || headings.contains(&heading) {
+                continue;
+            }
+
+            headings.push(heading);
+            if headings.len() >= MAXIMUM_HEADINGS {
+                break;
+            }
         }
 
-        // Get the text from the body.
-        let selector = Selector::parse("body").expect("Failed to parse body selector!");
-        let element = document
-            .select(&selector)
-            .next()
-            .expect("Failed to get body!");
-        let text = &element.text().collect::<Vec<_>>().join(" ");
+        headings
+    }
+
+    /// Gets the words in the headings of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `headings`: The headings of the page, from `get_headings`.
+    /// * `language`: The language of the page.
+    /// * `dictionary`: The stop words, protected words and tokenizer.
+    ///
+    /// # Returns
+    ///
+    /// * `HashMap<String, Vec<usize>>`: The words of the headings, with their positions.
+    ///
+    /// # Notes
+    ///
+    /// * The words are also in the body, so a match in a heading counts in both fields.
+    /// * Like the title, the words aren't filtered by frequency, since headings are short.
+    fn get_heading_words(
+        headings: &[String],
+        language: Option<&str>,
+        dictionary: &Dictionary,
+    ) -> HashMap<String, Vec<usize>> {
+        utils::words::extract_positions(
+            &headings.join("\n"),
+            Self::get_algorithm(language),
+            dictionary,
+        )
+    }
+
+    /// Gets the words in the alt text and captions of the images on a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `images`: The images on the page, from `get_images`.
+    /// * `language`: The language of the page.
+    /// * `dictionary`: The stop words, protected words and tokenizer.
+    ///
+    /// # Returns
+    ///
+    /// * `HashMap<String, Vec<usize>>`: The words of the images, with their positions.
+    ///
+    /// # Notes
+    ///
+    /// * A caption shared by the images of a figure is only counted once.
+    /// * Like the title, the words aren't filtered by frequency, since alt text and captions are short.
+    fn get_image_words(
+        images: &[(Url, Option<String>, Option<String>)],
+        language: Option<&str>,
+        dictionary: &Dictionary,
+    ) -> HashMap<String, Vec<usize>> {
+        let mut texts = Vec::<&str>::new();
+        for text in images
+            .iter()
+            .flat_map(|(_, alt, caption)| [alt, caption])
+            .flatten()
+        {
+            if !texts.contains(&text.as_str()) {
+                texts.push(text);
+            }
+        }
+
+        utils::words::extract_positions(
+            &texts.join("\n"),
+            Self::get_algorithm(language),
+            dictionary,
+        )
+    }
 
-        // Get the language of the page, or default to English.
-        let language = language.unwrap_or("en");
-        let language = match language {
+    /// Gets the stemming algorithm for the language of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `language`: The normalized language of the page, like `da`.
+    ///
+    /// # Returns
+    ///
+    /// * `Algorithm`: The algorithm of the language, or English if it's unknown.
+    fn get_algorithm(language: Option<&str>) -> Algorithm {
+        match language.unwrap_or("en") {
             "ar" => Algorithm::Arabic,
             "da" => Algorithm::Danish,
             "nl" => Algorithm::Dutch,
@@ -473,23 +2334,19 @@ impl Website {
             "sv" => Algorithm::Swedish,
             "tr" => Algorithm::Turkish,
             _ => Algorithm::English,
-        };
-
-        // Get the words from the text, stem, filter and count them.
-        let mut words = utils::words::extract(text, language);
-
-        words.retain(|_, frequency| {
-            *frequency >= minimum_frequency && *frequency <= maximum_frequency
-        });
-        words.retain(|word, _| word.len() >= minimum_length && word.len() <= maximum_length);
-
-        Ok(words)
+        }
     }
 }
 
 #[cfg(test)]
 mod tests {
     use super::*;
+    use crate::hosts::{Credentials, Override};
+    use common::database::store::Postgres;
+    use common::utils::compression::Codec;
+    use reqwest::header::HeaderValue;
+    use tokio::io::{AsyncReadExt, AsyncWriteExt};
+    use tokio::net::TcpListener;
 
     #[test]
     #[allow(clippy::expect_used)]
@@ -510,9 +2367,22 @@ mod tests {
             </html>
         "#;
 
+        let text = Website::get_text(html);
+        assert_eq!(
+            text,
+            "Hello, world! This is a test. This is yet another test. This is a third test. This is the final test."
+        );
         assert_eq!(
-            Website::get_words(html, None, utils::env::scraper::get_word_boundaries())
-                .expect("Failed to get words!"),
+            Website::get_words(
+                &text,
+                None,
+                utils::env::scraper::get_word_boundaries(),
+                &Dictionary::default()
+            )
+            .expect("Failed to get words!")
+            .into_iter()
+            .map(|(word, positions)| (word, positions.len()))
+            .collect::<HashMap<_, _>>(),
             vec![
                 ("hello".into(), 1), // "hello" is counted once.
                 ("world".into(), 1), // "world" is counted once.
@@ -529,4 +2399,748 @@ mod tests {
             .collect::<HashMap<_, _>>()
         );
     }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_extract_links() {
+        let base = Url::parse("https://example.com/").expect("Failed to parse URL!");
+        let schemes = vec!["http".to_string(), "https".to_string()];
+        let host_aliases = HostAliases::new(&["www.*".to_string()]);
+        let tracking_parameters = TrackingParameters::new(&["utm_*".to_string()]);
+
+        // A link farm, with 50,000 links to 2,000 pages between a menu and a footer repeating it on the www host.
+        // Every other link to a page is tagged with a tracking parameter.
+        let menu = |host| {
+            (0..10)
+                .map(|link| format!(r#"<a href="https://{host}/menu/{link}">Menu</a>"#))
+                .collect::<String>()
+        };
+        let content = (0..50_000)
+            .map(|link| {
+                let tag = if link / 2_000 % 2 == 0 {
+                    "?utm_source=farm"
+                } else {
+                    ""
+                };
+
+                format!(
+                    r#"<a href="https://example.com/page/{}{tag}">Page</a>"#,
+                    link % 2_000
+                )
+            })
+            .collect::<String>();
+        let html = format!(
+            "<html><body><nav>{}</nav><main>{content}</main><footer>{}</footer></body></html>",
+            menu("example.com"),
+            menu("www.example.com")
+        );
+
+        // The content is kept before the menu, in the order it's linked to, and every link is counted.
+        let links = Web::extract_links(
+            &html,
+            &base,
+            &schemes,
+            &host_aliases,
+            &tracking_parameters,
+            Some(1_000),
+        )
+        .expect("Failed to extract links!");
+        assert_eq!(links.counts.len(), 1_000);
+        assert_eq!(links.dropped, 1_010);
+        assert_eq!(
+            links.counts[0],
+            (
+                Url::parse("https://example.com/page/0").expect("Failed to parse URL!"),
+                25
+            )
+        );
+        assert_eq!(links.counts[999].0.as_str(), "https://example.com/page/999");
+        assert!(links
+            .counts
+            .iter()
+            .all(|(url, count)| url.path().starts_with("/page/") && *count == 25));
+
+        let links = Web::extract_links(
+            &html,
+            &base,
+            &schemes,
+            &host_aliases,
+            &tracking_parameters,
+            None,
+        )
+        .expect("Failed to extract links!");
+        // The footer links to the same pages as the menu, through the www host.
+        assert_eq!(links.counts.len(), 2_010);
+        assert_eq!(links.dropped, 0);
+        assert_eq!(
+            links.counts[2_000],
+            (
+                Url::parse("https://example.com/menu/0").expect("Failed to parse URL!"),
+                2
+            )
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_extract_qualified_links() {
+        let base = Url::parse("https://example.com/").expect("Failed to parse URL!");
+        let schemes = vec!["http".to_string(), "https".to_string()];
+        let html = r#"
+            <html>
+                <body>
+                    <a href="https://example.com/article" rel="noopener">Article</a>
+                    <a href="https://spam.example/" rel="NoFollow">Comment</a>
+                    <a href="https://ads.example/" rel="sponsored noopener">Ad</a>
+                    <a href="https://example.com/profile" rel="ugc">Profile</a>
+                    <a href="https://example.com/profile">Profile</a>
+                </body>
+            </html>
+        "#;
+        let url = |url| Url::parse(url).expect("Failed to parse URL!");
+
+        let links = Web::extract_links(
+            html,
+            &base,
+            &schemes,
+            &HostAliases::default(),
+            &TrackingParameters::default(),
+            None,
+        )
+        .expect("Failed to extract links!");
+        // A link is only qualified if every link to it is.
+        assert_eq!(
+            links.qualified,
+            HashSet::from([url("https://spam.example/"), url("https://ads.example/")])
+        );
+
+        assert!(links.is_queued(&url("https://spam.example/"), QualifiedLinks::Unranked));
+        assert!(!links.is_queued(&url("https://spam.example/"), QualifiedLinks::Skip));
+        assert!(links.is_queued(&url("https://example.com/profile"), QualifiedLinks::Skip));
+
+        assert_eq!(
+            links.clone().get_ranked(QualifiedLinks::Unranked),
+            vec![
+                (url("https://example.com/article"), 1),
+                (url("https://example.com/profile"), 2),
+            ]
+        );
+        assert_eq!(
+            links.clone().get_ranked(QualifiedLinks::Follow),
+            links.counts
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_extract_anchor_texts() {
+        let base = Url::parse("https://example.com/").expect("Failed to parse URL!");
+        let schemes = vec!["http".to_string(), "https".to_string()];
+        let html = r#"
+            <html>
+                <body>
+                    <a href="/rust">The <b>Rust</b>   language</a>
+                    <a href="/rust">Rust</a>
+                    <a href="/rust">Rust</a>
+                    <a href="/logo"><img src="/logo.png" alt="Our  logo"></a>
+                    <a href="/empty"><img src="/empty.png"></a>
+                    <a href="https://ads.example/" rel="sponsored">Buy now</a>
+                </body>
+            </html>
+        "#;
+        let url = |url| Url::parse(url).expect("Failed to parse URL!");
+
+        let links = Web::extract_links(
+            html,
+            &base,
+            &schemes,
+            &HostAliases::default(),
+            &TrackingParameters::default(),
+            None,
+        )
+        .expect("Failed to extract links!");
+        // Distinct texts are kept one per line, falling back to the alt text of images.
+        assert_eq!(
+            links.anchors,
+            HashMap::from([
+                (
+                    url("https://example.com/rust"),
+                    "The Rust language\nRust".to_string()
+                ),
+                (url("https://example.com/logo"), "Our logo".to_string()),
+                (url("https://ads.example/"), "Buy now".to_string()),
+            ])
+        );
+        assert!(!links
+            .get_ranked_anchors(QualifiedLinks::Unranked)
+            .contains_key(&url("https://ads.example/")));
+        assert_eq!(
+            links.get_ranked_anchors(QualifiedLinks::Follow),
+            links.anchors
+        );
+
+        // Texts that don't fit are left out.
+        let mut texts = "a".repeat(MAXIMUM_ANCHOR_TEXT_LENGTH - 2);
+        Web::add_anchor_text(&mut texts, "bc");
+        assert_eq!(texts.len(), MAXIMUM_ANCHOR_TEXT_LENGTH - 2);
+        Web::add_anchor_text(&mut texts, "b");
+        assert!(texts.ends_with("\nb"));
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_amp_canonical() {
+        let url = Url::parse("https://example.com/amp/article").expect("Failed to parse URL!");
+        let amp_html = r#"
+            <html ⚡ lang="en">
+                <head>
+                    <link rel="canonical" href="/article">
+                </head>
+                <body>
+                    <p>This is the stripped-down version.</p>
+                </body>
+            </html>
+        "#;
+        let html = r#"
+            <html lang="en">
+                <head>
+                    <link rel="canonical" href="/article">
+                </head>
+                <body>
+                    <p>This is the full version.</p>
+                </body>
+            </html>
+        "#;
+
+        assert_eq!(
+            Website::get_amp_canonical(amp_html, &url),
+            Some(Url::parse("https://example.com/article").expect("Failed to parse URL!"))
+        );
+        assert_eq!(
+            Website::get_amp_canonical(&amp_html.replace('⚡', "amp"), &url),
+            Some(Url::parse("https://example.com/article").expect("Failed to parse URL!"))
+        );
+        assert_eq!(Website::get_amp_canonical(html, &url), None);
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_variant_canonical() {
+        let url = Url::parse("https://example.com/shoes?sort=price").expect("Failed to parse URL!");
+        let allowed_schemes = vec!["http".to_string(), "https".to_string()];
+        let host_aliases = HostAliases::new(&["www.*".to_string()]);
+        let tracking_parameters = TrackingParameters::new(&["utm_*".to_string()]);
+        let canonical = |href: &str| {
+            Website::get_variant_canonical(
+                &format!(r#"<html><head><link rel="canonical" href="{href}"></head></html>"#),
+                &url,
+                &allowed_schemes,
+                &host_aliases,
+                &tracking_parameters,
+            )
+            .map(String::from)
+        };
+
+        assert_eq!(
+            canonical("/shoes"),
+            Some("https://example.com/shoes".into())
+        );
+        assert_eq!(
+            canonical("https://www.example.com/shoes/?utm_source=feed"),
+            Some("https://example.com/shoes".into())
+        );
+
+        // Pages that are their own canonical, or declare one on another host, are indexed as they are.
+        assert_eq!(canonical("?sort=price#top"), None);
+        assert_eq!(canonical("https://other.example/shoes"), None);
+        assert_eq!(canonical("javascript:void(0)"), None);
+        assert_eq!(
+            Website::get_variant_canonical(
+                "<html></html>",
+                &url,
+                &allowed_schemes,
+                &host_aliases,
+                &tracking_parameters,
+            ),
+            None
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_next() {
+        let url = Url::parse("https://example.com/blog?page=1").expect("Failed to parse URL!");
+        let allowed_schemes = vec!["http".to_string(), "https".to_string()];
+        let html = |next: &str| {
+            format!(r#"<html><head><link rel="prev start next" href="{next}"></head></html>"#)
+        };
+
+        assert_eq!(
+            Website::get_next(&html("?page=2"), &url, &allowed_schemes),
+            Some(Url::parse("https://example.com/blog?page=2").expect("Failed to parse URL!"))
+        );
+        assert_eq!(
+            Website::get_next(&html("?page=1"), &url, &allowed_schemes),
+            None
+        );
+        assert_eq!(
+            Website::get_next(&html("javascript:next()"), &url, &allowed_schemes),
+            None
+        );
+        assert_eq!(
+            Website::get_next("<html></html>", &url, &allowed_schemes),
+            None
+        );
+    }
+
+    #[test]
+    fn test_get_headings() {
+        let html = r#"
+            <html>
+                <body>
+                    <h1>Learning <em>Rust</em></h1>
+                    <h2>Installing</h2>
+                    <h4>Not indexed</h4>
+                    <h3>  </h3>
+                    <h2>Installing</h2>
+                    <h3>Hello, <code>world</code>!</h3>
+                </body>
+            </html>
+        "#;
+
+        // Empty and repeated headings are left out, and only h1 to h3 are kept.
+        assert_eq!(
+            Website::get_headings(html),
+            vec![
+                "Learning Rust".to_string(),
+                "Installing".to_string(),
+                "Hello, world!".to_string(),
+            ]
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_images() {
+        let url = Url::parse("https://example.com/posts/1").expect("Failed to parse URL!");
+        let allowed_schemes = vec!["http".to_string(), "https".to_string()];
+        let html = r#"
+            <html>
+                <body>
+                    <figure>
+                        <img src="/images/cat.png" alt="  A sleeping   cat ">
+                        <figcaption>Our cat, <em>Felix</em>.</figcaption>
+                    </figure>
+                    <img src="../images/cat.png" alt="The same cat">
+                    <img src="dog.png">
+                    <img src="javascript:alert(1)" alt="Not an image">
+                </body>
+            </html>
+        "#;
+
+        assert_eq!(
+            Website::get_images(html, &url, &allowed_schemes),
+            vec![
+                (
+                    Url::parse("https://example.com/images/cat.png").expect("Failed to parse URL!"),
+                    Some("A sleeping cat".into()),
+                    Some("Our cat, Felix.".into()),
+                ),
+                (
+                    Url::parse("https://example.com/posts/dog.png").expect("Failed to parse URL!"),
+                    None,
+                    None,
+                ),
+            ]
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_image_words() {
+        let url = Url::parse("https://example.com/posts/1").expect("Failed to parse URL!");
+        let allowed_schemes = vec!["http".to_string(), "https".to_string()];
+        let html = r#"
+            <html>
+                <body>
+                    <figure>
+                        <img src="/images/otter.png" alt="Sleeping otters">
+                        <img src="/images/river.png" alt="A river">
+                        <figcaption>Otters in the river</figcaption>
+                    </figure>
+                    <p>Nothing about animals here.</p>
+                </body>
+            </html>
+        "#;
+
+        let images = Website::get_images(html, &url, &allowed_schemes);
+        let words = Website::get_image_words(&images, None, &Dictionary::default())
+            .into_iter()
+            .map(|(word, positions)| (word, positions.len()))
+            .collect::<HashMap<_, _>>();
+
+        // The alt text and the caption are indexed stemmed like the body, and a shared caption is only counted once.
+        assert_eq!(words.get("otter"), Some(&2));
+        assert_eq!(words.get("river"), Some(&2));
+        assert_eq!(words.get("sleep"), Some(&1));
+
+        // The text of the page itself isn't image text.
+        assert_eq!(words.get("anim"), None);
+    }
+
+    #[test]
+    fn test_get_validator() {
+        let mut headers = HeaderMap::new();
+        headers.insert(ETAG, HeaderValue::from_static("\"abc\""));
+        headers.insert(
+            LAST_MODIFIED,
+            HeaderValue::from_static("Wed, 21 Oct 2015 07:28:00 GMT"),
+        );
+
+        assert_eq!(
+            Web::get_validator(&headers, &ETAG, MAXIMUM_ETAG_LENGTH),
+            Some("\"abc\"".into())
+        );
+        assert_eq!(
+            Web::get_validator(&headers, &LAST_MODIFIED, MAXIMUM_LAST_MODIFIED_LENGTH),
+            Some("Wed, 21 Oct 2015 07:28:00 GMT".into())
+        );
+
+        // Headers too long to store aren't sent back.
+        assert_eq!(Web::get_validator(&headers, &LAST_MODIFIED, 10), None);
+        assert_eq!(
+            Web::get_validator(&HeaderMap::new(), &ETAG, MAXIMUM_ETAG_LENGTH),
+            None
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_location() {
+        let url = Url::parse("https://example.com/old/page").expect("Failed to parse URL!");
+        let headers = |location: &'static str| {
+            let mut headers = HeaderMap::new();
+            headers.insert(LOCATION, HeaderValue::from_static(location));
+
+            headers
+        };
+
+        assert_eq!(
+            Web::get_location(StatusCode::MOVED_PERMANENTLY, &headers("/new/page"), &url),
+            Some(Url::parse("https://example.com/new/page").expect("Failed to parse URL!"))
+        );
+        assert_eq!(
+            Web::get_location(
+                StatusCode::PERMANENT_REDIRECT,
+                &headers("https://www.example.org/"),
+                &url
+            ),
+            Some(Url::parse("https://www.example.org/").expect("Failed to parse URL!"))
+        );
+
+        // Only redirects with a location are followed.
+        assert_eq!(
+            Web::get_location(StatusCode::NOT_MODIFIED, &headers("/new/page"), &url),
+            None
+        );
+        assert_eq!(
+            Web::get_location(StatusCode::OK, &headers("/new/page"), &url),
+            None
+        );
+        assert_eq!(
+            Web::get_location(StatusCode::FOUND, &HeaderMap::new(), &url),
+            None
+        );
+    }
+
+    /// Redirects `/` to `/landing` on `location`, recording the path of every request and whether it was authorized.
+    #[allow(clippy::expect_used)]
+    async fn serve(
+        location: impl Fn(u16) -> String + Send + 'static,
+    ) -> (u16, Arc<std::sync::Mutex<Vec<(String, bool)>>>) {
+        let listener = TcpListener::bind("127.0.0.1:0")
+            .await
+            .expect("Failed to bind listener!");
+        let port = listener
+            .local_addr()
+            .expect("Failed to get address!")
+            .port();
+        let requests = Arc::new(std::sync::Mutex::new(Vec::new()));
+
+        let recorded = requests.clone();
+        tokio::spawn(async move {
+            while let Ok((mut stream, _)) = listener.accept().await {
+                let mut buffer = [0; 4096];
+                let read = stream.read(&mut buffer).await.unwrap_or_default();
+                let request = String::from_utf8_lossy(&buffer[..read]).to_lowercase();
+
+                let path = request
+                    .split_whitespace()
+                    .nth(1)
+                    .unwrap_or_default()
+                    .to_string();
+                let authorized = request.contains("\r\nauthorization: basic ");
+                recorded
+                    .lock()
+                    .expect("Failed to lock requests!")
+                    .push((path.clone(), authorized));
+
+                let response = if path == "/" {
+                    format!(
+                        "HTTP/1.1 302 Found\r\nLocation: {}/landing\r\nContent-Length: 0\r\nConnection: close\r\n\r\n",
+                        location(port)
+                    )
+                } else {
+                    "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n".to_string()
+                };
+                let _ = stream.write_all(response.as_bytes()).await;
+            }
+        });
+
+        (port, requests)
+    }
+
+    #[tokio::test]
+    #[allow(clippy::expect_used)]
+    async fn test_fetch_redirects() {
+        let overrides = Overrides::new(HashMap::from([(
+            "127.0.0.1".to_string(),
+            Override {
+                credentials: Some(Credentials::Basic {
+                    username: "rse".into(),
+                    password: Some("secret".into()),
+                }),
+                exclude_from_search: true,
+                allow_http: true,
+            },
+        )]));
+        let web = Web::new(
+            client::build().expect("Failed to build HTTP clients!"),
+            Evaluator::new(
+                vec!["http".to_string(), "https".to_string()],
+                None,
+                "RSE/1.0.0".to_string(),
+                std::time::Duration::ZERO,
+                Vec::new(),
+                HostAliases::new(&[]),
+                TrackingParameters::new(&[]),
+                Vec::new(),
+                Vec::new(),
+            ),
+            Dictionary::default(),
+            Arc::new(Usage::new("test".to_string())),
+            Arc::new(Throttle::load()),
+            overrides,
+            Arc::new(Writer::new(
+                1,
+                0,
+                Codec::default(),
+                Arc::new(Postgres::new(String::new())),
+            )),
+            Arc::new(CrawlLog::new(1)),
+        );
+
+        // The hops are allowed by robots.txt without fetching it.
+        for host in ["127.0.0.1", "localhost"] {
+            web.robots_cache
+                .insert(format!("http://{host}/robots.txt"), RobotsFile::parse(""));
+        }
+
+        for (same_host, (port, requests)) in [
+            (true, serve(|port| format!("http://127.0.0.1:{port}")).await),
+            (
+                false,
+                serve(|port| format!("http://localhost:{port}")).await,
+            ),
+        ] {
+            let url =
+                Url::parse(&format!("http://127.0.0.1:{port}/")).expect("Failed to parse URL!");
+            let (response, redirects) = web
+                .fetch(&url, None, None)
+                .await
+                .expect("Failed to fetch URL!");
+
+            // The credentials are only sent to the hop on the same host.
+            let requests = requests.lock().expect("Failed to lock requests!").clone();
+            assert_eq!(
+                requests,
+                vec![("/".to_string(), true), ("/landing".to_string(), same_host)]
+            );
+            assert_eq!(redirects, vec![(url, 302)]);
+
+            assert_eq!(
+                web.overrides.get_flags(response.url()),
+                (same_host, same_host)
+            );
+        }
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_has_unknown_extension() {
+        for (url, unknown) in [
+            ("https://example.com/", false),
+            ("https://example.com/about", false),
+            ("https://example.com/index.HTML", false),
+            ("https://example.com/search.php?q=rust", false),
+            ("https://example.com/files/image.iso", true),
+            ("https://example.com/v1.2/data.bin", true),
+            ("https://example.com/v1.2/", false),
+        ] {
+            let url = Url::parse(url).expect("Failed to parse URL!");
+
+            assert_eq!(Web::has_unknown_extension(&url), unknown, "{url}");
+        }
+    }
+
+    #[test]
+    fn test_detect_language() {
+        assert_eq!(
+            Website::detect_language(
+                "The quick brown fox jumps over the lazy dog, and then it runs back into the forest where it lives with its family."
+            ),
+            Some("en".into())
+        );
+        assert_eq!(
+            Website::detect_language(
+                "Der schnelle braune Fuchs springt über den faulen Hund und läuft dann zurück in den Wald, wo er mit seiner Familie lebt."
+            ),
+            Some("de".into())
+        );
+        assert_eq!(Website::detect_language(""), None);
+    }
+
+    #[test]
+    fn test_get_meta_directives() {
+        let html = r#"
+            <html>
+                <head>
+                    <meta name="robots" content="noarchive">
+                    <meta name="RSE" content="nofollow">
+                    <meta name="googlebot" content="noindex">
+                </head>
+            </html>
+        "#;
+
+        assert_eq!(
+            Website::get_meta_directives(html, "RSE/1.0.0"),
+            Directives {
+                noindex: false,
+                nofollow: true,
+                noarchive: true,
+            }
+        );
+        assert_eq!(
+            Website::get_meta_directives("<html></html>", "RSE/1.0.0"),
+            Directives::default()
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_dates() {
+        let now = SystemTime::UNIX_EPOCH + std::time::Duration::from_secs(1_715_495_400);
+        let day = |day| {
+            Some(
+                SystemTime::UNIX_EPOCH
+                    + std::time::Duration::from_secs(1_714_521_600 + (day - 1) * 24 * 60 * 60),
+            )
+        };
+
+        let json_ld = r#"<script type="application/ld+json">{"@type": "Article", "datePublished": "2024-05-01T00:00:00Z", "dateModified": "2024-05-02"}</script>"#;
+        let meta = r#"<meta property="article:published_time" content="2024-05-03"><meta property="article:modified_time" content="2024-05-04">"#;
+        let time = r#"<article><time datetime="2024-05-05">May 5</time></article>"#;
+        let future = r#"<meta property="article:published_time" content="2099-01-01"><time datetime="1990-01-01"></time>"#;
+        let meta_and_json_ld = format!("{meta}{json_ld}");
+        let time_and_meta = format!("{time}{meta}");
+        let future_and_time = format!("{future}{time}");
+
+        // The name of the case, the head and body of the page, its URL, and the dates of the page.
+        for (name, html, url, published_at, modified_at) in [
+            ("JSON-LD", json_ld, "https://example.com/", day(1), day(2)),
+            ("meta tags", meta, "https://example.com/", day(3), day(4)),
+            ("time element", time, "https://example.com/", day(5), None),
+            ("URL", "", "https://example.com/2024/05/06/", day(6), None),
+            (
+                "none",
+                "<p>No dates here.</p>",
+                "https://example.com/",
+                None,
+                None,
+            ),
+            ("implausible", future, "https://example.com/", None, None),
+            (
+                "JSON-LD before meta tags",
+                meta_and_json_ld.as_str(),
+                "https://example.com/2024/05/06/",
+                day(1),
+                day(2),
+            ),
+            (
+                "meta tags before time element",
+                time_and_meta.as_str(),
+                "https://example.com/2024/05/06/",
+                day(3),
+                day(4),
+            ),
+            (
+                "time element before URL",
+                time,
+                "https://example.com/2024/05/06/",
+                day(5),
+                None,
+            ),
+            (
+                "implausible dates fall through",
+                future_and_time.as_str(),
+                "https://example.com/",
+                day(5),
+                None,
+            ),
+        ] {
+            let url = Url::parse(url).expect("Failed to parse URL!");
+            let html = format!("<html><head></head><body>{html}</body></html>");
+
+            assert_eq!(
+                Website::get_dates(&html, &url, now),
+                Dates {
+                    published_at,
+                    modified_at,
+                },
+                "{name}"
+            );
+        }
+    }
+
+    #[test]
+    fn test_get_structured_data() {
+        let html = format!(
+            r#"
+            <html>
+                <head>
+                    <script type="application/ld+json">{{"@type": "Recipe", "name": "Pancakes"}}</script>
+                    <script type="application/ld+json">{{"@type": "Product", "name": </script>
+                    <script type="application/ld+json">{{"@type": "Product", "description": "{}"}}</script>
+                    <script type="application/ld+json">[{{"@type": "WebSite"}}, {{"@type": "Organization", "name": "Example"}}]</script>
+                </head>
+            </html>
+        "#,
+            "a".repeat(MAXIMUM_STRUCTURED_DATA_SIZE)
+        );
+
+        // Invalid blocks and entities that are too big are skipped.
+        assert_eq!(
+            Website::get_structured_data(&html),
+            vec![
+                (
+                    Kind::Recipe,
+                    r#"{"@type":"Recipe","name":"Pancakes"}"#.to_string()
+                ),
+                (
+                    Kind::Organization,
+                    r#"{"@type":"Organization","name":"Example"}"#.to_string()
+                ),
+            ]
+        );
+    }
 }
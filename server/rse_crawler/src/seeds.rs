@@ -0,0 +1,144 @@
+use common::utils::env::crawler::SeedSelection;
+use common::utils::env::data::Seed;
+use rand::Rng;
+use std::collections::HashMap;
+use url::Url;
+
+/// Orders the seed URLs to queue them in.
+///
+/// # Arguments
+///
+/// * `seeds`: The seed URLs, in the order they're listed.
+/// * `selection`: How to order the seed URLs.
+/// * `rng`: The random number generator used for the weighted order.
+///
+/// # Returns
+///
+/// * `Vec<Url>` - The seed URLs, in the order to queue them in.
+pub fn order<R: Rng>(seeds: Vec<Seed>, selection: SeedSelection, rng: &mut R) -> Vec<Url> {
+    match selection {
+        SeedSelection::Weighted => order_weighted(seeds, rng),
+        SeedSelection::RoundRobin => order_round_robin(seeds),
+    }
+}
+
+/// Shuffles the seed URLs, so each one is more likely to come before another the higher its weight is.
+///
+/// # Arguments
+///
+/// * `seeds`: The seed URLs.
+/// * `rng`: The random number generator.
+///
+/// # Returns
+///
+/// * `Vec<Url>` - The shuffled seed URLs.
+///
+/// # Notes
+///
+/// * Each seed URL gets the key `u^(1 / weight)` for a uniform `u` in `[0, 1)`, and the URLs are sorted by it, highest first.
+fn order_weighted<R: Rng>(seeds: Vec<Seed>, rng: &mut R) -> Vec<Url> {
+    let mut keyed = seeds
+        .into_iter()
+        .map(|seed| (rng.gen::<f64>().powf(1.0 / seed.weight), seed.url))
+        .collect::<Vec<_>>();
+    keyed.sort_by(|(a, _), (b, _)| b.total_cmp(a));
+
+    keyed.into_iter().map(|(_, url)| url).collect()
+}
+
+/// Interleaves the seed URLs by host, so every host gets its first seed URL crawled before any gets its second.
+///
+/// # Arguments
+///
+/// * `seeds`: The seed URLs, in the order they're listed.
+///
+/// # Returns
+///
+/// * `Vec<Url>` - The seed URLs, one per host in turn, in the order the hosts are first listed.
+fn order_round_robin(seeds: Vec<Seed>) -> Vec<Url> {
+    let mut places = HashMap::new();
+    let mut hosts: Vec<Vec<Url>> = Vec::new();
+    for seed in seeds {
+        let host = seed.url.host_str().unwrap_or_default().to_string();
+        let place = *places.entry(host).or_insert_with(|| {
+            hosts.push(Vec::new());
+
+            hosts.len() - 1
+        });
+
+        hosts[place].push(seed.url);
+    }
+
+    let rounds = hosts.iter().map(Vec::len).max().unwrap_or_default();
+    let mut ordered = Vec::new();
+    for round in 0..rounds {
+        ordered.extend(hosts.iter().filter_map(|urls| urls.get(round)).cloned());
+    }
+
+    ordered
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use rand::rngs::StdRng;
+    use rand::SeedableRng;
+
+    #[allow(clippy::expect_used)]
+    fn seed(url: &str, weight: f64) -> Seed {
+        Seed {
+            url: Url::parse(url).expect("Failed to parse URL!"),
+            weight,
+        }
+    }
+
+    #[test]
+    fn test_order_weighted() {
+        let mut rng = StdRng::seed_from_u64(42);
+        let seeds = vec![
+            seed("https://light.com/", 1.0),
+            seed("https://heavy.com/", 9.0),
+        ];
+
+        // The heavy seed should come first about 90% of the time.
+        let mut heavy_first = 0;
+        for _ in 0..1_000 {
+            let ordered = order(seeds.clone(), SeedSelection::Weighted, &mut rng);
+            assert_eq!(ordered.len(), 2);
+
+            if ordered[0].as_str() == "https://heavy.com/" {
+                heavy_first += 1;
+            }
+        }
+
+        assert!((850..950).contains(&heavy_first), "{heavy_first}");
+    }
+
+    #[test]
+    fn test_order_round_robin() {
+        let mut rng = StdRng::seed_from_u64(42);
+        let seeds = vec![
+            seed("https://a.com/1", 1.0),
+            seed("https://a.com/2", 5.0),
+            seed("https://a.com/3", 1.0),
+            seed("https://b.com/1", 1.0),
+            seed("https://c.com/1", 1.0),
+            seed("https://c.com/2", 1.0),
+        ];
+
+        assert_eq!(
+            order(seeds, SeedSelection::RoundRobin, &mut rng)
+                .iter()
+                .map(Url::as_str)
+                .collect::<Vec<_>>(),
+            vec![
+                "https://a.com/1",
+                "https://b.com/1",
+                "https://c.com/1",
+                "https://a.com/2",
+                "https://c.com/2",
+                "https://a.com/3",
+            ]
+        );
+    }
+}
@@ -0,0 +1,287 @@
+use scraper::{ElementRef, Node};
+
+/// The elements whose text isn't shown to readers, so it's left out.
+///
+/// # Notes
+///
+/// * `noscript` is parsed as raw markup, since scripting is enabled when parsing.
+const SKIPPED_ELEMENTS: [&str; 4] = ["script", "style", "template", "noscript"];
+
+/// The elements that separate the text before and after them, like a line break would.
+const BLOCK_ELEMENTS: [&str; 46] = [
+    "address",
+    "article",
+    "aside",
+    "blockquote",
+    "body",
+    "br",
+    "caption",
+    "dd",
+    "details",
+    "dialog",
+    "div",
+    "dl",
+    "dt",
+    "fieldset",
+    "figcaption",
+    "figure",
+    "footer",
+    "form",
+    "h1",
+    "h2",
+    "h3",
+    "h4",
+    "h5",
+    "h6",
+    "header",
+    "hgroup",
+    "hr",
+    "li",
+    "main",
+    "nav",
+    "ol",
+    "option",
+    "p",
+    "pre",
+    "section",
+    "summary",
+    "table",
+    "tbody",
+    "td",
+    "textarea",
+    "tfoot",
+    "th",
+    "thead",
+    "title",
+    "tr",
+    "ul",
+];
+
+/// A step of the traversal of an element.
+enum Visit<'a> {
+    Element(ElementRef<'a>),
+    Text(&'a str),
+    Break,
+}
+
+/// Gets the text of an element, the way a reader sees it.
+///
+/// # Arguments
+///
+/// * `element`: The element to get the text of.
+///
+/// # Returns
+///
+/// * `String`: The text of the element, with its whitespace collapsed.
+///
+/// # Notes
+///
+/// * Every node is visited once, without recursing, so deeply nested pages can't overflow the stack.
+/// * Text next to an inline element is joined with its text, so `Hel<b>lo</b>` is one word.
+/// * Block elements, `br`, and elements with no text between them, like `<b>Hello</b><i>World</i>`, separate words.
+/// * Scripts, styles, templates and `noscript` elements are skipped along with everything in them.
+#[must_use]
+pub fn extract(element: ElementRef) -> String {
+    let mut text = String::new();
+    let mut visits = vec![Visit::Element(element)];
+    while let Some(visit) = visits.pop() {
+        let element = match visit {
+            Visit::Element(element) => element,
+            Visit::Text(value) => {
+                text.push_str(value);
+
+                continue;
+            }
+            Visit::Break => {
+                text.push(' ');
+
+                continue;
+            }
+        };
+
+        let name = element.value().name();
+        if SKIPPED_ELEMENTS.contains(&name) {
+            continue;
+        }
+
+        let is_block = BLOCK_ELEMENTS.contains(&name);
+        if is_block {
+            text.push(' ');
+            visits.push(Visit::Break);
+        }
+
+        // Elements right next to each other, like the links of a menu, are separated too.
+        let mut children = Vec::new();
+        let mut follows_element = false;
+        for child in element.children() {
+            if let Some(child) = ElementRef::wrap(child) {
+                if follows_element {
+                    children.push(Visit::Break);
+                }
+
+                children.push(Visit::Element(child));
+                follows_element = true;
+            } else if let Node::Text(value) = child.value() {
+                children.push(Visit::Text(value));
+                follows_element = false;
+            }
+        }
+
+        // The children are pushed last to first, so they're visited first to last.
+        visits.extend(children.into_iter().rev());
+    }
+
+    collapse(&text)
+}
+
+/// Collapses the runs of whitespace in a text into single spaces, trimming it.
+///
+/// # Arguments
+///
+/// * `text`: The text to collapse.
+///
+/// # Returns
+///
+/// * `String`: The collapsed text.
+fn collapse(text: &str) -> String {
+    text.split_whitespace().collect::<Vec<_>>().join(" ")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use scraper::{Html, Selector};
+
+    #[allow(clippy::expect_used)]
+    fn get_text(html: &str, selector: &str) -> String {
+        let document = Html::parse_document(html);
+        let element = document
+            .select(&Selector::parse(selector).expect("Failed to parse selector!"))
+            .next()
+            .expect("Failed to find element!");
+
+        extract(element)
+    }
+
+    #[test]
+    fn test_inline_elements() {
+        assert_eq!(
+            get_text("<p><b>Hello</b><i>World</i></p>", "body"),
+            "Hello World"
+        );
+        assert_eq!(
+            get_text("<p>Hel<b>lo</b>, <a>wor</a>ld!</p>", "body"),
+            "Hello, world!"
+        );
+        assert_eq!(
+            get_text("<nav><a>Home</a><!-- | --><a>Blog</a></nav>", "body"),
+            "Home Blog"
+        );
+    }
+
+    #[test]
+    fn test_block_elements() {
+        assert_eq!(
+            get_text("<div>Hello</div><div>World</div>", "body"),
+            "Hello World"
+        );
+        assert_eq!(
+            get_text(
+                "<ul><li>One</li><li>Two</li></ul><p>Three<br>Four</p>",
+                "body"
+            ),
+            "One Two Three Four"
+        );
+        assert_eq!(get_text("<h1>Title</h1>Text", "body"), "Title Text");
+        assert_eq!(
+            get_text("<table><tr><td>A</td><td>B</td></tr></table>", "body"),
+            "A B"
+        );
+    }
+
+    #[test]
+    fn test_skipped_elements() {
+        let html = r#"
+            <body>
+                Before
+                <script>var hidden = "script";</script>
+                <style>.hidden { display: none; }</style>
+                <template><p>Template</p></template>
+                <noscript><img src="pixel.gif"> Enable scripts</noscript>
+                <!-- A comment -->
+                After
+            </body>
+        "#;
+
+        assert_eq!(get_text(html, "body"), "Before After");
+    }
+
+    #[test]
+    fn test_samples() {
+        let article = r#"
+            <!DOCTYPE html>
+            <html lang="en">
+                <head>
+                    <title>
+                        Rust &amp; WebAssembly | Blog
+                    </title>
+                    <script>window.dataLayer = [];</script>
+                </head>
+                <body>
+                    <nav><a href="/">Home</a> | <a href="/blog">Blog</a></nav>
+                    <article>
+                        <h1>Getting started with <code>wasm-pack</code></h1>
+                        <p>Posted on <time datetime="2024-05-12">May 12</time></p>
+                        <p>Compile your crate with <code>wasm-pack build</code>, then
+                        import it from <em>JavaScript</em>.</p>
+                        <pre><code>fn main() {
+    println!("Hello!");
+}</code></pre>
+                    </article>
+                    <footer>&copy; 2024 Example&nbsp;Inc.</footer>
+                    <script>track("pageview");</script>
+                </body>
+            </html>
+        "#;
+        assert_eq!(get_text(article, "title"), "Rust & WebAssembly | Blog");
+        assert_eq!(
+            get_text(article, "body"),
+            "Home | Blog Getting started with wasm-pack Posted on May 12 \
+             Compile your crate with wasm-pack build, then import it from JavaScript. \
+             fn main() { println!(\"Hello!\"); } © 2024 Example Inc."
+        );
+
+        let product = r#"
+            <html>
+                <body>
+                    <div class="product"><h2>Mechanical Keyboard</h2><span class="price">$89.99</span></div>
+                    <dl><dt>Switches</dt><dd>Brown</dd><dt>Layout</dt><dd>ANSI</dd></dl>
+                    <table>
+                        <thead><tr><th>Size</th><th>Weight</th></tr></thead>
+                        <tbody><tr><td>TKL</td><td>900g</td></tr></tbody>
+                    </table>
+                    <template id="review"><div class="review">Review</div></template>
+                    <button>Add to cart</button>
+                </body>
+            </html>
+        "#;
+        assert_eq!(
+            get_text(product, "body"),
+            "Mechanical Keyboard $89.99 Switches Brown Layout ANSI Size Weight TKL 900g Add to cart"
+        );
+
+        let forum = r#"
+            <html>
+                <body>
+                    <div id="post-1"><div class="author">alice</div><div class="body">First!<br>Great post.</div></div>
+                    <div id="post-2"><div class="author">bob</div><div class="body"><blockquote>First!</blockquote>Agreed, <strong>very</strong> helpful.</div></div>
+                    <noscript>Please enable JavaScript to vote.</noscript>
+                </body>
+            </html>
+        "#;
+        assert_eq!(
+            get_text(forum, "body"),
+            "alice First! Great post. bob First! Agreed, very helpful."
+        );
+    }
+}
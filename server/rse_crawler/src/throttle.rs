@@ -0,0 +1,288 @@
+use common::utils;
+use common::utils::dates;
+use log::{info, warn};
+use std::collections::VecDeque;
+use std::sync::Mutex;
+use std::time::{Duration, Instant, SystemTime};
+
+/// The number of responses in the window needed before the share of throttled ones is trusted.
+const MINIMUM_RESPONSES: usize = 20;
+
+/// The longest `Retry-After` waited, so a single response can't stall the crawl.
+const MAXIMUM_RETRY_AFTER: Duration = Duration::from_secs(300);
+
+/// Slows down the whole crawl while many hosts throttle it at once, like when a shared proxy is rate limited.
+///
+/// # Fields
+///
+/// * `threshold`: The share of throttled responses that slows down the crawl, if enabled.
+/// * `recovery`: The share of throttled responses the crawl recovers at.
+/// * `window`: The window the share of throttled responses is measured over.
+/// * `delay`: The delay added after each request while the crawl is slowed down.
+/// * `state`: The recent responses, and whether the crawl is slowed down.
+#[derive(Debug)]
+pub struct Throttle {
+    threshold: Option<f64>,
+    recovery: f64,
+    window: Duration,
+    delay: Duration,
+    state: Mutex<State>,
+}
+
+/// The state of a throttle.
+///
+/// # Fields
+///
+/// * `responses`: When each recent response came in, and whether it was throttled.
+/// * `slowed`: Whether the crawl is slowed down.
+/// * `retry_at`: The latest time a throttled response asked to be retried at, if any.
+#[derive(Debug, Default)]
+struct State {
+    responses: VecDeque<(Instant, bool)>,
+    slowed: bool,
+    retry_at: Option<Instant>,
+}
+
+impl Throttle {
+    /// Creates a new throttle.
+    ///
+    /// # Arguments
+    ///
+    /// * `threshold`: The share of throttled responses that slows down the crawl, if enabled.
+    /// * `recovery`: The share of throttled responses the crawl recovers at.
+    /// * `window`: The window the share of throttled responses is measured over.
+    /// * `delay`: The delay added after each request while the crawl is slowed down.
+    ///
+    /// # Returns
+    ///
+    /// * `Throttle` - The new throttle.
+    #[must_use]
+    pub fn new(threshold: Option<f64>, recovery: f64, window: Duration, delay: Duration) -> Self {
+        Self {
+            threshold,
+            recovery,
+            window,
+            delay,
+            state: Mutex::new(State::default()),
+        }
+    }
+
+    /// Loads the throttle from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Throttle` - The throttle, disabled if `THROTTLE_THRESHOLD` is `0`.
+    #[must_use]
+    pub fn load() -> Self {
+        Self::new(
+            utils::env::crawler::get_throttle_threshold(),
+            utils::env::crawler::get_throttle_recovery(),
+            utils::env::crawler::get_throttle_window(),
+            utils::env::crawler::get_throttle_delay(),
+        )
+    }
+
+    /// Records a response of any host.
+    ///
+    /// # Arguments
+    ///
+    /// * `status`: The status code of the response.
+    /// * `retry_after`: How long the response asked to wait before retrying, if it did.
+    pub fn record(&self, status: u16, retry_after: Option<Duration>) {
+        self.record_at(Instant::now(), status, retry_after);
+    }
+
+    /// Gets the delay added after each request.
+    ///
+    /// # Returns
+    ///
+    /// * `Duration` - The delay while the crawl is slowed down, or zero.
+    pub fn get_delay(&self) -> Duration {
+        self.get_delay_at(Instant::now())
+    }
+
+    /// Records a response of any host, at a given time.
+    ///
+    /// # Arguments
+    ///
+    /// * `now`: When the response came in.
+    /// * `status`: The status code of the response.
+    /// * `retry_after`: How long the response asked to wait before retrying, if it did.
+    ///
+    /// # Notes
+    ///
+    /// * `429` and `503` responses are throttled, and the crawl is slowed down once their share reaches the threshold.
+    /// * The crawl recovers once their share drops to the recovery share, so it doesn't flap around the threshold.
+    fn record_at(&self, now: Instant, status: u16, retry_after: Option<Duration>) {
+        let Some(threshold) = self.threshold else {
+            return;
+        };
+
+        let Ok(mut state) = self.state.lock() else {
+            return;
+        };
+
+        let throttled = matches!(status, 429 | 503);
+        state.responses.push_back((now, throttled));
+        while state
+            .responses
+            .front()
+            .is_some_and(|(at, _)| now.duration_since(*at) > self.window)
+        {
+            state.responses.pop_front();
+        }
+
+        if let (true, Some(retry_after)) = (throttled, retry_after) {
+            let retry_at = now + retry_after.min(MAXIMUM_RETRY_AFTER);
+            state.retry_at = state.retry_at.max(Some(retry_at));
+        }
+
+        if state.responses.len() < MINIMUM_RESPONSES {
+            return;
+        }
+
+        #[allow(clippy::cast_precision_loss)]
+        let share = state
+            .responses
+            .iter()
+            .filter(|(_, throttled)| *throttled)
+            .count() as f64
+            / state.responses.len() as f64;
+
+        if !state.slowed && share >= threshold {
+            warn!(
+                "{:.0}% of the responses in the last {}s were throttled, slowing down the crawl...",
+                share * 100.0,
+                self.window.as_secs()
+            );
+
+            state.slowed = true;
+        } else if state.slowed && share <= self.recovery {
+            info!(
+                "Only {:.0}% of the responses in the last {}s were throttled, recovering the crawl...",
+                share * 100.0,
+                self.window.as_secs()
+            );
+
+            state.slowed = false;
+            state.retry_at = None;
+        }
+    }
+
+    /// Gets the delay added after each request, at a given time.
+    ///
+    /// # Arguments
+    ///
+    /// * `now`: The current time.
+    ///
+    /// # Returns
+    ///
+    /// * `Duration` - The delay, or the time left until the latest `Retry-After` if it's longer, while the crawl is slowed down.
+    fn get_delay_at(&self, now: Instant) -> Duration {
+        let Ok(state) = self.state.lock() else {
+            return Duration::ZERO;
+        };
+
+        if !state.slowed {
+            return Duration::ZERO;
+        }
+
+        let retry_after = state.retry_at.map_or(Duration::ZERO, |retry_at| {
+            retry_at.saturating_duration_since(now)
+        });
+
+        self.delay.max(retry_after)
+    }
+}
+
+/// Parses a `Retry-After` header.
+///
+/// # Arguments
+///
+/// * `value`: The value of the header, in seconds or an HTTP date.
+/// * `now`: The current time.
+///
+/// # Returns
+///
+/// * `Some(Duration)` - How long to wait before retrying.
+/// * `None` - If the value is neither in seconds nor a date.
+#[must_use]
+pub fn parse_retry_after(value: &str, now: SystemTime) -> Option<Duration> {
+    let value = value.trim();
+    if let Ok(seconds) = value.parse::<u64>() {
+        return Some(Duration::from_secs(seconds));
+    }
+
+    let date = dates::parse(value)?;
+
+    Some(date.duration_since(now).unwrap_or_default())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_throttle() {
+        let throttle = Throttle::new(
+            Some(0.5),
+            0.1,
+            Duration::from_secs(60),
+            Duration::from_secs(5),
+        );
+        let start = Instant::now();
+        let at = |secs| start + Duration::from_secs(secs);
+
+        // A few throttled responses aren't enough to slow down the crawl.
+        for _ in 0..MINIMUM_RESPONSES - 1 {
+            throttle.record_at(at(0), 429, None);
+        }
+        assert_eq!(throttle.get_delay_at(at(0)), Duration::ZERO);
+
+        // Once there are enough, the delay is added, or the time left of a longer Retry-After.
+        throttle.record_at(at(1), 503, Some(Duration::from_secs(30)));
+        assert_eq!(throttle.get_delay_at(at(1)), Duration::from_secs(30));
+        assert_eq!(throttle.get_delay_at(at(21)), Duration::from_secs(10));
+        assert_eq!(throttle.get_delay_at(at(40)), Duration::from_secs(5));
+
+        // The crawl stays slowed down between the recovery share and the threshold.
+        for _ in 0..MINIMUM_RESPONSES * 2 {
+            throttle.record_at(at(40), 200, None);
+        }
+        assert_eq!(throttle.get_delay_at(at(40)), Duration::from_secs(5));
+
+        // Once the throttled responses are outside of the window, the crawl recovers.
+        throttle.record_at(at(70), 200, None);
+        assert_eq!(throttle.get_delay_at(at(70)), Duration::ZERO);
+    }
+
+    #[test]
+    fn test_throttle_disabled() {
+        let throttle = Throttle::new(None, 0.1, Duration::from_secs(60), Duration::from_secs(5));
+        let now = Instant::now();
+
+        for _ in 0..MINIMUM_RESPONSES * 2 {
+            throttle.record_at(now, 429, None);
+        }
+        assert_eq!(throttle.get_delay_at(now), Duration::ZERO);
+    }
+
+    #[test]
+    fn test_parse_retry_after() {
+        let now = SystemTime::UNIX_EPOCH + Duration::from_secs(1_715_495_400);
+
+        assert_eq!(
+            parse_retry_after("120", now),
+            Some(Duration::from_secs(120))
+        );
+        assert_eq!(
+            parse_retry_after("Sun, 12 May 2024 06:31:00 GMT", now),
+            Some(Duration::from_secs(60))
+        );
+        assert_eq!(
+            parse_retry_after("Sun, 12 May 2024 06:00:00 GMT", now),
+            Some(Duration::ZERO)
+        );
+        assert_eq!(parse_retry_after("soon", now), None);
+    }
+}
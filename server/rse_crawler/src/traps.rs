@@ -0,0 +1,312 @@
+use common::utils;
+use std::collections::HashMap;
+use url::Url;
+
+/// The length of a query string in bytes, above which a URL is in a spider trap.
+const MAXIMUM_QUERY_LENGTH: usize = 512;
+
+/// The number of times a segment may occur in the path of a URL, above which it's in a spider trap.
+const MAXIMUM_SEGMENT_REPEATS: usize = 2;
+
+/// The query parameters that page through a calendar, like `?month=5&year=2024`.
+const CALENDAR_PARAMETERS: [&str; 6] = ["calendar", "date", "day", "month", "week", "year"];
+
+/// A pattern of URLs that never ends, which a crawler following every link would never get out of.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Trap {
+    /// A calendar linking from one day or month to the next, like `/events/2024/05` or `?date=2024-05-01`.
+    Calendar,
+    /// A query string growing with every link, like filters that are added on top of each other.
+    Query,
+    /// A path nested deeper than sites do, like relative links resolved against the page they're on.
+    Depth,
+    /// A path repeating its segments, like `/a/b/a/b/a/b`.
+    Repetition,
+}
+
+impl Trap {
+    /// Gets the name of the trap.
+    ///
+    /// # Returns
+    ///
+    /// * `&'static str` - The name of the trap.
+    #[must_use]
+    pub const fn as_str(self) -> &'static str {
+        match self {
+            Self::Calendar => "calendar",
+            Self::Query => "query",
+            Self::Depth => "depth",
+            Self::Repetition => "repetition",
+        }
+    }
+}
+
+/// Detects the URLs in spider traps, and caps how many of them are queued per host.
+///
+/// # Fields
+///
+/// * `maximum_urls`: The maximum number of URLs in spider traps queued per host.
+/// * `maximum_path_depth`: The number of path segments, above which a URL is in a spider trap.
+/// * `maximum_query_parameters`: The number of query parameters, above which a URL is in a spider trap.
+/// * `urls`: The number of URLs in spider traps queued so far, by their host.
+///
+/// # Notes
+///
+/// * The URLs in a trap are queued until their host reaches the cap, so the first pages of a calendar are still crawled.
+#[derive(Debug, Clone)]
+pub struct Traps {
+    maximum_urls: usize,
+    maximum_path_depth: usize,
+    maximum_query_parameters: usize,
+    urls: HashMap<String, usize>,
+}
+
+impl Traps {
+    /// Creates new spider trap detection.
+    ///
+    /// # Arguments
+    ///
+    /// * `maximum_urls`: The maximum number of URLs in spider traps queued per host.
+    /// * `maximum_path_depth`: The number of path segments, above which a URL is in a spider trap.
+    /// * `maximum_query_parameters`: The number of query parameters, above which a URL is in a spider trap.
+    ///
+    /// # Returns
+    ///
+    /// * `Traps` - The new spider trap detection.
+    #[must_use]
+    pub fn new(
+        maximum_urls: usize,
+        maximum_path_depth: usize,
+        maximum_query_parameters: usize,
+    ) -> Self {
+        Self {
+            maximum_urls,
+            maximum_path_depth,
+            maximum_query_parameters,
+            urls: HashMap::new(),
+        }
+    }
+
+    /// Loads the spider trap detection from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Traps)` - The spider trap detection.
+    /// * `None` - If URLs in spider traps are queued like any other.
+    #[must_use]
+    pub fn load() -> Option<Self> {
+        Some(Self::new(
+            utils::env::crawler::get_trap_urls_per_host()?,
+            utils::env::crawler::get_trap_path_depth(),
+            utils::env::crawler::get_trap_query_parameters(),
+        ))
+    }
+
+    /// Checks if a discovered URL is queued, counting it against its host if it's in a spider trap.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The normalized URL.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Trap)` - The trap the URL is in, if its host already had the maximum number of URLs in traps queued.
+    /// * `None` - If the URL is queued.
+    pub fn check(&mut self, url: &Url) -> Option<Trap> {
+        let trap = self.detect(url)?;
+
+        let urls = self
+            .urls
+            .entry(url.host_str().unwrap_or_default().to_string())
+            .or_insert(0);
+        if *urls >= self.maximum_urls {
+            return Some(trap);
+        }
+
+        *urls += 1;
+
+        None
+    }
+
+    /// Detects the spider trap a URL is in.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The normalized URL.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Trap)` - The trap the URL is in.
+    /// * `None` - If the URL doesn't look like it's in a trap.
+    #[must_use]
+    pub fn detect(&self, url: &Url) -> Option<Trap> {
+        let segments = url
+            .path_segments()
+            .map(|segments| {
+                segments
+                    .filter(|segment| !segment.is_empty())
+                    .collect::<Vec<_>>()
+            })
+            .unwrap_or_default();
+        if segments.len() > self.maximum_path_depth {
+            return Some(Trap::Depth);
+        }
+
+        let mut occurrences = HashMap::new();
+        for segment in &segments {
+            *occurrences.entry(*segment).or_insert(0) += 1;
+        }
+        if occurrences
+            .values()
+            .any(|&occurrences| occurrences > MAXIMUM_SEGMENT_REPEATS)
+        {
+            return Some(Trap::Repetition);
+        }
+
+        let query = url.query().unwrap_or_default();
+        if query.len() > MAXIMUM_QUERY_LENGTH
+            || url.query_pairs().count() > self.maximum_query_parameters
+        {
+            return Some(Trap::Query);
+        }
+
+        if Self::is_calendar(url, &segments) {
+            return Some(Trap::Calendar);
+        }
+
+        None
+    }
+
+    /// Checks if a URL is a page of a calendar.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The normalized URL.
+    /// * `segments`: The non-empty segments of its path.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the path ends in a date, like `/2024/05/01` or `/2024-05`, or the query has a date parameter.
+    ///
+    /// # Notes
+    ///
+    /// * Paths with a slug after the date, like the permalinks of blog posts, aren't calendars.
+    fn is_calendar(url: &Url, segments: &[&str]) -> bool {
+        let is_number = |value: &str, digits: usize, range: std::ops::RangeInclusive<u32>| {
+            value.len() == digits
+                && value.bytes().all(|byte| byte.is_ascii_digit())
+                && value.parse().is_ok_and(|number| range.contains(&number))
+        };
+        let is_date = |parts: &[&str]| match parts {
+            [year, month] => is_number(year, 4, 1_000..=9_999) && is_number(month, 2, 1..=12),
+            [year, month, day] => {
+                is_number(year, 4, 1_000..=9_999)
+                    && is_number(month, 2, 1..=12)
+                    && is_number(day, 2, 1..=31)
+            }
+            _ => false,
+        };
+
+        let ends_in_date = (2..=3).any(|length| {
+            segments.len() >= length && is_date(&segments[segments.len() - length..])
+        }) || segments
+            .last()
+            .is_some_and(|segment| is_date(&segment.split('-').collect::<Vec<_>>()));
+        if ends_in_date {
+            return true;
+        }
+
+        url.query_pairs().any(|(key, value)| {
+            let key = key.to_lowercase();
+
+            (CALENDAR_PARAMETERS.contains(&key.as_str())
+                && !value.is_empty()
+                && value
+                    .bytes()
+                    .all(|byte| byte.is_ascii_digit() || byte == b'-'))
+                || is_date(&value.split('-').collect::<Vec<_>>())
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[allow(clippy::expect_used)]
+    fn url(url: &str) -> Url {
+        Url::parse(url).expect("Failed to parse URL!")
+    }
+
+    #[test]
+    fn test_detect() {
+        let traps = Traps::new(100, 6, 4);
+        let detect = |value: &str| traps.detect(&url(value));
+
+        assert_eq!(
+            detect("https://example.com/events/2024/05"),
+            Some(Trap::Calendar)
+        );
+        assert_eq!(
+            detect("https://example.com/events/2024/05/01/"),
+            Some(Trap::Calendar)
+        );
+        assert_eq!(
+            detect("https://example.com/events/2024-05-01"),
+            Some(Trap::Calendar)
+        );
+        assert_eq!(
+            detect("https://example.com/events?month=5&year=2024"),
+            Some(Trap::Calendar)
+        );
+        assert_eq!(
+            detect("https://example.com/events?view=2024-05"),
+            Some(Trap::Calendar)
+        );
+
+        assert_eq!(
+            detect("https://example.com/a?a=1&b=2&c=3&d=4&e=5"),
+            Some(Trap::Query)
+        );
+        assert_eq!(
+            detect(&format!("https://example.com/?q={}", "a".repeat(600))),
+            Some(Trap::Query)
+        );
+        assert_eq!(
+            detect("https://example.com/a/b/c/d/e/f/g"),
+            Some(Trap::Depth)
+        );
+        assert_eq!(
+            detect("https://example.com/a/b/a/b/a/b"),
+            Some(Trap::Repetition)
+        );
+
+        // The permalinks of blog posts and ordinary pages aren't traps.
+        assert_eq!(detect("https://example.com/2024/05/01/hello-world"), None);
+        assert_eq!(detect("https://example.com/products/1234/56"), None);
+        assert_eq!(detect("https://example.com/search?q=rust&page=2"), None);
+        assert_eq!(detect("https://example.com/a/b/a/b"), None);
+        assert_eq!(detect("https://example.com/"), None);
+    }
+
+    #[test]
+    fn test_check() {
+        let mut traps = Traps::new(2, 6, 4);
+
+        // Only the first URLs in traps on a host are queued.
+        assert_eq!(traps.check(&url("https://example.com/cal/2024/01")), None);
+        assert_eq!(traps.check(&url("https://example.com/cal/2024/02")), None);
+        assert_eq!(
+            traps.check(&url("https://example.com/cal/2024/03")),
+            Some(Trap::Calendar)
+        );
+        assert_eq!(
+            traps.check(&url("https://example.com/a/b/a/b/a/b")),
+            Some(Trap::Repetition)
+        );
+
+        // URLs outside of traps, and the traps of other hosts, aren't capped.
+        assert_eq!(traps.check(&url("https://example.com/about")), None);
+        assert_eq!(traps.check(&url("https://example.org/cal/2024/03")), None);
+    }
+}
@@ -0,0 +1,249 @@
+use common::database;
+use common::database::model::CrawlUsage;
+use common::errors::Error;
+use common::utils;
+use log::{error, info};
+use std::collections::HashMap;
+use std::sync::{Arc, Mutex};
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+use url::Url;
+
+/// The bytes downloaded and requests made per host by a crawl run, accumulated in memory between flushes.
+///
+/// # Fields
+///
+/// * `run_id`: The ID of the crawl run.
+/// * `hosts`: The bytes downloaded from, and requests made to, each host since the last flush.
+#[derive(Debug)]
+pub struct Usage {
+    run_id: String,
+    hosts: Mutex<HashMap<String, (u64, u64)>>,
+}
+
+impl Usage {
+    /// Creates a new usage accumulator.
+    ///
+    /// # Arguments
+    ///
+    /// * `run_id`: The ID of the crawl run.
+    ///
+    /// # Returns
+    ///
+    /// * `Usage` - The new usage accumulator.
+    #[must_use]
+    pub fn new(run_id: String) -> Self {
+        Self {
+            run_id,
+            hosts: Mutex::new(HashMap::new()),
+        }
+    }
+
+    /// Creates a new usage accumulator for a crawl run starting now.
+    ///
+    /// # Returns
+    ///
+    /// * `Usage` - The new usage accumulator.
+    ///
+    /// # Notes
+    ///
+    /// * The run is identified by when it started and the ID of the process, like `1792016400-4242`.
+    #[must_use]
+    pub fn start() -> Self {
+        let started_at = SystemTime::now()
+            .duration_since(UNIX_EPOCH)
+            .map(|since_epoch| since_epoch.as_secs())
+            .unwrap_or_default();
+
+        Self::new(format!("{started_at}-{}", std::process::id()))
+    }
+
+    /// Gets the ID of the crawl run.
+    ///
+    /// # Returns
+    ///
+    /// * `&str` - The ID of the crawl run.
+    #[must_use]
+    pub fn run_id(&self) -> &str {
+        &self.run_id
+    }
+
+    /// Records a request.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL that was requested.
+    /// * `bytes`: The size of the body that was read.
+    pub fn record(&self, url: &Url, bytes: usize) {
+        let Some(host) = url.host_str() else {
+            return;
+        };
+
+        if let Ok(mut hosts) = self.hosts.lock() {
+            let (host_bytes, host_requests) = hosts.entry(host.to_string()).or_insert((0, 0));
+            *host_bytes += u64::try_from(bytes).unwrap_or(u64::MAX);
+            *host_requests += 1;
+        }
+    }
+
+    /// Writes the usage recorded since the last flush to the database.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(usize)` - The number of hosts written.
+    /// * `Err(Error)` - If the usage could not be written.
+    ///
+    /// # Errors
+    ///
+    /// * If the usage could not be added to the database, in which case it's kept for the next flush.
+    ///
+    /// # Notes
+    ///
+    /// * The usage is added to the day the flush happens on.
+    pub async fn flush(&self) -> Result<usize, Error> {
+        let hosts = self.take();
+        if hosts.is_empty() {
+            return Ok(0);
+        }
+
+        let usage = self.get_entries(&hosts, utils::usage::get_day(SystemTime::now()));
+        if let Err(err) = database::add_crawl_usage(&usage).await {
+            self.restore(hosts);
+
+            return Err(err);
+        }
+
+        Ok(usage.len())
+    }
+
+    /// Flushes the usage to the database in the background, every interval.
+    ///
+    /// # Arguments
+    ///
+    /// * `usage`: The usage to flush.
+    /// * `interval`: The interval between each flush.
+    pub fn flush_every(usage: Arc<Self>, interval: Duration) {
+        tokio::spawn(async move {
+            loop {
+                tokio::time::sleep(interval).await;
+
+                match usage.flush().await {
+                    Ok(0) => {}
+                    Ok(hosts) => info!("Flushed the crawl usage of {hosts} hosts."),
+                    Err(err) => error!("Failed to flush crawl usage ({}): {err}", err.code()),
+                }
+            }
+        });
+    }
+
+    /// Takes the usage recorded since the last flush.
+    ///
+    /// # Returns
+    ///
+    /// * `HashMap<String, (u64, u64)>` - The bytes downloaded from, and requests made to, each host.
+    fn take(&self) -> HashMap<String, (u64, u64)> {
+        self.hosts
+            .lock()
+            .map(|mut hosts| std::mem::take(&mut *hosts))
+            .unwrap_or_default()
+    }
+
+    /// Puts back usage that could not be flushed, adding it to what was recorded since.
+    ///
+    /// # Arguments
+    ///
+    /// * `usage`: The bytes downloaded from, and requests made to, each host.
+    fn restore(&self, usage: HashMap<String, (u64, u64)>) {
+        if let Ok(mut hosts) = self.hosts.lock() {
+            for (host, (bytes, requests)) in usage {
+                let (host_bytes, host_requests) = hosts.entry(host).or_insert((0, 0));
+                *host_bytes += bytes;
+                *host_requests += requests;
+            }
+        }
+    }
+
+    /// Gets the database entries of the usage of each host.
+    ///
+    /// # Arguments
+    ///
+    /// * `hosts`: The bytes downloaded from, and requests made to, each host.
+    /// * `day`: The start of the day to add the usage to.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<CrawlUsage>` - The entries.
+    fn get_entries(&self, hosts: &HashMap<String, (u64, u64)>, day: SystemTime) -> Vec<CrawlUsage> {
+        hosts
+            .iter()
+            .map(|(host, (bytes, requests))| CrawlUsage {
+                day,
+                run_id: self.run_id.clone(),
+                host: host.clone(),
+
+                bytes: i64::try_from(*bytes).unwrap_or(i64::MAX),
+                requests: i64::try_from(*requests).unwrap_or(i64::MAX),
+            })
+            .collect()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_flush_accumulation() {
+        let url = |url: &str| Url::parse(url).expect("Failed to parse URL!");
+        let usage = Usage::new("run".into());
+
+        usage.record(&url("https://example.com/robots.txt"), 100);
+        usage.record(&url("https://example.com/page"), 1_000);
+        usage.record(&url("https://other.com/"), 10);
+
+        // Taking the usage empties it for the next flush.
+        let hosts = usage.take();
+        assert_eq!(
+            hosts,
+            HashMap::from([
+                ("example.com".to_string(), (1_100, 2)),
+                ("other.com".to_string(), (10, 1)),
+            ])
+        );
+        assert!(usage.take().is_empty());
+
+        let day = utils::usage::get_day(SystemTime::now());
+        let mut entries = usage.get_entries(&hosts, day);
+        entries.sort_by(|a, b| a.host.cmp(&b.host));
+        assert_eq!(
+            entries,
+            vec![
+                CrawlUsage {
+                    day,
+                    run_id: "run".into(),
+                    host: "example.com".into(),
+                    bytes: 1_100,
+                    requests: 2,
+                },
+                CrawlUsage {
+                    day,
+                    run_id: "run".into(),
+                    host: "other.com".into(),
+                    bytes: 10,
+                    requests: 1,
+                },
+            ]
+        );
+
+        // Usage that failed to flush is added to what was recorded since.
+        usage.record(&url("https://example.com/other"), 5);
+        usage.restore(hosts);
+        assert_eq!(
+            usage.take(),
+            HashMap::from([
+                ("example.com".to_string(), (1_105, 3)),
+                ("other.com".to_string(), (10, 1)),
+            ])
+        );
+    }
+}
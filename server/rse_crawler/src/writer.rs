@@ -0,0 +1,542 @@
+use common::database::model::{Field, NewPage, Page};
+use common::database::store::{CrawledPage, Store};
+use common::errors::Error;
+use common::utils::compression::Codec;
+use common::utils::simhash;
+use common::utils::structured_data::Kind;
+use log::{error, info};
+use std::collections::HashMap;
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+use url::Url;
+
+/// A processed page, waiting to be written to the store.
+///
+/// # Fields
+///
+/// * `page`: The page.
+/// * `content`: The text of the page, compressed into the page once it's written.
+/// * `content_hash`: The SHA-256 hash of the body of the page.
+/// * `status`: The HTTP status code of the response.
+/// * `size`: The size of the body in bytes.
+/// * `forward_links`: The links on the page, and how many times each is linked to.
+/// * `keywords`: The words on the page, with the field they're in, their frequency and positions.
+/// * `images`: The images on the page, with their alt text and caption, in the order they're on it.
+/// * `anchors`: The anchor text of the links on the page, by the URL they point to.
+/// * `structured_data`: The kind and JSON-LD of the structured data entities on the page, in the order they're on it.
+/// * `simhash`: The simhash of the text of the page, if it has enough words.
+#[derive(Debug, Clone)]
+pub struct Entry {
+    pub page: NewPage,
+    pub content: String,
+
+    pub content_hash: String,
+    pub status: i32,
+    pub size: i32,
+
+    pub forward_links: HashMap<Url, i32>,
+    pub keywords: Vec<(Field, String, i32, Vec<i32>)>,
+    pub images: Vec<(Url, Option<String>, Option<String>)>,
+    pub anchors: HashMap<Url, String>,
+    pub structured_data: Vec<(Kind, String)>,
+    pub simhash: Option<u64>,
+}
+
+/// Writes processed pages to the store, buffering them to write many at once.
+///
+/// # Fields
+///
+/// * `batch_size`: The number of pages written at once, `1` to write each page right away.
+/// * `history_length`: The number of crawls kept in the history of each page.
+/// * `codec`: The codec the text of the pages is compressed with.
+/// * `store`: The store the pages are written to.
+/// * `entries`: The pages waiting to be written.
+#[derive(Debug)]
+pub struct Writer {
+    batch_size: usize,
+    history_length: i64,
+    codec: Codec,
+    store: Arc<dyn Store>,
+    entries: Mutex<Vec<Entry>>,
+}
+
+impl Writer {
+    /// Creates a new page writer.
+    ///
+    /// # Arguments
+    ///
+    /// * `batch_size`: The number of pages written at once, `1` to write each page right away.
+    /// * `history_length`: The number of crawls kept in the history of each page.
+    /// * `codec`: The codec to compress the text of the pages with.
+    /// * `store`: The store to write the pages to.
+    ///
+    /// # Returns
+    ///
+    /// * `Writer` - The new page writer.
+    #[must_use]
+    pub fn new(
+        batch_size: usize,
+        history_length: usize,
+        codec: Codec,
+        store: Arc<dyn Store>,
+    ) -> Self {
+        Self {
+            batch_size: batch_size.max(1),
+            history_length: i64::try_from(history_length).unwrap_or(i64::MAX),
+            codec,
+            store,
+            entries: Mutex::new(Vec::new()),
+        }
+    }
+
+    /// Checks if pages are buffered before they're written.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether more than one page is written at once.
+    #[must_use]
+    pub const fn is_batched(&self) -> bool {
+        self.batch_size > 1
+    }
+
+    /// Writes a page, or buffers it until the batch is full.
+    ///
+    /// # Arguments
+    ///
+    /// * `entry`: The page to write.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(())` - If the page was written or buffered.
+    /// * `Err(Error)` - If the batch the page completed could not be written.
+    ///
+    /// # Errors
+    ///
+    /// * If the text of the page could not be compressed.
+    /// * If the pages could not be written to the store.
+    pub async fn write(&self, mut entry: Entry) -> Result<(), Error> {
+        // Compress the text right away, so the buffered pages take up less memory.
+        let content = std::mem::take(&mut entry.content);
+        entry.page.content = Some(self.codec.compress(&content)?);
+
+        let batch = {
+            let mut entries = self.entries.lock()?;
+            entries.push(entry);
+            if entries.len() < self.batch_size {
+                return Ok(());
+            }
+
+            std::mem::take(&mut *entries)
+        };
+
+        self.write_batch(batch).await.map(|_| ())
+    }
+
+    /// Writes all the buffered pages.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(usize)` - The number of pages written.
+    /// * `Err(Error)` - If the pages could not be written.
+    ///
+    /// # Errors
+    ///
+    /// * If the pages could not be written to the store.
+    pub async fn flush(&self) -> Result<usize, Error> {
+        let batch = std::mem::take(&mut *self.entries.lock()?);
+
+        self.write_batch(batch).await
+    }
+
+    /// Writes the buffered pages in the background, every interval.
+    ///
+    /// # Arguments
+    ///
+    /// * `writer`: The page writer.
+    /// * `interval`: The maximum time a page waits to be written.
+    pub fn flush_every(writer: Arc<Self>, interval: Duration) {
+        tokio::spawn(async move {
+            loop {
+                tokio::time::sleep(interval).await;
+
+                match writer.flush().await {
+                    Ok(0) => {}
+                    Ok(pages) => info!("Wrote a batch of {pages} pages."),
+                    Err(err) => error!("Failed to write batch of pages ({}): {err}", err.code()),
+                }
+            }
+        });
+    }
+
+    /// Gets the stored page of a URL.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the page.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Some(Page))` - The page, as it was last written.
+    /// * `Ok(None)` - If the page isn't stored.
+    /// * `Err(Error)` - If the page could not be retrieved.
+    ///
+    /// # Errors
+    ///
+    /// * If the page could not be retrieved from the store.
+    pub async fn get_page(&self, url: &Url) -> Result<Option<Page>, Error> {
+        Ok(self
+            .store
+            .get_pages_by_urls(std::slice::from_ref(url))
+            .await?
+            .into_iter()
+            .next())
+    }
+
+    /// Marks a stored page as crawled now, for a page that wasn't modified since it was last crawled.
+    ///
+    /// # Arguments
+    ///
+    /// * `page`: The stored page.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Vec<Url>)` - The links stored for the page, so they're followed like if it was fetched in full.
+    /// * `Err(Error)` - If the page could not be marked as crawled, or its links could not be retrieved.
+    ///
+    /// # Errors
+    ///
+    /// * If the page could not be updated, or its links could not be retrieved from the store.
+    pub async fn revisit(&self, page: &Page) -> Result<Vec<Url>, Error> {
+        self.store.touch_page(page).await?;
+
+        Ok(self
+            .store
+            .get_forward_links(page)
+            .await?
+            .into_iter()
+            .filter(|link| link.to_page_url != page.url)
+            .filter_map(|link| Url::parse(&link.to_page_url).ok())
+            .collect())
+    }
+
+    /// Finds the indexed page a page is nearly the same as, by the simhash of its text.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the page, which isn't a near-duplicate of itself.
+    /// * `simhash`: The simhash of the text of the page.
+    /// * `maximum_distance`: The maximum number of bits the simhashes may differ in.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Some((String, u32)))` - The URL of the closest indexed page, and the number of bits their simhashes differ in.
+    /// * `Ok(None)` - If no indexed page is close enough.
+    /// * `Err(Error)` - If the simhashes could not be retrieved.
+    ///
+    /// # Errors
+    ///
+    /// * If the simhashes could not be retrieved from the store.
+    pub async fn find_near_duplicate(
+        &self,
+        url: &Url,
+        simhash: u64,
+        maximum_distance: u32,
+    ) -> Result<Option<(String, u32)>, Error> {
+        Ok(self
+            .store
+            .get_simhash_matches(simhash)
+            .await?
+            .into_iter()
+            .filter(|(match_url, _)| match_url != url.as_str())
+            .map(|(match_url, other)| (match_url, simhash::distance(simhash, other)))
+            .filter(|(_, distance)| *distance <= maximum_distance)
+            .min_by(|(url_a, distance_a), (url_b, distance_b)| {
+                distance_a.cmp(distance_b).then_with(|| url_a.cmp(url_b))
+            }))
+    }
+
+    /// Removes the stored page of a URL, for a page that may no longer be indexed.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the page.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(true)` - If the page was removed.
+    /// * `Ok(false)` - If the page isn't stored.
+    /// * `Err(Error)` - If the page could not be removed.
+    ///
+    /// # Errors
+    ///
+    /// * If the page could not be retrieved or deleted from the store.
+    pub async fn remove(&self, url: &Url) -> Result<bool, Error> {
+        let Some(page) = self.get_page(url).await? else {
+            return Ok(false);
+        };
+
+        self.store.delete_page(&page).await?;
+
+        Ok(true)
+    }
+
+    /// Writes a batch of pages to the store.
+    ///
+    /// # Arguments
+    ///
+    /// * `entries`: The pages to write.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(usize)` - The number of pages written.
+    /// * `Err(Error)` - If the pages could not be written.
+    ///
+    /// # Errors
+    ///
+    /// * If the pages, their history or their index could not be written to the store.
+    async fn write_batch(&self, entries: Vec<Entry>) -> Result<usize, Error> {
+        let entries = deduplicate(entries);
+        if entries.is_empty() {
+            return Ok(0);
+        }
+
+        let pages = entries
+            .into_iter()
+            .map(|entry| CrawledPage {
+                page: entry.page,
+
+                content_hash: entry.content_hash,
+                status: entry.status,
+                size: entry.size,
+
+                forward_links: entry.forward_links,
+                keywords: entry.keywords,
+                images: entry.images,
+                anchors: entry.anchors,
+                structured_data: entry.structured_data,
+                simhash: entry.simhash,
+            })
+            .collect();
+
+        self.store.save_pages(pages, self.history_length).await
+    }
+}
+
+/// Removes all but the latest entry of each page, since a page can only be upserted once per query.
+///
+/// # Arguments
+///
+/// * `entries`: The pages, oldest first.
+///
+/// # Returns
+///
+/// * `Vec<Entry>` - The latest entry of each page, in the order they were first added.
+fn deduplicate(entries: Vec<Entry>) -> Vec<Entry> {
+    let mut places = HashMap::new();
+    let mut deduplicated: Vec<Entry> = Vec::with_capacity(entries.len());
+    for entry in entries {
+        if let Some(&place) = places.get(&entry.page.url) {
+            deduplicated[place] = entry;
+
+            continue;
+        }
+
+        places.insert(entry.page.url.clone(), deduplicated.len());
+        deduplicated.push(entry);
+    }
+
+    deduplicated
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use async_trait::async_trait;
+    use common::database::model::{ForwardLink, Image, Keyword, RowCounts, WordMatch};
+    use common::database::CompletePage;
+    use std::collections::HashSet;
+
+    /// A store that only records the URLs of the pages saved to it, batch by batch.
+    #[derive(Debug, Default)]
+    struct Recorder {
+        batches: Mutex<Vec<Vec<String>>>,
+    }
+
+    #[async_trait]
+    impl Store for Recorder {
+        async fn save_pages(
+            &self,
+            pages: Vec<CrawledPage>,
+            _history_length: i64,
+        ) -> Result<usize, Error> {
+            let urls = pages
+                .into_iter()
+                .map(|page| page.page.url)
+                .collect::<Vec<_>>();
+            let saved = urls.len();
+            self.batches.lock()?.push(urls);
+
+            Ok(saved)
+        }
+
+        async fn get_pages_with_keywords(
+            &self,
+            _words: &[String],
+        ) -> Result<Vec<CompletePage>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn get_pages_by_urls(&self, _urls: &[Url]) -> Result<Vec<Page>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn get_keywords(&self, _page: &Page) -> Result<Option<Vec<Keyword>>, Error> {
+            Ok(None)
+        }
+
+        async fn get_forward_links(&self, _page: &Page) -> Result<Vec<ForwardLink>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn touch_page(&self, _page: &Page) -> Result<(), Error> {
+            Ok(())
+        }
+
+        async fn delete_page(&self, _page: &Page) -> Result<(), Error> {
+            Ok(())
+        }
+
+        async fn get_word_matches(&self, _words: &[String]) -> Result<Vec<WordMatch>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn get_backlinks(
+            &self,
+            _pages: &[CompletePage],
+        ) -> Result<HashMap<CompletePage, u32>, Error> {
+            Ok(HashMap::new())
+        }
+
+        async fn get_word_counts(&self, _limit: i64) -> Result<Vec<(String, i64)>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn get_domain_links(&self) -> Result<HashSet<(String, String)>, Error> {
+            Ok(HashSet::new())
+        }
+
+        async fn count_rows(&self) -> Result<RowCounts, Error> {
+            Ok(RowCounts::default())
+        }
+
+        async fn get_term_stats(&self) -> Result<Vec<(String, i64, i64)>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn get_images(&self, _urls: &[String]) -> Result<Vec<(String, Image)>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn get_content_hashes(
+            &self,
+            _urls: &[String],
+        ) -> Result<Vec<(String, String)>, Error> {
+            Ok(Vec::new())
+        }
+
+        async fn get_simhash_matches(&self, _simhash: u64) -> Result<Vec<(String, u64)>, Error> {
+            Ok(Vec::new())
+        }
+    }
+
+    fn entry(url: &str, status: i32) -> Entry {
+        Entry {
+            page: NewPage {
+                url: url.into(),
+
+                title: None,
+                description: None,
+                encoding: None,
+                index_fingerprint: None,
+                language: None,
+                published_at: None,
+                content_modified_at: None,
+                content: None,
+                authenticated: false,
+                excluded: false,
+                personalized: false,
+                unstable: false,
+                noarchive: false,
+                etag: None,
+                last_modified: None,
+            },
+            content: String::new(),
+            content_hash: String::new(),
+            status,
+            size: 0,
+            forward_links: HashMap::new(),
+            keywords: Vec::new(),
+            images: Vec::new(),
+            anchors: HashMap::new(),
+            structured_data: Vec::new(),
+            simhash: None,
+        }
+    }
+
+    #[test]
+    fn test_deduplicate() {
+        let entries = deduplicate(vec![
+            entry("https://example.com/", 500),
+            entry("https://example.com/other", 200),
+            entry("https://example.com/", 200),
+        ]);
+
+        assert_eq!(
+            entries
+                .iter()
+                .map(|entry| (entry.page.url.as_str(), entry.status))
+                .collect::<Vec<_>>(),
+            vec![
+                ("https://example.com/", 200),
+                ("https://example.com/other", 200),
+            ]
+        );
+        assert!(deduplicate(Vec::new()).is_empty());
+    }
+
+    #[tokio::test]
+    #[allow(clippy::expect_used)]
+    async fn test_write() {
+        let store = Arc::new(Recorder::default());
+        let writer = Writer::new(2, 1, Codec::default(), store.clone());
+
+        writer
+            .write(entry("https://example.com/", 200))
+            .await
+            .expect("Failed to write page!");
+        assert!(store
+            .batches
+            .lock()
+            .expect("Failed to lock batches!")
+            .is_empty());
+
+        writer
+            .write(entry("https://example.com/other", 200))
+            .await
+            .expect("Failed to write page!");
+        writer
+            .write(entry("https://example.com/", 200))
+            .await
+            .expect("Failed to write page!");
+        assert_eq!(writer.flush().await.expect("Failed to flush pages!"), 1);
+        assert_eq!(writer.flush().await.expect("Failed to flush pages!"), 0);
+
+        assert_eq!(
+            *store.batches.lock().expect("Failed to lock batches!"),
+            vec![
+                vec!["https://example.com/", "https://example.com/other"],
+                vec!["https://example.com/"],
+            ]
+        );
+    }
+}
@@ -0,0 +1,22 @@
+use actix_web::http::header::AUTHORIZATION;
+use actix_web::HttpRequest;
+use common::utils;
+
+/// Checks if a request is authorized as an admin request.
+///
+/// # Arguments
+///
+/// * `request`: The request.
+///
+/// # Returns
+///
+/// * `bool` - Whether the request has the admin token as its bearer token.
+#[must_use]
+pub fn is_authorized(request: &HttpRequest) -> bool {
+    utils::admin::is_authorized(
+        request
+            .headers()
+            .get(AUTHORIZATION)
+            .and_then(|authorization| authorization.to_str().ok()),
+    )
+}
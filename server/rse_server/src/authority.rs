@@ -0,0 +1,335 @@
+use actix_web::web;
+use common::database::model::DomainAuthority;
+use common::database::{self, store};
+use common::errors::Error;
+use common::utils::{self, urls};
+use log::{info, warn};
+use std::collections::{HashMap, HashSet};
+use std::sync::RwLock;
+use std::time::Duration;
+
+/// An in-memory cache of the domain authorities.
+///
+/// # Fields
+///
+/// * `domains`: The authority of each domain, from `0` to `1`.
+#[derive(Debug, Default)]
+pub struct Authorities {
+    domains: RwLock<HashMap<String, f64>>,
+}
+
+impl Authorities {
+    /// Creates a new cache of domain authorities.
+    ///
+    /// # Arguments
+    ///
+    /// * `authorities`: The domain authorities.
+    ///
+    /// # Returns
+    ///
+    /// * `Authorities` - The new cache.
+    #[must_use]
+    pub fn new(authorities: Vec<DomainAuthority>) -> Self {
+        Self {
+            domains: RwLock::new(group(authorities)),
+        }
+    }
+
+    /// Loads the domain authorities from the database.
+    ///
+    /// # Returns
+    ///
+    /// * `Authorities` - The cache, empty if the domain authorities could not be loaded.
+    pub async fn load() -> Self {
+        let authorities = Self::default();
+        if let Err(err) = authorities.refresh().await {
+            warn!("Failed to load domain authorities, searching without them! Error: {err}");
+        }
+
+        authorities
+    }
+
+    /// Replaces the cached domain authorities with those in the database.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(())` - If the domain authorities were loaded.
+    /// * `Err(Error)` - If the domain authorities could not be loaded.
+    ///
+    /// # Errors
+    ///
+    /// * If the domain authorities could not be retrieved.
+    pub async fn refresh(&self) -> Result<(), Error> {
+        let domains = group(database::get_domain_authorities().await?);
+        if let Ok(mut cached) = self.domains.write() {
+            *cached = domains;
+        }
+
+        Ok(())
+    }
+
+    /// Reloads the domain authorities in the background, so they're applied after each aggregation.
+    ///
+    /// # Arguments
+    ///
+    /// * `authorities`: The cache to reload.
+    /// * `interval`: The time between each reload, `0` to only load them on start.
+    pub fn refresh_every(authorities: web::Data<Self>, interval: Duration) {
+        if interval.is_zero() {
+            return;
+        }
+
+        actix_web::rt::spawn(async move {
+            loop {
+                actix_web::rt::time::sleep(interval).await;
+
+                if let Err(err) = authorities.refresh().await {
+                    warn!(
+                        "Failed to reload domain authorities, keeping the old ones! Error: {err}"
+                    );
+                }
+            }
+        });
+
+        info!(
+            "Reloading domain authorities every {} seconds...",
+            interval.as_secs()
+        );
+    }
+
+    /// Gets the authority of the domain of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the page.
+    ///
+    /// # Returns
+    ///
+    /// * `f64` - The authority of the domain, from `0` to `1`, `0` if it's unknown.
+    ///
+    /// # Notes
+    ///
+    /// * A subdomain without an authority of its own gets the authority of its closest parent, so `blog.example.com` gets that of `example.com`.
+    #[must_use]
+    pub fn get(&self, url: &str) -> f64 {
+        let Ok(domains) = self.domains.read() else {
+            return 0.0;
+        };
+        let Some(domain) = urls::get_domain(url) else {
+            return 0.0;
+        };
+
+        // Top-level domains are never scored, so the walk stops at the last dot.
+        let mut domain = domain.as_str();
+        loop {
+            if let Some(authority) = domains.get(domain) {
+                return *authority;
+            }
+
+            match domain.split_once('.') {
+                Some((_, parent)) if parent.contains('.') => domain = parent,
+                _ => return 0.0,
+            }
+        }
+    }
+
+    /// Gets the factor the rank of a page is multiplied by, for the authority of its domain.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the page.
+    /// * `weight`: The weight of the authority.
+    ///
+    /// # Returns
+    ///
+    /// * `f64` - The factor, from `1` for unknown domains to `1 + weight` for the most authoritative ones.
+    #[must_use]
+    pub fn get_boost(&self, url: &str, weight: f64) -> f64 {
+        if weight <= 0.0 {
+            return 1.0;
+        }
+
+        weight.mul_add(self.get(url), 1.0)
+    }
+}
+
+/// Groups the domain authorities by their domain.
+///
+/// # Arguments
+///
+/// * `authorities`: The domain authorities.
+///
+/// # Returns
+///
+/// * `HashMap<String, f64>` - The authority of each domain.
+fn group(authorities: Vec<DomainAuthority>) -> HashMap<String, f64> {
+    authorities
+        .into_iter()
+        .map(|authority| (authority.domain, authority.score))
+        .collect()
+}
+
+/// Scores the authority of each domain from the domains linking to it.
+///
+/// # Arguments
+///
+/// * `links`: The pairs of domains where a page on the first links to the second, each only once.
+/// * `seeds`: The scores operators set for domains, which win over the derived ones.
+///
+/// # Returns
+///
+/// * `Vec<DomainAuthority>` - The authority of each domain, ordered by domain.
+///
+/// # Notes
+///
+/// * The score is the logarithm of the number of linking domains, scaled so the most linked to domain scores `1`.
+/// * Only other domains count, so a domain can't raise its own authority by linking to itself from many pages.
+fn get_authorities(
+    links: &HashSet<(String, String)>,
+    seeds: &[(String, f64)],
+) -> Vec<DomainAuthority> {
+    let mut linking_domains = HashMap::<&str, i32>::new();
+    for (from, to) in links {
+        if from != to {
+            *linking_domains.entry(to.as_str()).or_insert(0) += 1;
+        }
+    }
+
+    let maximum = linking_domains.values().copied().max().unwrap_or_default();
+    let mut authorities = linking_domains
+        .into_iter()
+        .map(|(domain, linking_domains)| {
+            (
+                domain.to_string(),
+                DomainAuthority {
+                    domain: domain.to_string(),
+                    score: f64::from(linking_domains).ln_1p() / f64::from(maximum).ln_1p(),
+                    linking_domains,
+                    seeded: false,
+                },
+            )
+        })
+        .collect::<HashMap<_, _>>();
+
+    for (domain, score) in seeds {
+        let authority = authorities
+            .entry(domain.clone())
+            .or_insert_with(|| DomainAuthority {
+                domain: domain.clone(),
+                score: 0.0,
+                linking_domains: 0,
+                seeded: true,
+            });
+        authority.score = *score;
+        authority.seeded = true;
+    }
+
+    let mut authorities = authorities.into_values().collect::<Vec<_>>();
+    authorities.sort_by(|authority_a, authority_b| authority_a.domain.cmp(&authority_b.domain));
+
+    authorities
+}
+
+/// Recalculates the domain authorities from the links between the stored pages.
+///
+/// # Returns
+///
+/// * `Ok(usize)` - The number of domain authorities if successful.
+/// * `Err(Error)` - If the domain authorities could not be recalculated.
+///
+/// # Errors
+///
+/// * If the links could not be retrieved from every shard.
+/// * If the seeded domain authorities could not be read.
+/// * If the domain authorities could not be replaced.
+pub async fn aggregate() -> Result<usize, Error> {
+    let links = store::load().get_domain_links().await?;
+    let seeds = utils::env::data::fetch_domain_authorities()?.unwrap_or_default();
+    let authorities = get_authorities(&links, &seeds);
+
+    info!(
+        "Aggregated {} domain authorities from {} links between domains and {} seeded scores...",
+        authorities.len(),
+        links.len(),
+        seeds.len()
+    );
+    database::replace_domain_authorities(&authorities).await?;
+
+    Ok(authorities.len())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn link(from: &str, to: &str) -> (String, String) {
+        (from.to_string(), to.to_string())
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_authorities() {
+        let links = HashSet::from([
+            link("a.com", "popular.com"),
+            link("b.com", "popular.com"),
+            link("c.com", "popular.com"),
+            link("a.com", "niche.com"),
+            link("niche.com", "niche.com"),
+        ]);
+        let seeds = vec![("a.com".to_string(), 0.5), ("trusted.org".to_string(), 0.9)];
+        let authorities = get_authorities(&links, &seeds);
+        let get = |domain: &str| {
+            authorities
+                .iter()
+                .find(|authority| authority.domain == domain)
+                .expect("Failed to find domain authority!")
+        };
+
+        assert_eq!(
+            authorities
+                .iter()
+                .map(|authority| authority.domain.as_str())
+                .collect::<Vec<_>>(),
+            vec!["a.com", "niche.com", "popular.com", "trusted.org"]
+        );
+
+        // The most linked to domain scores 1, and links from the same domain don't count.
+        assert_eq!(get("popular.com").linking_domains, 3);
+        assert!((get("popular.com").score - 1.0).abs() < f64::EPSILON);
+        assert_eq!(get("niche.com").linking_domains, 1);
+        assert!((get("niche.com").score - 2.0_f64.ln() / 4.0_f64.ln()).abs() < f64::EPSILON);
+
+        // Seeded scores win, even for domains nothing links to.
+        assert!(get("trusted.org").seeded);
+        assert!((get("trusted.org").score - 0.9).abs() < f64::EPSILON);
+        assert!(get("a.com").seeded);
+        assert!(!get("popular.com").seeded);
+    }
+
+    #[test]
+    fn test_get() {
+        let authorities = Authorities::new(vec![
+            DomainAuthority {
+                domain: "example.com".to_string(),
+                score: 0.5,
+                linking_domains: 10,
+                seeded: false,
+            },
+            DomainAuthority {
+                domain: "docs.example.com".to_string(),
+                score: 0.8,
+                linking_domains: 20,
+                seeded: false,
+            },
+        ]);
+
+        assert!((authorities.get("https://example.com/page") - 0.5).abs() < f64::EPSILON);
+        assert!((authorities.get("https://blog.example.com/") - 0.5).abs() < f64::EPSILON);
+        assert!((authorities.get("https://a.docs.example.com/") - 0.8).abs() < f64::EPSILON);
+        assert!(authorities.get("https://other.com/").abs() < f64::EPSILON);
+        assert!(authorities.get("not a url").abs() < f64::EPSILON);
+
+        assert!((authorities.get_boost("https://example.com/", 2.0) - 2.0).abs() < f64::EPSILON);
+        assert!((authorities.get_boost("https://example.com/", 0.0) - 1.0).abs() < f64::EPSILON);
+    }
+}
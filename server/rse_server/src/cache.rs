@@ -0,0 +1,394 @@
+use crate::search;
+use common::database;
+use common::database::model::Page;
+use common::errors::Error;
+use common::utils;
+use common::utils::compression::Codec;
+use common::utils::dates;
+use hmac::{Hmac, Mac};
+use serde::Deserialize;
+use sha2::Sha256;
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+
+type HmacSha256 = Hmac<Sha256>;
+
+/// The query of a cached page.
+///
+/// # Fields
+///
+/// * `signature`: The signature of the link, as returned with the search results.
+#[derive(Debug, Deserialize)]
+pub struct Query {
+    #[serde(rename = "sig")]
+    pub signature: String,
+}
+
+/// Signs links to the cached copies of pages, and shows the text they were indexed with.
+///
+/// # Fields
+///
+/// * `secret`: The secret links are signed with.
+/// * `lifetime`: How long a link is valid for after it's issued.
+/// * `codec`: The codec the text of pages is stored with.
+///
+/// # Notes
+///
+/// * Links are only valid with their signature, so the cached pages can't be listed by walking the page IDs.
+#[derive(Debug)]
+pub struct Archive {
+    secret: Vec<u8>,
+    lifetime: Duration,
+    codec: Codec,
+}
+
+impl Archive {
+    /// Creates a new archive.
+    ///
+    /// # Arguments
+    ///
+    /// * `secret`: The secret to sign links with.
+    /// * `lifetime`: How long a link is valid for after it's issued.
+    /// * `codec`: The codec the text of pages is stored with.
+    ///
+    /// # Returns
+    ///
+    /// * `Archive` - The new archive.
+    #[must_use]
+    pub const fn new(secret: Vec<u8>, lifetime: Duration, codec: Codec) -> Self {
+        Self {
+            secret,
+            lifetime,
+            codec,
+        }
+    }
+
+    /// Creates a new archive from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Archive)` - The new archive if successful.
+    /// * `Err(Error)` - If the content dictionary could not be read.
+    ///
+    /// # Errors
+    ///
+    /// * If `CONTENT_DICTIONARY` is set, but the file could not be read.
+    ///
+    /// # Notes
+    ///
+    /// * If `CACHE_LINK_SECRET` isn't set, a random secret is used.
+    pub fn load() -> Result<Self, Error> {
+        let secret = utils::env::search::get_cache_link_secret().map_or_else(
+            || rand::random::<[u8; 32]>().to_vec(),
+            std::string::String::into_bytes,
+        );
+
+        Ok(Self::new(
+            secret,
+            utils::env::search::get_cache_link_lifetime(),
+            Codec::load()?,
+        ))
+    }
+
+    /// Gets the link to the cached copy of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `page`: The page.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(String)` - The signed link, like `/cache/1?sig=...`.
+    /// * `None` - If the page may not be shown from the cache.
+    #[must_use]
+    pub fn get_link(&self, page: &Page) -> Option<String> {
+        self.get_link_at(page, get_timestamp())
+    }
+
+    /// Verifies that a link to the cached copy of a page was issued by this archive, and hasn't expired.
+    ///
+    /// # Arguments
+    ///
+    /// * `page_id`: The ID of the page.
+    /// * `signature`: The signature of the link.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the link is valid.
+    #[must_use]
+    pub fn verify(&self, page_id: i32, signature: &str) -> bool {
+        self.verify_at(page_id, signature, get_timestamp())
+    }
+
+    /// Gets the cached copy of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `page_id`: The ID of the page.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Some(String))` - The HTML showing the text of the page, if it may be shown.
+    /// * `Ok(None)` - If the page isn't indexed, has no text stored or may not be shown from the cache.
+    /// * `Err(Error)` - If the page could not be retrieved.
+    ///
+    /// # Errors
+    ///
+    /// * If the database connection could not be established.
+    /// * If the page or its text could not be retrieved.
+    ///
+    /// # Notes
+    ///
+    /// * The page is checked again, since it may have been marked `noarchive` after the link was issued.
+    pub async fn get(&self, page_id: i32) -> Result<Option<String>, Error> {
+        let Ok(mut conn) = database::get_connection().await else {
+            return Err(Error::Database("Failed to get database connection!".into()));
+        };
+
+        let Some(page) = database::get_page_by_id(&mut conn, page_id)
+            .await?
+            .filter(is_archived)
+        else {
+            return Ok(None);
+        };
+        let Some(text) = database::get_page_content(&mut conn, page_id, &self.codec).await? else {
+            return Ok(None);
+        };
+
+        Ok(Some(render(&page, &text)))
+    }
+
+    fn get_link_at(&self, page: &Page, now: u64) -> Option<String> {
+        if !is_archived(page) {
+            return None;
+        }
+
+        let expires_at = now + self.lifetime.as_secs();
+        let signature = self.sign(page.id, expires_at).finalize().into_bytes();
+
+        Some(format!(
+            "/cache/{}?sig={expires_at}.{}",
+            page.id,
+            hex::encode(signature)
+        ))
+    }
+
+    fn verify_at(&self, page_id: i32, signature: &str, now: u64) -> bool {
+        let Some((expires_at, signature)) = signature.split_once('.') else {
+            return false;
+        };
+        let (Ok(expires_at), Ok(signature)) = (expires_at.parse::<u64>(), hex::decode(signature))
+        else {
+            return false;
+        };
+
+        if now > expires_at || expires_at - now > self.lifetime.as_secs() {
+            return false;
+        }
+
+        self.sign(page_id, expires_at)
+            .verify_slice(&signature)
+            .is_ok()
+    }
+
+    #[allow(clippy::expect_used)]
+    fn sign(&self, page_id: i32, expires_at: u64) -> HmacSha256 {
+        let mut mac =
+            HmacSha256::new_from_slice(&self.secret).expect("HMAC can take a key of any size!");
+        mac.update(format!("cache.{page_id}.{expires_at}").as_bytes());
+
+        mac
+    }
+}
+
+/// Checks if a page may be shown from the cache.
+///
+/// # Arguments
+///
+/// * `page`: The page.
+///
+/// # Returns
+///
+/// * `bool` - Whether the page isn't marked `noarchive`, and isn't left out of search results.
+fn is_archived(page: &Page) -> bool {
+    !page.noarchive && !page.excluded
+}
+
+/// Renders the cached copy of a page.
+///
+/// # Arguments
+///
+/// * `page`: The page.
+/// * `text`: The text of the page, as it was indexed.
+///
+/// # Returns
+///
+/// * `String` - The HTML, with a banner showing when the page was crawled and where it's from.
+///
+/// # Notes
+///
+/// * Only the extracted text is shown, never the HTML of the page, so nothing of it runs or loads.
+fn render(page: &Page, text: &str) -> String {
+    let title = page.title.as_deref().unwrap_or(&page.url);
+
+    format!(
+        r#"<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex, nofollow">
+<title>{title}</title>
+</head>
+<body>
+<p><strong>This is the text of <a href="{url}" rel="nofollow">{display_url}</a> as it was crawled on {crawled_at}.</strong> The page may have changed since.</p>
+<hr>
+<h1>{title}</h1>
+<pre style="white-space: pre-wrap">{text}</pre>
+</body>
+</html>
+"#,
+        title = escape_html(title),
+        url = escape_html(&page.url),
+        display_url = escape_html(&search::get_display_url(&page.url)),
+        crawled_at = dates::format(page.last_crawled_at),
+        text = escape_html(text),
+    )
+}
+
+/// Escapes text, so it can be put in HTML.
+///
+/// # Arguments
+///
+/// * `text`: The text.
+///
+/// # Returns
+///
+/// * `String` - The text, with `&`, `<`, `>`, `"` and `'` escaped.
+fn escape_html(text: &str) -> String {
+    let mut escaped = String::with_capacity(text.len());
+    for c in text.chars() {
+        match c {
+            '&' => escaped.push_str("&amp;"),
+            '<' => escaped.push_str("&lt;"),
+            '>' => escaped.push_str("&gt;"),
+            '"' => escaped.push_str("&quot;"),
+            '\'' => escaped.push_str("&#39;"),
+            c => escaped.push(c),
+        }
+    }
+
+    escaped
+}
+
+fn get_timestamp() -> u64 {
+    SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .unwrap_or_default()
+        .as_secs()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn get_page(id: i32, noarchive: bool) -> Page {
+        Page {
+            id,
+            url: "https://example.com/".into(),
+            last_crawled_at: UNIX_EPOCH + Duration::from_secs(1_700_000_000),
+            title: Some("<Example>".into()),
+            description: None,
+            encoding: None,
+            index_fingerprint: None,
+            first_seen_at: UNIX_EPOCH,
+            language: None,
+            published_at: None,
+            content_modified_at: None,
+            authenticated: false,
+            excluded: false,
+            personalized: false,
+            unstable: false,
+            noarchive,
+            etag: None,
+            last_modified: None,
+        }
+    }
+
+    fn get_signature(link: &str) -> &str {
+        link.split_once("?sig=")
+            .map_or("", |(_, signature)| signature)
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_verify() {
+        let archive = Archive::new(
+            b"secret".to_vec(),
+            Duration::from_secs(60),
+            Codec::default(),
+        );
+        let now = 1_000_000;
+
+        let link = archive
+            .get_link_at(&get_page(1, false), now)
+            .expect("Failed to get cache link!");
+        assert!(link.starts_with("/cache/1?sig=1000060."));
+
+        let signature = get_signature(&link);
+        assert!(archive.verify_at(1, signature, now));
+        assert!(archive.verify_at(1, signature, now + 60));
+
+        // Expired, for another page, or tampered with.
+        assert!(!archive.verify_at(1, signature, now + 61));
+        assert!(!archive.verify_at(2, signature, now));
+        assert!(!archive.verify_at(1, &signature.replacen("1000060", "1000059", 1), now));
+        assert!(!archive.verify_at(1, "", now));
+        assert!(!archive.verify_at(1, "1000060.zz", now));
+
+        // Signed with another secret.
+        let other = Archive::new(b"other".to_vec(), Duration::from_secs(60), Codec::default());
+        assert!(!other.verify_at(1, signature, now));
+
+        // Expiring further out than the lifetime, so it wasn't issued for it.
+        let longer = Archive::new(
+            b"secret".to_vec(),
+            Duration::from_secs(120),
+            Codec::default(),
+        );
+        let link = longer
+            .get_link_at(&get_page(1, false), now)
+            .expect("Failed to get cache link!");
+        assert!(!archive.verify_at(1, get_signature(&link), now));
+    }
+
+    #[test]
+    fn test_noarchive() {
+        let archive = Archive::new(
+            b"secret".to_vec(),
+            Duration::from_secs(60),
+            Codec::default(),
+        );
+
+        assert_eq!(archive.get_link_at(&get_page(1, true), 0), None);
+        assert_eq!(
+            archive.get_link_at(
+                &Page {
+                    excluded: true,
+                    ..get_page(1, false)
+                },
+                0
+            ),
+            None
+        );
+    }
+
+    #[test]
+    fn test_render() {
+        let html = render(&get_page(1, false), "<script>alert(1)</script>");
+
+        assert!(html.contains("&lt;script&gt;alert(1)&lt;/script&gt;"));
+        assert!(!html.contains("<script>"));
+        assert!(html.contains("<title>&lt;Example&gt;</title>"));
+        assert!(html.contains("as it was crawled on 2023-11-14 22:13 UTC"));
+        assert!(html.contains(r#"<a href="https://example.com/" rel="nofollow">"#));
+    }
+}
@@ -0,0 +1,478 @@
+use common::database;
+use common::database::model::ClickStat;
+use common::errors::Error;
+use common::utils;
+use hmac::{Hmac, Mac};
+use log::info;
+use serde::{Deserialize, Serialize};
+use sha2::{Digest, Sha256};
+use std::collections::HashMap;
+use std::net::IpAddr;
+use std::sync::Mutex;
+use std::time::{Duration, Instant, SystemTime, UNIX_EPOCH};
+
+/// How long a click token is valid for after the search it was issued with.
+const CLICK_TOKEN_LIFETIME: Duration = Duration::from_secs(60 * 60);
+
+/// The window clicks are rate limited over.
+const RATE_LIMIT_WINDOW: Duration = Duration::from_secs(60);
+
+/// The number of clients to track before forgetting the ones outside the rate limit window.
+const RATE_LIMIT_CLIENTS: usize = 10_000;
+
+/// Parts of user agents that are treated as bots.
+const BOT_USER_AGENTS: [&str; 6] = ["bot", "crawl", "spider", "slurp", "curl", "wget"];
+
+type HmacSha256 = Hmac<Sha256>;
+
+/// A click on a search result.
+///
+/// # Fields
+///
+/// * `query`: The query the result was returned for.
+/// * `url`: The URL of the result.
+/// * `position`: The 1-based position the result was shown at.
+/// * `token`: The click token returned with the result.
+#[derive(Debug, Serialize, Deserialize)]
+pub struct Click {
+    #[serde(rename = "q")]
+    pub query: String,
+    pub url: String,
+    #[serde(rename = "pos")]
+    pub position: u32,
+    pub token: String,
+}
+
+/// Issues click tokens and rate limits the clients recording clicks.
+///
+/// # Fields
+///
+/// * `secret`: The secret click tokens are signed with.
+/// * `clicks_per_minute`: The number of clicks a single client can record per minute.
+/// * `clients`: When each client's rate limit window started, and how many clicks it recorded since.
+#[derive(Debug)]
+pub struct Tracker {
+    secret: Vec<u8>,
+    clicks_per_minute: u32,
+    clients: Mutex<HashMap<String, (Instant, u32)>>,
+}
+
+impl Tracker {
+    /// Creates a new tracker.
+    ///
+    /// # Arguments
+    ///
+    /// * `secret`: The secret to sign click tokens with.
+    /// * `clicks_per_minute`: The number of clicks a single client can record per minute.
+    ///
+    /// # Returns
+    ///
+    /// * `Tracker` - The new tracker.
+    #[must_use]
+    pub fn new(secret: Vec<u8>, clicks_per_minute: u32) -> Self {
+        Self {
+            secret,
+            clicks_per_minute,
+            clients: Mutex::new(HashMap::new()),
+        }
+    }
+
+    /// Creates a new tracker from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Tracker` - The new tracker.
+    ///
+    /// # Notes
+    ///
+    /// * If `CLICK_TOKEN_SECRET` isn't set, a random secret is used.
+    #[must_use]
+    pub fn load() -> Self {
+        let secret = utils::env::search::get_click_token_secret().map_or_else(
+            || rand::random::<[u8; 32]>().to_vec(),
+            std::string::String::into_bytes,
+        );
+
+        Self::new(secret, utils::env::search::get_clicks_per_minute())
+    }
+
+    /// Issues a click token for a result of a query.
+    ///
+    /// # Arguments
+    ///
+    /// * `query_hash`: The hash of the query.
+    /// * `variant`: The ranking variant the results were ranked with.
+    /// * `url`: The URL of the result.
+    /// * `position`: The 1-based position the result is shown at.
+    ///
+    /// # Returns
+    ///
+    /// * `String` - The click token.
+    ///
+    /// # Notes
+    ///
+    /// * The token is only valid for clicks on this result, so it can't be reused to record clicks on other URLs or positions.
+    #[must_use]
+    pub fn issue_token(&self, query_hash: &str, variant: &str, url: &str, position: u32) -> String {
+        self.issue_token_at(query_hash, variant, url, position, get_timestamp())
+    }
+
+    /// Verifies that a click token was issued by this tracker for a result of a query, and hasn't expired.
+    ///
+    /// # Arguments
+    ///
+    /// * `token`: The click token.
+    /// * `query_hash`: The hash of the query.
+    /// * `url`: The URL of the result.
+    /// * `position`: The 1-based position the result was shown at.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(&str)` - The ranking variant the results were ranked with, if the click token is valid.
+    /// * `None` - If the click token is invalid.
+    #[must_use]
+    pub fn verify_token<'a>(
+        &self,
+        token: &'a str,
+        query_hash: &str,
+        url: &str,
+        position: u32,
+    ) -> Option<&'a str> {
+        self.verify_token_at(token, query_hash, url, position, get_timestamp())
+    }
+
+    /// Records a click from a client, and checks if it's over its rate limit.
+    ///
+    /// # Arguments
+    ///
+    /// * `client`: The truncated IP address of the client.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the client has recorded too many clicks.
+    #[must_use]
+    pub fn is_rate_limited(&self, client: &str) -> bool {
+        let now = Instant::now();
+        let Ok(mut clients) = self.clients.lock() else {
+            return true;
+        };
+
+        if clients.len() >= RATE_LIMIT_CLIENTS {
+            clients
+                .retain(|_, (started_at, _)| now.duration_since(*started_at) < RATE_LIMIT_WINDOW);
+        }
+
+        let (started_at, clicks) = clients.entry(client.to_string()).or_insert((now, 0));
+        if now.duration_since(*started_at) >= RATE_LIMIT_WINDOW {
+            *started_at = now;
+            *clicks = 0;
+        }
+
+        *clicks += 1;
+
+        *clicks > self.clicks_per_minute
+    }
+
+    fn issue_token_at(
+        &self,
+        query_hash: &str,
+        variant: &str,
+        url: &str,
+        position: u32,
+        issued_at: u64,
+    ) -> String {
+        let signature = self
+            .sign(query_hash, variant, url, position, issued_at)
+            .finalize()
+            .into_bytes();
+
+        format!("{issued_at}.{variant}.{}", hex::encode(signature))
+    }
+
+    fn verify_token_at<'a>(
+        &self,
+        token: &'a str,
+        query_hash: &str,
+        url: &str,
+        position: u32,
+        now: u64,
+    ) -> Option<&'a str> {
+        let mut parts = token.splitn(3, '.');
+        let issued_at = parts.next()?.parse::<u64>().ok()?;
+        let variant = parts.next()?;
+        let signature = hex::decode(parts.next()?).ok()?;
+
+        if issued_at > now || now - issued_at > CLICK_TOKEN_LIFETIME.as_secs() {
+            return None;
+        }
+
+        self.sign(query_hash, variant, url, position, issued_at)
+            .verify_slice(&signature)
+            .ok()?;
+
+        Some(variant)
+    }
+
+    #[allow(clippy::expect_used)]
+    fn sign(
+        &self,
+        query_hash: &str,
+        variant: &str,
+        url: &str,
+        position: u32,
+        issued_at: u64,
+    ) -> HmacSha256 {
+        let mut mac =
+            HmacSha256::new_from_slice(&self.secret).expect("HMAC can take a key of any size!");
+
+        // The URL goes last, so the dots in it can't be mistaken for the end of another field.
+        mac.update(format!("{query_hash}.{variant}.{issued_at}.{position}.{url}").as_bytes());
+
+        mac
+    }
+}
+
+/// Hashes a query, so clicks can be grouped by query without storing it.
+///
+/// # Arguments
+///
+/// * `query`: The stemmed words of the query.
+///
+/// # Returns
+///
+/// * `String` - The SHA-256 hash of the words, in hex.
+#[must_use]
+pub fn hash_query<S: std::hash::BuildHasher>(query: &HashMap<String, usize, S>) -> String {
+    let mut words = query.keys().map(String::as_str).collect::<Vec<_>>();
+    words.sort_unstable();
+
+    hex::encode(Sha256::digest(words.join(" ")))
+}
+
+/// Truncates an IP address, so it can't be traced back to a single client.
+///
+/// # Arguments
+///
+/// * `ip`: The IP address.
+///
+/// # Returns
+///
+/// * `String` - The `/24` network of IPv4 addresses, and the `/48` network of IPv6 addresses.
+#[must_use]
+pub fn truncate_ip(ip: IpAddr) -> String {
+    match ip {
+        IpAddr::V4(ip) => {
+            let [a, b, c, _] = ip.octets();
+
+            format!("{a}.{b}.{c}.0/24")
+        }
+        IpAddr::V6(ip) => {
+            let [a, b, c, ..] = ip.segments();
+
+            format!("{a:x}:{b:x}:{c:x}::/48")
+        }
+    }
+}
+
+/// Checks if a user agent belongs to a bot.
+///
+/// # Arguments
+///
+/// * `user_agent`: The user agent, if any.
+///
+/// # Returns
+///
+/// * `bool` - Whether the user agent is missing, or belongs to a bot.
+#[must_use]
+pub fn is_bot(user_agent: Option<&str>) -> bool {
+    user_agent.map_or(true, |user_agent| {
+        let user_agent = user_agent.to_lowercase();
+
+        BOT_USER_AGENTS.iter().any(|bot| user_agent.contains(bot))
+    })
+}
+
+/// Calculates the click-through rate of each result of each query.
+///
+/// # Arguments
+///
+/// * `counts`: The query hash, URL, position and number of clicks of each result.
+///
+/// # Returns
+///
+/// * `Vec<ClickStat>` - The click statistics of each result of each query.
+///
+/// # Notes
+///
+/// * Results further down are examined less, so each click is weighted by its position to correct for the bias.
+/// * The weighted clicks are normalized per query, so the click-through rates of a query's results sum to `1.0`.
+#[must_use]
+#[allow(clippy::cast_precision_loss)]
+pub fn get_click_stats(counts: &[(String, String, i32, i64)]) -> Vec<ClickStat> {
+    let mut results = HashMap::new();
+    let mut totals = HashMap::new();
+    for (query_hash, url, position, clicks) in counts {
+        let weighted_clicks = *clicks as f64 * f64::from((*position).max(1));
+
+        let (result_clicks, result_weighted_clicks) =
+            results.entry((query_hash, url)).or_insert((0_i64, 0.0_f64));
+        *result_clicks += clicks;
+        *result_weighted_clicks += weighted_clicks;
+
+        *totals.entry(query_hash).or_insert(0.0_f64) += weighted_clicks;
+    }
+
+    results
+        .into_iter()
+        .map(|((query_hash, url), (clicks, weighted_clicks))| {
+            let total = totals.get(query_hash).copied().unwrap_or_default();
+
+            ClickStat {
+                query_hash: query_hash.clone(),
+                url: url.clone(),
+                clicks: i32::try_from(clicks).unwrap_or(i32::MAX),
+                click_through_rate: if total > 0.0 {
+                    weighted_clicks / total
+                } else {
+                    0.0
+                },
+            }
+        })
+        .collect()
+}
+
+/// Recalculates the click statistics from the recorded clicks.
+///
+/// # Returns
+///
+/// * `Ok(usize)` - The number of click statistics if successful.
+/// * `Err(Error)` - If the click statistics could not be recalculated.
+///
+/// # Errors
+///
+/// * If the clicks could not be retrieved.
+/// * If the click statistics could not be replaced.
+pub async fn aggregate() -> Result<usize, Error> {
+    let counts = database::get_click_counts().await?;
+    let stats = get_click_stats(&counts);
+
+    info!(
+        "Aggregated {} click statistics from {} click counts...",
+        stats.len(),
+        counts.len()
+    );
+    database::replace_click_stats(&stats).await?;
+
+    Ok(stats.len())
+}
+
+fn get_timestamp() -> u64 {
+    SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .unwrap_or_default()
+        .as_secs()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_click_tokens() {
+        const URL: &str = "https://example.com/";
+
+        let tracker = Tracker::new(b"secret".to_vec(), 30);
+        let token = tracker.issue_token_at("query", "control", URL, 2, 1_000);
+        let verify = |token: &str, query_hash: &str, url: &str, position: u32, now: u64| {
+            tracker
+                .verify_token_at(token, query_hash, url, position, now)
+                .map(str::to_string)
+        };
+
+        assert_eq!(
+            verify(&token, "query", URL, 2, 1_000).as_deref(),
+            Some("control")
+        );
+        assert_eq!(
+            verify(&token, "query", URL, 2, 1_000 + 60 * 60).as_deref(),
+            Some("control")
+        );
+
+        // Expired, from the future, or for another query.
+        assert!(verify(&token, "query", URL, 2, 1_001 + 60 * 60).is_none());
+        assert!(verify(&token, "query", URL, 2, 999).is_none());
+        assert!(verify(&token, "other query", URL, 2, 1_000).is_none());
+
+        // For another result, at another position.
+        assert!(verify(&token, "query", "https://example.com/other", 2, 1_000).is_none());
+        assert!(verify(&token, "query", URL, 1, 1_000).is_none());
+
+        // Signed with another secret, or tampered with.
+        let other_tracker = Tracker::new(b"other secret".to_vec(), 30);
+        assert!(other_tracker
+            .verify_token_at(&token, "query", URL, 2, 1_000)
+            .is_none());
+        assert!(verify(&token.replacen("1000", "1001", 1), "query", URL, 2, 1_001).is_none());
+        assert!(verify(
+            &token.replacen("control", "other", 1),
+            "query",
+            URL,
+            2,
+            1_000
+        )
+        .is_none());
+        assert!(verify("garbage", "query", URL, 2, 1_000).is_none());
+    }
+
+    #[test]
+    fn test_rate_limit() {
+        let tracker = Tracker::new(b"secret".to_vec(), 2);
+
+        assert!(!tracker.is_rate_limited("1.2.3.0/24"));
+        assert!(!tracker.is_rate_limited("1.2.3.0/24"));
+        assert!(tracker.is_rate_limited("1.2.3.0/24"));
+        assert!(!tracker.is_rate_limited("4.5.6.0/24"));
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_click_stats() {
+        let counts = vec![
+            ("a".to_string(), "https://first.com/".to_string(), 1, 4),
+            ("a".to_string(), "https://second.com/".to_string(), 2, 1),
+            ("a".to_string(), "https://second.com/".to_string(), 3, 1),
+            ("b".to_string(), "https://first.com/".to_string(), 5, 2),
+        ];
+        let stats = get_click_stats(&counts);
+        let get = |query_hash: &str, url: &str| {
+            stats
+                .iter()
+                .find(|stat| stat.query_hash == query_hash && stat.url == url)
+                .expect("Failed to find click statistic!")
+        };
+
+        // 4 clicks at the top are worth as much as 1 click at the second and 1 at the third position put together.
+        let first = get("a", "https://first.com/");
+        let second = get("a", "https://second.com/");
+        assert_eq!(first.clicks, 4);
+        assert_eq!(second.clicks, 2);
+        assert!((first.click_through_rate - 4.0 / 9.0).abs() < f64::EPSILON);
+        assert!((second.click_through_rate - 5.0 / 9.0).abs() < f64::EPSILON);
+
+        // Each query is normalized on its own.
+        assert!((get("b", "https://first.com/").click_through_rate - 1.0).abs() < f64::EPSILON);
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_truncate_ip() {
+        assert_eq!(
+            truncate_ip("192.168.1.42".parse().expect("Invalid IP!")),
+            "192.168.1.0/24"
+        );
+        assert_eq!(
+            truncate_ip("2001:db8:85a3::8a2e:370:7334".parse().expect("Invalid IP!")),
+            "2001:db8:85a3::/48"
+        );
+    }
+}
@@ -0,0 +1,136 @@
+use actix_web::HttpRequest;
+use common::utils;
+use std::net::{IpAddr, SocketAddr};
+
+/// The header reverse proxies append the addresses they forwarded a request for to.
+const X_FORWARDED_FOR: &str = "X-Forwarded-For";
+
+/// Gets the IP address of the client of a request.
+///
+/// # Arguments
+///
+/// * `request`: The request.
+///
+/// # Returns
+///
+/// * `Some(IpAddr)` - The IP address of the client.
+/// * `None` - If the address of the client is unknown or invalid.
+///
+/// # Notes
+///
+/// * `X-Forwarded-For` is only honored if the request came from one of the `TRUSTED_PROXIES`, since anyone can set it.
+#[must_use]
+pub fn get_ip(request: &HttpRequest) -> Option<IpAddr> {
+    let peer = request.peer_addr()?.ip();
+    let forwarded_for = request
+        .headers()
+        .get_all(X_FORWARDED_FOR)
+        .filter_map(|forwarded_for| forwarded_for.to_str().ok())
+        .collect::<Vec<_>>()
+        .join(",");
+
+    get_client_ip(
+        peer,
+        &forwarded_for,
+        &utils::env::web::get_trusted_proxies(),
+    )
+}
+
+/// Gets the IP address of a client from the addresses a request was forwarded for.
+///
+/// # Arguments
+///
+/// * `peer`: The IP address the request came from.
+/// * `forwarded_for`: The `X-Forwarded-For` header of the request, empty if it has none.
+/// * `trusted_proxies`: The IP addresses of the trusted proxies.
+///
+/// # Returns
+///
+/// * `Some(IpAddr)` - The IP address of the client.
+/// * `None` - If a trusted proxy forwarded the request for an invalid address.
+///
+/// # Notes
+///
+/// * Proxies append to the header, so it's read from the right, stopping at the first address that isn't trusted.
+/// * Addresses to the left of that were set by the client, and are ignored.
+#[must_use]
+pub fn get_client_ip(
+    peer: IpAddr,
+    forwarded_for: &str,
+    trusted_proxies: &[IpAddr],
+) -> Option<IpAddr> {
+    let mut ip = peer;
+    for address in forwarded_for
+        .rsplit(',')
+        .map(str::trim)
+        .filter(|address| !address.is_empty())
+    {
+        if !trusted_proxies.contains(&ip) {
+            break;
+        }
+
+        ip = address
+            .parse::<SocketAddr>()
+            .map(|address| address.ip())
+            .or_else(|_| address.parse::<IpAddr>())
+            .ok()?;
+    }
+
+    Some(ip)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_client_ip() {
+        let ip = |ip: &str| ip.parse::<IpAddr>().expect("Invalid IP!");
+        let trusted_proxies = [ip("10.0.0.1"), ip("10.0.0.2")];
+
+        // Requests that didn't come from a trusted proxy can't pick their own address.
+        assert_eq!(
+            get_client_ip(ip("203.0.113.7"), "198.51.100.1", &trusted_proxies),
+            Some(ip("203.0.113.7"))
+        );
+        assert_eq!(
+            get_client_ip(ip("203.0.113.7"), "198.51.100.1", &[]),
+            Some(ip("203.0.113.7"))
+        );
+
+        // Forwarded through each trusted proxy in turn.
+        assert_eq!(
+            get_client_ip(ip("10.0.0.1"), "203.0.113.7", &trusted_proxies),
+            Some(ip("203.0.113.7"))
+        );
+        assert_eq!(
+            get_client_ip(
+                ip("10.0.0.1"),
+                "203.0.113.7:4711, 10.0.0.2",
+                &trusted_proxies
+            ),
+            Some(ip("203.0.113.7"))
+        );
+        assert_eq!(
+            get_client_ip(ip("10.0.0.1"), "[2001:db8::1]:443", &trusted_proxies),
+            Some(ip("2001:db8::1"))
+        );
+
+        // Addresses the client added before the first proxy are ignored.
+        assert_eq!(
+            get_client_ip(ip("10.0.0.1"), "127.0.0.1, 203.0.113.7", &trusted_proxies),
+            Some(ip("203.0.113.7"))
+        );
+
+        // A trusted proxy without a header is the client, and one with an invalid header has none.
+        assert_eq!(
+            get_client_ip(ip("10.0.0.1"), "", &trusted_proxies),
+            Some(ip("10.0.0.1"))
+        );
+        assert_eq!(
+            get_client_ip(ip("10.0.0.1"), "unknown", &trusted_proxies),
+            None
+        );
+    }
+}
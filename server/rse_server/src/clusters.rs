@@ -0,0 +1,276 @@
+use common::database::model::Keyword;
+use serde::Serialize;
+use std::collections::{HashMap, HashSet};
+
+/// The number of most frequent terms of a page its topic is made of.
+const MAXIMUM_TERMS: usize = 20;
+
+/// The minimum cosine similarity of two clusters for them to be merged.
+const MINIMUM_SIMILARITY: f64 = 0.2;
+
+/// The number of terms a cluster is labeled with.
+const LABEL_TERMS: usize = 3;
+
+/// The weights of the terms of a page or cluster.
+type Vector = HashMap<String, f64>;
+
+/// A group of results about the same topic.
+///
+/// # Fields
+///
+/// * `label`: The stemmed terms that set the results of the cluster apart from the rest, most distinctive first.
+/// * `results`: The indexes of the results in the cluster, on the current page of results.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Cluster {
+    pub label: Vec<String>,
+    pub results: Vec<usize>,
+}
+
+/// Groups the results of a query by their topic.
+///
+/// # Arguments
+///
+/// * `pages`: The keywords of each result, in the order they're ranked.
+/// * `query`: The stemmed words of the query, which are left out of the topics since every result has them.
+///
+/// # Returns
+///
+/// * `Vec<Cluster>` - The clusters, ordered by their best ranked result.
+///
+/// # Notes
+///
+/// * The most similar clusters are merged until no two are similar enough, starting with a cluster per result.
+/// * Results without keywords, like pinned pages, are left in clusters of their own.
+#[must_use]
+pub fn cluster(pages: &[&[Keyword]], query: &HashSet<&str>) -> Vec<Cluster> {
+    let vectors = pages
+        .iter()
+        .map(|keywords| get_vector(keywords, query))
+        .collect::<Vec<_>>();
+    let mut clusters = vectors
+        .iter()
+        .cloned()
+        .enumerate()
+        .map(|(index, vector)| (vec![index], vector))
+        .collect::<Vec<_>>();
+
+    // Merge the two most similar clusters, until none are similar enough.
+    loop {
+        let mut most_similar: Option<(usize, usize, f64)> = None;
+        for a in 0..clusters.len() {
+            for b in a + 1..clusters.len() {
+                let similarity = get_similarity(&clusters[a].1, &clusters[b].1);
+                if similarity >= MINIMUM_SIMILARITY
+                    && most_similar.map_or(true, |(_, _, highest)| similarity > highest)
+                {
+                    most_similar = Some((a, b, similarity));
+                }
+            }
+        }
+
+        let Some((a, b, _)) = most_similar else {
+            break;
+        };
+
+        let (results, vector) = clusters.remove(b);
+        clusters[a].0.extend(results);
+        for (term, weight) in vector {
+            *clusters[a].1.entry(term).or_default() += weight;
+        }
+    }
+
+    let mut clusters = clusters
+        .into_iter()
+        .map(|(mut results, centroid)| {
+            results.sort_unstable();
+
+            Cluster {
+                label: get_label(&results, &centroid, &vectors),
+                results,
+            }
+        })
+        .collect::<Vec<_>>();
+    clusters.sort_by_key(|cluster| cluster.results.first().copied());
+
+    clusters
+}
+
+/// Gets the topic of a page, from its most frequent terms.
+///
+/// # Arguments
+///
+/// * `keywords`: The keywords of the page.
+/// * `query`: The stemmed words of the query, which are left out.
+///
+/// # Returns
+///
+/// * `Vector` - The frequencies of the `MAXIMUM_TERMS` most frequent terms, scaled to a length of `1.0`.
+///
+/// # Notes
+///
+/// * The frequencies of a term in the title, body and images of the page are added up.
+fn get_vector(keywords: &[Keyword], query: &HashSet<&str>) -> Vector {
+    let mut frequencies = HashMap::<&str, i32>::new();
+    for keyword in keywords {
+        if !query.contains(keyword.word.as_str()) {
+            *frequencies.entry(keyword.word.as_str()).or_default() += keyword.frequency;
+        }
+    }
+
+    let mut terms = frequencies.into_iter().collect::<Vec<_>>();
+    terms.sort_by(|(term_a, frequency_a), (term_b, frequency_b)| {
+        frequency_b
+            .cmp(frequency_a)
+            .then_with(|| term_a.cmp(term_b))
+    });
+    terms.truncate(MAXIMUM_TERMS);
+
+    let length = terms
+        .iter()
+        .map(|(_, frequency)| f64::from(*frequency).powi(2))
+        .sum::<f64>()
+        .sqrt();
+    if length == 0.0 {
+        return Vector::new();
+    }
+
+    terms
+        .into_iter()
+        .map(|(term, frequency)| (term.to_string(), f64::from(frequency) / length))
+        .collect()
+}
+
+/// Gets the cosine similarity of two topics.
+///
+/// # Arguments
+///
+/// * `a`: The first topic.
+/// * `b`: The second topic.
+///
+/// # Returns
+///
+/// * `f64` - The similarity, `1.0` for the same topic and `0.0` for topics without terms in common.
+fn get_similarity(a: &Vector, b: &Vector) -> f64 {
+    let length = |vector: &Vector| {
+        vector
+            .values()
+            .map(|weight| weight.powi(2))
+            .sum::<f64>()
+            .sqrt()
+    };
+    let lengths = length(a) * length(b);
+    if lengths == 0.0 {
+        return 0.0;
+    }
+
+    a.iter()
+        .filter_map(|(term, weight)| b.get(term).map(|other| weight * other))
+        .sum::<f64>()
+        / lengths
+}
+
+/// Gets the label of a cluster.
+///
+/// # Arguments
+///
+/// * `results`: The indexes of the results in the cluster.
+/// * `centroid`: The topic of the cluster.
+/// * `vectors`: The topics of every result.
+///
+/// # Returns
+///
+/// * `Vec<String>` - The `LABEL_TERMS` terms found on the most results in the cluster, and the fewest outside of it.
+#[allow(clippy::cast_precision_loss)]
+fn get_label(results: &[usize], centroid: &Vector, vectors: &[Vector]) -> Vec<String> {
+    let outside = vectors.len() - results.len();
+    let share = |count: usize, total: usize| {
+        if total == 0 {
+            0.0
+        } else {
+            count as f64 / total as f64
+        }
+    };
+
+    let mut terms = centroid
+        .iter()
+        .map(|(term, weight)| {
+            let count = vectors
+                .iter()
+                .filter(|vector| vector.contains_key(term))
+                .count();
+            let inside_count = results
+                .iter()
+                .filter(|&&index| vectors[index].contains_key(term))
+                .count();
+
+            (
+                term,
+                share(inside_count, results.len()) - share(count - inside_count, outside),
+                *weight,
+            )
+        })
+        .collect::<Vec<_>>();
+    terms.sort_by(|(term_a, score_a, weight_a), (term_b, score_b, weight_b)| {
+        score_b
+            .total_cmp(score_a)
+            .then_with(|| weight_b.total_cmp(weight_a))
+            .then_with(|| term_a.cmp(term_b))
+    });
+
+    terms
+        .into_iter()
+        .take(LABEL_TERMS)
+        .map(|(term, _, _)| term.clone())
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn get_keywords(words: &[(&str, i32)]) -> Vec<Keyword> {
+        words
+            .iter()
+            .map(|(word, frequency)| Keyword {
+                id: 0,
+                page_id: 0,
+                word: (*word).to_string(),
+                frequency: *frequency,
+                positions: Vec::new(),
+                field: "body".into(),
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_cluster() {
+        let pages = [
+            get_keywords(&[("jaguar", 5), ("car", 4), ("engin", 3), ("speed", 1)]),
+            get_keywords(&[("jaguar", 5), ("cat", 4), ("jungl", 3), ("prey", 2)]),
+            get_keywords(&[("jaguar", 2), ("car", 3), ("engin", 2), ("dealer", 2)]),
+            get_keywords(&[("jaguar", 3), ("cat", 2), ("prey", 2), ("spot", 1)]),
+            Vec::new(),
+        ];
+        let pages = pages.iter().map(Vec::as_slice).collect::<Vec<_>>();
+        let query = HashSet::from(["jaguar"]);
+
+        assert_eq!(
+            cluster(&pages, &query),
+            vec![
+                Cluster {
+                    label: vec!["car".into(), "engin".into(), "dealer".into()],
+                    results: vec![0, 2],
+                },
+                Cluster {
+                    label: vec!["cat".into(), "prey".into(), "jungl".into()],
+                    results: vec![1, 3],
+                },
+                Cluster {
+                    label: Vec::new(),
+                    results: vec![4],
+                },
+            ]
+        );
+        assert_eq!(cluster(&[], &query), Vec::new());
+    }
+}
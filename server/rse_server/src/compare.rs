@@ -0,0 +1,252 @@
+use crate::experiments::{Experiments, Variant};
+use serde::{Deserialize, Serialize};
+use std::collections::{HashMap, HashSet};
+
+/// The query of a comparison of ranking variants.
+///
+/// # Fields
+///
+/// * `variants`: The comma separated names of the variants to compare, defaults to every variant.
+#[derive(Debug, Default, Deserialize)]
+pub struct Query {
+    pub variants: Option<String>,
+}
+
+impl Query {
+    /// Gets the variants to compare.
+    ///
+    /// # Arguments
+    ///
+    /// * `experiments`: The ranking variants.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Vec<&Variant>)` - The variants, in the order they were given.
+    /// * `None` - If a variant doesn't exist.
+    #[must_use]
+    pub fn get_variants<'a>(&self, experiments: &'a Experiments) -> Option<Vec<&'a Variant>> {
+        let Some(names) = &self.variants else {
+            return experiments
+                .names()
+                .map(|name| experiments.get(name))
+                .collect();
+        };
+
+        let mut seen = HashSet::new();
+        names
+            .split(',')
+            .map(str::trim)
+            .filter(|name| !name.is_empty() && seen.insert(*name))
+            .map(|name| experiments.get(name))
+            .collect()
+    }
+}
+
+/// The URLs a variant ranked.
+///
+/// # Fields
+///
+/// * `variant`: The name of the variant.
+/// * `urls`: The requested page of URLs, best ranked first.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct Ranking {
+    pub variant: String,
+    pub urls: Vec<String>,
+}
+
+/// How much the rankings of two variants agree.
+///
+/// # Fields
+///
+/// * `a`: The name of the first variant.
+/// * `b`: The name of the second variant.
+/// * `overlap`: The number of URLs both variants ranked.
+/// * `tau`: The Kendall rank correlation of the rankings, if there are enough URLs to tell.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct Correlation {
+    pub a: String,
+    pub b: String,
+    pub overlap: usize,
+    pub tau: Option<f64>,
+}
+
+/// The rankings of several variants for the same query.
+///
+/// # Fields
+///
+/// * `rankings`: The URLs each variant ranked, in the order the variants were given.
+/// * `correlations`: How much each pair of variants agrees.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct Comparison {
+    pub rankings: Vec<Ranking>,
+    pub correlations: Vec<Correlation>,
+}
+
+/// Compares the rankings of several variants.
+///
+/// # Arguments
+///
+/// * `variants`: The variants.
+/// * `rankings`: The URLs each variant ranked, in the same order.
+///
+/// # Returns
+///
+/// * `Comparison` - The rankings, and the correlation of each pair of them.
+#[must_use]
+pub fn compare(variants: &[&Variant], rankings: Vec<Vec<String>>) -> Comparison {
+    let rankings = variants
+        .iter()
+        .zip(rankings)
+        .map(|(variant, urls)| Ranking {
+            variant: variant.name.clone(),
+            urls,
+        })
+        .collect::<Vec<_>>();
+
+    let mut correlations = Vec::new();
+    for (index, a) in rankings.iter().enumerate() {
+        for b in &rankings[index + 1..] {
+            let (overlap, tau) = get_correlation(&a.urls, &b.urls);
+
+            correlations.push(Correlation {
+                a: a.variant.clone(),
+                b: b.variant.clone(),
+                overlap,
+                tau,
+            });
+        }
+    }
+
+    Comparison {
+        rankings,
+        correlations,
+    }
+}
+
+/// Gets the Kendall rank correlation of two rankings.
+///
+/// # Arguments
+///
+/// * `a`: The first ranking, best ranked first.
+/// * `b`: The second ranking, best ranked first.
+///
+/// # Returns
+///
+/// * `(usize, Option<f64>)` - The number of URLs in both rankings, and the correlation from `-1.0` for reversed rankings to `1.0` for the same ones.
+///
+/// # Notes
+///
+/// * Every URL in either ranking is compared, with the ones a ranking left out tied below the rest of it.
+/// * Ties are accounted for like `tau-b`, so the correlation is `None` if either ranking is tied throughout.
+fn get_correlation(a: &[String], b: &[String]) -> (usize, Option<f64>) {
+    let (positions_a, positions_b) = (get_positions(a), get_positions(b));
+
+    let mut urls = positions_a.keys().copied().collect::<Vec<_>>();
+    urls.extend(
+        positions_b
+            .keys()
+            .filter(|url| !positions_a.contains_key(*url)),
+    );
+    let overlap = positions_a
+        .keys()
+        .filter(|url| positions_b.contains_key(*url))
+        .count();
+
+    let ranks = urls
+        .iter()
+        .map(|url| {
+            (
+                positions_a.get(url).copied().unwrap_or(a.len()),
+                positions_b.get(url).copied().unwrap_or(b.len()),
+            )
+        })
+        .collect::<Vec<_>>();
+
+    let (mut concordant, mut discordant, mut tied_a, mut tied_b, mut pairs) = (0, 0, 0, 0, 0);
+    for (index, (rank_a, rank_b)) in ranks.iter().enumerate() {
+        for (other_a, other_b) in &ranks[index + 1..] {
+            pairs += 1;
+
+            let order_a = rank_a.cmp(other_a);
+            let order_b = rank_b.cmp(other_b);
+            if order_a.is_eq() {
+                tied_a += 1;
+            }
+            if order_b.is_eq() {
+                tied_b += 1;
+            }
+
+            if order_a.is_ne() && order_b.is_ne() {
+                if order_a == order_b {
+                    concordant += 1;
+                } else {
+                    discordant += 1;
+                }
+            }
+        }
+    }
+
+    let denominator = (f64::from(pairs - tied_a) * f64::from(pairs - tied_b)).sqrt();
+    if denominator == 0.0 {
+        return (overlap, None);
+    }
+
+    (
+        overlap,
+        Some(f64::from(concordant - discordant) / denominator),
+    )
+}
+
+/// Gets the position of each URL in a ranking.
+///
+/// # Arguments
+///
+/// * `ranking`: The ranking, best ranked first.
+///
+/// # Returns
+///
+/// * `HashMap<&str, usize>` - The first position of each URL, starting at `0`.
+fn get_positions(ranking: &[String]) -> HashMap<&str, usize> {
+    ranking
+        .iter()
+        .enumerate()
+        .rev()
+        .map(|(position, url)| (url.as_str(), position))
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn get_urls(urls: &[&str]) -> Vec<String> {
+        urls.iter().map(|url| (*url).to_string()).collect()
+    }
+
+    #[test]
+    fn test_get_correlation() {
+        let ranking = get_urls(&["a", "b", "c", "d"]);
+
+        assert_eq!(get_correlation(&ranking, &ranking), (4, Some(1.0)));
+        assert_eq!(
+            get_correlation(&ranking, &get_urls(&["d", "c", "b", "a"])),
+            (4, Some(-1.0))
+        );
+
+        // A single swap of neighbours leaves 5 of the 6 pairs in order.
+        let (overlap, tau) = get_correlation(&ranking, &get_urls(&["a", "c", "b", "d"]));
+        assert_eq!(overlap, 4);
+        assert!(tau.is_some_and(|tau| (tau - 4.0 / 6.0).abs() < 1e-9));
+
+        // URLs left out of a ranking are tied below it.
+        let (overlap, tau) = get_correlation(&get_urls(&["a", "b"]), &get_urls(&["a", "c"]));
+        assert_eq!(overlap, 1);
+        assert!(tau.is_some_and(|tau| tau > 0.0 && tau < 1.0));
+
+        assert_eq!(
+            get_correlation(&get_urls(&["a"]), &get_urls(&["a"])),
+            (1, None)
+        );
+        assert_eq!(get_correlation(&[], &[]), (0, None));
+    }
+}
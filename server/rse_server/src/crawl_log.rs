@@ -0,0 +1,364 @@
+use common::database::model::{CrawlEvent, CrawlLogFilter};
+use common::errors::Error;
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+
+/// The number of crawls in a page of the crawl log, if the query doesn't say.
+pub const DEFAULT_LIMIT: i64 = 100;
+
+/// The maximum number of crawls in a page of the crawl log.
+pub const MAXIMUM_LIMIT: i64 = 1_000;
+
+/// The maximum time span a query of the crawl log may cover, seven days.
+pub const MAXIMUM_WINDOW: Duration = Duration::from_secs(7 * 24 * 60 * 60);
+
+/// The query of the crawl log.
+///
+/// # Fields
+///
+/// * `host`: The host the crawls must be of, if any.
+/// * `status`: The HTTP status code the crawls must have, if any.
+/// * `error_code`: The code of the error the crawls must have failed with, if any.
+/// * `since`: The earliest time the crawls may be from in seconds since the Unix epoch, defaults to `MAXIMUM_WINDOW` before `until`.
+/// * `until`: The time the crawls must be from before in seconds since the Unix epoch, defaults to now.
+/// * `limit`: The maximum number of crawls to return, defaults to `DEFAULT_LIMIT`.
+/// * `cursor`: The cursor of the previous page, to continue after it.
+/// * `summary`: Whether to count the crawls by error code and status class instead of listing them.
+#[derive(Debug, Default, Deserialize)]
+pub struct Query {
+    pub host: Option<String>,
+    pub status: Option<i32>,
+    pub error_code: Option<String>,
+    pub since: Option<u64>,
+    pub until: Option<u64>,
+    pub limit: Option<i64>,
+    pub cursor: Option<String>,
+    #[serde(default)]
+    pub summary: u8,
+}
+
+/// A page of the crawl log.
+///
+/// # Fields
+///
+/// * `events`: The crawls, newest first.
+/// * `next_cursor`: The cursor to get the next page with, if there may be one.
+#[derive(Debug, Serialize)]
+pub struct Page {
+    pub events: Vec<CrawlEvent>,
+    pub next_cursor: Option<String>,
+}
+
+/// The number of crawls with an error code and status class.
+///
+/// # Fields
+///
+/// * `error_code`: The code of the error the crawls failed with, if any.
+/// * `status_class`: The class of the HTTP status code of the crawls, like `4xx`, if they got a response.
+/// * `crawls`: The number of crawls.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Count {
+    pub error_code: Option<String>,
+    pub status_class: Option<String>,
+    pub crawls: i64,
+}
+
+impl Query {
+    /// Gets the filters of the query.
+    ///
+    /// # Arguments
+    ///
+    /// * `now`: The current time.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(CrawlLogFilter)` - The filters, with the window capped at `MAXIMUM_WINDOW`.
+    /// * `Err(Error)` - If the window is empty.
+    ///
+    /// # Errors
+    ///
+    /// * If `since` isn't before `until`.
+    pub fn get_filter(&self, now: SystemTime) -> Result<CrawlLogFilter, Error> {
+        let until = self
+            .until
+            .map_or(now, |until| UNIX_EPOCH + Duration::from_secs(until));
+        let earliest = until.checked_sub(MAXIMUM_WINDOW).unwrap_or(UNIX_EPOCH);
+        let since = self
+            .since
+            .map_or(earliest, |since| UNIX_EPOCH + Duration::from_secs(since))
+            .max(earliest);
+
+        if since >= until {
+            return Err(Error::Query("The window of the crawl log is empty!".into()));
+        }
+
+        Ok(CrawlLogFilter {
+            host: self.host.clone(),
+            status: self.status,
+            error_code: self.error_code.clone(),
+            since,
+            until,
+        })
+    }
+
+    /// Gets the maximum number of crawls to return.
+    ///
+    /// # Returns
+    ///
+    /// * `i64` - The limit of the query, between `1` and `MAXIMUM_LIMIT`.
+    #[must_use]
+    pub fn get_limit(&self) -> i64 {
+        self.limit.unwrap_or(DEFAULT_LIMIT).clamp(1, MAXIMUM_LIMIT)
+    }
+
+    /// Gets the crawl the page continues after.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Some((SystemTime, i64)))` - When the last crawl of the previous page was, and its ID.
+    /// * `Ok(None)` - If the query is for the first page.
+    /// * `Err(Error)` - If the cursor is invalid.
+    ///
+    /// # Errors
+    ///
+    /// * If the cursor wasn't made by `get_cursor`.
+    pub fn get_before(&self) -> Result<Option<(SystemTime, i64)>, Error> {
+        self.cursor.as_deref().map(parse_cursor).transpose()
+    }
+
+    /// Checks if the query is for a summary.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether to count the crawls instead of listing them.
+    #[must_use]
+    pub const fn is_summary(&self) -> bool {
+        self.summary != 0
+    }
+}
+
+impl Page {
+    /// Creates a page of the crawl log.
+    ///
+    /// # Arguments
+    ///
+    /// * `events`: The crawls, newest first.
+    /// * `limit`: The maximum number of crawls that were asked for.
+    ///
+    /// # Returns
+    ///
+    /// * `Page` - The page, with a cursor if it's full.
+    #[must_use]
+    pub fn new(events: Vec<CrawlEvent>, limit: i64) -> Self {
+        let is_full = i64::try_from(events.len()).unwrap_or(i64::MAX) >= limit;
+        let next_cursor = events.last().filter(|_| is_full).map(get_cursor);
+
+        Self {
+            events,
+            next_cursor,
+        }
+    }
+}
+
+/// Gets the cursor to continue after a crawl with.
+///
+/// # Arguments
+///
+/// * `event`: The crawl.
+///
+/// # Returns
+///
+/// * `String` - When the crawl was in microseconds since the Unix epoch, and its ID, like `1792016400000000-42`.
+#[must_use]
+pub fn get_cursor(event: &CrawlEvent) -> String {
+    let crawled_at = event
+        .crawled_at
+        .duration_since(UNIX_EPOCH)
+        .map(|since_epoch| since_epoch.as_micros())
+        .unwrap_or_default();
+
+    format!("{crawled_at}-{}", event.id)
+}
+
+/// Parses a cursor made by `get_cursor`.
+///
+/// # Arguments
+///
+/// * `cursor`: The cursor.
+///
+/// # Returns
+///
+/// * `Ok((SystemTime, i64))` - When the crawl was, and its ID.
+/// * `Err(Error)` - If the cursor is invalid.
+///
+/// # Errors
+///
+/// * If the cursor isn't two numbers separated by a dash.
+pub fn parse_cursor(cursor: &str) -> Result<(SystemTime, i64), Error> {
+    let invalid = || Error::Query(format!("Invalid cursor \"{cursor}\"!"));
+
+    let (crawled_at, id) = cursor.split_once('-').ok_or_else(invalid)?;
+    let crawled_at = crawled_at.parse::<u64>().map_err(|_| invalid())?;
+    let id = id.parse::<i64>().map_err(|_| invalid())?;
+
+    Ok((UNIX_EPOCH + Duration::from_micros(crawled_at), id))
+}
+
+/// Counts the crawls by error code and class of their status.
+///
+/// # Arguments
+///
+/// * `counts`: The error code, status and number of crawls of each group.
+///
+/// # Returns
+///
+/// * `Vec<Count>` - The counts, most crawls first.
+#[must_use]
+pub fn summarize(counts: &[(Option<String>, Option<i32>, i64)]) -> Vec<Count> {
+    let mut totals: HashMap<(Option<&str>, Option<String>), i64> = HashMap::new();
+    for (error_code, status, crawls) in counts {
+        let status_class = status.map(|status| format!("{}xx", status / 100));
+        let total = totals
+            .entry((error_code.as_deref(), status_class))
+            .or_default();
+        *total = total.saturating_add(*crawls);
+    }
+
+    let mut summary = totals
+        .into_iter()
+        .map(|((error_code, status_class), crawls)| Count {
+            error_code: error_code.map(str::to_string),
+            status_class,
+            crawls,
+        })
+        .collect::<Vec<_>>();
+    summary.sort_by(|a, b| {
+        b.crawls
+            .cmp(&a.crawls)
+            .then_with(|| a.error_code.cmp(&b.error_code))
+            .then_with(|| a.status_class.cmp(&b.status_class))
+    });
+
+    summary
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_cursor() {
+        let event = CrawlEvent {
+            id: 42,
+
+            url: "https://example.com/".into(),
+            host: "example.com".into(),
+            status: Some(200),
+            error_code: None,
+            crawled_at: UNIX_EPOCH + Duration::from_micros(1_792_016_400_123_456),
+        };
+
+        let cursor = get_cursor(&event);
+        assert_eq!(cursor, "1792016400123456-42");
+        assert_eq!(
+            parse_cursor(&cursor).expect("Failed to parse cursor!"),
+            (event.crawled_at, event.id)
+        );
+
+        assert!(parse_cursor("").is_err());
+        assert!(parse_cursor("42").is_err());
+        assert!(parse_cursor("now-42").is_err());
+
+        // Only full pages can have a next page.
+        assert_eq!(Page::new(vec![event.clone()], 1).next_cursor, Some(cursor));
+        assert_eq!(Page::new(vec![event], 2).next_cursor, None);
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_filter() {
+        let now = UNIX_EPOCH + Duration::from_secs(1_792_016_400);
+        let query = |since, until| Query {
+            since,
+            until,
+            ..Query::default()
+        };
+
+        let filter = query(None, None)
+            .get_filter(now)
+            .expect("Failed to get filter!");
+        assert_eq!((filter.since, filter.until), (now - MAXIMUM_WINDOW, now));
+
+        // Windows longer than the maximum are capped.
+        let filter = query(Some(0), Some(1_792_016_400))
+            .get_filter(now)
+            .expect("Failed to get filter!");
+        assert_eq!((filter.since, filter.until), (now - MAXIMUM_WINDOW, now));
+
+        let filter = query(Some(1_792_012_800), None)
+            .get_filter(now)
+            .expect("Failed to get filter!");
+        assert_eq!(
+            (filter.since, filter.until),
+            (now - Duration::from_secs(60 * 60), now)
+        );
+
+        assert!(matches!(
+            query(Some(1_792_016_400), Some(1_792_016_400)).get_filter(now),
+            Err(Error::Query(_))
+        ));
+        assert!(query(Some(1_792_016_400), Some(1_792_012_800))
+            .get_filter(now)
+            .is_err());
+
+        assert_eq!(Query::default().get_limit(), DEFAULT_LIMIT);
+        assert_eq!(
+            Query {
+                limit: Some(1_000_000),
+                ..Query::default()
+            }
+            .get_limit(),
+            MAXIMUM_LIMIT
+        );
+    }
+
+    #[test]
+    fn test_summarize() {
+        let counts = vec![
+            (None, Some(200), 10),
+            (None, Some(204), 2),
+            (None, Some(404), 3),
+            (Some("timeout".to_string()), None, 4),
+            (Some("robots_disallowed".to_string()), None, 4),
+        ];
+
+        assert_eq!(
+            summarize(&counts),
+            vec![
+                Count {
+                    error_code: None,
+                    status_class: Some("2xx".into()),
+                    crawls: 12,
+                },
+                Count {
+                    error_code: Some("robots_disallowed".into()),
+                    status_class: None,
+                    crawls: 4,
+                },
+                Count {
+                    error_code: Some("timeout".into()),
+                    status_class: None,
+                    crawls: 4,
+                },
+                Count {
+                    error_code: None,
+                    status_class: Some("4xx".into()),
+                    crawls: 3,
+                },
+            ]
+        );
+        assert!(summarize(&[]).is_empty());
+    }
+}
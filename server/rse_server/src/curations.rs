@@ -0,0 +1,574 @@
+use actix_web::web;
+use common::database;
+use common::database::model::{Curation, NewCuration};
+use common::errors::Error;
+use common::utils::{dates, urls};
+use log::{info, warn};
+use serde::{Deserialize, Serialize};
+use std::collections::{HashMap, HashSet};
+use std::sync::RwLock;
+use std::time::{Duration, SystemTime};
+use url::Url;
+
+/// The maximum length of a normalized query that can be curated.
+const MAXIMUM_PATTERN_LENGTH: usize = 256;
+
+/// What a curation does to a page in the results of its query.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Action {
+    /// Puts the page at the top, even if it wasn't found.
+    Pin,
+    /// Multiplies the rank of the page by the weight.
+    Boost,
+    /// Divides the rank of the page by the weight.
+    Demote,
+    /// Leaves the page out.
+    Block,
+}
+
+impl Action {
+    /// Gets the name of the action, as it's stored.
+    ///
+    /// # Returns
+    ///
+    /// * `&'static str` - `pin`, `boost`, `demote` or `block`.
+    #[must_use]
+    pub const fn as_str(self) -> &'static str {
+        match self {
+            Self::Pin => "pin",
+            Self::Boost => "boost",
+            Self::Demote => "demote",
+            Self::Block => "block",
+        }
+    }
+
+    /// Parses the name of an action.
+    ///
+    /// # Arguments
+    ///
+    /// * `action`: The name of the action.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Action)` - The action.
+    /// * `None` - If there is no action with the name.
+    #[must_use]
+    pub fn parse(action: &str) -> Option<Self> {
+        match action {
+            "pin" => Some(Self::Pin),
+            "boost" => Some(Self::Boost),
+            "demote" => Some(Self::Demote),
+            "block" => Some(Self::Block),
+            _ => None,
+        }
+    }
+}
+
+/// A curation, as admins create or replace it.
+///
+/// # Fields
+///
+/// * `query`: The query the curation applies to, matched regardless of case and spacing.
+/// * `url`: The URL of the page that's curated.
+/// * `action`: What's done to the page.
+/// * `weight`: The order of pins, highest first, or the factor of boosts and demotions, `1` by default.
+/// * `expires_at`: When the curation stops applying, like `2024-05-12T08:30:00+02:00`, if ever.
+#[derive(Debug, Deserialize)]
+pub struct Request {
+    pub query: String,
+    pub url: String,
+    pub action: Action,
+    pub weight: Option<f64>,
+    pub expires_at: Option<String>,
+}
+
+impl Request {
+    /// Validates the curation, normalizing its query and URL the way they're matched.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(NewCuration)` - The curation to store.
+    /// * `Err(Error)` - If the curation is invalid.
+    ///
+    /// # Errors
+    ///
+    /// * If the query is empty or too long.
+    /// * If the URL or expiry date is invalid.
+    /// * If the weight isn't a positive number.
+    pub fn validate(&self) -> Result<NewCuration, Error> {
+        let pattern = normalize(&self.query);
+        if pattern.is_empty() || pattern.len() > MAXIMUM_PATTERN_LENGTH {
+            return Err(Error::Query(format!(
+                "The query must be between 1 and {MAXIMUM_PATTERN_LENGTH} bytes!"
+            )));
+        }
+
+        let url = Url::parse(&self.url)
+            .map_err(|_| Error::InvalidUrl(format!("Invalid URL \"{}\"!", self.url)))?;
+
+        let weight = self.weight.unwrap_or(1.0);
+        if !weight.is_finite() || weight <= 0.0 {
+            return Err(Error::Query("The weight must be a positive number!".into()));
+        }
+
+        let expires_at = self
+            .expires_at
+            .as_deref()
+            .map(|date| {
+                dates::parse(date).ok_or_else(|| Error::Query(format!("Invalid date \"{date}\"!")))
+            })
+            .transpose()?;
+
+        Ok(NewCuration {
+            pattern,
+            url: urls::normalize(&url).to_string(),
+            action: self.action.as_str().to_string(),
+            weight,
+            expires_at,
+        })
+    }
+}
+
+/// A curation of a page, as it's applied.
+///
+/// # Fields
+///
+/// * `url`: The URL of the page.
+/// * `action`: What's done to the page.
+/// * `weight`: The order of pins, or the factor of boosts and demotions.
+/// * `expires_at`: When the curation stops applying, if ever.
+#[derive(Debug, Clone, PartialEq)]
+struct Entry {
+    url: String,
+    action: Action,
+    weight: f64,
+    expires_at: Option<SystemTime>,
+}
+
+/// An in-memory cache of the curations, by the query they apply to.
+///
+/// # Fields
+///
+/// * `patterns`: The curations of each normalized query.
+#[derive(Debug, Default)]
+pub struct Curations {
+    patterns: RwLock<HashMap<String, Vec<Entry>>>,
+}
+
+/// The curations that apply to the results of a query.
+///
+/// # Fields
+///
+/// * `pins`: The URLs of the pinned pages, in the order they're put at the top.
+/// * `factors`: The factor the rank of each boosted or demoted page is multiplied by.
+/// * `blocked`: The URLs of the pages that are left out.
+#[derive(Debug, Default, Clone, PartialEq)]
+pub struct Curated {
+    pins: Vec<String>,
+    factors: HashMap<String, f64>,
+    blocked: HashSet<String>,
+}
+
+impl Curations {
+    /// Creates a new cache of curations.
+    ///
+    /// # Arguments
+    ///
+    /// * `curations`: The curations, whose unknown actions are skipped.
+    ///
+    /// # Returns
+    ///
+    /// * `Curations` - The new cache.
+    #[must_use]
+    pub fn new(curations: Vec<Curation>) -> Self {
+        Self {
+            patterns: RwLock::new(group(curations)),
+        }
+    }
+
+    /// Loads the curations from the database.
+    ///
+    /// # Returns
+    ///
+    /// * `Curations` - The cache, empty if the curations could not be loaded.
+    pub async fn load() -> Self {
+        let curations = Self::default();
+        if let Err(err) = curations.refresh().await {
+            warn!("Failed to load curations, searching without them! Error: {err}");
+        }
+
+        curations
+    }
+
+    /// Replaces the cached curations with those in the database.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(())` - If the curations were loaded.
+    /// * `Err(Error)` - If the curations could not be loaded.
+    ///
+    /// # Errors
+    ///
+    /// * If the curations could not be retrieved.
+    pub async fn refresh(&self) -> Result<(), Error> {
+        let patterns = group(database::get_curations().await?);
+        if let Ok(mut cached) = self.patterns.write() {
+            *cached = patterns;
+        }
+
+        Ok(())
+    }
+
+    /// Reloads the curations in the background, so changes made on other servers are applied.
+    ///
+    /// # Arguments
+    ///
+    /// * `curations`: The cache to reload.
+    /// * `interval`: The time between each reload, `0` to only load them on start.
+    pub fn refresh_every(curations: web::Data<Self>, interval: Duration) {
+        if interval.is_zero() {
+            return;
+        }
+
+        actix_web::rt::spawn(async move {
+            loop {
+                actix_web::rt::time::sleep(interval).await;
+
+                if let Err(err) = curations.refresh().await {
+                    warn!("Failed to reload curations, keeping the old ones! Error: {err}");
+                }
+            }
+        });
+
+        info!(
+            "Reloading curations every {} seconds...",
+            interval.as_secs()
+        );
+    }
+
+    /// Gets the curations that apply to the results of a query.
+    ///
+    /// # Arguments
+    ///
+    /// * `query`: The query string, as the client sent it.
+    /// * `now`: The current time.
+    ///
+    /// # Returns
+    ///
+    /// * `Curated` - The curations of the query that haven't expired.
+    ///
+    /// # Notes
+    ///
+    /// * Blocks win over every other curation of the same page, and a page boosted and demoted gets both factors.
+    #[must_use]
+    pub fn get(&self, query: &str, now: SystemTime) -> Curated {
+        let Ok(patterns) = self.patterns.read() else {
+            return Curated::default();
+        };
+        let Some(entries) = patterns.get(&normalize(query)) else {
+            return Curated::default();
+        };
+
+        let entries = entries
+            .iter()
+            .filter(|entry| entry.expires_at.map_or(true, |expires_at| expires_at > now))
+            .collect::<Vec<_>>();
+
+        let mut curated = Curated::default();
+        for entry in &entries {
+            match entry.action {
+                Action::Block => {
+                    curated.blocked.insert(entry.url.clone());
+                }
+                Action::Boost => {
+                    *curated.factors.entry(entry.url.clone()).or_insert(1.0) *= entry.weight;
+                }
+                Action::Demote => {
+                    *curated.factors.entry(entry.url.clone()).or_insert(1.0) /= entry.weight;
+                }
+                Action::Pin => {}
+            }
+        }
+
+        let mut pins = entries
+            .into_iter()
+            .filter(|entry| entry.action == Action::Pin && !curated.blocked.contains(&entry.url))
+            .collect::<Vec<_>>();
+        pins.sort_by(|entry_a, entry_b| entry_b.weight.total_cmp(&entry_a.weight));
+        for entry in pins {
+            if !curated.pins.contains(&entry.url) {
+                curated.pins.push(entry.url.clone());
+            }
+        }
+
+        curated
+    }
+}
+
+impl Curated {
+    /// Checks if a page is left out of the results.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the page.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the page is blocked.
+    #[must_use]
+    pub fn is_blocked(&self, url: &str) -> bool {
+        self.blocked.contains(url)
+    }
+
+    /// Gets the factor the rank of a page is multiplied by.
+    ///
+    /// # Arguments
+    ///
+    /// * `url`: The URL of the page.
+    ///
+    /// # Returns
+    ///
+    /// * `f64` - The factor of the boosts and demotions of the page, `1` if there are none.
+    #[must_use]
+    pub fn get_factor(&self, url: &str) -> f64 {
+        self.factors.get(url).copied().unwrap_or(1.0)
+    }
+
+    /// Gets the URLs of the pinned pages.
+    ///
+    /// # Returns
+    ///
+    /// * `&[String]` - The URLs, in the order they're put at the top.
+    #[must_use]
+    pub fn pins(&self) -> &[String] {
+        &self.pins
+    }
+
+    /// Puts the pinned pages at the top of the ranked results.
+    ///
+    /// # Arguments
+    ///
+    /// * `ranked`: The ranked results, best first.
+    /// * `pinned`: The pinned pages that weren't found, by their URL.
+    /// * `url`: Gets the URL of a result.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<T>` - The pinned pages in order, then the other results as they were ranked.
+    ///
+    /// # Notes
+    ///
+    /// * Pinned pages that were found are moved rather than repeated, and pins that are neither found nor given are skipped.
+    pub fn pin<T, F>(&self, ranked: Vec<T>, mut pinned: HashMap<String, T>, url: F) -> Vec<T>
+    where
+        F: Fn(&T) -> &str,
+    {
+        if self.pins.is_empty() {
+            return ranked;
+        }
+
+        let mut rest = Vec::with_capacity(ranked.len());
+        for result in ranked {
+            if self.pins.iter().any(|pin| pin == url(&result)) {
+                pinned.insert(url(&result).to_string(), result);
+            } else {
+                rest.push(result);
+            }
+        }
+
+        self.pins
+            .iter()
+            .filter_map(|pin| pinned.remove(pin))
+            .chain(rest)
+            .collect()
+    }
+}
+
+/// Normalizes a query the way curations are matched, ignoring case and spacing.
+///
+/// # Arguments
+///
+/// * `query`: The query string.
+///
+/// # Returns
+///
+/// * `String` - The lowercase words of the query, separated by single spaces.
+#[must_use]
+pub fn normalize(query: &str) -> String {
+    query
+        .split_whitespace()
+        .map(str::to_lowercase)
+        .collect::<Vec<_>>()
+        .join(" ")
+}
+
+/// Groups curations by the query they apply to.
+///
+/// # Arguments
+///
+/// * `curations`: The curations.
+///
+/// # Returns
+///
+/// * `HashMap<String, Vec<Entry>>` - The curations of each normalized query, without those with unknown actions.
+fn group(curations: Vec<Curation>) -> HashMap<String, Vec<Entry>> {
+    let mut patterns = HashMap::<String, Vec<Entry>>::new();
+    for curation in curations {
+        let Some(action) = Action::parse(&curation.action) else {
+            warn!(
+                "Skipping curation #{} with unknown action \"{}\"...",
+                curation.id, curation.action
+            );
+
+            continue;
+        };
+
+        patterns.entry(curation.pattern).or_default().push(Entry {
+            url: curation.url,
+            action,
+            weight: curation.weight,
+            expires_at: curation.expires_at,
+        });
+    }
+
+    patterns
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn get_curation(url: &str, action: Action, weight: f64) -> Curation {
+        Curation {
+            id: 1,
+            pattern: "status page".to_string(),
+            url: url.to_string(),
+            action: action.as_str().to_string(),
+            weight,
+            expires_at: None,
+            created_at: SystemTime::UNIX_EPOCH,
+        }
+    }
+
+    fn get_ranked() -> Vec<String> {
+        ["https://a.com/", "https://b.com/", "https://c.com/"]
+            .map(str::to_string)
+            .to_vec()
+    }
+
+    fn apply(curated: &Curated, ranked: Vec<String>) -> Vec<String> {
+        let pinned = curated
+            .pins()
+            .iter()
+            .map(|url| (url.clone(), url.clone()))
+            .collect();
+
+        curated
+            .pin(ranked, pinned, String::as_str)
+            .into_iter()
+            .filter(|url| !curated.is_blocked(url))
+            .collect()
+    }
+
+    #[test]
+    fn test_pin() {
+        let curations = Curations::new(vec![
+            get_curation("https://status.example.com/", Action::Pin, 1.0),
+            get_curation("https://c.com/", Action::Pin, 2.0),
+        ]);
+
+        // Pins go first by weight, and those already found are moved rather than repeated.
+        let curated = curations.get("  Status   PAGE ", SystemTime::now());
+        assert_eq!(
+            apply(&curated, get_ranked()),
+            vec![
+                "https://c.com/",
+                "https://status.example.com/",
+                "https://a.com/",
+                "https://b.com/",
+            ]
+        );
+
+        // Other queries aren't curated.
+        let curated = curations.get("status", SystemTime::now());
+        assert_eq!(curated, Curated::default());
+        assert_eq!(apply(&curated, get_ranked()), get_ranked());
+    }
+
+    #[test]
+    fn test_boost_and_demote() {
+        let curations = Curations::new(vec![
+            get_curation("https://a.com/", Action::Boost, 3.0),
+            get_curation("https://b.com/", Action::Demote, 4.0),
+            get_curation("https://b.com/", Action::Boost, 2.0),
+        ]);
+
+        let curated = curations.get("status page", SystemTime::now());
+        assert!((curated.get_factor("https://a.com/") - 3.0).abs() < f64::EPSILON);
+        assert!((curated.get_factor("https://b.com/") - 0.5).abs() < f64::EPSILON);
+        assert!((curated.get_factor("https://c.com/") - 1.0).abs() < f64::EPSILON);
+    }
+
+    #[test]
+    fn test_block() {
+        let curations = Curations::new(vec![
+            get_curation("https://b.com/", Action::Block, 1.0),
+            get_curation("https://b.com/", Action::Pin, 1.0),
+        ]);
+
+        // Blocks win over pins of the same page.
+        let curated = curations.get("status page", SystemTime::now());
+        assert!(curated.pins().is_empty());
+        assert_eq!(
+            apply(&curated, get_ranked()),
+            vec!["https://a.com/", "https://c.com/"]
+        );
+    }
+
+    #[test]
+    fn test_expiry() {
+        let now = SystemTime::UNIX_EPOCH + Duration::from_secs(1_000);
+        let mut expired = get_curation("https://a.com/", Action::Block, 1.0);
+        expired.expires_at = Some(now);
+        let mut active = get_curation("https://c.com/", Action::Pin, 1.0);
+        active.expires_at = Some(now + Duration::from_secs(1));
+
+        let curations = Curations::new(vec![expired, active]);
+        let curated = curations.get("status page", now);
+        assert!(!curated.is_blocked("https://a.com/"));
+        assert_eq!(
+            apply(&curated, get_ranked()),
+            vec!["https://c.com/", "https://a.com/", "https://b.com/"]
+        );
+
+        // Once the pin expires too, the results are left as they were.
+        let curated = curations.get("status page", now + Duration::from_secs(1));
+        assert_eq!(apply(&curated, get_ranked()), get_ranked());
+    }
+
+    #[test]
+    fn test_validate() {
+        let request = |weight, expires_at: Option<&str>| Request {
+            query: " Status Page ".to_string(),
+            url: "https://Status.Example.com".to_string(),
+            action: Action::Boost,
+            weight,
+            expires_at: expires_at.map(str::to_string),
+        };
+
+        assert_eq!(
+            request(None, Some("2024-05-12T00:00:00Z")).validate().ok(),
+            Some(NewCuration {
+                pattern: "status page".to_string(),
+                url: "https://status.example.com/".to_string(),
+                action: "boost".to_string(),
+                weight: 1.0,
+                expires_at: dates::parse("2024-05-12T00:00:00Z"),
+            })
+        );
+        assert!(request(Some(0.0), None).validate().is_err());
+        assert!(request(Some(f64::NAN), None).validate().is_err());
+        assert!(request(None, Some("soon")).validate().is_err());
+    }
+}
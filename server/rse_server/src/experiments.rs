@@ -0,0 +1,481 @@
+use common::database::model::Field;
+use common::errors::Error;
+use common::utils;
+use serde::Serialize;
+use sha2::{Digest, Sha256};
+use std::collections::HashMap;
+
+/// The name of the control variant, ranking with the configured weights.
+pub const CONTROL: &str = "control";
+
+/// The maximum number of variants to experiment with, besides the control.
+const MAXIMUM_VARIANTS: usize = 5;
+
+/// The weights used to rank pages.
+///
+/// # Fields
+///
+/// * `ranker_constant`: The factor each backlink's contribution to the rank is multiplied by.
+/// * `rating_factor`: The rank every page starts with.
+/// * `click_weight`: The weight of the click-through rate of a page, `0.0` to disable.
+/// * `proximity_weight`: The weight of how close the query terms are on a page, `0.0` to disable.
+/// * `language_weight`: The boost of pages in the most preferred language of the client, `0.0` to disable.
+/// * `authority_weight`: The weight of the authority of the domain of a page, `0.0` to disable.
+/// * `unstable_penalty`: The share of the rank taken from pages whose content changes between fetches, `0.0` to disable.
+/// * `title_weight`: The weight of matches in the title of a page.
+/// * `heading_weight`: The weight of matches in the `h1`, `h2` and `h3` headings of a page.
+/// * `body_weight`: The weight of matches in the body of a page.
+/// * `image_weight`: The weight of matches in the alt text and captions of the images on a page.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct Weights {
+    pub ranker_constant: f64,
+    pub rating_factor: f64,
+    pub click_weight: f64,
+    pub proximity_weight: f64,
+    pub language_weight: f64,
+    pub authority_weight: f64,
+    pub unstable_penalty: f64,
+    pub title_weight: f64,
+    pub heading_weight: f64,
+    pub body_weight: f64,
+    pub image_weight: f64,
+}
+
+impl Weights {
+    /// Loads the control weights from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Weights` - The control weights.
+    #[must_use]
+    pub fn load() -> Self {
+        Self {
+            ranker_constant: utils::env::ranker::get_ranker_constant(),
+            rating_factor: utils::env::ranker::get_rating_factor(),
+            click_weight: utils::env::ranker::get_click_weight(),
+            proximity_weight: utils::env::ranker::get_proximity_weight(),
+            language_weight: utils::env::ranker::get_language_weight(),
+            authority_weight: utils::env::ranker::get_authority_weight(),
+            unstable_penalty: utils::env::ranker::get_unstable_penalty(),
+            title_weight: utils::env::ranker::get_title_weight(),
+            heading_weight: utils::env::ranker::get_heading_weight(),
+            body_weight: utils::env::ranker::get_body_weight(),
+            image_weight: utils::env::ranker::get_image_weight(),
+        }
+    }
+
+    /// Gets the weight of matches in a field of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `field`: The field.
+    ///
+    /// # Returns
+    ///
+    /// * `f64` - The title, heading, body or image weight.
+    #[must_use]
+    pub const fn get_field_weight(&self, field: Field) -> f64 {
+        match field {
+            Field::Title => self.title_weight,
+            Field::Heading => self.heading_weight,
+            Field::Body => self.body_weight,
+            Field::Image => self.image_weight,
+        }
+    }
+}
+
+/// A ranking variant.
+///
+/// # Fields
+///
+/// * `name`: The name of the variant.
+/// * `weights`: The weights the variant ranks pages with.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Variant {
+    pub name: String,
+    pub weights: Weights,
+}
+
+/// The ranking variants to experiment with.
+///
+/// # Fields
+///
+/// * `variants`: The variants, starting with the control.
+#[derive(Debug)]
+pub struct Experiments {
+    variants: Vec<Variant>,
+}
+
+impl Experiments {
+    /// Creates new experiments.
+    ///
+    /// # Arguments
+    ///
+    /// * `control`: The weights of the control variant.
+    /// * `config`: The variants to experiment with, in the format `name:key=value,key=value;name:...`.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Experiments)` - The experiments if successful.
+    /// * `Err(Error)` - If the variants are invalid.
+    ///
+    /// # Errors
+    ///
+    /// * If a variant has no name, an invalid name, or shares its name with another variant.
+    /// * If a variant has an unknown key or an invalid value.
+    /// * If there are more than `MAXIMUM_VARIANTS` variants.
+    pub fn new(control: Weights, config: &str) -> Result<Self, Error> {
+        let mut variants = vec![Variant {
+            name: CONTROL.to_string(),
+            weights: control,
+        }];
+
+        for variant in config.split(';').map(str::trim).filter(|v| !v.is_empty()) {
+            let (name, settings) = variant.split_once(':').unwrap_or((variant, ""));
+            let name = name.trim();
+
+            if name.is_empty()
+                || !name
+                    .chars()
+                    .all(|c| c.is_ascii_alphanumeric() || c == '-' || c == '_')
+            {
+                return Err(Error::Internal(format!(
+                    "Invalid ranking variant name \"{name}\"!"
+                )));
+            }
+
+            if variants.iter().any(|variant| variant.name == name) {
+                return Err(Error::Internal(format!(
+                    "Duplicate ranking variant \"{name}\"!"
+                )));
+            }
+
+            let mut weights = variants[0].weights.clone();
+            for setting in settings.split(',').map(str::trim).filter(|s| !s.is_empty()) {
+                let Some((key, value)) = setting.split_once('=') else {
+                    return Err(Error::Internal(format!(
+                        "Invalid setting \"{setting}\" of ranking variant \"{name}\"!"
+                    )));
+                };
+                let Ok(value) = value.trim().parse::<f64>() else {
+                    return Err(Error::Internal(format!(
+                        "Invalid value of \"{key}\" of ranking variant \"{name}\"!"
+                    )));
+                };
+
+                match key.trim() {
+                    "ranker_constant" => weights.ranker_constant = value,
+                    "rating_factor" => weights.rating_factor = value,
+                    "click_weight" if value >= 0.0 => weights.click_weight = value,
+                    "click_weight" => {
+                        return Err(Error::Internal(format!(
+                            "The click weight of ranking variant \"{name}\" can't be negative!"
+                        )))
+                    }
+                    "proximity_weight" if value >= 0.0 => weights.proximity_weight = value,
+                    "proximity_weight" => {
+                        return Err(Error::Internal(format!(
+                            "The proximity weight of ranking variant \"{name}\" can't be negative!"
+                        )))
+                    }
+                    "language_weight" if value >= 0.0 => weights.language_weight = value,
+                    "language_weight" => {
+                        return Err(Error::Internal(format!(
+                            "The language weight of ranking variant \"{name}\" can't be negative!"
+                        )))
+                    }
+                    "authority_weight" if value >= 0.0 => weights.authority_weight = value,
+                    "authority_weight" => {
+                        return Err(Error::Internal(format!(
+                            "The authority weight of ranking variant \"{name}\" can't be negative!"
+                        )))
+                    }
+                    "unstable_penalty" if (0.0..=1.0).contains(&value) => {
+                        weights.unstable_penalty = value;
+                    }
+                    "unstable_penalty" => {
+                        return Err(Error::Internal(format!(
+                            "The unstable penalty of ranking variant \"{name}\" must be between 0 and 1!"
+                        )))
+                    }
+                    "title_weight" if value >= 0.0 => weights.title_weight = value,
+                    "title_weight" => {
+                        return Err(Error::Internal(format!(
+                            "The title weight of ranking variant \"{name}\" can't be negative!"
+                        )))
+                    }
+                    "heading_weight" if value >= 0.0 => weights.heading_weight = value,
+                    "heading_weight" => {
+                        return Err(Error::Internal(format!(
+                            "The heading weight of ranking variant \"{name}\" can't be negative!"
+                        )))
+                    }
+                    "body_weight" if value >= 0.0 => weights.body_weight = value,
+                    "body_weight" => {
+                        return Err(Error::Internal(format!(
+                            "The body weight of ranking variant \"{name}\" can't be negative!"
+                        )))
+                    }
+                    "image_weight" if value >= 0.0 => weights.image_weight = value,
+                    "image_weight" => {
+                        return Err(Error::Internal(format!(
+                            "The image weight of ranking variant \"{name}\" can't be negative!"
+                        )))
+                    }
+                    key => {
+                        return Err(Error::Internal(format!(
+                            "Invalid setting \"{key}\" of ranking variant \"{name}\"!"
+                        )))
+                    }
+                }
+            }
+
+            variants.push(Variant {
+                name: name.to_string(),
+                weights,
+            });
+        }
+
+        if variants.len() > MAXIMUM_VARIANTS + 1 {
+            return Err(Error::Internal(format!(
+                "Can't experiment with more than {MAXIMUM_VARIANTS} ranking variants!"
+            )));
+        }
+
+        Ok(Self { variants })
+    }
+
+    /// Loads the experiments from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Experiments)` - The experiments if successful.
+    /// * `Err(Error)` - If the variants are invalid.
+    ///
+    /// # Errors
+    ///
+    /// * If `RANKING_VARIANTS` is invalid.
+    pub fn load() -> Result<Self, Error> {
+        Self::new(
+            Weights::load(),
+            &utils::env::ranker::get_ranking_variants().unwrap_or_default(),
+        )
+    }
+
+    /// Gets a variant by its name.
+    ///
+    /// # Arguments
+    ///
+    /// * `name`: The name of the variant.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(&Variant)` - The variant, if it exists.
+    /// * `None` - If there's no variant with that name.
+    #[must_use]
+    pub fn get(&self, name: &str) -> Option<&Variant> {
+        self.variants.iter().find(|variant| variant.name == name)
+    }
+
+    /// Assigns a client to a variant.
+    ///
+    /// # Arguments
+    ///
+    /// * `client`: The anonymous token of the client, if any.
+    ///
+    /// # Returns
+    ///
+    /// * `&Variant` - The variant of the client.
+    ///
+    /// # Notes
+    ///
+    /// * A client is always assigned the same variant, as long as the variants don't change.
+    /// * Clients without a token are always assigned the control.
+    #[must_use]
+    pub fn assign(&self, client: Option<&str>) -> &Variant {
+        let Some(client) = client.filter(|client| !client.is_empty()) else {
+            return &self.variants[0];
+        };
+
+        let digest = Sha256::digest(client.as_bytes());
+        let mut bucket = [0; 8];
+        bucket.copy_from_slice(&digest[..8]);
+
+        // The remainder is always less than the number of variants, so it fits in a `usize`.
+        #[allow(clippy::cast_possible_truncation)]
+        let index = (u64::from_be_bytes(bucket) % self.variants.len() as u64) as usize;
+
+        &self.variants[index]
+    }
+
+    /// Gets the names of the variants, starting with the control.
+    ///
+    /// # Returns
+    ///
+    /// * `impl Iterator<Item = &str>` - The names of the variants.
+    pub fn names(&self) -> impl Iterator<Item = &str> {
+        self.variants.iter().map(|variant| variant.name.as_str())
+    }
+}
+
+/// The statistics of a ranking variant.
+///
+/// # Fields
+///
+/// * `variant`: The name of the variant.
+/// * `searches`: The number of searches ranked with the variant.
+/// * `zero_result_rate`: The share of the searches that found no pages.
+/// * `clicks`: The number of clicks on results ranked with the variant.
+/// * `click_through_rate`: The number of clicks per search that found pages.
+#[derive(Debug, Serialize, PartialEq)]
+pub struct VariantStats {
+    pub variant: String,
+    pub searches: i64,
+    pub zero_result_rate: f64,
+    pub clicks: i64,
+    pub click_through_rate: f64,
+}
+
+/// Calculates the statistics of each variant.
+///
+/// # Arguments
+///
+/// * `experiments`: The experiments.
+/// * `counts`: The searches, searches without results and clicks of each variant.
+///
+/// # Returns
+///
+/// * `Vec<VariantStats>` - The statistics of each current variant, starting with the control.
+#[must_use]
+#[allow(clippy::cast_precision_loss)]
+pub fn get_stats<S: std::hash::BuildHasher>(
+    experiments: &Experiments,
+    counts: &HashMap<String, (i64, i64, i64), S>,
+) -> Vec<VariantStats> {
+    experiments
+        .names()
+        .map(|name| {
+            let (searches, zero_results, clicks) = counts.get(name).copied().unwrap_or_default();
+            let searches_with_results = searches - zero_results;
+
+            VariantStats {
+                variant: name.to_string(),
+                searches,
+                zero_result_rate: if searches > 0 {
+                    zero_results as f64 / searches as f64
+                } else {
+                    0.0
+                },
+                clicks,
+                click_through_rate: if searches_with_results > 0 {
+                    clicks as f64 / searches_with_results as f64
+                } else {
+                    0.0
+                },
+            }
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn get_control() -> Weights {
+        Weights {
+            ranker_constant: 0.7,
+            rating_factor: 0.4,
+            click_weight: 0.0,
+            proximity_weight: 1.0,
+            language_weight: 1.0,
+            authority_weight: 0.0,
+            unstable_penalty: 0.5,
+            title_weight: 3.0,
+            heading_weight: 2.0,
+            body_weight: 1.0,
+            image_weight: 0.5,
+        }
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_new() {
+        let experiments = Experiments::new(
+            get_control(),
+            "clicky: click_weight=0.5; steep:ranker_constant=0.9,rating_factor=0.1",
+        )
+        .expect("Failed to create experiments!");
+
+        assert_eq!(
+            experiments.names().collect::<Vec<_>>(),
+            vec![CONTROL, "clicky", "steep"]
+        );
+        assert_eq!(
+            experiments.get("clicky").expect("Missing variant!").weights,
+            Weights {
+                click_weight: 0.5,
+                ..get_control()
+            }
+        );
+        assert_eq!(
+            experiments.get("steep").expect("Missing variant!").weights,
+            Weights {
+                ranker_constant: 0.9,
+                rating_factor: 0.1,
+                ..get_control()
+            }
+        );
+
+        assert!(Experiments::new(get_control(), "control:click_weight=1").is_err());
+        assert!(Experiments::new(get_control(), "a.b:click_weight=1").is_err());
+        assert!(Experiments::new(get_control(), "a:speed=1").is_err());
+        assert!(Experiments::new(get_control(), "a;b;c;d;e;f").is_err());
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_assign() {
+        let experiments = Experiments::new(get_control(), "a:rating_factor=1;b:rating_factor=2")
+            .expect("Failed to create experiments!");
+
+        // Assignment is sticky per client.
+        for client in ["first", "second", "third"] {
+            assert_eq!(
+                experiments.assign(Some(client)),
+                experiments.assign(Some(client))
+            );
+        }
+
+        // Clients without a token get the control.
+        assert_eq!(experiments.assign(None).name, CONTROL);
+        assert_eq!(experiments.assign(Some("")).name, CONTROL);
+
+        // Every variant gets some of the clients.
+        let mut names = (0..100)
+            .map(|client| experiments.assign(Some(&client.to_string())).name.clone())
+            .collect::<Vec<_>>();
+        names.sort();
+        names.dedup();
+        assert_eq!(names, vec!["a", "b", CONTROL]);
+
+        // Without any variants, everyone gets the control.
+        let experiments =
+            Experiments::new(get_control(), "").expect("Failed to create experiments!");
+        assert_eq!(experiments.assign(Some("first")).name, CONTROL);
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_stats() {
+        let experiments = Experiments::new(get_control(), "a:rating_factor=1")
+            .expect("Failed to create experiments!");
+        let counts = HashMap::from([(CONTROL.to_string(), (10, 2, 4))]);
+        let stats = get_stats(&experiments, &counts);
+
+        assert_eq!(stats[0].searches, 10);
+        assert!((stats[0].zero_result_rate - 0.2).abs() < f64::EPSILON);
+        assert!((stats[0].click_through_rate - 0.5).abs() < f64::EPSILON);
+        assert_eq!(stats[1].variant, "a");
+        assert_eq!(stats[1].searches, 0);
+    }
+}
@@ -0,0 +1,298 @@
+use crate::search::SearchResult;
+use actix_web::http::header::{ContentDisposition, DispositionParam, DispositionType};
+use actix_web::web::Bytes;
+use actix_web::HttpResponse;
+use common::errors::Error;
+use futures::stream;
+use serde::{Deserialize, Serialize};
+
+/// The format to return search results in.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Format {
+    #[default]
+    Json,
+    Csv,
+    Ndjson,
+}
+
+impl Format {
+    /// Checks if the format is for exporting results, rather than showing a page of them.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the format is an export format.
+    #[must_use]
+    pub const fn is_export(self) -> bool {
+        matches!(self, Self::Csv | Self::Ndjson)
+    }
+}
+
+/// The columns of an exported result, in order.
+const COLUMNS: [&str; 4] = ["position", "url", "title", "description"];
+
+/// A search result, as it's exported.
+///
+/// # Fields
+///
+/// * `position`: The position of the result in the export, starting at `1`.
+/// * `url`: The URL of the page.
+/// * `title`: The title of the page, if any.
+/// * `description`: The description of the page, if any.
+#[derive(Debug, Serialize)]
+struct Row<'a> {
+    position: usize,
+    url: &'a str,
+    title: Option<&'a str>,
+    description: Option<&'a str>,
+}
+
+impl<'a> Row<'a> {
+    fn new(position: usize, result: &'a SearchResult) -> Self {
+        Self {
+            position,
+            url: &result.page.page.url,
+            title: result.page.page.title.as_deref(),
+            description: result.page.page.description.as_deref(),
+        }
+    }
+
+    /// Formats the row as a line of CSV.
+    fn to_csv(&self) -> String {
+        let fields = [
+            self.position.to_string(),
+            escape_csv(self.url),
+            escape_csv(self.title.unwrap_or_default()),
+            escape_csv(self.description.unwrap_or_default()),
+        ];
+
+        format!("{}\r\n", fields.join(","))
+    }
+
+    /// Formats the row as a line of JSON.
+    fn to_ndjson(&self) -> Result<String, Error> {
+        serde_json::to_string(self)
+            .map(|row| format!("{row}\n"))
+            .map_err(|err| Error::Internal(err.to_string()))
+    }
+}
+
+/// Escapes a field of a CSV row.
+///
+/// # Arguments
+///
+/// * `field`: The field.
+///
+/// # Returns
+///
+/// * `String` - The field, quoted with its quotes doubled if it contains commas, quotes or newlines.
+fn escape_csv(field: &str) -> String {
+    if field.contains([',', '"', '\n', '\r']) {
+        format!("\"{}\"", field.replace('"', "\"\""))
+    } else {
+        field.to_string()
+    }
+}
+
+/// Gets the name of the file to export results to.
+///
+/// # Arguments
+///
+/// * `query`: The query the results were found for.
+/// * `format`: The format of the file.
+///
+/// # Returns
+///
+/// * `String` - The file name, like `rse-hello-world.csv`.
+fn get_file_name(query: &str, format: Format) -> String {
+    let mut name = String::from("rse");
+    for word in query
+        .split(|c: char| !c.is_ascii_alphanumeric())
+        .filter(|word| !word.is_empty())
+    {
+        if name.len() + word.len() >= 64 {
+            break;
+        }
+
+        name.push('-');
+        name.push_str(&word.to_ascii_lowercase());
+    }
+
+    let extension = match format {
+        Format::Json => "json",
+        Format::Csv => "csv",
+        Format::Ndjson => "ndjson",
+    };
+
+    format!("{name}.{extension}")
+}
+
+/// Exports search results as a file download, streaming it a row at a time.
+///
+/// # Arguments
+///
+/// * `query`: The query the results were found for.
+/// * `results`: The results.
+/// * `format`: The format to export the results in.
+///
+/// # Returns
+///
+/// * `HttpResponse` - The response, downloaded by browsers as a file.
+pub fn respond(query: &str, results: Vec<SearchResult>, format: Format) -> HttpResponse {
+    let header = match format {
+        Format::Csv => Some(format!("{}\r\n", COLUMNS.join(","))),
+        Format::Json | Format::Ndjson => None,
+    };
+
+    let rows = results.into_iter().enumerate().map(move |(index, result)| {
+        let row = Row::new(index + 1, &result);
+
+        match format {
+            Format::Csv => Ok(row.to_csv()),
+            Format::Json | Format::Ndjson => row.to_ndjson(),
+        }
+    });
+    let body = header
+        .into_iter()
+        .map(Ok)
+        .chain(rows)
+        .map(|line| line.map(Bytes::from));
+
+    let content_type = match format {
+        Format::Csv => "text/csv; charset=utf-8",
+        Format::Json | Format::Ndjson => "application/x-ndjson",
+    };
+
+    HttpResponse::Ok()
+        .content_type(content_type)
+        .insert_header(ContentDisposition {
+            disposition: DispositionType::Attachment,
+            parameters: vec![DispositionParam::Filename(get_file_name(query, format))],
+        })
+        .streaming(stream::iter(body))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use common::database::model::Page;
+    use common::database::CompletePage;
+    use std::time::SystemTime;
+
+    fn get_result(url: &str, title: Option<&str>, description: Option<&str>) -> SearchResult {
+        SearchResult {
+            page: CompletePage {
+                page: Page {
+                    id: 1,
+                    url: url.to_string(),
+                    last_crawled_at: SystemTime::UNIX_EPOCH,
+                    title: title.map(str::to_string),
+                    description: description.map(str::to_string),
+                    encoding: None,
+                    index_fingerprint: None,
+                    first_seen_at: SystemTime::UNIX_EPOCH,
+                    language: None,
+                    published_at: None,
+                    content_modified_at: None,
+                    authenticated: false,
+                    excluded: false,
+                    personalized: false,
+                    unstable: false,
+                    noarchive: false,
+                    etag: None,
+                    last_modified: None,
+                },
+                keywords: None,
+            },
+            display_url: url.to_string(),
+            snippet: None,
+            cache_url: None,
+            duplicates: 0,
+            click_token: String::new(),
+        }
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_csv_round_trip() {
+        let results = [
+            get_result(
+                "https://example.com/",
+                Some("Hello, \"world\""),
+                Some("First line\nSecond line"),
+            ),
+            get_result("https://example.com/empty", None, None),
+        ];
+
+        let mut text = format!("{}\r\n", COLUMNS.join(","));
+        for (index, result) in results.iter().enumerate() {
+            text.push_str(&Row::new(index + 1, result).to_csv());
+        }
+
+        let mut reader = csv::Reader::from_reader(text.as_bytes());
+        assert_eq!(
+            reader
+                .headers()
+                .expect("Failed to read header!")
+                .iter()
+                .collect::<Vec<_>>(),
+            COLUMNS
+        );
+
+        let records = reader
+            .records()
+            .map(|record| {
+                record
+                    .expect("Failed to read record!")
+                    .iter()
+                    .map(str::to_string)
+                    .collect::<Vec<_>>()
+            })
+            .collect::<Vec<_>>();
+        assert_eq!(
+            records,
+            vec![
+                vec![
+                    "1",
+                    "https://example.com/",
+                    "Hello, \"world\"",
+                    "First line\nSecond line"
+                ],
+                vec!["2", "https://example.com/empty", "", ""],
+            ]
+        );
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_ndjson() {
+        let result = get_result("https://example.com/", Some("Line\nbreak"), None);
+        let line = Row::new(1, &result)
+            .to_ndjson()
+            .expect("Failed to serialize row!");
+
+        assert_eq!(line.matches('\n').count(), 1);
+        assert_eq!(
+            serde_json::from_str::<serde_json::Value>(&line).expect("Failed to parse row!"),
+            serde_json::json!({
+                "position": 1,
+                "url": "https://example.com/",
+                "title": "Line\nbreak",
+                "description": null,
+            })
+        );
+    }
+
+    #[test]
+    fn test_get_file_name() {
+        assert_eq!(
+            get_file_name("Hello, World!", Format::Csv),
+            "rse-hello-world.csv"
+        );
+        assert_eq!(
+            get_file_name("\"; rm -rf /", Format::Ndjson),
+            "rse-rm-rf.ndjson"
+        );
+        assert_eq!(get_file_name("", Format::Csv), "rse.csv");
+    }
+}
@@ -0,0 +1,85 @@
+use actix_web::http::header::ContentType;
+use actix_web::{web, HttpRequest, HttpResponse, HttpResponseBuilder};
+use log::error;
+use serde::{Deserialize, Serialize};
+
+/// The query of any JSON endpoint.
+///
+/// # Fields
+///
+/// * `pretty`: Whether the response is indented, to be read by eye instead of a program.
+#[derive(Debug, Default, Deserialize)]
+pub struct Query {
+    #[serde(default)]
+    pub pretty: bool,
+}
+
+/// Checks if a request asks for its response to be pretty-printed, with `pretty=true`.
+///
+/// # Arguments
+///
+/// * `request`: The request.
+///
+/// # Returns
+///
+/// * `bool` - Whether the response should be indented.
+#[must_use]
+pub fn is_pretty(request: &HttpRequest) -> bool {
+    web::Query::<Query>::from_query(request.query_string()).is_ok_and(|query| query.pretty)
+}
+
+/// Builds a JSON response, indented if the request asks for it.
+///
+/// # Arguments
+///
+/// * `request`: The request.
+/// * `response`: The response to send the body with.
+/// * `body`: The body of the response.
+///
+/// # Returns
+///
+/// * `HttpResponse` - The response, with the body serialized as JSON.
+///
+/// # Notes
+///
+/// * Responses are compact unless `pretty=true` is set, to keep them small.
+pub fn respond<T: Serialize>(
+    request: &HttpRequest,
+    mut response: HttpResponseBuilder,
+    body: &T,
+) -> HttpResponse {
+    if !is_pretty(request) {
+        return response.json(body);
+    }
+
+    match serde_json::to_string_pretty(body) {
+        Ok(json) => response.content_type(ContentType::json()).body(json),
+        Err(err) => {
+            error!("Failed to serialize the response! Error: {err}");
+
+            HttpResponse::InternalServerError().finish()
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use actix_web::test::TestRequest;
+
+    #[test]
+    fn test_is_pretty() {
+        assert!(is_pretty(
+            &TestRequest::with_uri("/?q=rust&pretty=true").to_http_request()
+        ));
+        assert!(!is_pretty(
+            &TestRequest::with_uri("/?q=rust&pretty=false").to_http_request()
+        ));
+        assert!(!is_pretty(
+            &TestRequest::with_uri("/?q=rust").to_http_request()
+        ));
+        assert!(!is_pretty(
+            &TestRequest::with_uri("/?pretty=yes").to_http_request()
+        ));
+    }
+}
@@ -0,0 +1,107 @@
+use common::utils;
+
+/// Parses the preferred languages of a client.
+///
+/// # Arguments
+///
+/// * `value`: The languages, comma separated like `da,en`, or an `Accept-Language` header like `da, en;q=0.8`.
+///
+/// # Returns
+///
+/// * `Vec<String>` - The primary languages, most preferred first and without duplicates.
+///
+/// # Notes
+///
+/// * Languages with a quality of `0`, wildcards and invalid tags are skipped.
+/// * Languages without a quality keep the order they're listed in.
+#[must_use]
+pub fn parse_preferences(value: &str) -> Vec<String> {
+    let mut languages = Vec::new();
+    for item in value.split(',') {
+        let mut parameters = item.split(';');
+        let Some(language) = parameters.next().and_then(utils::language::normalize) else {
+            continue;
+        };
+
+        let quality = parameters
+            .filter_map(|parameter| parameter.trim().strip_prefix("q="))
+            .find_map(|quality| quality.trim().parse::<f64>().ok())
+            .unwrap_or(1.0);
+        if quality <= 0.0 {
+            continue;
+        }
+
+        languages.push((language, quality));
+    }
+
+    // A stable sort keeps the listed order of languages of the same quality.
+    languages.sort_by(|(_, a), (_, b)| b.total_cmp(a));
+
+    let mut preferences = Vec::new();
+    for (language, _) in languages {
+        if !preferences.contains(&language) {
+            preferences.push(language);
+        }
+    }
+
+    preferences
+}
+
+/// Gets the factor to boost a page's rank by for its language.
+///
+/// # Arguments
+///
+/// * `preferences`: The preferred languages, most preferred first.
+/// * `language`: The language of the page, if known.
+/// * `weight`: The boost of the most preferred language.
+///
+/// # Returns
+///
+/// * `f64` - The factor, `1.0` for pages in no preferred language or of an unknown one.
+///
+/// # Notes
+///
+/// * The boost is divided by the place of the language in the preferences, so the second language gets half of it.
+#[must_use]
+#[allow(clippy::cast_precision_loss)]
+pub fn get_boost(preferences: &[String], language: Option<&str>, weight: f64) -> f64 {
+    let Some(place) = language.and_then(|language| {
+        preferences
+            .iter()
+            .position(|preference| preference == language)
+    }) else {
+        return 1.0;
+    };
+
+    1.0 + weight / (place + 1) as f64
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_preferences() {
+        assert_eq!(parse_preferences("da,en"), vec!["da", "en"]);
+        assert_eq!(
+            parse_preferences("en-GB;q=0.8, da, fr;q=0, *;q=0.1"),
+            vec!["da", "en"]
+        );
+        assert_eq!(
+            parse_preferences("da-DK, da;q=0.9, en-US;q=0.8, en;q=0.7"),
+            vec!["da", "en"]
+        );
+        assert!(parse_preferences("").is_empty());
+    }
+
+    #[test]
+    fn test_get_boost() {
+        let preferences = parse_preferences("da,en");
+
+        assert!((get_boost(&preferences, Some("da"), 1.0) - 2.0).abs() < f64::EPSILON);
+        assert!((get_boost(&preferences, Some("en"), 1.0) - 1.5).abs() < f64::EPSILON);
+        assert!((get_boost(&preferences, Some("de"), 1.0) - 1.0).abs() < f64::EPSILON);
+        assert!((get_boost(&preferences, None, 1.0) - 1.0).abs() < f64::EPSILON);
+        assert!((get_boost(&[], Some("da"), 1.0) - 1.0).abs() < f64::EPSILON);
+    }
+}
@@ -1,40 +1,738 @@
+mod admin;
+mod authority;
+mod cache;
+mod clicks;
+mod clients;
+mod clusters;
+mod compare;
+mod crawl_log;
+mod curations;
+mod experiments;
+mod export;
+mod json;
+mod language;
+mod metrics;
+mod pages;
+mod postings;
+mod proximity;
 mod search;
+mod snippet;
+mod status;
+mod submissions;
+mod suggestions;
+mod terms;
+mod usage;
 
+use actix_web::http::header::{ACCEPT_LANGUAGE, USER_AGENT};
+use actix_web::http::StatusCode;
 use actix_web::App;
 use actix_web::HttpServer;
 use actix_web::Responder;
-use actix_web::{get, web};
+use actix_web::{delete, get, post, put, web};
+use actix_web::{HttpRequest, HttpResponse};
+use common::database;
+use common::database::model::NewClick;
 use common::errors::Error;
-use log::info;
+use common::utils::urls::HostAliases;
+use common::utils::words::Dictionary;
+use log::{error, info, warn};
+use std::time::SystemTime;
+use url::Url;
 
-use crate::search::{Info, Output};
+use crate::authority::Authorities;
+use crate::cache::Archive;
+use crate::clicks::{Click, Tracker};
+use crate::curations::Curations;
+use crate::experiments::{Experiments, Variant};
+use crate::metrics::Metrics;
+use crate::search::{Info, Output, Shard};
+use crate::submissions::{State, Submitter};
+use crate::suggestions::Suggester;
+use crate::terms::Terms;
+
+/// The header with the stable code of the error a request failed with.
+const ERROR_CODE: &str = "X-Error-Code";
 
 #[get("/")]
-async fn handle_query(info: web::Query<Info>) -> impl Responder {
+async fn handle_query(
+    request: HttpRequest,
+    info: web::Query<Info>,
+    dictionary: web::Data<Dictionary>,
+    tracker: web::Data<Tracker>,
+    archive: web::Data<Archive>,
+    shards: web::Data<Vec<Shard>>,
+    suggester: web::Data<Suggester>,
+    curations: web::Data<Curations>,
+    authorities: web::Data<Authorities>,
+    experiments: web::Data<Experiments>,
+    metrics: web::Data<Metrics>,
+) -> impl Responder {
+    let info = info.into_inner();
+    let variant = match get_variant(&request, &info, &experiments) {
+        Ok(variant) => variant,
+        Err(response) => return response,
+    };
+
+    let is_admin = admin::is_authorized(&request);
+    let accept_language = get_accept_language(&request);
+    match info
+        .search(
+            &dictionary,
+            &tracker,
+            &archive,
+            &shards,
+            &suggester,
+            &curations,
+            &authorities,
+            variant,
+            is_admin,
+            accept_language,
+        )
+        .await
+    {
+        Ok(search_results) => {
+            metrics.record_degraded(&search_results.degraded_stages);
+
+            let format = info.format.unwrap_or_default();
+            if format.is_export() {
+                return export::respond(
+                    info.query.as_deref().unwrap_or_default(),
+                    search_results.pages.unwrap_or_default(),
+                    format,
+                );
+            }
+
+            json::respond(&request, HttpResponse::Ok(), &search_results)
+        }
+        Err(err) => {
+            // Tell the client to back off while the database recovers, instead of retrying right away.
+            let response = if err.is_transient() {
+                HttpResponse::ServiceUnavailable()
+            } else {
+                HttpResponse::Ok()
+            };
+
+            json::respond(
+                &request,
+                response,
+                &Output {
+                    query: info.query,
+                    corrected_query: None,
+                    error: Some(Error::Internal(err.to_string())),
+                    pages: None,
+                    images: None,
+                    clusters: None,
+                    total: None,
+                    duplicates: None,
+                    partial: false,
+                    degraded: false,
+                    degraded_stages: Vec::new(),
+                    variant: None,
+                },
+            )
+        }
+    }
+}
+
+#[get("/search/urls")]
+async fn handle_search_urls(
+    request: HttpRequest,
+    info: web::Query<Info>,
+    dictionary: web::Data<Dictionary>,
+    shards: web::Data<Vec<Shard>>,
+    curations: web::Data<Curations>,
+    authorities: web::Data<Authorities>,
+    experiments: web::Data<Experiments>,
+) -> impl Responder {
     let info = info.into_inner();
+    let variant = match get_variant(&request, &info, &experiments) {
+        Ok(variant) => variant,
+        Err(response) => return response,
+    };
+
+    let is_admin = admin::is_authorized(&request);
+    let accept_language = get_accept_language(&request);
+    match info
+        .search_urls(
+            &dictionary,
+            &shards,
+            &curations,
+            &authorities,
+            variant,
+            is_admin,
+            accept_language,
+        )
+        .await
+    {
+        Ok(urls) => json::respond(&request, HttpResponse::Ok(), &urls),
+        Err(err) => get_error_response(&request, "Failed to search for URLs!", err),
+    }
+}
+
+#[get("/compare")]
+async fn handle_compare(
+    request: HttpRequest,
+    info: web::Query<Info>,
+    query: web::Query<compare::Query>,
+    dictionary: web::Data<Dictionary>,
+    shards: web::Data<Vec<Shard>>,
+    curations: web::Data<Curations>,
+    authorities: web::Data<Authorities>,
+    experiments: web::Data<Experiments>,
+) -> impl Responder {
+    if !admin::is_authorized(&request) {
+        return HttpResponse::Unauthorized().finish();
+    }
+
+    let Some(variants) = query.get_variants(&experiments) else {
+        return HttpResponse::BadRequest().finish();
+    };
+
+    let accept_language = get_accept_language(&request);
+    match info
+        .search_urls_with(
+            &dictionary,
+            &shards,
+            &curations,
+            &authorities,
+            &variants,
+            true,
+            accept_language,
+        )
+        .await
+    {
+        Ok(rankings) => json::respond(
+            &request,
+            HttpResponse::Ok(),
+            &compare::compare(&variants, rankings),
+        ),
+        Err(err) => get_error_response(&request, "Failed to compare the variants!", err),
+    }
+}
+
+#[post("/click")]
+async fn handle_click(
+    request: HttpRequest,
+    click: web::Json<Click>,
+    dictionary: web::Data<Dictionary>,
+    tracker: web::Data<Tracker>,
+) -> impl Responder {
+    let click = click.into_inner();
+
+    let query =
+        common::utils::words::extract(&click.query, rust_stemmers::Algorithm::English, &dictionary);
+    let query_hash = clicks::hash_query(&query);
+    let Some(variant) = tracker.verify_token(&click.token, &query_hash, &click.url, click.position)
+    else {
+        return HttpResponse::Forbidden().finish();
+    };
+    let variant = variant.to_string();
+
+    // Bots are told the click was recorded, so they have no reason to retry.
+    let user_agent = request
+        .headers()
+        .get(USER_AGENT)
+        .and_then(|user_agent| user_agent.to_str().ok());
+    if clicks::is_bot(user_agent) {
+        return HttpResponse::Accepted().finish();
+    }
+
+    let Some(ip) = clients::get_ip(&request) else {
+        return HttpResponse::BadRequest().finish();
+    };
+
+    let ip_prefix = clicks::truncate_ip(ip);
+    if tracker.is_rate_limited(&ip_prefix) {
+        return HttpResponse::TooManyRequests().finish();
+    }
 
-    let results = match info.search().await {
-        Ok(search_results) => search_results,
-        Err(err) => Output {
-            query: info.query,
-            error: Some(Error::Internal(err.to_string())),
-            pages: None,
+    let Ok(position) = i32::try_from(click.position) else {
+        return HttpResponse::BadRequest().finish();
+    };
+
+    let new_click = NewClick {
+        query_hash,
+        url: click.url,
+        position,
+        ip_prefix,
+        variant,
+    };
+
+    // Don't make the client wait for the click to be written.
+    actix_web::rt::spawn(async move {
+        if let Err(err) = database::create_click(&new_click).await {
+            warn!(
+                "Failed to record click on \"{}\"! Error: {err}",
+                new_click.url
+            );
+        }
+    });
+
+    HttpResponse::Accepted().finish()
+}
+
+#[post("/submit")]
+async fn handle_submit(
+    request: HttpRequest,
+    query: web::Query<submissions::Query>,
+    submitter: web::Data<Submitter>,
+) -> impl Responder {
+    let Some(ip) = clients::get_ip(&request) else {
+        return HttpResponse::BadRequest().finish();
+    };
+
+    match submitter.submit(&query.url, ip).await {
+        Ok(receipt) => match receipt.state {
+            State::Indexed => json::respond(&request, HttpResponse::Ok(), &receipt),
+            State::Submitted | State::Verified => {
+                json::respond(&request, HttpResponse::Accepted(), &receipt)
+            }
+            State::RateLimited => {
+                json::respond(&request, HttpResponse::TooManyRequests(), &receipt)
+            }
         },
+        Err(err) => get_error_response(
+            &request,
+            &format!("Failed to submit \"{}\"!", query.url),
+            err,
+        ),
+    }
+}
+
+#[get("/page")]
+async fn handle_page(
+    request: HttpRequest,
+    query: web::Query<pages::Query>,
+    host_aliases: web::Data<HostAliases>,
+) -> impl Responder {
+    let Ok(url) = Url::parse(&query.url) else {
+        return HttpResponse::BadRequest().finish();
     };
 
-    web::Json(results)
+    match pages::get_detail(&url, &host_aliases).await {
+        Ok(Some(detail)) => json::respond(&request, HttpResponse::Ok(), &detail),
+        Ok(None) => HttpResponse::NotFound().finish(),
+        Err(err) => get_error_response(
+            &request,
+            &format!("Failed to get the details of \"{url}\"!"),
+            err,
+        ),
+    }
+}
+
+#[get("/cache/{id}")]
+async fn handle_cache(
+    request: HttpRequest,
+    path: web::Path<i32>,
+    query: web::Query<cache::Query>,
+    archive: web::Data<Archive>,
+) -> impl Responder {
+    let page_id = path.into_inner();
+    if !archive.verify(page_id, &query.signature) {
+        return HttpResponse::Forbidden().finish();
+    }
+
+    match archive.get(page_id).await {
+        Ok(Some(html)) => HttpResponse::Ok()
+            .content_type("text/html; charset=utf-8")
+            .body(html),
+        Ok(None) => HttpResponse::NotFound().finish(),
+        Err(err) => get_error_response(
+            &request,
+            &format!("Failed to get the cached copy of page {page_id}!"),
+            err,
+        ),
+    }
+}
+
+#[get("/terms/stats")]
+async fn handle_term_stats(
+    request: HttpRequest,
+    query: web::Query<terms::Query>,
+    dictionary: web::Data<Dictionary>,
+    terms: web::Data<Terms>,
+) -> impl Responder {
+    match terms.get(&query.word, &dictionary) {
+        Ok(output) => json::respond(&request, HttpResponse::Ok(), &output),
+        Err(err) => get_error_response(&request, "Failed to get the term statistics!", err),
+    }
+}
+
+#[get("/health")]
+async fn handle_health() -> impl Responder {
+    HttpResponse::Ok().finish()
+}
+
+#[get("/stats")]
+async fn handle_stats(request: HttpRequest, experiments: web::Data<Experiments>) -> impl Responder {
+    if !admin::is_authorized(&request) {
+        return HttpResponse::Unauthorized().finish();
+    }
+
+    match database::get_variant_counts().await {
+        Ok(counts) => json::respond(
+            &request,
+            HttpResponse::Ok(),
+            &experiments::get_stats(&experiments, &counts),
+        ),
+        Err(err) => get_error_response(
+            &request,
+            "Failed to get the statistics of the ranking variants!",
+            err,
+        ),
+    }
+}
+
+#[get("/metrics")]
+async fn handle_metrics(request: HttpRequest, metrics: web::Data<Metrics>) -> impl Responder {
+    if !admin::is_authorized(&request) {
+        return HttpResponse::Unauthorized().finish();
+    }
+
+    json::respond(&request, HttpResponse::Ok(), &metrics.snapshot())
+}
+
+#[get("/admin/usage")]
+async fn handle_usage(request: HttpRequest, query: web::Query<usage::Query>) -> impl Responder {
+    if !admin::is_authorized(&request) {
+        return HttpResponse::Unauthorized().finish();
+    }
+
+    let since = usage::get_since(query.period, SystemTime::now());
+    match database::get_crawl_usage_since(since).await {
+        Ok(crawl_usage) => json::respond(
+            &request,
+            HttpResponse::Ok(),
+            &usage::aggregate(&crawl_usage, query.by, usage::TOP_CONSUMERS),
+        ),
+        Err(err) => get_error_response(&request, "Failed to get the crawl usage!", err),
+    }
+}
+
+#[get("/admin/crawl-log")]
+async fn handle_crawl_log(
+    request: HttpRequest,
+    query: web::Query<crawl_log::Query>,
+) -> impl Responder {
+    if !admin::is_authorized(&request) {
+        return HttpResponse::Unauthorized().finish();
+    }
+
+    let filter = match query.get_filter(SystemTime::now()) {
+        Ok(filter) => filter,
+        Err(err) => return get_error_response(&request, "Invalid crawl log query!", err),
+    };
+
+    if query.is_summary() {
+        return match database::count_crawl_events(&filter).await {
+            Ok(counts) => {
+                json::respond(&request, HttpResponse::Ok(), &crawl_log::summarize(&counts))
+            }
+            Err(err) => get_error_response(&request, "Failed to count the crawl log!", err),
+        };
+    }
+
+    let before = match query.get_before() {
+        Ok(before) => before,
+        Err(err) => return get_error_response(&request, "Invalid crawl log cursor!", err),
+    };
+
+    let limit = query.get_limit();
+    match database::get_crawl_events(&filter, before, limit).await {
+        Ok(events) => json::respond(
+            &request,
+            HttpResponse::Ok(),
+            &crawl_log::Page::new(events, limit),
+        ),
+        Err(err) => get_error_response(&request, "Failed to get the crawl log!", err),
+    }
+}
+
+#[get("/admin/curations")]
+async fn handle_curations(request: HttpRequest) -> impl Responder {
+    if !admin::is_authorized(&request) {
+        return HttpResponse::Unauthorized().finish();
+    }
+
+    match database::get_curations().await {
+        Ok(curations) => json::respond(&request, HttpResponse::Ok(), &curations),
+        Err(err) => get_error_response(&request, "Failed to get the curations!", err),
+    }
+}
+
+#[post("/admin/curations")]
+async fn handle_create_curation(
+    request: HttpRequest,
+    curation: web::Json<curations::Request>,
+    curations: web::Data<Curations>,
+) -> impl Responder {
+    if !admin::is_authorized(&request) {
+        return HttpResponse::Unauthorized().finish();
+    }
+
+    let new_curation = match curation.validate() {
+        Ok(new_curation) => new_curation,
+        Err(err) => return get_error_response(&request, "Invalid curation!", err),
+    };
+
+    match database::create_curation(&new_curation).await {
+        Ok(curation) => {
+            reload_curations(&curations).await;
+
+            json::respond(&request, HttpResponse::Created(), &curation)
+        }
+        Err(err) => get_error_response(&request, "Failed to create the curation!", err),
+    }
+}
+
+#[put("/admin/curations/{id}")]
+async fn handle_update_curation(
+    request: HttpRequest,
+    id: web::Path<i32>,
+    curation: web::Json<curations::Request>,
+    curations: web::Data<Curations>,
+) -> impl Responder {
+    if !admin::is_authorized(&request) {
+        return HttpResponse::Unauthorized().finish();
+    }
+
+    let new_curation = match curation.validate() {
+        Ok(new_curation) => new_curation,
+        Err(err) => return get_error_response(&request, "Invalid curation!", err),
+    };
+
+    match database::update_curation(*id, &new_curation).await {
+        Ok(Some(curation)) => {
+            reload_curations(&curations).await;
+
+            json::respond(&request, HttpResponse::Ok(), &curation)
+        }
+        Ok(None) => HttpResponse::NotFound().finish(),
+        Err(err) => get_error_response(&request, &format!("Failed to update curation #{id}!"), err),
+    }
+}
+
+#[delete("/admin/curations/{id}")]
+async fn handle_delete_curation(
+    request: HttpRequest,
+    id: web::Path<i32>,
+    curations: web::Data<Curations>,
+) -> impl Responder {
+    if !admin::is_authorized(&request) {
+        return HttpResponse::Unauthorized().finish();
+    }
+
+    match database::delete_curation(*id).await {
+        Ok(true) => {
+            reload_curations(&curations).await;
+
+            HttpResponse::NoContent().finish()
+        }
+        Ok(false) => HttpResponse::NotFound().finish(),
+        Err(err) => get_error_response(&request, &format!("Failed to delete curation #{id}!"), err),
+    }
+}
+
+/// Reloads the curations after an admin changed them, so the change applies right away on this server.
+///
+/// # Arguments
+///
+/// * `curations`: The cache of curations.
+async fn reload_curations(curations: &Curations) {
+    if let Err(err) = curations.refresh().await {
+        warn!("Failed to reload curations, applying the change later! Error: {err}");
+    }
+}
+
+/// Builds the response to a request that failed.
+///
+/// # Arguments
+///
+/// * `request`: The request that failed.
+/// * `context`: What failed, logged along with the error if it's not the client's fault.
+/// * `err`: The error.
+///
+/// # Returns
+///
+/// * `HttpResponse` - A response with the status of the error and its code in the `X-Error-Code` header.
+///
+/// # Notes
+///
+/// * Only client errors have a body with the error, since the client can't do anything about the others.
+fn get_error_response(request: &HttpRequest, context: &str, err: Error) -> HttpResponse {
+    let status = StatusCode::from_u16(err.status()).unwrap_or(StatusCode::INTERNAL_SERVER_ERROR);
+
+    let mut response = HttpResponse::build(status);
+    response.insert_header((ERROR_CODE, err.code()));
+
+    if status.is_client_error() {
+        return json::respond(request, response, &err);
+    }
+
+    warn!("{context} Error ({}): {err}", err.code());
+
+    response.finish()
+}
+
+/// Gets the ranking variant to search with.
+///
+/// # Arguments
+///
+/// * `request`: The request.
+/// * `info`: The query of the request.
+/// * `experiments`: The ranking variants.
+///
+/// # Returns
+///
+/// * `Ok(&Variant)` - The variant picked by an admin, or the one the client is assigned.
+/// * `Err(HttpResponse)` - The response to return, if a non-admin picked a variant or the variant doesn't exist.
+fn get_variant<'a>(
+    request: &HttpRequest,
+    info: &Info,
+    experiments: &'a Experiments,
+) -> Result<&'a Variant, HttpResponse> {
+    // Admins can pick a variant to compare them, everyone else sticks to the one they're assigned.
+    let variant = match &info.variant {
+        Some(name) if admin::is_authorized(request) => experiments.get(name),
+        Some(_) => return Err(HttpResponse::Forbidden().finish()),
+        None => Some(experiments.assign(info.client.as_deref())),
+    };
+
+    variant.ok_or_else(|| HttpResponse::BadRequest().finish())
+}
+
+/// Gets the `Accept-Language` header of a request.
+///
+/// # Arguments
+///
+/// * `request`: The request.
+///
+/// # Returns
+///
+/// * `Some(&str)` - The header, if it's set and valid.
+/// * `None` - If the header isn't set, or isn't valid.
+fn get_accept_language(request: &HttpRequest) -> Option<&str> {
+    request
+        .headers()
+        .get(ACCEPT_LANGUAGE)
+        .and_then(|accept_language| accept_language.to_str().ok())
 }
 
 #[actix_web::main]
+#[allow(clippy::expect_used)]
 async fn main() -> std::io::Result<()> {
     env_logger::init();
 
+    match std::env::args().nth(1).as_deref() {
+        None => {}
+        Some("aggregate-clicks") => {
+            info!("Aggregating clicks...");
+
+            if let Err(err) = clicks::aggregate().await {
+                error!("Failed to aggregate clicks! Error: {err}");
+            }
+
+            return Ok(());
+        }
+        Some("score-domains") => {
+            info!("Aggregating domain authorities...");
+
+            if let Err(err) = authority::aggregate().await {
+                error!("Failed to aggregate domain authorities! Error: {err}");
+            }
+
+            return Ok(());
+        }
+        Some("status") => {
+            let status = status::Status::collect().await;
+            if std::env::args().any(|arg| arg == "--json") {
+                println!(
+                    "{}",
+                    serde_json::to_string_pretty(&status).expect("Failed to serialize status!")
+                );
+            } else {
+                print!("{}", status.render(SystemTime::now()));
+            }
+
+            // Exit with a failure, so scripts and health checks notice.
+            if !status.is_healthy() {
+                std::process::exit(1);
+            }
+
+            return Ok(());
+        }
+        Some(command) => {
+            error!("Unknown command \"{command}\"! Available commands: aggregate-clicks, score-domains, status");
+
+            return Ok(());
+        }
+    }
+
+    let dictionary = web::Data::new(Dictionary::load().expect("Failed to load dictionary!"));
+    let tracker = web::Data::new(Tracker::load());
+    let shards = web::Data::new(Shard::load());
+    let suggester = web::Data::new(Suggester::load(&shards).await);
+    let curations = web::Data::new(Curations::load().await);
+    Curations::refresh_every(
+        curations.clone(),
+        common::utils::env::search::get_curation_refresh_interval(),
+    );
+    let authorities = web::Data::new(Authorities::load().await);
+    Authorities::refresh_every(
+        authorities.clone(),
+        common::utils::env::search::get_authority_refresh_interval(),
+    );
+    let terms = web::Data::new(Terms::default());
+    Terms::refresh_every(
+        terms.clone(),
+        shards.clone(),
+        common::utils::env::search::get_term_stats_interval(),
+    );
+    let experiments =
+        web::Data::new(Experiments::load().expect("Failed to load ranking variants!"));
+    let metrics = web::Data::new(Metrics::default());
+    let submitter =
+        web::Data::new(Submitter::load().expect("Failed to build the submission HTTP client!"));
+    let host_aliases = web::Data::new(HostAliases::load());
+    let archive = web::Data::new(Archive::load().expect("Failed to load content dictionary!"));
+
     let (ip, port) = common::utils::env::web::get_address();
 
     info!("Starting web server...");
     info!("Listening on \"http://{ip}:{port}\"...");
-    HttpServer::new(|| App::new().service(handle_query))
-        .bind((ip, port))?
-        .run()
-        .await
+    HttpServer::new(move || {
+        App::new()
+            .app_data(dictionary.clone())
+            .app_data(tracker.clone())
+            .app_data(shards.clone())
+            .app_data(suggester.clone())
+            .app_data(curations.clone())
+            .app_data(authorities.clone())
+            .app_data(terms.clone())
+            .app_data(experiments.clone())
+            .app_data(metrics.clone())
+            .app_data(submitter.clone())
+            .app_data(host_aliases.clone())
+            .app_data(archive.clone())
+            .service(handle_query)
+            .service(handle_search_urls)
+            .service(handle_compare)
+            .service(handle_click)
+            .service(handle_submit)
+            .service(handle_page)
+            .service(handle_cache)
+            .service(handle_term_stats)
+            .service(handle_health)
+            .service(handle_stats)
+            .service(handle_metrics)
+            .service(handle_usage)
+            .service(handle_crawl_log)
+            .service(handle_curations)
+            .service(handle_create_curation)
+            .service(handle_update_curation)
+            .service(handle_delete_curation)
+    })
+    .bind((ip, port))?
+    .run()
+    .await
 }
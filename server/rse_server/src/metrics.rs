@@ -0,0 +1,74 @@
+use crate::search::Stage;
+use serde::Serialize;
+use std::collections::HashMap;
+use std::sync::Mutex;
+
+/// The metrics of the server since it started.
+///
+/// # Fields
+///
+/// * `degraded`: The number of degraded responses, by the stage that wasn't done in time.
+#[derive(Debug, Default)]
+pub struct Metrics {
+    degraded: Mutex<HashMap<Stage, u64>>,
+}
+
+/// A snapshot of the metrics of the server.
+///
+/// # Fields
+///
+/// * `degraded`: The number of degraded responses, by the stage that wasn't done in time.
+#[derive(Debug, Serialize, PartialEq, Eq)]
+pub struct Snapshot {
+    pub degraded: HashMap<Stage, u64>,
+}
+
+impl Metrics {
+    /// Records a degraded response.
+    ///
+    /// # Arguments
+    ///
+    /// * `stages`: The stages that weren't done in time, nothing is recorded if there are none.
+    pub fn record_degraded(&self, stages: &[Stage]) {
+        if let Ok(mut degraded) = self.degraded.lock() {
+            for stage in stages {
+                *degraded.entry(*stage).or_insert(0) += 1;
+            }
+        }
+    }
+
+    /// Takes a snapshot of the metrics.
+    ///
+    /// # Returns
+    ///
+    /// * `Snapshot` - The current metrics.
+    #[must_use]
+    pub fn snapshot(&self) -> Snapshot {
+        Snapshot {
+            degraded: self
+                .degraded
+                .lock()
+                .map(|degraded| degraded.clone())
+                .unwrap_or_default(),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_record_degraded() {
+        let metrics = Metrics::default();
+
+        metrics.record_degraded(&[Stage::Backlinks]);
+        metrics.record_degraded(&[Stage::Backlinks, Stage::Clicks]);
+        metrics.record_degraded(&[]);
+
+        assert_eq!(
+            metrics.snapshot().degraded,
+            HashMap::from([(Stage::Backlinks, 2), (Stage::Clicks, 1)])
+        );
+    }
+}
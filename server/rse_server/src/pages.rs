@@ -0,0 +1,72 @@
+use crate::search;
+use common::database;
+use common::database::model::{Page, PageHistory};
+use common::errors::Error;
+use common::utils::history;
+use common::utils::urls::{self, HostAliases};
+use serde::{Deserialize, Serialize};
+use url::Url;
+
+/// The query of a page detail request.
+///
+/// # Fields
+///
+/// * `url`: The URL of the page.
+#[derive(Debug, Deserialize)]
+pub struct Query {
+    pub url: String,
+}
+
+/// The details of a page.
+///
+/// # Fields
+///
+/// * `page`: The page, including when it was first seen.
+/// * `display_url`: The URL of the page to show, with its host in Unicode.
+/// * `history`: The recorded crawls of the page, newest first.
+/// * `change_rate`: The share of recrawls where the content had changed, if it was crawled successfully more than once.
+#[derive(Debug, Serialize)]
+pub struct Detail {
+    #[serde(flatten)]
+    pub page: Page,
+    pub display_url: String,
+    pub history: Vec<PageHistory>,
+    pub change_rate: Option<f64>,
+}
+
+/// Gets the details of a page.
+///
+/// # Arguments
+///
+/// * `url`: The URL of the page, in any form that normalizes to the stored one.
+/// * `host_aliases`: The aliases of hosts, so a page can be looked up through an alias of its host.
+///
+/// # Returns
+///
+/// * `Ok(Some(Detail))` - The details of the page if it's indexed.
+/// * `Ok(None)` - If the page isn't indexed.
+/// * `Err(Error)` - If the details could not be retrieved.
+///
+/// # Errors
+///
+/// * If the database connection could not be established.
+/// * If the page or its history could not be retrieved.
+pub async fn get_detail(url: &Url, host_aliases: &HostAliases) -> Result<Option<Detail>, Error> {
+    let Ok(mut conn) = database::get_connection().await else {
+        return Err(Error::Database("Failed to get database connection!".into()));
+    };
+
+    let Some(page) =
+        database::get_page_by_url(&mut conn, &host_aliases.apply(&urls::normalize(url))).await?
+    else {
+        return Ok(None);
+    };
+    let history = database::get_page_history(&mut conn, page.id).await?;
+
+    Ok(Some(Detail {
+        change_rate: history::get_change_rate(&history),
+        display_url: search::get_display_url(&page.url),
+        page,
+        history,
+    }))
+}
@@ -0,0 +1,299 @@
+use common::database::model::WordMatch;
+use std::collections::HashMap;
+use std::sync::Mutex;
+use std::time::{Duration, Instant};
+
+/// The maximum number of searched terms counted, before the counts are halved and the rarest terms forgotten.
+const MAXIMUM_COUNTED_TERMS: usize = 10_000;
+
+/// An in-memory cache of the postings of the most searched terms of a shard.
+///
+/// # Fields
+///
+/// * `capacity`: The maximum number of postings cached, `0` to disable the cache.
+/// * `top_terms`: The number of most searched terms whose postings are cached.
+/// * `interval`: The time postings are served for, before they're loaded from the shard again.
+/// * `state`: The counted terms and the cached postings.
+#[derive(Debug)]
+pub struct PostingCache {
+    capacity: usize,
+    top_terms: usize,
+    interval: Duration,
+    state: Mutex<State>,
+}
+
+/// The state of a posting cache.
+///
+/// # Fields
+///
+/// * `counts`: How often each term was searched for.
+/// * `postings`: The cached postings of each term.
+/// * `size`: The number of postings cached.
+/// * `clock`: The number of lookups, telling when the postings of a term were last used.
+#[derive(Debug, Default)]
+struct State {
+    counts: HashMap<String, u64>,
+    postings: HashMap<String, Postings>,
+    size: usize,
+    clock: u64,
+}
+
+/// The cached postings of a term.
+///
+/// # Fields
+///
+/// * `matches`: The keywords of the term, along with the URL and language of their pages.
+/// * `loaded_at`: When the postings were loaded from the shard.
+/// * `used_at`: The lookup the postings were last used by.
+#[derive(Debug)]
+struct Postings {
+    matches: Vec<WordMatch>,
+    loaded_at: Instant,
+    used_at: u64,
+}
+
+impl PostingCache {
+    /// Creates a new, empty posting cache.
+    ///
+    /// # Arguments
+    ///
+    /// * `capacity`: The maximum number of postings cached, `0` to disable the cache.
+    /// * `top_terms`: The number of most searched terms whose postings are cached.
+    /// * `interval`: The time postings are served for, before they're loaded from the shard again.
+    ///
+    /// # Returns
+    ///
+    /// * `PostingCache` - The new posting cache.
+    #[must_use]
+    pub fn new(capacity: usize, top_terms: usize, interval: Duration) -> Self {
+        Self {
+            capacity,
+            top_terms,
+            interval,
+            state: Mutex::new(State::default()),
+        }
+    }
+
+    /// Counts a search for terms, and gets the cached postings of them.
+    ///
+    /// # Arguments
+    ///
+    /// * `words`: The stemmed words of the query.
+    ///
+    /// # Returns
+    ///
+    /// * `(Vec<WordMatch>, Vec<String>)` - The cached postings, and the words that have to be looked up on the shard.
+    pub fn get(&self, words: &[String]) -> (Vec<WordMatch>, Vec<String>) {
+        if self.capacity == 0 {
+            return (Vec::new(), words.to_vec());
+        }
+
+        let Ok(mut state) = self.state.lock() else {
+            return (Vec::new(), words.to_vec());
+        };
+
+        state.clock += 1;
+        state.count(words);
+
+        let clock = state.clock;
+        let mut matches = Vec::new();
+        let mut missing = Vec::new();
+        for word in words {
+            match state.postings.get_mut(word) {
+                Some(postings) if postings.loaded_at.elapsed() < self.interval => {
+                    postings.used_at = clock;
+                    matches.extend(postings.matches.iter().cloned());
+                }
+                _ => missing.push(word.clone()),
+            }
+        }
+
+        (matches, missing)
+    }
+
+    /// Caches the postings looked up on the shard, of the words that are among the most searched.
+    ///
+    /// # Arguments
+    ///
+    /// * `words`: The words that were looked up.
+    /// * `matches`: The postings of the words.
+    ///
+    /// # Notes
+    ///
+    /// * The least recently used postings are evicted to make room, and postings larger than the cache are never cached.
+    pub fn insert(&self, words: &[String], matches: &[WordMatch]) {
+        if self.capacity == 0 {
+            return;
+        }
+
+        let Ok(mut state) = self.state.lock() else {
+            return;
+        };
+
+        let mut grouped = HashMap::<&str, Vec<WordMatch>>::new();
+        for word_match in matches {
+            grouped
+                .entry(word_match.word.as_str())
+                .or_default()
+                .push(word_match.clone());
+        }
+
+        let clock = state.clock;
+        for word in words {
+            if !state.is_top(word, self.top_terms) {
+                continue;
+            }
+
+            let matches = grouped.remove(word.as_str()).unwrap_or_default();
+            if matches.len() > self.capacity {
+                continue;
+            }
+
+            state.remove(word);
+            while state.size + matches.len() > self.capacity {
+                let Some(oldest) = state
+                    .postings
+                    .iter()
+                    .min_by_key(|(_, postings)| postings.used_at)
+                    .map(|(word, _)| word.clone())
+                else {
+                    break;
+                };
+
+                state.remove(&oldest);
+            }
+
+            state.size += matches.len();
+            state.postings.insert(
+                word.clone(),
+                Postings {
+                    matches,
+                    loaded_at: Instant::now(),
+                    used_at: clock,
+                },
+            );
+        }
+    }
+}
+
+impl State {
+    /// Counts a search for terms.
+    ///
+    /// # Arguments
+    ///
+    /// * `words`: The stemmed words of the query.
+    fn count(&mut self, words: &[String]) {
+        for word in words {
+            *self.counts.entry(word.clone()).or_insert(0) += 1;
+        }
+
+        // Forget the rarest terms once too many are counted, so old searches count for less.
+        if self.counts.len() > MAXIMUM_COUNTED_TERMS {
+            self.counts.retain(|_, count| {
+                *count /= 2;
+
+                *count > 0
+            });
+        }
+    }
+
+    /// Checks if a term is among the most searched.
+    ///
+    /// # Arguments
+    ///
+    /// * `word`: The stemmed word.
+    /// * `top_terms`: The number of most searched terms.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether fewer than `top_terms` terms are searched for more often.
+    fn is_top(&self, word: &str, top_terms: usize) -> bool {
+        let Some(&count) = self.counts.get(word) else {
+            return false;
+        };
+
+        self.counts.values().filter(|&&other| other > count).count() < top_terms
+    }
+
+    /// Removes the cached postings of a term.
+    ///
+    /// # Arguments
+    ///
+    /// * `word`: The stemmed word.
+    fn remove(&mut self, word: &str) {
+        if let Some(postings) = self.postings.remove(word) {
+            self.size -= postings.matches.len();
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn word_match(url: &str, word: &str) -> WordMatch {
+        WordMatch {
+            url: url.to_string(),
+            language: None,
+            published_at: None,
+            unstable: false,
+            word: word.to_string(),
+            frequency: 1,
+            positions: vec![0],
+            field: "body".into(),
+        }
+    }
+
+    fn words(words: &[&str]) -> Vec<String> {
+        words.iter().map(|word| (*word).to_string()).collect()
+    }
+
+    #[test]
+    fn test_get() {
+        let cache = PostingCache::new(3, 2, Duration::from_secs(60));
+        let matches = vec![
+            word_match("https://a.com/", "rust"),
+            word_match("https://b.com/", "rust"),
+            word_match("https://a.com/", "tutori"),
+        ];
+
+        // Nothing is cached before it's looked up once.
+        let query = words(&["rust", "tutori"]);
+        assert_eq!(cache.get(&query), (Vec::new(), query.clone()));
+        cache.insert(&query, &matches);
+
+        // The cached postings are the same as looking them up again.
+        let (cached, missing) = cache.get(&query);
+        assert!(missing.is_empty());
+        assert_eq!(cached.len(), matches.len());
+        assert!(matches.iter().all(|word_match| cached.contains(word_match)));
+
+        // Uncached terms are looked up on the shard, while the rest come from the cache.
+        let query = words(&["rust", "async"]);
+        let (cached, missing) = cache.get(&query);
+        assert_eq!(cached, matches[..2].to_vec());
+        assert_eq!(missing, words(&["async"]));
+
+        // The least recently used postings are evicted to make room.
+        cache.get(&query);
+        cache.insert(&words(&["async"]), &[word_match("https://c.com/", "async")]);
+        assert_eq!(cache.get(&words(&["tutori"])).1, words(&["tutori"]));
+        assert!(cache.get(&words(&["rust", "async"])).1.is_empty());
+    }
+
+    #[test]
+    fn test_get_expired_or_disabled() {
+        let query = words(&["rust"]);
+        let matches = vec![word_match("https://a.com/", "rust")];
+
+        for cache in [
+            PostingCache::new(10, 10, Duration::ZERO),
+            PostingCache::new(0, 10, Duration::from_secs(60)),
+        ] {
+            cache.get(&query);
+            cache.insert(&query, &matches);
+
+            assert_eq!(cache.get(&query), (Vec::new(), query.clone()));
+        }
+    }
+}
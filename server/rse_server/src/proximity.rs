@@ -0,0 +1,76 @@
+/// Scores how close the query terms are to each other on a page.
+///
+/// # Arguments
+///
+/// * `positions`: The positions of each query term on the page, in order.
+///
+/// # Returns
+///
+/// * `f64` - The proximity, `1.0` if the terms are next to each other, approaching `0.0` the further apart they are.
+///
+/// # Notes
+///
+/// * The proximity is `0.0` if there are fewer than two terms, or a term has no positions.
+/// * The terms are scored by the smallest span of words covering every one of them, in any order.
+#[must_use]
+#[allow(clippy::cast_precision_loss)]
+pub fn get_proximity(positions: &[&[i32]]) -> f64 {
+    if positions.len() < 2 || positions.iter().any(|positions| positions.is_empty()) {
+        return 0.0;
+    }
+
+    let mut occurrences = positions
+        .iter()
+        .enumerate()
+        .flat_map(|(term, positions)| positions.iter().map(move |&position| (position, term)))
+        .collect::<Vec<_>>();
+    occurrences.sort_unstable();
+
+    // Slide a window over the occurrences, shrinking it from the start while it covers every term.
+    let mut counts = vec![0_usize; positions.len()];
+    let mut covered = 0;
+    let mut start = 0;
+    let mut smallest_span = i32::MAX;
+    for &(end_position, end_term) in &occurrences {
+        if counts[end_term] == 0 {
+            covered += 1;
+        }
+        counts[end_term] += 1;
+
+        while covered == positions.len() {
+            let (start_position, start_term) = occurrences[start];
+            smallest_span = smallest_span.min(end_position - start_position);
+
+            counts[start_term] -= 1;
+            if counts[start_term] == 0 {
+                covered -= 1;
+            }
+            start += 1;
+        }
+    }
+
+    (positions.len() - 1) as f64 / f64::from(smallest_span.max(1))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_get_proximity() {
+        // Next to each other, in either order.
+        assert!((get_proximity(&[&[4], &[5]]) - 1.0).abs() < f64::EPSILON);
+        assert!((get_proximity(&[&[5], &[4]]) - 1.0).abs() < f64::EPSILON);
+
+        // The closest occurrences are used.
+        assert!((get_proximity(&[&[0, 40], &[20, 42]]) - 0.5).abs() < f64::EPSILON);
+
+        // Three terms spread over five words.
+        assert!((get_proximity(&[&[10], &[12], &[14]]) - 0.5).abs() < f64::EPSILON);
+
+        assert!(get_proximity(&[&[1], &[100]]) < get_proximity(&[&[1], &[10]]));
+
+        assert!(get_proximity(&[&[1, 2, 3]]).abs() < f64::EPSILON);
+        assert!(get_proximity(&[&[1], &[]]).abs() < f64::EPSILON);
+    }
+}
@@ -1,144 +1,524 @@
+use crate::authority::Authorities;
+use crate::cache::Archive;
+use crate::clicks;
+use crate::clicks::Tracker;
+use crate::clusters::{self, Cluster};
+use crate::curations::{Curated, Curations};
+use crate::experiments::{Variant, Weights};
+use crate::export::Format;
+use crate::language;
+use crate::postings::PostingCache;
+use crate::proximity;
+use crate::snippet::Snippet;
+use crate::suggestions::Suggester;
+use common::database::model::{Field, Image, NewSearch, WordMatch};
+use common::database::retry::{self, CircuitBreaker};
+use common::database::store::{Postgres, Store};
 use common::database::CompletePage;
 use common::errors::Error;
+use common::utils::words::Dictionary;
 use common::{database, utils};
+use futures::future::join_all;
 use log::warn;
 use serde::{Deserialize, Serialize};
-use std::collections::HashMap;
+use std::cmp::Ordering;
+use std::collections::{HashMap, HashSet};
+use std::future::Future;
+use std::time::{Instant, SystemTime};
+use url::Url;
+
+/// The share of the search timeout spent finding candidates, the rest is left for ranking them.
+const CANDIDATES_SHARE: f64 = 0.6;
+
+/// The number of best ranked pages whose images are searched, for image searches.
+const IMAGE_PAGES: usize = 100;
+
+/// The number of best ranked pages collapsed by their content, for searches without duplicates.
+const DEDUP_PAGES: usize = 1_000;
+
+/// The kind of results to search for.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Kind {
+    #[default]
+    Web,
+    Image,
+}
+
+/// The order to return results in.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Sort {
+    /// The best ranked first.
+    #[default]
+    Relevance,
+    /// The most recently published first, and the ones without a publish date last.
+    Date,
+}
+
+impl Sort {
+    /// Orders two results by when they were published, if sorting by date.
+    ///
+    /// # Arguments
+    ///
+    /// * `a`: When the first result was published, if known.
+    /// * `b`: When the second result was published, if known.
+    ///
+    /// # Returns
+    ///
+    /// * `Ordering` - `Less` if the first result goes first, and `Equal` if they're left to be ordered by their rank.
+    #[must_use]
+    pub fn order(self, a: Option<SystemTime>, b: Option<SystemTime>) -> Ordering {
+        match self {
+            Self::Relevance => Ordering::Equal,
+            Self::Date => match (a, b) {
+                (Some(a), Some(b)) => b.cmp(&a),
+                (Some(_), None) => Ordering::Less,
+                (None, Some(_)) => Ordering::Greater,
+                (None, None) => Ordering::Equal,
+            },
+        }
+    }
+}
+
+/// A stage of a search that can be skipped if it isn't done in time.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Stage {
+    Backlinks,
+    Clicks,
+}
+
+/// A database shard to search.
+///
+/// # Fields
+///
+/// * `store`: The store of the shard, a Postgres database by default.
+/// * `breaker`: The circuit breaker of the database.
+/// * `postings`: The cached postings of the most searched terms of the database.
+#[derive(Debug)]
+pub struct Shard {
+    pub store: Box<dyn Store>,
+    pub breaker: CircuitBreaker,
+    pub postings: PostingCache,
+}
+
+impl Shard {
+    /// Loads the database shards to search from the environment.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<Shard>` - The database shards.
+    #[must_use]
+    pub fn load() -> Vec<Self> {
+        let threshold = utils::env::database::get_circuit_breaker_threshold();
+        let cooldown = utils::env::database::get_circuit_breaker_cooldown();
+        let posting_cache_size = utils::env::search::get_posting_cache_size();
+        let posting_cache_terms = utils::env::search::get_posting_cache_terms();
+        let posting_cache_interval = utils::env::search::get_posting_cache_interval();
+
+        utils::env::database::get_database_urls()
+            .into_iter()
+            .map(|url| Self {
+                store: Box::new(Postgres::new(url)),
+                breaker: CircuitBreaker::new(threshold, cooldown),
+                postings: PostingCache::new(
+                    posting_cache_size,
+                    posting_cache_terms,
+                    posting_cache_interval,
+                ),
+            })
+            .collect()
+    }
+}
 
 /// A query.
 ///
 /// # Fields
 ///
-/// * `query`: The query string.
-#[derive(Debug, Serialize, Deserialize)]
+/// * `query`: The query string, where terms like `title:rust` only match that field of a page.
+/// * `boost`: The term boosts, as comma separated `term:factor` pairs.
+/// * `page`: The page of results to return, starting at `1`.
+/// * `limit`: The number of results per page.
+/// * `client`: The anonymous token of the client, used to assign it a ranking variant.
+/// * `variant`: The ranking variant to use, only allowed for admins.
+/// * `format`: The format to return the results in.
+/// * `lang`: The only language to return pages in.
+/// * `accept_lang`: The preferred languages, comma separated, favoring pages in them instead of leaving out the others.
+/// * `after`: Only return pages published at or after this date, like `2024-05-12`.
+/// * `before`: Only return pages published before this date.
+/// * `autocorrect`: Whether to search for the corrected query if there are no results, `true` by default.
+/// * `kind`: The kind of results to return, pages by default, or the images on them with `type=image`.
+/// * `cluster`: Whether to group the returned page of results by their topic.
+/// * `sort`: The order to return the results in, by relevance by default, or the most recently published first with `sort=date`.
+/// * `dedup`: Whether to collapse the pages with the same content into the best ranked of them.
+#[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct Info {
     #[serde(rename = "q")]
     pub query: Option<String>,
+    pub boost: Option<String>,
+    pub page: Option<usize>,
+    pub limit: Option<usize>,
+    pub client: Option<String>,
+    pub variant: Option<String>,
+    pub format: Option<Format>,
+    pub lang: Option<String>,
+    pub accept_lang: Option<String>,
+    pub after: Option<String>,
+    pub before: Option<String>,
+    pub autocorrect: Option<bool>,
+    #[serde(rename = "type")]
+    pub kind: Option<Kind>,
+    pub cluster: Option<bool>,
+    pub sort: Option<Sort>,
+    pub dedup: Option<bool>,
 }
 
 impl Info {
-    /// Searches for pages.
+    /// Searches for pages, or for the corrected query if there are none.
+    ///
+    /// # Arguments
+    ///
+    /// * `dictionary`: The stop words and protected words, the same as the crawler uses.
+    /// * `tracker`: The tracker to issue the click tokens of the results with.
+    /// * `archive`: The archive to sign the links to the cached copies of the results with.
+    /// * `shards`: The database shards to search.
+    /// * `suggester`: The suggester to correct the query with.
+    /// * `curations`: The curations of the results of queries.
+    /// * `authorities`: The authority of the domains of the results.
+    /// * `variant`: The ranking variant to rank the pages with.
+    /// * `is_admin`: Whether the search was made by an admin, who can export any number of results.
+    /// * `accept_language`: The `Accept-Language` header of the request, used if `accept_lang` isn't given.
     ///
     /// # Returns
     ///
-    /// * `Result<Output, Box<dyn std::errors::Error>>` - The search results.
+    /// * `Ok(Output)` - The search results, with the query they're for in `corrected_query` if it was corrected.
+    /// * `Err(Error)` - If the search failed.
     ///
     /// # Errors
     ///
     /// * If the database connection fails.
-    /// * If no pages are found.
-    #[allow(clippy::expect_used, clippy::cast_precision_loss)]
-    pub async fn search(&self) -> Result<Output, Error> {
-        // Get the query.
-        let query = match &self.query {
-            Some(query) => {
-                if query.is_empty() {
-                    return Err(Error::Query("No query provided!".into()));
-                }
+    /// * If the language or a date is invalid.
+    /// * If images are searched for in an export format.
+    /// * If no pages are found, for the query or its correction.
+    /// * If every shard is unavailable, or too slow.
+    ///
+    /// # Notes
+    ///
+    /// * The query is only corrected if it has no results, `autocorrect` isn't `false`, and the correction has at least `AUTOCORRECT_CONFIDENCE`.
+    /// * The corrected query is searched for once, and never corrected again.
+    #[allow(clippy::too_many_arguments)]
+    pub async fn search(
+        &self,
+        dictionary: &Dictionary,
+        tracker: &Tracker,
+        archive: &Archive,
+        shards: &[Shard],
+        suggester: &Suggester,
+        curations: &Curations,
+        authorities: &Authorities,
+        variant: &Variant,
+        is_admin: bool,
+        accept_language: Option<&str>,
+    ) -> Result<Output, Error> {
+        if let Some(output) = self
+            .search_pages(
+                dictionary,
+                tracker,
+                archive,
+                shards,
+                curations,
+                authorities,
+                variant,
+                is_admin,
+                accept_language,
+            )
+            .await?
+        {
+            return Ok(output);
+        }
 
-                query
-            }
-            None => return Err(Error::Query("No query provided!".into())),
+        let correction = self
+            .query
+            .as_deref()
+            .filter(|_| self.autocorrect.unwrap_or(true))
+            .and_then(|query| suggester.correct(query, dictionary))
+            .filter(|correction| {
+                correction.confidence >= utils::env::search::get_autocorrect_confidence()
+            });
+        let Some(correction) = correction else {
+            return Err(Error::Query("No pages found!".into()));
         };
 
-        let Ok(mut conn) = database::get_connection().await else {
-            return Err(Error::Database("Failed to get database connection!".into()));
+        let corrected = Self {
+            query: Some(correction.query.clone()),
+            ..self.clone()
         };
-
-        let query = utils::words::extract(query, rust_stemmers::Algorithm::English);
-
-        // Get pages like the query, if any.
-        let Some(pages) = database::get_pages_with_words(
-            &mut conn,
-            query.keys().map(std::string::ToString::to_string).collect(),
-        )
-        .await?
+        let Some(mut output) = corrected
+            .search_pages(
+                dictionary,
+                tracker,
+                archive,
+                shards,
+                curations,
+                authorities,
+                variant,
+                is_admin,
+                accept_language,
+            )
+            .await?
         else {
             return Err(Error::Query("No pages found!".into()));
         };
 
-        // Map the pages to their keywords.
+        output.query.clone_from(&self.query);
+        output.corrected_query = Some(correction.query);
+
+        Ok(output)
+    }
+
+    /// Searches for pages matching the query as it is.
+    ///
+    /// # Arguments
+    ///
+    /// * `dictionary`: The stop words and protected words, the same as the crawler uses.
+    /// * `tracker`: The tracker to issue the click tokens of the results with.
+    /// * `archive`: The archive to sign the links to the cached copies of the results with.
+    /// * `shards`: The database shards to search.
+    /// * `curations`: The curations of the results of queries.
+    /// * `authorities`: The authority of the domains of the results.
+    /// * `variant`: The ranking variant to rank the pages with.
+    /// * `is_admin`: Whether the search was made by an admin, who can export any number of results.
+    /// * `accept_language`: The `Accept-Language` header of the request, used if `accept_lang` isn't given.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Some(Output))` - The search results.
+    /// * `Ok(None)` - If no pages are found.
+    /// * `Err(Error)` - If the search failed.
+    ///
+    /// # Errors
+    ///
+    /// * If the database connection fails.
+    /// * If the language or a date is invalid.
+    /// * If images are searched for in an export format.
+    /// * If every shard is unavailable, or too slow.
+    ///
+    /// # Notes
+    ///
+    /// * If the backlinks or click-through rates aren't found by `SEARCH_TIMEOUT`, the pages are ranked without them and the output is marked as degraded.
+    /// * Pinned pages are put at the top even if they weren't found, as long as they're found by `SEARCH_TIMEOUT`.
+    #[allow(clippy::cast_precision_loss, clippy::too_many_arguments)]
+    async fn search_pages(
+        &self,
+        dictionary: &Dictionary,
+        tracker: &Tracker,
+        archive: &Archive,
+        shards: &[Shard],
+        curations: &Curations,
+        authorities: &Authorities,
+        variant: &Variant,
+        is_admin: bool,
+        accept_language: Option<&str>,
+    ) -> Result<Option<Output>, Error> {
+        if self.kind.unwrap_or_default() == Kind::Image
+            && self.format.unwrap_or_default().is_export()
+        {
+            return Err(Error::Query("Images can't be exported!".into()));
+        }
+
+        let query = self.get_query(dictionary)?;
+        let fields = self.get_fields(dictionary);
+        let boosts = self.get_boosts(
+            &query,
+            dictionary,
+            utils::env::ranker::get_maximum_term_boost(),
+        );
+        let query_hash = clicks::hash_query(&query);
+
+        let required_language = self.get_required_language()?;
+        let preferred_languages = self.get_preferred_languages(accept_language);
+        let published_range = self.get_published_range()?;
+
+        // Everything has to be done by the deadline, and finding the candidates only gets the first part of it.
+        let started_at = Instant::now();
+        let timeout = utils::env::search::get_search_timeout();
+        let candidates_deadline = started_at + timeout.mul_f64(CANDIDATES_SHARE);
+        let deadline = started_at + timeout;
+
+        // Query all the shards at once, and merge what the healthy ones return.
+        let words = query
+            .keys()
+            .map(std::string::ToString::to_string)
+            .collect::<Vec<_>>();
+        let results = join_all(shards.iter().map(|shard| {
+            with_deadline(
+                candidates_deadline,
+                Self::get_candidates(shard, words.clone()),
+            )
+        }))
+        .await;
+
+        let mut partial = false;
+        let mut unavailable = false;
         let mut unordered_pages = Vec::new();
-        for page in pages {
-            let page_id = page.id;
-            let page = CompletePage {
-                page,
-                keywords: database::get_keywords_by_page_id(&mut conn, page_id).await?,
-            };
+        let mut healthy_shards = Vec::new();
+        for (index, (shard, result)) in shards.iter().zip(results).enumerate() {
+            match result {
+                Ok(mut pages) => {
+                    pages.retain(|page| {
+                        Self::is_in_language(page, required_language.as_deref())
+                            && Self::is_published_in(page.page.published_at, published_range)
+                    });
+
+                    healthy_shards.push(shard);
+                    unordered_pages.extend(pages);
+                }
+                Err(err) => {
+                    warn!(
+                        "Failed to search shard #{index}, returning partial results! Error: {err}"
+                    );
 
-            unordered_pages.push(page);
+                    partial = true;
+                    unavailable |= err.is_transient();
+                }
+            }
         }
 
-        // Find the backlinks for each page.
-        let mut backlinks = HashMap::new();
-        for page in &unordered_pages {
-            let page_backlinks = database::get_backlinks(&mut conn, page).await?;
+        if unordered_pages.is_empty() {
+            if unavailable {
+                return Err(Error::Unavailable("The database is unavailable!".into()));
+            }
 
-            for backlink in page_backlinks {
-                let count = backlinks.entry(backlink).or_insert(0);
-                *count += 1;
+            if partial {
+                return Err(Error::Database("Failed to search the database!".into()));
             }
+
+            Self::log_search(&query_hash, variant, 0);
+
+            return Ok(None);
         }
 
+        // Look up the backlinks and click-through rates at the same time, and rank without whatever is too slow.
+        let click_weight = variant.weights.click_weight;
+        let (backlinks, click_through_rates, degraded_stages) = Self::get_ranking_data(
+            async {
+                // Links are stored on the shard of the page they're on, so every shard can link to every page.
+                let results = join_all(
+                    healthy_shards
+                        .iter()
+                        .map(|shard| Self::get_backlinks(shard, &unordered_pages)),
+                )
+                .await;
+
+                let mut backlinks = HashMap::new();
+                for result in results {
+                    for (backlink, frequency) in result? {
+                        *backlinks.entry(backlink).or_insert(0_u32) += frequency;
+                    }
+                }
+
+                Ok::<_, Error>(backlinks)
+            },
+            async {
+                if click_weight > 0.0 {
+                    database::get_click_through_rates(&query_hash).await
+                } else {
+                    Ok(HashMap::new())
+                }
+            },
+            deadline,
+        )
+        .await;
+
         // Sum up the token counts for each page, and use that as the relevance score for the page.
         let mut relevance_scores = HashMap::new();
         for page in &unordered_pages {
-            let mut score = 0;
             let Some(keywords) = &page.keywords else {
                 warn!("No keywords for page: {}", page.page.url);
 
                 continue;
             };
 
-            // For each keyword, add the frequency of the keyword times the frequency of the word in the query.
-            for keyword in keywords {
-                if let Some(frequency) = query.get(&keyword.word) {
-                    score += frequency * usize::try_from(keyword.frequency)?;
-                }
-            }
+            let score = Self::get_relevance(
+                &query,
+                &boosts,
+                &fields,
+                keywords.iter().map(|keyword| {
+                    (
+                        Field::parse(&keyword.field).unwrap_or_default(),
+                        keyword.word.as_str(),
+                        keyword.frequency,
+                        keyword.positions.as_slice(),
+                    )
+                }),
+                &variant.weights,
+            )?;
 
             // Add the score to the page.
             relevance_scores.insert(page, score);
         }
 
-        let rating_factor = utils::env::ranker::get_rating_factor();
-        let ranker_constant = utils::env::ranker::get_ranker_constant();
-
-        // Calculate the actual page rank.
-        let mut page_ranks = HashMap::new();
-        for page in relevance_scores.keys().copied() {
-            let mut rank = rating_factor;
-            for backlink in &unordered_pages {
-                if let Some(frequency) = backlinks.get(backlink) {
-                    if backlink.page.id == page.page.id {
-                        continue;
-                    }
+        // Without the backlinks, the pages are ranked by their relevance alone.
+        let mut page_ranks = match &backlinks {
+            Some(backlinks) => Self::get_page_ranks(
+                &unordered_pages,
+                &relevance_scores,
+                backlinks,
+                &variant.weights,
+            ),
+            None => relevance_scores.clone(),
+        };
 
-                    // Rank is the sum of the relevance scores of the backlinks divided by the number of backlinks.
-                    rank += (relevance_scores
-                        .get(backlink)
-                        .expect("Failed to get backlink score!")
-                        / frequency) as f64;
+        // Favor the pages users click on for this query, if enabled.
+        if let Some(click_through_rates) = click_through_rates.filter(|_| click_weight > 0.0) {
+            for (page, rank) in &mut page_ranks {
+                if let Some(click_through_rate) = click_through_rates.get(&page.page.url) {
+                    *rank *= click_weight.mul_add(*click_through_rate, 1.0);
                 }
+            }
+        }
 
-                rank *= ranker_constant;
+        // Favor the pages in the languages the client prefers, if any.
+        Self::boost_languages(
+            &mut page_ranks,
+            &preferred_languages,
+            variant.weights.language_weight,
+        );
 
-                // Add the rank to the page.
-                page_ranks.insert(page, rank);
+        // Favor the pages on domains many other domains link to, if enabled.
+        let authority_weight = variant.weights.authority_weight;
+        if authority_weight > 0.0 {
+            for (page, rank) in &mut page_ranks {
+                *rank *= authorities.get_boost(&page.page.url, authority_weight);
+            }
+        }
+
+        // Demote the pages whose content changes between fetches, since others may not see what was indexed.
+        for (page, rank) in &mut page_ranks {
+            if page.page.unstable {
+                *rank *= 1.0 - variant.weights.unstable_penalty;
             }
         }
 
-        // Order the pages by their rank.
+        // Apply what admins curated for the query, leaving out the blocked pages.
+        let curated = curations.get(self.query.as_deref().unwrap_or_default(), SystemTime::now());
+        page_ranks.retain(|page, _| !curated.is_blocked(&page.page.url));
+        for (page, rank) in &mut page_ranks {
+            *rank *= curated.get_factor(&page.page.url);
+        }
+
+        // Order the pages by their rank, or by when they were published if asked for.
+        let sort = self.sort.unwrap_or_default();
         let pages = {
             let mut pages = Vec::new();
             for (page, rank) in page_ranks {
                 pages.push((page, rank));
             }
 
-            pages.sort_by(|(_, rank_a), (_, rank_b)| {
-                rank_b
-                    .partial_cmp(rank_a)
-                    .expect("Failed to compare ranks!")
+            pages.sort_by(|(page_a, rank_a), (page_b, rank_b)| {
+                sort.order(page_a.page.published_at, page_b.page.published_at)
+                    .then_with(|| rank_b.total_cmp(rank_a))
             });
             pages
                 .into_iter()
@@ -146,24 +526,1910 @@ impl Info {
                 .collect::<Vec<_>>()
         };
 
-        Ok(Output {
+        // Put the pinned pages at the top, looking up those that weren't found.
+        let pinned = Self::get_pinned_pages(shards, &curated, &pages, deadline).await;
+        let pages = curated.pin(pages, pinned, |page| page.page.url.as_str());
+
+        // Return the images on the best ranked pages instead, if asked for.
+        if self.kind.unwrap_or_default() == Kind::Image {
+            let images =
+                Self::get_images(&healthy_shards, &pages, &query, dictionary, deadline).await;
+
+            let total = images.len();
+            let (offset, limit) = self.get_page_bounds(is_admin);
+            let images = images
+                .into_iter()
+                .skip(offset)
+                .take(limit)
+                .enumerate()
+                .map(|(index, image)| ImageResult {
+                    click_token: tracker.issue_token(
+                        &query_hash,
+                        &variant.name,
+                        &image.page_url,
+                        get_position(offset, index),
+                    ),
+                    ..image
+                })
+                .collect();
+
+            Self::log_search(&query_hash, variant, total);
+
+            return Ok(Some(Output {
+                query: self.query.clone(),
+                corrected_query: None,
+                error: None,
+                pages: None,
+                images: Some(images),
+                clusters: None,
+                total: Some(total),
+                duplicates: None,
+                partial,
+                degraded: !degraded_stages.is_empty(),
+                degraded_stages,
+                variant: Some(variant.name.clone()),
+            }));
+        }
+
+        // Collapse the pages with the same content into the best ranked of them, if asked for.
+        let (pages, duplicates) = if self.dedup.unwrap_or_default() {
+            let hashes = Self::get_content_hashes(&healthy_shards, &pages, deadline).await;
+            let pages = Self::collapse(pages, &hashes);
+            let duplicates = pages
+                .iter()
+                .map(|(_, duplicates)| duplicates)
+                .sum::<usize>();
+
+            (pages, Some(duplicates))
+        } else {
+            (pages.into_iter().map(|page| (page, 0)).collect(), None)
+        };
+
+        // Only return the requested page of results.
+        let total = pages.len();
+        let (offset, limit) = self.get_page_bounds(is_admin);
+        let snippet_length = utils::env::search::get_snippet_length();
+        let pages = pages
+            .into_iter()
+            .skip(offset)
+            .take(limit)
+            .enumerate()
+            .map(|(index, (page, duplicates))| SearchResult {
+                display_url: get_display_url(&page.page.url),
+                click_token: tracker.issue_token(
+                    &query_hash,
+                    &variant.name,
+                    &page.page.url,
+                    get_position(offset, index),
+                ),
+                cache_url: archive.get_link(&page.page),
+                snippet: page.page.description.as_deref().map(|description| {
+                    Snippet::new(description, &query, snippet_length, dictionary)
+                }),
+                duplicates,
+                page,
+            })
+            .collect::<Vec<_>>();
+
+        // Group the returned results by their topic, if asked for, but not exports which can be of any size.
+        let is_clustered =
+            self.cluster.unwrap_or_default() && !self.format.unwrap_or_default().is_export();
+        let clusters = is_clustered.then(|| {
+            clusters::cluster(
+                &pages
+                    .iter()
+                    .map(|result| result.page.keywords.as_deref().unwrap_or_default())
+                    .collect::<Vec<_>>(),
+                &query.keys().map(String::as_str).collect(),
+            )
+        });
+
+        Self::log_search(&query_hash, variant, total);
+
+        Ok(Some(Output {
             query: self.query.clone(),
-            pages: Some(pages),
+            corrected_query: None,
             error: None,
-        })
+            pages: Some(pages),
+            images: None,
+            clusters,
+            total: Some(total),
+            duplicates,
+            partial,
+            degraded: !degraded_stages.is_empty(),
+            degraded_stages,
+            variant: Some(variant.name.clone()),
+        }))
     }
-}
 
-/// The results of a search.
-///
-/// # Fields
-///
-/// * `query`: The query, if any.
-/// * `errors`: An errors, if any.
-/// * `pages`: The pages that match the query, if any.
-#[derive(Debug, Serialize)]
-pub struct Output {
-    pub query: Option<String>,
-    pub error: Option<Error>,
-    pub pages: Option<Vec<CompletePage>>,
+    /// Searches for the URLs of pages, without assembling the pages themselves.
+    ///
+    /// # Arguments
+    ///
+    /// * `dictionary`: The stop words and protected words, the same as the crawler uses.
+    /// * `shards`: The database shards to search.
+    /// * `curations`: The curations of the results of queries.
+    /// * `authorities`: The authority of the domains of the results.
+    /// * `variant`: The ranking variant to rank the pages with.
+    /// * `is_admin`: Whether the search was made by an admin.
+    /// * `accept_language`: The `Accept-Language` header of the request, used if `accept_lang` isn't given.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Vec<String>)` - The requested page of URLs, best ranked first.
+    /// * `Err(Error)` - If the URLs could not be found.
+    ///
+    /// # Errors
+    ///
+    /// * If no query is provided.
+    /// * If the language or a date is invalid.
+    /// * If every shard that failed is unavailable, or too slow, and no URLs were found on the others.
+    ///
+    /// # Notes
+    ///
+    /// * Only the keywords matching the query are loaded, and the backlinks and click-through rates aren't looked up.
+    /// * The pages are ranked like a degraded search, by their relevance, language, domain authority and stability alone.
+    /// * Pinned URLs are put at the top without checking that they're indexed.
+    pub async fn search_urls(
+        &self,
+        dictionary: &Dictionary,
+        shards: &[Shard],
+        curations: &Curations,
+        authorities: &Authorities,
+        variant: &Variant,
+        is_admin: bool,
+        accept_language: Option<&str>,
+    ) -> Result<Vec<String>, Error> {
+        let mut rankings = self
+            .search_urls_with(
+                dictionary,
+                shards,
+                curations,
+                authorities,
+                &[variant],
+                is_admin,
+                accept_language,
+            )
+            .await?;
+
+        Ok(rankings.pop().unwrap_or_default())
+    }
+
+    /// Searches for the URLs of pages, ranking the same candidates with each of several variants.
+    ///
+    /// # Arguments
+    ///
+    /// * `dictionary`: The stop words and protected words, the same as the crawler uses.
+    /// * `shards`: The database shards to search.
+    /// * `curations`: The curations of the results of queries.
+    /// * `authorities`: The authority of the domains of the results.
+    /// * `variants`: The ranking variants to rank the pages with.
+    /// * `is_admin`: Whether the search was made by an admin.
+    /// * `accept_language`: The `Accept-Language` header of the request, used if `accept_lang` isn't given.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Vec<Vec<String>>)` - The requested page of URLs of each variant, in the order of the variants.
+    /// * `Err(Error)` - If the URLs could not be found.
+    ///
+    /// # Errors
+    ///
+    /// * If no query is provided.
+    /// * If the language or a date is invalid.
+    /// * If every shard that failed is unavailable, or too slow, and no URLs were found on the others.
+    ///
+    /// # Notes
+    ///
+    /// * The keywords are only loaded once, so the variants can't differ in the candidates they're given.
+    pub async fn search_urls_with(
+        &self,
+        dictionary: &Dictionary,
+        shards: &[Shard],
+        curations: &Curations,
+        authorities: &Authorities,
+        variants: &[&Variant],
+        is_admin: bool,
+        accept_language: Option<&str>,
+    ) -> Result<Vec<Vec<String>>, Error> {
+        let query = self.get_query(dictionary)?;
+        let fields = self.get_fields(dictionary);
+        let boosts = self.get_boosts(
+            &query,
+            dictionary,
+            utils::env::ranker::get_maximum_term_boost(),
+        );
+
+        let required_language = self.get_required_language()?;
+        let preferred_languages = self.get_preferred_languages(accept_language);
+        let published_range = self.get_published_range()?;
+
+        let deadline = Instant::now() + utils::env::search::get_search_timeout();
+        let words = query
+            .keys()
+            .map(std::string::ToString::to_string)
+            .collect::<Vec<_>>();
+        let results =
+            join_all(shards.iter().map(|shard| {
+                with_deadline(deadline, Self::get_word_matches(shard, words.clone()))
+            }))
+            .await;
+
+        let mut failed = false;
+        let mut unavailable = false;
+        let mut matches = Vec::new();
+        for (index, result) in results.into_iter().enumerate() {
+            match result {
+                Ok(shard_matches) => matches.extend(shard_matches),
+                Err(err) => {
+                    warn!("Failed to search shard #{index}, returning partial URLs! Error: {err}");
+
+                    failed = true;
+                    unavailable |= err.is_transient();
+                }
+            }
+        }
+
+        if matches.is_empty() && failed {
+            if unavailable {
+                return Err(Error::Unavailable("The database is unavailable!".into()));
+            }
+
+            return Err(Error::Database("Failed to search the database!".into()));
+        }
+
+        matches
+            .retain(|word_match| Self::is_published_in(word_match.published_at, published_range));
+
+        let curated = curations.get(self.query.as_deref().unwrap_or_default(), SystemTime::now());
+        let (offset, limit) = self.get_page_bounds(is_admin);
+
+        variants
+            .iter()
+            .map(|variant| {
+                let urls = Self::rank_urls(
+                    matches.clone(),
+                    &query,
+                    &boosts,
+                    &fields,
+                    required_language.as_deref(),
+                    &preferred_languages,
+                    &variant.weights,
+                    self.sort.unwrap_or_default(),
+                    &curated,
+                    authorities,
+                )?;
+                let pinned = curated
+                    .pins()
+                    .iter()
+                    .map(|url| (url.clone(), url.clone()))
+                    .collect();
+                let urls = curated.pin(urls, pinned, String::as_str);
+
+                Ok(urls.into_iter().skip(offset).take(limit).collect())
+            })
+            .collect()
+    }
+
+    /// Ranks the URLs of the pages with keywords matching a query.
+    ///
+    /// # Arguments
+    ///
+    /// * `matches`: The keywords matching the query, along with the URL and language of their pages.
+    /// * `query`: The stemmed words of the query, and how often they occur in it.
+    /// * `boosts`: The boost factor of each stemmed term.
+    /// * `fields`: The only field each qualified stemmed term may match.
+    /// * `required_language`: The only language to return pages in, if any.
+    /// * `preferences`: The preferred languages, most preferred first.
+    /// * `weights`: The weights to rank the pages with.
+    /// * `sort`: The order to return the URLs in.
+    /// * `curated`: The curations of the query, leaving out or boosting pages.
+    /// * `authorities`: The authority of the domains of the pages.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Vec<String>)` - The URLs, best ranked first unless sorted by date.
+    /// * `Err(Error)` - If a keyword has a negative frequency.
+    ///
+    /// # Errors
+    ///
+    /// * If a keyword has a negative frequency.
+    #[allow(clippy::too_many_arguments)]
+    fn rank_urls(
+        matches: Vec<WordMatch>,
+        query: &HashMap<String, usize>,
+        boosts: &HashMap<String, f64>,
+        fields: &HashMap<String, Field>,
+        required_language: Option<&str>,
+        preferences: &[String],
+        weights: &Weights,
+        sort: Sort,
+        curated: &Curated,
+        authorities: &Authorities,
+    ) -> Result<Vec<String>, Error> {
+        let mut pages = HashMap::<String, (Option<String>, Vec<WordMatch>)>::new();
+        for word_match in matches {
+            if required_language
+                .is_some_and(|language| word_match.language.as_deref() != Some(language))
+                || curated.is_blocked(&word_match.url)
+            {
+                continue;
+            }
+
+            pages
+                .entry(word_match.url.clone())
+                .or_insert_with(|| (word_match.language.clone(), Vec::new()))
+                .1
+                .push(word_match);
+        }
+
+        let mut ranks = Vec::new();
+        for (url, (page_language, keywords)) in pages {
+            let published_at = keywords.first().and_then(|keyword| keyword.published_at);
+            let mut rank = Self::get_relevance(
+                query,
+                boosts,
+                fields,
+                keywords.iter().map(|keyword| {
+                    (
+                        Field::parse(&keyword.field).unwrap_or_default(),
+                        keyword.word.as_str(),
+                        keyword.frequency,
+                        keyword.positions.as_slice(),
+                    )
+                }),
+                weights,
+            )?;
+
+            // Favor the pages in the languages the client prefers, if any.
+            if weights.language_weight > 0.0 {
+                rank *= language::get_boost(
+                    preferences,
+                    page_language.as_deref(),
+                    weights.language_weight,
+                );
+            }
+
+            rank *= authorities.get_boost(&url, weights.authority_weight);
+            if keywords.iter().any(|keyword| keyword.unstable) {
+                rank *= 1.0 - weights.unstable_penalty;
+            }
+            rank *= curated.get_factor(&url);
+            ranks.push((url, published_at, rank));
+        }
+
+        // Pages of the same rank are ordered by their URL, so the pages of results don't overlap.
+        ranks.sort_by(
+            |(url_a, published_at_a, rank_a), (url_b, published_at_b, rank_b)| {
+                sort.order(*published_at_a, *published_at_b)
+                    .then_with(|| rank_b.total_cmp(rank_a))
+                    .then_with(|| url_a.cmp(url_b))
+            },
+        );
+
+        Ok(ranks.into_iter().map(|(url, _, _)| url).collect())
+    }
+
+    /// Scores how relevant a page is to a query.
+    ///
+    /// # Arguments
+    ///
+    /// * `query`: The stemmed words of the query, and how often they occur in it.
+    /// * `boosts`: The boost factor of each stemmed term.
+    /// * `fields`: The only field each qualified stemmed term may match.
+    /// * `keywords`: The field, word, frequency and positions of the keywords on the page.
+    /// * `weights`: The weights of the proximity of the query terms and of each field.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(f64)` - The relevance score of the page.
+    /// * `Err(Error)` - If a keyword has a negative frequency.
+    ///
+    /// # Errors
+    ///
+    /// * If a keyword has a negative frequency.
+    ///
+    /// # Notes
+    ///
+    /// * Each field is scored on its own, and the scores are added up by the weight of their field.
+    #[allow(clippy::cast_precision_loss)]
+    fn get_relevance<'a, I>(
+        query: &HashMap<String, usize>,
+        boosts: &HashMap<String, f64>,
+        fields: &HashMap<String, Field>,
+        keywords: I,
+        weights: &Weights,
+    ) -> Result<f64, Error>
+    where
+        I: IntoIterator<Item = (Field, &'a str, i32, &'a [i32])>,
+    {
+        // For each keyword, add the frequency of the keyword times the frequency of the word in the query.
+        let mut scores = HashMap::<Field, (f64, Vec<&[i32]>)>::new();
+        for (field, word, frequency, word_positions) in keywords {
+            let Some(query_frequency) = query.get(word) else {
+                continue;
+            };
+
+            if fields.get(word).is_some_and(|&only| only != field) {
+                continue;
+            }
+
+            let boost = boosts.get(word).copied().unwrap_or(1.0);
+            let (score, positions) = scores.entry(field).or_default();
+
+            *score += (query_frequency * usize::try_from(frequency)?) as f64 * boost;
+            positions.push(word_positions);
+        }
+
+        // Favor the fields where the query terms are close together, if every one of them is in the field.
+        Ok(scores
+            .into_iter()
+            .map(|(field, (mut score, positions))| {
+                if positions.len() == query.len() {
+                    score *= weights
+                        .proximity_weight
+                        .mul_add(proximity::get_proximity(&positions), 1.0);
+                }
+
+                score * weights.get_field_weight(field)
+            })
+            .sum())
+    }
+
+    /// Gets the stemmed words of the query.
+    ///
+    /// # Arguments
+    ///
+    /// * `dictionary`: The stop words and protected words.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(HashMap<String, usize>)` - The stemmed words, and how often they occur in the query.
+    /// * `Err(Error)` - If no query is provided.
+    ///
+    /// # Errors
+    ///
+    /// * If the query is missing or empty.
+    fn get_query(&self, dictionary: &Dictionary) -> Result<HashMap<String, usize>, Error> {
+        match &self.query {
+            Some(query) if !query.is_empty() => Ok(utils::words::extract(
+                &split_fields(query)
+                    .into_iter()
+                    .map(|(_, term)| term)
+                    .collect::<Vec<_>>()
+                    .join(" "),
+                rust_stemmers::Algorithm::English,
+                dictionary,
+            )),
+            _ => Err(Error::Query("No query provided!".into())),
+        }
+    }
+
+    /// Gets the fields the qualified terms of the query are restricted to.
+    ///
+    /// # Arguments
+    ///
+    /// * `dictionary`: The stop words and protected words.
+    ///
+    /// # Returns
+    ///
+    /// * `HashMap<String, Field>` - The stemmed words of the qualified terms, like `title:rust`, and the only field they may match.
+    fn get_fields(&self, dictionary: &Dictionary) -> HashMap<String, Field> {
+        let mut fields = HashMap::new();
+        for (field, term) in split_fields(self.query.as_deref().unwrap_or_default()) {
+            let Some(field) = field else {
+                continue;
+            };
+
+            for word in utils::words::extract(term, rust_stemmers::Algorithm::English, dictionary)
+                .into_keys()
+            {
+                fields.insert(word, field);
+            }
+        }
+
+        fields
+    }
+
+    /// Gets the only language to return pages in.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Option<String>)` - The normalized language, if any.
+    /// * `Err(Error)` - If the language is invalid.
+    ///
+    /// # Errors
+    ///
+    /// * If `lang` isn't a valid language tag.
+    fn get_required_language(&self) -> Result<Option<String>, Error> {
+        self.lang
+            .as_deref()
+            .map(|lang| {
+                utils::language::normalize(lang)
+                    .ok_or_else(|| Error::Query(format!("Invalid language \"{lang}\"!")))
+            })
+            .transpose()
+    }
+
+    /// Gets the range of dates the pages must be published in.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok((Option<SystemTime>, Option<SystemTime>))` - The earliest date the pages may be published on, and the date they must be published before, if any.
+    /// * `Err(Error)` - If a date is invalid.
+    ///
+    /// # Errors
+    ///
+    /// * If `after` or `before` isn't a date.
+    fn get_published_range(&self) -> Result<(Option<SystemTime>, Option<SystemTime>), Error> {
+        let parse = |date: &Option<String>| {
+            date.as_deref()
+                .map(|date| {
+                    utils::dates::parse(date)
+                        .ok_or_else(|| Error::Query(format!("Invalid date \"{date}\"!")))
+                })
+                .transpose()
+        };
+
+        Ok((parse(&self.after)?, parse(&self.before)?))
+    }
+
+    /// Gets the languages the client prefers.
+    ///
+    /// # Arguments
+    ///
+    /// * `accept_language`: The `Accept-Language` header of the request, used if `accept_lang` isn't given.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<String>` - The preferred languages, most preferred first.
+    fn get_preferred_languages(&self, accept_language: Option<&str>) -> Vec<String> {
+        self.accept_lang
+            .as_deref()
+            .or(accept_language)
+            .map(language::parse_preferences)
+            .unwrap_or_default()
+    }
+
+    /// Checks if a page is in the language results are limited to.
+    ///
+    /// # Arguments
+    ///
+    /// * `page`: The page.
+    /// * `language`: The only language to return pages in, if any.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the page is in the language, always `true` without one.
+    fn is_in_language(page: &CompletePage, language: Option<&str>) -> bool {
+        language.map_or(true, |language| {
+            page.page.language.as_deref() == Some(language)
+        })
+    }
+
+    /// Checks if a page was published in the range results are limited to.
+    ///
+    /// # Arguments
+    ///
+    /// * `published_at`: When the page was published, if known.
+    /// * `range`: The earliest date the page may be published on, and the date it must be published before, if any.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether the page was published in the range, always `true` without one.
+    ///
+    /// # Notes
+    ///
+    /// * Pages without a publish date are left out if there is a range.
+    fn is_published_in(
+        published_at: Option<SystemTime>,
+        (after, before): (Option<SystemTime>, Option<SystemTime>),
+    ) -> bool {
+        if after.is_none() && before.is_none() {
+            return true;
+        }
+
+        published_at.is_some_and(|published_at| {
+            after.map_or(true, |after| published_at >= after)
+                && before.map_or(true, |before| published_at < before)
+        })
+    }
+
+    /// Favors the pages in the languages the client prefers, without leaving out the others.
+    ///
+    /// # Arguments
+    ///
+    /// * `page_ranks`: The rank of each page.
+    /// * `preferences`: The preferred languages, most preferred first.
+    /// * `weight`: The boost of the most preferred language.
+    fn boost_languages<S>(
+        page_ranks: &mut HashMap<&CompletePage, f64, S>,
+        preferences: &[String],
+        weight: f64,
+    ) where
+        S: std::hash::BuildHasher,
+    {
+        if preferences.is_empty() || weight <= 0.0 {
+            return;
+        }
+
+        for (page, rank) in page_ranks.iter_mut() {
+            *rank *= language::get_boost(preferences, page.page.language.as_deref(), weight);
+        }
+    }
+
+    /// Calculates the rank of each page from its relevance, and the relevance of its backlinks.
+    ///
+    /// # Arguments
+    ///
+    /// * `unordered_pages`: The pages matching the query.
+    /// * `relevance_scores`: The relevance score of each page.
+    /// * `backlinks`: How many of the pages each backlink links to.
+    /// * `weights`: The weights to rank the pages with.
+    ///
+    /// # Returns
+    ///
+    /// * `HashMap<&CompletePage, f64>` - The rank of each page.
+    #[allow(clippy::expect_used)]
+    fn get_page_ranks<'a, S, T>(
+        unordered_pages: &'a [CompletePage],
+        relevance_scores: &HashMap<&'a CompletePage, f64, S>,
+        backlinks: &HashMap<CompletePage, u32, T>,
+        weights: &Weights,
+    ) -> HashMap<&'a CompletePage, f64>
+    where
+        S: std::hash::BuildHasher,
+        T: std::hash::BuildHasher,
+    {
+        let mut page_ranks = HashMap::new();
+        for page in relevance_scores.keys().copied() {
+            let mut rank = weights.rating_factor;
+            for backlink in unordered_pages {
+                if let Some(frequency) = backlinks.get(backlink) {
+                    if backlink.page.url == page.page.url {
+                        continue;
+                    }
+
+                    // Rank is the sum of the relevance scores of the backlinks divided by the number of backlinks.
+                    rank += relevance_scores
+                        .get(backlink)
+                        .expect("Failed to get backlink score!")
+                        / f64::from(*frequency);
+                }
+
+                rank *= weights.ranker_constant;
+
+                // Add the rank to the page.
+                page_ranks.insert(page, rank);
+            }
+        }
+
+        page_ranks
+    }
+
+    /// Logs a search in the background, so the client doesn't wait for it.
+    ///
+    /// # Arguments
+    ///
+    /// * `query_hash`: The hash of the query.
+    /// * `variant`: The ranking variant the pages were ranked with.
+    /// * `results`: The number of pages found.
+    fn log_search(query_hash: &str, variant: &Variant, results: usize) {
+        let new_search = NewSearch {
+            query_hash: query_hash.to_string(),
+            variant: variant.name.clone(),
+            results: i32::try_from(results).unwrap_or(i32::MAX),
+        };
+
+        actix_web::rt::spawn(async move {
+            if let Err(err) = database::create_search(&new_search).await {
+                warn!("Failed to log search! Error: {err}");
+            }
+        });
+    }
+
+    /// Looks up the backlinks and click-through rates used to rank the pages, giving up on each of them at the deadline.
+    ///
+    /// # Arguments
+    ///
+    /// * `backlinks`: Looks up how many of the pages each backlink links to.
+    /// * `click_through_rates`: Looks up the click-through rate of each page for the query.
+    /// * `deadline`: When to give up on the lookups.
+    ///
+    /// # Returns
+    ///
+    /// * `(Option<HashMap<CompletePage, u32>>, Option<HashMap<String, f64>>, Vec<Stage>)` - The backlinks and click-through rates, if they were found in time, and the stages that weren't.
+    async fn get_ranking_data<B, C>(
+        backlinks: B,
+        click_through_rates: C,
+        deadline: Instant,
+    ) -> (
+        Option<HashMap<CompletePage, u32>>,
+        Option<HashMap<String, f64>>,
+        Vec<Stage>,
+    )
+    where
+        B: Future<Output = Result<HashMap<CompletePage, u32>, Error>>,
+        C: Future<Output = Result<HashMap<String, f64>, Error>>,
+    {
+        let (backlinks, click_through_rates) = futures::join!(
+            with_deadline(deadline, backlinks),
+            with_deadline(deadline, click_through_rates)
+        );
+
+        let mut degraded_stages = Vec::new();
+        let backlinks = backlinks
+            .map_err(|err| {
+                warn!("Failed to get backlinks, ranking by relevance alone! Error: {err}");
+
+                degraded_stages.push(Stage::Backlinks);
+            })
+            .ok();
+        let click_through_rates = click_through_rates
+            .map_err(|err| {
+                warn!("Failed to get click-through rates, ranking without them! Error: {err}");
+
+                degraded_stages.push(Stage::Clicks);
+            })
+            .ok();
+
+        (backlinks, click_through_rates, degraded_stages)
+    }
+
+    /// Gets the pages matching the words of a query from a single shard, retrying while it's unavailable.
+    ///
+    /// # Arguments
+    ///
+    /// * `shard`: The shard to search.
+    /// * `words`: The stemmed words of the query.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Vec<CompletePage>)` - The pages, with their keywords.
+    /// * `Err(Error)` - If the shard could not be searched.
+    ///
+    /// # Errors
+    ///
+    /// * If the circuit breaker of the shard is open.
+    /// * If the shard could not be searched, even after retrying.
+    async fn get_candidates(shard: &Shard, words: Vec<String>) -> Result<Vec<CompletePage>, Error> {
+        retry::with_retry(
+            &shard.breaker,
+            utils::env::database::get_retries(),
+            utils::env::database::get_retry_backoff(),
+            || shard.store.get_pages_with_keywords(&words),
+        )
+        .await
+    }
+
+    /// Gets the keywords matching the words of a query from a single shard, retrying while it's unavailable.
+    ///
+    /// # Arguments
+    ///
+    /// * `shard`: The shard to search.
+    /// * `words`: The stemmed words of the query.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Vec<WordMatch>)` - The matching keywords, along with the URL and language of their pages.
+    /// * `Err(Error)` - If the shard could not be searched.
+    ///
+    /// # Errors
+    ///
+    /// * If the circuit breaker of the shard is open.
+    /// * If the shard could not be searched, even after retrying.
+    ///
+    /// # Notes
+    ///
+    /// * The keywords of the most searched words are served from the posting cache of the shard, only the rest are looked up.
+    async fn get_word_matches(shard: &Shard, words: Vec<String>) -> Result<Vec<WordMatch>, Error> {
+        let (mut matches, missing) = shard.postings.get(&words);
+        if missing.is_empty() {
+            return Ok(matches);
+        }
+
+        let missing_matches = retry::with_retry(
+            &shard.breaker,
+            utils::env::database::get_retries(),
+            utils::env::database::get_retry_backoff(),
+            || shard.store.get_word_matches(&missing),
+        )
+        .await?;
+        shard.postings.insert(&missing, &missing_matches);
+        matches.extend(missing_matches);
+
+        Ok(matches)
+    }
+
+    /// Looks up the pinned pages that weren't found, on every shard at once.
+    ///
+    /// # Arguments
+    ///
+    /// * `shards`: The database shards to look the pages up on.
+    /// * `curated`: The curations of the query.
+    /// * `pages`: The pages that were found.
+    /// * `deadline`: When to give up on the lookups.
+    ///
+    /// # Returns
+    ///
+    /// * `HashMap<String, CompletePage>` - The pinned pages found in time, by their URL, without their keywords.
+    ///
+    /// # Notes
+    ///
+    /// * Pinned pages that aren't indexed, or are excluded from search results, are skipped.
+    async fn get_pinned_pages(
+        shards: &[Shard],
+        curated: &Curated,
+        pages: &[CompletePage],
+        deadline: Instant,
+    ) -> HashMap<String, CompletePage> {
+        let found = pages
+            .iter()
+            .map(|page| page.page.url.as_str())
+            .collect::<HashSet<_>>();
+        let missing = curated
+            .pins()
+            .iter()
+            .filter(|url| !found.contains(url.as_str()))
+            .filter_map(|url| Url::parse(url).ok())
+            .collect::<Vec<_>>();
+        if missing.is_empty() {
+            return HashMap::new();
+        }
+
+        let results = join_all(shards.iter().map(|shard| {
+            with_deadline(
+                deadline,
+                retry::with_retry(
+                    &shard.breaker,
+                    utils::env::database::get_retries(),
+                    utils::env::database::get_retry_backoff(),
+                    || shard.store.get_pages_by_urls(&missing),
+                ),
+            )
+        }))
+        .await;
+
+        let mut pinned = HashMap::new();
+        for (index, result) in results.into_iter().enumerate() {
+            match result {
+                Ok(pages) => {
+                    for page in pages.into_iter().filter(|page| !page.excluded) {
+                        pinned.insert(
+                            page.url.clone(),
+                            CompletePage {
+                                page,
+                                keywords: None,
+                            },
+                        );
+                    }
+                }
+                Err(err) => {
+                    warn!("Failed to look up the pinned pages on shard #{index}! Error: {err}");
+                }
+            }
+        }
+
+        pinned
+    }
+
+    /// Looks up the images on the best ranked pages whose alt text or caption matches the query, on every shard at once.
+    ///
+    /// # Arguments
+    ///
+    /// * `shards`: The database shards to look the images up on.
+    /// * `pages`: The pages that were found, best ranked first.
+    /// * `query`: The stemmed words of the query.
+    /// * `dictionary`: The stop words and protected words.
+    /// * `deadline`: When to give up on the lookups.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<ImageResult>` - The matching images found in time, in the order of their pages, and then of the pages themselves.
+    ///
+    /// # Notes
+    ///
+    /// * Only the images of the first `IMAGE_PAGES` pages are searched, so the best pages aren't crowded out by galleries.
+    async fn get_images(
+        shards: &[&Shard],
+        pages: &[CompletePage],
+        query: &HashMap<String, usize>,
+        dictionary: &Dictionary,
+        deadline: Instant,
+    ) -> Vec<ImageResult> {
+        let urls = pages
+            .iter()
+            .take(IMAGE_PAGES)
+            .map(|page| page.page.url.clone())
+            .collect::<Vec<_>>();
+
+        let results = join_all(shards.iter().map(|shard| {
+            with_deadline(
+                deadline,
+                retry::with_retry(
+                    &shard.breaker,
+                    utils::env::database::get_retries(),
+                    utils::env::database::get_retry_backoff(),
+                    || shard.store.get_images(&urls),
+                ),
+            )
+        }))
+        .await;
+
+        let mut images = HashMap::<String, Vec<Image>>::new();
+        for (index, result) in results.into_iter().enumerate() {
+            match result {
+                Ok(found) => {
+                    for (url, image) in found {
+                        images.entry(url).or_default().push(image);
+                    }
+                }
+                Err(err) => {
+                    warn!("Failed to look up the images on shard #{index}! Error: {err}");
+                }
+            }
+        }
+
+        let mut results = Vec::new();
+        for url in urls {
+            let Some(mut page_images) = images.remove(&url) else {
+                continue;
+            };
+            page_images.sort_by_key(|image| image.position);
+
+            for image in page_images {
+                let text = [image.alt.as_deref(), image.caption.as_deref()]
+                    .into_iter()
+                    .flatten()
+                    .collect::<Vec<_>>()
+                    .join(" ");
+                let words =
+                    utils::words::extract(&text, rust_stemmers::Algorithm::English, dictionary);
+                if !query.keys().any(|word| words.contains_key(word)) {
+                    continue;
+                }
+
+                results.push(ImageResult {
+                    url: image.url,
+                    alt: image.alt,
+                    caption: image.caption,
+                    display_url: get_display_url(&url),
+                    page_url: url.clone(),
+                    // Issued once the position of the image on the page of results is known.
+                    click_token: String::new(),
+                });
+            }
+        }
+
+        results
+    }
+
+    /// Gets the hash of the latest content of the best ranked pages.
+    ///
+    /// # Arguments
+    ///
+    /// * `shards`: The healthy database shards, each asked for the hashes of the pages stored on it.
+    /// * `pages`: The pages, best ranked first.
+    /// * `deadline`: The time to give up on the shards that haven't answered by.
+    ///
+    /// # Returns
+    ///
+    /// * `HashMap<String, String>` - The hash of each page that has one, by its URL.
+    ///
+    /// # Notes
+    ///
+    /// * Only the `DEDUP_PAGES` best ranked pages are looked up.
+    /// * Shards that fail, or are too slow, are skipped, so their pages aren't collapsed.
+    async fn get_content_hashes(
+        shards: &[&Shard],
+        pages: &[CompletePage],
+        deadline: Instant,
+    ) -> HashMap<String, String> {
+        let urls = pages
+            .iter()
+            .take(DEDUP_PAGES)
+            .map(|page| page.page.url.clone())
+            .collect::<Vec<_>>();
+
+        let results = join_all(shards.iter().map(|shard| {
+            with_deadline(
+                deadline,
+                retry::with_retry(
+                    &shard.breaker,
+                    utils::env::database::get_retries(),
+                    utils::env::database::get_retry_backoff(),
+                    || shard.store.get_content_hashes(&urls),
+                ),
+            )
+        }))
+        .await;
+
+        let mut hashes = HashMap::new();
+        for (index, result) in results.into_iter().enumerate() {
+            match result {
+                Ok(found) => hashes.extend(found),
+                Err(err) => {
+                    warn!("Failed to look up the content hashes on shard #{index}! Error: {err}");
+                }
+            }
+        }
+
+        hashes
+    }
+
+    /// Collapses the pages with the same content into the best ranked of them.
+    ///
+    /// # Arguments
+    ///
+    /// * `pages`: The pages, best ranked first.
+    /// * `hashes`: The hash of the content of each page, by its URL.
+    ///
+    /// # Returns
+    ///
+    /// * `Vec<(CompletePage, usize)>` - The pages left, still best ranked first, and how many pages were collapsed into each.
+    ///
+    /// # Notes
+    ///
+    /// * Pages without a hash are always kept.
+    fn collapse(
+        pages: Vec<CompletePage>,
+        hashes: &HashMap<String, String>,
+    ) -> Vec<(CompletePage, usize)> {
+        let mut places = HashMap::<&str, usize>::new();
+        let mut collapsed: Vec<(CompletePage, usize)> = Vec::with_capacity(pages.len());
+        for page in pages {
+            let Some(hash) = hashes.get(&page.page.url) else {
+                collapsed.push((page, 0));
+
+                continue;
+            };
+
+            if let Some(&place) = places.get(hash.as_str()) {
+                collapsed[place].1 += 1;
+
+                continue;
+            }
+
+            places.insert(hash, collapsed.len());
+            collapsed.push((page, 0));
+        }
+
+        collapsed
+    }
+
+    /// Gets how many of the pages each backlink on a single shard links to, retrying while it's unavailable.
+    ///
+    /// # Arguments
+    ///
+    /// * `shard`: The shard to look the backlinks up on.
+    /// * `pages`: The pages.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(HashMap<CompletePage, u32>)` - How many of the pages each backlink links to.
+    /// * `Err(Error)` - If the backlinks could not be retrieved.
+    ///
+    /// # Errors
+    ///
+    /// * If the circuit breaker of the shard is open.
+    /// * If the backlinks could not be retrieved, even after retrying.
+    async fn get_backlinks(
+        shard: &Shard,
+        pages: &[CompletePage],
+    ) -> Result<HashMap<CompletePage, u32>, Error> {
+        retry::with_retry(
+            &shard.breaker,
+            utils::env::database::get_retries(),
+            utils::env::database::get_retry_backoff(),
+            || shard.store.get_backlinks(pages),
+        )
+        .await
+    }
+
+    /// Gets the offset and number of the results to return.
+    ///
+    /// # Arguments
+    ///
+    /// * `is_admin`: Whether the search was made by an admin.
+    ///
+    /// # Returns
+    ///
+    /// * `(usize, usize)` - The number of results to skip, and the number of results to return.
+    ///
+    /// # Notes
+    ///
+    /// * Pages start at `1`, and the page size is capped at the maximum results per page.
+    /// * Exports return up to the maximum export rows at once, and admins can export as many as they like.
+    fn get_page_bounds(&self, is_admin: bool) -> (usize, usize) {
+        let limit = if self.format.unwrap_or_default().is_export() {
+            let maximum_export_rows = utils::env::search::get_maximum_export_rows();
+
+            self.limit.unwrap_or(maximum_export_rows).min(if is_admin {
+                usize::MAX
+            } else {
+                maximum_export_rows
+            })
+        } else {
+            self.limit
+                .unwrap_or_else(utils::env::search::get_results_per_page)
+                .min(utils::env::search::get_maximum_results_per_page())
+        }
+        .max(1);
+        let page = self.page.unwrap_or(1).max(1);
+
+        ((page - 1).saturating_mul(limit), limit)
+    }
+
+    /// Gets the term boosts of the query.
+    ///
+    /// # Arguments
+    ///
+    /// * `query`: The stemmed words of the query.
+    /// * `dictionary`: The stop words and protected words.
+    /// * `maximum_boost`: The maximum factor a term can be boosted by.
+    ///
+    /// # Returns
+    ///
+    /// * `HashMap<String, f64>` - The boost factor of each stemmed term.
+    ///
+    /// # Notes
+    ///
+    /// * Boosted terms are stemmed the same way as the query, so they match the index.
+    /// * Boosts for terms that aren't in the query are ignored.
+    /// * Factors must be positive, and are capped at the maximum term boost.
+    /// * A term boosted more than once keeps its last factor, so repeating it never stacks past the cap.
+    fn get_boosts(
+        &self,
+        query: &HashMap<String, usize>,
+        dictionary: &Dictionary,
+        maximum_boost: f64,
+    ) -> HashMap<String, f64> {
+        let mut boosts = HashMap::new();
+        let Some(boost) = &self.boost else {
+            return boosts;
+        };
+
+        for pair in boost.split(',') {
+            let Some((term, factor)) = pair.rsplit_once(':') else {
+                warn!("Ignoring malformed boost \"{pair}\", expected \"term:factor\"!");
+
+                continue;
+            };
+
+            let factor = match factor.trim().parse::<f64>() {
+                Ok(factor) if factor.is_finite() && factor > 0.0 => factor.min(maximum_boost),
+                _ => {
+                    warn!("Ignoring boost \"{pair}\", the factor must be a positive number!");
+
+                    continue;
+                }
+            };
+
+            for word in utils::words::extract(term, rust_stemmers::Algorithm::English, dictionary)
+                .into_keys()
+            {
+                if query.contains_key(&word) {
+                    boosts.insert(word, factor);
+                }
+            }
+        }
+
+        boosts
+    }
+}
+
+/// A page that matches a query.
+///
+/// # Fields
+///
+/// * `page`: The page.
+/// * `display_url`: The URL of the page to show, with its host in Unicode.
+/// * `snippet`: The snippet of the page's description, if it has one.
+/// * `cache_url`: The signed link to the cached copy of the page, unless it may not be shown from the cache.
+/// * `duplicates`: The number of pages with the same content collapsed into this one, with `dedup=true`.
+/// * `click_token`: The token to record clicks on the page with, at its position.
+#[derive(Debug, Serialize)]
+pub struct SearchResult {
+    #[serde(flatten)]
+    pub page: CompletePage,
+    pub display_url: String,
+    pub snippet: Option<Snippet>,
+    pub cache_url: Option<String>,
+    pub duplicates: usize,
+    pub click_token: String,
+}
+
+/// An image on a page that matches a query.
+///
+/// # Fields
+///
+/// * `url`: The URL of the image.
+/// * `alt`: The alt text of the image, if any.
+/// * `caption`: The caption of the image, if any.
+/// * `page_url`: The URL of the page the image is on.
+/// * `display_url`: The URL of the page to show, with its host in Unicode.
+/// * `click_token`: The token to record clicks on the page of the image with, at its position.
+#[derive(Debug, Serialize)]
+pub struct ImageResult {
+    pub url: String,
+    pub alt: Option<String>,
+    pub caption: Option<String>,
+    pub page_url: String,
+    pub display_url: String,
+    pub click_token: String,
+}
+
+/// Splits a query into its terms, and the fields they're qualified with.
+///
+/// # Arguments
+///
+/// * `query`: The query string.
+///
+/// # Returns
+///
+/// * `Vec<(Option<Field>, &str)>` - Each term without its qualifier, and the field it's restricted to, if any.
+///
+/// # Notes
+///
+/// * Only `title:` and `body:` are qualifiers, any other prefix is kept as part of the term.
+#[must_use]
+pub fn split_fields(query: &str) -> Vec<(Option<Field>, &str)> {
+    query
+        .split_whitespace()
+        .map(|term| {
+            term.split_once(':')
+                .and_then(|(field, term)| Some((Some(Field::parse(field)?), term)))
+                .unwrap_or((None, term))
+        })
+        .collect()
+}
+
+/// Gets the human-readable form of a stored URL.
+///
+/// # Arguments
+///
+/// * `url`: The stored URL.
+///
+/// # Returns
+///
+/// * `String` - The URL with its host in Unicode, or as it's stored if it can't be parsed.
+#[must_use]
+pub fn get_display_url(url: &str) -> String {
+    Url::parse(url).map_or_else(
+        |_| url.to_string(),
+        |url| utils::urls::get_display_url(&url),
+    )
+}
+
+/// Gets the 1-based position a result is shown at.
+///
+/// # Arguments
+///
+/// * `offset`: The number of results on the earlier pages of results.
+/// * `index`: The index of the result on its page of results.
+///
+/// # Returns
+///
+/// * `u32` - The position of the result across all pages of results.
+fn get_position(offset: usize, index: usize) -> u32 {
+    u32::try_from(offset + index + 1).unwrap_or(u32::MAX)
+}
+
+/// Runs a database operation, failing it if it isn't done by a deadline.
+///
+/// # Arguments
+///
+/// * `deadline`: When to give up on the operation.
+/// * `operation`: The operation.
+///
+/// # Returns
+///
+/// * `Ok(T)` - The result of the operation if successful.
+/// * `Err(Error)` - If the operation failed, or wasn't done in time.
+///
+/// # Errors
+///
+/// * If the operation failed.
+/// * If the operation wasn't done by the deadline.
+async fn with_deadline<T, F>(deadline: Instant, operation: F) -> Result<T, Error>
+where
+    F: Future<Output = Result<T, Error>>,
+{
+    actix_web::rt::time::timeout(
+        deadline.saturating_duration_since(Instant::now()),
+        operation,
+    )
+    .await
+    .unwrap_or_else(|_| {
+        Err(Error::Unavailable(
+            "The database didn't answer in time!".into(),
+        ))
+    })
+}
+
+/// The results of a search.
+///
+/// # Fields
+///
+/// * `query`: The query, if any.
+/// * `corrected_query`: The corrected query the results are for instead, if the query had none.
+/// * `errors`: An errors, if any.
+/// * `pages`: The pages that match the query, if any.
+/// * `images`: The images on the pages that match the query, for image searches.
+/// * `clusters`: The topics the returned pages are grouped by, if asked for.
+/// * `total`: The total number of pages, or images, that match the query, across all pages of results.
+/// * `duplicates`: The number of pages collapsed into others with the same content, with `dedup=true`.
+/// * `partial`: Whether some of the database shards failed, so the results may be incomplete.
+/// * `degraded`: Whether some of the ranking data wasn't found in time, so the pages were ranked without it.
+/// * `degraded_stages`: The stages of the search that weren't done in time.
+/// * `variant`: The ranking variant the pages were ranked with, if any.
+#[derive(Debug, Serialize)]
+pub struct Output {
+    pub query: Option<String>,
+    pub corrected_query: Option<String>,
+    pub error: Option<Error>,
+    pub pages: Option<Vec<SearchResult>>,
+    pub images: Option<Vec<ImageResult>>,
+    pub clusters: Option<Vec<Cluster>>,
+    pub total: Option<usize>,
+    pub duplicates: Option<usize>,
+    pub partial: bool,
+    pub degraded: bool,
+    pub degraded_stages: Vec<Stage>,
+    pub variant: Option<String>,
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use common::database::model::Page;
+    use std::time::{Duration, SystemTime};
+
+    fn get_page(id: i32, url: &str) -> CompletePage {
+        get_page_in(id, url, None)
+    }
+
+    fn get_page_in(id: i32, url: &str, language: Option<&str>) -> CompletePage {
+        CompletePage {
+            page: Page {
+                id,
+                url: url.to_string(),
+                last_crawled_at: SystemTime::UNIX_EPOCH,
+                title: None,
+                description: None,
+                encoding: None,
+                index_fingerprint: None,
+                first_seen_at: SystemTime::UNIX_EPOCH,
+                language: language.map(str::to_string),
+                published_at: None,
+                content_modified_at: None,
+                authenticated: false,
+                excluded: false,
+                personalized: false,
+                unstable: false,
+                noarchive: false,
+                etag: None,
+                last_modified: None,
+            },
+            keywords: None,
+        }
+    }
+
+    /// Orders pages of equal rank by language, the way the results of a search are.
+    fn get_languages(pages: &[CompletePage], preferences: &str, lang: Option<&str>) -> Vec<String> {
+        let pages = pages
+            .iter()
+            .filter(|page| Info::is_in_language(page, lang))
+            .collect::<Vec<_>>();
+        let mut page_ranks = pages
+            .iter()
+            .map(|page| (*page, 1.0))
+            .collect::<HashMap<_, _>>();
+        Info::boost_languages(
+            &mut page_ranks,
+            &language::parse_preferences(preferences),
+            1.0,
+        );
+
+        let mut pages = page_ranks.into_iter().collect::<Vec<_>>();
+        pages.sort_by(|(page_a, rank_a), (page_b, rank_b)| {
+            rank_b
+                .total_cmp(rank_a)
+                .then(page_a.page.id.cmp(&page_b.page.id))
+        });
+        pages
+            .into_iter()
+            .map(|(page, _)| page.page.language.clone().unwrap_or_default())
+            .collect()
+    }
+
+    #[test]
+    fn test_languages() {
+        let pages = [
+            get_page_in(1, "https://example.de/", Some("de")),
+            get_page_in(2, "https://example.com/", Some("en")),
+            get_page_in(3, "https://example.dk/", Some("da")),
+        ];
+
+        assert_eq!(get_languages(&pages, "da,en", None), ["da", "en", "de"]);
+        assert_eq!(
+            get_languages(&pages, "da;q=0.5, de", None),
+            ["de", "da", "en"]
+        );
+        assert_eq!(get_languages(&pages, "fr,en", None), ["en", "de", "da"]);
+        assert_eq!(get_languages(&pages, "", None), ["de", "en", "da"]);
+
+        // The language filter leaves out every other language, even the preferred ones.
+        assert_eq!(get_languages(&pages, "da,en", Some("de")), ["de"]);
+        assert!(get_languages(&pages, "", Some("fr")).is_empty());
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_is_published_in() {
+        let date = |date| utils::dates::parse(date).expect("Failed to parse date!");
+        let published_at = Some(date("2024-05-12T06:30:00Z"));
+
+        for (after, before, expected) in [
+            (None, None, true),
+            (Some("2024-05-12"), None, true),
+            (Some("2024-05-13"), None, false),
+            (None, Some("2024-05-13"), true),
+            (None, Some("2024-05-12"), false),
+            (Some("2024-05-01"), Some("2024-06-01"), true),
+            (Some("2024-06-01"), Some("2024-07-01"), false),
+        ] {
+            let range = (after.map(date), before.map(date));
+
+            assert_eq!(
+                Info::is_published_in(published_at, range),
+                expected,
+                "{after:?}..{before:?}"
+            );
+        }
+
+        // Pages without a publish date are only left out if there's a range.
+        assert!(Info::is_published_in(None, (None, None)));
+        assert!(!Info::is_published_in(
+            None,
+            (Some(date("2024-05-01")), None)
+        ));
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get_boosts() {
+        let dictionary = Dictionary::default();
+        let query = utils::words::extract(
+            "rust search engines",
+            rust_stemmers::Algorithm::English,
+            &dictionary,
+        );
+        let get_boosts = |boost: &str| {
+            let info = serde_json::from_value::<Info>(serde_json::json!({ "boost": boost }))
+                .expect("Failed to parse search info!");
+
+            info.get_boosts(&query, &dictionary, 5.0)
+        };
+        let rust = |boosts: &HashMap<String, f64>| boosts.get("rust").copied();
+
+        // Boosts above the maximum are clamped to it.
+        assert_eq!(rust(&get_boosts("rust:2")), Some(2.0));
+        assert_eq!(rust(&get_boosts("rust:50")), Some(5.0));
+
+        // Boosts that aren't positive, or aren't numbers, are ignored.
+        for boost in ["rust:0", "rust:-2", "rust:NaN", "rust:inf", "rust"] {
+            assert!(get_boosts(boost).is_empty(), "{boost}");
+        }
+
+        // Repeating a term, or boosting words with the same stem, doesn't stack past the cap.
+        assert_eq!(rust(&get_boosts("rust:4,rust:4,rust:50")), Some(5.0));
+        let boosts = get_boosts("engine:4,engines:4,other:2");
+        assert_eq!(boosts.values().copied().collect::<Vec<_>>(), vec![4.0]);
+    }
+
+    #[test]
+    fn test_collapse() {
+        let pages = vec![
+            get_page(1, "https://a.com/"),
+            get_page(2, "https://b.com/"),
+            get_page(3, "https://mirror.a.com/"),
+            get_page(4, "https://c.com/"),
+            get_page(5, "https://mirror.b.com/"),
+            get_page(6, "https://copy.a.com/"),
+        ];
+        let hashes = HashMap::from([
+            ("https://a.com/".to_string(), "a".to_string()),
+            ("https://b.com/".to_string(), "b".to_string()),
+            ("https://mirror.a.com/".to_string(), "a".to_string()),
+            ("https://mirror.b.com/".to_string(), "b".to_string()),
+            ("https://copy.a.com/".to_string(), "a".to_string()),
+        ]);
+
+        // The best ranked page of each content is kept where it was, and pages without a hash are never collapsed.
+        let collapsed = Info::collapse(pages, &hashes)
+            .into_iter()
+            .map(|(page, duplicates)| (page.page.id, duplicates))
+            .collect::<Vec<_>>();
+        assert_eq!(collapsed, vec![(1, 2), (2, 1), (4, 0)]);
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_sort_order() {
+        let date = |date| Some(utils::dates::parse(date).expect("Failed to parse date!"));
+        let (older, newer) = (date("2024-05-01"), date("2024-05-12"));
+
+        assert_eq!(Sort::Date.order(newer, older), Ordering::Less);
+        assert_eq!(Sort::Date.order(older, newer), Ordering::Greater);
+        assert_eq!(Sort::Date.order(older, None), Ordering::Less);
+        assert_eq!(Sort::Date.order(None, None), Ordering::Equal);
+
+        // Sorting by relevance leaves the order to the rank.
+        assert_eq!(Sort::Relevance.order(older, newer), Ordering::Equal);
+    }
+
+    #[test]
+    fn test_rank_urls() {
+        let word_match =
+            |url: &str, language: Option<&str>, word: &str, frequency, positions| WordMatch {
+                url: url.to_string(),
+                language: language.map(str::to_string),
+                published_at: None,
+                unstable: false,
+                word: word.to_string(),
+                frequency,
+                positions,
+                field: Field::Body.as_str().into(),
+            };
+        let matches = vec![
+            word_match("https://a.com/", Some("en"), "rust", 2, vec![0]),
+            word_match("https://a.com/", Some("en"), "tutori", 2, vec![1]),
+            word_match("https://b.com/", None, "rust", 5, vec![0]),
+            word_match("https://b.com/", None, "tutori", 1, vec![50]),
+            word_match("https://c.com/", Some("da"), "rust", 5, vec![0]),
+        ];
+        let query = HashMap::from([("rust".to_string(), 1), ("tutori".to_string(), 1)]);
+        let weights = Weights {
+            ranker_constant: 0.85,
+            rating_factor: 1.0,
+            click_weight: 0.0,
+            proximity_weight: 1.0,
+            language_weight: 1.0,
+            authority_weight: 0.0,
+            unstable_penalty: 0.5,
+            title_weight: 3.0,
+            heading_weight: 2.0,
+            body_weight: 1.0,
+            image_weight: 0.5,
+        };
+        let rank = |required_language, preferences: &str| {
+            Info::rank_urls(
+                matches.clone(),
+                &query,
+                &HashMap::new(),
+                &HashMap::new(),
+                required_language,
+                &language::parse_preferences(preferences),
+                &weights,
+                Sort::default(),
+                &Curated::default(),
+                &Authorities::default(),
+            )
+            .unwrap_or_default()
+        };
+
+        // Close terms rank higher, and a page missing a term is ranked by the one it has.
+        assert_eq!(
+            rank(None, ""),
+            vec!["https://a.com/", "https://b.com/", "https://c.com/"]
+        );
+        assert_eq!(
+            rank(None, "da"),
+            vec!["https://c.com/", "https://a.com/", "https://b.com/"]
+        );
+        assert_eq!(rank(Some("da"), ""), vec!["https://c.com/"]);
+    }
+
+    #[test]
+    fn test_rank_urls_by_field() {
+        let word_match = |url: &str, field: Field| WordMatch {
+            url: url.to_string(),
+            language: None,
+            published_at: None,
+            unstable: false,
+            word: "rust".to_string(),
+            frequency: 2,
+            positions: vec![0],
+            field: field.as_str().into(),
+        };
+        let matches = vec![
+            word_match("https://body.com/", Field::Body),
+            word_match("https://title.com/", Field::Title),
+        ];
+        let query = HashMap::from([("rust".to_string(), 1)]);
+        let weights = Weights {
+            ranker_constant: 0.85,
+            rating_factor: 1.0,
+            click_weight: 0.0,
+            proximity_weight: 1.0,
+            language_weight: 1.0,
+            authority_weight: 0.0,
+            unstable_penalty: 0.5,
+            title_weight: 3.0,
+            heading_weight: 2.0,
+            body_weight: 1.0,
+            image_weight: 0.5,
+        };
+        let rank = |field: Option<Field>| {
+            let fields = field
+                .map(|field| HashMap::from([("rust".to_string(), field)]))
+                .unwrap_or_default();
+
+            Info::rank_urls(
+                matches.clone(),
+                &query,
+                &HashMap::new(),
+                &fields,
+                None,
+                &[],
+                &weights,
+                Sort::default(),
+                &Curated::default(),
+                &Authorities::default(),
+            )
+            .unwrap_or_default()
+        };
+
+        // A match in the title outranks one in the body that's just as frequent.
+        assert_eq!(rank(None), vec!["https://title.com/", "https://body.com/"]);
+
+        // Qualified terms only score in their field.
+        assert_eq!(
+            rank(Some(Field::Body)),
+            vec!["https://body.com/", "https://title.com/"]
+        );
+
+        assert_eq!(
+            split_fields("title:rust body:async tutorial url:x"),
+            vec![
+                (Some(Field::Title), "rust"),
+                (Some(Field::Body), "async"),
+                (None, "tutorial"),
+                (None, "url:x"),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_rank_urls_by_image() {
+        let word_match = |url: &str, field: Field| WordMatch {
+            url: url.to_string(),
+            language: None,
+            published_at: None,
+            unstable: false,
+            word: "otter".to_string(),
+            frequency: 2,
+            positions: vec![0],
+            field: field.as_str().into(),
+        };
+        let query = HashMap::from([("otter".to_string(), 1)]);
+        let weights = Weights {
+            ranker_constant: 0.85,
+            rating_factor: 1.0,
+            click_weight: 0.0,
+            proximity_weight: 1.0,
+            language_weight: 1.0,
+            authority_weight: 0.0,
+            unstable_penalty: 0.5,
+            title_weight: 3.0,
+            heading_weight: 2.0,
+            body_weight: 1.0,
+            image_weight: 0.5,
+        };
+        let rank = |matches: Vec<WordMatch>| {
+            Info::rank_urls(
+                matches,
+                &query,
+                &HashMap::new(),
+                &HashMap::new(),
+                None,
+                &[],
+                &weights,
+                Sort::default(),
+                &Curated::default(),
+                &Authorities::default(),
+            )
+            .unwrap_or_default()
+        };
+
+        // Pages are found by the alt text and captions of their images alone.
+        assert_eq!(
+            rank(vec![word_match("https://image.com/", Field::Image)]),
+            vec!["https://image.com/"]
+        );
+
+        // Image text weighs less than a match in the body that's just as frequent.
+        assert_eq!(
+            rank(vec![
+                word_match("https://image.com/", Field::Image),
+                word_match("https://body.com/", Field::Body),
+            ]),
+            vec!["https://body.com/", "https://image.com/"]
+        );
+    }
+
+    #[test]
+    fn test_rank_urls_cached() {
+        let word_match = |url: &str, word: &str, frequency, positions| WordMatch {
+            url: url.to_string(),
+            language: None,
+            published_at: None,
+            unstable: false,
+            word: word.to_string(),
+            frequency,
+            positions,
+            field: Field::Body.as_str().into(),
+        };
+        let matches = vec![
+            word_match("https://a.com/", "rust", 2, vec![0]),
+            word_match("https://a.com/", "tutori", 2, vec![1]),
+            word_match("https://b.com/", "rust", 5, vec![0]),
+            word_match("https://b.com/", "tutori", 1, vec![50]),
+            word_match("https://c.com/", "rust", 1, vec![0]),
+        ];
+        let query = HashMap::from([("rust".to_string(), 1), ("tutori".to_string(), 1)]);
+        let weights = Weights {
+            ranker_constant: 0.85,
+            rating_factor: 1.0,
+            click_weight: 0.0,
+            proximity_weight: 1.0,
+            language_weight: 1.0,
+            authority_weight: 0.0,
+            unstable_penalty: 0.5,
+            title_weight: 3.0,
+            heading_weight: 2.0,
+            body_weight: 1.0,
+            image_weight: 0.5,
+        };
+        let rank = |matches| {
+            Info::rank_urls(
+                matches,
+                &query,
+                &HashMap::new(),
+                &HashMap::new(),
+                None,
+                &[],
+                &weights,
+                Sort::default(),
+                &Curated::default(),
+                &Authorities::default(),
+            )
+            .unwrap_or_default()
+        };
+
+        let words = vec!["rust".to_string(), "tutori".to_string()];
+        let cache = PostingCache::new(100, 10, Duration::from_secs(60));
+        cache.get(&words);
+        cache.insert(&words, &matches);
+
+        // The postings served from the cache rank the same as the ones looked up on the shard.
+        let (cached, missing) = cache.get(&words);
+        assert!(missing.is_empty());
+        assert_eq!(rank(cached), rank(matches));
+    }
+
+    #[test]
+    fn test_get_page_ranks() {
+        let linked = get_page(1, "https://linked.com/");
+        let linking = get_page(2, "https://linking.com/");
+        let unordered_pages = vec![linked.clone(), linking.clone()];
+        let relevance_scores =
+            HashMap::from([(&unordered_pages[0], 1.0), (&unordered_pages[1], 2.0)]);
+        let backlinks = HashMap::from([(linking, 1)]);
+
+        // The variant's weights are used, not the control's.
+        for (weights, linked_rank, linking_rank) in [
+            (
+                Weights {
+                    ranker_constant: 0.7,
+                    rating_factor: 0.4,
+                    click_weight: 0.0,
+                    proximity_weight: 1.0,
+                    language_weight: 1.0,
+                    authority_weight: 0.0,
+                    unstable_penalty: 0.5,
+                    title_weight: 3.0,
+                    heading_weight: 2.0,
+                    body_weight: 1.0,
+                    image_weight: 0.5,
+                },
+                (0.4_f64 * 0.7 + 2.0) * 0.7,
+                0.4 * 0.7,
+            ),
+            (
+                Weights {
+                    ranker_constant: 0.5,
+                    rating_factor: 1.0,
+                    click_weight: 0.0,
+                    proximity_weight: 1.0,
+                    language_weight: 1.0,
+                    authority_weight: 0.0,
+                    unstable_penalty: 0.5,
+                    title_weight: 3.0,
+                    heading_weight: 2.0,
+                    body_weight: 1.0,
+                    image_weight: 0.5,
+                },
+                (1.0_f64 * 0.5 + 2.0) * 0.5,
+                1.0 * 0.5,
+            ),
+        ] {
+            let page_ranks =
+                Info::get_page_ranks(&unordered_pages, &relevance_scores, &backlinks, &weights);
+
+            assert!((page_ranks[&linked] - linked_rank).abs() < f64::EPSILON);
+            assert!((page_ranks[&unordered_pages[1]] - linking_rank).abs() < f64::EPSILON);
+        }
+    }
+
+    #[actix_web::test]
+    async fn test_get_ranking_data_slow_backlinks() {
+        let started_at = Instant::now();
+        let (backlinks, click_through_rates, degraded_stages) = Info::get_ranking_data(
+            async {
+                actix_web::rt::time::sleep(Duration::from_secs(10)).await;
+
+                Ok(HashMap::new())
+            },
+            async { Ok(HashMap::from([("https://example.com/".to_string(), 0.5)])) },
+            started_at + Duration::from_millis(50),
+        )
+        .await;
+
+        // The slow backlinks are given up on at the deadline, without holding up the click-through rates.
+        assert!(started_at.elapsed() < Duration::from_secs(1));
+        assert_eq!(backlinks, None);
+        assert_eq!(
+            click_through_rates,
+            Some(HashMap::from([("https://example.com/".to_string(), 0.5)]))
+        );
+        assert_eq!(degraded_stages, vec![Stage::Backlinks]);
+    }
+
+    #[actix_web::test]
+    async fn test_get_ranking_data_slow_clicks() {
+        let started_at = Instant::now();
+        let (backlinks, click_through_rates, degraded_stages) = Info::get_ranking_data(
+            async { Ok(HashMap::from([(get_page(1, "https://example.com/"), 1)])) },
+            async {
+                actix_web::rt::time::sleep(Duration::from_secs(10)).await;
+
+                Ok(HashMap::new())
+            },
+            started_at + Duration::from_millis(50),
+        )
+        .await;
+
+        assert!(started_at.elapsed() < Duration::from_secs(1));
+        assert_eq!(
+            backlinks,
+            Some(HashMap::from([(get_page(1, "https://example.com/"), 1)]))
+        );
+        assert_eq!(click_through_rates, None);
+        assert_eq!(degraded_stages, vec![Stage::Clicks]);
+    }
+
+    #[actix_web::test]
+    async fn test_get_ranking_data_in_time() {
+        let (backlinks, click_through_rates, degraded_stages) = Info::get_ranking_data(
+            async { Ok(HashMap::new()) },
+            async { Ok(HashMap::new()) },
+            Instant::now() + Duration::from_secs(1),
+        )
+        .await;
+
+        assert_eq!(backlinks, Some(HashMap::new()));
+        assert_eq!(click_through_rates, Some(HashMap::new()));
+        assert!(degraded_stages.is_empty());
+    }
 }
@@ -0,0 +1,225 @@
+use common::utils::words::Dictionary;
+use serde::Serialize;
+use std::collections::HashMap;
+use unicode_segmentation::UnicodeSegmentation;
+
+/// What's appended to snippets that were truncated.
+const ELLIPSIS: &str = "…";
+
+/// The direction of a text.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum TextDirection {
+    Ltr,
+    Rtl,
+}
+
+/// A snippet of a page, shown below its title.
+///
+/// # Fields
+///
+/// * `text`: The text of the snippet.
+/// * `text_direction`: The direction of the text.
+/// * `highlights`: The start and end of each query word in the text, in characters rather than bytes.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Snippet {
+    pub text: String,
+    pub text_direction: TextDirection,
+    pub highlights: Vec<(usize, usize)>,
+}
+
+impl Snippet {
+    /// Creates a snippet from the text of a page.
+    ///
+    /// # Arguments
+    ///
+    /// * `text`: The text of the page.
+    /// * `query`: The stemmed words of the query, to highlight.
+    /// * `maximum_length`: The maximum length of the snippet, in grapheme clusters.
+    /// * `dictionary`: The protected words, which aren't stemmed.
+    ///
+    /// # Returns
+    ///
+    /// * `Snippet` - The snippet.
+    ///
+    /// # Notes
+    ///
+    /// * The text is truncated at the last word boundary that fits, so no grapheme cluster or word is cut in half.
+    #[must_use]
+    pub fn new<S: std::hash::BuildHasher>(
+        text: &str,
+        query: &HashMap<String, usize, S>,
+        maximum_length: usize,
+        dictionary: &Dictionary,
+    ) -> Self {
+        let text = truncate(text.trim(), maximum_length);
+        let stemmer = rust_stemmers::Stemmer::create(rust_stemmers::Algorithm::English);
+
+        let mut highlights = Vec::new();
+        for (start, word) in text.unicode_word_indices() {
+            let length = word.chars().count();
+            let word = word.to_lowercase();
+            let stemmed_word = if dictionary.is_protected(&word) {
+                word
+            } else {
+                stemmer.stem(&word).to_string()
+            };
+
+            if query.contains_key(&stemmed_word) {
+                let start = text[..start].chars().count();
+
+                highlights.push((start, start + length));
+            }
+        }
+
+        Self {
+            text_direction: get_text_direction(&text),
+            text,
+            highlights,
+        }
+    }
+}
+
+/// Truncates a text at the last word boundary within a number of grapheme clusters.
+///
+/// # Arguments
+///
+/// * `text`: The text.
+/// * `maximum_length`: The maximum length of the text, in grapheme clusters.
+///
+/// # Returns
+///
+/// * `String` - The truncated text, ending with an ellipsis if anything was cut off.
+fn truncate(text: &str, maximum_length: usize) -> String {
+    let Some((cut, _)) = text.grapheme_indices(true).nth(maximum_length) else {
+        return text.to_string();
+    };
+
+    // Cut before the word that doesn't fit, unless it's the only word.
+    let end = if text[cut..].starts_with(char::is_whitespace) {
+        cut
+    } else {
+        text[..cut]
+            .split_word_bound_indices()
+            .filter(|(_, segment)| segment.chars().all(char::is_whitespace))
+            .map(|(start, _)| start)
+            .last()
+            .unwrap_or(cut)
+    };
+
+    format!("{}{ELLIPSIS}", text[..end].trim_end())
+}
+
+/// Gets the direction of a text from its first strong directional character.
+///
+/// # Arguments
+///
+/// * `text`: The text.
+///
+/// # Returns
+///
+/// * `TextDirection` - The direction of the text, left to right if it has no strong directional characters.
+fn get_text_direction(text: &str) -> TextDirection {
+    text.chars()
+        .find_map(|c| {
+            if is_rtl(c) {
+                Some(TextDirection::Rtl)
+            } else if c.is_alphabetic() {
+                Some(TextDirection::Ltr)
+            } else {
+                None
+            }
+        })
+        .unwrap_or(TextDirection::Ltr)
+}
+
+/// Checks if a character is a strong right to left character, like Hebrew or Arabic letters.
+///
+/// # Arguments
+///
+/// * `c`: The character.
+///
+/// # Returns
+///
+/// * `bool` - Whether the character is written right to left.
+fn is_rtl(c: char) -> bool {
+    matches!(
+        c,
+        '\u{0590}'..='\u{08FF}'
+            | '\u{FB1D}'..='\u{FDFF}'
+            | '\u{FE70}'..='\u{FEFF}'
+            | '\u{10800}'..='\u{10FFF}'
+            | '\u{1E800}'..='\u{1EFFF}'
+    ) && c.is_alphabetic()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn get_query(words: &[&str]) -> HashMap<String, usize> {
+        words.iter().map(|word| ((*word).to_string(), 1)).collect()
+    }
+
+    fn get_highlighted(snippet: &Snippet) -> Vec<String> {
+        snippet
+            .highlights
+            .iter()
+            .map(|(start, end)| {
+                snippet
+                    .text
+                    .chars()
+                    .skip(*start)
+                    .take(end - start)
+                    .collect()
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_truncate() {
+        assert_eq!(truncate("Hello world", 20), "Hello world");
+        assert_eq!(truncate("Hello wonderful world", 12), "Hello…");
+        assert_eq!(truncate("Hello wonderful world", 15), "Hello wonderful…");
+        assert_eq!(truncate("Supercalifragilistic", 5), "Super…");
+
+        // Family emoji and flags are single grapheme clusters made of several characters.
+        let text = "👨‍👩‍👧‍👦 🇩🇰 hygge";
+        assert_eq!(truncate(text, 1), "👨‍👩‍👧‍👦…");
+        assert_eq!(truncate(text, 4), "👨‍👩‍👧‍👦 🇩🇰…");
+    }
+
+    #[test]
+    fn test_arabic() {
+        let text = "مرحبا بالعالم، هذا محرك بحث مكتوب بلغة رست";
+        let snippet = Snippet::new(text, &get_query(&["محرك"]), 24, &Dictionary::default());
+
+        assert_eq!(snippet.text_direction, TextDirection::Rtl);
+        assert_eq!(snippet.text, "مرحبا بالعالم، هذا محرك…");
+        assert_eq!(get_highlighted(&snippet), vec!["محرك"]);
+    }
+
+    #[test]
+    fn test_hebrew() {
+        // Hebrew points are combining marks, which must stay with their letters.
+        let text = "שָׁלוֹם עוֹלָם";
+        let snippet = Snippet::new(text, &get_query(&["עוֹלָם"]), 5, &Dictionary::default());
+
+        assert_eq!(snippet.text_direction, TextDirection::Rtl);
+        assert_eq!(snippet.text, "שָׁלוֹם…");
+        assert!(snippet.highlights.is_empty());
+
+        let snippet = Snippet::new(text, &get_query(&["עוֹלָם"]), 50, &Dictionary::default());
+        assert_eq!(get_highlighted(&snippet), vec!["עוֹלָם"]);
+    }
+
+    #[test]
+    fn test_highlights() {
+        let text = "🦀 Crabs are rusting, and Rust is great!";
+        let snippet = Snippet::new(text, &get_query(&["rust"]), 100, &Dictionary::default());
+
+        assert_eq!(snippet.text_direction, TextDirection::Ltr);
+        assert_eq!(snippet.highlights, vec![(12, 19), (25, 29)]);
+        assert_eq!(get_highlighted(&snippet), vec!["rusting", "Rust"]);
+    }
+}
@@ -0,0 +1,465 @@
+use common::database::model::{CrawlLogFilter, RowCounts};
+use common::database::{self, store};
+use common::errors::Error;
+use common::utils;
+use log::warn;
+use reqwest::Client;
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::fmt::Write;
+use std::net::IpAddr;
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+
+/// The time a health endpoint has to respond, before it's considered down.
+const HEALTH_TIMEOUT: Duration = Duration::from_secs(5);
+
+/// The window the crawls in the status are counted in, an hour.
+const CRAWL_WINDOW: Duration = Duration::from_secs(60 * 60);
+
+/// The number of error codes listed in the status.
+const TOP_ERRORS: usize = 5;
+
+/// A check of a part of the system.
+///
+/// # Fields
+///
+/// * `name`: The name of the part, like `database`.
+/// * `critical`: Whether the system is unhealthy if the check fails.
+/// * `passed`: Whether the check passed.
+/// * `detail`: What was found, or why the check failed.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Check {
+    pub name: String,
+    pub critical: bool,
+    pub passed: bool,
+    pub detail: String,
+}
+
+/// The size of the frontier, from its latest snapshot.
+///
+/// # Fields
+///
+/// * `taken_at`: When the snapshot was taken, in seconds since the Unix epoch.
+/// * `urls`: The number of URLs waiting to be crawled in the snapshot.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Frontier {
+    pub taken_at: u64,
+    pub urls: i64,
+}
+
+/// The number of crawls that failed with an error code.
+///
+/// # Fields
+///
+/// * `code`: The stable code of the error.
+/// * `crawls`: The number of crawls.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct ErrorCount {
+    pub code: String,
+    pub crawls: i64,
+}
+
+/// The status of the system, for operators.
+///
+/// # Fields
+///
+/// * `frontier`: The size of the frontier, if a snapshot of it has been taken.
+/// * `rows`: The number of pages, keywords and links across every shard, if they could be counted.
+/// * `crawled_last_hour`: The number of URLs crawled in the last hour, if they could be counted.
+/// * `top_errors`: The most common error codes of the crawls in the last hour, most crawls first.
+/// * `checks`: The checks of the database, the shards and the health endpoints.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Status {
+    pub frontier: Option<Frontier>,
+    pub rows: Option<RowCounts>,
+    pub crawled_last_hour: Option<i64>,
+    pub top_errors: Vec<ErrorCount>,
+    pub checks: Vec<Check>,
+}
+
+impl Check {
+    /// Creates a check from its result.
+    ///
+    /// # Arguments
+    ///
+    /// * `name`: The name of the part that was checked.
+    /// * `critical`: Whether the system is unhealthy if the check fails.
+    /// * `result`: What was found, or why the check failed.
+    ///
+    /// # Returns
+    ///
+    /// * `Check` - The check.
+    fn new(name: &str, critical: bool, result: Result<String, Error>) -> Self {
+        let (passed, detail) = match result {
+            Ok(detail) => (true, detail),
+            Err(err) => (false, format!("{err} ({})", err.code())),
+        };
+
+        Self {
+            name: name.to_string(),
+            critical,
+            passed,
+            detail,
+        }
+    }
+}
+
+impl Status {
+    /// Collects the status of the system.
+    ///
+    /// # Returns
+    ///
+    /// * `Status` - The status, with a failed check for every part that couldn't be reached.
+    ///
+    /// # Notes
+    ///
+    /// * The crawler only runs while there's something to crawl, so it being down isn't critical.
+    pub async fn collect() -> Self {
+        let mut checks = Vec::new();
+
+        let snapshot = database::count_latest_frontier_snapshot().await;
+        let frontier = snapshot
+            .as_ref()
+            .ok()
+            .copied()
+            .flatten()
+            .map(|(taken_at, urls)| Frontier {
+                taken_at: taken_at
+                    .duration_since(UNIX_EPOCH)
+                    .map(|since_epoch| since_epoch.as_secs())
+                    .unwrap_or_default(),
+                urls,
+            });
+        checks.push(Check::new(
+            "database",
+            true,
+            snapshot.map(|_| "Connected".to_string()),
+        ));
+
+        let rows = store::load().count_rows().await;
+        checks.push(Check::new(
+            "shards",
+            true,
+            rows.as_ref().map(|_| {
+                format!(
+                    "Counted {} shards",
+                    utils::env::database::get_database_urls().len()
+                )
+            }),
+        ));
+
+        let now = SystemTime::now();
+        let filter = CrawlLogFilter {
+            host: None,
+            status: None,
+            error_code: None,
+            since: now - CRAWL_WINDOW,
+            until: now,
+        };
+        let (crawled_last_hour, top_errors) = match database::count_crawl_events(&filter).await {
+            Ok(counts) => (
+                Some(counts.iter().map(|(_, _, crawls)| crawls).sum()),
+                get_top_errors(&counts, TOP_ERRORS),
+            ),
+            Err(err) => {
+                warn!("Failed to count the crawls of the last hour! Error: {err}");
+
+                (None, Vec::new())
+            }
+        };
+
+        let client = Client::builder()
+            .timeout(HEALTH_TIMEOUT)
+            .build()
+            .unwrap_or_default();
+        let (ip, port) = utils::env::web::get_address();
+        checks.push(Check::new(
+            "api",
+            true,
+            check_health(&client, &get_health_url(&ip, port)).await,
+        ));
+        if let Some((ip, port)) = utils::env::web::get_crawler_admin_address() {
+            checks.push(Check::new(
+                "crawler",
+                false,
+                check_health(&client, &get_health_url(&ip, port)).await,
+            ));
+        }
+
+        Self {
+            frontier,
+            rows: rows.ok(),
+            crawled_last_hour,
+            top_errors,
+            checks,
+        }
+    }
+
+    /// Checks if the system is healthy.
+    ///
+    /// # Returns
+    ///
+    /// * `bool` - Whether every critical check passed.
+    #[must_use]
+    pub fn is_healthy(&self) -> bool {
+        self.checks
+            .iter()
+            .all(|check| check.passed || !check.critical)
+    }
+
+    /// Renders the status as a dashboard for the terminal.
+    ///
+    /// # Arguments
+    ///
+    /// * `now`: The current time, to tell the age of the frontier snapshot with.
+    ///
+    /// # Returns
+    ///
+    /// * `String` - The dashboard, one line per number and check.
+    #[must_use]
+    pub fn render(&self, now: SystemTime) -> String {
+        let unknown = || "unknown".to_string();
+
+        let frontier = self.frontier.map_or_else(
+            || "no snapshot".to_string(),
+            |frontier| {
+                let age = now
+                    .duration_since(UNIX_EPOCH + Duration::from_secs(frontier.taken_at))
+                    .unwrap_or_default();
+
+                format!(
+                    "{} URLs (snapshot from {} seconds ago)",
+                    frontier.urls,
+                    age.as_secs()
+                )
+            },
+        );
+        let top_errors = if self.top_errors.is_empty() {
+            "none".to_string()
+        } else {
+            self.top_errors
+                .iter()
+                .map(|error| format!("{} ({})", error.code, error.crawls))
+                .collect::<Vec<_>>()
+                .join(", ")
+        };
+
+        let mut dashboard = String::new();
+        let _ = writeln!(dashboard, "Frontier:      {frontier}");
+        for (name, count) in [
+            ("Pages:", self.rows.map(|rows| rows.pages)),
+            ("Keywords:", self.rows.map(|rows| rows.keywords)),
+            ("Links:", self.rows.map(|rows| rows.forward_links)),
+            ("Crawled (1h):", self.crawled_last_hour),
+        ] {
+            let count = count.map_or_else(unknown, |count| count.to_string());
+            let _ = writeln!(dashboard, "{name:<14} {count}");
+        }
+        let _ = writeln!(dashboard, "Top errors:    {top_errors}");
+
+        let _ = writeln!(dashboard, "Checks:");
+        for check in &self.checks {
+            let label = match (check.passed, check.critical) {
+                (true, _) => " OK ",
+                (false, true) => "FAIL",
+                (false, false) => "WARN",
+            };
+
+            let _ = writeln!(dashboard, "  [{label}] {}: {}", check.name, check.detail);
+        }
+
+        dashboard
+    }
+}
+
+/// Gets the most common error codes of the crawls.
+///
+/// # Arguments
+///
+/// * `counts`: The error code, status and number of crawls of each group.
+/// * `limit`: The maximum number of error codes.
+///
+/// # Returns
+///
+/// * `Vec<ErrorCount>` - The error codes, most crawls first.
+fn get_top_errors(counts: &[(Option<String>, Option<i32>, i64)], limit: usize) -> Vec<ErrorCount> {
+    let mut totals: HashMap<&str, i64> = HashMap::new();
+    for (error_code, _, crawls) in counts {
+        if let Some(error_code) = error_code {
+            let total = totals.entry(error_code).or_default();
+            *total = total.saturating_add(*crawls);
+        }
+    }
+
+    let mut top_errors = totals
+        .into_iter()
+        .map(|(code, crawls)| ErrorCount {
+            code: code.to_string(),
+            crawls,
+        })
+        .collect::<Vec<_>>();
+    top_errors.sort_by(|a, b| b.crawls.cmp(&a.crawls).then_with(|| a.code.cmp(&b.code)));
+    top_errors.truncate(limit);
+
+    top_errors
+}
+
+/// Gets the URL of the health endpoint of a server.
+///
+/// # Arguments
+///
+/// * `ip`: The IP the server listens on.
+/// * `port`: The port the server listens on.
+///
+/// # Returns
+///
+/// * `String` - The URL, on the loopback address if the server listens on every address.
+fn get_health_url(ip: &str, port: u16) -> String {
+    match ip.parse::<IpAddr>() {
+        Ok(ip) if ip.is_unspecified() => format!("http://127.0.0.1:{port}/health"),
+        Ok(IpAddr::V6(ip)) => format!("http://[{ip}]:{port}/health"),
+        _ => format!("http://{ip}:{port}/health"),
+    }
+}
+
+/// Checks the health endpoint of a server.
+///
+/// # Arguments
+///
+/// * `client`: The HTTP client.
+/// * `url`: The URL of the health endpoint.
+///
+/// # Returns
+///
+/// * `Ok(String)` - How long the server took to respond, if it responded with a success.
+/// * `Err(Error)` - If the server didn't respond in time, or failed.
+///
+/// # Errors
+///
+/// * If the request failed or timed out.
+/// * If the server responded with an error status.
+async fn check_health(client: &Client, url: &str) -> Result<String, Error> {
+    let started_at = SystemTime::now();
+    let response = client.get(url).send().await?;
+    if !response.status().is_success() {
+        return Err(Error::Unavailable(format!(
+            "\"{url}\" responded with {}!",
+            response.status()
+        )));
+    }
+
+    Ok(format!(
+        "Responded in {} ms",
+        started_at.elapsed().unwrap_or_default().as_millis()
+    ))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn check(name: &str, critical: bool, passed: bool) -> Check {
+        Check {
+            name: name.to_string(),
+            critical,
+            passed,
+            detail: "Detail".to_string(),
+        }
+    }
+
+    fn status(checks: Vec<Check>) -> Status {
+        Status {
+            frontier: Some(Frontier {
+                taken_at: 1_000,
+                urls: 42,
+            }),
+            rows: Some(RowCounts {
+                pages: 10,
+                keywords: 200,
+                forward_links: 30,
+            }),
+            crawled_last_hour: Some(12),
+            top_errors: get_top_errors(
+                &[
+                    (Some("timeout".into()), None, 3),
+                    (Some("fetch".into()), None, 1),
+                    (Some("timeout".into()), Some(504), 2),
+                    (None, Some(200), 6),
+                ],
+                TOP_ERRORS,
+            ),
+            checks,
+        }
+    }
+
+    #[test]
+    fn test_is_healthy() {
+        assert!(status(vec![check("database", true, true)]).is_healthy());
+        assert!(status(vec![
+            check("database", true, true),
+            check("crawler", false, false)
+        ])
+        .is_healthy());
+        assert!(!status(vec![
+            check("database", true, true),
+            check("api", true, false)
+        ])
+        .is_healthy());
+    }
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_json() {
+        let status = status(vec![
+            check("database", true, true),
+            check("api", true, false),
+        ]);
+        let json = serde_json::to_value(&status).expect("Failed to serialize status!");
+
+        assert_eq!(
+            json,
+            serde_json::json!({
+                "frontier": {"taken_at": 1_000, "urls": 42},
+                "rows": {"pages": 10, "keywords": 200, "forward_links": 30},
+                "crawled_last_hour": 12,
+                "top_errors": [
+                    {"code": "timeout", "crawls": 5},
+                    {"code": "fetch", "crawls": 1},
+                ],
+                "checks": [
+                    {"name": "database", "critical": true, "passed": true, "detail": "Detail"},
+                    {"name": "api", "critical": true, "passed": false, "detail": "Detail"},
+                ],
+            })
+        );
+        assert_eq!(
+            serde_json::from_value::<Status>(json).expect("Failed to deserialize status!"),
+            status
+        );
+    }
+
+    #[test]
+    fn test_render() {
+        let dashboard = status(vec![
+            check("api", true, false),
+            check("crawler", false, false),
+        ])
+        .render(UNIX_EPOCH + Duration::from_secs(1_060));
+
+        assert!(dashboard.contains("Frontier:      42 URLs (snapshot from 60 seconds ago)"));
+        assert!(dashboard.contains("Keywords:      200"));
+        assert!(dashboard.contains("Top errors:    timeout (5), fetch (1)"));
+        assert!(dashboard.contains("  [FAIL] api: Detail"));
+        assert!(dashboard.contains("  [WARN] crawler: Detail"));
+    }
+
+    #[test]
+    fn test_get_health_url() {
+        assert_eq!(
+            get_health_url("0.0.0.0", 8080),
+            "http://127.0.0.1:8080/health"
+        );
+        assert_eq!(get_health_url("::1", 8080), "http://[::1]:8080/health");
+        assert_eq!(get_health_url("api", 80), "http://api:80/health");
+    }
+}
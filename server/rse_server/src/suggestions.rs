@@ -0,0 +1,307 @@
+use crate::search::{self, Shard};
+use common::utils;
+use common::utils::words::Dictionary;
+use log::{info, warn};
+use rust_stemmers::{Algorithm, Stemmer};
+use std::collections::HashMap;
+
+/// The letters misspelled words are corrected with.
+const ALPHABET: &str = "abcdefghijklmnopqrstuvwxyz";
+
+/// The weight given to the chance that a word that isn't in the vocabulary is spelled right, like a count of its own.
+const SMOOTHING: f64 = 5.0;
+
+/// Corrects the spelling of queries against the most common words of the index.
+///
+/// # Fields
+///
+/// * `words`: The most common stemmed words of the index, and how many keywords there are of each.
+#[derive(Debug, Default)]
+pub struct Suggester {
+    words: HashMap<String, u64>,
+}
+
+/// A corrected query.
+///
+/// # Fields
+///
+/// * `query`: The corrected query string.
+/// * `confidence`: How likely the corrected query is what was meant, between `0` and `1`.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Correction {
+    pub query: String,
+    pub confidence: f64,
+}
+
+impl Suggester {
+    /// Creates a new suggester.
+    ///
+    /// # Arguments
+    ///
+    /// * `words`: The stemmed words to correct spelling against, and how many keywords there are of each.
+    ///
+    /// # Returns
+    ///
+    /// * `Suggester` - The new suggester.
+    #[must_use]
+    pub const fn new(words: HashMap<String, u64>) -> Self {
+        Self { words }
+    }
+
+    /// Loads the most common words of every shard.
+    ///
+    /// # Arguments
+    ///
+    /// * `shards`: The database shards to load the words of.
+    ///
+    /// # Returns
+    ///
+    /// * `Suggester` - The suggester, without the words of the shards that failed.
+    ///
+    /// # Notes
+    ///
+    /// * The words are loaded once, when the server starts, and `SUGGESTION_VOCABULARY_SIZE` of `0` skips loading them.
+    pub async fn load(shards: &[Shard]) -> Self {
+        let size = utils::env::search::get_suggestion_vocabulary_size();
+        if size == 0 {
+            return Self::default();
+        }
+
+        let limit = i64::try_from(size).unwrap_or(i64::MAX);
+        let mut words = HashMap::new();
+        for (index, shard) in shards.iter().enumerate() {
+            match shard.store.get_word_counts(limit).await {
+                Ok(counts) => {
+                    for (word, count) in counts {
+                        *words.entry(word).or_insert(0) += u64::try_from(count).unwrap_or(0);
+                    }
+                }
+                Err(err) => warn!(
+                    "Failed to load the words of shard #{index}, correcting spelling without them! Error: {err}"
+                ),
+            }
+        }
+
+        info!("Loaded {} words to correct spelling against!", words.len());
+
+        Self::new(words)
+    }
+
+    /// Corrects the spelling of a query.
+    ///
+    /// # Arguments
+    ///
+    /// * `query`: The query string.
+    /// * `dictionary`: The stop words and protected words.
+    ///
+    /// # Returns
+    ///
+    /// * `Some(Correction)` - The corrected query, if any of its terms were corrected.
+    /// * `None` - If every term is known, or none of them could be corrected.
+    ///
+    /// # Notes
+    ///
+    /// * Only terms whose stem isn't in the vocabulary are corrected, to the most common known word one edit away.
+    /// * The confidence is that of every corrected term multiplied, so each correction makes it less likely.
+    #[must_use]
+    pub fn correct(&self, query: &str, dictionary: &Dictionary) -> Option<Correction> {
+        if self.words.is_empty() {
+            return None;
+        }
+
+        let stemmer = Stemmer::create(Algorithm::English);
+        let mut corrected = false;
+        let mut confidence = 1.0;
+        let mut terms = Vec::new();
+        for (field, term) in search::split_fields(query) {
+            let Some((word, term_confidence)) = self.correct_term(&stemmer, term, dictionary)
+            else {
+                terms.push(field.map_or_else(
+                    || term.to_string(),
+                    |field| format!("{}:{term}", field.as_str()),
+                ));
+
+                continue;
+            };
+
+            corrected = true;
+            confidence *= term_confidence;
+            terms.push(field.map_or_else(
+                || word.clone(),
+                |field| format!("{}:{word}", field.as_str()),
+            ));
+        }
+
+        corrected.then(|| Correction {
+            query: terms.join(" "),
+            confidence,
+        })
+    }
+
+    /// Corrects the spelling of a single term.
+    ///
+    /// # Arguments
+    ///
+    /// * `stemmer`: The stemmer of the index.
+    /// * `term`: The term, without its field.
+    /// * `dictionary`: The stop words and protected words.
+    ///
+    /// # Returns
+    ///
+    /// * `Some((String, f64))` - The corrected word, and the share of the known words one edit away it makes up.
+    /// * `None` - If the term is known, a stop word, not a plain word, or no known word is one edit away.
+    fn correct_term(
+        &self,
+        stemmer: &Stemmer,
+        term: &str,
+        dictionary: &Dictionary,
+    ) -> Option<(String, f64)> {
+        let word = term.to_lowercase();
+        if word.is_empty() || !word.chars().all(char::is_alphabetic) {
+            return None;
+        }
+
+        let stem = get_stem(stemmer, &word, dictionary)?;
+        if self.words.contains_key(&stem) {
+            return None;
+        }
+
+        // Edits that stem to the same word are the same candidate, spelled the shortest way.
+        let mut candidates = HashMap::<String, (String, u64)>::new();
+        for edit in get_edits(&word) {
+            let Some(stem) = get_stem(stemmer, &edit, dictionary) else {
+                continue;
+            };
+            let Some(&count) = self.words.get(&stem) else {
+                continue;
+            };
+
+            let (spelling, _) = candidates.entry(stem).or_insert((edit.clone(), count));
+            if (edit.len(), &edit) < (spelling.len(), &*spelling) {
+                *spelling = edit;
+            }
+        }
+
+        #[allow(clippy::cast_precision_loss)]
+        let total = candidates.values().map(|(_, count)| *count).sum::<u64>() as f64;
+        let (spelling, count) =
+            candidates
+                .into_values()
+                .max_by(|(spelling_a, count_a), (spelling_b, count_b)| {
+                    count_a
+                        .cmp(count_b)
+                        .then_with(|| spelling_b.cmp(spelling_a))
+                })?;
+
+        #[allow(clippy::cast_precision_loss)]
+        Some((spelling, count as f64 / (total + SMOOTHING)))
+    }
+}
+
+/// Stems a word the way the index does.
+///
+/// # Arguments
+///
+/// * `stemmer`: The stemmer of the index.
+/// * `word`: The lowercase word.
+/// * `dictionary`: The stop words and protected words.
+///
+/// # Returns
+///
+/// * `Some(String)` - The stemmed word, or the word itself if it's protected.
+/// * `None` - If the word is a stop word, which is never indexed.
+fn get_stem(stemmer: &Stemmer, word: &str, dictionary: &Dictionary) -> Option<String> {
+    if dictionary.is_stop_word(word) {
+        return None;
+    }
+
+    if dictionary.is_protected(word) {
+        return Some(word.to_string());
+    }
+
+    Some(stemmer.stem(word).to_string())
+}
+
+/// Gets every word one edit away from a word.
+///
+/// # Arguments
+///
+/// * `word`: The lowercase word.
+///
+/// # Returns
+///
+/// * `Vec<String>` - The words with a letter deleted, swapped with the next one, replaced or inserted.
+fn get_edits(word: &str) -> Vec<String> {
+    let letters = word.chars().collect::<Vec<_>>();
+    let join = |parts: &[&[char]]| parts.concat().into_iter().collect::<String>();
+
+    let mut edits = Vec::new();
+    for index in 0..=letters.len() {
+        let (head, tail) = letters.split_at(index);
+
+        if let Some((_, rest)) = tail.split_first() {
+            edits.push(join(&[head, rest]));
+        }
+        if let [first, second, rest @ ..] = tail {
+            edits.push(join(&[head, &[*second, *first], rest]));
+        }
+
+        for letter in ALPHABET.chars() {
+            if let Some((current, rest)) = tail.split_first() {
+                if *current != letter {
+                    edits.push(join(&[head, &[letter], rest]));
+                }
+            }
+
+            edits.push(join(&[head, &[letter], tail]));
+        }
+    }
+
+    edits
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_correct() {
+        let dictionary = Dictionary::new(vec!["the".to_string()], Vec::new())
+            .expect("Failed to create dictionary!");
+        let suggester = Suggester::new(HashMap::from([
+            ("rust".to_string(), 1_000),
+            ("program".to_string(), 400),
+            ("cat".to_string(), 10),
+            ("car".to_string(), 10),
+        ]));
+
+        // Known words and stop words are left alone, and fields are kept.
+        let correction = suggester
+            .correct("the title:russt Programming", &dictionary)
+            .expect("Failed to correct query!");
+        assert_eq!(correction.query, "the title:rust Programming");
+        assert!(correction.confidence > 0.99);
+
+        // Corrections between words that are as common aren't confident.
+        let correction = suggester
+            .correct("cav", &dictionary)
+            .expect("Failed to correct query!");
+        assert!(correction.confidence < 0.5);
+
+        // Words that are known, or too far from every known word, aren't corrected.
+        assert_eq!(suggester.correct("rust programs", &dictionary), None);
+        assert_eq!(suggester.correct("zyxwv", &dictionary), None);
+        assert_eq!(Suggester::default().correct("russt", &dictionary), None);
+    }
+
+    #[test]
+    fn test_get_edits() {
+        let edits = get_edits("ab");
+
+        for edit in ["b", "a", "ba", "bb", "aab", "abc", "cab"] {
+            assert!(edits.contains(&edit.to_string()), "{edit}");
+        }
+        assert!(!edits.contains(&"ab".to_string()));
+    }
+}
@@ -0,0 +1,320 @@
+use crate::search::Shard;
+use actix_web::web;
+use common::errors::Error;
+use common::utils;
+use common::utils::words::Dictionary;
+use log::{info, warn};
+use rust_stemmers::Algorithm;
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::sync::RwLock;
+use std::time::Duration;
+
+/// The maximum number of words looked up in one request.
+pub const MAXIMUM_WORDS: usize = 100;
+
+/// The query of the term statistics.
+///
+/// # Fields
+///
+/// * `word`: Comma separated words to get the statistics of, like `rust,search`.
+#[derive(Debug, Deserialize)]
+pub struct Query {
+    pub word: String,
+}
+
+/// How common a stemmed word is in the index.
+///
+/// # Fields
+///
+/// * `pages`: The number of pages the word is on, its document frequency.
+/// * `frequency`: The number of times the word occurs on those pages in total.
+/// * `rank`: The place of the word among all words, ordered by the number of pages they're on, starting at `1`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+pub struct Stats {
+    pub pages: i64,
+    pub frequency: i64,
+    pub rank: usize,
+}
+
+/// The statistics of a word that was looked up.
+///
+/// # Fields
+///
+/// * `word`: The word as it was asked for.
+/// * `stem`: The stemmed word the index has it as, if it isn't a stop word.
+/// * `stats`: How common the stemmed word is, if it's in the index.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Term {
+    pub word: String,
+    pub stem: Option<String>,
+    #[serde(flatten)]
+    pub stats: Option<Stats>,
+}
+
+/// The statistics of the words that were looked up.
+///
+/// # Fields
+///
+/// * `terms`: The statistics of each word, in the order they were asked for.
+/// * `vocabulary`: The number of distinct stemmed words in the index, the lowest possible rank.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Output {
+    pub terms: Vec<Term>,
+    pub vocabulary: usize,
+}
+
+/// An in-memory cache of the statistics of every stemmed word in the index.
+///
+/// # Fields
+///
+/// * `words`: The statistics of each word, `None` until they've been aggregated.
+#[derive(Debug, Default)]
+pub struct Terms {
+    words: RwLock<Option<HashMap<String, Stats>>>,
+}
+
+impl Terms {
+    /// Creates a new cache of term statistics.
+    ///
+    /// # Arguments
+    ///
+    /// * `words`: Each word, the number of pages it's on and its total frequency.
+    ///
+    /// # Returns
+    ///
+    /// * `Terms` - The new cache.
+    #[must_use]
+    pub fn new(words: Vec<(String, i64, i64)>) -> Self {
+        Self {
+            words: RwLock::new(Some(rank(words))),
+        }
+    }
+
+    /// Replaces the cached term statistics with those aggregated from every shard.
+    ///
+    /// # Arguments
+    ///
+    /// * `shards`: The database shards to aggregate the keywords of.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(usize)` - The number of words if successful.
+    /// * `Err(Error)` - If the keywords of a shard could not be aggregated.
+    ///
+    /// # Errors
+    ///
+    /// * If the keywords of any shard could not be aggregated, since the ranks would be wrong without them.
+    pub async fn refresh(&self, shards: &[Shard]) -> Result<usize, Error> {
+        let mut totals = HashMap::<String, (i64, i64)>::new();
+        for shard in shards {
+            for (word, pages, frequency) in shard.store.get_term_stats().await? {
+                let total = totals.entry(word).or_default();
+                total.0 += pages;
+                total.1 += frequency;
+            }
+        }
+
+        let words = rank(
+            totals
+                .into_iter()
+                .map(|(word, (pages, frequency))| (word, pages, frequency))
+                .collect(),
+        );
+        let vocabulary = words.len();
+        if let Ok(mut cached) = self.words.write() {
+            *cached = Some(words);
+        }
+
+        Ok(vocabulary)
+    }
+
+    /// Aggregates the term statistics in the background, right away and then again after each interval.
+    ///
+    /// # Arguments
+    ///
+    /// * `terms`: The cache to fill.
+    /// * `shards`: The database shards to aggregate the keywords of.
+    /// * `interval`: The time between each aggregation, `0` to only aggregate them on start.
+    ///
+    /// # Notes
+    ///
+    /// * Aggregating every keyword is expensive, so the server starts without waiting for it.
+    pub fn refresh_every(
+        terms: web::Data<Self>,
+        shards: web::Data<Vec<Shard>>,
+        interval: Duration,
+    ) {
+        actix_web::rt::spawn(async move {
+            loop {
+                match terms.refresh(&shards).await {
+                    Ok(vocabulary) => info!("Aggregated the statistics of {vocabulary} terms!"),
+                    Err(err) => warn!(
+                        "Failed to aggregate term statistics, keeping the old ones! Error: {err}"
+                    ),
+                }
+
+                if interval.is_zero() {
+                    break;
+                }
+
+                actix_web::rt::time::sleep(interval).await;
+            }
+        });
+    }
+
+    /// Looks up the statistics of words.
+    ///
+    /// # Arguments
+    ///
+    /// * `query`: Comma separated words.
+    /// * `dictionary`: The stop words and protected words, to stem the words like the index does.
+    ///
+    /// # Returns
+    ///
+    /// * `Ok(Output)` - The statistics of each word.
+    /// * `Err(Error)` - If the query is invalid, or the statistics haven't been aggregated yet.
+    ///
+    /// # Errors
+    ///
+    /// * If there are no words, or more than `MAXIMUM_WORDS`.
+    /// * If the statistics haven't been aggregated yet, or the cache is poisoned.
+    pub fn get(&self, query: &str, dictionary: &Dictionary) -> Result<Output, Error> {
+        let requested = query
+            .split(',')
+            .map(str::trim)
+            .filter(|word| !word.is_empty())
+            .collect::<Vec<_>>();
+        if requested.is_empty() {
+            return Err(Error::Query("No words to get the statistics of!".into()));
+        }
+
+        if requested.len() > MAXIMUM_WORDS {
+            return Err(Error::Query(format!(
+                "At most {MAXIMUM_WORDS} words can be looked up at once!"
+            )));
+        }
+
+        let cached = self.words.read()?;
+        let Some(words) = cached.as_ref() else {
+            return Err(Error::Unavailable(
+                "The term statistics are still being aggregated!".into(),
+            ));
+        };
+
+        let terms = requested
+            .into_iter()
+            .map(|word| {
+                let stem = utils::words::extract(word, Algorithm::English, dictionary)
+                    .into_keys()
+                    .next();
+                let stats = stem.as_ref().and_then(|stem| words.get(stem)).copied();
+
+                Term {
+                    word: word.to_string(),
+                    stem,
+                    stats,
+                }
+            })
+            .collect();
+
+        Ok(Output {
+            terms,
+            vocabulary: words.len(),
+        })
+    }
+}
+
+/// Ranks words by the number of pages they're on.
+///
+/// # Arguments
+///
+/// * `words`: Each word, the number of pages it's on and its total frequency.
+///
+/// # Returns
+///
+/// * `HashMap<String, Stats>` - The statistics of each word.
+///
+/// # Notes
+///
+/// * Words on as many pages share a rank, and the next rank skips past them, like `1, 2, 2, 4`.
+fn rank(mut words: Vec<(String, i64, i64)>) -> HashMap<String, Stats> {
+    words.sort_by(|(_, pages_a, _), (_, pages_b, _)| pages_b.cmp(pages_a));
+
+    let mut ranked = HashMap::with_capacity(words.len());
+    let mut rank = 0;
+    let mut previous_pages = None;
+    for (index, (word, pages, frequency)) in words.into_iter().enumerate() {
+        if previous_pages != Some(pages) {
+            rank = index + 1;
+            previous_pages = Some(pages);
+        }
+
+        ranked.insert(
+            word,
+            Stats {
+                pages,
+                frequency,
+                rank,
+            },
+        );
+    }
+
+    ranked
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    #[allow(clippy::expect_used)]
+    fn test_get() {
+        let terms = Terms::new(vec![
+            ("rust".into(), 10, 42),
+            ("search".into(), 4, 9),
+            ("engin".into(), 4, 5),
+            ("crawl".into(), 1, 1),
+        ]);
+        let dictionary = Dictionary::default();
+
+        let output = terms
+            .get("Rust, engines ,crawl,unknown", &dictionary)
+            .expect("Failed to get term statistics!");
+        assert_eq!(output.vocabulary, 4);
+        assert_eq!(
+            output
+                .terms
+                .iter()
+                .map(|term| (term.stem.as_deref(), term.stats.map(|stats| stats.rank)))
+                .collect::<Vec<_>>(),
+            vec![
+                (Some("rust"), Some(1)),
+                (Some("engin"), Some(2)),
+                (Some("crawl"), Some(4)),
+                (Some("unknown"), None),
+            ]
+        );
+        assert_eq!(
+            output.terms[0].stats,
+            Some(Stats {
+                pages: 10,
+                frequency: 42,
+                rank: 1,
+            })
+        );
+
+        assert!(matches!(
+            terms.get(" , ", &dictionary),
+            Err(Error::Query(_))
+        ));
+        assert!(matches!(
+            terms.get(&vec!["rust"; MAXIMUM_WORDS + 1].join(","), &dictionary),
+            Err(Error::Query(_))
+        ));
+        assert!(matches!(
+            Terms::default().get("rust", &dictionary),
+            Err(Error::Unavailable(_))
+        ));
+    }
+}
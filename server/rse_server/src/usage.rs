@@ -0,0 +1,184 @@
+use common::database::model::CrawlUsage;
+use common::utils;
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::time::SystemTime;
+
+/// The number of top consumers to report.
+pub const TOP_CONSUMERS: usize = 25;
+
+/// The period to report the crawl usage over.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Period {
+    /// Today, in UTC.
+    #[default]
+    Day,
+    /// Today and the 6 days before it, in UTC.
+    Week,
+}
+
+/// What to group the crawl usage by.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Group {
+    /// The host the requests were made to.
+    #[default]
+    Host,
+    /// The crawl run that made the requests.
+    Run,
+}
+
+/// The query of a crawl usage report.
+///
+/// # Fields
+///
+/// * `period`: The period to report the usage over, defaults to the current day.
+/// * `by`: What to group the usage by, defaults to the host.
+#[derive(Debug, Default, Deserialize)]
+pub struct Query {
+    #[serde(default)]
+    pub period: Period,
+    #[serde(default)]
+    pub by: Group,
+}
+
+/// A consumer of crawl bandwidth.
+///
+/// # Fields
+///
+/// * `key`: The host or the ID of the crawl run.
+/// * `bytes`: The bytes downloaded.
+/// * `requests`: The requests made.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Consumer {
+    pub key: String,
+    pub bytes: i64,
+    pub requests: i64,
+}
+
+/// Gets the start of a period.
+///
+/// # Arguments
+///
+/// * `period`: The period.
+/// * `now`: The current time.
+///
+/// # Returns
+///
+/// * `SystemTime` - The start of the first day of the period.
+#[must_use]
+pub fn get_since(period: Period, now: SystemTime) -> SystemTime {
+    let today = utils::usage::get_day(now);
+
+    match period {
+        Period::Day => today,
+        Period::Week => today.checked_sub(utils::usage::DAY * 6).unwrap_or(today),
+    }
+}
+
+/// Aggregates the crawl usage into its top consumers.
+///
+/// # Arguments
+///
+/// * `usage`: The crawl usage per day, run and host.
+/// * `by`: What to group the usage by.
+/// * `limit`: The maximum number of consumers to return.
+///
+/// # Returns
+///
+/// * `Vec<Consumer>` - The consumers, most bytes first.
+#[must_use]
+pub fn aggregate(usage: &[CrawlUsage], by: Group, limit: usize) -> Vec<Consumer> {
+    let mut totals: HashMap<&str, (i64, i64)> = HashMap::new();
+    for entry in usage {
+        let key = match by {
+            Group::Host => entry.host.as_str(),
+            Group::Run => entry.run_id.as_str(),
+        };
+
+        let (bytes, requests) = totals.entry(key).or_insert((0, 0));
+        *bytes = bytes.saturating_add(entry.bytes);
+        *requests = requests.saturating_add(entry.requests);
+    }
+
+    let mut consumers = totals
+        .into_iter()
+        .map(|(key, (bytes, requests))| Consumer {
+            key: key.to_string(),
+            bytes,
+            requests,
+        })
+        .collect::<Vec<_>>();
+    consumers.sort_by(|a, b| b.bytes.cmp(&a.bytes).then_with(|| a.key.cmp(&b.key)));
+    consumers.truncate(limit);
+
+    consumers
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::time::{Duration, UNIX_EPOCH};
+
+    #[test]
+    fn test_get_since() {
+        let midnight = UNIX_EPOCH + utils::usage::DAY * 20_000;
+        let now = midnight + Duration::from_secs(12 * 60 * 60);
+
+        assert_eq!(get_since(Period::Day, now), midnight);
+        assert_eq!(
+            get_since(Period::Week, now),
+            midnight - utils::usage::DAY * 6
+        );
+    }
+
+    #[test]
+    fn test_aggregate() {
+        let day = UNIX_EPOCH + utils::usage::DAY * 20_000;
+        let entry = |day, run_id: &str, host: &str, bytes, requests| CrawlUsage {
+            day,
+            run_id: run_id.into(),
+            host: host.into(),
+            bytes,
+            requests,
+        };
+        let usage = vec![
+            entry(day, "a", "example.com", 1_000, 2),
+            entry(day + utils::usage::DAY, "a", "example.com", 500, 1),
+            entry(day, "b", "example.com", 250, 1),
+            entry(day, "a", "other.com", 2_000, 4),
+            entry(day, "b", "small.com", 250, 3),
+        ];
+
+        assert_eq!(
+            aggregate(&usage, Group::Host, TOP_CONSUMERS),
+            vec![
+                Consumer {
+                    key: "other.com".into(),
+                    bytes: 2_000,
+                    requests: 4,
+                },
+                Consumer {
+                    key: "example.com".into(),
+                    bytes: 1_750,
+                    requests: 4,
+                },
+                Consumer {
+                    key: "small.com".into(),
+                    bytes: 250,
+                    requests: 3,
+                },
+            ]
+        );
+        assert_eq!(
+            aggregate(&usage, Group::Run, 1),
+            vec![Consumer {
+                key: "a".into(),
+                bytes: 3_500,
+                requests: 7,
+            }]
+        );
+        assert!(aggregate(&[], Group::Host, TOP_CONSUMERS).is_empty());
+    }
+}